@@ -22,11 +22,11 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/gliderlabs/ssh"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 	rawssh "golang.org/x/crypto/ssh"
 
 	"github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/remote/sshd"
 	"github.com/tensorchord/envd/pkg/version"
 )
@@ -89,11 +89,7 @@ func main() {
 	app.Before = func(context *cli.Context) error {
 		debugEnabled = context.Bool(flagDebug)
 
-		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
-		if debugEnabled {
-			logrus.SetLevel(logrus.DebugLevel)
-		}
-		return nil
+		return log.Setup(log.Options{Debug: debugEnabled})
 	}
 
 	app.Action = sshServer
@@ -103,7 +99,7 @@ func main() {
 func sshServer(c *cli.Context) error {
 	err := sshd.GetShell(c.String(flagShell))
 	if err != nil {
-		logrus.Fatal(err.Error())
+		log.Fatal(err.Error())
 	}
 	shell := c.String(flagShell)
 
@@ -128,9 +124,9 @@ func sshServer(c *cli.Context) error {
 			return errors.Errorf("failed to load authorized keys: no keys found at %s", path)
 		}
 
-		logrus.Debugf("loaded %d authorized keys from %s", len(keys), path)
+		log.Debugf("loaded %d authorized keys from %s", len(keys), path)
 	} else {
-		logrus.Warn("no authentication enabled")
+		log.Warn("no authentication enabled")
 	}
 
 	var hostKey ssh.Signer = nil
@@ -144,7 +140,7 @@ func sshServer(c *cli.Context) error {
 		if privateKey, err := rawssh.ParsePrivateKey(pemBytes); err != nil {
 			return err
 		} else {
-			logrus.Debugf("load host key from %s", c.String(flagHostKey))
+			log.Debugf("load host key from %s", c.String(flagHostKey))
 			hostKey = privateKey
 		}
 	}
@@ -156,7 +152,7 @@ func sshServer(c *cli.Context) error {
 		Hostkey:        hostKey,
 	}
 
-	logrus.Infof("ssh server %s started in 0.0.0.0:%d", version.GetVersion().String(), srv.Port)
+	log.Infof("ssh server %s started in 0.0.0.0:%d", version.GetVersion().String(), srv.Port)
 	return srv.ListenAndServe()
 }
 
@@ -15,8 +15,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/cockroachdb/errors"
 	"github.com/spf13/viper"
@@ -26,6 +29,8 @@ import (
 	"go.starlark.net/syntax"
 
 	"github.com/tensorchord/envd/pkg/app"
+	"github.com/tensorchord/envd/pkg/builder"
+	"github.com/tensorchord/envd/pkg/errdefs"
 	"github.com/tensorchord/envd/pkg/flag"
 	"github.com/tensorchord/envd/pkg/version"
 )
@@ -35,8 +40,13 @@ func run(args []string) error {
 		fmt.Println(c.App.Name, version.Package, c.App.Version, version.Revision)
 	}
 
+	// Cancel the context on Ctrl-C, thus the network operations and
+	// the buildkit solves in the commands are aborted promptly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	app := app.New()
-	return app.Run(args)
+	return app.RunContext(ctx, args)
 }
 
 func handleErr(err error) {
@@ -58,8 +68,27 @@ func handleErr(err error) {
 	} else if ok := errors.As(err, &resolveErr); ok {
 		fmt.Fprintf(os.Stderr, "%+v\n", resolveErr)
 	} else {
+		// Point at the lines in the build file if the build step fails.
+		var bkErr *builder.BuildkitdErr
+		if ok := errors.As(err, &bkErr); ok {
+			for _, s := range bkErr.Sources() {
+				if err := s.Print(os.Stderr); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to print the source: %v\n", err)
+				}
+			}
+		}
 		fmt.Fprintf(os.Stderr, "error: %v\n", errors.Cause(err))
 	}
+	// Tell the users what to do next if the failure is known.
+	if h, ok := errdefs.GetHint(err); ok {
+		if h.Cause != errors.Cause(err).Error() {
+			fmt.Fprintf(os.Stderr, "cause: %s\n", h.Cause)
+		}
+		fmt.Fprintf(os.Stderr, "hint: %s\n", h.Suggestion)
+		if h.DocsURL != "" {
+			fmt.Fprintf(os.Stderr, "docs: %s\n", h.DocsURL)
+		}
+	}
 	os.Exit(1)
 }
 
@@ -60,7 +60,7 @@ var _ = Describe("up command", Ordered, func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			destroyArgs := append(baseArgs, []string{
-				"destroy", "--path", buildContext,
+				"destroy", "--yes", "--path", buildContext,
 			}...)
 			err = envdApp.Run(destroyArgs)
 			Expect(err).NotTo(HaveOccurred())
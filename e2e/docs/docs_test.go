@@ -58,7 +58,7 @@ var _ = Describe("check examples in documentation", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		destroyArgs := append(baseArgs, []string{
-			"destroy", "--path", buildContext,
+			"destroy", "--yes", "--path", buildContext,
 		}...)
 		err = envdApp.Run(destroyArgs)
 		Expect(err).NotTo(HaveOccurred())
@@ -77,7 +77,7 @@ var _ = Describe("check examples in documentation", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			destroyArgs := append(baseArgs, []string{
-				"destroy", "--path", v,
+				"destroy", "--yes", "--path", v,
 			}...)
 			err = envdApp.Run(destroyArgs)
 			Expect(err).NotTo(HaveOccurred())
@@ -155,7 +155,7 @@ func (e *Example) DestroyContainer() func() {
 	return func() {
 		buildContext := e.BuildContextPath
 		args := []string{
-			"envd.test", "--debug", "destroy", "--path", buildContext,
+			"envd.test", "--debug", "destroy", "--yes", "--path", buildContext,
 		}
 		err := e.app.Run(args)
 		if err != nil {
@@ -21,36 +21,150 @@ Please update the python file there instead of directly editing file inside envd
 :::
 """
 
-from typing import Optional
+from typing import Callable, List, Optional
 
 
 def base(os: str, language: str, image: Optional[str]):
     """Set base image
 
+    In the build file of `# syntax=v1`, the arguments are keyword-only, and the `os` is
+    set by `os(name, version)` instead. The build file without the header is `v0`.
+
     Args:
-        os (str): The operating system (i.e. `ubuntu20.04`)
+        os (str): Deprecated, use `os(name, version)` instead. The operating system
+            (i.e. `ubuntu20.04`, `ubuntu22.04`, `debian11`)
         language (str): The programing language dependency (i.e. `python3.8`)
         image (Optional[str]): Custom image (i.e. `python:3.9-slim`)
+
+    Example usage:
+    ```
+    # syntax=v1
+
+    def build():
+        os(name="ubuntu", version="22.04")
+        base(language="python3.9")
+    ```
+    """
+
+
+def os(name: str, version: str):
+    """Set the OS family and version of the base image
+
+    The supported ones are ubuntu 18.04, 20.04 and 22.04, and debian 11.
+    CUDA is only supported on ubuntu, and the R and Julia environments
+    are only supported on ubuntu 20.04.
+
+    Args:
+        name (str): The OS family (i.e. `ubuntu`, `debian`)
+        version (str): The OS version (i.e. `22.04`, `11`)
+
+    Example:
+    ```
+    os(name="ubuntu", version="22.04")
+    ```
     """
 
 
-def shell(name: str):
+def target(name: str) -> bool:
+    """Check the build target
+
+    The target is set by `envd build --target`, and it is `dev` by default.
+    The targets other than `dev` are the production images, thus envd-sshd
+    and the prompt are not installed, and the entrypoint is the one set by
+    `config.entrypoint`. The package stages are shared between the targets.
+
+    Args:
+        name (str): The target name (i.e. `dev`, `prod`)
+
+    Example:
+    ```
+    def build():
+        base(os="ubuntu20.04", language="python3")
+        install.python_packages(["numpy"])
+        if target("dev"):
+            shell("zsh")
+            install.vscode_extensions(["ms-python.python"])
+    ```
+    """
+
+
+def environment(name: str, build: Callable[[], None]):
+    """Declare the named environment in the build file
+
+    The build file could declare several environments, e.g. `cpu`, `gpu` and `docs`,
+    and one of them is selected by `envd build --env` or `envd up --env`. The image
+    is tagged `PROJECT-NAME:dev` and the container is named `PROJECT-NAME`, thus the
+    environments do not collide.
+
+    Args:
+        name (str): The environment name (i.e. `gpu`), lowercase letters, digits,
+            `_`, `.` and `-`
+        build (Callable[[], None]): The function building the environment
+
+    Example:
+    ```
+    def _common():
+        os(name="ubuntu", version="20.04")
+        base(language="python3")
+        install.python_packages(["numpy"])
+
+    def build_cpu():
+        _common()
+
+    def build_gpu():
+        _common()
+        install.cuda(version="11.6.2", cudnn="8")
+
+    environment("cpu", build_cpu)
+    environment("gpu", build_gpu)
+    ```
+    """
+
+
+def shell(name: str, plugins: Optional[List[str]] = None, theme: Optional[str] = None):
     """Interactive shell
 
     Args:
-        name (str): shell name (i.e. `zsh`, `bash`)
+        name (str): shell name (i.e. `zsh`, `bash`, `fish`)
+        plugins (Optional[List[str]]): oh-my-zsh plugins in the zshrc for zsh
+            (i.e. `["git", "autojump"]`), the tools used by the plugins should be
+            installed by `install.apt_packages`. For bash, they are the bash-it
+            plugins (i.e. `["git", "history"]`). For fish, they are the fisher
+            plugins (i.e. `["PatrickF1/fzf.fish", "ilancosman/tide@v5"]`)
+        theme (Optional[str]): oh-my-zsh theme in the zshrc for zsh (i.e. `ys`), or
+            the bash-it theme for bash (i.e. `powerline`). Not supported by fish
+
+    The `.bashrc` is replaced by the sensible defaults if `bash` is chosen
+    explicitly, and bash-it is installed if the plugins or the theme are set.
+
+    Example:
+    ```
+    shell("zsh", plugins=["git", "autojump"], theme="ys")
+    shell("bash", plugins=["git", "history"])
+    shell("fish", plugins=["PatrickF1/fzf.fish"])
+    ```
     """
 
 
-def run(commands: str):
+def run(
+    commands: str, shell: Optional[str] = None, allow: Optional[List[str]] = None
+):
     """Execute command
 
     Args:
         commands (str): command to run during the building process
+        shell (Optional[str]): shell to run the commands by `<shell> -c` in their own stage
+            (i.e. `bash -eo pipefail`), thus the failure in the pipeline fails the build.
+            The adjacent runs without the shell are merged into one stage.
+        allow (Optional[List[str]]): grants of the commands in `envd build --sandbox`,
+            i.e. `network`, `context` (the build context) and `proxy` (the proxy env).
+            The commands in the sandbox have none of them by default.
 
     Example:
     ```
     run(commands=["conda install -y -c conda-forge exa"])
+    run(commands=["curl -fsSL https://example.com/install.sh | bash"], shell="bash -eo pipefail")
+    run(commands=["git clone https://github.com/example/repo.git"], allow=["network"])
     ```
     """
 
@@ -74,21 +188,30 @@ def git_config(
     """
 
 
-def include(git: str):
-    """Import from another git repo
+def include(git: Optional[str] = None, path: Optional[str] = None):
+    """Import from another git repo or the local build files
 
     This will pull the git repo and execute all the `envd` files. The return value will be a module
     contains all the variables/functions defined (expect those has `_` prefix).
 
+    The local `path` can be a file or a directory of `envd` files, e.g. the settings shared by
+    the team. It is relative to the file which includes it. The `load` statement resolves the
+    relative paths in the same way.
+
     Args:
-        git (str): git URL
+        git (Optional[str]): git URL
+        path (Optional[str]): path to the local build file or directory
 
     Example usage:
     ```
     envd = include("https://github.com/tensorchord/envdlib")
+    team = include(path="../shared/team.envd")
+    load("../shared/packages.envd", "common_packages")
 
     def build():
         base(os="ubuntu20.04", language="python")
         envd.tensorboard(8000)
+        team.base_settings()
+        install.python_packages(name=common_packages)
     ```
     """
@@ -0,0 +1,46 @@
+# Copyright 2022 The envd Authors
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Build argument functions
+
+::: tip
+Note that the documentation is automatically generated from [envd/api](https://github.com/tensorchord/envd/tree/main/envd/api) folder
+in [tensorchord/envd](https://github.com/tensorchord/envd/tree/main/envd/api) repo.
+Please update the python file there instead of directly editing file inside envd-docs repo.
+:::
+"""
+
+
+from typing import Optional
+
+
+def get(name: str, default: Optional[str] = None) -> Optional[str]:
+    """Read the build argument passed by `envd build --arg`
+
+    One build file can parameterize the versions and the flags without being edited.
+    The image is rebuilt if the arguments change, and the arguments passed but not read
+    by the build file are warned about, e.g. the typos.
+
+    Args:
+        name (str): name of the build argument
+        default (Optional[str]): returned if the argument is not passed
+
+    Example usage:
+    ```
+    def build():
+        install.cuda(version=args.get("CUDA", "11.6.2"), cudnn="8")
+    ```
+
+    Then build it with `envd build --arg CUDA=11.7`.
+    """
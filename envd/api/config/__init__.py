@@ -21,7 +21,7 @@ Please update the python file there instead of directly editing file inside envd
 :::
 """
 
-from typing import Optional, List
+from typing import Any, Dict, Optional, List
 
 
 def apt_source(source: Optional[str]):
@@ -89,16 +89,23 @@ def conda_channel(channel: str):
     """
 
 
-def entrypoint(args: List[str]):
-    """Configure entrypoint for custom base image
+def entrypoint(args: List[str], replace: bool = False):
+    """Configure entrypoint
+
+    It is the entrypoint of the custom base image. In the other images, the
+    command runs along with the envd-sshd, e.g. a supervisor or a server,
+    and the environment stops if it exits.
 
     Example usage:
     ```
     config.entrypoint(["date", "-u"])
+    config.entrypoint(["supervisord", "-n"], replace=True)
     ```
 
     Args:
         args (List[str]): list of arguments to run
+        replace (bool): Run the command instead of the envd-sshd, thus
+            `envd up` cannot attach to the environment via ssh
     """
 
 
@@ -136,3 +143,289 @@ def rstudio_server():
     """
     Enable the RStudio Server (only work for `base(os="ubuntu20.04", language="r")`)
     """
+
+
+def code_server(port: Optional[int] = None):
+    """Enable code-server, i.e. vscode in the browser
+
+    code-server shares the extensions in `install.vscode_extensions` and the settings
+    in `config.vscode` with the vscode server. It is served without the password,
+    since the port is only published to the localhost.
+
+    Args:
+        port (Optional[int]): Port of code-server in the host, a free port if not set
+    """
+
+
+def shell_rc(content: str):
+    """Append the content to the rc files of the shells, i.e. `.bashrc` and `.zshrc`
+
+    It can be invoked more than once, the contents are appended in order.
+
+    Example:
+    ```
+    config.shell_rc(content="alias ll='ls -alF'\nexport EDITOR=vim")
+    ```
+
+    Args:
+        content (str): lines appended to the shell rc, e.g. the aliases and the env
+    """
+
+
+def pip_lock(require_hashes: bool = False, no_deps: bool = False):
+    """Install the PyPI packages from `envd.lock` instead of resolving them
+
+    All the PyPI packages in the lockfile are installed in one step, thus the
+    build fails if the packages in the build file are not locked. Run `envd lock`
+    after changing them.
+
+    Example:
+    ```
+    config.pip_lock(require_hashes=True, no_deps=True)
+    ```
+
+    Args:
+        require_hashes (bool): Only install the distributions with the sha256 digests
+            in the lockfile, which are resolved from PyPI by `envd lock`
+        no_deps (bool): Do not resolve the dependencies, since they are locked too
+    """
+
+
+def authorized_keys(paths: Optional[List[str]] = None):
+    """Authorize the public keys on the host in the environment
+
+    The standard `ssh` client works with the keys besides `envd ssh`, e.g.
+    `ssh -p <port> envd@localhost`. It can be invoked more than once.
+
+    Example:
+    ```
+    config.authorized_keys(paths=["~/.ssh/id_ed25519.pub", "keys/alice.pub"])
+    ```
+
+    Args:
+        paths (Optional[List[str]]): Paths to the public key files, relative paths are
+            relative to the build context. Default: `~/.ssh/id_*.pub`
+    """
+
+
+def stage_limits(timeout: str = "", max_log_size: str = ""):
+    """Limit the stages of the packages and the commands in the build
+
+    The stage exceeding the timeout fails the build, instead of hanging the CI.
+
+    Example:
+    ```
+    config.stage_limits(timeout="30m", max_log_size="2MiB")
+    ```
+
+    Args:
+        timeout (str): Timeout of each stage, e.g. `30m`, `1h`
+        max_log_size (str): Size of the output kept for each stage, e.g. `2MiB`,
+            the output beyond it is clipped
+    """
+
+
+def known_hosts(
+    hosts: Optional[List[str]] = None, entries: Optional[List[str]] = None
+):
+    """Bake the ssh host keys into `/etc/ssh/ssh_known_hosts`
+
+    Thus ssh, e.g. `git clone git@github.com:...`, does not prompt for the host keys
+    in the non-tty build steps and commands.
+
+    Example:
+    ```
+    config.known_hosts(hosts=["github.com"], entries=["git.example.com ssh-ed25519 AAAA..."])
+    ```
+
+    Args:
+        hosts (Optional[List[str]]): Hosts whose verified keys are built in, i.e. `github.com`
+            and `gitlab.com`. Default: both of them if no entry is passed
+        entries (Optional[List[str]]): Lines in the known_hosts format, e.g. from
+            `ssh-keyscan` after verifying the fingerprints
+    """
+
+
+def vscode_marketplace(vendor: str, url: Optional[str] = None):
+    """Set the marketplace where the vscode extensions are downloaded
+
+    The extensions are downloaded from Open VSX by default. The Microsoft marketplace
+    requires the versions of the extensions to be pinned. It is usually set in the
+    user or the organization config, e.g. to use the internal mirror.
+
+    Example:
+    ```
+    config.vscode_marketplace(vendor="openvsx", url="https://open-vsx.example.com")
+    ```
+
+    Args:
+        vendor (str): `openvsx` or `vscode`
+        url (Optional[str]): URL of the mirror of the marketplace, the vendor's
+            default endpoint if not set
+    """
+
+
+def vscode(
+    settings: Optional[Dict[str, Any]] = None,
+    keybindings: Optional[List[Dict[str, Any]]] = None,
+    server_version: Optional[str] = None,
+):
+    """Ship the vscode settings, keybindings and vscode-server with the environment
+
+    The settings are written to the machine settings of the vscode server, thus the
+    team-standard editor settings apply to everyone connecting to the environment.
+    The keybindings are only read by the web-based vscode, since the desktop vscode
+    uses the local keybindings in the remote environments.
+
+    The vscode-server of the `server_version` is downloaded in the host cache and
+    installed in the image, thus VS Code of the same version does not download it on
+    the first connection, e.g. in the air-gapped environments.
+
+    Example:
+    ```
+    config.vscode(
+        settings={"editor.formatOnSave": True, "python.formatting.provider": "black"},
+        keybindings=[{"key": "ctrl+shift+t", "command": "workbench.action.terminal.new"}],
+        server_version="1.85.1",
+    )
+    ```
+
+    Args:
+        settings (Optional[Dict[str, Any]]): vscode settings, which override the
+            ones set before
+        keybindings (Optional[List[Dict[str, Any]]]): vscode keybindings, each one
+            requires the `key`
+        server_version (Optional[str]): VS Code version (e.g. `1.85.1`) or the commit
+            of the release, whose vscode-server is installed
+    """
+
+
+def oh_my_zsh(
+    revision: Optional[str] = None,
+    url: Optional[str] = None,
+    tarball: Optional[str] = None,
+):
+    """Pin the revision and the source of oh-my-zsh installed for zsh
+
+    oh-my-zsh is cloned in the host cache with depth 1, and the commit which the
+    revision is resolved to is used until `envd cache refresh` updates it. The
+    `master` branch of GitHub is used by default. It is usually set in the user or
+    the organization config, e.g. to use the internal mirror.
+
+    Example:
+    ```
+    config.oh_my_zsh(
+        url="https://git.example.com/mirror/ohmyzsh.git",
+        tarball="~/Downloads/ohmyzsh-master.tar.gz",
+    )
+    ```
+
+    Args:
+        revision (Optional[str]): branch, tag or the full commit hash of oh-my-zsh.
+            The commit is cloned with the whole history, and it is never updated
+        url (Optional[str]): git repository of oh-my-zsh, e.g. the internal mirror
+        tarball (Optional[str]): local `.tar.gz` archive of oh-my-zsh, e.g. the
+            GitHub archive, which is installed if the repository is unreachable
+    """
+
+
+def timezone(name: str):
+    """Set the timezone of the environment
+
+    `tzdata` is installed and the timezone is linked to `/etc/localtime`.
+
+    Example:
+    ```
+    config.timezone("Asia/Shanghai")
+    ```
+
+    Args:
+        name (str): timezone in the tz database, e.g. `Europe/Berlin`
+    """
+
+
+def locale(name: str):
+    """Generate the locale and use it as the default one
+
+    Example:
+    ```
+    config.locale("en_US.UTF-8")
+    ```
+
+    Args:
+        name (str): locale with the charset, e.g. `zh_CN.UTF-8`
+    """
+
+
+def ca_certificates(paths: List[str]):
+    """Trust the CA certificates in the environment
+
+    The certificates are copied to `/usr/local/share/ca-certificates` and
+    `update-ca-certificates` adds them to the system trust store, which is used
+    by apt, pip and curl in the build process.
+
+    Example:
+    ```
+    config.ca_certificates(paths=["~/certs/corp-root-ca.pem"])
+    ```
+
+    Args:
+        paths (List[str]): PEM encoded certificates in the host
+    """
+
+
+def proxy(http: str = "", https: str = "", no_proxy: str = ""):
+    """Use the proxy in the build process
+
+    `http_proxy`, `https_proxy` and `no_proxy` are set for the apt, pip, conda
+    and the download steps. They are not kept in the image. The empty values do
+    not override the ones set before, e.g. in the organization config.
+
+    Example:
+    ```
+    config.proxy(
+        http="http://proxy.example.com:3128",
+        https="http://proxy.example.com:3128",
+        no_proxy="localhost,.example.com",
+    )
+    ```
+
+    Args:
+        http (str): proxy for the HTTP requests
+        https (str): proxy for the HTTPS requests
+        no_proxy (str): comma separated hosts which are not proxied
+    """
+
+
+def apt_proxy(url: str):
+    """Download the apt packages through the caching proxy
+
+    The proxy, e.g. apt-cacher-ng, is set by `APT_CONFIG` in the build process
+    only, thus it is not kept in the image. Only the HTTP proxy is supported.
+
+    Example:
+    ```
+    config.apt_proxy(url="http://apt-cache.example.com:3142")
+    ```
+
+    Args:
+        url (str): URL of the caching proxy, which starts with `http://`
+    """
+
+
+def builtin_system_packages(
+    add: Optional[List[str]] = None, remove: Optional[List[str]] = None
+):
+    """Change the system packages installed in the base image by envd
+
+    `curl`, `sudo` and `tini` are required by envd and cannot be removed.
+
+    Example:
+    ```
+    config.builtin_system_packages(add=["htop"], remove=["vim", "zsh"])
+    ```
+
+    Args:
+        add (Optional[List[str]]): apt packages installed with the builtin ones
+        remove (Optional[List[str]]): builtin apt packages which are not installed
+    """
@@ -0,0 +1,65 @@
+# Copyright 2022 The envd Authors
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#      http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Host functions
+
+::: tip
+Note that the documentation is automatically generated from [envd/api](https://github.com/tensorchord/envd/tree/main/envd/api) folder
+in [tensorchord/envd](https://github.com/tensorchord/envd/tree/main/envd/api) repo.
+Please update the python file there instead of directly editing file inside envd-docs repo.
+:::
+"""
+
+
+from typing import Optional
+
+
+def getenv(name: str, default: Optional[str] = None) -> Optional[str]:
+    """Read the environment variable in the host (build time)
+
+    The build file can make decisions based on the host configuration, e.g. the mirrors
+    and the proxies. The names are listed by `envd inspect`. The credential-like names,
+    e.g. `GITHUB_TOKEN`, are refused since the values would be baked into the image, use
+    `runtime.env_passthrough` instead.
+
+    Args:
+        name (str): name of the environment variable
+        default (Optional[str]): returned if the variable is not set
+
+    Example usage:
+    ```
+    def build():
+        mirror = host.getenv("PIP_INDEX_URL")
+        if mirror:
+            config.pip_index(url=mirror)
+    ```
+    """
+
+
+def gpu() -> int:
+    """Return the number of the NVIDIA GPUs in the host (build time)
+
+    The GPUs are listed by `nvidia-smi -L`, and 0 is returned if nvidia-smi is missing,
+    thus the same build file works on the laptops without the GPU. Note that the host
+    which runs envd is probed, instead of the remote docker host.
+
+    Example usage:
+    ```
+    def build():
+        os(name="ubuntu", version="20.04")
+        base(language="python3")
+        if host.gpu():
+            install.cuda(version="11.6.2", cudnn="8")
+    ```
+    """
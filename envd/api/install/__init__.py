@@ -32,14 +32,26 @@ def apt_packages(name: List[str]):
     """
 
 
-def python_packages(name: List[str], requirements: str, local_wheels: List[str]):
+def python_packages(
+    name: List[str],
+    requirements: str,
+    pipfile: str,
+    local_wheels: List[str],
+    layer: Optional[str] = None,
+):
     """Install python package by pip
 
     Args:
         name (List[str]): package name list
         requirements (str): requirements file path
+        pipfile (str): Pipfile path, the packages are installed by pipenv.
+            Pipfile.lock next to it is respected if it exists
         local_wheels (List[str]): local wheels
             (wheel files should be placed under the current directory)
+        layer (optional, str): install the packages in the name list in their own
+            layers, thus changing other packages does not reinstall them.
+            'package' installs every package in its own layer, and 'group'
+            installs them in one layer
     """
 
 
@@ -71,11 +83,129 @@ def cuda(version: str, cudnn: Optional[str] = None):
     """
 
 
+def cuda_libraries(name: List[str]):
+    """Install CUDA libraries from the NVIDIA apt repo
+
+    The NVIDIA apt repo is configured with the current key, and the versions
+    matching the CUDA set by `install.cuda` are installed.
+
+    Args:
+        name (List[str]): Library names, such as ['tensorrt', 'nccl']
+
+    Example:
+    ```
+    install.cuda(version="11.6.2", cudnn="8")
+    install.cuda_libraries(["tensorrt", "nccl"])
+    ```
+    """
+
+
+def git_lfs(propagate_config: bool = True):
+    """Install git-lfs and set up its filters
+
+    ML repos usually keep the model weights in git-lfs, and cloning them
+    without git-lfs only gets the pointer files.
+
+    Args:
+        propagate_config (bool): Copy the lfs section of the global git config
+            on the host, such as `lfs.url`, into the image
+
+    Example:
+    ```
+    install.git_lfs()
+    ```
+    """
+
+
+def pre_commit(install_hooks: bool = False):
+    """Install pre-commit
+
+    The environments of the hooks are cached in a volume shared by all the
+    environments, thus they are not installed again after rebuilding.
+
+    Args:
+        install_hooks (bool): Run `pre-commit install` in the workspace at
+            startup if there is `.pre-commit-config.yaml`
+
+    Example:
+    ```
+    install.pre_commit(install_hooks=True)
+    ```
+    """
+
+
+def tmux(config: str = ""):
+    """Install tmux
+
+    The ssh agent keeps working in the tmux sessions after reconnecting to
+    the environment with envd ssh.
+
+    Args:
+        config (str): Path to the tmux.conf on the host, which is baked into
+            the image as the system config. `~/.tmux.conf` in the environment
+            still takes precedence over it
+
+    Example:
+    ```
+    install.tmux(config="tmux.conf")
+    ```
+    """
+
+
+def direnv():
+    """Install direnv and hook it into the shells
+
+    The workspace is whitelisted, thus the `.envrc` files in the project are
+    loaded without `direnv allow`.
+
+    Example:
+    ```
+    install.direnv()
+    ```
+    """
+
+
+def database_clients(clients: Optional[List[str]] = None):
+    """Install the database clients, i.e. psql, mysql and redis-cli
+
+    The connection profiles are set by `runtime.database`.
+
+    Example:
+    ```
+    install.database_clients(clients=["postgresql", "redis"])
+    ```
+
+    Args:
+        clients (Optional[List[str]]): Clients to install, i.e. `postgresql`, `mysql`
+            and `redis`. Default: all of them
+    """
+
+
+def github_cli(forward_token: bool = False):
+    """Install GitHub CLI (gh) and set up its completion in the shells
+
+    Example:
+    ```
+    install.github_cli(forward_token=True)
+    ```
+
+    Args:
+        forward_token (bool): Pass the GitHub token of the host to `gh` in the environment
+            by `envd up`, i.e. `GH_TOKEN`, `GITHUB_TOKEN` or `gh auth token` on the host.
+            The token is not stored in the image.
+    """
+
+
 def vscode_extensions(name: List[str]):
     """Install VS Code extensions
 
+    The extensions without the versions, or with `@latest`, are resolved to the latest
+    versions in the marketplace, and they are pinned in `envd.lock` by `envd lock`.
+
     Args:
-        name (List[str]): extension names, such as ['ms-python.python']
+        name (List[str]): extension names in the format of
+            publisher.extension[-version|@version|@latest][@platform],
+            such as ['ms-python.python@latest', 'ms-python.python@2023.4.1@linux-x64']
     """
 
 
@@ -42,3 +42,24 @@ def http(url: str, checksum: Optional[str], filename: Optional[str]):
         checksum (Optional[str]): checksum for the downloaded file
         filename (Optional[str]): rewrite the filename
     """
+
+
+def read_file(path: str) -> str:
+    """Read the file in the build context (build time)
+
+    The content can be parsed and fed into the other rules, e.g. the version files and the
+    requirements lists. The path is relative to the build context, and the files out of the
+    build context, including those linked by symlinks, cannot be read. The file size is
+    limited to 1 MiB.
+
+    Args:
+        path (str): path to the file in the build context
+
+    Example usage:
+    ```
+    def build():
+        version = io.read_file("VERSION").strip()
+        packages = io.read_file("packages.txt").splitlines()
+        install.python_packages(name=packages)
+    ```
+    """
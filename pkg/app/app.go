@@ -15,16 +15,20 @@
 package app
 
 import (
+	"os"
+
 	"github.com/cockroachdb/errors"
 	_ "github.com/moby/buildkit/client/connhelper/dockercontainer"
 	_ "github.com/moby/buildkit/client/connhelper/kubepod"
 	_ "github.com/moby/buildkit/client/connhelper/podmancontainer"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/urfave/cli/v2"
 
+	"github.com/tensorchord/envd/pkg/docker"
 	"github.com/tensorchord/envd/pkg/flag"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 	"github.com/tensorchord/envd/pkg/version"
 )
 
@@ -42,8 +46,43 @@ func New() EnvdApp {
 	internalApp.Version = version.GetVersion().String()
 	internalApp.Flags = []cli.Flag{
 		&cli.BoolFlag{
-			Name:  "debug",
-			Usage: "enable debug output in logs",
+			Name:    flag.FlagDebug,
+			Usage:   "enable debug output in logs",
+			Aliases: []string{"v"},
+		},
+		&cli.StringFlag{
+			Name:  flag.FlagLogLevel,
+			Usage: "log level (trace, debug, info, warn, error)",
+			Value: "info",
+		},
+		&cli.StringFlag{
+			Name:  flag.FlagLogFormat,
+			Usage: "log format (text, json)",
+			Value: log.FormatText,
+		},
+		&cli.StringFlag{
+			Name:  flag.FlagCacheDir,
+			Usage: "cache dir of the assets, e.g. on a larger partition ($ENVD_CACHE_DIR or $XDG_CACHE_HOME/envd by default)",
+		},
+		&cli.StringFlag{
+			Name:  flag.FlagBuilder,
+			Usage: "builder to use instead of the one in the current context, e.g. tcp://buildkitd.example.com:1234",
+		},
+		&cli.PathFlag{
+			Name:  flag.FlagBuilderTLSCA,
+			Usage: "CA certificate of the remote buildkitd, which enables mTLS for the tcp builder",
+		},
+		&cli.PathFlag{
+			Name:  flag.FlagBuilderTLSCert,
+			Usage: "client certificate for the remote buildkitd",
+		},
+		&cli.PathFlag{
+			Name:  flag.FlagBuilderTLSKey,
+			Usage: "client key for the remote buildkitd",
+		},
+		&cli.StringFlag{
+			Name:  flag.FlagBuilderTLSName,
+			Usage: "server name in the certificate of the remote buildkitd",
 		},
 		&cli.StringFlag{
 			Name:   flag.FlagBuildkitdImage,
@@ -63,10 +102,21 @@ func New() EnvdApp {
 		CommandBootstrap,
 		CommandContext,
 		CommandBuild,
+		CommandCache,
+		CommandConfig,
+		CommandDebug,
 		CommandDestroy,
 		CommandEnvironment,
+		CommandExport,
+		CommandExportBundle,
+		CommandHistory,
 		CommandImage,
+		CommandImportBundle,
 		CommandInit,
+		CommandInspect,
+		CommandLint,
+		CommandLock,
+		CommandLSP,
 		CommandLogin,
 		CommandK8s,
 		CommandSSH,
@@ -79,6 +129,8 @@ func New() EnvdApp {
 		CommandTop,
 	}
 
+	auditOnce.Do(func() { withAudit(internalApp.Commands, "") })
+
 	internalApp.CustomAppHelpTemplate = ` envd - Development environment for data science and AI/ML teams
 
  Usage:
@@ -106,13 +158,29 @@ func New() EnvdApp {
 	var debugEnabled bool
 
 	internalApp.Before = func(context *cli.Context) error {
-		debugEnabled = context.Bool("debug")
-
-		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
-		if debugEnabled {
-			logrus.SetLevel(logrus.DebugLevel)
+		debugEnabled = context.Bool(flag.FlagDebug)
+
+		if err := log.Setup(log.Options{
+			Level:  context.String(flag.FlagLogLevel),
+			Format: context.String(flag.FlagLogFormat),
+			Debug:  debugEnabled,
+		}); err != nil {
+			return errors.Wrap(err, "failed to setup the logger")
 		}
 
+		if dir := context.String(flag.FlagCacheDir); dir != "" {
+			if err := fileutil.SetCacheDir(dir); err != nil {
+				return errors.Wrap(err, "failed to set the cache dir")
+			}
+		}
+		// The docker CLI run by the docker-container:// builder reads
+		// DOCKER_HOST as well, thus it is set instead of the client option.
+		if host, ok := docker.RootlessHost(); ok {
+			log.WithField("host", host).Debug("using the rootless docker daemon")
+			if err := os.Setenv("DOCKER_HOST", host); err != nil {
+				return errors.Wrap(err, "failed to set DOCKER_HOST")
+			}
+		}
 		if err := home.Initialize(); err != nil {
 			return errors.Wrap(err, "failed to initialize home manager")
 		}
@@ -122,6 +190,12 @@ func New() EnvdApp {
 		viper.Set(flag.FlagDebug, debugEnabled)
 		viper.Set(flag.FlagDockerOrganization,
 			context.String(flag.FlagDockerOrganization))
+		viper.Set(flag.FlagBuilder, context.String(flag.FlagBuilder))
+		for _, f := range []string{flag.FlagBuilderTLSCA, flag.FlagBuilderTLSCert,
+			flag.FlagBuilderTLSKey} {
+			viper.Set(f, context.Path(f))
+		}
+		viper.Set(flag.FlagBuilderTLSName, context.String(flag.FlagBuilderTLSName))
 		return nil
 	}
 
@@ -0,0 +1,149 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+const redacted = "******"
+
+// secretFlagPattern matches the flags whose values are redacted in the
+// audit log, e.g. --password and --token.
+var secretFlagPattern = regexp.MustCompile(`(?i)(password|passwd|token|secret|credential)`)
+
+// keyValueFlags are the flags in the KEY=VALUE format whose values are
+// redacted and the keys are kept, e.g. --arg HF_TOKEN=xxx.
+var keyValueFlags = map[string]bool{"--arg": true}
+
+// auditOnce guards the commands from being wrapped again by the next New.
+var auditOnce sync.Once
+
+// withAudit wraps the actions of the commands, thus every command is
+// recorded in the audit log after it exits, including the failed ones.
+func withAudit(commands []*cli.Command, parent string) {
+	for _, c := range commands {
+		name := strings.TrimSpace(parent + " " + c.Name)
+		withAudit(c.Subcommands, name)
+		if c.Action == nil {
+			continue
+		}
+		action := c.Action
+		c.Action = func(clicontext *cli.Context) error {
+			start := time.Now()
+			err := action(clicontext)
+			record := types.AuditRecord{
+				Time:     start,
+				Command:  name,
+				Args:     redactArgs(rootArgs(clicontext)),
+				Duration: time.Since(start),
+			}
+			if u, uerr := user.Current(); uerr == nil {
+				record.User = u.Username
+			}
+			if host, herr := os.Hostname(); herr == nil {
+				record.Host = host
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+			if aerr := home.GetManager().AppendAudit(record); aerr != nil {
+				log.Debugf("failed to write the audit log: %s", aerr)
+			}
+			return err
+		}
+	}
+}
+
+// rootArgs returns the args of the app context, i.e. the ones after the
+// global flags. The context of the app is the last one with the app in the
+// lineage.
+func rootArgs(clicontext *cli.Context) []string {
+	var root *cli.Context
+	for _, c := range clicontext.Lineage() {
+		if c.App != nil {
+			root = c
+		}
+	}
+	if root == nil {
+		return nil
+	}
+	return root.Args().Slice()
+}
+
+// redactArgs replaces the values of the secret flags and the key value
+// flags, in both the --flag=value and the --flag value forms.
+func redactArgs(args []string) []string {
+	res := make([]string, 0, len(args))
+	redactNext := false
+	redactNextValue := false
+	for _, arg := range args {
+		if redactNext {
+			res = append(res, redacted)
+			redactNext = false
+			continue
+		}
+		if redactNextValue {
+			res = append(res, redactKeyValue(arg))
+			redactNextValue = false
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			res = append(res, arg)
+			continue
+		}
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if keyValueFlags[flag] {
+			if hasValue {
+				res = append(res, flag+"="+redactKeyValue(value))
+			} else {
+				res = append(res, arg)
+				redactNextValue = true
+			}
+			continue
+		}
+		if !secretFlagPattern.MatchString(flag) {
+			res = append(res, arg)
+			continue
+		}
+		if hasValue {
+			res = append(res, flag+"="+redacted)
+		} else {
+			res = append(res, arg)
+			redactNext = true
+		}
+	}
+	return res
+}
+
+// redactKeyValue replaces the value in KEY=VALUE, the key is kept.
+func redactKeyValue(kv string) string {
+	key, _, ok := strings.Cut(kv, "=")
+	if !ok {
+		return kv
+	}
+	return key + "=" + redacted
+}
@@ -21,13 +21,15 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/docker/docker/pkg/namesgenerator"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
 	ac "github.com/tensorchord/envd/pkg/autocomplete"
+	"github.com/tensorchord/envd/pkg/builder"
 	"github.com/tensorchord/envd/pkg/buildkitd"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
 	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
+	"github.com/tensorchord/envd/pkg/types"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
@@ -52,6 +54,11 @@ var CommandBootstrap = &cli.Command{
 			Usage:   "Dockerhub mirror to use",
 			Aliases: []string{"m"},
 		},
+		&cli.BoolFlag{
+			Name:  "with-pypi-cache",
+			Usage: "Launch the PyPI cache container and use it in all the following builds",
+			Value: false,
+		},
 		&cli.StringSliceFlag{
 			Name: "ssh-keypair",
 			Usage: fmt.Sprintf("Manually specify ssh key pair as `publicKey,privateKey`. Envd will generate a keypair at %s and %s if not specified",
@@ -76,11 +83,14 @@ func bootstrap(clicontext *cli.Context) error {
 	}, {
 		"buildkit",
 		buildkit,
+	}, {
+		"PyPI cache",
+		pypiCache,
 	}}
 
 	total := len(stages)
 	for i, stage := range stages {
-		logrus.Infof("[%d/%d] Bootstrap %s", i+1, total, stage.Name)
+		log.Infof("[%d/%d] Bootstrap %s", i+1, total, stage.Name)
 		err := stage.Func(clicontext)
 		if err != nil {
 			return err
@@ -132,7 +142,7 @@ func sshKey(clicontext *cli.Context) error {
 					return err
 				}
 			}
-			logrus.Debugf("New key name: %s", newPrivateKeyName)
+			log.Debugf("New key name: %s", newPrivateKeyName)
 			if err := sshconfig.ReplaceKeyManagedByEnvd(
 				path, newPrivateKeyName); err != nil {
 				return err
@@ -173,16 +183,16 @@ func autocomplete(clicontext *cli.Context) error {
 	// Because this requires sudo, it should warn and not fail the rest of it.
 	err := ac.InsertBashCompleteEntry()
 	if err != nil {
-		logrus.Warnf("Warning: %s\n", err.Error())
+		log.Warnf("Warning: %s\n", err.Error())
 		err = nil
 	}
 	err = ac.InsertZSHCompleteEntry()
 	if err != nil {
-		logrus.Warnf("Warning: %s\n", err.Error())
+		log.Warnf("Warning: %s\n", err.Error())
 		err = nil
 	}
 
-	logrus.Info("You may have to restart your shell for autocomplete to get initialized (e.g. run \"exec $SHELL\")\n")
+	log.Info("You may have to restart your shell for autocomplete to get initialized (e.g. run \"exec $SHELL\")\n")
 	return nil
 }
 
@@ -197,14 +207,38 @@ func buildkit(clicontext *cli.Context) error {
 		return errors.Wrap(err, "failed to get the current context")
 	}
 
-	logrus.Debug("bootstrap the buildkitd container")
+	log.Debug("bootstrap the buildkitd container")
 	bkClient, err := buildkitd.NewClient(clicontext.Context,
-		c.Builder, c.BuilderAddress, clicontext.String("dockerhub-mirror"))
+		*c, clicontext.String("dockerhub-mirror"))
 	if err != nil {
 		return errors.Wrap(err, "failed to create buildkit client")
 	}
 	defer bkClient.Close()
-	logrus.Infof("The buildkit is running at %s", bkClient.BuildkitdAddr())
+	log.Infof("The buildkit is running at %s", bkClient.BuildkitdAddr())
+
+	return nil
+}
+
+func pypiCache(clicontext *cli.Context) error {
+	if !clicontext.Bool("with-pypi-cache") {
+		return nil
+	}
 
+	c, err := home.GetManager().ContextGetCurrent()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the current context")
+	}
+	if c.Builder != types.BuilderTypeDocker {
+		return errors.Newf("PyPI cache is only supported by the %s builder",
+			types.BuilderTypeDocker)
+	}
+	index, err := builder.StartPyPICacher(clicontext.Context)
+	if err != nil {
+		return err
+	}
+	if err := home.GetManager().ContextSetPyPICache(true); err != nil {
+		return errors.Wrap(err, "failed to enable the PyPI cache in the context")
+	}
+	log.Infof("The PyPI cache is running at %s", index)
 	return nil
 }
@@ -17,16 +17,20 @@ package app
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
 	"github.com/tensorchord/envd/pkg/builder"
 	"github.com/tensorchord/envd/pkg/docker"
 	"github.com/tensorchord/envd/pkg/envd"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/progress/progresswriter"
 	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
+	"github.com/tensorchord/envd/pkg/types"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
@@ -38,8 +42,24 @@ var CommandBuild = &cli.Command{
 	Description: `
 To build an image using build.envd:
 	$ envd build
+To build an image using the graph serialized as JSON or YAML (see envd debug ir):
+	$ envd build --from graph.json
+To build the environment gpu declared by environment("gpu", build_gpu) in build.envd, tagged PROJECT-gpu:dev:
+	$ envd build --env gpu
+To build the image with the build argument read by args.get("CUDA", "11.6.2") in build.envd:
+	$ envd build --arg CUDA=11.7
+To build the production image of the target prod, without envd-sshd:
+	$ envd build --target prod
+To build the image with the packages only, without oh-my-zsh, VS Code extensions and envd-sshd:
+	$ envd build --minimal
+To run the commands of run() without the network, the build context and the proxy unless granted:
+	$ envd build --sandbox
 To build and push the image to a registry:
 	$ envd build --output type=image,name=docker.io/username/image,push=true
+To export the image to an OCI tarball instead of loading it into the docker host:
+	$ envd build --output type=oci,dest=image.tar
+To export the filesystem of the image to a local directory:
+	$ envd build --output type=local,dest=output
 `,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
@@ -48,18 +68,67 @@ To build and push the image to a registry:
 			Aliases:     []string{"t"},
 			DefaultText: "PROJECT:dev",
 		},
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "Build target evaluated by target() in the build file, the targets other than dev do not install envd-sshd",
+			Value: ir.TargetDev,
+		},
+		&cli.GenericFlag{
+			Name:  "arg",
+			Usage: "Build argument in the KEY=VALUE format read by args.get in the build file, e.g. CUDA=11.7, it can be repeated",
+			Value: &repeatedValues{},
+		},
+		&cli.StringFlag{
+			Name:  "env",
+			Usage: "Name of the environment declared by environment(name, build) in the build file, e.g. gpu",
+		},
 		&cli.PathFlag{
 			Name:    "from",
 			Usage:   "Function to execute, format `file:func`",
 			Aliases: []string{"f"},
 			Value:   "build.envd:build",
 		},
+		&cli.BoolFlag{
+			Name:  "minimal",
+			Usage: "Omit oh-my-zsh, the VS Code extensions and envd-sshd, only the packages are kept, e.g. for the batch jobs",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "sandbox",
+			Usage: "Run the commands of run() without the network, the build context and the proxy env unless they are granted by run(allow=[...])",
+			Value: false,
+		},
+		&cli.PathFlag{
+			Name:    "vsix-dir",
+			Usage:   "Install the VS Code extensions from the .vsix files in the directory before the marketplace, e.g. for the air-gapped builds",
+			EnvVars: []string{"ENVD_VSIX_DIR"},
+		},
 		&cli.BoolFlag{
 			Name:    "use-proxy",
 			Usage:   "Use HTTPS_PROXY/HTTP_PROXY/NO_PROXY in the build process",
 			Aliases: []string{"proxy"},
 			Value:   false,
 		},
+		&cli.BoolFlag{
+			Name:  "reproducible",
+			Usage: "Pin the timestamps to SOURCE_DATE_EPOCH (defaults to the last commit time of the build file) and squash the image, so that the builds produce the same digest",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "apt-cacher",
+			Usage: "Cache the apt packages in the local apt-cacher-ng container shared by all the builds",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "notify",
+			Usage: "Show the desktop notification when the build is finished",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:    "notify-webhook",
+			Usage:   "Post the build result to the webhook URL (e.g. Slack incoming webhook) when the build is finished",
+			EnvVars: []string{"ENVD_NOTIFY_WEBHOOK"},
+		},
 		&cli.PathFlag{
 			Name:    "path",
 			Usage:   "Path to the directory containing the build.envd",
@@ -75,7 +144,7 @@ To build and push the image to a registry:
 		},
 		&cli.StringFlag{
 			Name:    "output",
-			Usage:   "Output destination (e.g. type=tar,dest=path,push=true)",
+			Usage:   "Output destination (e.g. type=oci,dest=image.tar or type=local,dest=dir)",
 			Aliases: []string{"o"},
 		},
 		&cli.BoolFlag{
@@ -83,16 +152,25 @@ To build and push the image to a registry:
 			Usage: "Force rebuild the image",
 			Value: false,
 		},
+		&cli.IntFlag{
+			Name:  "events-fd",
+			Usage: "File descriptor inherited from the parent process to write the build events as JSON lines, e.g. for the IDE plugins",
+		},
+		&cli.PathFlag{
+			Name:  "events-socket",
+			Usage: "Unix socket to write the build events as JSON lines, e.g. for the IDE plugins",
+		},
 		// https://github.com/urfave/cli/issues/1134#issuecomment-1191407527
 		&cli.StringFlag{
-			Name:    "export-cache",
-			Usage:   "Export the cache (e.g. type=registry,ref=<image>)",
-			Aliases: []string{"ec"},
+			Name:    "cache-to",
+			Usage:   "Export the build cache (e.g. type=registry,ref=<image>,mode=max to export the cache of all the stages)",
+			Aliases: []string{"export-cache", "ec"},
 		},
-		&cli.StringFlag{
-			Name:    "import-cache",
-			Usage:   "Import the cache (e.g. type=registry,ref=<image>)",
-			Aliases: []string{"ic"},
+		&cli.GenericFlag{
+			Name:    "cache-from",
+			Usage:   "Import the build cache (e.g. type=registry,ref=<image>), it can be repeated",
+			Aliases: []string{"import-cache", "ic"},
+			Value:   &repeatedValues{},
 		},
 	},
 	Action: build,
@@ -103,14 +181,15 @@ func build(clicontext *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	defer opt.Events.Close()
 
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
 		"build-context": opt.BuildContextDir,
 		"build-file":    opt.ManifestFilePath,
 		"config":        opt.ConfigFilePath,
 		"tag":           opt.Tag,
 	})
-	logger.WithFields(logrus.Fields{
+	logger.WithFields(log.Fields{
 		"builder-options": opt,
 	}).Debug("starting build command")
 
@@ -124,11 +203,7 @@ func build(clicontext *cli.Context) error {
 	return BuildImage(clicontext, builder)
 }
 
-func DetectEnvironment(clicontext *cli.Context, buildOpt builder.Options) error {
-	context, err := home.GetManager().ContextGetCurrent()
-	if err != nil {
-		return errors.Wrap(err, "failed to get the current context")
-	}
+func DetectEnvironment(clicontext *cli.Context, buildOpt builder.Options, context *types.Context) error {
 	opt := envd.Options{
 		Context: context,
 	}
@@ -137,14 +212,14 @@ func DetectEnvironment(clicontext *cli.Context, buildOpt builder.Options) error
 		return errors.Wrap(err, "failed to create the docker client")
 	}
 	// detect if the current environment is running before building
-	ctr := filepath.Base(buildOpt.BuildContextDir)
+	ctr := builder.EnvironmentName(buildOpt.BuildContextDir, buildOpt.Env)
 	running, err := engine.IsRunning(clicontext.Context, ctr)
 	if err != nil {
 		return err
 	}
 	force := clicontext.Bool("force")
 	if running && !force {
-		logrus.Errorf("detect container %s is running, please save your data and stop the running container if you need to envd up again.", ctr)
+		log.Errorf("detect container %s is running, please save your data and stop the running container if you need to envd up again.", ctr)
 		return errors.Newf("\"%s\" is stil running, please run `envd destroy --name %s` stop it first", ctr, ctr)
 	}
 	return nil
@@ -173,6 +248,28 @@ func BuildImage(clicontext *cli.Context, builder builder.Builder) error {
 	return nil
 }
 
+// repeatedValues is the value of the flags which can be repeated, e.g.
+// --cache-from and --arg. Unlike cli.StringSlice, the value is not split by
+// the commas in it.
+type repeatedValues []string
+
+func (c *repeatedValues) Set(value string) error {
+	*c = append(*c, value)
+	return nil
+}
+
+func (c *repeatedValues) String() string {
+	return strings.Join(*c, " ")
+}
+
+// repeatedFlag returns the values of the flag set by repeatedValues.
+func repeatedFlag(clicontext *cli.Context, name string) []string {
+	if c, ok := clicontext.Generic(name).(*repeatedValues); ok {
+		return *c
+	}
+	return nil
+}
+
 func ParseBuildOpt(clicontext *cli.Context) (builder.Options, error) {
 	buildContext, err := filepath.Abs(clicontext.Path("path"))
 	if err != nil {
@@ -182,6 +279,14 @@ func ParseBuildOpt(clicontext *cli.Context) (builder.Options, error) {
 	if err != nil {
 		return builder.Options{}, err
 	}
+	buildArgs, err := builder.ParseBuildArgs(repeatedFlag(clicontext, "arg"))
+	if err != nil {
+		return builder.Options{}, err
+	}
+	env := clicontext.String("env")
+	if env != "" && clicontext.IsSet("from") && strings.Contains(clicontext.String("from"), ":") {
+		return builder.Options{}, errors.New("cannot specify --env and the func in --from at the same time")
+	}
 
 	manifest, err := fileutil.FindFileAbsPath(buildContext, fileName)
 	if err != nil {
@@ -192,11 +297,21 @@ func ParseBuildOpt(clicontext *cli.Context) (builder.Options, error) {
 	}
 
 	config := home.GetManager().ConfigFile()
+	orgConfig := home.GetManager().OrgConfigFile()
 
+	target := clicontext.String("target")
+	if target == "" {
+		target = ir.TargetDev
+	}
+	minimal := clicontext.Bool("minimal")
 	tag := clicontext.String("tag")
 	if tag == "" {
-		logrus.Debug("tag not specified, using default")
-		tag = fmt.Sprintf("%s:%s", filepath.Base(buildContext), "dev")
+		log.Debug("tag not specified, using default")
+		tag = fmt.Sprintf("%s:%s", builder.EnvironmentName(buildContext, env), target)
+		// The minimal image does not replace the one used by envd up.
+		if minimal {
+			tag += "-minimal"
+		}
 	}
 	// The current container engine is only Docker. It should be expanded to support other container engines.
 	tag, err = docker.NormalizeNamed(tag)
@@ -204,22 +319,44 @@ func ParseBuildOpt(clicontext *cli.Context) (builder.Options, error) {
 		return builder.Options{}, err
 	}
 	output := clicontext.String("output")
-	exportCache := clicontext.String("export-cache")
-	importCache := clicontext.String("import-cache")
+	exportCache := clicontext.String("cache-to")
+	if _, err := builder.ParseExportCache([]string{exportCache}, nil); err != nil {
+		return builder.Options{}, errors.Wrap(err, "invalid --cache-to")
+	}
+	importCache := repeatedFlag(clicontext, "cache-from")
+	if _, err := builder.ParseImportCache(importCache); err != nil {
+		return builder.Options{}, errors.Wrap(err, "invalid --cache-from")
+	}
 	useProxy := clicontext.Bool("use-proxy")
 
 	opt := builder.Options{
-		ManifestFilePath: manifest,
-		ConfigFilePath:   config,
-		BuildFuncName:    funcName,
-		BuildContextDir:  buildContext,
-		Tag:              tag,
-		OutputOpts:       output,
-		PubKeyPath:       clicontext.Path("public-key"),
-		ProgressMode:     "auto",
-		ExportCache:      exportCache,
-		ImportCache:      importCache,
-		UseHTTPProxy:     useProxy,
+		ManifestFilePath:  manifest,
+		ConfigFilePath:    config,
+		OrgConfigFilePath: orgConfig,
+		BuildFuncName:     funcName,
+		Env:               env,
+		BuildArgs:         buildArgs,
+		Target:            target,
+		Minimal:           minimal,
+		Sandbox:           clicontext.Bool("sandbox"),
+		VSIXDir:           clicontext.Path("vsix-dir"),
+		BuildContextDir:   buildContext,
+		Tag:               tag,
+		OutputOpts:        output,
+		PubKeyPath:        clicontext.Path("public-key"),
+		ProgressMode:      "auto",
+		ExportCache:       exportCache,
+		ImportCache:       importCache,
+		UseHTTPProxy:      useProxy,
+		UseAPTCacher:      clicontext.Bool("apt-cacher"),
+		Reproducible:      clicontext.Bool("reproducible"),
+		NotifyDesktop:     clicontext.Bool("notify"),
+		NotifyWebhook:     clicontext.String("notify-webhook"),
+	}
+	opt.Events, err = progresswriter.OpenEventStream(
+		clicontext.Int("events-fd"), clicontext.Path("events-socket"))
+	if err != nil {
+		return builder.Options{}, err
 	}
 
 	debug := clicontext.Bool("debug")
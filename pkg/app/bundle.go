@@ -0,0 +1,267 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/bundle"
+	envdconfig "github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/docker"
+	"github.com/tensorchord/envd/pkg/envd"
+	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/types"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+	"github.com/tensorchord/envd/pkg/version"
+)
+
+var CommandExportBundle = &cli.Command{
+	Name:     "export-bundle",
+	Category: CategoryAdvanced,
+	Usage:    "Export the envd environment with its workspace and state to a bundle",
+	Description: `The bundle contains the image, the workspace, the shell state and the lockfile of
+the environment. It is restored by envd import-bundle on another machine, e.g. to hand a
+problem reproduction to a colleague:
+	$ envd export-bundle --env mnist --output mnist.tar.gz`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "env",
+			Usage:   "Environment name",
+			Aliases: []string{"e"},
+		},
+		&cli.PathFlag{
+			Name:        "output",
+			Usage:       "Path to the bundle",
+			Aliases:     []string{"o"},
+			DefaultText: "ENV.tar.gz",
+		},
+	},
+	Action: exportBundle,
+}
+
+var CommandImportBundle = &cli.Command{
+	Name:     "import-bundle",
+	Category: CategoryAdvanced,
+	Usage:    "Import the envd environment from a bundle",
+	Description: `The image and the shell state are loaded into the docker host, and the workspace
+is extracted into the directory. Then start the environment in the workspace:
+	$ envd import-bundle --input mnist.tar.gz
+	$ envd up --path mnist`,
+	Flags: []cli.Flag{
+		&cli.PathFlag{
+			Name:     "input",
+			Usage:    "Path to the bundle",
+			Aliases:  []string{"i"},
+			Required: true,
+		},
+		&cli.PathFlag{
+			Name:    "path",
+			Usage:   "Directory to extract the workspace into",
+			Aliases: []string{"p"},
+			Value:   ".",
+		},
+	},
+	Action: importBundle,
+}
+
+func exportBundle(clicontext *cli.Context) error {
+	name := clicontext.String("env")
+	if name == "" {
+		return errors.New("env is required")
+	}
+	output := clicontext.Path("output")
+	if output == "" {
+		output = name + ".tar.gz"
+	}
+
+	context, err := home.GetManager().ContextGetCurrent()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the current context")
+	}
+	engine, err := envd.New(clicontext.Context, envd.Options{Context: context})
+	if err != nil {
+		return errors.Wrap(err, "failed to create the envd engine")
+	}
+	envs, err := engine.ListEnvironment(clicontext.Context)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the environments")
+	}
+	var env *types.EnvdEnvironment
+	for i := range envs {
+		if envs[i].Name == name {
+			env = &envs[i]
+		}
+	}
+	if env == nil {
+		return errors.Newf("environment %s is not found", name)
+	}
+	if env.BuildContext == "" {
+		return errors.Newf("the workspace of the environment %s is unknown", name)
+	}
+	workspace := fileutil.EnvdHomeDir(filepath.Base(env.BuildContext))
+
+	dockerClient, err := docker.NewClient(clicontext.Context)
+	if err != nil {
+		return err
+	}
+	w, err := bundle.NewWriter(output, bundle.Manifest{
+		Name:        name,
+		Workspace:   filepath.Base(env.BuildContext),
+		Image:       env.Image,
+		EnvdVersion: version.GetVersion().String(),
+		Created:     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeBundle(clicontext, dockerClient, w, env, workspace); err != nil {
+		w.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	log.Infof("environment %s is exported to %s", name, output)
+	return nil
+}
+
+// writeBundle adds the image, the workspace, the shell state and the
+// lockfile of the environment into the bundle in order.
+func writeBundle(clicontext *cli.Context, dockerClient docker.Client,
+	w *bundle.Writer, env *types.EnvdEnvironment, workspace string) error {
+	ctx := clicontext.Context
+	log.Infof("exporting the image %s", env.Image)
+	image, err := dockerClient.SaveImage(ctx, env.Image)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	if err := w.Add(bundle.ImageFile, image); err != nil {
+		return err
+	}
+
+	log.Infof("exporting the workspace %s", workspace)
+	ws, err := dockerClient.CopyFrom(ctx, env.Name, workspace)
+	if err != nil {
+		return err
+	}
+	if ws == nil {
+		return errors.Newf("workspace %s is not found in the environment", workspace)
+	}
+	defer ws.Close()
+	if err := w.Add(bundle.WorkspaceFile, ws); err != nil {
+		return err
+	}
+
+	hasState := false
+	for _, m := range env.Mounts {
+		if m.Destination == envdconfig.ContainerStateDir {
+			hasState = true
+		}
+	}
+	if hasState {
+		log.Info("exporting the shell state")
+		state, err := dockerClient.CopyFrom(ctx, env.Name, envdconfig.ContainerStateDir)
+		if err != nil {
+			return err
+		}
+		if state != nil {
+			defer state.Close()
+			if err := w.Add(bundle.StateFile, state); err != nil {
+				return err
+			}
+		}
+	}
+
+	lock, err := dockerClient.CopyFrom(ctx, env.Name, filepath.Join(workspace, ir.LockFileName))
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		log.Debugf("%s is not found in the workspace", ir.LockFileName)
+		return nil
+	}
+	defer lock.Close()
+	// The archive only contains the lockfile.
+	tr := tar.NewReader(lock)
+	if _, err := tr.Next(); err != nil {
+		return errors.Wrapf(err, "failed to read %s", ir.LockFileName)
+	}
+	return w.Add(bundle.LockFile, tr)
+}
+
+func importBundle(clicontext *cli.Context) error {
+	path, err := filepath.Abs(clicontext.Path("path"))
+	if err != nil {
+		return errors.Wrap(err, "failed to get absolute path of the directory")
+	}
+	dockerClient, err := docker.NewClient(clicontext.Context)
+	if err != nil {
+		return err
+	}
+
+	var workspace string
+	err = bundle.Walk(clicontext.Path("input"), func(m bundle.Manifest, name string, r io.Reader) error {
+		workspace = filepath.Join(path, m.WorkspaceDir())
+		switch name {
+		case bundle.ImageFile:
+			log.Infof("importing the image %s", m.Image)
+			return dockerClient.Load(clicontext.Context, io.NopCloser(r), true)
+		case bundle.WorkspaceFile:
+			if _, err := os.Stat(workspace); err == nil {
+				return errors.Newf("workspace %s already exists", workspace)
+			}
+			log.Infof("importing the workspace into %s", workspace)
+			return bundle.Extract(r, path)
+		case bundle.StateFile:
+			volume := envd.StateVolumeName(m.Name)
+			log.Infof("importing the shell state into the volume %s", volume)
+			return dockerClient.RestoreVolume(clicontext.Context, m.Image, volume,
+				envdconfig.ContainerStateDir, r)
+		case bundle.LockFile:
+			// The lockfile is usually in the workspace already.
+			lockfile := filepath.Join(workspace, ir.LockFileName)
+			if _, err := os.Stat(lockfile); err == nil {
+				return nil
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read %s", bundle.LockFile)
+			}
+			if err := os.WriteFile(lockfile, data, 0644); err != nil {
+				return errors.Wrapf(err, "failed to write %s", lockfile)
+			}
+			return nil
+		default:
+			log.Warnf("unknown entry %s in the bundle is ignored", name)
+			return nil
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to import the bundle")
+	}
+	log.Infof("the bundle is imported, run `envd up --path %s` to start the environment", workspace)
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/docker/go-units"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/editor/vscode"
+	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+var CommandCache = &cli.Command{
+	Name:     "cache",
+	Category: CategoryManagement,
+	Usage:    "Manage the envd caches of the assets, e.g. oh-my-zsh and vscode extensions",
+	Subcommands: []*cli.Command{
+		CommandCacheList,
+		CommandCacheDU,
+		CommandCacheRefresh,
+		CommandCacheGC,
+		CommandCacheVerify,
+	},
+}
+
+var CommandCacheGC = &cli.Command{
+	Name:  "gc",
+	Usage: "Evict the least recently used assets in the cache, e.g. vscode extensions and oh-my-zsh",
+	Description: `The assets are evicted until the total size of them is not larger than
+--keep-size. They are downloaded again by the next build which uses them. The assets cached
+by the previous envd are tracked after they are used once, and the shell history and the
+ssh host keys in the cache dir are never evicted.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "keep-size",
+			Usage: "Total size of the assets kept in the cache, e.g. 10GB",
+			Value: "10GB",
+		},
+	},
+	Action: gcCache,
+}
+
+func gcCache(clicontext *cli.Context) error {
+	keepSize, err := units.FromHumanSize(clicontext.String("keep-size"))
+	if err != nil {
+		return errors.Wrapf(err, "invalid keep size %s", clicontext.String("keep-size"))
+	}
+	evicted, err := home.GetManager().GCCache(keepSize)
+	// The evicted ones are reported even if the gc is interrupted.
+	var total int64
+	for _, c := range evicted {
+		log.Infof("%s is evicted, %s, last used %s", c.Key,
+			units.HumanSize(float64(c.Size)), units.HumanDuration(time.Since(c.LastAccess))+" ago")
+		total += c.Size
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to gc the cache")
+	}
+	if len(evicted) == 0 {
+		log.Info("the cache is within the keep size")
+		return nil
+	}
+	log.Infof("%d assets are evicted, %s is freed", len(evicted), units.HumanSize(float64(total)))
+	return nil
+}
+
+var CommandCacheRefresh = &cli.Command{
+	Name:  "refresh",
+	Usage: "Update the cached oh-my-zsh and vscode extensions to the latest versions",
+	Description: `The builds always use the cached assets, thus they are deterministic until the
+cache is refreshed. oh-my-zsh is updated to the latest commit of the branch pinned by
+config.oh_my_zsh, the tags and the commits are never updated. The vscode extensions are cached by the exact versions, thus only the
+ones cached without the versions by the previous envd are updated.`,
+	Action: refreshCache,
+}
+
+func refreshCache(clicontext *cli.Context) error {
+	ctx := clicontext.Context
+	if err := interpretCacheConfig(); err != nil {
+		return err
+	}
+	updated, err := ir.DefaultGraph.ZSHManager().Update(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to update oh-my-zsh")
+	}
+	if updated {
+		log.Info("oh-my-zsh is updated")
+	}
+
+	plugins, err := vscode.CachedPlugins()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the cached vscode extensions")
+	}
+	client, err := ir.DefaultGraph.VSCodeClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to create the vscode client")
+	}
+	for _, p := range plugins {
+		ok, err := client.Refresh(ctx, p)
+		if err != nil {
+			return errors.Wrapf(err, "failed to refresh vscode extension %s", p)
+		}
+		if ok {
+			log.Infof("vscode extension %s is updated", p)
+			updated = true
+		}
+	}
+	if !updated {
+		log.Info("the cache is up to date")
+	}
+	return nil
+}
+
+// interpretCacheConfig evaluates the config files, since the marketplace and
+// the revision of oh-my-zsh may be set there, e.g. the mirror.
+func interpretCacheConfig() error {
+	interpreter := starlark.NewSandboxInterpreter(".")
+	for _, config := range configFiles() {
+		if _, err := interpreter.ExecFile(config.Path, ""); err != nil {
+			return errors.Wrapf(err, "failed to exec starlark file %s", config.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/docker/go-units"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/buildkitd"
+	"github.com/tensorchord/envd/pkg/editor/vscode"
+	"github.com/tensorchord/envd/pkg/formatter"
+	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/shell"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+const (
+	cacheKindVSCodeExtension = "vscode-extension"
+	cacheKindVSCodeServer    = "vscode-server"
+	cacheKindShell           = "shell"
+	cacheKindBuildkit        = "buildkit"
+	cacheKindOther           = "other"
+	// cacheKindUntracked is the rest of the cache dir, e.g. the shell
+	// history and the assets which are not used since the previous envd.
+	cacheKindUntracked = "untracked"
+)
+
+var cacheFormatFlag = &cli.StringFlag{
+	Name:  "format",
+	Usage: "Output format (table, json)",
+	Value: "table",
+}
+
+var CommandCacheList = &cli.Command{
+	Name:    "ls",
+	Aliases: []string{"list"},
+	Usage:   "List the cached assets, e.g. vscode extensions and oh-my-zsh, with their sizes",
+	Flags: []cli.Flag{
+		cacheFormatFlag,
+		&cli.BoolFlag{
+			Name:  "buildkit",
+			Usage: "Include the records of the build cache in buildkitd",
+		},
+	},
+	Action: listCache,
+}
+
+var CommandCacheDU = &cli.Command{
+	Name:  "du",
+	Usage: "Show the disk usage of the cache by the kinds of the assets",
+	Description: `The size of the assets cached by the previous envd is unknown until they are
+used once, thus it is reported as untracked with the shell history.`,
+	Flags: []cli.Flag{
+		cacheFormatFlag,
+	},
+	Action: duCache,
+}
+
+// cacheItem is the cached asset in the output of envd cache ls.
+type cacheItem struct {
+	Kind       string     `json:"kind"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version,omitempty"`
+	Size       int64      `json:"size"`
+	LastAccess *time.Time `json:"last_access,omitempty"`
+}
+
+// cacheUsage is the disk usage of a kind in the output of envd cache du.
+type cacheUsage struct {
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+	// Reclaimable is only reported for the build cache.
+	Reclaimable *int64 `json:"reclaimable,omitempty"`
+}
+
+func listCache(clicontext *cli.Context) error {
+	format, err := cacheFormat(clicontext)
+	if err != nil {
+		return err
+	}
+	items, err := cacheItems()
+	if err != nil {
+		return err
+	}
+	if clicontext.Bool("buildkit") {
+		bkClient, err := cacheBuildkitClient(clicontext)
+		if err != nil {
+			return err
+		}
+		defer bkClient.Close()
+		records, err := bkClient.DiskUsage(clicontext.Context, nil)
+		if err != nil {
+			return errors.Wrap(err, "failed to get the build cache")
+		}
+		for _, r := range records {
+			items = append(items, cacheItem{
+				Kind:       cacheKindBuildkit,
+				Name:       r.ID,
+				Version:    string(r.RecordType),
+				Size:       r.Size,
+				LastAccess: r.LastUsedAt,
+			})
+		}
+	}
+
+	if format == "json" {
+		return printJSON(os.Stdout, items)
+	}
+	renderCacheItems(os.Stdout, items)
+	return nil
+}
+
+func duCache(clicontext *cli.Context) error {
+	format, err := cacheFormat(clicontext)
+	if err != nil {
+		return err
+	}
+	items, err := cacheItems()
+	if err != nil {
+		return err
+	}
+
+	usages := map[string]*cacheUsage{}
+	var tracked int64
+	for _, item := range items {
+		u, ok := usages[item.Kind]
+		if !ok {
+			u = &cacheUsage{Kind: item.Kind}
+			usages[item.Kind] = u
+		}
+		u.Count++
+		u.Size += item.Size
+		tracked += item.Size
+	}
+	total, err := fileutil.DirSize(home.GetManager().CacheDir())
+	if err != nil {
+		return errors.Wrap(err, "failed to get the size of the cache dir")
+	}
+	if total > tracked {
+		usages[cacheKindUntracked] = &cacheUsage{
+			Kind: cacheKindUntracked,
+			Size: total - tracked,
+		}
+	}
+	result := make([]cacheUsage, 0, len(usages)+1)
+	for _, u := range usages {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Kind < result[j].Kind
+	})
+
+	// The cache dir is still reported if buildkitd is not running.
+	if u, err := buildkitUsage(clicontext); err != nil {
+		log.Warnf("failed to get the build cache in buildkitd: %s", err)
+	} else {
+		result = append(result, u)
+	}
+
+	if format == "json" {
+		return printJSON(os.Stdout, result)
+	}
+	renderCacheUsages(os.Stdout, result)
+	return nil
+}
+
+func cacheFormat(clicontext *cli.Context) (string, error) {
+	format := clicontext.String("format")
+	if format != "table" && format != "json" {
+		return "", errors.Newf("unsupported format %s, expected table or json", format)
+	}
+	return format, nil
+}
+
+// cacheItems returns the assets in the cache dir.
+func cacheItems() ([]cacheItem, error) {
+	entries, err := home.GetManager().ListCache()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the cache")
+	}
+	items := make([]cacheItem, 0, len(entries))
+	for _, e := range entries {
+		item, err := newCacheItem(e)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func newCacheItem(e home.CacheEntry) (cacheItem, error) {
+	item := cacheItem{
+		Kind: cacheKindOther,
+		Name: e.Key,
+		Size: e.Size,
+	}
+	if !e.LastAccess.IsZero() {
+		lastAccess := e.LastAccess
+		item.LastAccess = &lastAccess
+	}
+
+	p, ok, err := vscode.PluginFromCacheKey(e.Key)
+	if err != nil {
+		return item, errors.Wrapf(err, "failed to parse the cached vscode extension %s", e.Key)
+	}
+	if ok {
+		item.Kind = cacheKindVSCodeExtension
+		item.Name = fmt.Sprintf("%s.%s", p.Publisher, p.Extension)
+		if p.Version != nil {
+			item.Version = *p.Version
+		}
+		return item, nil
+	}
+	if version, ok := vscode.ServerVersionFromCacheKey(e.Key); ok {
+		item.Kind = cacheKindVSCodeServer
+		item.Name = "vscode-server"
+		item.Version = version
+		return item, nil
+	}
+	if e.Key == shell.CacheKey {
+		item.Kind = cacheKindShell
+		rev, err := shell.NewManager(shell.Source{}).Revision()
+		if err != nil {
+			log.Debugf("failed to read the revision of oh-my-zsh: %s", err)
+			return item, nil
+		}
+		item.Version = rev.Revision
+		if rev.Commit != "" {
+			item.Version = fmt.Sprintf("%s@%s", rev.Revision, rev.Commit)
+		}
+	}
+	return item, nil
+}
+
+func cacheBuildkitClient(clicontext *cli.Context) (buildkitd.Client, error) {
+	c, err := home.GetManager().ContextGetCurrent()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the current context")
+	}
+	bkClient, err := buildkitd.NewClient(clicontext.Context, *c, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create buildkit client")
+	}
+	return bkClient, nil
+}
+
+func buildkitUsage(clicontext *cli.Context) (cacheUsage, error) {
+	u := cacheUsage{Kind: cacheKindBuildkit}
+	bkClient, err := cacheBuildkitClient(clicontext)
+	if err != nil {
+		return u, err
+	}
+	defer bkClient.Close()
+	records, err := bkClient.DiskUsage(clicontext.Context, nil)
+	if err != nil {
+		return u, err
+	}
+	var reclaimable int64
+	for _, r := range records {
+		u.Count++
+		u.Size += r.Size
+		if !r.InUse {
+			reclaimable += r.Size
+		}
+	}
+	u.Reclaimable = &reclaimable
+	return u, nil
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the output")
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
+
+func renderCacheItems(w io.Writer, items []cacheItem) {
+	table := formatter.NewTable(w, []string{
+		"Kind", "Name", "Version", "Size", "Last used",
+	})
+	for _, item := range items {
+		lastUsed := "<unknown>"
+		if item.LastAccess != nil {
+			lastUsed = units.HumanDuration(time.Since(*item.LastAccess)) + " ago"
+		}
+		table.Append([]string{
+			item.Kind,
+			item.Name,
+			formatter.StringOrNone(item.Version),
+			formatter.HumanSize(item.Size),
+			lastUsed,
+		})
+	}
+	table.Render()
+}
+
+func renderCacheUsages(w io.Writer, usages []cacheUsage) {
+	table := formatter.NewTable(w, []string{
+		"Kind", "Count", "Size", "Reclaimable",
+	})
+	var total int64
+	for _, u := range usages {
+		reclaimable := formatter.StringOrNone("")
+		if u.Reclaimable != nil {
+			reclaimable = formatter.HumanSize(*u.Reclaimable)
+		}
+		count := fmt.Sprint(u.Count)
+		if u.Kind == cacheKindUntracked {
+			count = "-"
+		}
+		table.Append([]string{
+			u.Kind, count, formatter.HumanSize(u.Size), reclaimable,
+		})
+		total += u.Size
+	}
+	table.SetFooter([]string{"Total", "", formatter.HumanSize(total), ""})
+	table.Render()
+}
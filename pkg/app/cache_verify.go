@@ -0,0 +1,144 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/editor/vscode"
+	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/shell"
+)
+
+var CommandCacheVerify = &cli.Command{
+	Name:  "verify",
+	Usage: "Verify the cached assets and download the broken ones again",
+	Description: `The vscode extensions are verified by the sha256 of the vsix, the vscode-server
+by reading through the archive, and oh-my-zsh by the git worktree at the recorded commit.
+The broken assets are removed and downloaded again, e.g. the truncated downloads. With
+--dry-run, they are only reported and the command fails if any of them is broken.`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only report the broken assets",
+		},
+	},
+	Action: verifyCache,
+}
+
+// cachedAsset is the cached asset which can be verified and downloaded again.
+type cachedAsset struct {
+	verify   func() error
+	download func(ctx context.Context) error
+}
+
+func verifyCache(clicontext *cli.Context) error {
+	ctx := clicontext.Context
+	dryRun := clicontext.Bool("dry-run")
+	// The marketplace and the oh-my-zsh mirror are used to download again.
+	if err := interpretCacheConfig(); err != nil {
+		return err
+	}
+
+	broken := 0
+	for _, key := range home.GetManager().CachedKeys() {
+		asset, err := newCachedAsset(key)
+		if err != nil {
+			return err
+		}
+		if asset == nil {
+			log.Debugf("%s cannot be verified, skipped", key)
+			continue
+		}
+		if err = asset.verify(); err == nil {
+			log.Debugf("%s is verified", key)
+			continue
+		}
+		log.Warnf("%s is broken: %s", key, err)
+		broken++
+		if dryRun {
+			continue
+		}
+		if err := home.GetManager().RemoveCache(key); err != nil {
+			return errors.Wrapf(err, "failed to remove %s", key)
+		}
+		if err := asset.download(ctx); err != nil {
+			return errors.Wrapf(err, "failed to download %s again", key)
+		}
+		log.Infof("%s is downloaded again", key)
+	}
+
+	switch {
+	case broken == 0:
+		log.Info("the cache is verified")
+	case dryRun:
+		return errors.Newf("%d assets in the cache are broken", broken)
+	default:
+		log.Infof("%d broken assets are downloaded again", broken)
+	}
+	return nil
+}
+
+// newCachedAsset returns nil if the asset of the key cannot be verified,
+// e.g. the shell history.
+func newCachedAsset(key string) (*cachedAsset, error) {
+	p, ok, err := vscode.PluginFromCacheKey(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the cached vscode extension %s", key)
+	}
+	if ok {
+		return &cachedAsset{
+			verify: func() error {
+				return vscode.VerifyCache(*p)
+			},
+			download: func(ctx context.Context) error {
+				client, err := ir.DefaultGraph.VSCodeClient()
+				if err != nil {
+					return errors.Wrap(err, "failed to create the vscode client")
+				}
+				_, _, err = client.DownloadOrCache(ctx, *p)
+				return err
+			},
+		}, nil
+	}
+	if version, ok := vscode.ServerVersionFromCacheKey(key); ok {
+		return &cachedAsset{
+			verify: func() error {
+				_, err := vscode.VerifyServerCache(version)
+				return err
+			},
+			download: func(ctx context.Context) error {
+				_, _, err := vscode.DownloadServerOrCache(ctx, ir.DefaultGraph.HTTPClient(), version)
+				return err
+			},
+		}, nil
+	}
+	if key == shell.CacheKey {
+		m := ir.DefaultGraph.ZSHManager()
+		return &cachedAsset{
+			verify: m.Verify,
+			download: func(ctx context.Context) error {
+				_, err := m.DownloadOrCache(ctx)
+				return err
+			},
+		}, nil
+	}
+	return nil, nil
+}
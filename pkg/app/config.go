@@ -0,0 +1,54 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/home"
+)
+
+const (
+	// The tiers of the configuration, from the lowest precedence.
+	tierOrg     = "org"
+	tierUser    = "user"
+	tierProject = "project"
+)
+
+var CommandConfig = &cli.Command{
+	Name:     "config",
+	Category: CategoryManagement,
+	Usage:    "Manage the layered envd configuration",
+	Subcommands: []*cli.Command{
+		CommandConfigExplain,
+	},
+}
+
+// configFile is the config file evaluated before the build file.
+type configFile struct {
+	Tier string
+	Path string
+}
+
+// configFiles returns the config files in the order of evaluation: the
+// organization defaults and the user config. The build file is evaluated
+// after them, thus the later one takes precedence.
+func configFiles() []configFile {
+	files := []configFile{}
+	if org := home.GetManager().OrgConfigFile(); org != "" {
+		files = append(files, configFile{Tier: tierOrg, Path: org})
+	}
+	return append(files, configFile{Tier: tierUser, Path: home.GetManager().ConfigFile()})
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/formatter"
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+var CommandConfigExplain = &cli.Command{
+	Name:      "explain",
+	Usage:     "Show where the setting comes from in the layered configuration",
+	ArgsUsage: "[key]",
+	Description: `The configuration is resolved in three tiers, the later one takes precedence:
+	org: the defaults pushed by the organization, /etc/envd/config.envd or $ENVD_ORG_CONFIG
+	user: the user config, config.envd in $ENVD_CONFIG_DIR, $XDG_CONFIG_HOME/envd or $HOME/.config/envd
+	project: the build file and the files loaded by it
+The key is the rule in the build file, e.g. config.pip_index, base:
+	$ envd config explain config.pip_index
+The invocations are listed in the order of evaluation. The last one is in effect for the
+settings, e.g. the mirrors and the base image, while the packages are merged from all the
+tiers. All the keys are listed with the last tier if the key is not given.`,
+	Flags: []cli.Flag{
+		&cli.PathFlag{
+			Name:    "file",
+			Usage:   "Path to the build file",
+			Aliases: []string{"f"},
+			Value:   "build.envd",
+		},
+		&cli.StringFlag{
+			Name:  "func",
+			Usage: "Function to execute in the build file",
+			Value: "build",
+		},
+	},
+	Action: configExplain,
+}
+
+// configSource is where the rule is invoked in the layered configuration.
+type configSource struct {
+	Tier     string
+	Location ir.SourceLocation
+}
+
+func configExplain(clicontext *cli.Context) error {
+	manifest, err := filepath.Abs(clicontext.Path("file"))
+	if err != nil {
+		return errors.Wrap(err, "failed to get absolute path of the build file")
+	}
+	if _, err := os.Stat(manifest); err != nil {
+		return errors.Wrapf(err, "failed to find the build file %s", manifest)
+	}
+
+	// The files are evaluated in the sandbox, thus nothing is changed on
+	// the host, e.g. the remote modules are not cloned.
+	files := configFiles()
+	interpreter := starlark.NewSandboxInterpreter(filepath.Dir(manifest))
+	for _, f := range files {
+		if _, err := interpreter.ExecFile(f.Path, ""); err != nil &&
+			!errors.Is(err, starlark.ErrRemoteModule) {
+			return errors.Wrapf(err, "failed to exec starlark file %s", f.Path)
+		}
+	}
+	_, evalErr := interpreter.ExecFile(manifest, clicontext.String("func"))
+	if evalErr != nil && !errors.Is(evalErr, starlark.ErrRemoteModule) {
+		return errors.Wrapf(evalErr, "failed to exec starlark file %s", manifest)
+	}
+	if evalErr != nil {
+		log.Warnf("the evaluation stopped at the remote module, "+
+			"the settings after it are not reported: %s", evalErr)
+	}
+
+	sources := configSources(ir.DefaultGraph.SourceLocations, files)
+	if clicontext.Args().Len() == 0 {
+		renderConfigKeys(os.Stdout, sources)
+		return nil
+	}
+	key := clicontext.Args().First()
+	if len(sources[key]) == 0 {
+		return errors.Newf("%s is not set in any tier of the configuration", key)
+	}
+	renderConfigSources(os.Stdout, sources[key])
+	return nil
+}
+
+// configSources returns the sources of the rules in the order of evaluation.
+// The tier is decided by the file, and the files not in the config files,
+// e.g. the build file and the files loaded by it, are in the project tier.
+func configSources(locations map[string][]ir.SourceLocation,
+	files []configFile) map[string][]configSource {
+	tiers := map[string]string{}
+	for _, f := range files {
+		tiers[filepath.Clean(f.Path)] = f.Tier
+	}
+	sources := map[string][]configSource{}
+	for rule, ls := range locations {
+		for _, l := range ls {
+			tier, ok := tiers[filepath.Clean(l.Filename)]
+			if !ok {
+				tier = tierProject
+			}
+			sources[rule] = append(sources[rule], configSource{Tier: tier, Location: l})
+		}
+	}
+	return sources
+}
+
+func renderConfigKeys(w io.Writer, sources map[string][]configSource) {
+	keys := make([]string, 0, len(sources))
+	for k := range sources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	table := formatter.NewTable(w, []string{"Key", "Tier", "Location"})
+	for _, k := range keys {
+		// The last one is in effect.
+		s := sources[k][len(sources[k])-1]
+		table.Append([]string{k, s.Tier,
+			fmt.Sprintf("%s:%d", s.Location.Filename, s.Location.Line)})
+	}
+	table.Render()
+}
+
+func renderConfigSources(w io.Writer, sources []configSource) {
+	table := formatter.NewTable(w, []string{"Tier", "Location", "Effective"})
+	for i, s := range sources {
+		effective := ""
+		if i == len(sources)-1 {
+			effective = "yes"
+		}
+		table.Append([]string{s.Tier,
+			fmt.Sprintf("%s:%d", s.Location.Filename, s.Location.Line), effective})
+	}
+	table.Render()
+}
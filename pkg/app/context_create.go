@@ -15,11 +15,15 @@
 package app
 
 import (
+	"path/filepath"
+	"strings"
+
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
+	"github.com/tensorchord/envd/pkg/flag"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/types"
 )
 
@@ -34,8 +38,8 @@ var CommandContextCreate = &cli.Command{
 			Required: true,
 		},
 		&cli.StringFlag{
-			Name:  "builder",
-			Usage: "Builder to use (docker-container, kube-pod, tcp)",
+			Name:  flag.FlagBuilder,
+			Usage: "Builder to use (docker-container, kube-pod, tcp, unix), or with the address (e.g. tcp://buildkitd.example.com:1234)",
 			Value: string(types.BuilderTypeDocker),
 		},
 		&cli.StringFlag{
@@ -43,14 +47,34 @@ var CommandContextCreate = &cli.Command{
 			Usage: "Builder address",
 			Value: "envd_buildkitd",
 		},
+		&cli.PathFlag{
+			Name:  flag.FlagBuilderTLSCA,
+			Usage: "CA certificate of the remote buildkitd, which enables mTLS for the tcp builder",
+		},
+		&cli.PathFlag{
+			Name:  flag.FlagBuilderTLSCert,
+			Usage: "Client certificate for the remote buildkitd",
+		},
+		&cli.PathFlag{
+			Name:  flag.FlagBuilderTLSKey,
+			Usage: "Client key for the remote buildkitd",
+		},
+		&cli.StringFlag{
+			Name:  flag.FlagBuilderTLSName,
+			Usage: "Server name in the certificate of the remote buildkitd, the host of the address by default",
+		},
 		&cli.StringFlag{
 			Name:  "runner",
-			Usage: "Runner to use(docker, envd-server)",
+			Usage: "Runner to use(docker, envd-server, nerdctl)",
 			Value: string(types.RunnerTypeDocker),
 		},
 		&cli.StringFlag{
 			Name:  "runner-address",
-			Usage: "Runner address",
+			Usage: "Runner address, i.e. the docker host or the containerd socket of nerdctl",
+		},
+		&cli.StringFlag{
+			Name:  "registry",
+			Usage: "Registry to push the images to if the runner is remote (e.g. registry.example.com:5000/envd)",
 		},
 		&cli.BoolFlag{
 			Name:  "use",
@@ -62,8 +86,19 @@ var CommandContextCreate = &cli.Command{
 
 func contextCreate(clicontext *cli.Context) error {
 	name := clicontext.String("name")
-	builder := clicontext.String("builder")
+	builder := clicontext.String(flag.FlagBuilder)
 	builderAddress := clicontext.String("builder-address")
+	if strings.Contains(builder, "://") {
+		typ, address, err := types.ParseBuilder(builder)
+		if err != nil {
+			return err
+		}
+		builder, builderAddress = string(typ), address
+	}
+	builderTLS, err := builderTLSFromFlags(clicontext)
+	if err != nil {
+		return err
+	}
 	runner := clicontext.String("runner")
 	runnerAddress := clicontext.String("runner-address")
 	use := clicontext.Bool("use")
@@ -73,18 +108,48 @@ func contextCreate(clicontext *cli.Context) error {
 		Builder:        types.BuilderType(builder),
 		BuilderAddress: builderAddress,
 		Runner:         types.RunnerType(runner),
+		Registry:       clicontext.String("registry"),
+		BuilderTLS:     builderTLS,
 	}
 	if runnerAddress != "" {
 		c.RunnerAddress = &runnerAddress
 	}
 
-	err := home.GetManager().ContextCreate(c, use)
+	err = home.GetManager().ContextCreate(c, use)
 	if err != nil {
 		return errors.Wrap(err, "failed to create context")
 	}
-	logrus.Infof("Context %s is created", name)
+	log.Infof("Context %s is created", name)
 	if use {
-		logrus.Infof("Current context is now \"%s\"", name)
+		log.Infof("Current context is now \"%s\"", name)
 	}
 	return nil
 }
+
+// builderTLSFromFlags returns nil if none of the TLS flags is set. The paths
+// are absolute since they are kept in the context.
+func builderTLSFromFlags(clicontext *cli.Context) (*types.BuilderTLS, error) {
+	t := types.BuilderTLS{ServerName: clicontext.String(flag.FlagBuilderTLSName)}
+	for _, f := range []struct {
+		name string
+		path *string
+	}{
+		{flag.FlagBuilderTLSCA, &t.CACert},
+		{flag.FlagBuilderTLSCert, &t.Cert},
+		{flag.FlagBuilderTLSKey, &t.Key},
+	} {
+		p := clicontext.Path(f.name)
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get the absolute path of %s", p)
+		}
+		*f.path = abs
+	}
+	if t == (types.BuilderTLS{}) {
+		return nil, nil
+	}
+	return &t, nil
+}
@@ -20,9 +20,9 @@ import (
 	"os"
 
 	"github.com/cockroachdb/errors"
-	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli/v2"
 
+	"github.com/tensorchord/envd/pkg/formatter"
 	"github.com/tensorchord/envd/pkg/home"
 	"github.com/tensorchord/envd/pkg/types"
 )
@@ -43,20 +43,9 @@ func contextList(clicontext *cli.Context) error {
 }
 
 func renderContext(contexts types.EnvdContext, w io.Writer) {
-	table := tablewriter.NewWriter(w)
-	table.SetHeader([]string{"context", "builder", "builder addr", "runner", "runner addr"})
-
-	table.SetAutoWrapText(false)
-	table.SetAutoFormatHeaders(true)
-	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetCenterSeparator("")
-	table.SetColumnSeparator("")
-	table.SetRowSeparator("")
-	table.SetHeaderLine(false)
-	table.SetBorder(false)
-	table.SetTablePadding("\t") // pad with tabs
-	table.SetNoWhiteSpace(true)
+	table := formatter.NewTable(w, []string{
+		"context", "builder", "builder addr", "runner", "runner addr",
+	})
 
 	for _, p := range contexts.Contexts {
 		envRow := make([]string, 5)
@@ -67,9 +56,12 @@ func renderContext(contexts types.EnvdContext, w io.Writer) {
 		}
 		envRow[1] = string(p.Builder)
 		envRow[2] = fmt.Sprintf("%s://%s", p.Builder, p.BuilderAddress)
+		if p.BuilderTLS != nil {
+			envRow[2] += " (mTLS)"
+		}
 		envRow[3] = string(p.Runner)
 		if p.RunnerAddress != nil {
-			envRow[4] = stringOrNone(*p.RunnerAddress)
+			envRow[4] = formatter.StringOrNone(*p.RunnerAddress)
 		}
 		table.Append(envRow)
 	}
@@ -16,10 +16,10 @@ package app
 
 import (
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 var CommandContextRemove = &cli.Command{
@@ -43,6 +43,6 @@ func contextRemove(clicontext *cli.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to remove context")
 	}
-	logrus.Infof("Context %s is removed", name)
+	log.Infof("Context %s is removed", name)
 	return nil
 }
@@ -16,10 +16,10 @@ package app
 
 import (
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 var CommandContextUse = &cli.Command{
@@ -43,6 +43,6 @@ func contextUse(clicontext *cli.Context) error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to use the specified context %s", name)
 	}
-	logrus.Infof("Current context is now \"%s\"", name)
+	log.Infof("Current context is now \"%s\"", name)
 	return nil
 }
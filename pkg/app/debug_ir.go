@@ -0,0 +1,120 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
+)
+
+var CommandDebugIR = &cli.Command{
+	Name:  "ir",
+	Usage: "Dump the intermediate representation of the envd environment",
+	Description: `
+To dump the graph as JSON:
+	$ envd debug ir
+To dump the graph as YAML, which can be edited and built by envd build --from graph.yaml:
+	$ envd debug ir --format yaml > graph.yaml
+To dump the graph and the LLB vertices as YAML:
+	$ envd debug ir --llb --format yaml
+`,
+	Flags: []cli.Flag{
+		&cli.PathFlag{
+			Name:    "path",
+			Usage:   "Path to the directory containing the build.envd",
+			Aliases: []string{"p"},
+			Value:   ".",
+		},
+		&cli.PathFlag{
+			Name:    "from",
+			Usage:   "Function to execute, format `file:func`",
+			Aliases: []string{"f"},
+			Value:   "build.envd:build",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "Output format (json, yaml)",
+			Value: "json",
+		},
+		&cli.BoolFlag{
+			Name:  "llb",
+			Usage: "Compile the graph and dump the LLB vertices with their digests",
+			Value: false,
+		},
+		&cli.PathFlag{
+			Name:    "public-key",
+			Usage:   "Path to the public key",
+			Aliases: []string{"pubk"},
+			Value:   sshconfig.GetPublicKeyOrPanic(),
+			Hidden:  true,
+		},
+	},
+	Action: debugIR,
+}
+
+// irDump without the LLB vertices is the same as ir.GraphDocument, thus it
+// can be used as the build file, e.g. envd build --from graph.json.
+type irDump struct {
+	Version string         `json:"version"`
+	Graph   *ir.Graph      `json:"graph"`
+	LLB     []ir.LLBVertex `json:"llb,omitempty"`
+}
+
+func debugIR(clicontext *cli.Context) error {
+	format := clicontext.String("format")
+	if format != "json" && format != "yaml" {
+		return errors.Newf("unsupported format %s, expected json or yaml", format)
+	}
+	buildContext, err := interpretWithoutBuildkitd(clicontext)
+	if err != nil {
+		return err
+	}
+
+	dump := irDump{Version: ir.GraphSchemaVersion}
+	if clicontext.Bool("llb") {
+		dump.LLB, err = ir.DumpLLB(clicontext.Context,
+			filepath.Base(buildContext), clicontext.Path("public-key"), ir.CompileOptions{})
+		if err != nil {
+			return errors.Wrap(err, "failed to compile the graph")
+		}
+	}
+	// The graph is dumped after the compilation since it fills some fields.
+	dump.Graph = ir.DefaultGraph
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the graph")
+	}
+	if format == "yaml" {
+		// Convert from JSON to keep the field names.
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return errors.Wrap(err, "failed to unmarshal the graph")
+		}
+		if data, err = yaml.Marshal(v); err != nil {
+			return errors.Wrap(err, "failed to marshal the graph to yaml")
+		}
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -20,13 +20,15 @@ import (
 	"strings"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
-	"github.com/tensorchord/envd/pkg/docker"
+	"github.com/tensorchord/envd/pkg/builder"
 	"github.com/tensorchord/envd/pkg/envd"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/prompt"
 	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
+	"github.com/tensorchord/envd/pkg/types"
 )
 
 var CommandDestroy = &cli.Command{
@@ -41,11 +43,28 @@ var CommandDestroy = &cli.Command{
 			Aliases:     []string{"p"},
 			DefaultText: "current directory",
 		},
+		&cli.StringFlag{
+			Name:  "env",
+			Usage: "Name of the environment declared by environment(name, build) in the build file of --path",
+		},
 		&cli.PathFlag{
 			Name:    "name",
 			Usage:   "Name of the environment or container ID",
 			Aliases: []string{"n"},
 		},
+		&cli.StringSliceFlag{
+			Name:  "filter",
+			Usage: "Destroy the environments matching the tags set by envd up --env-tag, e.g. tag=team=nlp",
+		},
+		&cli.BoolFlag{
+			Name:  "volumes",
+			Usage: "Remove the volume keeping the shell state, the shell history in the cache dir, and the ssh host key",
+		},
+		&cli.BoolFlag{
+			Name:    "yes",
+			Usage:   "Skip the confirmation prompt",
+			Aliases: []string{"y"},
+		},
 	},
 
 	Action: destroy,
@@ -54,67 +73,137 @@ var CommandDestroy = &cli.Command{
 func destroy(clicontext *cli.Context) error {
 	path := clicontext.Path("path")
 	name := clicontext.String("name")
+	filters, err := types.ParseEnvironmentFilters(clicontext.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
 	if path != "" && name != "" {
 		return errors.New("Cannot specify --path and --name at the same time.")
 	}
+	if len(filters) > 0 && (path != "" || name != "") {
+		return errors.New("Cannot specify --filter with --path or --name at the same time.")
+	}
 	if path == "" && name == "" {
 		path = "."
 	}
-	dockerClient, err := docker.NewClient(clicontext.Context)
+	c, err := home.GetManager().ContextGetCurrent()
 	if err != nil {
-		return err
+		return errors.Wrap(err, "failed to get the current context")
+	}
+	engine, err := envd.New(clicontext.Context, envd.Options{Context: c})
+	if err != nil {
+		return errors.Wrap(err, "failed to create the envd engine")
 	}
-	var ctrName string
-	if name != "" {
-		ctrName = name
-	} else {
+
+	var ctrNames []string
+	switch {
+	case len(filters) > 0:
+		envs, err := engine.ListEnvironment(clicontext.Context)
+		if err != nil {
+			return errors.Wrap(err, "failed to list the environments")
+		}
+		for _, env := range types.FilterEnvironments(envs, filters) {
+			ctrNames = append(ctrNames, env.Name)
+		}
+		if len(ctrNames) == 0 {
+			log.Info("no environment matches the filters")
+			return nil
+		}
+	case name != "":
+		ctrNames = []string{name}
+	default:
 		buildContext, err := filepath.Abs(path)
 		if err != nil {
 			return errors.Wrap(err, "failed to get absolute path of the build context")
 		}
-		ctrName = filepath.Base(buildContext)
+		ctrNames = []string{builder.EnvironmentName(buildContext, clicontext.String("env"))}
 	}
 
-	if ctrName, err := dockerClient.Destroy(clicontext.Context, ctrName); err != nil {
+	summary := prompt.Summary{}
+	tags := make(map[string][]string, len(ctrNames))
+	for _, ctrName := range ctrNames {
+		exists, err := engine.Exists(clicontext.Context, ctrName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check the container %s", ctrName)
+		}
+		if tags[ctrName], err = getContainerTag(clicontext, engine, ctrName); err != nil {
+			return err
+		}
+		summary.Images = append(summary.Images, tags[ctrName]...)
+		if exists {
+			summary.Containers = append(summary.Containers, ctrName)
+		}
+		if clicontext.Bool("volumes") {
+			summary.Volumes = append(summary.Volumes, envd.StateVolumeName(ctrName))
+		}
+	}
+	ok, err := prompt.Confirm(summary, clicontext.Bool("yes"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Info("destroy is cancelled")
+		return nil
+	}
+
+	for _, ctrName := range ctrNames {
+		if err := destroyEnvironment(clicontext, engine, ctrName, tags[ctrName]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// destroyEnvironment removes the container, the secrets written for it, the
+// images and optionally the state volume of the environment, then its entry
+// in the SSH config.
+func destroyEnvironment(clicontext *cli.Context, engine envd.Engine,
+	ctrName string, tags []string) error {
+	if ctrName, err := engine.DestroyEnvironment(clicontext.Context, ctrName); err != nil {
 		return errors.Wrapf(err, "failed to destroy the environment: %s", ctrName)
 	} else if ctrName != "" {
-		logrus.Infof("container(%s) is destroyed", ctrName)
+		log.Infof("container(%s) is destroyed", ctrName)
 	}
-
-	tags, err := getContainerTag(clicontext, ctrName)
-	if err != nil {
+	// The credentials are only used by the container.
+	if err := removeGitCredentials(ctrName); err != nil {
 		return err
-	} else {
-		for _, tag := range tags {
-			if err := dockerClient.RemoveImage(clicontext.Context, tag); err != nil {
-				return errors.Errorf("remove image %s failed: %w", tag, err)
-			}
-			logrus.Infof("image(%s) is destroyed", tag)
+	}
+	if err := envd.RemoveDatabaseProfiles(ctrName); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := engine.RemoveImage(clicontext.Context, tag); err != nil {
+			return errors.Errorf("remove image %s failed: %w", tag, err)
 		}
+		log.Infof("image(%s) is destroyed", tag)
 	}
 
-	if err = sshconfig.RemoveEntry(ctrName); err != nil {
-		logrus.Infof("failed to remove entry %s from your SSH config file: %s", ctrName, err)
+	if clicontext.Bool("volumes") {
+		volume := envd.StateVolumeName(ctrName)
+		if err := engine.RemoveVolume(clicontext.Context, volume); err != nil {
+			return err
+		}
+		log.Infof("volume(%s) is destroyed", volume)
+		if err := sshconfig.RemoveHostKey(ctrName); err != nil {
+			return err
+		}
+		if err := envd.RemoveHistory(ctrName); err != nil {
+			return err
+		}
+	}
+
+	if err := sshconfig.RemoveEntry(ctrName); err != nil {
+		log.Infof("failed to remove entry %s from your SSH config file: %s", ctrName, err)
 		return errors.Wrap(err, "failed to remove entry from your SSH config file")
 	}
 	return nil
 }
 
-func getContainerTag(clicontext *cli.Context, name string) ([]string, error) {
+func getContainerTag(clicontext *cli.Context, engine envd.Engine, name string) ([]string, error) {
 	tags := []string{}
-	context, err := home.GetManager().ContextGetCurrent()
-	if err != nil {
-		return tags, err
-	}
-	opt := envd.Options{
-		Context: context,
-	}
-	envdEngine, err := envd.New(clicontext.Context, opt)
-	if err != nil {
-		return tags, err
-	}
 	// check the images instead of running containers because `envd build` also produce images
-	images, err := envdEngine.ListImage(clicontext.Context)
+	images, err := engine.ListImage(clicontext.Context)
 	if err != nil {
 		return tags, err
 	}
@@ -126,7 +215,7 @@ func getContainerTag(clicontext *cli.Context, name string) ([]string, error) {
 		}
 	}
 	if len(tags) == 0 {
-		logrus.Infof("cannot find the image of %s", name)
+		log.Infof("cannot find the image of %s", name)
 	}
 	return tags, nil
 }
@@ -18,16 +18,18 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/cockroachdb/errors"
 	"github.com/docker/docker/pkg/stringid"
-	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli/v2"
 
 	"github.com/tensorchord/envd/pkg/envd"
+	"github.com/tensorchord/envd/pkg/formatter"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/types"
 )
 
@@ -47,64 +49,95 @@ var CommandListEnv = &cli.Command{
 	Name:    "list",
 	Aliases: []string{"ls", "l"},
 	Usage:   "List envd environments",
-	Action:  getEnvironment,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "all-contexts",
+			Usage:   "List the environments on the runners of all the contexts, e.g. placed by envd up --auto-place",
+			Aliases: []string{"A"},
+		},
+		&cli.StringSliceFlag{
+			Name:  "filter",
+			Usage: "Filter the environments by the tags set by envd up --env-tag, e.g. tag=team=nlp or tag=team",
+		},
+	},
+	Action: getEnvironment,
 }
 
 func getEnvironment(clicontext *cli.Context) error {
+	filters, err := types.ParseEnvironmentFilters(clicontext.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
 	context, err := home.GetManager().ContextGetCurrent()
 	if err != nil {
 		return errors.Wrap(err, "failed to get the current context")
 	}
-	opt := envd.Options{
-		Context: context,
+	contexts := []types.Context{*context}
+	if clicontext.Bool("all-contexts") {
+		c, err := home.GetManager().ContextList()
+		if err != nil {
+			return errors.Wrap(err, "failed to list context")
+		}
+		contexts = c.Contexts
 	}
-	envdEngine, err := envd.New(clicontext.Context, opt)
-	if err != nil {
-		return err
-	}
-	envs, err := envdEngine.ListEnvironment(clicontext.Context)
-	if err != nil {
-		return err
+
+	envs := []types.EnvdEnvironment{}
+	for i := range contexts {
+		opt := envd.Options{
+			Context: &contexts[i],
+		}
+		envdEngine, err := envd.New(clicontext.Context, opt)
+		if err == nil {
+			var res []types.EnvdEnvironment
+			res, err = envdEngine.ListEnvironment(clicontext.Context)
+			envs = append(envs, res...)
+		}
+		if err != nil {
+			if len(contexts) == 1 {
+				return err
+			}
+			log.Warnf("failed to list the environments of context %s: %s",
+				contexts[i].Name, err)
+		}
 	}
-	renderEnvironments(envs, os.Stdout)
+	renderEnvironments(types.FilterEnvironments(envs, filters), os.Stdout)
 	return nil
 }
 
 func renderEnvironments(envs []types.EnvdEnvironment, w io.Writer) {
-	table := tablewriter.NewWriter(w)
-	table.SetHeader([]string{
+	table := formatter.NewTable(w, []string{
 		"Name", "Endpoint", "SSH Target", "Image",
-		"GPU", "CUDA", "CUDNN", "Status", "Container ID",
+		"GPU", "CUDA", "CUDNN", "Status", "Container ID", "Context", "Tags",
 	})
 
-	table.SetAutoWrapText(false)
-	table.SetAutoFormatHeaders(true)
-	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetCenterSeparator("")
-	table.SetColumnSeparator("")
-	table.SetRowSeparator("")
-	table.SetHeaderLine(false)
-	table.SetBorder(false)
-	table.SetTablePadding("\t") // pad with tabs
-	table.SetNoWhiteSpace(true)
-
 	for _, env := range envs {
-		envRow := make([]string, 9)
+		envRow := make([]string, 11)
 		envRow[0] = env.Name
 		envRow[1] = endpointOrNone(env)
 		envRow[2] = fmt.Sprintf("%s.envd", env.Name)
 		envRow[3] = env.Container.Image
 		envRow[4] = strconv.FormatBool(env.GPU)
-		envRow[5] = stringOrNone(env.CUDA)
-		envRow[6] = stringOrNone(env.CUDNN)
+		envRow[5] = formatter.StringOrNone(env.CUDA)
+		envRow[6] = formatter.StringOrNone(env.CUDNN)
 		envRow[7] = env.Status
 		envRow[8] = stringid.TruncateID(env.Container.ID)
+		envRow[9] = formatter.StringOrNone(env.Context)
+		envRow[10] = formatter.StringOrNone(tagsString(env.Tags))
 		table.Append(envRow)
 	}
 	table.Render()
 }
 
+// tagsString returns the tags sorted by the keys, e.g. owner=alice,team=nlp.
+func tagsString(tags map[string]string) string {
+	res := make([]string, 0, len(tags))
+	for k, v := range tags {
+		res = append(res, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
+
 func endpointOrNone(env types.EnvdEnvironment) string {
 	var res strings.Builder
 	if env.JupyterAddr != nil {
@@ -113,5 +146,8 @@ func endpointOrNone(env types.EnvdEnvironment) string {
 	if env.RStudioServerAddr != nil {
 		res.WriteString(fmt.Sprintf("rstudio: %s", *env.RStudioServerAddr))
 	}
+	if env.CodeServerAddr != nil {
+		res.WriteString(fmt.Sprintf("code-server: %s", *env.CodeServerAddr))
+	}
 	return res.String()
 }
@@ -15,14 +15,15 @@
 package app
 
 import (
+	"fmt"
 	"io"
 	"os"
 
 	"github.com/cockroachdb/errors"
-	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli/v2"
 
 	"github.com/tensorchord/envd/pkg/envd"
+	"github.com/tensorchord/envd/pkg/formatter"
 	"github.com/tensorchord/envd/pkg/home"
 	"github.com/tensorchord/envd/pkg/types"
 )
@@ -38,6 +39,10 @@ var CommandDescribeEnvironment = &cli.Command{
 			Aliases:  []string{"e"},
 			Required: true,
 		},
+		&cli.BoolFlag{
+			Name:  "entrypoint",
+			Usage: "Show the entrypoint script generated from the build file",
+		},
 	},
 	Action: getEnvironmentDescriptions,
 }
@@ -56,6 +61,15 @@ func getEnvironmentDescriptions(clicontext *cli.Context) error {
 		return errors.Wrap(err, "failed to create envd engine")
 	}
 
+	if clicontext.Bool("entrypoint") {
+		script, err := envdEngine.GetEnvEntrypoint(clicontext.Context, envName)
+		if err != nil {
+			return errors.Wrap(err, "failed to get the entrypoint script")
+		}
+		fmt.Fprint(os.Stdout, script)
+		return nil
+	}
+
 	dep, err := envdEngine.ListEnvDependency(clicontext.Context, envName)
 	if err != nil {
 		return errors.Wrap(err, "failed to list dependencies")
@@ -71,30 +85,11 @@ func getEnvironmentDescriptions(clicontext *cli.Context) error {
 	return nil
 }
 
-func createTable(w io.Writer, headers []string) *tablewriter.Table {
-	table := tablewriter.NewWriter(w)
-	table.SetHeader(headers)
-
-	table.SetAutoWrapText(false)
-	table.SetAutoFormatHeaders(true)
-	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetCenterSeparator("")
-	table.SetColumnSeparator("")
-	table.SetRowSeparator("")
-	table.SetHeaderLine(false)
-	table.SetBorder(true)
-	table.SetTablePadding("\t") // pad with tabs
-	table.SetNoWhiteSpace(true)
-
-	return table
-}
-
 func renderPortBindings(w io.Writer, ports []types.PortBinding) {
 	if ports == nil {
 		return
 	}
-	table := createTable(w, []string{"Container Port", "Protocol", "Host IP", "Host Port"})
+	table := formatter.NewBorderedTable(w, []string{"Container Port", "Protocol", "Host IP", "Host Port"})
 	for _, port := range ports {
 		row := make([]string, 4)
 		row[0] = port.Port
@@ -110,7 +105,7 @@ func renderDependencies(w io.Writer, dep *types.Dependency) {
 	if dep == nil {
 		return
 	}
-	table := createTable(w, []string{"Dependencies", "Type"})
+	table := formatter.NewBorderedTable(w, []string{"Dependencies", "Type"})
 	for _, p := range dep.PyPIPackages {
 		envRow := make([]string, 2)
 		envRow[0] = p
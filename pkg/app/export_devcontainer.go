@@ -0,0 +1,101 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/builder"
+	"github.com/tensorchord/envd/pkg/docker"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+var CommandExportDevContainer = &cli.Command{
+	Name:  "devcontainer",
+	Usage: "Export the envd environment as a devcontainer.json",
+	Description: `The devcontainer.json refers to the image built by envd build, thus the
+same environment can be opened by VS Code Remote Containers and GitHub Codespaces:
+
+    envd build && envd export devcontainer -o .devcontainer/devcontainer.json
+`,
+	Flags: []cli.Flag{
+		&cli.PathFlag{
+			Name:    "path",
+			Usage:   "Path to the directory containing the build.envd",
+			Aliases: []string{"p"},
+			Value:   ".",
+		},
+		&cli.PathFlag{
+			Name:    "from",
+			Usage:   "Function to execute, format `file:func`",
+			Aliases: []string{"f"},
+			Value:   "build.envd:build",
+		},
+		&cli.StringFlag{
+			Name:        "image",
+			Usage:       "Image of the environment, in the 'name:tag' format",
+			Aliases:     []string{"i"},
+			DefaultText: "PROJECT:dev",
+		},
+		&cli.PathFlag{
+			Name:        "output",
+			Usage:       "Path to the exported devcontainer.json",
+			Aliases:     []string{"o"},
+			DefaultText: "stdout",
+		},
+	},
+	Action: exportDevContainer,
+}
+
+func exportDevContainer(clicontext *cli.Context) error {
+	buildContext, err := interpretWithoutBuildkitd(clicontext)
+	if err != nil {
+		return err
+	}
+
+	envName := builder.EnvironmentName(buildContext, "")
+	image := clicontext.String("image")
+	if image == "" {
+		image = fmt.Sprintf("%s:%s", envName, ir.TargetDev)
+	}
+	image, err = docker.NormalizeNamed(image)
+	if err != nil {
+		return err
+	}
+	data, err := ir.DevContainer(filepath.Base(buildContext), image)
+	if err != nil {
+		return errors.Wrap(err, "failed to export the devcontainer.json")
+	}
+
+	output := clicontext.Path("output")
+	if output == "" {
+		fmt.Print(string(data))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create the directory of %s", output)
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write the devcontainer.json to %s", output)
+	}
+	log.Infof("devcontainer.json is exported to %s, it refers to the image %s", output, image)
+	return nil
+}
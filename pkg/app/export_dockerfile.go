@@ -0,0 +1,145 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/builder"
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+var CommandExportDockerfile = &cli.Command{
+	Name:  "dockerfile",
+	Usage: "Export the envd environment as a Dockerfile",
+	Flags: []cli.Flag{
+		&cli.PathFlag{
+			Name:    "path",
+			Usage:   "Path to the directory containing the build.envd",
+			Aliases: []string{"p"},
+			Value:   ".",
+		},
+		&cli.PathFlag{
+			Name:    "from",
+			Usage:   "Function to execute, format `file:func`",
+			Aliases: []string{"f"},
+			Value:   "build.envd:build",
+		},
+		&cli.PathFlag{
+			Name:        "output",
+			Usage:       "Path to the exported Dockerfile",
+			Aliases:     []string{"o"},
+			DefaultText: "stdout",
+		},
+		&cli.PathFlag{
+			Name:    "public-key",
+			Usage:   "Path to the public key",
+			Aliases: []string{"pubk"},
+			Value:   sshconfig.GetPublicKeyOrPanic(),
+			Hidden:  true,
+		},
+	},
+	Action: exportDockerfile,
+}
+
+func exportDockerfile(clicontext *cli.Context) error {
+	buildContext, err := interpretWithoutBuildkitd(clicontext)
+	if err != nil {
+		return err
+	}
+	// The PyPI packages are pinned by the lockfile like envd build.
+	if err := useLockfile(buildContext); err != nil {
+		return err
+	}
+
+	dockerfile, err := ir.Dockerfile(filepath.Base(buildContext),
+		clicontext.Path("public-key"), buildContext)
+	if err != nil {
+		return errors.Wrap(err, "failed to export the Dockerfile")
+	}
+
+	output := clicontext.Path("output")
+	if output == "" {
+		fmt.Print(dockerfile)
+		return nil
+	}
+	if err := os.WriteFile(output, []byte(dockerfile), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write the Dockerfile to %s", output)
+	}
+	log.Infof("Dockerfile is exported to %s, build it in %s", output, buildContext)
+	return nil
+}
+
+// useLockfile uses the lockfile in the build context if it exists.
+func useLockfile(buildContext string) error {
+	lockfile := filepath.Join(buildContext, ir.LockFileName)
+	exists, err := fileutil.FileExists(lockfile)
+	if err != nil {
+		return err
+	}
+	if exists {
+		l, err := ir.LoadLock(lockfile)
+		if err != nil {
+			return err
+		}
+		log.Debugf("using the lockfile %s", lockfile)
+		ir.UseLock(l)
+	}
+	return ir.CheckPipLock()
+}
+
+// interpretWithoutBuildkitd interprets the config file and the build file
+// into ir.DefaultGraph, and returns the absolute path of the build context.
+func interpretWithoutBuildkitd(clicontext *cli.Context) (string, error) {
+	buildContext, err := filepath.Abs(clicontext.Path("path"))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get absolute path of the build context")
+	}
+	fileName, funcName, err := builder.ParseFromStr(clicontext.String("from"))
+	if err != nil {
+		return "", err
+	}
+	manifest, err := fileutil.FindFileAbsPath(buildContext, fileName)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get absolute path of the build file")
+	}
+	if manifest == "" {
+		return "", errors.New("file does not exist")
+	}
+
+	if ir.IsGraphFile(manifest) {
+		return buildContext, ir.LoadGraph(manifest)
+	}
+
+	interpreter := starlark.NewInterpreter(buildContext)
+	for _, config := range configFiles() {
+		if _, err := interpreter.ExecFile(config.Path, ""); err != nil {
+			return "", errors.Wrapf(err, "failed to exec starlark file %s", config.Path)
+		}
+	}
+	if _, err := interpreter.ExecFile(manifest, funcName); err != nil {
+		return "", errors.Wrapf(err, "failed to exec starlark file %s", manifest)
+	}
+	return buildContext, nil
+}
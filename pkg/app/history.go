@@ -0,0 +1,86 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/formatter"
+	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+var CommandHistory = &cli.Command{
+	Name:     "history",
+	Category: CategoryOther,
+	Usage:    "Show the history of the envd commands",
+	Description: `The commands are recorded in the audit log under the envd config directory,
+with the secrets in the arguments redacted. Show the full audit trail:
+	$ envd history --audit`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "audit",
+			Usage: "Show the user, the host, the result and the duration of the commands",
+		},
+		&cli.IntFlag{
+			Name:    "limit",
+			Usage:   "Number of the latest commands to show, 0 for all",
+			Aliases: []string{"n"},
+			Value:   20,
+		},
+	},
+	Action: history,
+}
+
+func history(clicontext *cli.Context) error {
+	records, err := home.GetManager().ListAudit()
+	if err != nil {
+		return errors.Wrap(err, "failed to read the audit log")
+	}
+	if limit := clicontext.Int("limit"); limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	renderHistory(records, clicontext.Bool("audit"), os.Stdout)
+	return nil
+}
+
+func renderHistory(records []types.AuditRecord, audit bool, w io.Writer) {
+	headers := []string{"Time", "Command"}
+	if audit {
+		headers = append(headers, "User", "Host", "Result", "Duration")
+	}
+	table := formatter.NewTable(w, headers)
+	for _, r := range records {
+		row := []string{
+			r.Time.Format("2006-01-02 15:04:05"),
+			strings.Join(append([]string{"envd"}, r.Args...), " "),
+		}
+		if audit {
+			result := "success"
+			if r.Error != "" {
+				result = "error: " + r.Error
+			}
+			row = append(row, formatter.StringOrNone(r.User), formatter.StringOrNone(r.Host),
+				result, formatter.HumanDuration(r.Duration))
+		}
+		table.Append(row)
+	}
+	table.Render()
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/cockroachdb/errors"
 	cli "github.com/urfave/cli/v2"
 
+	"github.com/tensorchord/envd/pkg/lang/ir"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
@@ -57,6 +58,10 @@ var CommandInit = &cli.Command{
 			Aliases: []string{"p"},
 			Value:   ".",
 		},
+		&cli.PathFlag{
+			Name:  "devcontainer",
+			Usage: "Import the devcontainer.json instead of detecting the language, e.g. .devcontainer/devcontainer.json",
+		},
 	},
 	Action: initCommand,
 }
@@ -118,7 +123,8 @@ func NewPythonEnv(dir string) (*pythonEnv, error) {
 func (pe *pythonEnv) generate() []byte {
 	var buf bytes.Buffer
 	buf.WriteString("def build():\n")
-	buf.WriteString(fmt.Sprintf("%sbase(os=\"ubuntu20.04\", language=\"%s\")\n", pe.indent, pe.pythonVersion))
+	buf.WriteString(fmt.Sprintf("%sos(name=\"ubuntu\", version=\"20.04\")\n", pe.indent))
+	buf.WriteString(fmt.Sprintf("%sbase(language=\"%s\")\n", pe.indent, pe.pythonVersion))
 	if len(pe.requirements) > 0 {
 		buf.WriteString(fmt.Sprintf("%sinstall.python_packages(requirements=\"%s\")\n", pe.indent, pe.requirements))
 	}
@@ -173,7 +179,13 @@ func initCommand(clicontext *cli.Context) error {
 	}
 
 	var buildEnvdContent []byte
-	if lang == "python" {
+	if devcontainer := clicontext.Path("devcontainer"); devcontainer != "" {
+		devcontainer, err = filepath.Abs(devcontainer)
+		if err != nil {
+			return err
+		}
+		buildEnvdContent, err = ir.ImportDevContainer(devcontainer, buildContext)
+	} else if lang == "python" {
 		buildEnvdContent, err = initPythonEnv(buildContext)
 	} else {
 		buildEnvdContent, err = templatef.ReadFile("template/" + lang + ".envd")
@@ -0,0 +1,104 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/formatter"
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+var CommandInspect = &cli.Command{
+	Name:      "inspect",
+	Category:  CategoryAdvanced,
+	Usage:     "Report the external resources of the build file without building it",
+	ArgsUsage: "[build file]",
+	Description: `The build file is evaluated in a sandbox without side effects on the host, i.e. no image
+is built, no remote module is cloned and no data dir is created. The images, URLs, repos,
+mirrors, packages, commands and host paths it would touch are reported, thus the build
+file from the third party can be reviewed before it is trusted:
+	$ envd inspect build.envd
+The remote modules loaded by include are reported but not evaluated, review them separately.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "func",
+			Usage: "Function to execute in the build file",
+			Value: "build",
+		},
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "Build target evaluated by target() in the build file",
+			Value: ir.TargetDev,
+		},
+	},
+	Action: inspect,
+}
+
+func inspect(clicontext *cli.Context) error {
+	file := "build.envd"
+	if clicontext.Args().Len() > 0 {
+		file = clicontext.Args().First()
+	}
+	manifest, err := filepath.Abs(file)
+	if err != nil {
+		return errors.Wrap(err, "failed to get absolute path of the build file")
+	}
+	if _, err := os.Stat(manifest); err != nil {
+		return errors.Wrapf(err, "failed to find the build file %s", file)
+	}
+
+	// The config file on the host is trusted, thus it is not evaluated.
+	ir.Target(clicontext.String("target"))
+	interpreter := starlark.NewSandboxInterpreter(filepath.Dir(manifest))
+	_, evalErr := interpreter.ExecFile(manifest, clicontext.String("func"))
+	if evalErr != nil && !errors.Is(evalErr, starlark.ErrRemoteModule) {
+		return errors.Wrapf(evalErr, "failed to exec starlark file %s", manifest)
+	}
+
+	resources, err := ir.DefaultGraph.ExternalResources()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the external resources")
+	}
+	renderResources(resources, ir.DefaultGraph.SourceLocations, os.Stdout)
+	if evalErr != nil {
+		log.Warnf("the evaluation stopped at the remote module, "+
+			"the resources after it are not reported: %s", evalErr)
+	}
+	return nil
+}
+
+func renderResources(resources []ir.Resource,
+	locations map[string][]ir.SourceLocation, w io.Writer) {
+	table := formatter.NewTable(w, []string{"Kind", "Resource", "Rule", "Location"})
+	for _, r := range resources {
+		lines := []string{}
+		for _, l := range locations[r.Rule] {
+			lines = append(lines, fmt.Sprintf("%s:%d", filepath.Base(l.Filename), l.Line))
+		}
+		table.Append([]string{r.Kind, r.Name, r.Rule,
+			formatter.StringOrNone(strings.Join(lines, ", "))})
+	}
+	table.Render()
+}
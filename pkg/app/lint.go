@@ -0,0 +1,86 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+)
+
+var CommandLint = &cli.Command{
+	Name:      "lint",
+	Category:  CategoryAdvanced,
+	Usage:     "Check the build file for the problems without building it",
+	ArgsUsage: "[build file]",
+	Description: `The build file is evaluated in a sandbox as envd inspect does, and the unknown functions,
+the bad arguments, the conflicting rules (e.g. two base images) and the deprecated usages
+are reported with the positions:
+	$ envd lint build.envd
+The command fails if there is any error, the warnings do not fail it.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "func",
+			Usage: "Function to execute in the build file",
+			Value: "build",
+		},
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "Build target evaluated by target() in the build file",
+			Value: ir.TargetDev,
+		},
+	},
+	Action: lint,
+}
+
+func lint(clicontext *cli.Context) error {
+	file := "build.envd"
+	if clicontext.Args().Len() > 0 {
+		file = clicontext.Args().First()
+	}
+	manifest, err := filepath.Abs(file)
+	if err != nil {
+		return errors.Wrap(err, "failed to get absolute path of the build file")
+	}
+	if _, err := os.Stat(manifest); err != nil {
+		return errors.Wrapf(err, "failed to find the build file %s", file)
+	}
+
+	ir.Target(clicontext.String("target"))
+	diagnostics := starlark.Lint(manifest, clicontext.String("func"))
+	wd, _ := os.Getwd()
+	errs := 0
+	for _, d := range diagnostics {
+		// The paths relative to the working dir are clickable in the
+		// terminals and the editors.
+		if rel, err := filepath.Rel(wd, d.Filename); err == nil {
+			d.Filename = rel
+		}
+		fmt.Println(d)
+		if d.Severity == starlark.SeverityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return errors.Newf("found %d errors in %s", errs, file)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/docker"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
+)
+
+var CommandLock = &cli.Command{
+	Name:     "lock",
+	Category: CategoryBasic,
+	Usage:    "Resolve the package versions and write them to envd.lock",
+	Description: `The apt, PyPI and conda packages are resolved in the image built from the build file,
+and the vscode extensions are resolved in the marketplace, the versions are written to
+envd.lock in the build context. The subsequent builds
+use the versions in envd.lock, thus the teammates get the identical environments.
+PyPI pins all the packages in the python environment, including the dependencies.
+The sha256 digests of the PyPI packages are resolved from PyPI too if the build file
+has config.pip_lock(require_hashes=True).
+To update the lockfile after changing the build file:
+	$ envd lock`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "tag",
+			Usage:       "Name and optionally a tag in the 'name:tag' format",
+			Aliases:     []string{"t"},
+			DefaultText: "PROJECT:dev",
+		},
+		&cli.PathFlag{
+			Name:    "path",
+			Usage:   "Path to the directory containing the build.envd",
+			Aliases: []string{"p"},
+			Value:   ".",
+		},
+		&cli.PathFlag{
+			Name:    "from",
+			Usage:   "Function to execute, format `file:func`",
+			Aliases: []string{"f"},
+			Value:   "build.envd:build",
+		},
+		&cli.BoolFlag{
+			Name:    "use-proxy",
+			Usage:   "Use HTTPS_PROXY/HTTP_PROXY/NO_PROXY in the build process",
+			Aliases: []string{"proxy"},
+			Value:   false,
+		},
+		&cli.PathFlag{
+			Name:    "public-key",
+			Usage:   "Path to the public key",
+			Aliases: []string{"pubk"},
+			Value:   sshconfig.GetPublicKeyOrPanic(),
+			Hidden:  true,
+		},
+	},
+	Action: lock,
+}
+
+func lock(clicontext *cli.Context) error {
+	opt, err := ParseBuildOpt(clicontext)
+	if err != nil {
+		return err
+	}
+	// The versions are resolved again instead of pinned by the lockfile.
+	opt.NoLock = true
+
+	builder, err := GetBuilder(clicontext, opt)
+	if err != nil {
+		return err
+	}
+	if err = InterpretEnvdDef(builder); err != nil {
+		return err
+	}
+	if err = BuildImage(clicontext, builder); err != nil {
+		return err
+	}
+
+	dockerClient, err := docker.NewClient(clicontext.Context)
+	if err != nil {
+		return err
+	}
+	l := ir.Lock{Version: ir.LockVersion}
+	for _, query := range ir.LockQueries() {
+		log.WithField("command", query.Command).Debugf("resolving the %s packages", query.Kind)
+		out, err := dockerClient.Run(clicontext.Context, opt.Tag, query.Command)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve the %s packages", query.Kind)
+		}
+		if err := l.Add(query.Kind, out); err != nil {
+			return err
+		}
+	}
+
+	if c := ir.DefaultGraph.PipLockConfig; c != nil && c.RequireHashes {
+		if l.PyPIHashes, err = resolvePyPIHashes(clicontext.Context, l.PyPI); err != nil {
+			return err
+		}
+	}
+
+	if len(ir.DefaultGraph.VSCodePlugins) > 0 {
+		if l.VSCode, l.VSCodeHashes, err = ir.ResolveVSCodePlugins(clicontext.Context); err != nil {
+			return err
+		}
+	}
+
+	lockfile := filepath.Join(opt.BuildContextDir, ir.LockFileName)
+	if err := l.Write(lockfile); err != nil {
+		return err
+	}
+	log.Infof("%d apt, %d PyPI, %d conda packages and %d vscode extensions are locked in %s",
+		len(l.APT), len(l.PyPI), len(l.Conda), len(l.VSCode), lockfile)
+	return nil
+}
+
+// pypiReleaseURL is the JSON API of the release in PyPI, see
+// https://warehouse.pypa.io/api-reference/json.html
+const pypiReleaseURL = "https://pypi.org/pypi/%s/%s/json"
+
+// resolvePyPIHashes resolves the sha256 digests of all the distributions of
+// the locked PyPI packages, thus the wheels of any platform are verified.
+func resolvePyPIHashes(ctx context.Context, versions map[string]string) (map[string][]string, error) {
+	hashes := map[string][]string{}
+	for name, version := range versions {
+		digests, err := pypiDigests(ctx, name, version)
+		if err != nil {
+			return nil, err
+		}
+		if len(digests) == 0 {
+			log.Warnf("PyPI package %s==%s is not found in PyPI, it is not installed from %s",
+				name, version, ir.LockFileName)
+			continue
+		}
+		hashes[name] = digests
+	}
+	return hashes, nil
+}
+
+func pypiDigests(ctx context.Context, name, version string) ([]string, error) {
+	url := fmt.Sprintf(pypiReleaseURL, name, version)
+	log.WithField("url", url).Debug("resolving the PyPI hashes")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the request")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve the hashes of %s==%s", name, version)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Newf("failed to resolve the hashes of %s==%s: %s", name, version, resp.Status)
+	}
+	release := struct {
+		URLs []struct {
+			Digests struct {
+				SHA256 string `json:"sha256"`
+			} `json:"digests"`
+		} `json:"urls"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the release of %s==%s", name, version)
+	}
+	digests := make([]string, 0, len(release.URLs))
+	for _, u := range release.URLs {
+		if u.Digests.SHA256 != "" {
+			digests = append(digests, u.Digests.SHA256)
+		}
+	}
+	sort.Strings(digests)
+	return digests, nil
+}
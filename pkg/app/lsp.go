@@ -0,0 +1,51 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd/pkg/lsp"
+)
+
+var CommandLSP = &cli.Command{
+	Name:     "lsp",
+	Category: CategoryAdvanced,
+	Usage:    "Start the language server of the build file on the stdio",
+	Description: `The language server provides the completion, the signature help and the diagnostics of
+the rules for the editors. The file being edited is checked for the syntax errors and the
+unknown functions, and the saved file is checked as envd lint does. e.g. in neovim:
+	vim.lsp.start({ name = "envd", cmd = { "envd", "lsp" } })`,
+	Flags: []cli.Flag{
+		// The editors, e.g. VS Code, pass --stdio to the language server
+		// by default.
+		&cli.BoolFlag{
+			Name:   "stdio",
+			Usage:  "Communicate over the stdio, which is the only supported transport",
+			Hidden: true,
+		},
+	},
+	Action: languageServer,
+}
+
+func languageServer(clicontext *cli.Context) error {
+	server, err := lsp.NewServer(os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return server.Serve()
+}
@@ -16,11 +16,11 @@ package app
 
 import (
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
 	"github.com/tensorchord/envd/pkg/envd"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 var CommandPause = &cli.Command{
@@ -60,7 +60,7 @@ func pause(clicontext *cli.Context) error {
 		return errors.Wrap(err, "failed to pause the environment")
 	}
 	if name != "" {
-		logrus.Infof("%s is paused", name)
+		log.Infof("%s is paused", name)
 	}
 	return nil
 }
@@ -15,11 +15,17 @@
 package app
 
 import (
+	"fmt"
+
 	"github.com/cockroachdb/errors"
 	"github.com/urfave/cli/v2"
 
 	"github.com/tensorchord/envd/pkg/buildkitd"
+	"github.com/tensorchord/envd/pkg/formatter"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/prompt"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
 var CommandPrune = &cli.Command{
@@ -48,6 +54,11 @@ var CommandPrune = &cli.Command{
 			Name:  "verbose, v",
 			Usage: "Verbose output",
 		},
+		&cli.BoolFlag{
+			Name:    "yes",
+			Usage:   "Skip the confirmation prompt",
+			Aliases: []string{"y"},
+		},
 	},
 
 	Action: prune,
@@ -55,12 +66,6 @@ var CommandPrune = &cli.Command{
 
 func prune(clicontext *cli.Context) error {
 	cleanAll := clicontext.Bool("all")
-	if cleanAll {
-		if err := home.GetManager().CleanCache(); err != nil {
-			return errors.Wrap(err, "failed to clean internal cache")
-		}
-	}
-
 	keepDuration := clicontext.Duration("keep-duration")
 	keepStorage := clicontext.Float64("keep-storage")
 	filter := clicontext.StringSlice("filter")
@@ -70,11 +75,39 @@ func prune(clicontext *cli.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to get the current context")
 	}
-	bkClient, err := buildkitd.NewClient(clicontext.Context,
-		c.Builder, c.BuilderAddress, "")
+	bkClient, err := buildkitd.NewClient(clicontext.Context, *c, "")
 	if err != nil {
 		return errors.Wrap(err, "failed to create buildkit client")
 	}
+
+	summary := prompt.Summary{}
+	if summary.CacheBytes, err = bkClient.Reclaimable(
+		clicontext.Context, filter, cleanAll); err != nil {
+		return errors.Wrap(err, "failed to get the reclaimable build cache")
+	}
+	if cleanAll {
+		cacheDir := home.GetManager().CacheDir()
+		size, err := fileutil.DirSize(cacheDir)
+		if err != nil {
+			return errors.Wrap(err, "failed to get the size of the internal cache")
+		}
+		summary.Directories = append(summary.Directories,
+			fmt.Sprintf("%s (%s)", cacheDir, formatter.HumanSize(size)))
+	}
+	ok, err := prompt.Confirm(summary, clicontext.Bool("yes"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Info("prune is cancelled")
+		return nil
+	}
+
+	if cleanAll {
+		if err := home.GetManager().CleanCache(); err != nil {
+			return errors.Wrap(err, "failed to clean internal cache")
+		}
+	}
 	if err := bkClient.Prune(clicontext.Context,
 		keepDuration, keepStorage, filter, verbose, cleanAll); err != nil {
 		return errors.Wrap(err, "failed to prune buildkit cache")
@@ -15,24 +15,39 @@
 package app
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
+	"github.com/docker/go-units"
 	"github.com/urfave/cli/v2"
 
 	"github.com/tensorchord/envd/pkg/builder"
+	envdconfig "github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/docker"
 	"github.com/tensorchord/envd/pkg/envd"
 	"github.com/tensorchord/envd/pkg/home"
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/progress/progresswriter"
 	"github.com/tensorchord/envd/pkg/ssh"
 	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
+	"github.com/tensorchord/envd/pkg/types"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+	"github.com/tensorchord/envd/pkg/util/gitutil"
 	"github.com/tensorchord/envd/pkg/util/netutil"
+	"github.com/tensorchord/envd/pkg/util/osutil"
 )
 
 const (
 	localhost = "127.0.0.1"
+
+	readinessInterval = time.Millisecond * 500
 )
 
 var CommandUp = &cli.Command{
@@ -58,18 +73,79 @@ var CommandUp = &cli.Command{
 			Usage:   "Mount host directory into container",
 			Aliases: []string{"v"},
 		},
+		&cli.GenericFlag{
+			Name:  "arg",
+			Usage: "Build argument in the KEY=VALUE format read by args.get in the build file, e.g. CUDA=11.7, it can be repeated",
+			Value: &repeatedValues{},
+		},
+		&cli.StringFlag{
+			Name:  "env",
+			Usage: "Name of the environment declared by environment(name, build) in the build file, e.g. gpu",
+		},
 		&cli.PathFlag{
 			Name:    "from",
 			Usage:   "Function to execute, format `file:func`",
 			Aliases: []string{"f"},
 			Value:   "build.envd:build",
 		},
+		&cli.StringSliceFlag{
+			Name:  "env-passthrough",
+			Usage: "Copy the host env matching the patterns into the container, e.g. WANDB_*,HF_TOKEN",
+		},
+		&cli.StringSliceFlag{
+			Name:  "env-tag",
+			Usage: "Tag the environment in the format of key=value, e.g. team=nlp, which is used by envd ls --filter and envd destroy --filter",
+		},
+		&cli.BoolFlag{
+			Name:    "host-git-config",
+			Usage:   "Propagate the git config on the host into the environment, filtered by --git-config-section",
+			EnvVars: []string{"ENVD_HOST_GIT_CONFIG"},
+		},
+		&cli.StringSliceFlag{
+			Name:  "git-config-section",
+			Usage: "Section of the host git config to propagate, e.g. user, alias, url",
+			Value: cli.NewStringSlice(gitutil.DefaultSections...),
+		},
+		&cli.StringSliceFlag{
+			Name:  "git-credential",
+			Usage: "Host whose https credential from the git credential helper on the host is usable in the environment, e.g. github.com",
+		},
+		&cli.BoolFlag{
+			Name:    "forward-ssh-agent",
+			Usage:   "Forward the ssh agent of the host into the environment, e.g. for git against the private repos",
+			EnvVars: []string{"ENVD_FORWARD_SSH_AGENT"},
+		},
+		&cli.StringFlag{
+			Name:    "log-forward",
+			Usage:   "Forward the logs of envd-sshd, jupyter and the daemons to journald on the docker host or the syslog address, e.g. udp://logs.example.com:514",
+			EnvVars: []string{"ENVD_LOG_FORWARD"},
+		},
+		&cli.PathFlag{
+			Name:    "vsix-dir",
+			Usage:   "Install the VS Code extensions from the .vsix files in the directory before the marketplace, e.g. for the air-gapped builds",
+			EnvVars: []string{"ENVD_VSIX_DIR"},
+		},
 		&cli.BoolFlag{
 			Name:    "use-proxy",
 			Usage:   "Use HTTPS_PROXY/HTTP_PROXY/NO_PROXY in the build process",
 			Aliases: []string{"proxy"},
 			Value:   false,
 		},
+		&cli.BoolFlag{
+			Name:  "apt-cacher",
+			Usage: "Cache the apt packages in the local apt-cacher-ng container shared by all the builds",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "notify",
+			Usage: "Show the desktop notification when the build is finished",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:    "notify-webhook",
+			Usage:   "Post the build result to the webhook URL (e.g. Slack incoming webhook) when the build is finished",
+			EnvVars: []string{"ENVD_NOTIFY_WEBHOOK"},
+		},
 		&cli.PathFlag{
 			Name:    "private-key",
 			Usage:   "Path to the private key",
@@ -89,6 +165,16 @@ var CommandUp = &cli.Command{
 			Usage: "Timeout of container creation",
 			Value: time.Second * 30,
 		},
+		&cli.DurationFlag{
+			Name:  "wait-timeout",
+			Usage: "Timeout of waiting for the SSH and Jupyter/RStudio/code-server servers to be ready, 0 to skip the wait",
+			Value: time.Minute,
+		},
+		&cli.BoolFlag{
+			Name:  "open",
+			Usage: "Open the Jupyter/RStudio/code-server servers in the browser when it is ready",
+			Value: false,
+		},
 		&cli.BoolFlag{
 			Name:  "detach",
 			Usage: "Detach from the container",
@@ -104,16 +190,35 @@ var CommandUp = &cli.Command{
 			Usage: "Force rebuild and run the container although the previous container is running",
 			Value: false,
 		},
-		// https://github.com/urfave/cli/issues/1134#issuecomment-1191407527
+		&cli.BoolFlag{
+			Name:  "auto-place",
+			Usage: "Run the environment on the runner of the context with enough free GPUs and memory",
+			Value: false,
+		},
 		&cli.StringFlag{
-			Name:    "export-cache",
-			Usage:   "Export the cache (e.g. type=registry,ref=<image>)",
-			Aliases: []string{"ec"},
+			Name:  "min-memory",
+			Usage: "Free memory required on the runner chosen by --auto-place, e.g. 16g",
+			Value: "0",
+		},
+		&cli.IntFlag{
+			Name:  "events-fd",
+			Usage: "File descriptor inherited from the parent process to write the build events as JSON lines, e.g. for the IDE plugins",
 		},
+		&cli.PathFlag{
+			Name:  "events-socket",
+			Usage: "Unix socket to write the build events as JSON lines, e.g. for the IDE plugins",
+		},
+		// https://github.com/urfave/cli/issues/1134#issuecomment-1191407527
 		&cli.StringFlag{
-			Name:    "import-cache",
-			Usage:   "Import the cache (e.g. type=registry,ref=<image>)",
-			Aliases: []string{"ic"},
+			Name:    "cache-to",
+			Usage:   "Export the build cache (e.g. type=registry,ref=<image>,mode=max to export the cache of all the stages)",
+			Aliases: []string{"export-cache", "ec"},
+		},
+		&cli.GenericFlag{
+			Name:    "cache-from",
+			Usage:   "Import the build cache (e.g. type=registry,ref=<image>), it can be repeated",
+			Aliases: []string{"import-cache", "ic"},
+			Value:   &repeatedValues{},
 		},
 	},
 
@@ -125,10 +230,21 @@ func up(clicontext *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	defer buildOpt.Events.Close()
+	c, err := home.GetManager().ContextGetCurrent()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the current context")
+	}
+	autoPlace := clicontext.Bool("auto-place")
+	if !autoPlace {
+		if err := setRemoteRunnerOutput(&buildOpt, c); err != nil {
+			return err
+		}
+	}
 
-	ctr := filepath.Base(buildOpt.BuildContextDir)
+	ctr := builder.EnvironmentName(buildOpt.BuildContextDir, buildOpt.Env)
 	detach := clicontext.Bool("detach")
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
 		"builder-options": buildOpt,
 		"container-name":  ctr,
 		"detach":          detach,
@@ -142,12 +258,6 @@ func up(clicontext *cli.Context) error {
 	if err = InterpretEnvdDef(builder); err != nil {
 		return err
 	}
-	if err = DetectEnvironment(clicontext, buildOpt); err != nil {
-		return err
-	}
-	if err = BuildImage(clicontext, builder); err != nil {
-		return err
-	}
 
 	// Do not attach GPU if the flag is set.
 	gpuEnable := clicontext.Bool("no-gpu")
@@ -159,11 +269,48 @@ func up(clicontext *cli.Context) error {
 	}
 	numGPUs := builder.NumGPUs()
 
-	sshPortInHost, error := StartEnvd(clicontext, buildOpt, gpu, numGPUs)
+	if autoPlace {
+		if c, err = placeEnvironment(clicontext, gpu, numGPUs); err != nil {
+			return err
+		}
+		if c.RemoteRunner() {
+			if err := setRemoteRunnerOutput(&buildOpt, c); err != nil {
+				return err
+			}
+			// The graph is interpreted already, only the output is changed.
+			if builder, err = GetBuilder(clicontext, buildOpt); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = DetectEnvironment(clicontext, buildOpt, c); err != nil {
+		return err
+	}
+	if err = BuildImage(clicontext, builder); err != nil {
+		return err
+	}
+
+	sshPortInHost, error := StartEnvd(clicontext, buildOpt, c, gpu, numGPUs)
 	if error != nil {
 		return error
 	}
 
+	buildOpt.Events.Emit(progresswriter.Event{
+		Type: progresswriter.EventEnvStarted,
+		Data: map[string]string{"name": ctr},
+	})
+	if err := waitUntilReady(clicontext, c, ctr, buildOpt.BuildContextDir, sshPortInHost); err != nil {
+		return err
+	}
+	buildOpt.Events.Emit(progresswriter.Event{
+		Type: progresswriter.EventEnvReady,
+		Data: map[string]string{
+			"name":     ctr,
+			"ssh_port": strconv.Itoa(sshPortInHost),
+		},
+	})
+
 	if !detach {
 		opt := ssh.DefaultOptions()
 		opt.PrivateKeyPath = clicontext.Path("private-key")
@@ -180,11 +327,51 @@ func up(clicontext *cli.Context) error {
 	return nil
 }
 
-func StartEnvd(clicontext *cli.Context, buildOpt builder.Options, gpu bool, numGPUs int) (int, error) {
-	context, err := home.GetManager().ContextGetCurrent()
+// placeEnvironment returns the context with enough free GPUs and memory
+// for the environment, in all the contexts.
+func placeEnvironment(clicontext *cli.Context, gpu bool, numGPUs int) (*types.Context, error) {
+	memory, err := units.RAMInBytes(clicontext.String("min-memory"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse --min-memory")
+	}
+	gpus := 0
+	if gpu {
+		gpus = numGPUs
+	}
+	contexts, err := home.GetManager().ContextList()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list context")
+	}
+	c, resources, err := envd.Place(clicontext.Context, contexts.Contexts, gpus, memory)
+	for _, res := range resources {
+		log.Debugf("context %s: %d/%d GPUs and %s/%s memory are free", res.Context,
+			res.FreeGPUs, res.GPUs, units.BytesSize(float64(res.FreeMemory)),
+			units.BytesSize(float64(res.Memory)))
+	}
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to get the current context")
+		return nil, errors.Wrap(err, "failed to place the environment")
+	}
+	log.Infof("the environment is placed on the runner of context %s", c.Name)
+	return c, nil
+}
+
+// setRemoteRunnerOutput pushes the image to the registry of the context if
+// the runner is remote, thus the runner could pull it.
+func setRemoteRunnerOutput(opt *builder.Options, c *types.Context) error {
+	if !c.RemoteRunner() {
+		return nil
 	}
+	if c.Registry == "" {
+		return errors.Newf("the runner of context %s is remote, please set the registry by envd context create --registry", c.Name)
+	}
+	opt.Tag = docker.WithRegistry(c.Registry, opt.Tag)
+	opt.OutputOpts = fmt.Sprintf("type=image,name=%s,push=true", opt.Tag)
+	log.Infof("the image %s will be pushed for the remote runner", opt.Tag)
+	return nil
+}
+
+func StartEnvd(clicontext *cli.Context, buildOpt builder.Options,
+	context *types.Context, gpu bool, numGPUs int) (int, error) {
 	opt := envd.Options{
 		Context: context,
 	}
@@ -208,7 +395,44 @@ func StartEnvd(clicontext *cli.Context, buildOpt builder.Options, gpu bool, numG
 		return 0, errors.Wrap(err, "failed to get a free port")
 	}
 
-	ctr := filepath.Base(buildOpt.BuildContextDir)
+	if err := ir.RuntimeEnvPassthrough(
+		clicontext.StringSlice("env-passthrough")); err != nil {
+		return 0, err
+	}
+	if err := ir.RuntimeTags(clicontext.StringSlice("env-tag")); err != nil {
+		return 0, err
+	}
+	if err := ir.RuntimeLogForward(clicontext.String("log-forward")); err != nil {
+		return 0, err
+	}
+	if clicontext.Bool("forward-ssh-agent") {
+		sock, err := sshconfig.AgentSocket()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to forward the ssh agent")
+		}
+		ir.RuntimeSSHAgent(sock)
+	}
+
+	ctr := builder.EnvironmentName(buildOpt.BuildContextDir, buildOpt.Env)
+	var sections []string
+	if clicontext.Bool("host-git-config") {
+		sections = clicontext.StringSlice("git-config-section")
+	}
+	hosts := clicontext.StringSlice("git-credential")
+	if len(hosts) > 0 {
+		path, err := gitCredentials(ctr, hosts)
+		if err != nil {
+			return 0, err
+		}
+		ir.RuntimeGitCredentials(path)
+	}
+	if len(sections) > 0 || len(hosts) > 0 {
+		path, err := gitConfig(ctr, sections, len(hosts) > 0)
+		if err != nil {
+			return 0, err
+		}
+		ir.RuntimeGitConfig(path)
+	}
 	force := clicontext.Bool("force")
 	err = engine.CleanEnvdIfExists(clicontext.Context, ctr, force)
 	if err != nil {
@@ -220,14 +444,153 @@ func StartEnvd(clicontext *cli.Context, buildOpt builder.Options, gpu bool, numG
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to start the envd environment")
 	}
-	logrus.Debugf("container %s is running", containerID)
+	log.Debugf("container %s is running", containerID)
 
-	logrus.Debugf("Add entry %s to SSH config. at %s", buildOpt.BuildContextDir, containerIP)
+	log.Debugf("Add entry %s to SSH config. at %s", buildOpt.BuildContextDir, containerIP)
 	if err = sshconfig.AddEntry(
 		ctr, localhost, sshPortInHost, clicontext.Path("private-key")); err != nil {
-		logrus.Infof("failed to add entry %s to your SSH config file: %s", ctr, err)
+		log.Infof("failed to add entry %s to your SSH config file: %s", ctr, err)
 		return 0, errors.Wrap(err, "failed to add entry to your SSH config file")
 	}
 	return sshPortInHost, nil
+}
+
+// waitUntilReady waits for the SSH server and the Jupyter/RStudio/code-server
+// servers in the environment, then prints how to connect to it. The ports
+// are published on the localhost of the runner, thus they are not probed if
+// the runner is remote.
+func waitUntilReady(clicontext *cli.Context, c *types.Context, name, buildContext string,
+	sshPortInHost int) error {
+	timeout := clicontext.Duration("wait-timeout")
+	if timeout == 0 {
+		return nil
+	}
+	if c.RemoteRunner() {
+		log.Warnf("skip waiting for the environment %s on the remote runner", name)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(clicontext.Context, timeout)
+	defer cancel()
+
+	// The custom entrypoint replaces envd-sshd, thus there is no ssh server.
+	if !ir.DefaultGraph.ReplaceEntrypoint {
+		// The same address as the entry in the ssh config.
+		addr := fmt.Sprintf("%s:%d", localhost, sshPortInHost)
+		log.WithField("addr", addr).Debug("waiting for the ssh server to be ready")
+		if err := netutil.WaitForTCP(ctx, addr, "SSH-", readinessInterval); err != nil {
+			return errors.Wrap(err, "failed to wait for the ssh server")
+		}
+	}
+
+	engine, err := envd.New(ctx, envd.Options{Context: c})
+	if err != nil {
+		return errors.Wrap(err, "failed to create the docker client")
+	}
+	envs, err := engine.ListEnvironment(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the environments")
+	}
+
+	addrs := []string{}
+	for _, env := range envs {
+		if env.Name != name {
+			continue
+		}
+		if env.JupyterAddr != nil {
+			addrs = append(addrs, *env.JupyterAddr)
+		}
+		if env.RStudioServerAddr != nil {
+			addrs = append(addrs, *env.RStudioServerAddr)
+		}
+		if env.CodeServerAddr != nil {
+			addrs = append(addrs, *env.CodeServerAddr)
+		}
+	}
+	for _, addr := range addrs {
+		log.Debugf("waiting for %s to be ready", addr)
+		if err := netutil.WaitForHTTP(ctx, addr, readinessInterval); err != nil {
+			return errors.Wrapf(err, "failed to wait for %s", addr)
+		}
+	}
+
+	fmt.Printf("envd environment %s is ready\n", name)
+	fmt.Printf("  ssh: ssh %s.envd\n", name)
+	// The working dir is named after the build context, not the
+	// environment, see containerConfig.
+	fmt.Printf("  vscode: vscode://vscode-remote/ssh-remote+%s.envd%s\n",
+		name, fileutil.EnvdHomeDir(filepath.Base(buildContext)))
+	for _, addr := range addrs {
+		fmt.Printf("  web: %s\n", addr)
+		if clicontext.Bool("open") {
+			if err := osutil.OpenBrowser(addr); err != nil {
+				log.Warn(err)
+			}
+		}
+	}
+	return nil
+}
+
+// gitConfig writes the git config of the environment to the cache dir, i.e.
+// the sections of the host git config and the helper of the credentials
+// bridged from the host. It is mounted into the environment.
+func gitConfig(name string, sections []string, credentials bool) (string, error) {
+	var content []byte
+	if len(sections) > 0 {
+		host, err := gitutil.HostConfig()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to propagate the host git config")
+		}
+		content = gitutil.FilterConfig(host, sections)
+	}
+	if credentials {
+		content = append(content,
+			gitutil.CredentialHelperConfig(envdconfig.ContainerGitCredentialsPath)...)
+	}
+	path, err := fileutil.CacheFile(fmt.Sprintf("gitconfig_%s", name))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return "", errors.Wrap(err, "failed to write the git config")
+	}
+	return path, nil
+}
+
+// gitCredentials gets the https credentials of the hosts from the git
+// credential helper on the host, and writes them to the cache dir. The file
+// is mounted into the environment instead of being stored in the image.
+func gitCredentials(name string, hosts []string) (string, error) {
+	var sb strings.Builder
+	for _, host := range hosts {
+		c, err := gitutil.FillCredential(host)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(c.StoreLine() + "\n")
+	}
+	path, err := gitCredentialsPath(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0600); err != nil {
+		return "", errors.Wrap(err, "failed to write the git credentials")
+	}
+	return path, nil
+}
 
+func gitCredentialsPath(name string) (string, error) {
+	return fileutil.CacheFile(fmt.Sprintf("git_credentials_%s", name))
+}
+
+// removeGitCredentials removes the plaintext credentials of the environment
+// written by gitCredentials.
+func removeGitCredentials(name string) error {
+	path, err := gitCredentialsPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove the git credentials")
+	}
+	return nil
 }
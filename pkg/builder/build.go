@@ -44,8 +44,8 @@ func (b generalBuilder) BuildFunc() func(ctx context.Context, c client.Client) (
 		}
 
 		// Get the user-defined cache importer.
-		if b.Options.ImportCache != "" {
-			ci, err := ParseImportCache([]string{b.Options.ImportCache})
+		if len(b.Options.ImportCache) > 0 {
+			ci, err := ParseImportCache(b.Options.ImportCache)
 			if err != nil {
 				return nil, errors.Wrap(err, "failed to get the import cache")
 			}
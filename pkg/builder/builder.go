@@ -20,23 +20,32 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/auth/authprovider"
-	"github.com/sirupsen/logrus"
+	"github.com/moby/buildkit/solver/errdefs"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/tensorchord/envd/pkg/buildkitd"
 	"github.com/tensorchord/envd/pkg/docker"
+	"github.com/tensorchord/envd/pkg/envd"
 	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/formatter"
 	"github.com/tensorchord/envd/pkg/home"
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark"
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/nerdctl"
+	"github.com/tensorchord/envd/pkg/notify"
 	"github.com/tensorchord/envd/pkg/progress/progresswriter"
 	"github.com/tensorchord/envd/pkg/types"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
 type Builder interface {
@@ -51,6 +60,9 @@ type Options struct {
 	ManifestFilePath string
 	// ConfigFilePath is the path to the config file `config.envd`.
 	ConfigFilePath string
+	// OrgConfigFilePath is the path to the organization defaults, which is
+	// evaluated before the config file. It is optional.
+	OrgConfigFilePath string
 	// ProgressMode is the output mode (auto, plain).
 	ProgressMode string
 	// Tag is the name of the image.
@@ -59,6 +71,25 @@ type Options struct {
 	BuildContextDir string
 	// BuildFuncName is the name of the build func.
 	BuildFuncName string
+	// Env is the name of the environment declared by environment(name,
+	// build) in the build file, whose build func is executed instead.
+	Env string
+	// BuildArgs are the arguments read by args.get in the build file, see
+	// envd build --arg.
+	BuildArgs map[string]string
+	// Target is the build target evaluated by target() in the build file,
+	// e.g. dev, prod.
+	Target string
+	// Minimal omits oh-my-zsh, the VS Code extensions and envd-sshd.
+	Minimal bool
+	// Sandbox runs the run rules without the network, the build context
+	// and the proxy env unless they are granted.
+	Sandbox bool
+	// NoLock ignores the lockfile envd.lock in the build context.
+	NoLock bool
+	// VSIXDir is the directory of the .vsix files, which are installed
+	// before the VS Code extensions in the marketplace.
+	VSIXDir string
 	// PubKeyPath is the path to the ssh public key.
 	PubKeyPath string
 	// OutputOpts is the output options.
@@ -66,11 +97,26 @@ type Options struct {
 	// ExportCache is the option to export cache.
 	// e.g. type=registry,ref=docker.io/username/image
 	ExportCache string
-	// ImportCache is the option to import cache.
+	// ImportCache are the options to import cache, which are imported along
+	// with the default cache.
 	// e.g. type=registry,ref=docker.io/username/image
-	ImportCache string
+	ImportCache []string
 	// UseHTTPProxy uses HTTPS_PROXY/HTTP_PROXY/NO_PROXY in the build process.
 	UseHTTPProxy bool
+	// Reproducible pins the timestamps to SOURCE_DATE_EPOCH, thus the builds
+	// of the same manifest produce the same image.
+	Reproducible bool
+	// UseAPTCacher routes apt through the apt-cacher-ng container on the host,
+	// which is started on demand.
+	UseAPTCacher bool
+	// NotifyDesktop shows the desktop notification when the build is finished.
+	NotifyDesktop bool
+	// NotifyWebhook is the URL to post to when the build is finished.
+	// e.g. the Slack incoming webhook
+	NotifyWebhook string
+	// Events is the stream of the machine-readable build events, e.g.
+	// for the IDE plugins. It is nil if not requested.
+	Events *progresswriter.EventStream
 }
 
 type BuildkitdErr struct {
@@ -82,14 +128,26 @@ func (e *BuildkitdErr) Error() string {
 }
 func (e *BuildkitdErr) Format(s fmt.State, verb rune) { errors.FormatError(e, s, verb) }
 
+// Sources returns where the failed build step is defined in the build file.
+func (e *BuildkitdErr) Sources() []*errdefs.Source {
+	return errdefs.Sources(e.err)
+}
+
 type generalBuilder struct {
 	Options
 	manifestCodeHash string
 	entries          []client.ExportEntry
+	// remoteRunner is true if the image is not used in the local docker host.
+	remoteRunner bool
+	// nerdctl is set if the runner is nerdctl, thus the image is loaded into
+	// containerd instead of the docker host.
+	nerdctl nerdctl.Client
+	// rootless is true if the image is built by the rootless buildkitd.
+	rootless bool
 
 	definition *llb.Definition
 
-	logger *logrus.Entry
+	logger *log.Entry
 	starlark.Interpreter
 	buildkitd.Client
 }
@@ -100,7 +158,7 @@ func New(ctx context.Context, opt Options) (Builder, error) {
 		return nil, errors.Wrap(err, "failed to parse output")
 	}
 
-	logrus.WithField("entry", entries).Debug("getting exporter entry")
+	log.WithField("entry", entries).Debug("getting exporter entry")
 	// Build docker image by default
 	if len(entries) == 0 {
 		entries = []client.ExportEntry{
@@ -111,17 +169,31 @@ func New(ctx context.Context, opt Options) (Builder, error) {
 	} else if len(entries) > 1 {
 		return nil, errors.New("only one output type is supported")
 	}
+	setDefaultImageName(entries, opt.Tag)
 
-	manifestHash, err := starlark.GetEnvdProgramHash(opt.ManifestFilePath)
+	manifestHash, err := manifestHash(opt.ManifestFilePath)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to compile manifest file")
 	}
+	// The targets of the same manifest produce the different images.
+	if opt.Target != "" && opt.Target != ir.TargetDev {
+		manifestHash = fmt.Sprintf("%s-%s", manifestHash, opt.Target)
+	}
+	if opt.Minimal {
+		manifestHash = fmt.Sprintf("%s-minimal", manifestHash)
+	}
+	if !opt.NoLock {
+		if manifestHash, err = withLockHash(manifestHash, opt.BuildContextDir); err != nil {
+			return nil, err
+		}
+	}
+	manifestHash = withArgsHash(manifestHash, opt.BuildArgs)
 
 	b := &generalBuilder{
 		Options:          opt,
 		manifestCodeHash: manifestHash,
 		entries:          entries,
-		logger: logrus.WithFields(logrus.Fields{
+		logger: log.WithFields(log.Fields{
 			"tag": opt.Tag,
 		}),
 	}
@@ -130,16 +202,109 @@ func New(ctx context.Context, opt Options) (Builder, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get the current context")
 	}
-	cli, err := buildkitd.NewClient(ctx, c.Builder, c.BuilderAddress, "")
+	cli, err := buildkitd.NewClient(ctx, *c, "")
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create buildkit client")
 	}
 	b.Client = cli
+	b.remoteRunner = c.RemoteRunner()
+	if c.Runner == types.RunnerTypeNerdctl {
+		address := ""
+		if c.RunnerAddress != nil {
+			address = *c.RunnerAddress
+		}
+		if b.nerdctl, err = nerdctl.NewClient(address); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Builder == types.BuilderTypeDocker {
+		if b.rootless, err = detectRootless(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if opt.UseAPTCacher {
+		if err := startAPTCacher(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	// The PyPI cache is enabled by envd bootstrap --with-pypi-cache.
+	if c.PyPICache && c.Builder == types.BuilderTypeDocker {
+		index, err := StartPyPICacher(ctx)
+		if err != nil {
+			return nil, err
+		}
+		log.WithField("index", index).Debug("PyPI cacher is running")
+		if err := ir.PyPIProxy(index); err != nil {
+			return nil, err
+		}
+	}
 
 	b.Interpreter = starlark.NewInterpreter(opt.BuildContextDir)
 	return b, nil
 }
 
+// detectRootless returns true if the docker daemon is rootless, thus the
+// image is built by the rootless buildkitd, see docker.Client.StartBuildkitd.
+func detectRootless(ctx context.Context) (bool, error) {
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to new docker client")
+	}
+	rootless, err := dockerClient.Rootless(ctx)
+	if err != nil {
+		return false, err
+	}
+	if rootless {
+		log.Debug("building with the rootless buildkitd")
+	}
+	return rootless, nil
+}
+
+// startAPTCacher starts the apt-cacher-ng container and uses it as the apt
+// proxy. The apt_proxy in the config file takes precedence over it.
+func startAPTCacher(ctx context.Context, c *types.Context) error {
+	if c.Builder != types.BuilderTypeDocker {
+		log.Warnf("apt cacher is only supported by the %s builder, skip it",
+			types.BuilderTypeDocker)
+		return nil
+	}
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to new docker client")
+	}
+	addr, err := dockerClient.StartCacher(ctx, docker.CacherOptions{
+		Image:    types.APTCacherImage,
+		Name:     types.APTCacherContainerName,
+		CacheDir: types.APTCacherCacheDir,
+		Port:     types.APTCacherPort,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to start the apt cacher")
+	}
+	log.WithField("addr", addr).Debug("apt cacher is running")
+	return ir.APTProxy(addr)
+}
+
+// StartPyPICacher starts the PyPI cache container, and returns the index URL.
+func StartPyPICacher(ctx context.Context) (string, error) {
+	dockerClient, err := docker.NewClient(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to new docker client")
+	}
+	addr, err := dockerClient.StartCacher(ctx, docker.CacherOptions{
+		Image:    types.PyPICacherImage,
+		Name:     types.PyPICacherContainerName,
+		CacheDir: types.PyPICacherCacheDir,
+		Port:     types.PyPICacherPort,
+		Env:      []string{"PROXPI_CACHE_DIR=" + types.PyPICacherCacheDir},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to start the PyPI cacher")
+	}
+	return addr + "/index/", nil
+}
+
 // GPUEnabled returns true if cuda is enabled.
 func (b generalBuilder) GPUEnabled() bool {
 	return ir.GPUEnabled()
@@ -151,7 +316,13 @@ func (b generalBuilder) NumGPUs() int {
 }
 
 func (b generalBuilder) Build(ctx context.Context, force bool) error {
-	if !force && !b.checkIfNeedBuild(ctx) {
+	// The up-to-date check only works for the image in the docker host.
+	if !force && b.loadsIntoDocker() && !b.checkIfNeedBuild(ctx) {
+		b.Events.Emit(progresswriter.Event{
+			Type:   progresswriter.EventBuildFinished,
+			Cached: true,
+			Data:   map[string]string{"tag": b.Tag},
+		})
 		return nil
 	}
 
@@ -165,31 +336,193 @@ func (b generalBuilder) Build(ctx context.Context, force bool) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to create progress writer")
 	}
+	if max := ir.MaxLogSize(); max > 0 {
+		pw = progresswriter.LimitLogs(pw, max)
+	}
+	pw = progresswriter.TeeEvents(pw, b.Events)
+	b.Events.Emit(progresswriter.Event{
+		Type: progresswriter.EventBuildStarted,
+		Data: map[string]string{"tag": b.Tag},
+	})
 
-	if err = b.build(ctx, pw); err != nil {
+	exportDirExisted := b.exportDirExists()
+	localSources := b.localSources(ctx)
+	start := time.Now()
+	digest, err := b.build(ctx, pw)
+	if ir.StageTimeoutExceeded(err) {
+		err = errors.Wrapf(err, "the stage exceeded the timeout %s of config.stage_limits",
+			ir.StageTimeout())
+	}
+	b.notify(notify.Event{
+		Tag:      b.Tag,
+		Digest:   digest,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+	finished := progresswriter.Event{
+		Type: progresswriter.EventBuildFinished,
+		Data: map[string]string{"tag": b.Tag, "digest": digest},
+	}
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	b.Events.Emit(finished)
+	if err != nil {
+		cancelled := errors.Is(err, context.Canceled) || ctx.Err() != nil
+		b.cleanupFailedBuild(localSources, exportDirExisted, cancelled)
 		return errors.Wrap(err, "failed to build")
 	}
+	b.logger.Infof("image %s is built in %s", b.Tag,
+		formatter.HumanDuration(time.Since(start)))
+	return b.pullPushedImages(ctx)
+}
+
+// pullPushedImages pulls the images pushed by buildkitd into the docker host,
+// thus envd up does not need to pull them when it starts the environment.
+func (b generalBuilder) pullPushedImages(ctx context.Context) error {
+	if b.remoteRunner {
+		return nil
+	}
+	for _, entry := range b.entries {
+		if entry.Type != client.ExporterImage || entry.Attrs["push"] != "true" {
+			continue
+		}
+		// The name may be a comma-separated list, e.g. name=a:v1,b:v1
+		name := strings.Split(entry.Attrs["name"], ",")[0]
+		if b.nerdctl != nil {
+			b.logger.Infof("pulling the pushed image %s into containerd", name)
+			if _, err := b.nerdctl.Output(ctx, "pull", name); err != nil {
+				return errors.Wrapf(err, "failed to pull the pushed image %s", name)
+			}
+			continue
+		}
+		dockerClient, err := docker.NewClient(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to new docker client")
+		}
+		b.logger.Infof("pulling the pushed image %s into the docker host", name)
+		if err := dockerClient.PullImage(ctx, name); err != nil {
+			return errors.Wrapf(err, "failed to pull the pushed image %s", name)
+		}
+	}
 	return nil
 }
 
+// notify sends the build result to the configured notifiers. The failure
+// of the notification does not fail the build. It does not use the build
+// context, thus the cancelled build, e.g. by Ctrl-C, is notified too.
+func (b generalBuilder) notify(e notify.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	notifiers := []notify.Notifier{}
+	if b.NotifyDesktop {
+		notifiers = append(notifiers, notify.NewDesktop())
+	}
+	if b.NotifyWebhook != "" {
+		notifiers = append(notifiers, notify.NewWebhook(b.NotifyWebhook))
+	}
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, e); err != nil {
+			b.logger.Warnf("failed to send the notification: %s", err)
+		}
+	}
+}
+
 func (b generalBuilder) Interpret() error {
-	// Evaluate config first.
-	if b.ConfigFilePath != "" {
-		b.logger.Debug("evaluating config file")
-		if _, err := b.ExecFile(b.ConfigFilePath, ""); err != nil {
-			return errors.Wrapf(err, "failed to exec starlark file %s", b.ConfigFilePath)
+	ir.Target(b.Target)
+	if err := ir.BuildArgs(b.BuildArgs); err != nil {
+		return err
+	}
+	// The proxy in the build.envd takes precedence over the host env.
+	if b.UseHTTPProxy {
+		ir.Proxy(getEnv("HTTP_PROXY"), getEnv("HTTPS_PROXY"), getEnv("NO_PROXY"))
+	}
+
+	if ir.IsGraphFile(b.ManifestFilePath) {
+		// The serialized graph is the whole environment, thus the config
+		// file is not evaluated.
+		b.logger.Debug("loading the graph file")
+		if err := ir.LoadGraph(b.ManifestFilePath); err != nil {
+			return err
+		}
+		ir.Target(b.Target)
+	} else {
+		// Evaluate config first, the later one takes precedence.
+		for _, config := range []string{b.OrgConfigFilePath, b.ConfigFilePath} {
+			if config == "" {
+				continue
+			}
+			b.logger.Debugf("evaluating config file %s", config)
+			if _, err := b.ExecFile(config, ""); err != nil {
+				return errors.Wrapf(err, "failed to exec starlark file %s", config)
+			}
+		}
+
+		var err error
+		if b.Env != "" {
+			_, err = b.ExecEnv(b.ManifestFilePath, b.Env)
+		} else {
+			_, err = b.ExecFile(b.ManifestFilePath, b.BuildFuncName)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to exec starlark file %s", b.ManifestFilePath)
+		}
+		for _, name := range ir.UnusedBuildArgs() {
+			b.logger.Warnf("the build arg %s is not read by args.get in the build file", name)
 		}
 	}
 
-	if _, err := b.ExecFile(b.ManifestFilePath, b.BuildFuncName); err != nil {
-		return errors.Wrapf(err, "failed to exec starlark file %s", b.ManifestFilePath)
+	if !b.NoLock {
+		lockfile := filepath.Join(b.BuildContextDir, ir.LockFileName)
+		exists, err := fileutil.FileExists(lockfile)
+		if err != nil {
+			return err
+		}
+		if exists {
+			l, err := ir.LoadLock(lockfile)
+			if err != nil {
+				return err
+			}
+			b.logger.Debugf("using the lockfile %s", lockfile)
+			ir.UseLock(l)
+		}
+		if err := ir.CheckPipLock(); err != nil {
+			return err
+		}
+	}
+
+	if b.Minimal {
+		b.logger.Debug("minimal build without the dev conveniences")
+		ir.Minimal()
+	}
+	if b.Sandbox {
+		b.logger.Debug("sandbox the run rules")
+		ir.Sandbox()
+	}
+	if b.VSIXDir != "" {
+		b.logger.Debugf("installing the vscode plugins from %s", b.VSIXDir)
+		if err := ir.VSCodeVSIXDir(b.VSIXDir); err != nil {
+			return err
+		}
+	}
+
+	if b.Reproducible {
+		epoch, err := sourceDateEpoch(b.ManifestFilePath)
+		if err != nil {
+			return err
+		}
+		b.logger.Debugf("reproducible build with SOURCE_DATE_EPOCH=%d", epoch)
+		ir.Reproducible(epoch)
 	}
 	return nil
 }
 
 func (b generalBuilder) compile(ctx context.Context) (*llb.Definition, error) {
-	envName := filepath.Base(b.BuildContextDir)
-	def, err := ir.Compile(ctx, envName, b.PubKeyPath)
+	envName := EnvironmentName(b.BuildContextDir, b.Env)
+	def, err := ir.Compile(ctx, envName, b.PubKeyPath, ir.CompileOptions{
+		Rootless: b.rootless,
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to compile build.envd")
 	}
@@ -215,7 +548,7 @@ func (b generalBuilder) imageConfig(ctx context.Context) (string, error) {
 	}
 	labels[types.ImageLabelContext] = b.BuildContextDir
 
-	ep, err := ir.CompileEntrypoint(b.BuildContextDir)
+	ep, err := ir.CompileEntrypoint()
 	if err != nil {
 		return "", errors.Wrap(err, "failed to get entrypoint")
 	}
@@ -223,7 +556,13 @@ func (b generalBuilder) imageConfig(ctx context.Context) (string, error) {
 
 	env := ir.CompileEnviron()
 
-	data, err := ImageConfigStr(labels, ports, ep, env)
+	var created *time.Time
+	if ir.DefaultGraph.SourceDateEpoch != nil {
+		t := time.Unix(*ir.DefaultGraph.SourceDateEpoch, 0).UTC()
+		created = &t
+	}
+
+	data, err := ImageConfigStr(labels, ports, ep, env, created)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to get image config")
 	}
@@ -237,11 +576,12 @@ func (b generalBuilder) defaultCacheImporter() (*string, error) {
 	return nil, nil
 }
 
-func (b generalBuilder) build(ctx context.Context, pw progresswriter.Writer) error {
+// build solves the definition and returns the digest of the image.
+func (b generalBuilder) build(ctx context.Context, pw progresswriter.Writer) (string, error) {
 	b.logger.Debug("building envd image")
 	ce, err := ParseExportCache([]string{b.ExportCache}, nil)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse export cache")
+		return "", errors.Wrap(err, "failed to parse export cache")
 	}
 	// k := platforms.Format(platforms.DefaultSpec())
 	ctx, cancel := context.WithCancel(ctx)
@@ -251,15 +591,19 @@ func (b generalBuilder) build(ctx context.Context, pw progresswriter.Writer) err
 	// Create a pipe to load the image into the docker host.
 	pipeR, pipeW := io.Pipe()
 
-	for _, entry := range b.entries {
+	// The digests are indexed by the entries since they are solved concurrently.
+	digests := make([]string, len(b.entries))
+
+	for i, entry := range b.entries {
+		i, entry := i, entry
 		// Set up docker config auth.
 		attachable := []session.Attachable{authprovider.NewDockerAuthProvider(os.Stderr)}
-		b.logger.WithFields(logrus.Fields{
+		b.logger.WithFields(log.Fields{
 			"type": entry.Type,
 		}).Debug("build image with buildkit")
-		switch entry.Type {
-		// Create default build.
-		case client.ExporterDocker:
+		switch {
+		// Create default build, and load the image into the docker host.
+		case isDockerLoad(entry):
 			eg.Go(func() error {
 				if entry.Attrs == nil {
 					entry = client.ExportEntry{
@@ -280,27 +624,33 @@ func (b generalBuilder) build(ctx context.Context, pw progresswriter.Writer) err
 						flag.FlagCacheDir:     home.GetManager().CacheDir(),
 						flag.FlagBuildContext: b.BuildContextDir,
 					},
-					Session: attachable,
+					Session:   attachable,
+					SharedKey: sharedKey(b.BuildContextDir),
 				}
-				if b.UseHTTPProxy {
-					solveOpt.FrontendAttrs = map[string]string{
-						"build-arg:HTTPS_PROXY": os.Getenv("HTTPS_PROXY"),
-						"build-arg:HTTP_PROXY":  os.Getenv("HTTP_PROXY"),
-						"build-arg:NO_PROXY":    os.Getenv("NO_PROXY"),
-					}
-				}
-				_, err := b.Client.Build(ctx, solveOpt, "envd", b.BuildFunc(), pw.Status())
+				resp, err := b.Client.Build(ctx, solveOpt, "envd", b.BuildFunc(), pw.Status())
 				if err != nil {
 					err = errors.Wrap(&BuildkitdErr{err: err}, "Buildkit error")
-					logrus.Errorf("%+v", err)
+					log.Errorf("%+v", err)
 					return err
 				}
+				if resp != nil {
+					digests[i] = resp.ExporterResponse[exptypes.ExporterImageDigestKey]
+				}
 				b.logger.Debug("llb def is solved successfully")
 				return nil
 			})
 			// Load the image to docker host.
 			eg.Go(func() error {
 				defer pipeR.Close()
+				if b.nerdctl != nil {
+					b.logger.Debug("loading image to containerd")
+					if err := b.nerdctl.Load(ctx, pipeR); err != nil {
+						err = errors.Wrap(err, "failed to load the image by nerdctl")
+						b.logger.Error(err)
+						return err
+					}
+					return nil
+				}
 				dockerClient, err := docker.NewClient(ctx)
 				if err != nil {
 					return errors.Wrap(err, "failed to new docker client")
@@ -323,20 +673,17 @@ func (b generalBuilder) build(ctx context.Context, pw progresswriter.Writer) err
 						flag.FlagCacheDir:     home.GetManager().CacheDir(),
 						flag.FlagBuildContext: b.BuildContextDir,
 					},
-					Session: attachable,
+					Session:   attachable,
+					SharedKey: sharedKey(b.BuildContextDir),
 				}
-				if b.UseHTTPProxy {
-					solveOpt.FrontendAttrs = map[string]string{
-						"build-arg:HTTPS_PROXY": os.Getenv("HTTPS_PROXY"),
-						"build-arg:HTTP_PROXY":  os.Getenv("HTTP_PROXY"),
-						"build-arg:NO_PROXY":    os.Getenv("NO_PROXY"),
-					}
-				}
-				_, err := b.Client.Build(ctx, solveOpt, "envd", b.BuildFunc(), pw.Status())
+				resp, err := b.Client.Build(ctx, solveOpt, "envd", b.BuildFunc(), pw.Status())
 				if err != nil {
 					err = errors.Wrap(err, "failed to solve LLB")
 					return err
 				}
+				if resp != nil {
+					digests[i] = resp.ExporterResponse[exptypes.ExporterImageDigestKey]
+				}
 				b.logger.Debug("llb def is solved successfully")
 				return nil
 			})
@@ -356,12 +703,28 @@ func (b generalBuilder) build(ctx context.Context, pw progresswriter.Writer) err
 			b.logger.Debug("cancelling the error group")
 			// Close the pipe on cancels, otherwise the whole thing hangs.
 			pipeR.Close()
-			return errors.Wrap(err, "build cancelled")
+			return "", errors.Wrap(err, "build cancelled")
 		} else {
-			return errors.Wrap(err, "failed to wait error group")
+			return "", errors.Wrap(err, "failed to wait error group")
 		}
 	}
-	return nil
+	for _, digest := range digests {
+		if digest != "" {
+			return digest, nil
+		}
+	}
+	return "", nil
+}
+
+// loadsIntoDocker returns true if the image is loaded into the docker host
+// instead of being exported to the tarball, the directory or the registry.
+func (b generalBuilder) loadsIntoDocker() bool {
+	for _, entry := range b.entries {
+		if !isDockerLoad(entry) {
+			return false
+		}
+	}
+	return true
 }
 
 func (b generalBuilder) checkIfNeedBuild(ctx context.Context) bool {
@@ -369,6 +732,12 @@ func (b generalBuilder) checkIfNeedBuild(ctx context.Context) bool {
 		b.PubKeyPath,
 		b.ConfigFilePath,
 	}
+	if b.OrgConfigFilePath != "" {
+		depsFiles = append(depsFiles, b.OrgConfigFilePath)
+	}
+	// The files loaded or read by the manifest are not in the manifest hash.
+	depsFiles = append(depsFiles, ir.DefaultGraph.LocalModules...)
+	depsFiles = append(depsFiles, ir.DefaultGraph.ReadFiles...)
 	isUpdated, err := b.checkDepsFileUpdate(ctx, b.Tag, b.ManifestFilePath, depsFiles)
 	if err != nil {
 		b.logger.Debugf("failed to check manifest update: %s", err)
@@ -382,15 +751,23 @@ func (b generalBuilder) checkIfNeedBuild(ctx context.Context) bool {
 
 // nolint:unparam
 func (b generalBuilder) checkDepsFileUpdate(ctx context.Context, tag string, manifest string, deps []string) (bool, error) {
-	dockerClient, err := docker.NewClient(ctx)
+	c, err := home.GetManager().ContextGetCurrent()
+	if err != nil {
+		return true, errors.Wrap(err, "failed to get the current context")
+	}
+	// The image is in the runner, e.g. containerd for nerdctl.
+	engine, err := envd.New(ctx, envd.Options{Context: c})
 	if err != nil {
 		return true, err
 	}
 
-	image, err := dockerClient.GetImageWithCacheHashLabel(ctx, tag, b.manifestCodeHash)
+	image, err := engine.GetImage(ctx, tag)
 	if err != nil {
 		return true, err
 	}
+	if image.Labels[types.ImageLabelCacheHash] != b.manifestCodeHash {
+		return true, errors.Errorf("image with hash %s not found", b.manifestCodeHash)
+	}
 	imageCreatedTime := image.Created
 
 	latestTimestamp := int64(0)
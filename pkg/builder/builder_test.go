@@ -17,6 +17,7 @@ package builder
 import (
 	"context"
 	"os"
+	"path/filepath"
 
 	"github.com/cockroachdb/errors"
 	"github.com/golang/mock/gomock"
@@ -89,11 +90,36 @@ var _ = Describe("Builder", func() {
 					Expect(err).NotTo(HaveOccurred())
 
 					close(pw.Status())
-					err = b.build(context.TODO(), pw)
+					_, err = b.build(context.TODO(), pw)
 					Expect(err).To(HaveOccurred())
 				})
 			})
 
+			When("the build fails", func() {
+				It("should clean up the local contexts and the cache export", func() {
+					dest := filepath.Join(GinkgoT().TempDir(), "cache")
+					b.ExportCache = "type=local,dest=" + dest
+					Expect(b.exportDirExists()).To(BeFalse())
+					// The half-written cache export.
+					Expect(os.MkdirAll(filepath.Join(dest, "blobs"), 0755)).To(Succeed())
+
+					// Only the snapshot created by the build is cleaned.
+					b.Client.(*mockbuildkitd.MockClient).EXPECT().DiskUsage(gomock.Any(),
+						gomock.Eq([]string{"type==source.local"})).
+						Return([]*client.UsageInfo{{ID: "other"}, {ID: "failed"}}, nil)
+					b.Client.(*mockbuildkitd.MockClient).EXPECT().Clean(gomock.Any(),
+						gomock.Eq([]string{"id==failed"})).Return(int64(1024), nil)
+					b.cleanupFailedBuild(map[string]bool{"other": true}, false, false)
+					_, err := os.Stat(dest)
+					Expect(os.IsNotExist(err)).To(BeTrue())
+				})
+
+				It("should keep the local contexts if the build is cancelled", func() {
+					// The mock fails on the unexpected DiskUsage or Clean.
+					b.cleanupFailedBuild(map[string]bool{"other": true}, false, true)
+				})
+			})
+
 			It("should build successfully", func() {
 				err := home.Initialize()
 				Expect(err).ToNot(HaveOccurred())
@@ -112,7 +138,7 @@ var _ = Describe("Builder", func() {
 				Expect(err).NotTo(HaveOccurred())
 
 				close(pw.Status())
-				err = b.build(context.TODO(), pw)
+				_, err = b.build(context.TODO(), pw)
 				Expect(err).ToNot(HaveOccurred())
 			})
 		})
@@ -0,0 +1,135 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/moby/buildkit/client"
+
+	"github.com/tensorchord/envd/pkg/formatter"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+// cleanupTimeout bounds the cleanup, which runs after the build context may
+// be cancelled already, e.g. by Ctrl-C.
+const cleanupTimeout = 30 * time.Second
+
+// localCacheExportDir returns the dest of --export-cache type=local, which
+// is empty for the other cache exporters.
+func (b generalBuilder) localCacheExportDir() string {
+	ce, err := ParseExportCache([]string{b.ExportCache}, nil)
+	if err != nil {
+		return ""
+	}
+	for _, e := range ce {
+		if e.Type == "local" {
+			return e.Attrs["dest"]
+		}
+	}
+	return ""
+}
+
+// localSourceFilter matches the snapshots of the local contexts.
+var localSourceFilter = fmt.Sprintf("type==%s", client.UsageRecordTypeLocalSource)
+
+// localSources returns the IDs of the snapshots of the local contexts on the
+// builder, or nil if they cannot be listed.
+func (b generalBuilder) localSources(ctx context.Context) map[string]bool {
+	records, err := b.Client.DiskUsage(ctx, []string{localSourceFilter})
+	if err != nil {
+		b.logger.Debugf("failed to list the local context snapshots: %s", err)
+		return nil
+	}
+	ids := make(map[string]bool, len(records))
+	for _, r := range records {
+		ids[r.ID] = true
+	}
+	return ids
+}
+
+// cleanupFailedBuild removes what the failed build leaves behind, i.e. the
+// snapshots of the local contexts created by this build and the
+// half-written cache export, and reports what is kept for debugging.
+// The snapshots existing before the build (see localSources) belong to the
+// other builds on the builder and are kept. The snapshots of the cancelled
+// build are kept too, thus the next build reuses the transferred context
+// by the shared key. The cache of the finished steps is kept, thus the next
+// build resumes.
+func (b generalBuilder) cleanupFailedBuild(before map[string]bool,
+	exportDirExisted, cancelled bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	if cancelled {
+		b.logger.Info("kept the transferred build context for the next build")
+	} else if before != nil {
+		b.cleanLocalSources(ctx, before)
+	}
+
+	if dir := b.localCacheExportDir(); dir != "" {
+		if exportDirExisted {
+			b.logger.Infof("kept the cache export in %s, which existed before the build", dir)
+		} else if err := os.RemoveAll(dir); err != nil {
+			b.logger.Warnf("failed to remove the half-written cache export %s: %s", dir, err)
+		} else {
+			b.logger.Infof("removed the half-written cache export %s", dir)
+		}
+	}
+	b.logger.Info("kept the build cache of the finished steps for debugging and the next build, " +
+		"run `envd prune` to remove it")
+}
+
+// exportDirExists returns true if the dest of the local cache exporter
+// exists, which is not removed by cleanupFailedBuild.
+func (b generalBuilder) exportDirExists() bool {
+	dir := b.localCacheExportDir()
+	if dir == "" {
+		return false
+	}
+	// The dir is kept if it cannot be checked.
+	exists, err := fileutil.DirExists(dir)
+	return err != nil || exists
+}
+
+// cleanLocalSources removes the snapshots of the local contexts which do
+// not exist before the build. The sessions of the build are closed when
+// build returns, thus the snapshots are unused here.
+func (b generalBuilder) cleanLocalSources(ctx context.Context, before map[string]bool) {
+	records, err := b.Client.DiskUsage(ctx, []string{localSourceFilter})
+	if err != nil {
+		b.logger.Warnf("failed to list the local context snapshots: %s", err)
+		return
+	}
+	filter := []string{}
+	for _, r := range records {
+		if !before[r.ID] {
+			filter = append(filter, fmt.Sprintf("id==%s", r.ID))
+		}
+	}
+	// The empty filter matches all the records.
+	if len(filter) == 0 {
+		return
+	}
+	size, err := b.Client.Clean(ctx, filter)
+	if err != nil {
+		b.logger.Warnf("failed to clean the local context snapshots: %s", err)
+	} else if size > 0 {
+		b.logger.Infof("cleaned %s of the local context snapshots", formatter.HumanSize(size))
+	}
+}
@@ -15,11 +15,19 @@
 package builder
 
 import (
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/containerd/console"
@@ -27,8 +35,10 @@ import (
 	"github.com/moby/buildkit/client"
 	gatewayclient "github.com/moby/buildkit/frontend/gateway/client"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/types"
 )
 
@@ -37,14 +47,17 @@ const (
 	defaultFunc = "build"
 )
 
+// ImageConfigStr returns the image config. The created time is set by
+// buildkitd if it is nil.
 func ImageConfigStr(labels map[string]string, ports map[string]struct{},
-	entrypoint []string, env []string) (string, error) {
+	entrypoint []string, env []string, created *time.Time) (string, error) {
 	pl := platforms.Normalize(platforms.DefaultSpec())
 	img := v1.Image{
+		Created: created,
 		Config: v1.ImageConfig{
 			Labels:       labels,
 			WorkingDir:   "/",
-			Env:          append(env, "PATH="+DefaultPathEnv(pl.OS)),
+			Env:          withDefaultPath(env, pl.OS),
 			ExposedPorts: ports,
 			Entrypoint:   entrypoint,
 		},
@@ -62,6 +75,39 @@ func ImageConfigStr(labels map[string]string, ports map[string]struct{},
 	return string(data), nil
 }
 
+// sourceDateEpoch returns SOURCE_DATE_EPOCH if it is set, or the time of
+// the last git commit of the manifest. The mtime of the manifest is not
+// used since it differs in every checkout.
+func sourceDateEpoch(manifest string) (int64, error) {
+	if v, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		epoch, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid SOURCE_DATE_EPOCH %s", v)
+		}
+		return epoch, nil
+	}
+	out, err := exec.Command("git", "-C", filepath.Dir(manifest),
+		"log", "-1", "--format=%ct", "--", filepath.Base(manifest)).Output()
+	v := strings.TrimSpace(string(out))
+	if err != nil || v == "" {
+		return 0, errors.Newf("failed to get the commit time of %s, "+
+			"set SOURCE_DATE_EPOCH for the reproducible build", manifest)
+	}
+	epoch, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid commit time %s", v)
+	}
+	return epoch, nil
+}
+
+// getEnv gets the env in upper case, or falls back to the lower case.
+func getEnv(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return os.Getenv(strings.ToLower(key))
+}
+
 func DefaultPathEnv(os string) string {
 	if os == "windows" {
 		return types.DefaultPathEnvWindows
@@ -69,6 +115,17 @@ func DefaultPathEnv(os string) string {
 	return types.DefaultPathEnvUnix
 }
 
+// withDefaultPath appends the default PATH to the env unless it is set,
+// e.g. by the imported Dockerfile.
+func withDefaultPath(env []string, os string) []string {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			return env
+		}
+	}
+	return append(env, "PATH="+DefaultPathEnv(os))
+}
+
 func parseImportCacheCSV(s string) (gatewayclient.CacheOptionsEntry, error) {
 	im := gatewayclient.CacheOptionsEntry{
 		Type:  "",
@@ -105,7 +162,7 @@ func ParseImportCache(importCaches []string) ([]gatewayclient.CacheOptionsEntry,
 	for _, importCache := range importCaches {
 		legacy := !strings.Contains(importCache, "type=")
 		if legacy {
-			logrus.Warn("--import-cache <ref> is deprecated. Please use --import-cache type=registry,ref=<ref>,<opt>=<optval>[,<opt>=<optval>] instead.")
+			log.Warn("--import-cache <ref> is deprecated. Please use --import-cache type=registry,ref=<ref>,<opt>=<optval>[,<opt>=<optval>] instead.")
 			imports = append(imports, gatewayclient.CacheOptionsEntry{
 				Type:  "registry",
 				Attrs: map[string]string{"ref": importCache},
@@ -136,7 +193,7 @@ func ParseExportCache(exportCaches, legacyExportCacheOpts []string) ([]client.Ca
 		}
 		legacy := !strings.Contains(exportCache, "type=")
 		if legacy {
-			logrus.Warnf("--export-cache <ref> --export-cache-opt <opt>=<optval> is deprecated. Please use --export-cache type=registry,ref=<ref>,<opt>=<optval>[,<opt>=<optval>] instead")
+			log.Warnf("--export-cache <ref> --export-cache-opt <opt>=<optval> is deprecated. Please use --export-cache type=registry,ref=<ref>,<opt>=<optval>[,<opt>=<optval>] instead")
 			attrs, err := attrMap(legacyExportCacheOpts)
 			if err != nil {
 				return nil, err
@@ -208,6 +265,87 @@ func parseExportCacheCSV(s string) (client.CacheOptionsEntry, error) {
 	return ex, nil
 }
 
+// sharedKey returns the session shared key of the build context. buildkitd
+// keys the transferred local sources by it, thus the build after an
+// interrupted one (e.g. the laptop sleeps) reuses the uploaded context and
+// only transfers the changed files, besides the cached steps.
+func sharedKey(buildContextDir string) string {
+	sum := sha256.Sum256([]byte(buildContextDir))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// manifestHash returns the hash of the build file used as the cache key.
+// The serialized graph is hashed after normalization, thus the formatting
+// and the field order do not invalidate the cache.
+func manifestHash(filename string) (string, error) {
+	if !ir.IsGraphFile(filename) {
+		return starlark.GetEnvdProgramHash(filename)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	g, err := ir.UnmarshalGraph(data)
+	if err != nil {
+		return "", err
+	}
+	data, err = ir.MarshalGraph(g, ir.GraphFormatJSON)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// withLockHash appends the hash of the lockfile in the build context to
+// the manifest hash, thus the image is rebuilt if the lockfile changes.
+func withLockHash(hash, buildContextDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(buildContextDir, ir.LockFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return hash, nil
+		}
+		return "", errors.Wrap(err, "failed to read the lockfile")
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s-%s", hash, hex.EncodeToString(sum[:])[:8]), nil
+}
+
+// withArgsHash appends the hash of the build args to the manifest hash, thus
+// the image is rebuilt if the args change.
+func withArgsHash(hash string, args map[string]string) string {
+	if len(args) == 0 {
+		return hash
+	}
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s\n", name, args[name])
+	}
+	return fmt.Sprintf("%s-%s", hash, hex.EncodeToString(h.Sum(nil))[:8])
+}
+
+// ParseBuildArgs parses --arg in the KEY=VALUE format, the later one of the
+// same key takes precedence.
+func ParseBuildArgs(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, errors.Newf("invalid build arg %q, expected KEY=VALUE", arg)
+		}
+		parsed[name] = value
+	}
+	return parsed, nil
+}
+
 // parseOutput parses --output
 // Refer to https://github.com/moby/buildkit/blob/master/cmd/buildctl/build/output.go#L56
 func parseOutput(exports string) ([]client.ExportEntry, error) {
@@ -224,6 +362,25 @@ func parseOutput(exports string) ([]client.ExportEntry, error) {
 	return entries, nil
 }
 
+// isDockerLoad returns true if the entry loads the image into the docker host,
+// i.e. the docker exporter without the destination.
+func isDockerLoad(entry client.ExportEntry) bool {
+	return entry.Type == client.ExporterDocker && entry.Output == nil
+}
+
+// setDefaultImageName sets the image name to the tag for the exporters
+// which need it, if it is not specified in --output.
+func setDefaultImageName(entries []client.ExportEntry, tag string) {
+	for _, entry := range entries {
+		switch entry.Type {
+		case client.ExporterOCI, client.ExporterDocker, client.ExporterImage:
+			if _, ok := entry.Attrs["name"]; !ok && entry.Attrs != nil {
+				entry.Attrs["name"] = tag
+			}
+		}
+	}
+}
+
 // parseOutputCSV parses a single --output CSV string
 func parseOutputCSV(s string) (client.ExportEntry, error) {
 	ex := client.ExportEntry{
@@ -244,12 +401,12 @@ func parseOutputCSV(s string) (client.ExportEntry, error) {
 		value := parts[1]
 		switch key {
 		case "type":
-			logrus.WithFields(logrus.Fields{
+			log.WithFields(log.Fields{
 				"type": value,
 			}).Debug("Adding type into exporter entry")
 			ex.Type = value
 		default:
-			logrus.WithFields(logrus.Fields{
+			log.WithFields(log.Fields{
 				"key":   key,
 				"value": value,
 			}).Debug("Adding key into exporter entry")
@@ -333,3 +490,14 @@ func ParseFromStr(fromStr string) (string, string, error) {
 	}
 	return filename, funcname, nil
 }
+
+// EnvironmentName returns the name of the environment, which is the name of
+// the build context dir, suffixed with the env declared by environment(name,
+// build) if any, thus the environments in one build file do not collide.
+func EnvironmentName(buildContextDir, env string) string {
+	name := filepath.Base(buildContextDir)
+	if env != "" {
+		name += "-" + env
+	}
+	return name
+}
@@ -15,7 +15,11 @@
 package builder
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/moby/buildkit/client"
 	gatewayclient "github.com/moby/buildkit/frontend/gateway/client"
@@ -163,6 +167,22 @@ func TestParseOutput(t *testing.T) {
 		"tar",
 		1,
 		false,
+	}, {
+		"output to the local directory",
+		args{
+			output: "type=local,dest=output",
+		},
+		"local",
+		1,
+		false,
+	}, {
+		"local output without dest",
+		args{
+			output: "type=local",
+		},
+		"",
+		0,
+		true,
 	}, {
 		"no output",
 		args{
@@ -195,6 +215,61 @@ func TestParseOutput(t *testing.T) {
 	}
 }
 
+func TestSetDefaultImageName(t *testing.T) {
+	entries := []client.ExportEntry{
+		{Type: client.ExporterOCI, Attrs: map[string]string{}},
+		{Type: client.ExporterImage, Attrs: map[string]string{"name": "docker.io/envd/test:v1"}},
+		{Type: client.ExporterLocal, Attrs: map[string]string{}},
+	}
+	setDefaultImageName(entries, "docker.io/library/test:dev")
+	require.Equal(t, "docker.io/library/test:dev", entries[0].Attrs["name"])
+	require.Equal(t, "docker.io/envd/test:v1", entries[1].Attrs["name"])
+	require.NotContains(t, entries[2].Attrs, "name")
+}
+
+func TestSharedKey(t *testing.T) {
+	key := sharedKey("/home/envd/project")
+	require.Len(t, key, 16)
+	require.Equal(t, key, sharedKey("/home/envd/project"))
+	require.NotEqual(t, key, sharedKey("/home/envd/another"))
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "build.envd")
+	require.NoError(t, os.WriteFile(manifest, []byte(""), 0644))
+
+	// The manifest is not committed.
+	_, err := sourceDateEpoch(manifest)
+	require.Error(t, err)
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "build.envd"},
+		{"-c", "user.name=envd", "-c", "user.email=envd@example.com",
+			"commit", "-q", "-m", "init"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_COMMITTER_DATE=@1660000000 +0000")
+		require.NoError(t, cmd.Run())
+	}
+	// The mtime does not change the epoch.
+	mtime := time.Unix(1670000000, 0)
+	require.NoError(t, os.Chtimes(manifest, mtime, mtime))
+	epoch, err := sourceDateEpoch(manifest)
+	require.NoError(t, err)
+	require.Equal(t, int64(1660000000), epoch)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "0")
+	epoch, err = sourceDateEpoch(manifest)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), epoch)
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = sourceDateEpoch(manifest)
+	require.Error(t, err)
+}
+
 func TestParseFromStr(t *testing.T) {
 	type testCase struct {
 		name        string
@@ -259,3 +334,30 @@ func TestParseFromStr(t *testing.T) {
 		}
 	}
 }
+
+func TestEnvironmentName(t *testing.T) {
+	require.Equal(t, "project", EnvironmentName("/home/envd/project", ""))
+	require.Equal(t, "project-gpu", EnvironmentName("/home/envd/project", "gpu"))
+}
+
+func TestParseBuildArgs(t *testing.T) {
+	args, err := ParseBuildArgs([]string{"CUDA=11.7", "EXTRA=a=b", "EMPTY=", "CUDA=11.8"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"CUDA": "11.8", "EXTRA": "a=b", "EMPTY": ""}, args)
+
+	args, err = ParseBuildArgs(nil)
+	require.NoError(t, err)
+	require.Nil(t, args)
+
+	for _, arg := range []string{"CUDA", "=11.7"} {
+		_, err := ParseBuildArgs([]string{arg})
+		require.Error(t, err, arg)
+	}
+}
+
+func TestWithArgsHash(t *testing.T) {
+	require.Equal(t, "hash", withArgsHash("hash", nil))
+	hash := withArgsHash("hash", map[string]string{"CUDA": "11.7", "PYTHON": "3.9"})
+	require.Equal(t, hash, withArgsHash("hash", map[string]string{"PYTHON": "3.9", "CUDA": "11.7"}))
+	require.NotEqual(t, hash, withArgsHash("hash", map[string]string{"CUDA": "11.8", "PYTHON": "3.9"}))
+}
@@ -25,14 +25,16 @@ import (
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
 	gateway "github.com/moby/buildkit/frontend/gateway/client"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
-	"github.com/tonistiigi/units"
 
 	"github.com/tensorchord/envd/pkg/docker"
 	"github.com/tensorchord/envd/pkg/envd"
+	"github.com/tensorchord/envd/pkg/errdefs"
 	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/formatter"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/types"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
 var (
@@ -53,6 +55,13 @@ type Client interface {
 	) (*client.SolveResponse, error)
 	Prune(ctx context.Context, keepDuration time.Duration,
 		keepStorage float64, filter []string, verbose, all bool) error
+	// Reclaimable returns the size of the build cache that Prune may delete.
+	Reclaimable(ctx context.Context, filter []string, all bool) (int64, error)
+	// DiskUsage returns the records of the build cache matching the filter.
+	DiskUsage(ctx context.Context, filter []string) ([]*client.UsageInfo, error)
+	// Clean deletes the unused build cache matching the filter without
+	// printing, and returns the size deleted.
+	Clean(ctx context.Context, filter []string) (int64, error)
 	Close() error
 }
 
@@ -65,11 +74,16 @@ type generalClient struct {
 	socket string
 
 	*client.Client
-	logger *logrus.Entry
+	logger *log.Entry
 }
 
-func NewClient(ctx context.Context, driver types.BuilderType,
-	socket, mirror string) (Client, error) {
+// NewClient creates the client of the builder in the context, which is
+// overridden by --builder and the TLS flags if they are set.
+func NewClient(ctx context.Context, bc types.Context, mirror string) (Client, error) {
+	driver, socket, tlsConfig, err := builder(bc)
+	if err != nil {
+		return nil, err
+	}
 	c := &generalClient{
 		containerName: socket,
 		image:         viper.GetString(flag.FlagBuildkitdImage),
@@ -77,25 +91,65 @@ func NewClient(ctx context.Context, driver types.BuilderType,
 	}
 	c.socket = socket
 	c.driver = driver
-	c.logger = logrus.WithFields(logrus.Fields{
+	c.logger = log.WithFields(log.Fields{
 		"container": c.containerName,
 		"image":     c.image,
 		"socket":    c.socket,
 		"driver":    c.driver,
+		"tls":       tlsConfig != nil,
 	})
 
-	cli, err := client.New(ctx, c.BuildkitdAddr(), client.WithFailFast())
+	opts := []client.ClientOpt{client.WithFailFast()}
+	if tlsConfig != nil {
+		opts = append(opts, client.WithCredentials(tlsConfig.ServerName,
+			tlsConfig.CACert, tlsConfig.Cert, tlsConfig.Key))
+	}
+	cli, err := client.New(ctx, c.BuildkitdAddr(), opts...)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create the client")
+		return nil, errdefs.Wrap(errors.Wrap(err, "failed to create the client"),
+			errdefs.BuildkitdUnavailable)
 	}
 	c.Client = cli
 
 	if _, err := c.Bootstrap(ctx, timeoutRun, timeoutConnection); err != nil {
-		return nil, errors.Wrap(err, "failed to bootstrap the buildkitd")
+		return nil, errdefs.Wrap(errors.Wrap(err, "failed to bootstrap the buildkitd"),
+			errdefs.BuildkitdUnavailable)
 	}
 	return c, nil
 }
 
+// builder returns the builder of the context, or the one set by the flags,
+// e.g. envd --builder tcp://buildkitd.example.com:1234 build.
+func builder(c types.Context) (types.BuilderType, string, *types.BuilderTLS, error) {
+	driver, socket, tlsConfig := c.Builder, c.BuilderAddress, c.BuilderTLS
+	if b := viper.GetString(flag.FlagBuilder); b != "" {
+		var err error
+		if driver, socket, err = types.ParseBuilder(b); err != nil {
+			return "", "", nil, err
+		}
+		tlsConfig = nil
+	}
+	flagTLS := types.BuilderTLS{
+		CACert:     viper.GetString(flag.FlagBuilderTLSCA),
+		Cert:       viper.GetString(flag.FlagBuilderTLSCert),
+		Key:        viper.GetString(flag.FlagBuilderTLSKey),
+		ServerName: viper.GetString(flag.FlagBuilderTLSName),
+	}
+	if flagTLS != (types.BuilderTLS{}) {
+		tlsConfig = &flagTLS
+	}
+	if tlsConfig == nil {
+		return driver, socket, nil, nil
+	}
+	if driver != types.BuilderTypeTCP {
+		return "", "", nil, errors.Newf("TLS is only supported by the tcp builder, got %s", driver)
+	}
+	if err := tlsConfig.Validate(); err != nil {
+		return "", "", nil, err
+	}
+	return driver, socket, tlsConfig, nil
+}
+
 func (c *generalClient) Bootstrap(ctx context.Context,
 	runningTimeout, connectingTimeout time.Duration) (string, error) {
 	address, err := c.maybeStart(ctx, runningTimeout, connectingTimeout)
@@ -114,6 +168,12 @@ func (c generalClient) Close() error {
 func (c *generalClient) maybeStart(ctx context.Context,
 	runningTimeout, connectingTimeout time.Duration) (string, error) {
 	if c.driver == types.BuilderTypeDocker {
+		// The concurrent envd processes may create the same container.
+		unlock, err := fileutil.Lock(ctx, "buildkitd-"+c.containerName)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
 		dockerClient, err := docker.NewClient(ctx)
 		if err != nil {
 			return "", err
@@ -177,7 +237,7 @@ func (c generalClient) waitUntilConnected(
 		case <-time.After(interval):
 			connected, err := c.connected(ctxTimeout)
 			if err != nil {
-				logrus.Debugf("failed to connect to buildkitd: %s", err.Error())
+				log.Debugf("failed to connect to buildkitd: %s", err.Error())
 				continue
 			}
 			if !connected {
@@ -243,11 +303,62 @@ func (c generalClient) Prune(ctx context.Context, keepDuration time.Duration,
 	}
 
 	tw = tabwriter.NewWriter(os.Stdout, 1, 8, 1, '\t', 0)
-	fmt.Fprintf(tw, "Total:\t%.2f\n", units.Bytes(total))
+	fmt.Fprintf(tw, "Total:\t%s\n", formatter.HumanSize(total))
 	tw.Flush()
 	return nil
 }
 
+func (c generalClient) Clean(ctx context.Context, filter []string) (int64, error) {
+	ch := make(chan client.UsageInfo)
+	done := make(chan struct{})
+	total := int64(0)
+	go func() {
+		defer close(done)
+		for du := range ch {
+			total += du.Size
+		}
+	}()
+
+	err := c.Client.Prune(ctx, ch, client.WithFilter(filter))
+	close(ch)
+	<-done
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to prune the build cache")
+	}
+	return total, nil
+}
+
+func (c generalClient) DiskUsage(ctx context.Context,
+	filter []string) ([]*client.UsageInfo, error) {
+	du, err := c.Client.DiskUsage(ctx, client.WithFilter(filter))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the disk usage")
+	}
+	return du, nil
+}
+
+func (c generalClient) Reclaimable(ctx context.Context,
+	filter []string, all bool) (int64, error) {
+	du, err := c.DiskUsage(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	total := int64(0)
+	for _, di := range du {
+		if di.InUse {
+			continue
+		}
+		// Internal and frontend records are only pruned with --all.
+		if !all && (di.RecordType == client.UsageRecordTypeInternal ||
+			di.RecordType == client.UsageRecordTypeFrontend) {
+			continue
+		}
+		total += di.Size
+	}
+	return total, nil
+}
+
 func (c generalClient) BuildkitdAddr() string {
 	return fmt.Sprintf("%s://%s", c.driver, c.socket)
 }
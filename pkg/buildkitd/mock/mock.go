@@ -67,6 +67,21 @@ func (mr *MockClientMockRecorder) BuildkitdAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildkitdAddr", reflect.TypeOf((*MockClient)(nil).BuildkitdAddr))
 }
 
+// Clean mocks base method.
+func (m *MockClient) Clean(ctx context.Context, filter []string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Clean", ctx, filter)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clean indicates an expected call of Clean.
+func (mr *MockClientMockRecorder) Clean(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clean", reflect.TypeOf((*MockClient)(nil).Clean), ctx, filter)
+}
+
 // Close mocks base method.
 func (m *MockClient) Close() error {
 	m.ctrl.T.Helper()
@@ -81,6 +96,21 @@ func (mr *MockClientMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockClient)(nil).Close))
 }
 
+// DiskUsage mocks base method.
+func (m *MockClient) DiskUsage(ctx context.Context, filter []string) ([]*client.UsageInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DiskUsage", ctx, filter)
+	ret0, _ := ret[0].([]*client.UsageInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DiskUsage indicates an expected call of DiskUsage.
+func (mr *MockClientMockRecorder) DiskUsage(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiskUsage", reflect.TypeOf((*MockClient)(nil).DiskUsage), ctx, filter)
+}
+
 // Prune mocks base method.
 func (m *MockClient) Prune(ctx context.Context, keepDuration time.Duration, keepStorage float64, filter []string, verbose, all bool) error {
 	m.ctrl.T.Helper()
@@ -95,6 +125,21 @@ func (mr *MockClientMockRecorder) Prune(ctx, keepDuration, keepStorage, filter,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prune", reflect.TypeOf((*MockClient)(nil).Prune), ctx, keepDuration, keepStorage, filter, verbose, all)
 }
 
+// Reclaimable mocks base method.
+func (m *MockClient) Reclaimable(ctx context.Context, filter []string, all bool) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reclaimable", ctx, filter, all)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reclaimable indicates an expected call of Reclaimable.
+func (mr *MockClientMockRecorder) Reclaimable(ctx, filter, all interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reclaimable", reflect.TypeOf((*MockClient)(nil).Reclaimable), ctx, filter, all)
+}
+
 // Solve mocks base method.
 func (m *MockClient) Solve(ctx context.Context, def *llb.Definition, opt client.SolveOpt, statusChan chan *client.SolveStatus) (*client.SolveResponse, error) {
 	m.ctrl.T.Helper()
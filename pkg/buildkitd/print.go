@@ -21,7 +21,8 @@ import (
 	"text/tabwriter"
 
 	"github.com/moby/buildkit/client"
-	"github.com/tonistiigi/units"
+
+	"github.com/tensorchord/envd/pkg/formatter"
 )
 
 func printVerbose(tw *tabwriter.Writer, du []*client.UsageInfo) {
@@ -34,7 +35,7 @@ func printVerbose(tw *tabwriter.Writer, du []*client.UsageInfo) {
 		printKV(tw, "Mutable", di.Mutable)
 		printKV(tw, "Reclaimable", !di.InUse)
 		printKV(tw, "Shared", di.Shared)
-		printKV(tw, "Size", fmt.Sprintf("%.2f", units.Bytes(di.Size)))
+		printKV(tw, "Size", formatter.HumanSize(di.Size))
 		if di.Description != "" {
 			printKV(tw, "Description", di.Description)
 		}
@@ -65,7 +66,7 @@ func printTableRow(tw *tabwriter.Writer, di *client.UsageInfo) {
 	if di.Mutable {
 		id += "*"
 	}
-	size := fmt.Sprintf("%.2f", units.Bytes(di.Size))
+	size := formatter.HumanSize(di.Size)
 	if di.Shared {
 		size += "*"
 	}
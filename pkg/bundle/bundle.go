@@ -0,0 +1,250 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle reads and writes the bundle of the envd environment, which
+// is a gzipped tar archive of the image, the workspace, the shell state and
+// the lockfile. The manifest is always the first entry.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	// Version is the version of the bundle format.
+	Version = "v1"
+
+	ManifestFile  = "manifest.json"
+	ImageFile     = "image.tar"
+	WorkspaceFile = "workspace.tar"
+	StateFile     = "state.tar"
+	LockFile      = "envd.lock"
+)
+
+// Manifest describes the environment in the bundle.
+type Manifest struct {
+	Version string `json:"version"`
+	// Name is the name of the environment.
+	Name string `json:"name"`
+	// Workspace is the base name of the workspace directory, which differs
+	// from the name if the environment is started with --env.
+	Workspace string `json:"workspace,omitempty"`
+	// Image is the tag of the image in the bundle.
+	Image       string    `json:"image"`
+	EnvdVersion string    `json:"envd_version,omitempty"`
+	Created     time.Time `json:"created"`
+}
+
+// WorkspaceDir returns the base name of the workspace directory. The older
+// bundles do not record it, and it is the same as the name there.
+func (m Manifest) WorkspaceDir() string {
+	if m.Workspace != "" {
+		return m.Workspace
+	}
+	return m.Name
+}
+
+// Writer writes the entries into the bundle.
+type Writer struct {
+	f  *os.File
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+// NewWriter creates the bundle file and writes the manifest into it.
+func NewWriter(path string, m Manifest) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the bundle %s", path)
+	}
+	gz := gzip.NewWriter(f)
+	w := &Writer{f: f, gz: gz, tw: tar.NewWriter(gz)}
+
+	m.Version = Version
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		w.Close()
+		return nil, errors.Wrap(err, "failed to marshal the manifest")
+	}
+	if err := w.write(ManifestFile, int64(len(data)), strings.NewReader(string(data))); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Add adds the entry with the content in the reader. The content is
+// buffered in a temporary file since the size is required by the tar header.
+func (w *Writer) Add(name string, r io.Reader) error {
+	tmp, err := os.CreateTemp("", "envd-bundle-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create the temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", name)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "failed to read %s", name)
+	}
+	return w.write(name, size, tmp)
+}
+
+func (w *Writer) write(name string, size int64, r io.Reader) error {
+	if err := w.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}); err != nil {
+		return errors.Wrapf(err, "failed to write the header of %s", name)
+	}
+	if _, err := io.Copy(w.tw, r); err != nil {
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+	return nil
+}
+
+// Close flushes the bundle and closes the file.
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		w.f.Close()
+		return errors.Wrap(err, "failed to close the bundle")
+	}
+	if err := w.gz.Close(); err != nil {
+		w.f.Close()
+		return errors.Wrap(err, "failed to close the bundle")
+	}
+	return w.f.Close()
+}
+
+// Walk reads the manifest in the bundle and calls fn with every other
+// entry in order. The reader is only valid in the call.
+func Walk(path string, fn func(m Manifest, name string, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open the bundle %s", path)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrapf(err, "%s is not an envd bundle", path)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != ManifestFile {
+		return errors.Newf("%s is not an envd bundle: the manifest is not found", path)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return errors.Wrap(err, "failed to parse the manifest")
+	}
+	if m.Version != Version {
+		return errors.Newf("unsupported bundle version %s, expected %s", m.Version, Version)
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the bundle %s", path)
+		}
+		if err := fn(m, hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// Extract extracts the tar archive into the directory. The entries out of
+// the directory are rejected, and the symlinks out of it are skipped.
+func Extract(r io.Reader, dir string) error {
+	dir = filepath.Clean(dir)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read the archive")
+		}
+		target := filepath.Join(dir, hdr.Name)
+		if !within(dir, target) {
+			return errors.Newf("invalid path %s in the archive", hdr.Name)
+		}
+
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return errors.Wrapf(err, "failed to create the directory %s", target)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return errors.Wrapf(err, "failed to create the directory of %s", target)
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create %s", target)
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return errors.Wrapf(err, "failed to write %s", target)
+			}
+			if err := f.Close(); err != nil {
+				return errors.Wrapf(err, "failed to write %s", target)
+			}
+		case tar.TypeSymlink:
+			link := hdr.Linkname
+			if !filepath.IsAbs(link) {
+				link = filepath.Join(filepath.Dir(target), link)
+			}
+			if !within(dir, link) {
+				continue
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return errors.Wrapf(err, "failed to create the symlink %s", target)
+			}
+		default:
+			// e.g. the devices and the hard links are not expected in the workspace.
+			continue
+		}
+		// The modification time is kept, thus the build cache is still valid.
+		if hdr.Typeflag != tar.TypeSymlink {
+			if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+				return errors.Wrapf(err, "failed to set the time of %s", target)
+			}
+		}
+	}
+}
+
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
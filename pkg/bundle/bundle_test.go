@@ -0,0 +1,125 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tar.gz")
+	w, err := NewWriter(path, Manifest{Name: "test", Image: "test:dev"})
+	if err != nil {
+		t.Fatalf("failed to create the bundle: %v", err)
+	}
+	if err := w.Add(ImageFile, strings.NewReader("image")); err != nil {
+		t.Fatalf("failed to add the image: %v", err)
+	}
+	if err := w.Add(LockFile, strings.NewReader("lock")); err != nil {
+		t.Fatalf("failed to add the lockfile: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close the bundle: %v", err)
+	}
+
+	entries := map[string]string{}
+	if err := Walk(path, func(m Manifest, name string, r io.Reader) error {
+		if m.Version != Version || m.Name != "test" || m.Image != "test:dev" {
+			t.Errorf("unexpected manifest %v", m)
+		}
+		data, err := io.ReadAll(r)
+		entries[name] = string(data)
+		return err
+	}); err != nil {
+		t.Fatalf("failed to walk the bundle: %v", err)
+	}
+	if entries[ImageFile] != "image" || entries[LockFile] != "lock" || len(entries) != 2 {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestManifestWorkspaceDir(t *testing.T) {
+	m := Manifest{Name: "test-dev", Workspace: "test"}
+	if dir := m.WorkspaceDir(); dir != "test" {
+		t.Errorf("expected the workspace test, got %s", dir)
+	}
+	// The older bundles do not record the workspace.
+	m.Workspace = ""
+	if dir := m.WorkspaceDir(); dir != "test-dev" {
+		t.Errorf("expected the workspace test-dev, got %s", dir)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	testcases := []struct {
+		name    string
+		headers []tar.Header
+		files   []string
+		wantErr bool
+	}{
+		{
+			name: "workspace",
+			headers: []tar.Header{
+				{Name: "test/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "test/build.envd", Typeflag: tar.TypeReg, Mode: 0644},
+				{Name: "test/link", Typeflag: tar.TypeSymlink, Linkname: "build.envd"},
+			},
+			files: []string{"test/build.envd", "test/link"},
+		},
+		{
+			name: "symlink out of the directory",
+			headers: []tar.Header{
+				{Name: "passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+			},
+		},
+		{
+			name: "path out of the directory",
+			headers: []tar.Header{
+				{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for i := range tc.headers {
+			if err := tw.WriteHeader(&tc.headers[i]); err != nil {
+				t.Fatalf("%s: failed to write the header: %v", tc.name, err)
+			}
+		}
+		tw.Close()
+
+		dir := t.TempDir()
+		err := Extract(&buf, dir)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.wantErr, err)
+		}
+		for _, f := range tc.files {
+			if _, err := os.Lstat(filepath.Join(dir, f)); err != nil {
+				t.Errorf("%s: expected %s to be extracted: %v", tc.name, f, err)
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "passwd")); err == nil {
+			t.Errorf("%s: expected the symlink out of the directory to be skipped", tc.name)
+		}
+	}
+}
@@ -19,7 +19,30 @@ const (
 	PrivateKeyFile               = "id_rsa_envd"
 	PublicKeyFile                = "id_rsa_envd.pub"
 	ContainerAuthorizedKeysPath  = "/var/envd/authorized_keys"
+	ContainerHostKeyPath         = "/var/envd/host_key"
+	ContainerSSHAgentPath        = "/var/envd/ssh-agent.sock"
 	SSHPortInContainer           = 2222
 	JupyterPortInContainer       = 8888
 	RStudioServerPortInContainer = 8787
+	CodeServerPortInContainer    = 8080
+
+	// ContainerStateDir keeps the shell state, e.g. the history, in the
+	// volume mounted by envd up, thus it survives the rebuilds.
+	ContainerStateDir = "/var/envd/state"
+	// ContainerHistoryDir is the shell history dir in the host cache mounted
+	// by envd up, see envd.HistoryDir.
+	ContainerHistoryDir = "/var/envd/history"
+
+	// ContainerGitConfigPath is the system git config, thus the one in the
+	// home dir set by git_config takes precedence.
+	ContainerGitConfigPath = "/etc/gitconfig"
+	// ContainerGitCredentialsPath is read by git credential-store.
+	ContainerGitCredentialsPath = "/var/envd/git-credentials"
+	// ContainerPGServicePath is the pg_service.conf set by PGSERVICEFILE.
+	ContainerPGServicePath = "/var/envd/pg_service.conf"
+	// ContainerMySQLConfigPath is included by the mysql option file.
+	ContainerMySQLConfigPath = "/etc/mysql/conf.d/envd.cnf"
+	// ContainerEntrypointPath is the entrypoint script generated from the
+	// build file, which starts envd-sshd and the other processes.
+	ContainerEntrypointPath = "/var/envd/bin/entrypoint.sh"
 )
@@ -15,21 +15,27 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"regexp"
 	"strings"
 
 	"github.com/cockroachdb/errors"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/moby/term"
-	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd/pkg/errdefs"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 var (
@@ -39,17 +45,52 @@ var (
 type Client interface {
 	// Load loads the image from the reader to the docker host.
 	Load(ctx context.Context, r io.ReadCloser, quiet bool) error
+	// PullImage pulls the image into the docker host, even if it exists.
+	PullImage(ctx context.Context, image string) error
+	// StartBuildkitd starts the buildkitd container. The rootless image is
+	// used if the docker daemon is rootless.
 	StartBuildkitd(ctx context.Context, tag, name, mirror string) (string, error)
+	// Rootless returns true if the docker daemon runs in the user namespace.
+	Rootless(ctx context.Context) (bool, error)
+	// StartCacher starts the package cache container if it is not running,
+	// and returns the address of it.
+	StartCacher(ctx context.Context, opt CacherOptions) (string, error)
 
 	Exec(ctx context.Context, cname string, cmd []string) error
+	// Run runs the command as root in a temporary container of the image,
+	// and returns the stdout.
+	Run(ctx context.Context, image string, cmd []string) (string, error)
 	Destroy(ctx context.Context, name string) (string, error)
+	// CopyFrom returns the tar archive of the path in the container. It
+	// returns nil if the path does not exist. It's up to the caller to close
+	// the io.ReadCloser.
+	CopyFrom(ctx context.Context, cname, path string) (io.ReadCloser, error)
 
 	GetImageWithCacheHashLabel(ctx context.Context, image string, hash string) (types.ImageSummary, error)
 	RemoveImage(ctx context.Context, image string) error
+	// SaveImage returns the tar archive of the image, which is loaded by Load.
+	// It's up to the caller to close the io.ReadCloser.
+	SaveImage(ctx context.Context, image string) (io.ReadCloser, error)
+	// RemoveVolume removes the volume. It returns nil if it does not exist.
+	RemoveVolume(ctx context.Context, name string) error
+	// RestoreVolume creates the volume from the target dir in the image, and
+	// extracts the archive returned by CopyFrom of the target into it.
+	RestoreVolume(ctx context.Context, image, name, target string, r io.Reader) error
 
 	Stats(ctx context.Context, cname string, statChan chan<- *Stats, done <-chan bool) error
 }
 
+// CacherOptions is the options of the container which caches the
+// packages (e.g. apt, PyPI) on the host for all the builds.
+type CacherOptions struct {
+	Image string
+	Name  string
+	// CacheDir is the directory in the container, which is kept in the volume.
+	CacheDir string
+	Port     int
+	Env      []string
+}
+
 type generalClient struct {
 	*client.Client
 }
@@ -61,12 +102,10 @@ func NewClient(ctx context.Context) (Client, error) {
 	}
 	_, err = cli.Ping(ctx)
 	if err != nil {
-		// Special note needed to give users
 		if strings.Contains(err.Error(), "permission denied") {
-			err = errors.New(`It seems that current user have no access to docker daemon,
-please visit https://docs.docker.com/engine/install/linux-postinstall/ for more info.`)
+			return nil, errdefs.Wrap(err, errdefs.DockerPermissionDenied)
 		}
-		return nil, err
+		return nil, errdefs.Wrap(err, errdefs.DockerUnavailable)
 	}
 	return generalClient{cli}, nil
 }
@@ -90,12 +129,26 @@ func NormalizeNamed(s string) (string, error) {
 		} else {
 			s = remoteName
 		}
-		logrus.Warnf("The working direcotry's name is not lowercased: %s, the image built will be lowercased to %s", remoteName, s)
+		log.Warnf("The working direcotry's name is not lowercased: %s, the image built will be lowercased to %s", remoteName, s)
 	}
 	return s, nil
 
 }
 
+// WithRegistry replaces the registry of the image with the given one, e.g.
+// registry.example.com/envd and docker.io/library/test:dev are turned into
+// registry.example.com/envd/library/test:dev.
+func WithRegistry(registry, image string) string {
+	name := image
+	if i := strings.IndexRune(image, '/'); i > -1 {
+		domain := image[:i]
+		if strings.ContainsAny(domain, ".:") || domain == "localhost" {
+			name = image[i+1:]
+		}
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(registry, "/"), name)
+}
+
 func (c generalClient) ListImage(ctx context.Context) ([]types.ImageSummary, error) {
 	images, err := c.ImageList(ctx, types.ImageListOptions{
 		Filters: dockerFilters(false),
@@ -106,12 +159,22 @@ func (c generalClient) ListImage(ctx context.Context) ([]types.ImageSummary, err
 func (c generalClient) RemoveImage(ctx context.Context, image string) error {
 	_, err := c.ImageRemove(ctx, image, types.ImageRemoveOptions{})
 	if err != nil {
-		logrus.WithError(err).Errorf("failed to remove image %s", image)
+		log.WithError(err).Errorf("failed to remove image %s", image)
 		return err
 	}
 	return nil
 }
 
+func (c generalClient) RemoveVolume(ctx context.Context, name string) error {
+	if err := c.VolumeRemove(ctx, name, false); err != nil {
+		if client.IsErrNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to remove the volume %s", name)
+	}
+	return nil
+}
+
 func (c generalClient) GetImage(ctx context.Context, image string) (types.ImageSummary, error) {
 	images, err := c.ImageList(ctx, types.ImageListOptions{
 		Filters: dockerFiltersWithName(image),
@@ -139,7 +202,7 @@ func (c generalClient) GetImageWithCacheHashLabel(ctx context.Context, image str
 }
 
 func (c generalClient) PauseContainer(ctx context.Context, name string) (string, error) {
-	logger := logrus.WithField("container", name)
+	logger := log.WithField("container", name)
 	err := c.ContainerPause(ctx, name)
 	if err != nil {
 		errCause := errors.UnwrapAll(err).Error()
@@ -158,7 +221,7 @@ func (c generalClient) PauseContainer(ctx context.Context, name string) (string,
 }
 
 func (c generalClient) ResumeContainer(ctx context.Context, name string) (string, error) {
-	logger := logrus.WithField("container", name)
+	logger := log.WithField("container", name)
 	err := c.ContainerUnpause(ctx, name)
 	if err != nil {
 		errCause := errors.UnwrapAll(err).Error()
@@ -177,7 +240,7 @@ func (c generalClient) ResumeContainer(ctx context.Context, name string) (string
 }
 
 func (c generalClient) Destroy(ctx context.Context, name string) (string, error) {
-	logger := logrus.WithField("container", name)
+	logger := log.WithField("container", name)
 	// Refer to https://docs.docker.com/engine/reference/commandline/container_kill/
 	if err := c.ContainerKill(ctx, name, "KILL"); err != nil {
 		errCause := errors.UnwrapAll(err).Error()
@@ -201,46 +264,23 @@ func (c generalClient) Destroy(ctx context.Context, name string) (string, error)
 }
 
 func (c generalClient) StartBuildkitd(ctx context.Context, tag, name, mirror string) (string, error) {
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
 		"tag":       tag,
 		"container": name,
 		"mirror":    mirror,
 	})
 	logger.Debug("starting buildkitd")
-	if _, _, err := c.ImageInspectWithRaw(ctx, tag); err != nil {
-		if !client.IsErrNotFound(err) {
-			return "", errors.Wrap(err, "failed to inspect image")
-		}
-
-		// Pull the image.
-		logger.Debug("pulling image")
-		body, err := c.ImagePull(ctx, tag, types.ImagePullOptions{})
-		if err != nil {
-			return "", errors.Wrap(err, "failed to pull image")
-		}
-		defer body.Close()
-		termFd, isTerm := term.GetFdInfo(os.Stdout)
-		err = jsonmessage.DisplayJSONMessagesStream(body, os.Stdout, termFd, isTerm, nil)
-		if err != nil {
-			logger.WithError(err).Warningln("failed to display image pull output")
-		}
-	}
-	config := &container.Config{
-		Image: tag,
-	}
-	if mirror != "" {
-		cfg := fmt.Sprintf(`
-[registry."docker.io"]
-	mirrors = ["%s"]`, mirror)
-		config.Entrypoint = []string{
-			"/bin/sh",
-			"-c",
-			fmt.Sprintf("mkdir /etc/buildkit && echo '%s' > /etc/buildkit/buildkitd.toml && buildkitd", cfg),
-		}
-		logger.Debugf("setting buildkit config: %s", cfg)
+	rootless, err := c.Rootless(ctx)
+	if err != nil {
+		return "", err
 	}
-	hostConfig := &container.HostConfig{
-		Privileged: true,
+	config, hostConfig := buildkitdConfig(tag, mirror, rootless)
+	logger.WithFields(log.Fields{
+		"rootless":   rootless,
+		"entrypoint": config.Entrypoint,
+	}).Debug("setting buildkitd config")
+	if err := c.pullIfNotExists(ctx, config.Image); err != nil {
+		return "", err
 	}
 	created, _ := c.Exists(ctx, name)
 	if created {
@@ -271,6 +311,83 @@ func (c generalClient) StartBuildkitd(ctx context.Context, tag, name, mirror str
 	return container.Name, nil
 }
 
+func (c generalClient) StartCacher(ctx context.Context, opt CacherOptions) (string, error) {
+	logger := log.WithFields(log.Fields{
+		"tag":       opt.Image,
+		"container": opt.Name,
+	})
+	logger.Debug("starting the cacher")
+	created, err := c.Exists(ctx, opt.Name)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to inspect container")
+	}
+	if !created {
+		if err := c.pullIfNotExists(ctx, opt.Image); err != nil {
+			return "", err
+		}
+		config := &container.Config{
+			Image: opt.Image,
+			Env:   opt.Env,
+		}
+		hostConfig := &container.HostConfig{
+			// Keep the cache across the restarts of the container.
+			Binds:         []string{fmt.Sprintf("%s:%s", opt.Name, opt.CacheDir)},
+			RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+		}
+		resp, err := c.ContainerCreate(ctx, config, hostConfig, nil, nil, opt.Name)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to create container")
+		}
+		for _, w := range resp.Warnings {
+			logger.Warnf("run with warnings: %s", w)
+		}
+	}
+	if err := c.ContainerStart(ctx, opt.Name, types.ContainerStartOptions{}); err != nil {
+		return "", errors.Wrap(err, "failed to start container")
+	}
+
+	// The buildkitd container reaches it by the IP in the docker network.
+	container, err := c.ContainerInspect(ctx, opt.Name)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to inspect container")
+	}
+	if container.NetworkSettings == nil || container.NetworkSettings.IPAddress == "" {
+		return "", errors.Newf("failed to get the IP address of %s", opt.Name)
+	}
+	return fmt.Sprintf("http://%s:%d", container.NetworkSettings.IPAddress, opt.Port), nil
+}
+
+// pullIfNotExists pulls the image if it does not exist in the docker host.
+func (c generalClient) pullIfNotExists(ctx context.Context, tag string) error {
+	if _, _, err := c.ImageInspectWithRaw(ctx, tag); err != nil {
+		if !client.IsErrNotFound(err) {
+			return errors.Wrap(err, "failed to inspect image")
+		}
+		return c.PullImage(ctx, tag)
+	}
+	return nil
+}
+
+func (c generalClient) PullImage(ctx context.Context, image string) error {
+	logger := log.WithField("tag", image)
+	logger.Debug("pulling image")
+	body, err := c.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to pull image")
+	}
+	defer body.Close()
+	termFd, isTerm := term.GetFdInfo(os.Stdout)
+	err = jsonmessage.DisplayJSONMessagesStream(body, os.Stdout, termFd, isTerm, nil)
+	if err != nil {
+		var jsonErr *jsonmessage.JSONError
+		if errors.As(err, &jsonErr) {
+			return errors.Wrap(err, "failed to pull image")
+		}
+		logger.WithError(err).Warningln("failed to display image pull output")
+	}
+	return nil
+}
+
 func (c generalClient) Exists(ctx context.Context, cname string) (bool, error) {
 	_, err := c.ContainerInspect(ctx, cname)
 	if err != nil {
@@ -320,6 +437,112 @@ func (c generalClient) Exec(ctx context.Context, cname string, cmd []string) err
 	})
 }
 
+func (c generalClient) Run(ctx context.Context, image string, cmd []string) (string, error) {
+	logger := log.WithFields(log.Fields{
+		"image":   image,
+		"command": cmd,
+	})
+	resp, err := c.ContainerCreate(ctx, &container.Config{
+		Image:      image,
+		User:       "root",
+		Entrypoint: cmd,
+	}, nil, nil, nil, "")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create the container")
+	}
+	defer func() {
+		if err := c.ContainerRemove(context.Background(), resp.ID,
+			types.ContainerRemoveOptions{Force: true}); err != nil {
+			logger.Warnf("failed to remove the container %s: %s", resp.ID, err)
+		}
+	}()
+
+	if err := c.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return "", errors.Wrap(err, "failed to start the container")
+	}
+	var code int64
+	statusC, errC := c.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errC:
+		return "", errors.Wrap(err, "failed to wait for the container")
+	case status := <-statusC:
+		code = status.StatusCode
+	}
+
+	logs, err := c.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the logs of the container")
+	}
+	defer logs.Close()
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+		return "", errors.Wrap(err, "failed to read the logs of the container")
+	}
+	if code != 0 {
+		return "", errors.Newf("command exited with code %d: %s",
+			code, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func (c generalClient) CopyFrom(ctx context.Context, cname, path string) (io.ReadCloser, error) {
+	r, _, err := c.CopyFromContainer(ctx, cname, path)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to copy %s from the container %s", path, cname)
+	}
+	return r, nil
+}
+
+func (c generalClient) SaveImage(ctx context.Context, image string) (io.ReadCloser, error) {
+	r, err := c.ImageSave(ctx, []string{image})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to save the image %s", image)
+	}
+	return r, nil
+}
+
+func (c generalClient) RestoreVolume(ctx context.Context, image, name, target string, r io.Reader) error {
+	logger := log.WithFields(log.Fields{
+		"image":  image,
+		"volume": name,
+		"target": target,
+	})
+	// The container is never started, it only mounts the volume.
+	resp, err := c.ContainerCreate(ctx, &container.Config{
+		Image: image,
+		User:  "root",
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{{
+			Type:   mount.TypeVolume,
+			Source: name,
+			Target: target,
+		}},
+	}, nil, nil, "")
+	if err != nil {
+		return errors.Wrap(err, "failed to create the container")
+	}
+	defer func() {
+		if err := c.ContainerRemove(context.Background(), resp.ID,
+			types.ContainerRemoveOptions{Force: true}); err != nil {
+			logger.Warnf("failed to remove the container %s: %s", resp.ID, err)
+		}
+	}()
+
+	// The archive contains the target dir itself.
+	if err := c.CopyToContainer(ctx, resp.ID, path.Dir(target), r,
+		types.CopyToContainerOptions{CopyUIDGID: true}); err != nil {
+		return errors.Wrapf(err, "failed to restore the volume %s", name)
+	}
+	logger.Debug("volume is restored")
+	return nil
+}
+
 func (c generalClient) Stats(ctx context.Context, cname string, statChan chan<- *Stats, done <-chan bool) (retErr error) {
 	errC := make(chan error, 1)
 	containerStats, err := c.ContainerStats(ctx, cname, true)
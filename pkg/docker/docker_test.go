@@ -15,6 +15,8 @@
 package docker
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -39,4 +41,79 @@ var _ = Describe("docker", func() {
 			Expect(newTag).To(Equal(strings.ToLower(tag)))
 		})
 	})
+	When("given the registry", func() {
+		It("should replace the registry of the image", func() {
+			tcs := []struct {
+				registry string
+				image    string
+				expected string
+			}{
+				{"registry:5000", "test:dev", "registry:5000/test:dev"},
+				{"registry:5000/", "user/test:dev", "registry:5000/user/test:dev"},
+				{"example.com/envd", "docker.io/library/test:dev", "example.com/envd/library/test:dev"},
+				{"example.com", "localhost/test:dev", "example.com/test:dev"},
+			}
+			for _, tc := range tcs {
+				Expect(WithRegistry(tc.registry, tc.image)).To(Equal(tc.expected))
+			}
+		})
+	})
+	When("the rootful daemon is not found", func() {
+		var runtimeDir string
+		BeforeEach(func() {
+			runtimeDir = GinkgoT().TempDir()
+			GinkgoT().Setenv("DOCKER_HOST", "")
+			GinkgoT().Setenv("XDG_RUNTIME_DIR", runtimeDir)
+		})
+		It("should use the rootless daemon of the user", func() {
+			sock := filepath.Join(runtimeDir, "docker.sock")
+			Expect(os.WriteFile(sock, nil, 0600)).To(Succeed())
+			host, ok := rootlessHost(filepath.Join(runtimeDir, "missing.sock"))
+			Expect(ok).To(BeTrue())
+			Expect(host).To(Equal("unix://" + sock))
+
+			// The rootful daemon takes precedence.
+			_, ok = rootlessHost(sock)
+			Expect(ok).To(BeFalse())
+		})
+		It("should respect DOCKER_HOST", func() {
+			Expect(os.WriteFile(filepath.Join(runtimeDir, "docker.sock"), nil, 0600)).To(Succeed())
+			GinkgoT().Setenv("DOCKER_HOST", "tcp://localhost:2375")
+			_, ok := rootlessHost(filepath.Join(runtimeDir, "missing.sock"))
+			Expect(ok).To(BeFalse())
+		})
+	})
+	When("the docker daemon is rootless", func() {
+		It("should use the rootless buildkitd image", func() {
+			tcs := []struct {
+				tag      string
+				expected string
+			}{
+				{"docker.io/moby/buildkit:v0.10.3", "docker.io/moby/buildkit:v0.10.3-rootless"},
+				{"moby/buildkit", "moby/buildkit:rootless"},
+				{"localhost:5000/buildkit", "localhost:5000/buildkit:rootless"},
+				{"moby/buildkit:rootless", "moby/buildkit:rootless"},
+			}
+			for _, tc := range tcs {
+				Expect(RootlessImage(tc.tag)).To(Equal(tc.expected))
+			}
+		})
+		It("should start the buildkitd without the privileges", func() {
+			config, hostConfig := buildkitdConfig("moby/buildkit:v0.10.3", "", true)
+			Expect(config.Image).To(Equal("moby/buildkit:v0.10.3-rootless"))
+			Expect(config.Cmd).To(ConsistOf("--oci-worker-no-process-sandbox"))
+			Expect(hostConfig.Privileged).To(BeFalse())
+			Expect(hostConfig.SecurityOpt).To(ContainElement("seccomp=unconfined"))
+
+			config, _ = buildkitdConfig("moby/buildkit:v0.10.3", "https://mirror", true)
+			Expect(config.Cmd).To(BeEmpty())
+			Expect(config.Entrypoint[2]).To(ContainSubstring(rootlessBuildkitdConfigDir))
+			Expect(config.Entrypoint[2]).To(HaveSuffix("rootlesskit buildkitd --oci-worker-no-process-sandbox"))
+		})
+		It("should start the privileged buildkitd otherwise", func() {
+			config, hostConfig := buildkitdConfig("moby/buildkit:v0.10.3", "", false)
+			Expect(config.Image).To(Equal("moby/buildkit:v0.10.3"))
+			Expect(hostConfig.Privileged).To(BeTrue())
+		})
+	})
 })
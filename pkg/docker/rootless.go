@@ -0,0 +1,125 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	// defaultSocket is the socket of the rootful docker daemon.
+	defaultSocket = "/var/run/docker.sock"
+	// rootlessSecurityOption is reported in the info of the rootless daemon.
+	rootlessSecurityOption = "name=rootless"
+	// rootlessSuffix is the suffix of the rootless buildkitd image tag.
+	rootlessSuffix = "rootless"
+	// rootlessBuildkitdConfigDir is the config dir of the user in the
+	// rootless buildkitd image.
+	rootlessBuildkitdConfigDir = "/home/user/.config/buildkit"
+)
+
+// RootlessHost returns the address of the rootless docker daemon of the
+// current user. It is only used if DOCKER_HOST is not set and the rootful
+// daemon is not found, see https://docs.docker.com/engine/security/rootless/
+func RootlessHost() (string, bool) {
+	return rootlessHost(defaultSocket)
+}
+
+func rootlessHost(socket string) (string, bool) {
+	if os.Getenv("DOCKER_HOST") != "" {
+		return "", false
+	}
+	if _, err := os.Stat(socket); err == nil {
+		return "", false
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	rootless := filepath.Join(dir, "docker.sock")
+	if _, err := os.Stat(rootless); err != nil {
+		return "", false
+	}
+	return "unix://" + rootless, true
+}
+
+// Rootless returns true if the docker daemon runs in the user namespace.
+func (c generalClient) Rootless(ctx context.Context) (bool, error) {
+	info, err := c.Info(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get the docker info")
+	}
+	for _, opt := range info.SecurityOptions {
+		if opt == rootlessSecurityOption {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RootlessImage returns the rootless variant of the buildkitd image, e.g.
+// moby/buildkit:v0.10.3-rootless for moby/buildkit:v0.10.3.
+func RootlessImage(tag string) string {
+	if strings.HasSuffix(tag, rootlessSuffix) {
+		return tag
+	}
+	if i := strings.LastIndex(tag, ":"); i > strings.LastIndex(tag, "/") {
+		return tag + "-" + rootlessSuffix
+	}
+	return tag + ":" + rootlessSuffix
+}
+
+// buildkitdConfig returns the configs of the buildkitd container. The
+// rootless buildkitd runs without the privileges and the process sandbox,
+// see https://github.com/moby/buildkit/blob/master/docs/rootless.md
+func buildkitdConfig(tag, mirror string, rootless bool) (
+	*container.Config, *container.HostConfig) {
+	config := &container.Config{
+		Image: tag,
+	}
+	hostConfig := &container.HostConfig{
+		Privileged: true,
+	}
+	configDir, cmd := "/etc/buildkit", "buildkitd"
+	if rootless {
+		config.Image = RootlessImage(tag)
+		config.Cmd = []string{"--oci-worker-no-process-sandbox"}
+		hostConfig = &container.HostConfig{
+			SecurityOpt: []string{"seccomp=unconfined", "apparmor=unconfined"},
+		}
+		configDir, cmd = rootlessBuildkitdConfigDir,
+			"rootlesskit buildkitd --oci-worker-no-process-sandbox"
+	}
+	if mirror != "" {
+		cfg := fmt.Sprintf(`
+[registry."docker.io"]
+	mirrors = ["%s"]`, mirror)
+		config.Entrypoint = []string{
+			"/bin/sh",
+			"-c",
+			fmt.Sprintf("mkdir -p %s && echo '%s' > %s/buildkitd.toml && exec %s",
+				configDir, cfg, configDir, cmd),
+		}
+		config.Cmd = nil
+	}
+	return config, hostConfig
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vscode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Marketplace resolves the vscode plugins to their download urls, thus the
+// plugins can be downloaded from Open VSX, the Microsoft marketplace or the
+// internal mirrors of them.
+type Marketplace interface {
+	// Resolve returns the release of the plugin. The latest version is
+	// resolved if the plugin is not pinned.
+	Resolve(ctx context.Context, p Plugin) (Release, error)
+}
+
+// Release is the version of the plugin in the marketplace.
+type Release struct {
+	Version string
+	URL     string
+	// SHA256 is the digest of the vsix file, it is empty if the marketplace
+	// does not provide it.
+	SHA256 string
+}
+
+// NewMarketplace returns the marketplace of the vendor. The url overrides
+// the default endpoint of the vendor, e.g. the internal Open VSX mirror.
+// The requests are sent by the client, e.g. through the proxy.
+func NewMarketplace(vendor MarketplaceVendor, url string, client *http.Client) (Marketplace, error) {
+	url = strings.TrimSuffix(url, "/")
+	switch vendor {
+	case MarketplaceVendorOpenVSX:
+		if url == "" {
+			url = defaultOpenVSXURL
+		}
+		return openVSX{url: url, client: client}, nil
+	case MarketplaceVendorVSCode:
+		return vscodeMarketplace{url: url}, nil
+	default:
+		return nil, errors.Errorf("unknown marketplace vendor %s", vendor)
+	}
+}
+
+// openVSX resolves the plugins by the API of Open VSX, see
+// https://open-vsx.org/swagger-ui/index.html.
+type openVSX struct {
+	url    string
+	client *http.Client
+}
+
+func (m openVSX) Resolve(ctx context.Context, p Plugin) (Release, error) {
+	// Refer to https://github.com/tensorchord/envd/issues/161#issuecomment-1129475975
+	version := pluginLatest
+	if p.Version != nil {
+		version = *p.Version
+	}
+	url := fmt.Sprintf("%s/api/%s/%s/%s", m.url, p.Publisher, p.Extension, version)
+	if p.Platform != "" {
+		url = fmt.Sprintf("%s/api/%s/%s/%s/%s", m.url, p.Publisher, p.Extension, p.Platform, version)
+	}
+	body, err := httpGet(ctx, m.client, url)
+	if err != nil {
+		return Release{}, errors.Wrapf(err, "failed to get the version %s", version)
+	}
+	defer body.Close()
+	var extension struct {
+		Version string `json:"version"`
+		Files   struct {
+			Download string `json:"download"`
+			SHA256   string `json:"sha256"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(body).Decode(&extension); err != nil {
+		return Release{}, errors.Wrap(err, "failed to decode response")
+	}
+	if extension.Files.Download == "" {
+		return Release{}, errors.Errorf("failed to get the version %s: no download url", version)
+	}
+	release := Release{Version: extension.Version, URL: extension.Files.Download}
+	if extension.Files.SHA256 != "" {
+		if release.SHA256, err = m.sha256(ctx, extension.Files.SHA256); err != nil {
+			return Release{}, err
+		}
+	}
+	return release, nil
+}
+
+// sha256 returns the digest in the sha256 file, i.e. the output of
+// sha256sum, the file name after the digest is ignored.
+func (m openVSX) sha256(ctx context.Context, url string) (string, error) {
+	body, err := httpGet(ctx, m.client, url)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get the sha256")
+	}
+	defer body.Close()
+	content, err := io.ReadAll(io.LimitReader(body, 1024))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the sha256")
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 || !sha256Pattern.MatchString(fields[0]) {
+		return "", errors.Errorf("invalid sha256 %q in %s", content, url)
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// vscodeMarketplace downloads the pinned plugins from the Microsoft
+// marketplace, which has no public API to get the latest version.
+type vscodeMarketplace struct {
+	url string
+}
+
+func (m vscodeMarketplace) Resolve(ctx context.Context, p Plugin) (Release, error) {
+	if p.Version == nil {
+		return Release{}, errors.New("version is required for vscode marketplace")
+	}
+	// TODO(gaocegege): Support version auto-detection.
+	url := fmt.Sprintf(vendorVSCodeTemplate,
+		p.Publisher, p.Publisher, p.Extension, *p.Version)
+	if m.url != "" {
+		url = fmt.Sprintf(vendorVSCodeMirrorTemplate,
+			m.url, p.Publisher, p.Extension, *p.Version)
+	}
+	if p.Platform != "" {
+		url = fmt.Sprintf("%s?targetPlatform=%s", url, p.Platform)
+	}
+	return Release{Version: *p.Version, URL: url}, nil
+}
+
+func httpGet(ctx context.Context, client *http.Client, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the request")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("%s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
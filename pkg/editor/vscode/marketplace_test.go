@@ -0,0 +1,94 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vscode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Marketplace", func() {
+	digest := strings.Repeat("ab", 32)
+	var server *httptest.Server
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/redhat/java/latest":
+				fmt.Fprintf(w, `{"version": "1.2.0", "files": {"download": "%[1]s/java-1.2.0.vsix", `+
+					`"sha256": "%[1]s/java-1.2.0.sha256"}}`, server.URL)
+			case "/java-1.2.0.sha256":
+				fmt.Fprintf(w, "%s java-1.2.0.vsix\n", digest)
+			case "/api/redhat/java/1.1.0", "/api/redhat/java/linux-x64/1.1.0":
+				fmt.Fprintf(w, `{"version": "1.1.0", "files": {"download": "%s/java-1.1.0.vsix"}}`, server.URL)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should resolve the plugins in the Open VSX mirror", func() {
+		m, err := NewMarketplace(MarketplaceVendorOpenVSX, server.URL+"/", http.DefaultClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		release, err := m.Resolve(context.Background(), Plugin{Publisher: "redhat", Extension: "java"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(release).To(Equal(Release{
+			Version: "1.2.0",
+			URL:     server.URL + "/java-1.2.0.vsix",
+			SHA256:  digest,
+		}))
+
+		pinned := "1.1.0"
+		for _, platform := range []string{"", "linux-x64"} {
+			release, err = m.Resolve(context.Background(), Plugin{
+				Publisher: "redhat", Extension: "java", Version: &pinned, Platform: platform})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(release).To(Equal(Release{Version: "1.1.0", URL: server.URL + "/java-1.1.0.vsix"}))
+		}
+
+		_, err = m.Resolve(context.Background(), Plugin{Publisher: "redhat", Extension: "unknown"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should require the version in the vscode marketplace", func() {
+		m, err := NewMarketplace(MarketplaceVendorVSCode, "https://marketplace.example.com", http.DefaultClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = m.Resolve(context.Background(), Plugin{Publisher: "ms-python", Extension: "python"})
+		Expect(err).To(HaveOccurred())
+
+		version := "2022.8.0"
+		release, err := m.Resolve(context.Background(), Plugin{
+			Publisher: "ms-python", Extension: "python", Version: &version, Platform: "linux-x64"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(release.SHA256).To(BeEmpty())
+		Expect(release.URL).To(Equal("https://marketplace.example.com/_apis/public/gallery/publishers/" +
+			"ms-python/vsextensions/python/2022.8.0/vspackage?targetPlatform=linux-x64"))
+	})
+
+	It("should reject the unknown vendor", func() {
+		_, err := NewMarketplace("unknown", "", http.DefaultClient)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,224 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vscode
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+const (
+	serverCacheKeyPrefix = "vscode-server"
+	// serverPlatform is the platform of the vscode-server, the environments
+	// are built for linux/amd64 only.
+	serverPlatform = "server-linux-x64"
+	// ServerArchiveRoot is the directory of the vscode-server in the archive.
+	ServerArchiveRoot = "vscode-server-linux-x64"
+)
+
+// serverUpdateURL is the update service of VS Code, which redirects to the
+// archive of the release, and the commit of the release is in the url.
+var serverUpdateURL = "https://update.code.visualstudio.com"
+
+// commitPattern matches the commit of the VS Code release.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Server is the vscode-server of the VS Code release. VS Code downloads it
+// on the first connection if it is not installed in the environment.
+type Server struct {
+	// Version is the VS Code version, e.g. 1.85.1, or the commit of the
+	// release.
+	Version string
+	Commit  string
+}
+
+// ArchivePath returns the path of the archive in the cache directory.
+func (s Server) ArchivePath() string {
+	return fmt.Sprintf("%s-%s/%s.tar.gz", serverCacheKeyPrefix, s.Version, ServerArchiveRoot)
+}
+
+// InstallPath returns the directory of the vscode-server in the home
+// directory, where VS Code looks for the server of the commit.
+func (s Server) InstallPath() string {
+	return filepath.Join(".vscode-server", "cli", "servers", "Stable-"+s.Commit, "server")
+}
+
+// DownloadServerOrCache downloads or caches the vscode-server of the VS Code
+// version, which is cached by the version, thus the cached one is used in
+// the air-gapped builds. It returns true if it is already downloaded.
+func DownloadServerOrCache(ctx context.Context, client *http.Client, version string) (Server, bool, error) {
+	s := Server{Version: strings.TrimSpace(version)}
+	if s.Version == "" {
+		return s, false, errors.New("the vscode version is required")
+	}
+	dir := filepath.Join(home.GetManager().CacheDir(), fmt.Sprintf("%s-%s", serverCacheKeyPrefix, s.Version))
+	commitFile := filepath.Join(dir, "commit")
+	cacheKey := fmt.Sprintf("%s-%s", serverCacheKeyPrefix, s.Version)
+	logger := log.WithFields(log.Fields{
+		"version": s.Version,
+		"cache":   cacheKey,
+	})
+	unlock, err := fileutil.Lock(ctx, cacheKey)
+	if err != nil {
+		return s, false, err
+	}
+	defer unlock()
+	if home.GetManager().Cached(cacheKey) {
+		cached, err := VerifyServerCache(s.Version)
+		if err == nil {
+			logger.Debugf("vscode-server %s already exists in cache", cached.Commit)
+			return cached, true, touchServerCache(cacheKey)
+		}
+		logger.Warnf("the cached vscode-server cannot be verified, downloading it again: %s", err)
+	}
+
+	commit, err := resolveServerCommit(ctx, client, s.Version)
+	if err != nil {
+		return s, false, err
+	}
+	s.Commit = commit
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return s, false, errors.Wrapf(err, "failed to create %s", dir)
+	}
+	url := fmt.Sprintf("%s/commit:%s/%s/stable", serverUpdateURL, s.Commit, serverPlatform)
+	logger.Debugf("downloading vscode-server from %s", url)
+	body, err := httpGet(ctx, client, url)
+	if err != nil {
+		return s, false, errors.Wrap(err, "failed to download vscode-server")
+	}
+	defer body.Close()
+
+	// The archive is downloaded aside and renamed, thus the partial one is
+	// never used.
+	filename := filepath.Join(home.GetManager().CacheDir(), s.ArchivePath())
+	out, err := os.Create(filename + ".tmp")
+	if err != nil {
+		return s, false, err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, body); err != nil {
+		return s, false, errors.Wrap(err, "failed to download vscode-server")
+	}
+	if err := os.Rename(filename+".tmp", filename); err != nil {
+		return s, false, errors.Wrap(err, "failed to rename the archive")
+	}
+	if err := os.WriteFile(commitFile, []byte(s.Commit+"\n"), 0644); err != nil {
+		return s, false, errors.Wrap(err, "failed to record the commit")
+	}
+	if err := home.GetManager().MarkCache(cacheKey, true); err != nil {
+		return s, false, errors.Wrap(err, "failed to update cache status")
+	}
+	return s, false, touchServerCache(cacheKey)
+}
+
+// VerifyServerCache verifies the cached vscode-server of the version, i.e.
+// the recorded commit and the archive, which is read through to detect the
+// truncated download.
+func VerifyServerCache(version string) (Server, error) {
+	s := Server{Version: version}
+	dir := filepath.Join(home.GetManager().CacheDir(), fmt.Sprintf("%s-%s", serverCacheKeyPrefix, s.Version))
+	commit, err := os.ReadFile(filepath.Join(dir, "commit"))
+	if err != nil {
+		return s, errors.Wrap(err, "failed to read the commit")
+	}
+	s.Commit = strings.TrimSpace(string(commit))
+	if !commitPattern.MatchString(s.Commit) {
+		return s, errors.Errorf("invalid commit %s", s.Commit)
+	}
+	f, err := os.Open(filepath.Join(home.GetManager().CacheDir(), s.ArchivePath()))
+	if err != nil {
+		return s, errors.Wrap(err, "failed to open the archive")
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return s, errors.Wrap(err, "failed to read the archive")
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, errors.Wrap(err, "failed to read the archive")
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return s, errors.Wrap(err, "failed to read the archive")
+		}
+	}
+}
+
+// resolveServerCommit returns the commit of the VS Code version, which is
+// in the url redirected by the update service.
+func resolveServerCommit(ctx context.Context, client *http.Client, version string) (string, error) {
+	if commitPattern.MatchString(version) {
+		return version, nil
+	}
+	url := fmt.Sprintf("%s/%s/%s/stable", serverUpdateURL, version, serverPlatform)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create the request")
+	}
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve vscode %s", version)
+	}
+	defer resp.Body.Close()
+	location := resp.Header.Get("Location")
+	for _, segment := range strings.Split(location, "/") {
+		if commitPattern.MatchString(segment) {
+			return segment, nil
+		}
+	}
+	return "", errors.Errorf("failed to resolve vscode %s: %s", version, resp.Status)
+}
+
+// touchServerCache records the access of the cached vscode-server, whose
+// dir is named by the cache key.
+func touchServerCache(cacheKey string) error {
+	if err := home.GetManager().TouchCache(cacheKey, cacheKey); err != nil {
+		return errors.Wrap(err, "failed to update cache index")
+	}
+	return nil
+}
+
+// ServerVersionFromCacheKey returns the version of the vscode-server cached
+// with the key, ok is false if the key is not the one of a vscode-server.
+func ServerVersionFromCacheKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, serverCacheKeyPrefix+"-") {
+		return "", false
+	}
+	return strings.TrimPrefix(key, serverCacheKeyPrefix+"-"), true
+}
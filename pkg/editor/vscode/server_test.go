@@ -0,0 +1,106 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vscode
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tensorchord/envd/pkg/home"
+)
+
+var _ = Describe("Server", func() {
+	commit := strings.Repeat("0123456789", 4)
+	var server *httptest.Server
+	var updateURL string
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/1.85.1/server-linux-x64/stable" {
+				http.Redirect(w, r, "https://download.example.com/stable/"+commit+
+					"/vscode-server-linux-x64.tar.gz", http.StatusFound)
+				return
+			}
+			http.NotFound(w, r)
+		}))
+		updateURL = serverUpdateURL
+		serverUpdateURL = server.URL
+	})
+	AfterEach(func() {
+		serverUpdateURL = updateURL
+		server.Close()
+	})
+
+	It("should resolve the commit of the version", func() {
+		c, err := resolveServerCommit(context.Background(), http.DefaultClient, "1.85.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(Equal(commit))
+
+		c, err = resolveServerCommit(context.Background(), http.DefaultClient, commit)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(Equal(commit))
+
+		_, err = resolveServerCommit(context.Background(), http.DefaultClient, "0.0.1")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should install the server by the commit", func() {
+		s := Server{Version: "1.85.1", Commit: commit}
+		Expect(s.ArchivePath()).To(Equal("vscode-server-1.85.1/vscode-server-linux-x64.tar.gz"))
+		Expect(s.InstallPath()).To(Equal(".vscode-server/cli/servers/Stable-" + commit + "/server"))
+	})
+
+	It("should verify the cached archive", func() {
+		Expect(home.Initialize()).To(Succeed())
+		s := Server{Version: "0.0.0-verify", Commit: commit}
+		archive := filepath.Join(home.GetManager().CacheDir(), s.ArchivePath())
+		Expect(os.MkdirAll(filepath.Dir(archive), 0755)).To(Succeed())
+		DeferCleanup(os.RemoveAll, filepath.Dir(archive))
+		_, err := VerifyServerCache(s.Version)
+		Expect(err).To(HaveOccurred())
+
+		Expect(os.WriteFile(filepath.Join(filepath.Dir(archive), "commit"),
+			[]byte(commit+"\n"), 0644)).To(Succeed())
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		content := bytes.Repeat([]byte("server"), 1024)
+		Expect(tw.WriteHeader(&tar.Header{
+			Name: "server.sh", Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg,
+		})).To(Succeed())
+		_, err = tw.Write(content)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gw.Close()).To(Succeed())
+		Expect(os.WriteFile(archive, buf.Bytes(), 0644)).To(Succeed())
+		cached, err := VerifyServerCache(s.Version)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(Equal(s))
+
+		// The truncated download is detected.
+		Expect(os.WriteFile(archive, buf.Bytes()[:buf.Len()/2], 0644)).To(Succeed())
+		_, err = VerifyServerCache(s.Version)
+		Expect(err).To(HaveOccurred())
+	})
+})
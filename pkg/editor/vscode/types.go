@@ -17,8 +17,12 @@ package vscode
 import "fmt"
 
 const (
-	vendorVSCodeTemplate  = "https://%s.gallery.vsassets.io/_apis/public/gallery/publisher/%s/extension/%s/%s/assetbyname/Microsoft.VisualStudio.Services.VSIXPackage"
-	vendorOpenVSXTemplate = "https://open-vsx.org/api/%s/%s/latest"
+	vendorVSCodeTemplate = "https://%s.gallery.vsassets.io/_apis/public/gallery/publisher/%s/extension/%s/%s/assetbyname/Microsoft.VisualStudio.Services.VSIXPackage"
+	// vendorVSCodeMirrorTemplate is the vspackage API of the marketplace,
+	// which is served by the mirrors of marketplace.visualstudio.com.
+	vendorVSCodeMirrorTemplate = "%s/_apis/public/gallery/publishers/%s/vsextensions/%s/%s/vspackage"
+
+	defaultOpenVSXURL = "https://open-vsx.org"
 )
 
 type MarketplaceVendor string
@@ -28,15 +32,31 @@ const (
 	MarketplaceVendorOpenVSX MarketplaceVendor = "openvsx"
 )
 
+// Plugin is the vscode plugin parsed by ParsePlugin.
 type Plugin struct {
 	Publisher string
 	Extension string
 	Version   *string
+	// Platform is the target platform, e.g. linux-x64. It is empty for
+	// the platform-independent plugins.
+	Platform string
+	// SHA256 is the expected digest of the vsix, e.g. in envd.lock.
+	SHA256 string `json:"SHA256,omitempty"`
 }
 
 func (p Plugin) String() string {
+	s := fmt.Sprintf("%s.%s", p.Publisher, p.Extension)
 	if p.Version != nil {
-		return fmt.Sprintf("%s.%s-%s", p.Publisher, p.Extension, *p.Version)
+		s = fmt.Sprintf("%s-%s", s, *p.Version)
+	}
+	if p.Platform != "" {
+		s = fmt.Sprintf("%s@%s", s, p.Platform)
 	}
-	return fmt.Sprintf("%s.%s", p.Publisher, p.Extension)
+	return s
+}
+
+// ID returns the plugin without the version, e.g. ms-python.python@linux-x64.
+func (p Plugin) ID() string {
+	p.Version = nil
+	return p.String()
 }
@@ -15,84 +15,76 @@
 package vscode
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"net/http"
-	"strconv"
+	"regexp"
 	"strings"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd/pkg/log"
 )
 
-func GetLatestVersionURL(p Plugin) (string, error) {
-	// Auto-detect the version.
-	// Refer to https://github.com/tensorchord/envd/issues/161#issuecomment-1129475975
-	latestURL := fmt.Sprintf(vendorOpenVSXTemplate, p.Publisher, p.Extension)
-	resp, err := http.Get(latestURL)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to get latest version")
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.Errorf("failed to get latest version: %s", resp.Status)
-	}
-	jsonResp := make(map[string]interface{})
-	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
-		return "", errors.Wrap(err, "failed to decode response")
-	}
-	if jsonResp["files"] == nil {
-		return "", errors.New("failed to get latest version: no files")
-	}
-	files := jsonResp["files"].(map[string]interface{})
-	if files["download"] == nil {
-		return "", errors.New("failed to get latest version: no download url")
-	}
-	return files["download"].(string), nil
+// GetLatestVersionURL returns the download url of the latest version of
+// the plugin in Open VSX.
+func GetLatestVersionURL(ctx context.Context, p Plugin) (string, error) {
+	p.Version = nil
+	release, err := openVSX{url: defaultOpenVSXURL, client: http.DefaultClient}.Resolve(ctx, p)
+	return release.URL, err
 }
 
+// pluginRegexp matches publisher.extension[-version|@version|@latest][@platform],
+// e.g. ms-python.python-2021.12.1559732655@linux-x64 or
+// ms-python.python@2023.4.1. The extension is matched lazily, thus the
+// trailing -version is not a part of it.
+var pluginRegexp = regexp.MustCompile(
+	`^([a-z0-9][a-z0-9-]*)\.([a-z0-9][a-z0-9-]*?)` +
+		`(?:-([0-9]+(?:\.[0-9]+)*)|@([0-9]+(?:\.[0-9]+)*|latest))?(?:@([a-z0-9-]+))?$`)
+
+// sha256Pattern matches the hex sha256 digest.
+var sha256Pattern = regexp.MustCompile(`^[A-Fa-f0-9]{64}$`)
+
+// pluginLatest resolves the plugin to the latest version in the marketplace,
+// the same as the plugin without the version.
+const pluginLatest = "latest"
+
+// platforms are the target platforms supported by the marketplaces.
+var platforms = map[string]bool{
+	"win32-x64": true, "win32-ia32": true, "win32-arm64": true,
+	"linux-x64": true, "linux-arm64": true, "linux-armhf": true,
+	"alpine-x64": true, "alpine-arm64": true,
+	"darwin-x64": true, "darwin-arm64": true,
+	"web": true, "universal": true,
+}
+
+// ParsePlugin parses the plugin ID publisher.extension[-version|@version|@latest][@platform].
+// The publisher and the extension are case-insensitive, thus they are lowercased.
 func ParsePlugin(p string) (*Plugin, error) {
-	indexPublisher := strings.Index(p, ".")
-	if indexPublisher == -1 {
-		return nil, errors.New("invalid publisher")
+	matches := pluginRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(p)))
+	if matches == nil {
+		return nil, errors.Newf("invalid vscode plugin %q, expected "+
+			"publisher.extension[-version|@version|@latest][@platform]", p)
 	}
-	publisher := p[:indexPublisher]
-
-	indexExtension := strings.LastIndex(p[indexPublisher:], "-")
-	if indexExtension == -1 {
-		extension := p[indexPublisher+1:]
-		logrus.WithFields(logrus.Fields{
-			"publisher": publisher,
-			"extension": extension,
-		}).Debug("vscode plugin is parsed without version")
-		return &Plugin{
-			Publisher: publisher,
-			Extension: extension,
-		}, nil
+	plugin := &Plugin{
+		Publisher: matches[1],
+		Extension: matches[2],
+		Platform:  matches[5],
 	}
-
-	indexExtension = indexPublisher + indexExtension
-	extension := p[indexPublisher+1 : indexExtension]
-	version := p[indexExtension+1:]
-	if _, err := strconv.Atoi(version[0:1]); err != nil {
-		extension := p[indexPublisher+1:]
-		logrus.WithFields(logrus.Fields{
-			"publisher": publisher,
-			"extension": extension,
-		}).Debug("vscode plugin is parsed without version")
-		return &Plugin{
-			Publisher: publisher,
-			Extension: extension,
-		}, nil
+	version := matches[3]
+	if matches[4] != pluginLatest {
+		version += matches[4]
+	}
+	if version != "" {
+		plugin.Version = &version
+	}
+	if plugin.Platform != "" && !platforms[plugin.Platform] {
+		return nil, errors.Newf("invalid platform %s of vscode plugin %s", plugin.Platform, p)
 	}
-	logrus.WithFields(logrus.Fields{
-		"publisher": publisher,
-		"extension": extension,
-		"version":   version,
+	log.WithFields(log.Fields{
+		"publisher": plugin.Publisher,
+		"extension": plugin.Extension,
+		"version":   plugin.Version,
+		"platform":  plugin.Platform,
 	}).Debug("vscode plugin is parsed")
-	return &Plugin{
-		Publisher: publisher,
-		Extension: extension,
-		Version:   &version,
-	}, nil
+	return plugin, nil
 }
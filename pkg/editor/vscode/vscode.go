@@ -15,15 +15,23 @@
 package vscode
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 
+	"github.com/tensorchord/envd/pkg/errdefs"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 	"github.com/tensorchord/envd/pkg/util/ziputil"
 )
 
@@ -32,85 +40,237 @@ const (
 )
 
 type Client interface {
-	DownloadOrCache(plugin Plugin) (bool, error)
+	// Resolve pins the plugin to the latest version in the marketplace if
+	// it is not pinned, with the digest provided by the marketplace.
+	Resolve(ctx context.Context, plugin Plugin) (Plugin, error)
+	DownloadOrCache(ctx context.Context, plugin Plugin) (Plugin, bool, error)
+	// Refresh updates the cached plugin to the latest version.
+	Refresh(ctx context.Context, plugin Plugin) (bool, error)
+	// PluginPath returns the path of the unzipped plugin in the cache
+	// directory, the plugins in the vsix directory are unzipped there too.
 	PluginPath(p Plugin) string
+	// Dependencies returns the extensionDependencies and the extensionPack
+	// of the downloaded plugin.
+	Dependencies(p Plugin) ([]Plugin, error)
 }
 
 type generalClient struct {
-	vendor MarketplaceVendor
-	logger *logrus.Entry
+	vendor      MarketplaceVendor
+	marketplace Marketplace
+	// vsixDir is the local directory of the vsix files, which are used
+	// before the marketplace, e.g. for the air-gapped installs.
+	vsixDir    string
+	httpClient *http.Client
+	logger     *log.Entry
 }
 
-func NewClient(vendor MarketplaceVendor) (Client, error) {
-	switch vendor {
-	case MarketplaceVendorOpenVSX:
-		return &generalClient{
-			vendor: vendor,
-			logger: logrus.WithField("vendor", MarketplaceVendorOpenVSX),
-		}, nil
-	case MarketplaceVendorVSCode:
-		return &generalClient{
-			vendor: vendor,
-			logger: logrus.WithField("vendor", MarketplaceVendorVSCode),
-		}, nil
-	default:
-		return nil, errors.Errorf("unknown marketplace vendor %s", vendor)
+// NewClient returns the client which downloads the plugins from the
+// marketplace of the vendor, the url overrides its default endpoint. The
+// plugins in the vsix directory are used first if it is not empty.
+func NewClient(vendor MarketplaceVendor, url, vsixDir string, httpClient *http.Client) (Client, error) {
+	marketplace, err := NewMarketplace(vendor, url, httpClient)
+	if err != nil {
+		return nil, err
 	}
+	return &generalClient{
+		vendor:      vendor,
+		marketplace: marketplace,
+		vsixDir:     vsixDir,
+		httpClient:  httpClient,
+		logger:      log.WithField("vendor", vendor),
+	}, nil
 }
 
 func (c generalClient) PluginPath(p Plugin) string {
-	if p.Version != nil {
-		return fmt.Sprintf("%s.%s-%s/extension/", p.Publisher, p.Extension, *p.Version)
+	return fmt.Sprintf("%s/extension/", p)
+}
 
+func unzipPath(p Plugin) string {
+	return fmt.Sprintf("%s/%s", home.GetManager().CacheDir(), p)
+}
+
+// touchCache records the access of the cached plugin, i.e. the unzipped
+// dir, the vsix and its digest, thus it can be evicted by envd cache gc.
+func touchCache(cacheKey string, p Plugin) error {
+	if err := home.GetManager().TouchCache(cacheKey,
+		p.String(), p.String()+vsixExt, p.String()+vsixExt+".sha256"); err != nil {
+		return errors.Wrap(err, "failed to update cache index")
 	}
-	return fmt.Sprintf("%s.%s/extension/", p.Publisher, p.Extension)
+	return nil
 }
 
-func unzipPath(p Plugin) string {
-	if p.Version != nil {
-		return fmt.Sprintf("%s/%s.%s-%s", home.GetManager().CacheDir(),
-			p.Publisher, p.Extension, *p.Version)
+// Resolve pins the plugin to the latest version in the marketplace if it
+// is not pinned, and the digest of the vsix is set if the marketplace
+// provides it. The plugin in the vsix directory takes precedence.
+func (c generalClient) Resolve(ctx context.Context, p Plugin) (Plugin, error) {
+	filename, local, err := c.findVSIX(p)
+	if err != nil {
+		return p, err
+	}
+	if filename != "" {
+		local.SHA256, err = fileSHA256(filename)
+		return local, err
+	}
+	release, err := c.resolve(ctx, p)
+	if err != nil {
+		return p, err
+	}
+	p.Version = &release.Version
+	p.SHA256 = release.SHA256
+	return p, nil
+}
+
+// findVSIX finds the plugin in the vsix directory, it returns the empty
+// path if the directory is not set or the plugin is not found.
+func (c generalClient) findVSIX(p Plugin) (string, Plugin, error) {
+	if c.vsixDir == "" {
+		return "", p, nil
+	}
+	filename, local, err := findVSIX(c.vsixDir, p)
+	if err == nil && filename == "" {
+		c.logger.Debugf("vscode plugin %s is not found in %s, using the marketplace", p, c.vsixDir)
 	}
-	return fmt.Sprintf("%s/%s.%s", home.GetManager().CacheDir(),
-		p.Publisher, p.Extension)
+	return filename, local, err
 }
 
-// DownloadOrCache downloads or cache the plugin.
-// If the plugin is already downloaded, it returns true.
-func (c generalClient) DownloadOrCache(p Plugin) (bool, error) {
+func (c generalClient) resolve(ctx context.Context, p Plugin) (Release, error) {
+	if c.vendor == MarketplaceVendorVSCode && p.Version == nil {
+		return Release{}, errors.New("version is required for vscode marketplace")
+	}
+	release, err := c.marketplace.Resolve(ctx, p)
+	if err != nil {
+		return Release{}, errdefs.Wrap(errors.Wrap(err, "failed to get the download url"),
+			errdefs.MarketplaceUnavailable)
+	}
+	return release, nil
+}
+
+// DownloadOrCache downloads or cache the plugin, which is cached by the
+// exact version, thus the plugin without the version is resolved to the
+// latest one first. The vsix is verified against the digest of the plugin,
+// e.g. in envd.lock, and the one provided by the marketplace, and the
+// corrupted cache is downloaded again. It returns the pinned plugin, and
+// true if the plugin is already downloaded.
+func (c generalClient) DownloadOrCache(ctx context.Context, p Plugin) (Plugin, bool, error) {
+	filename, local, err := c.findVSIX(p)
+	if err != nil {
+		return p, false, err
+	}
+	if filename != "" {
+		return installVSIX(ctx, filename, local)
+	}
+
+	var release *Release
+	if p.Version == nil {
+		r, err := c.resolve(ctx, p)
+		if err != nil {
+			return p, false, err
+		}
+		release = &r
+		p.Version = &r.Version
+		if p.SHA256 == "" {
+			p.SHA256 = r.SHA256
+		}
+	}
 	cacheKey := fmt.Sprintf("%s-%s", cacheKeyPrefix, p)
+	unlock, err := fileutil.Lock(ctx, cacheKey)
+	if err != nil {
+		return p, false, err
+	}
+	defer unlock()
 	if home.GetManager().Cached(cacheKey) {
-		logrus.WithFields(logrus.Fields{
-			"cache": cacheKey,
-		}).Debugf("vscode plugin %s already exists in cache", p)
-		return true, nil
+		err := VerifyCache(p)
+		if err == nil {
+			log.WithFields(log.Fields{
+				"cache": cacheKey,
+			}).Debugf("vscode plugin %s already exists in cache", p)
+			return p, true, touchCache(cacheKey, p)
+		}
+		log.Warnf("vscode plugin %s in the cache cannot be verified, downloading it again: %s", p, err)
 	}
 
-	var url, filename string
-	if c.vendor == MarketplaceVendorVSCode {
-		if p.Version == nil {
-			return false, errors.New("version is required for vscode marketplace")
-		}
-		// TODO(gaocegege): Support version auto-detection.
-		url = fmt.Sprintf(vendorVSCodeTemplate,
-			p.Publisher, p.Publisher, p.Extension, *p.Version)
-		filename = fmt.Sprintf("%s/%s.%s-%s.vsix", home.GetManager().CacheDir(),
-			p.Publisher, p.Extension, *p.Version)
-	} else {
-		var err error
-		url, err = GetLatestVersionURL(p)
+	if release == nil {
+		r, err := c.resolve(ctx, p)
 		if err != nil {
-			return false, errors.Wrap(err, "failed to get latest version url")
+			return p, false, err
 		}
-		filename = fmt.Sprintf("%s/%s.%s.vsix", home.GetManager().CacheDir(),
-			p.Publisher, p.Extension)
+		release = &r
+	}
+	if err := c.download(ctx, p, *release, unzipPath(p)); err != nil {
+		return p, false, err
+	}
+	if err := home.GetManager().MarkCache(cacheKey, true); err != nil {
+		return p, false, errors.Wrap(err, "failed to update cache status")
 	}
+	if err := touchCache(cacheKey, p); err != nil {
+		return p, false, err
+	}
+	if p.SHA256 == "" {
+		p.SHA256 = release.SHA256
+	}
+	return p, false, nil
+}
 
-	logger := logrus.WithFields(logrus.Fields{
+// Refresh updates the plugin cached without the version by the previous
+// envd if there is a newer version in Open VSX. The plugins with the pinned
+// versions are never updated, thus the builds are still deterministic. It
+// returns true if it is updated.
+func (c generalClient) Refresh(ctx context.Context, p Plugin) (bool, error) {
+	if p.Version != nil || c.vendor != MarketplaceVendorOpenVSX {
+		return false, nil
+	}
+	logger := c.logger.WithField("plugin", p.String())
+	unlock, err := fileutil.Lock(ctx, fmt.Sprintf("%s-%s", cacheKeyPrefix, p))
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	current, err := cachedVersion(p)
+	if err != nil {
+		return false, err
+	}
+	latest, err := c.marketplace.Resolve(ctx, p)
+	if err != nil {
+		return false, errdefs.Wrap(errors.Wrap(err, "failed to get latest version"),
+			errdefs.MarketplaceUnavailable)
+	}
+	if current == latest.Version {
+		logger.Debugf("vscode plugin is up to date: %s", current)
+		return false, nil
+	}
+
+	// The plugin is downloaded aside and then replaces the cached one, thus
+	// the concurrent builds never see the partial plugin.
+	dir := unzipPath(p)
+	tmp := dir + ".refresh"
+	if err := os.RemoveAll(tmp); err != nil {
+		return false, errors.Wrapf(err, "failed to remove %s", tmp)
+	}
+	if err := c.download(ctx, p, latest, tmp); err != nil {
+		return false, err
+	}
+	if err := fileutil.ReplaceDir(tmp, dir); err != nil {
+		return false, err
+	}
+	for _, ext := range []string{".vsix", ".vsix.sha256"} {
+		if err := os.Rename(tmp+ext, dir+ext); err != nil {
+			return false, errors.Wrapf(err, "failed to rename the %s file", ext)
+		}
+	}
+	logger.Debugf("vscode plugin is updated from %s to %s", current, latest.Version)
+	return true, nil
+}
+
+// download downloads the plugin from the url of the release, verifies it
+// and unzips it into the dir. The digest is recorded aside the vsix, thus
+// the cache can be verified later.
+func (c generalClient) download(ctx context.Context, p Plugin, release Release, dir string) error {
+	filename := dir + ".vsix"
+	logger := log.WithFields(log.Fields{
 		"publisher": p.Publisher,
 		"extension": p.Extension,
 		"version":   p.Version,
-		"url":       url,
+		"url":       release.URL,
 		"file":      filename,
 	})
 
@@ -118,29 +278,161 @@ func (c generalClient) DownloadOrCache(p Plugin) (bool, error) {
 	out, err := os.Create(filename)
 
 	if err != nil {
-		return false, err
+		return err
 	}
 	defer out.Close()
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, release.URL, nil)
 	if err != nil {
-		return false, err
+		return errors.Wrap(err, "failed to create the request")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errdefs.Wrap(err, errdefs.MarketplaceUnavailable)
 	}
 	logger.Debugf("downloading vscode plugin")
 
 	defer resp.Body.Close()
-	_, err = io.Copy(out, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errdefs.Wrap(
+			errors.Errorf("failed to download vscode plugin %s: %s", p, resp.Status),
+			errdefs.MarketplaceUnavailable)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), resp.Body)
 	if err != nil {
-		return false, err
+		return err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	for _, expected := range []string{p.SHA256, release.SHA256} {
+		if expected != "" && !strings.EqualFold(expected, digest) {
+			os.Remove(filename)
+			return errors.Errorf("the sha256 of vscode plugin %s is %s, expected %s",
+				p, digest, expected)
+		}
+	}
+	if err := os.WriteFile(filename+".sha256", []byte(digest+"\n"), 0644); err != nil {
+		return errors.Wrap(err, "failed to record the sha256")
 	}
 
-	_, err = ziputil.Unzip(filename, unzipPath(p))
+	_, err = ziputil.Unzip(filename, dir)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to unzip")
+		return errors.Wrap(err, "failed to unzip")
 	}
+	return nil
+}
 
-	if err := home.GetManager().MarkCache(cacheKey, true); err != nil {
-		return false, errors.Wrap(err, "failed to update cache status")
+// VerifyCache verifies the cached vsix against the digest of the plugin,
+// or the one recorded when it was downloaded, and the unzipped manifest.
+func VerifyCache(p Plugin) error {
+	filename := unzipPath(p) + ".vsix"
+	expected := p.SHA256
+	if expected == "" {
+		recorded, err := os.ReadFile(filename + ".sha256")
+		if err != nil {
+			return errors.Wrap(err, "failed to read the recorded sha256")
+		}
+		expected = strings.TrimSpace(string(recorded))
+	}
+	digest, err := fileSHA256(filename)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(digest, expected) {
+		return errors.Errorf("the sha256 is %s, expected %s", digest, expected)
+	}
+	if _, err := cachedVersion(p); err != nil {
+		return err
+	}
+	return nil
+}
+
+// manifest is the package.json of the plugin.
+type manifest struct {
+	Version               string   `json:"version"`
+	ExtensionDependencies []string `json:"extensionDependencies"`
+	ExtensionPack         []string `json:"extensionPack"`
+}
+
+// readManifest reads the manifest of the cached plugin.
+func readManifest(p Plugin) (manifest, error) {
+	m := manifest{}
+	filename := filepath.Join(unzipPath(p), "extension", "package.json")
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return m, errors.Wrapf(err, "failed to read the manifest of vscode plugin %s", p)
+	}
+	if err := json.Unmarshal(content, &m); err != nil {
+		return m, errors.Wrapf(err, "failed to parse the manifest of vscode plugin %s", p)
+	}
+	return m, nil
+}
+
+// cachedVersion returns the version in the manifest of the cached plugin.
+func cachedVersion(p Plugin) (string, error) {
+	m, err := readManifest(p)
+	if err != nil {
+		return "", err
+	}
+	return m.Version, nil
+}
+
+// builtinPublisher is the publisher of the plugins bundled in vscode, e.g.
+// vscode.git, which are never downloaded.
+const builtinPublisher = "vscode"
+
+// Dependencies returns the plugins in the extensionDependencies and the
+// extensionPack of the downloaded plugin, without the versions. The
+// plugins bundled in vscode are excluded.
+func (c generalClient) Dependencies(p Plugin) ([]Plugin, error) {
+	m, err := readManifest(p)
+	if err != nil {
+		return nil, err
+	}
+	return parseDependencies(m)
+}
+
+func parseDependencies(m manifest) ([]Plugin, error) {
+	deps := []Plugin{}
+	seen := map[string]bool{}
+	for _, id := range append(m.ExtensionDependencies, m.ExtensionPack...) {
+		dep, err := ParsePlugin(id)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse the dependency")
+		}
+		if dep.Publisher == builtinPublisher || seen[dep.ID()] {
+			continue
+		}
+		seen[dep.ID()] = true
+		deps = append(deps, *dep)
+	}
+	return deps, nil
+}
+
+// CachedPlugins returns the plugins in the cache.
+func CachedPlugins() ([]Plugin, error) {
+	plugins := []Plugin{}
+	for _, key := range home.GetManager().CachedKeys() {
+		p, ok, err := PluginFromCacheKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			plugins = append(plugins, *p)
+		}
+	}
+	return plugins, nil
+}
+
+// PluginFromCacheKey returns the plugin cached with the key, ok is false if
+// the key is not the one of a vscode plugin.
+func PluginFromCacheKey(key string) (*Plugin, bool, error) {
+	if !strings.HasPrefix(key, cacheKeyPrefix+"-") {
+		return nil, false, nil
+	}
+	p, err := ParsePlugin(strings.TrimPrefix(key, cacheKeyPrefix+"-"))
+	if err != nil {
+		return nil, false, err
 	}
-	return false, nil
+	return p, true, nil
 }
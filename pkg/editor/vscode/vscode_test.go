@@ -15,6 +15,8 @@
 package vscode
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -22,7 +24,7 @@ import (
 var _ = Describe("Visual Studio Code", func() {
 	Describe("Plugin", func() {
 		It("should get the latest version successfully", func() {
-			url, err := GetLatestVersionURL(Plugin{
+			url, err := GetLatestVersionURL(context.Background(), Plugin{
 				Publisher: "redhat",
 				Extension: "java",
 			})
@@ -35,6 +37,7 @@ var _ = Describe("Visual Studio Code", func() {
 				expectedExtension string
 				expectedVersion   string
 				expectedPublisher string
+				expectedPlatform  string
 				expectedErr       bool
 			}{
 				{
@@ -72,10 +75,65 @@ var _ = Describe("Visual Studio Code", func() {
 					expectedVersion:   "",
 					expectedErr:       false,
 				},
+				{
+					name:              "MS-Python.Python-2022.1.0@linux-x64",
+					expectedPublisher: "ms-python",
+					expectedExtension: "python",
+					expectedVersion:   "2022.1.0",
+					expectedPlatform:  "linux-x64",
+					expectedErr:       false,
+				},
+				{
+					name:              "ms-python.vscode-pylance@linux-arm64",
+					expectedPublisher: "ms-python",
+					expectedExtension: "vscode-pylance",
+					expectedPlatform:  "linux-arm64",
+					expectedErr:       false,
+				},
+				{
+					name:              "ms-python.python@2023.4.1",
+					expectedPublisher: "ms-python",
+					expectedExtension: "python",
+					expectedVersion:   "2023.4.1",
+					expectedErr:       false,
+				},
+				{
+					name:              "ms-python.python@latest",
+					expectedPublisher: "ms-python",
+					expectedExtension: "python",
+					expectedErr:       false,
+				},
+				{
+					name:              "ms-python.python@2023.4.1@linux-x64",
+					expectedPublisher: "ms-python",
+					expectedExtension: "python",
+					expectedVersion:   "2023.4.1",
+					expectedPlatform:  "linux-x64",
+					expectedErr:       false,
+				},
+				{
+					name:              "ms-python.python@latest@linux-x64",
+					expectedPublisher: "ms-python",
+					expectedExtension: "python",
+					expectedPlatform:  "linux-x64",
+					expectedErr:       false,
+				},
 				{
 					name:        "test",
 					expectedErr: true,
 				},
+				{
+					name:        "ms-python.",
+					expectedErr: true,
+				},
+				{
+					name:        "ms-python.python-1.0@unknown-os",
+					expectedErr: true,
+				},
+				{
+					name:        "ms python.python",
+					expectedErr: true,
+				},
 			}
 			for _, tc := range tcs {
 				p, err := ParsePlugin(tc.name)
@@ -85,12 +143,29 @@ var _ = Describe("Visual Studio Code", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Expect(p.Publisher).To(Equal(tc.expectedPublisher))
 					Expect(p.Extension).To(Equal(tc.expectedExtension))
+					Expect(p.Platform).To(Equal(tc.expectedPlatform))
 					if tc.expectedVersion != "" {
 						Expect(p.Version).NotTo(BeNil())
 						Expect(*p.Version).To(Equal(tc.expectedVersion))
+					} else {
+						Expect(p.Version).To(BeNil())
 					}
 				}
 			}
 		})
+		It("should parse the dependencies and the extension pack", func() {
+			deps, err := parseDependencies(manifest{
+				ExtensionDependencies: []string{"ms-python.vscode-pylance", "vscode.git"},
+				ExtensionPack:         []string{"MS-Toolsai.Jupyter", "ms-python.vscode-pylance"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deps).To(Equal([]Plugin{
+				{Publisher: "ms-python", Extension: "vscode-pylance"},
+				{Publisher: "ms-toolsai", Extension: "jupyter"},
+			}))
+
+			_, err = parseDependencies(manifest{ExtensionPack: []string{"invalid"}})
+			Expect(err).To(HaveOccurred())
+		})
 	})
 })
@@ -0,0 +1,169 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vscode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+	"github.com/tensorchord/envd/pkg/util/ziputil"
+)
+
+const vsixExt = ".vsix"
+
+// findVSIX finds the vsix of the plugin in the directory, whose name is
+// publisher.extension-version[@platform].vsix as downloaded from the
+// marketplaces. The latest version is used if the plugin is not pinned. It
+// returns the empty path if the plugin is not found.
+func findVSIX(dir string, p Plugin) (string, Plugin, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", p, errors.Wrapf(err, "failed to read the vsix directory %s", dir)
+	}
+	var found string
+	var latest Plugin
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), vsixExt) {
+			continue
+		}
+		candidate, err := ParsePlugin(strings.TrimSuffix(entry.Name(), vsixExt))
+		if err != nil || candidate.Version == nil {
+			log.Debugf("ignore the vsix %s without the version", entry.Name())
+			continue
+		}
+		if candidate.Publisher != p.Publisher || candidate.Extension != p.Extension ||
+			candidate.Platform != p.Platform {
+			continue
+		}
+		if p.Version != nil && *candidate.Version != *p.Version {
+			continue
+		}
+		if found == "" || compareVersions(*candidate.Version, *latest.Version) > 0 {
+			found = filepath.Join(dir, entry.Name())
+			latest = *candidate
+		}
+	}
+	if found == "" {
+		return "", p, nil
+	}
+	latest.SHA256 = p.SHA256
+	return found, latest, nil
+}
+
+// compareVersions compares the dot-separated numeric versions, e.g.
+// 2022.10.0 is newer than 2022.8.1.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// fileSHA256 returns the hex sha256 digest of the file.
+func fileSHA256(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to open %s", filename)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "failed to read %s", filename)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// installVSIX installs the local vsix of the pinned plugin into the cache,
+// the same as the downloaded ones. It returns true if the same vsix is
+// already in the cache.
+func installVSIX(ctx context.Context, filename string, p Plugin) (Plugin, bool, error) {
+	digest, err := fileSHA256(filename)
+	if err != nil {
+		return p, false, err
+	}
+	if p.SHA256 != "" && !strings.EqualFold(p.SHA256, digest) {
+		return p, false, errors.Errorf("the sha256 of %s is %s, expected %s",
+			filename, digest, p.SHA256)
+	}
+	p.SHA256 = digest
+
+	cacheKey := fmt.Sprintf("%s-%s", cacheKeyPrefix, p)
+	unlock, err := fileutil.Lock(ctx, cacheKey)
+	if err != nil {
+		return p, false, err
+	}
+	defer unlock()
+	if home.GetManager().Cached(cacheKey) && VerifyCache(p) == nil {
+		log.Debugf("vscode plugin %s from %s already exists in cache", p, filename)
+		return p, true, touchCache(cacheKey, p)
+	}
+
+	dir := unzipPath(p)
+	if err := os.RemoveAll(dir); err != nil {
+		return p, false, errors.Wrapf(err, "failed to remove %s", dir)
+	}
+	in, err := os.Open(filename)
+	if err != nil {
+		return p, false, errors.Wrapf(err, "failed to open %s", filename)
+	}
+	defer in.Close()
+	out, err := os.Create(dir + vsixExt)
+	if err != nil {
+		return p, false, err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return p, false, errors.Wrapf(err, "failed to copy %s", filename)
+	}
+	if err := os.WriteFile(dir+vsixExt+".sha256", []byte(digest+"\n"), 0644); err != nil {
+		return p, false, errors.Wrap(err, "failed to record the sha256")
+	}
+	if _, err := ziputil.Unzip(dir+vsixExt, dir); err != nil {
+		return p, false, errors.Wrap(err, "failed to unzip")
+	}
+	if err := home.GetManager().MarkCache(cacheKey, true); err != nil {
+		return p, false, errors.Wrap(err, "failed to update cache status")
+	}
+	if err := touchCache(cacheKey, p); err != nil {
+		return p, false, err
+	}
+	log.Debugf("vscode plugin %s is installed from %s", p, filename)
+	return p, false, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vscode
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VSIX directory", func() {
+	var dir string
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "envd-vsix")
+		Expect(err).NotTo(HaveOccurred())
+		for _, name := range []string{
+			"ms-python.python-2022.8.0.vsix",
+			"ms-python.python-2022.10.1.vsix",
+			"ms-python.python-2022.12.0@linux-x64.vsix",
+			"ms-python.python.vsix",
+			"ms-python.python-2023.1.0.zip",
+		} {
+			Expect(os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)).To(Succeed())
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should find the latest version of the unpinned plugin", func() {
+		filename, p, err := findVSIX(dir, Plugin{Publisher: "ms-python", Extension: "python"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filename).To(Equal(filepath.Join(dir, "ms-python.python-2022.10.1.vsix")))
+		Expect(*p.Version).To(Equal("2022.10.1"))
+	})
+
+	It("should find the pinned plugin of the platform", func() {
+		version := "2022.12.0"
+		filename, p, err := findVSIX(dir, Plugin{
+			Publisher: "ms-python", Extension: "python", Version: &version, Platform: "linux-x64"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filename).To(Equal(filepath.Join(dir, "ms-python.python-2022.12.0@linux-x64.vsix")))
+		Expect(p.Platform).To(Equal("linux-x64"))
+
+		version = "2022.9.0"
+		filename, _, err = findVSIX(dir, Plugin{Publisher: "ms-python", Extension: "python", Version: &version})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filename).To(BeEmpty())
+	})
+
+	It("should compare the versions", func() {
+		Expect(compareVersions("2022.10.0", "2022.8.1")).To(Equal(1))
+		Expect(compareVersions("1.0", "1.0.0")).To(Equal(0))
+		Expect(compareVersions("1.2", "1.10")).To(Equal(-1))
+	})
+})
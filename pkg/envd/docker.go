@@ -15,9 +15,13 @@
 package envd
 
 import (
+	"archive/tar"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -29,11 +33,14 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/go-connections/nat"
-	"github.com/sirupsen/logrus"
 
 	envdconfig "github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/errdefs"
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
 	"github.com/tensorchord/envd/pkg/types"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 	"github.com/tensorchord/envd/pkg/util/netutil"
@@ -49,6 +56,8 @@ var (
 
 type dockerEngine struct {
 	*client.Client
+	// context is the name of the context, it is labeled on the environments.
+	context string
 }
 
 func dockerFilters(gpu bool) filters.Args {
@@ -106,7 +115,7 @@ func (e dockerEngine) ListEnvironment(
 }
 
 func (e dockerEngine) PauseEnvironment(ctx context.Context, env string) (string, error) {
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
 		"env": env,
 	})
 	logger.Debug("pausing environment")
@@ -128,7 +137,7 @@ func (e dockerEngine) PauseEnvironment(ctx context.Context, env string) (string,
 }
 
 func (e dockerEngine) ResumeEnvironment(ctx context.Context, env string) (string, error) {
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
 		"env": env,
 	})
 	logger.Debug("resuming environment")
@@ -151,8 +160,42 @@ func (e dockerEngine) ResumeEnvironment(ctx context.Context, env string) (string
 }
 
 // ListImageDependency gets the dependencies of the given environment.
+func (e dockerEngine) DestroyEnvironment(ctx context.Context, env string) (string, error) {
+	logger := log.WithField("container", env)
+	// Refer to https://docs.docker.com/engine/reference/commandline/container_kill/
+	if err := e.ContainerKill(ctx, env, "KILL"); err != nil {
+		errCause := errors.UnwrapAll(err).Error()
+		switch {
+		case strings.Contains(errCause, "is not running"):
+			// If the container is not running, there is no need to kill it.
+			logger.Debug("container is not running, there is no need to kill it")
+		case client.IsErrNotFound(err):
+			// If the container is not found, it is already destroyed or the name is wrong.
+			logger.Infof("cannot find container %s, maybe it's already destroyed or the name is wrong", env)
+			return "", nil
+		default:
+			return "", errors.Wrap(err, "failed to kill the container")
+		}
+	}
+
+	if err := e.ContainerRemove(ctx, env, dockertypes.ContainerRemoveOptions{}); err != nil {
+		return "", errors.Wrap(err, "failed to remove the container")
+	}
+	return env, nil
+}
+
+func (e dockerEngine) RemoveVolume(ctx context.Context, name string) error {
+	if err := e.VolumeRemove(ctx, name, false); err != nil {
+		if client.IsErrNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to remove the volume %s", name)
+	}
+	return nil
+}
+
 func (e dockerEngine) ListImageDependency(ctx context.Context, image string) (*types.Dependency, error) {
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
 		"image": image,
 	})
 	logger.Debug("getting dependencies")
@@ -177,7 +220,7 @@ func (e dockerEngine) ListImageDependency(ctx context.Context, image string) (*t
 // ListEnvDependency gets the dependencies of the given environment.
 func (e dockerEngine) ListEnvDependency(
 	ctx context.Context, env string) (*types.Dependency, error) {
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
 		"env": env,
 	})
 	logger.Debug("getting dependencies")
@@ -193,7 +236,7 @@ func (e dockerEngine) ListEnvDependency(
 }
 
 func (e dockerEngine) ListEnvPortBinding(ctx context.Context, env string) ([]types.PortBinding, error) {
-	logrus.WithField("env", env).Debug("getting env port bindings")
+	log.WithField("env", env).Debug("getting env port bindings")
 	ctr, err := e.ContainerInspect(ctx, env)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get container")
@@ -202,6 +245,30 @@ func (e dockerEngine) ListEnvPortBinding(ctx context.Context, env string) ([]typ
 	return ports, nil
 }
 
+// GetEnvEntrypoint returns the entrypoint script generated from the build
+// file, which is read from the container thus it works if it is stopped.
+func (e dockerEngine) GetEnvEntrypoint(ctx context.Context, env string) (string, error) {
+	log.WithField("env", env).Debug("getting env entrypoint script")
+	r, _, err := e.CopyFromContainer(ctx, env, envdconfig.ContainerEntrypointPath)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return "", errors.Newf("there is no entrypoint script in the environment %s, "+
+				"e.g. it is built by the previous envd or with the custom image", env)
+		}
+		return "", errors.Wrap(err, "failed to copy the entrypoint script")
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	if _, err := tr.Next(); err != nil {
+		return "", errors.Wrap(err, "failed to read the entrypoint script")
+	}
+	data, err := io.ReadAll(tr)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the entrypoint script")
+	}
+	return string(data), nil
+}
+
 func (e dockerEngine) GetInfo(ctx context.Context) (*types.EnvdInfo, error) {
 	info, err := e.Info(ctx)
 	if err != nil {
@@ -249,7 +316,69 @@ func (e dockerEngine) IsRunning(ctx context.Context, cname string) (bool, error)
 func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext string,
 	gpuEnabled bool, numGPUs int, sshPortInHost int, g ir.Graph, timeout time.Duration,
 	mountOptionsStr []string) (string, string, error) {
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
+		"tag":           tag,
+		"container":     name,
+		"gpu":           gpuEnabled,
+		"numGPUs":       numGPUs,
+		"build-context": buildContext,
+	})
+	config, hostConfig, err := containerConfig(e.context, tag, name, buildContext,
+		gpuEnabled, numGPUs, sshPortInHost, g, mountOptionsStr)
+	if err != nil {
+		return "", "", err
+	}
+
+	logger = logger.WithFields(log.Fields{
+		"entrypoint":  config.Entrypoint,
+		"working-dir": config.WorkingDir,
+	})
+	logger.Debugf("starting %s container", name)
+
+	if err := e.pullIfNotExists(ctx, tag); err != nil {
+		return "", "", err
+	}
+	resp, err := e.ContainerCreate(ctx, config, hostConfig, nil, nil, name)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to create the container")
+	}
+
+	for _, w := range resp.Warnings {
+		logger.Warnf("run with warnings: %s", w)
+	}
+
+	if err := e.ContainerStart(
+		ctx, resp.ID, dockertypes.ContainerStartOptions{}); err != nil {
+		errCause := errors.UnwrapAll(err)
+		// Hack to check if the port is already allocated.
+		if strings.Contains(errCause.Error(), "port is already allocated") {
+			log.Debugf("failed to allocate the port: %s", err)
+			return "", "", errdefs.New(errdefs.PortAllocated)
+		}
+		return "", "", errors.Wrap(err, "failed to run the container")
+	}
+
+	container, err := e.ContainerInspect(ctx, resp.ID)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to inspect the container")
+	}
+
+	if err := e.WaitUntilRunning(
+		ctx, container.Name, timeout); err != nil {
+		return "", "", errdefs.Wrap(
+			errors.Wrap(err, "failed to wait until the container is running"),
+			errdefs.ContainerNotRunning)
+	}
+
+	return container.Name, container.NetworkSettings.IPAddress, nil
+}
+
+// containerConfig returns the configs of the environment container, which
+// are shared by the docker and the nerdctl runners.
+func containerConfig(contextName, tag, name, buildContext string,
+	gpuEnabled bool, numGPUs int, sshPortInHost int, g ir.Graph,
+	mountOptionsStr []string) (*container.Config, *container.HostConfig, error) {
+	logger := log.WithFields(log.Fields{
 		"tag":           tag,
 		"container":     name,
 		"gpu":           gpuEnabled,
@@ -264,14 +393,31 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 	base := fileutil.EnvdHomeDir(filepath.Base(buildContext))
 	config.WorkingDir = base
 
-	mountOption := make([]mount.Mount, 0, len(mountOptionsStr)+len(g.Mount)+1)
+	// Only log the names here since the values may be secrets.
+	config.Env = g.PassthroughEnviron(os.Environ())
+	for _, kv := range config.Env {
+		name, _, _ := strings.Cut(kv, "=")
+		logger.WithField("env", name).Debug("passing through the host env")
+	}
+
+	if g.GitHubCLIConfig != nil && g.GitHubCLIConfig.ForwardToken {
+		if token := hostGitHubToken(); token != "" {
+			logger.Debug("forwarding the GitHub token")
+			config.Env = append(config.Env, fmt.Sprintf("GH_TOKEN=%s", token))
+		} else {
+			logger.Warn("the GitHub token is not found on the host, " +
+				"please run gh auth login or set GH_TOKEN")
+		}
+	}
+
+	mountOption := make([]mount.Mount, 0, len(mountOptionsStr)+len(g.Mount)+9)
 	for _, option := range mountOptionsStr {
 		mStr := strings.Split(option, ":")
 		if len(mStr) != 2 {
-			return "", "", errors.Newf("Invalid mount options %s", option)
+			return nil, nil, errors.Newf("Invalid mount options %s", option)
 		}
 
-		logger.WithFields(logrus.Fields{
+		logger.WithFields(log.Fields{
 			"mount-path":     mStr[0],
 			"container-path": mStr[1],
 		}).Debug("setting up container working directory")
@@ -282,7 +428,7 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 		})
 	}
 	for _, m := range g.Mount {
-		logger.WithFields(logrus.Fields{
+		logger.WithFields(log.Fields{
 			"mount-path":     m.Source,
 			"container-path": m.Destination,
 		}).Debug("setting up declared mount directory")
@@ -298,8 +444,83 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 		Source: buildContext,
 		Target: base,
 	})
+	if g.Image == nil {
+		// The volume is created from the state dir in the image at the
+		// first start, thus it is owned by the user.
+		mountOption = append(mountOption, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: StateVolumeName(name),
+			Target: envdconfig.ContainerStateDir,
+		})
+		historyDir, err := HistoryDir(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		mountOption = append(mountOption, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: historyDir,
+			Target: envdconfig.ContainerHistoryDir,
+		})
+		// The host key is kept across the rebuilds, thus ssh does not
+		// complain that the remote host identification has changed.
+		hostKey, err := sshconfig.HostKey(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		mountOption = append(mountOption, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   hostKey,
+			Target:   envdconfig.ContainerHostKeyPath,
+			ReadOnly: true,
+		})
+		// It is read by envd-sshd --hostkey.
+		config.Env = append(config.Env,
+			fmt.Sprintf("ENVD_HOST_KEY=%s", envdconfig.ContainerHostKeyPath))
+	}
+	if g.RuntimeSSHAgent != "" {
+		logger.WithField("ssh-agent", g.RuntimeSSHAgent).Debug("forwarding the ssh agent")
+		mountOption = append(mountOption, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: g.RuntimeSSHAgent,
+			Target: envdconfig.ContainerSSHAgentPath,
+		})
+		// The ssh sessions with the agent forwarding use their own socket.
+		config.Env = append(config.Env,
+			fmt.Sprintf("SSH_AUTH_SOCK=%s", envdconfig.ContainerSSHAgentPath))
+	}
+	if g.RuntimeGitConfig != "" {
+		mountOption = append(mountOption, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   g.RuntimeGitConfig,
+			Target:   envdconfig.ContainerGitConfigPath,
+			ReadOnly: true,
+		})
+	}
+	if g.RuntimeGitCredentials != "" {
+		mountOption = append(mountOption, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   g.RuntimeGitCredentials,
+			Target:   envdconfig.ContainerGitCredentialsPath,
+			ReadOnly: true,
+		})
+	}
+	if len(g.RuntimeDatabases) > 0 {
+		mounts, environ, err := databaseProfiles(name, g)
+		if err != nil {
+			return nil, nil, err
+		}
+		mountOption = append(mountOption, mounts...)
+		config.Env = append(config.Env, environ...)
+	}
+	if g.PreCommitConfig != nil {
+		mountOption = append(mountOption, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: PreCommitVolumeName,
+			Target: ir.PreCommitHome,
+		})
+	}
 
-	logger.WithFields(logrus.Fields{
+	logger.WithFields(log.Fields{
 		"mount-path":  buildContext,
 		"working-dir": base,
 	}).Debug("setting up container working directory")
@@ -312,6 +533,10 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 		Mounts:        mountOption,
 		RestartPolicy: rp,
 	}
+	if g.RuntimeLogForward != "" {
+		logger.WithField("log-forward", g.RuntimeLogForward).Debug("forwarding the logs")
+		hostConfig.LogConfig = logConfig(name, g.RuntimeLogForward)
+	}
 
 	// Configure ssh port.
 	natPort := nat.Port(fmt.Sprintf("%d/tcp", envdconfig.SSHPortInContainer))
@@ -331,7 +556,7 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 			var err error
 			jupyterPortInHost, err = netutil.GetFreePort()
 			if err != nil {
-				return "", "", errors.Wrap(err, "failed to get a free port")
+				return nil, nil, errors.Wrap(err, "failed to get a free port")
 			}
 		}
 		natPort := nat.Port(fmt.Sprintf("%d/tcp", envdconfig.JupyterPortInContainer))
@@ -348,7 +573,7 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 		var err error
 		rStudioPortInHost, err = netutil.GetFreePort()
 		if err != nil {
-			return "", "", errors.Wrap(err, "failed to get a free port")
+			return nil, nil, errors.Wrap(err, "failed to get a free port")
 		}
 		natPort := nat.Port(fmt.Sprintf("%d/tcp", envdconfig.RStudioServerPortInContainer))
 		hostConfig.PortBindings[natPort] = []nat.PortBinding{
@@ -359,6 +584,25 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 		}
 		config.ExposedPorts[natPort] = struct{}{}
 	}
+	var codeServerPortInHost int
+	if g.CodeServerConfig != nil {
+		codeServerPortInHost = int(g.CodeServerConfig.Port)
+		if codeServerPortInHost == 0 {
+			var err error
+			codeServerPortInHost, err = netutil.GetFreePort()
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "failed to get a free port")
+			}
+		}
+		natPort := nat.Port(fmt.Sprintf("%d/tcp", envdconfig.CodeServerPortInContainer))
+		hostConfig.PortBindings[natPort] = []nat.PortBinding{
+			{
+				HostIP:   localhost,
+				HostPort: strconv.Itoa(codeServerPortInHost),
+			},
+		}
+		config.ExposedPorts[natPort] = struct{}{}
+	}
 
 	if len(g.RuntimeExpose) > 0 {
 		for _, item := range g.RuntimeExpose {
@@ -366,7 +610,7 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 			if item.HostPort == 0 {
 				item.HostPort, err = netutil.GetFreePort()
 				if err != nil {
-					return "", "", errors.Wrap(err, "failed to get a free port")
+					return nil, nil, errors.Wrap(err, "failed to get a free port")
 				}
 			}
 			natPort := nat.Port(fmt.Sprintf("%d/tcp", item.EnvdPort))
@@ -386,50 +630,16 @@ func (e dockerEngine) StartEnvd(ctx context.Context, tag, name, buildContext str
 	}
 
 	config.Labels = labels(name, g,
-		sshPortInHost, jupyterPortInHost, rStudioPortInHost)
-
-	logger = logger.WithFields(logrus.Fields{
-		"entrypoint":  config.Entrypoint,
-		"working-dir": config.WorkingDir,
-	})
-	logger.Debugf("starting %s container", name)
-
-	resp, err := e.ContainerCreate(ctx, config, hostConfig, nil, nil, name)
-	if err != nil {
-		return "", "", errors.Wrap(err, "failed to create the container")
-	}
-
-	for _, w := range resp.Warnings {
-		logger.Warnf("run with warnings: %s", w)
-	}
-
-	if err := e.ContainerStart(
-		ctx, resp.ID, dockertypes.ContainerStartOptions{}); err != nil {
-		errCause := errors.UnwrapAll(err)
-		// Hack to check if the port is already allocated.
-		if strings.Contains(errCause.Error(), "port is already allocated") {
-			logrus.Debugf("failed to allocate the port: %s", err)
-			return "", "", errors.New("port is already allocated in the host")
-		}
-		return "", "", errors.Wrap(err, "failed to run the container")
-	}
-
-	container, err := e.ContainerInspect(ctx, resp.ID)
-	if err != nil {
-		return "", "", errors.Wrap(err, "failed to inspect the container")
+		sshPortInHost, jupyterPortInHost, rStudioPortInHost, codeServerPortInHost)
+	if contextName != "" {
+		config.Labels[types.ContainerLabelContext] = contextName
 	}
-
-	if err := e.WaitUntilRunning(
-		ctx, container.Name, timeout); err != nil {
-		return "", "", errors.Wrap(err, "failed to wait until the container is running")
-	}
-
-	return container.Name, container.NetworkSettings.IPAddress, nil
+	return config, hostConfig, nil
 }
 
 func (e dockerEngine) WaitUntilRunning(ctx context.Context,
 	name string, timeout time.Duration) error {
-	logger := logrus.WithField("container", name)
+	logger := log.WithField("container", name)
 	logger.Debug("waiting to start")
 
 	// First, wait for the container to be marked as started.
@@ -468,7 +678,7 @@ func (e dockerEngine) GPUEnabled(ctx context.Context) (bool, error) {
 	if err != nil {
 		return false, errors.Wrap(err, "failed to get docker info")
 	}
-	logrus.WithField("info", info).Debug("docker info")
+	log.WithField("info", info).Debug("docker info")
 	nv := info.Runtimes["nvidia"]
 	return nv.Path != "", nil
 }
@@ -487,6 +697,13 @@ func (e dockerEngine) GetImage(ctx context.Context, image string) (dockertypes.I
 	return images[0], nil
 }
 
+func (e dockerEngine) RemoveImage(ctx context.Context, image string) error {
+	if _, err := e.ImageRemove(ctx, image, dockertypes.ImageRemoveOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to remove the image %s", image)
+	}
+	return nil
+}
+
 func deviceRequests(count int) []container.DeviceRequest {
 	return []container.DeviceRequest{
 		{
@@ -506,8 +723,104 @@ func deviceRequests(count int) []container.DeviceRequest {
 	}
 }
 
+// databaseProfiles writes the connection profiles of the databases to the
+// cache dir, and returns the mounts and the envs of them.
+func databaseProfiles(name string, g ir.Graph) ([]mount.Mount, []string, error) {
+	profiles, err := g.DatabaseProfiles(os.Environ())
+	if err != nil {
+		return nil, nil, err
+	}
+	mounts := []mount.Mount{}
+	environ := profiles.Environ
+	for _, f := range []struct {
+		name, content, target string
+	}{
+		{pgServiceFile(name), profiles.PGService, envdconfig.ContainerPGServicePath},
+		{mySQLConfigFile(name), profiles.MySQLConfig, envdconfig.ContainerMySQLConfigPath},
+	} {
+		if f.content == "" {
+			continue
+		}
+		path, err := fileutil.CacheFile(f.name)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The profiles contain the passwords.
+		if err := os.WriteFile(path, []byte(f.content), 0600); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to write the database profile")
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   path,
+			Target:   f.target,
+			ReadOnly: true,
+		})
+	}
+	if profiles.PGService != "" {
+		environ = append(environ, fmt.Sprintf("PGSERVICEFILE=%s", envdconfig.ContainerPGServicePath))
+	}
+	return mounts, environ, nil
+}
+
+func pgServiceFile(name string) string {
+	return fmt.Sprintf("pg_service_%s.conf", name)
+}
+
+func mySQLConfigFile(name string) string {
+	return fmt.Sprintf("my_%s.cnf", name)
+}
+
+// RemoveDatabaseProfiles removes the connection profiles of the environment
+// in the host cache, which contain the passwords.
+func RemoveDatabaseProfiles(name string) error {
+	for _, f := range []string{pgServiceFile(name), mySQLConfigFile(name)} {
+		path, err := fileutil.CacheFile(f)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to remove the database profile")
+		}
+	}
+	return nil
+}
+
+// hostGitHubToken returns the GitHub token of the host, i.e. GH_TOKEN,
+// GITHUB_TOKEN or the one of gh auth login.
+func hostGitHubToken() string {
+	for _, env := range []string{"GH_TOKEN", "GITHUB_TOKEN"} {
+		if token := os.Getenv(env); token != "" {
+			return token
+		}
+	}
+	out, err := exec.Command("gh", "auth", "token").Output()
+	if err != nil {
+		log.Debugf("failed to get the token by gh auth token: %s", err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// logConfig returns the docker logging driver which forwards the logs to
+// the target, the entries are tagged with the environment name.
+func logConfig(name, target string) container.LogConfig {
+	if target == ir.LogForwardJournald {
+		return container.LogConfig{
+			Type:   "journald",
+			Config: map[string]string{"tag": name},
+		}
+	}
+	return container.LogConfig{
+		Type: "syslog",
+		Config: map[string]string{
+			"syslog-address": target,
+			"tag":            name,
+		},
+	}
+}
+
 func labels(name string, g ir.Graph,
-	sshPortInHost, jupyterPortInHost, rstudioServerPortInHost int) map[string]string {
+	sshPortInHost, jupyterPortInHost, rstudioServerPortInHost, codeServerPortInHost int) map[string]string {
 	res := make(map[string]string)
 	res[types.ContainerLabelName] = name
 	res[types.ContainerLabelSSHPort] = strconv.Itoa(sshPortInHost)
@@ -519,6 +832,36 @@ func labels(name string, g ir.Graph,
 		res[types.ContainerLabelRStudioServerAddr] =
 			fmt.Sprintf("http://%s:%d", localhost, rstudioServerPortInHost)
 	}
+	if g.CodeServerConfig != nil {
+		res[types.ContainerLabelCodeServerAddr] =
+			fmt.Sprintf("http://%s:%d", localhost, codeServerPortInHost)
+	}
+	for k, v := range g.RuntimeTags {
+		res[types.ContainerLabelTagPrefix+k] = v
+	}
 
 	return res
 }
+
+// pullIfNotExists pulls the image if it does not exist in the docker host,
+// e.g. the image is pushed to the registry for the remote docker host.
+func (e dockerEngine) pullIfNotExists(ctx context.Context, tag string) error {
+	_, _, err := e.ImageInspectWithRaw(ctx, tag)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return errors.Wrap(err, "failed to inspect the image")
+	}
+	log.Infof("pulling image %s", tag)
+	body, err := e.ImagePull(ctx, tag, dockertypes.ImagePullOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to pull image %s", tag)
+	}
+	defer body.Close()
+	if err := jsonmessage.DisplayJSONMessagesStream(
+		body, io.Discard, 0, false, nil); err != nil {
+		return errors.Wrapf(err, "failed to pull image %s", tag)
+	}
+	return nil
+}
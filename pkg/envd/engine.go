@@ -16,6 +16,7 @@ package envd
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
@@ -33,9 +34,16 @@ type Engine interface {
 type EnvironmentClient interface {
 	PauseEnvironment(ctx context.Context, env string) (string, error)
 	ResumeEnvironment(ctx context.Context, env string) (string, error)
+	// DestroyEnvironment kills and removes the container, and returns its
+	// name, or "" if it does not exist.
+	DestroyEnvironment(ctx context.Context, env string) (string, error)
+	// RemoveVolume removes the volume if it exists.
+	RemoveVolume(ctx context.Context, name string) error
 	ListEnvironment(ctx context.Context) ([]types.EnvdEnvironment, error)
 	ListEnvDependency(ctx context.Context, env string) (*types.Dependency, error)
 	ListEnvPortBinding(ctx context.Context, env string) ([]types.PortBinding, error)
+	// GetEnvEntrypoint returns the entrypoint script of the environment.
+	GetEnvEntrypoint(ctx context.Context, env string) (string, error)
 
 	CleanEnvdIfExists(ctx context.Context, name string, force bool) error
 	// StartEnvd creates the container for the given tag and container name.
@@ -48,13 +56,26 @@ type EnvironmentClient interface {
 	WaitUntilRunning(ctx context.Context, name string, timeout time.Duration) error
 }
 
+// PreCommitVolumeName is the volume keeping the environments of the
+// pre-commit hooks, which is shared by all the environments.
+const PreCommitVolumeName = "envd_pre_commit"
+
+// StateVolumeName returns the name of the volume keeping the shell state
+// of the environment, which is kept after the environment is destroyed.
+func StateVolumeName(name string) string {
+	return fmt.Sprintf("envd_state_%s", name)
+}
+
 type ImageClient interface {
 	ListImage(ctx context.Context) ([]types.EnvdImage, error)
 	ListImageDependency(ctx context.Context, image string) (*types.Dependency, error)
 	GetImage(ctx context.Context, image string) (dockertypes.ImageSummary, error)
+	RemoveImage(ctx context.Context, image string) error
 }
 
 type VersionClient interface {
 	GetInfo(ctx context.Context) (*types.EnvdInfo, error)
 	GPUEnabled(ctx context.Context) (bool, error)
+	// GetResources returns the GPUs and the memory of the runner host.
+	GetResources(ctx context.Context) (*types.HostResources, error)
 }
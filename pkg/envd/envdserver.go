@@ -42,6 +42,10 @@ func (e *envdServerEngine) GetImage(ctx context.Context, image string) (dockerty
 	return dockertypes.ImageSummary{}, errors.New("not implemented")
 }
 
+func (e *envdServerEngine) RemoveImage(ctx context.Context, image string) error {
+	return errors.New("not implemented")
+}
+
 func (e *envdServerEngine) GetInfo(ctx context.Context) (*types.EnvdInfo, error) {
 	return nil, errors.New("not implemented")
 }
@@ -50,6 +54,10 @@ func (e *envdServerEngine) GPUEnabled(ctx context.Context) (bool, error) {
 	return false, errors.New("not implemented")
 }
 
+func (e *envdServerEngine) GetResources(ctx context.Context) (*types.HostResources, error) {
+	return nil, errors.New("not implemented")
+}
+
 func (e *envdServerEngine) PauseEnvironment(ctx context.Context, env string) (string, error) {
 	return "", errors.New("not implemented")
 }
@@ -58,6 +66,14 @@ func (e *envdServerEngine) ResumeEnvironment(ctx context.Context, env string) (s
 	return "", errors.New("not implemented")
 }
 
+func (e *envdServerEngine) DestroyEnvironment(ctx context.Context, env string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (e *envdServerEngine) RemoveVolume(ctx context.Context, name string) error {
+	return errors.New("not implemented")
+}
+
 func (e *envdServerEngine) ListEnvironment(ctx context.Context) ([]types.EnvdEnvironment, error) {
 	return nil, errors.New("not implemented")
 }
@@ -70,6 +86,10 @@ func (e *envdServerEngine) ListEnvPortBinding(ctx context.Context, env string) (
 	return nil, errors.New("not implemented")
 }
 
+func (e *envdServerEngine) GetEnvEntrypoint(ctx context.Context, env string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
 func (e *envdServerEngine) CleanEnvdIfExists(ctx context.Context, name string, force bool) error {
 	return errors.New("not implemented")
 }
@@ -21,6 +21,7 @@ import (
 	"github.com/docker/docker/client"
 	envdclient "github.com/tensorchord/envd-server/client"
 
+	"github.com/tensorchord/envd/pkg/nerdctl"
 	"github.com/tensorchord/envd/pkg/types"
 )
 
@@ -32,6 +33,20 @@ func New(ctx context.Context, opt Options) (Engine, error) {
 	if opt.Context == nil {
 		return nil, errors.New("failed to get the context")
 	}
+	if opt.Context.Runner == types.RunnerTypeNerdctl {
+		address := ""
+		if opt.Context.RunnerAddress != nil {
+			address = *opt.Context.RunnerAddress
+		}
+		cli, err := nerdctl.NewClient(address)
+		if err != nil {
+			return nil, err
+		}
+		return &nerdctlEngine{
+			Client:  cli,
+			context: opt.Context.Name,
+		}, nil
+	}
 	if opt.Context.Runner == types.RunnerTypeEnvdServer {
 		cli, err := envdclient.NewClientWithOpts(envdclient.FromEnv)
 		if err != nil {
@@ -41,13 +56,17 @@ func New(ctx context.Context, opt Options) (Engine, error) {
 			Client: cli,
 		}, nil
 	} else {
-		cli, err := client.NewClientWithOpts(
-			client.FromEnv, client.WithAPIVersionNegotiation())
+		opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+		if opt.Context.RunnerAddress != nil {
+			opts = append(opts, client.WithHost(*opt.Context.RunnerAddress))
+		}
+		cli, err := client.NewClientWithOpts(opts...)
 		if err != nil {
 			return nil, err
 		}
 		return &dockerEngine{
-			Client: cli,
+			Client:  cli,
+			context: opt.Context.Name,
 		}, nil
 	}
 }
@@ -0,0 +1,61 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+func historyDirPath(name string) (string, error) {
+	path, err := fileutil.CacheFile(fmt.Sprintf("history_%s", name))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get the history dir")
+	}
+	return path, nil
+}
+
+// HistoryDir returns the dir in the host cache which keeps the shell history
+// of the environment, e.g. zsh_history. It is mounted by envd up, thus the
+// history survives the rebuilds and the restarts. The dir is mounted instead
+// of the files since the shells may replace the history file.
+func HistoryDir(name string) (string, error) {
+	path, err := historyDirPath(name)
+	if err != nil {
+		return "", err
+	}
+	// The user in the container may have the different uid.
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return "", errors.Wrapf(err, "failed to create the history dir %s", path)
+	}
+	return path, nil
+}
+
+// RemoveHistory removes the shell history of the environment in the host
+// cache.
+func RemoveHistory(name string) error {
+	path, err := historyDirPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return errors.Wrap(err, "failed to remove the history dir")
+	}
+	return nil
+}
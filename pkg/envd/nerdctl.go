@@ -0,0 +1,545 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+
+	envdconfig "github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/errdefs"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/nerdctl"
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+// nerdctlEngine runs the environments on containerd by nerdctl. The outputs
+// of nerdctl inspect are compatible with docker, thus they are decoded into
+// the docker types.
+type nerdctlEngine struct {
+	nerdctl.Client
+	// context is the name of the context, it is labeled on the environments.
+	context string
+}
+
+// inspectContainers returns the containers, whose port bindings are filled
+// from the network settings since nerdctl does not report the host config.
+func (e nerdctlEngine) inspectContainers(ctx context.Context,
+	names ...string) ([]dockertypes.ContainerJSON, error) {
+	out, err := e.Output(ctx, append([]string{"container", "inspect"}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	ctrs := []dockertypes.ContainerJSON{}
+	if err := json.Unmarshal(out, &ctrs); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the containers")
+	}
+	for i := range ctrs {
+		c := &ctrs[i]
+		if c.ContainerJSONBase == nil {
+			c.ContainerJSONBase = &dockertypes.ContainerJSONBase{}
+		}
+		if c.Config == nil {
+			c.Config = &container.Config{}
+		}
+		if c.HostConfig == nil {
+			c.HostConfig = &container.HostConfig{}
+		}
+		if c.HostConfig.PortBindings == nil && c.NetworkSettings != nil {
+			c.HostConfig.PortBindings = c.NetworkSettings.Ports
+		}
+	}
+	return ctrs, nil
+}
+
+func (e nerdctlEngine) inspectContainer(ctx context.Context,
+	name string) (dockertypes.ContainerJSON, error) {
+	ctrs, err := e.inspectContainers(ctx, name)
+	if err != nil {
+		return dockertypes.ContainerJSON{}, err
+	}
+	if len(ctrs) == 0 {
+		return dockertypes.ContainerJSON{}, errors.Newf("no such container: %s", name)
+	}
+	return ctrs[0], nil
+}
+
+// inspectImages returns the summaries of the images, which are labeled by
+// envd if envdOnly is true.
+func (e nerdctlEngine) inspectImages(ctx context.Context,
+	envdOnly bool, names ...string) ([]dockertypes.ImageSummary, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	out, err := e.Output(ctx, append([]string{"image", "inspect"}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	images := []dockertypes.ImageInspect{}
+	if err := json.Unmarshal(out, &images); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the images")
+	}
+	summaries := []dockertypes.ImageSummary{}
+	for _, img := range images {
+		s := imageSummary(img)
+		if envdOnly && s.Labels[types.ImageLabelVendor] != types.ImageVendorEnvd {
+			continue
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+func imageSummary(img dockertypes.ImageInspect) dockertypes.ImageSummary {
+	s := dockertypes.ImageSummary{
+		ID:          img.ID,
+		RepoTags:    img.RepoTags,
+		RepoDigests: img.RepoDigests,
+		Size:        img.Size,
+		VirtualSize: img.VirtualSize,
+	}
+	if img.Config != nil {
+		s.Labels = img.Config.Labels
+	}
+	if created, err := time.Parse(time.RFC3339Nano, img.Created); err == nil {
+		s.Created = created.Unix()
+	}
+	return s
+}
+
+func containerSummary(ctr dockertypes.ContainerJSON) dockertypes.Container {
+	c := dockertypes.Container{
+		ID:     ctr.ID,
+		Names:  []string{ctr.Name},
+		Image:  ctr.Image,
+		Labels: ctr.Config.Labels,
+	}
+	if ctr.Config.Image != "" {
+		c.Image = ctr.Config.Image
+	}
+	if ctr.State != nil {
+		c.State = ctr.State.Status
+		c.Status = ctr.State.Status
+	}
+	if created, err := time.Parse(time.RFC3339Nano, ctr.Created); err == nil {
+		c.Created = created.Unix()
+	}
+	return c
+}
+
+func (e nerdctlEngine) ListImage(ctx context.Context) ([]types.EnvdImage, error) {
+	out, err := e.Output(ctx, "image", "ls", "-q")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the images")
+	}
+	images, err := e.inspectImages(ctx, true, uniqueFields(out)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the images")
+	}
+	envdImgs := make([]types.EnvdImage, 0)
+	for _, img := range images {
+		envdImg, err := types.NewImage(img)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create envd image from the image")
+		}
+		envdImgs = append(envdImgs, *envdImg)
+	}
+	return envdImgs, nil
+}
+
+func (e nerdctlEngine) ListImageDependency(ctx context.Context, image string) (*types.Dependency, error) {
+	img, err := e.GetImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	dep, err := types.NewDependencyFromImage(img)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create dependency from image")
+	}
+	return dep, nil
+}
+
+func (e nerdctlEngine) GetImage(ctx context.Context, image string) (dockertypes.ImageSummary, error) {
+	images, err := e.inspectImages(ctx, false, image)
+	if err != nil {
+		if nerdctl.IsErrNotFound(err) {
+			return dockertypes.ImageSummary{}, errors.Errorf("image %s not found", image)
+		}
+		return dockertypes.ImageSummary{}, err
+	}
+	if len(images) == 0 {
+		return dockertypes.ImageSummary{}, errors.Errorf("image %s not found", image)
+	}
+	return images[0], nil
+}
+
+func (e nerdctlEngine) RemoveImage(ctx context.Context, image string) error {
+	if _, err := e.Output(ctx, "rmi", image); err != nil {
+		return errors.Wrapf(err, "failed to remove the image %s", image)
+	}
+	return nil
+}
+
+func (e nerdctlEngine) GetInfo(ctx context.Context) (*types.EnvdInfo, error) {
+	out, err := e.Output(ctx, "info", "--format", "{{json .}}")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get nerdctl info")
+	}
+	info := &types.EnvdInfo{}
+	if err := json.Unmarshal(out, &info.Info); err != nil {
+		return nil, errors.Wrap(err, "failed to decode nerdctl info")
+	}
+	return info, nil
+}
+
+// GPUEnabled returns true if the nvidia container toolkit, which is used by
+// nerdctl run --gpus, is installed.
+func (e nerdctlEngine) GPUEnabled(ctx context.Context) (bool, error) {
+	_, err := exec.LookPath("nvidia-container-cli")
+	return err == nil, nil
+}
+
+// GetResources returns the GPUs and the memory of the host, the GPUs
+// requested by the environments are not known since nerdctl does not
+// report them.
+func (e nerdctlEngine) GetResources(ctx context.Context) (*types.HostResources, error) {
+	info, err := e.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &types.HostResources{
+		Context:    e.context,
+		Memory:     info.MemTotal,
+		FreeMemory: info.MemTotal,
+	}
+	out, err := exec.CommandContext(ctx, "sh", "-c", resourcesProbe).Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to probe the resources")
+	}
+	gpus, free := parseResourcesProbe(out)
+	res.GPUs, res.FreeGPUs = gpus, gpus
+	if free > 0 {
+		res.FreeMemory = free
+	}
+	return res, nil
+}
+
+func (e nerdctlEngine) PauseEnvironment(ctx context.Context, env string) (string, error) {
+	log.WithField("env", env).Debug("pausing environment")
+	if _, err := e.Output(ctx, "pause", env); err != nil {
+		if nerdctl.IsErrNotFound(err) {
+			return "", errors.New("container not found")
+		}
+		return "", errors.Wrap(err, "failed to pause container")
+	}
+	return env, nil
+}
+
+func (e nerdctlEngine) ResumeEnvironment(ctx context.Context, env string) (string, error) {
+	log.WithField("env", env).Debug("resuming environment")
+	if _, err := e.Output(ctx, "unpause", env); err != nil {
+		if nerdctl.IsErrNotFound(err) {
+			return "", errors.New("container not found")
+		}
+		return "", errors.Wrap(err, "failed to resume container")
+	}
+	return env, nil
+}
+
+func (e nerdctlEngine) DestroyEnvironment(ctx context.Context, env string) (string, error) {
+	exists, err := e.Exists(ctx, env)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		log.Infof("cannot find container %s, maybe it's already destroyed or the name is wrong", env)
+		return "", nil
+	}
+	// rm -f kills the running container before removing it.
+	if _, err := e.Output(ctx, "rm", "-f", env); err != nil {
+		return "", errors.Wrap(err, "failed to remove the container")
+	}
+	return env, nil
+}
+
+func (e nerdctlEngine) RemoveVolume(ctx context.Context, name string) error {
+	out, err := e.Output(ctx, "volume", "ls", "-q")
+	if err != nil {
+		return errors.Wrap(err, "failed to list the volumes")
+	}
+	for _, v := range uniqueFields(out) {
+		if v != name {
+			continue
+		}
+		if _, err := e.Output(ctx, "volume", "rm", name); err != nil {
+			return errors.Wrapf(err, "failed to remove the volume %s", name)
+		}
+	}
+	return nil
+}
+
+func (e nerdctlEngine) ListEnvironment(ctx context.Context) ([]types.EnvdEnvironment, error) {
+	out, err := e.Output(ctx, "ps", "-q")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list containers")
+	}
+	envs := make([]types.EnvdEnvironment, 0)
+	ids := uniqueFields(out)
+	if len(ids) == 0 {
+		return envs, nil
+	}
+	ctrs, err := e.inspectContainers(ctx, ids...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list containers")
+	}
+	for _, ctr := range ctrs {
+		if ctr.Config.Labels[types.ImageLabelVendor] != types.ImageVendorEnvd {
+			continue
+		}
+		env, err := types.NewEnvironment(containerSummary(ctr))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create env from the container")
+		}
+		envs = append(envs, *env)
+	}
+	return envs, nil
+}
+
+func (e nerdctlEngine) ListEnvDependency(ctx context.Context, env string) (*types.Dependency, error) {
+	ctr, err := e.inspectContainer(ctx, env)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get container")
+	}
+	dep, err := types.NewDependencyFromContainerJSON(ctr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create dependency from the container")
+	}
+	return dep, nil
+}
+
+func (e nerdctlEngine) ListEnvPortBinding(ctx context.Context, env string) ([]types.PortBinding, error) {
+	ctr, err := e.inspectContainer(ctx, env)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get container")
+	}
+	return types.NewPortBindingFromContainerJSON(ctr), nil
+}
+
+// GetEnvEntrypoint returns the entrypoint script generated from the build
+// file, which is copied out of the container.
+func (e nerdctlEngine) GetEnvEntrypoint(ctx context.Context, env string) (string, error) {
+	dir, err := os.MkdirTemp("", "envd-entrypoint")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create the temp dir")
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, filepath.Base(envdconfig.ContainerEntrypointPath))
+	if _, err := e.Output(ctx, "cp",
+		fmt.Sprintf("%s:%s", env, envdconfig.ContainerEntrypointPath), path); err != nil {
+		return "", errors.Wrap(err, "failed to copy the entrypoint script")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the entrypoint script")
+	}
+	return string(data), nil
+}
+
+func (e nerdctlEngine) CleanEnvdIfExists(ctx context.Context, name string, force bool) error {
+	created, err := e.Exists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return nil
+	}
+	args := []string{"rm", name}
+	if force {
+		args = []string{"rm", "-f", name}
+	}
+	_, err = e.Output(ctx, args...)
+	return err
+}
+
+func (e nerdctlEngine) Exists(ctx context.Context, name string) (bool, error) {
+	if _, err := e.inspectContainer(ctx, name); err != nil {
+		if nerdctl.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (e nerdctlEngine) IsRunning(ctx context.Context, name string) (bool, error) {
+	ctr, err := e.inspectContainer(ctx, name)
+	if err != nil {
+		if nerdctl.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return ctr.State != nil && ctr.State.Running, nil
+}
+
+// StartEnvd creates the container for the given tag and container name.
+func (e nerdctlEngine) StartEnvd(ctx context.Context, tag, name, buildContext string,
+	gpuEnabled bool, numGPUs int, sshPortInHost int, g ir.Graph, timeout time.Duration,
+	mountOptionsStr []string) (string, string, error) {
+	config, hostConfig, err := containerConfig(e.context, tag, name, buildContext,
+		gpuEnabled, numGPUs, sshPortInHost, g, mountOptionsStr)
+	if err != nil {
+		return "", "", err
+	}
+	log.WithFields(log.Fields{
+		"tag":         tag,
+		"container":   name,
+		"working-dir": config.WorkingDir,
+	}).Debugf("starting %s container by nerdctl", name)
+
+	if _, err := e.Output(ctx, nerdctlRunArgs(name, config, hostConfig)...); err != nil {
+		if strings.Contains(err.Error(), "address already in use") {
+			return "", "", errdefs.New(errdefs.PortAllocated)
+		}
+		return "", "", errors.Wrap(err, "failed to run the container")
+	}
+	if err := e.WaitUntilRunning(ctx, name, timeout); err != nil {
+		return "", "", errdefs.Wrap(
+			errors.Wrap(err, "failed to wait until the container is running"),
+			errdefs.ContainerNotRunning)
+	}
+	ctr, err := e.inspectContainer(ctx, name)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to inspect the container")
+	}
+	ip := ""
+	if ctr.NetworkSettings != nil {
+		ip = ctr.NetworkSettings.IPAddress
+	}
+	return name, ip, nil
+}
+
+func (e nerdctlEngine) WaitUntilRunning(ctx context.Context,
+	name string, timeout time.Duration) error {
+	logger := log.WithField("container", name)
+	logger.Debug("waiting to start")
+	ctxTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		select {
+		case <-time.After(waitingInternal):
+			isRunning, err := e.IsRunning(ctxTimeout, name)
+			if err != nil {
+				return errors.Wrap(err, "failed to check if container is running")
+			}
+			if isRunning {
+				logger.Debug("the container is running")
+				return nil
+			}
+		case <-ctxTimeout.Done():
+			return errors.Errorf("timeout %s: container did not start", timeout)
+		}
+	}
+}
+
+// nerdctlRunArgs returns the arguments of nerdctl run, which creates the
+// container of the docker configs.
+func nerdctlRunArgs(name string, config *container.Config,
+	hostConfig *container.HostConfig) []string {
+	args := []string{"run", "-d", "--name", name}
+	if config.User != "" {
+		args = append(args, "--user", config.User)
+	}
+	if config.WorkingDir != "" {
+		args = append(args, "--workdir", config.WorkingDir)
+	}
+	for _, kv := range config.Env {
+		args = append(args, "-e", kv)
+	}
+	keys := make([]string, 0, len(config.Labels))
+	for k := range config.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, config.Labels[k]))
+	}
+	for _, m := range hostConfig.Mounts {
+		v := fmt.Sprintf("%s:%s", m.Source, m.Target)
+		if m.ReadOnly {
+			v += ":ro"
+		}
+		args = append(args, "-v", v)
+	}
+	ports := make([]string, 0, len(hostConfig.PortBindings))
+	for port := range hostConfig.PortBindings {
+		ports = append(ports, string(port))
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		for _, b := range hostConfig.PortBindings[nat.Port(port)] {
+			args = append(args, "-p", fmt.Sprintf("%s:%s:%s", b.HostIP, b.HostPort, port))
+		}
+	}
+	if hostConfig.RestartPolicy.Name != "" {
+		args = append(args, "--restart", hostConfig.RestartPolicy.Name)
+	}
+	if hostConfig.LogConfig.Type != "" {
+		args = append(args, "--log-driver", hostConfig.LogConfig.Type)
+		opts := make([]string, 0, len(hostConfig.LogConfig.Config))
+		for k, v := range hostConfig.LogConfig.Config {
+			opts = append(opts, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(opts)
+		for _, opt := range opts {
+			args = append(args, "--log-opt", opt)
+		}
+	}
+	for _, r := range hostConfig.DeviceRequests {
+		gpus := "all"
+		if r.Count > 0 {
+			gpus = strconv.Itoa(r.Count)
+		}
+		args = append(args, "--gpus", gpus)
+	}
+	return append(args, config.Image)
+}
+
+// uniqueFields returns the unique fields of the output, e.g. the IDs.
+func uniqueFields(out []byte) []string {
+	seen := map[string]bool{}
+	fields := []string{}
+	for _, f := range strings.Fields(string(out)) {
+		if !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+func TestNerdctlRunArgs(t *testing.T) {
+	config := &container.Config{
+		Image:      "mnist:dev",
+		User:       "envd",
+		WorkingDir: "/home/envd/mnist",
+		Env:        []string{"HF_TOKEN=token"},
+		Labels: map[string]string{
+			types.ContainerLabelName:    "mnist",
+			types.ContainerLabelSSHPort: "2222",
+		},
+	}
+	hostConfig := &container.HostConfig{
+		Mounts: []mount.Mount{
+			{Type: mount.TypeBind, Source: "/src/mnist", Target: "/home/envd/mnist"},
+			{Type: mount.TypeBind, Source: "/src/key", Target: "/etc/key", ReadOnly: true},
+		},
+		PortBindings: nat.PortMap{
+			"2222/tcp": []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: "2222"}},
+		},
+		RestartPolicy: container.RestartPolicy{Name: "always"},
+	}
+	hostConfig.DeviceRequests = deviceRequests(-1)
+	expected := []string{
+		"run", "-d", "--name", "mnist",
+		"--user", "envd",
+		"--workdir", "/home/envd/mnist",
+		"-e", "HF_TOKEN=token",
+		"--label", types.ContainerLabelName + "=mnist",
+		"--label", types.ContainerLabelSSHPort + "=2222",
+		"-v", "/src/mnist:/home/envd/mnist",
+		"-v", "/src/key:/etc/key:ro",
+		"-p", "127.0.0.1:2222:2222/tcp",
+		"--restart", "always",
+		"--gpus", "all",
+		"mnist:dev",
+	}
+	if args := nerdctlRunArgs("mnist", config, hostConfig); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+}
+
+func TestNerdctlSummaries(t *testing.T) {
+	ctrs := []dockertypes.ContainerJSON{}
+	// The output of nerdctl container inspect.
+	if err := json.Unmarshal([]byte(`[{
+		"Id": "abc",
+		"Created": "2022-10-01T08:00:00.000000000Z",
+		"Image": "mnist:dev",
+		"Name": "mnist",
+		"State": {"Status": "running", "Running": true},
+		"Config": {"Labels": {"ai.tensorchord.envd.name": "mnist"}}
+	}]`), &ctrs); err != nil {
+		t.Fatal(err)
+	}
+	c := containerSummary(ctrs[0])
+	if c.ID != "abc" || c.Image != "mnist:dev" || c.State != "running" ||
+		c.Labels[types.ContainerLabelName] != "mnist" || c.Created == 0 {
+		t.Errorf("unexpected container %+v", c)
+	}
+
+	img := imageSummary(dockertypes.ImageInspect{
+		ID:       "sha256:abc",
+		RepoTags: []string{"mnist:dev"},
+		Created:  "2022-10-01T08:00:00Z",
+		Config: &container.Config{
+			Labels: map[string]string{types.ImageLabelVendor: types.ImageVendorEnvd},
+		},
+	})
+	if img.Created == 0 || img.Labels[types.ImageLabelVendor] != types.ImageVendorEnvd {
+		t.Errorf("unexpected image %+v", img)
+	}
+}
+
+// fakeNerdctl records the commands and returns the output by the command.
+type fakeNerdctl struct {
+	outputs map[string]string
+	cmds    []string
+}
+
+func (f *fakeNerdctl) Output(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := strings.Join(args, " ")
+	f.cmds = append(f.cmds, cmd)
+	return []byte(f.outputs[cmd]), nil
+}
+
+func (f *fakeNerdctl) Load(ctx context.Context, r io.Reader) error {
+	return nil
+}
+
+func TestNerdctlRemoveVolume(t *testing.T) {
+	f := &fakeNerdctl{outputs: map[string]string{
+		"volume ls -q": "envd_state_mnist\nenvd_pre_commit\n",
+	}}
+	e := nerdctlEngine{Client: f}
+	if err := e.RemoveVolume(context.TODO(), "envd_state_mnist"); err != nil {
+		t.Fatal(err)
+	}
+	// The volume which does not exist is skipped.
+	if err := e.RemoveVolume(context.TODO(), "envd_state_other"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"volume ls -q", "volume rm envd_state_mnist", "volume ls -q"}
+	if !reflect.DeepEqual(f.cmds, expected) {
+		t.Errorf("expected commands %v, got %v", expected, f.cmds)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+// resourcesProbe lists the GPUs and gets the available memory of the host.
+// nvidia-smi may be missing on the CPU hosts, thus its error is ignored.
+const resourcesProbe = "nvidia-smi -L 2>/dev/null; grep MemAvailable /proc/meminfo"
+
+// GetResources returns the GPUs and the memory of the docker host. The GPUs
+// and the available memory are queried by nvidia-smi and /proc/meminfo on
+// the host, locally or over ssh, thus they are unknown for the tcp hosts.
+func (e dockerEngine) GetResources(ctx context.Context) (*types.HostResources, error) {
+	info, err := e.Info(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get docker info")
+	}
+	res := &types.HostResources{
+		Context:    e.context,
+		Memory:     info.MemTotal,
+		FreeMemory: info.MemTotal,
+	}
+
+	cmd, err := hostCommand(ctx, e.DaemonHost(), resourcesProbe)
+	if err != nil {
+		log.Debugf("skip probing the GPUs: %s", err)
+		return res, nil
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to probe the resources of %s", e.DaemonHost())
+	}
+	gpus, free := parseResourcesProbe(out)
+	res.GPUs = gpus
+	if free > 0 {
+		res.FreeMemory = free
+	}
+
+	requested, err := e.requestedGPUs(ctx, gpus)
+	if err != nil {
+		return nil, err
+	}
+	res.FreeGPUs = gpus - requested
+	if res.FreeGPUs < 0 {
+		res.FreeGPUs = 0
+	}
+	return res, nil
+}
+
+// requestedGPUs returns the number of the GPUs requested by the running
+// envd environments, the count -1 requests all the GPUs.
+func (e dockerEngine) requestedGPUs(ctx context.Context, total int) (int, error) {
+	ctrs, err := e.ContainerList(ctx, dockertypes.ContainerListOptions{
+		Filters: dockerFilters(false),
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list containers")
+	}
+	requested := 0
+	for _, ctr := range ctrs {
+		c, err := e.ContainerInspect(ctx, ctr.ID)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to inspect the container")
+		}
+		for _, r := range c.HostConfig.DeviceRequests {
+			switch {
+			case len(r.DeviceIDs) > 0:
+				requested += len(r.DeviceIDs)
+			case r.Count < 0:
+				requested += total
+			default:
+				requested += r.Count
+			}
+		}
+	}
+	return requested, nil
+}
+
+// hostCommand returns the command to run the script on the docker host.
+func hostCommand(ctx context.Context, host, script string) (*exec.Cmd, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the docker host %s", host)
+	}
+	switch u.Scheme {
+	case "unix":
+		return exec.CommandContext(ctx, "sh", "-c", script), nil
+	case "ssh":
+		// The same as docker, the system ssh client is used thus the
+		// ssh config of the user is respected.
+		args := []string{"-o", "BatchMode=yes"}
+		if u.Port() != "" {
+			args = append(args, "-p", u.Port())
+		}
+		target := u.Hostname()
+		if u.User != nil {
+			target = u.User.Username() + "@" + target
+		}
+		args = append(args, target, script)
+		return exec.CommandContext(ctx, "ssh", args...), nil
+	default:
+		return nil, errors.Newf("cannot run the command on the docker host %s", host)
+	}
+}
+
+// parseResourcesProbe returns the number of the GPUs and the available
+// memory in bytes from the output of resourcesProbe.
+func parseResourcesProbe(out []byte) (int, int64) {
+	gpus := 0
+	var free int64
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "GPU "):
+			gpus++
+		case strings.HasPrefix(line, "MemAvailable:"):
+			// e.g. MemAvailable:   12345678 kB
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			free = kb * units.KiB
+		}
+	}
+	return gpus, free
+}
+
+// Place returns the context to run the environment, which has enough free
+// GPUs and memory, along with the resources of all the probed contexts.
+// The contexts whose runner is not docker, or cannot be probed, are skipped.
+func Place(ctx context.Context, contexts []types.Context,
+	gpus int, memory int64) (*types.Context, []types.HostResources, error) {
+	resources := []types.HostResources{}
+	for i := range contexts {
+		c := contexts[i]
+		logger := log.WithField("context", c.Name)
+		if c.Runner != types.RunnerTypeDocker {
+			logger.Debugf("skip the context with the runner %s", c.Runner)
+			continue
+		}
+		engine, err := New(ctx, Options{Context: &c})
+		if err != nil {
+			logger.Warnf("skip the context: %s", err)
+			continue
+		}
+		res, err := engine.GetResources(ctx)
+		if err != nil {
+			logger.Warnf("skip the context: %s", err)
+			continue
+		}
+		logger.WithField("resources", res).Debug("probed the resources")
+		resources = append(resources, *res)
+	}
+
+	res, err := choosePlacement(resources, gpus, memory)
+	if err != nil {
+		return nil, resources, err
+	}
+	for i := range contexts {
+		if contexts[i].Name == res.Context {
+			return &contexts[i], resources, nil
+		}
+	}
+	return nil, resources, errors.Newf("context %s is not found", res.Context)
+}
+
+// choosePlacement returns the host with enough free GPUs and memory. The
+// host with the fewest free GPUs, then the most free memory, is preferred,
+// thus the GPU hosts are kept for the environments requesting more GPUs.
+// gpus -1 requests all the GPUs, thus at least one GPU is required.
+func choosePlacement(resources []types.HostResources,
+	gpus int, memory int64) (*types.HostResources, error) {
+	if gpus < 0 {
+		gpus = 1
+	}
+	candidates := []types.HostResources{}
+	for _, res := range resources {
+		if res.FreeGPUs >= gpus && res.FreeMemory >= memory {
+			candidates = append(candidates, res)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.Newf(
+			"no context has %d free GPUs and %s free memory in the %d probed contexts",
+			gpus, units.BytesSize(float64(memory)), len(resources))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].FreeGPUs != candidates[j].FreeGPUs {
+			return candidates[i].FreeGPUs < candidates[j].FreeGPUs
+		}
+		return candidates[i].FreeMemory > candidates[j].FreeMemory
+	})
+	return &candidates[0], nil
+}
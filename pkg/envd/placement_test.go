@@ -0,0 +1,76 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package envd
+
+import (
+	"testing"
+
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+func TestParseResourcesProbe(t *testing.T) {
+	out := []byte(`GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-1)
+GPU 1: NVIDIA A100-SXM4-40GB (UUID: GPU-2)
+MemAvailable:   16384 kB
+`)
+	gpus, free := parseResourcesProbe(out)
+	if gpus != 2 || free != 16384*1024 {
+		t.Errorf("expected 2 GPUs and 16MiB, got %d GPUs and %d", gpus, free)
+	}
+
+	gpus, free = parseResourcesProbe([]byte("MemAvailable: 1024 kB\n"))
+	if gpus != 0 || free != 1024*1024 {
+		t.Errorf("expected no GPU and 1MiB, got %d GPUs and %d", gpus, free)
+	}
+}
+
+func TestChoosePlacement(t *testing.T) {
+	resources := []types.HostResources{
+		{Context: "cpu", FreeMemory: 64 << 30},
+		{Context: "gpu-small", GPUs: 2, FreeGPUs: 1, FreeMemory: 16 << 30},
+		{Context: "gpu-large", GPUs: 8, FreeGPUs: 4, FreeMemory: 32 << 30},
+	}
+	testcases := []struct {
+		gpus     int
+		memory   int64
+		expected string
+	}{
+		{0, 0, "cpu"},
+		{1, 0, "gpu-small"},
+		{1, 20 << 30, "gpu-large"},
+		{-1, 0, "gpu-small"},
+		{2, 0, "gpu-large"},
+		{8, 0, ""},
+		{0, 128 << 30, ""},
+	}
+	for _, tc := range testcases {
+		res, err := choosePlacement(resources, tc.gpus, tc.memory)
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("expected no placement for %d GPUs and %d, got %s",
+					tc.gpus, tc.memory, res.Context)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to place %d GPUs and %d: %v", tc.gpus, tc.memory, err)
+			continue
+		}
+		if res.Context != tc.expected {
+			t.Errorf("expected %s for %d GPUs and %d, got %s",
+				tc.expected, tc.gpus, tc.memory, res.Context)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package errdefs defines the errors with the remediation hints, thus the
+// CLI can tell the users what to do next.
+package errdefs
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	docsURL           = "https://envd.tensorchord.ai/"
+	gettingStartedURL = "https://envd.tensorchord.ai/guide/getting-started.html"
+)
+
+// Hint is the remediation of a kind of failure.
+type Hint struct {
+	// Cause is the short description of what went wrong.
+	Cause string
+	// Suggestion tells the users what to do next.
+	Suggestion string
+	// DocsURL is the link to the related documentation, it is optional.
+	DocsURL string
+}
+
+var (
+	BuildkitdUnavailable = Hint{
+		Cause: "cannot connect to the buildkitd",
+		Suggestion: "Run `envd bootstrap` to start the buildkitd, " +
+			"or check the builder of the current context with `envd context ls`",
+		DocsURL: gettingStartedURL,
+	}
+	DockerUnavailable = Hint{
+		Cause: "cannot connect to the docker daemon",
+		Suggestion: "Make sure the docker daemon is running, " +
+			"or set DOCKER_HOST to the address of the daemon",
+		DocsURL: gettingStartedURL,
+	}
+	NerdctlUnavailable = Hint{
+		Cause: "cannot run nerdctl",
+		Suggestion: "Install nerdctl and make sure the containerd is running, " +
+			"or set the containerd socket by `envd context create --runner-address`",
+		DocsURL: "https://github.com/containerd/nerdctl",
+	}
+	DockerPermissionDenied = Hint{
+		Cause:      "the current user has no access to the docker daemon",
+		Suggestion: "Add the current user to the docker group, and then log out and log back in",
+		DocsURL:    "https://docs.docker.com/engine/install/linux-postinstall/",
+	}
+	MarketplaceUnavailable = Hint{
+		Cause: "failed to download the vscode extension",
+		Suggestion: "Check the network and the extension ID (i.e. `publisher.extension-version`), " +
+			"the extension may not exist in the marketplace",
+		DocsURL: docsURL,
+	}
+	PortAllocated = Hint{
+		Cause: "port is already allocated in the host",
+		Suggestion: "Stop the process or the environment using the port, " +
+			"e.g. `envd destroy`, or expose another host port",
+	}
+	ContainerNotRunning = Hint{
+		Cause:      "the environment did not start",
+		Suggestion: "Check the logs of the container with `docker logs <name>`",
+	}
+)
+
+// Error is the error with the remediation hint.
+type Error struct {
+	Hint
+	err error
+}
+
+func (e *Error) Error() string {
+	if e.err == nil {
+		return e.Cause
+	}
+	return fmt.Sprintf("%s: %v", e.Cause, e.err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// New returns the error of the hint.
+func New(h Hint) error {
+	return &Error{Hint: h}
+}
+
+// Wrap annotates the error with the hint. It returns nil if err is nil.
+func Wrap(err error, h Hint) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Hint: h, err: err}
+}
+
+// GetHint returns the innermost hint in the error chain, which is the
+// most specific one, e.g. the docker daemon is not running rather than
+// the buildkitd is unavailable.
+func GetHint(err error) (Hint, bool) {
+	var e *Error
+	if !errors.As(err, &e) {
+		return Hint{}, false
+	}
+	for {
+		var inner *Error
+		if !errors.As(e.err, &inner) {
+			return e.Hint, true
+		}
+		e = inner
+	}
+}
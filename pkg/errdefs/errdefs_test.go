@@ -0,0 +1,50 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errdefs
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrap(t *testing.T) {
+	assert.Nil(t, Wrap(nil, PortAllocated))
+
+	err := errors.Wrap(Wrap(errors.New("connection refused"), BuildkitdUnavailable),
+		"failed to create buildkit client")
+	assert.Equal(t,
+		"failed to create buildkit client: cannot connect to the buildkitd: connection refused",
+		err.Error())
+	assert.Equal(t, "connection refused", errors.Cause(err).Error())
+
+	h, ok := GetHint(err)
+	assert.True(t, ok)
+	assert.Equal(t, BuildkitdUnavailable, h)
+}
+
+func TestGetHint(t *testing.T) {
+	_, ok := GetHint(errors.New("unknown"))
+	assert.False(t, ok)
+
+	h, ok := GetHint(errors.Wrap(New(PortAllocated), "failed to start"))
+	assert.True(t, ok)
+	assert.Equal(t, PortAllocated.Cause, h.Cause)
+
+	h, ok = GetHint(Wrap(Wrap(errors.New("refused"), DockerUnavailable), BuildkitdUnavailable))
+	assert.True(t, ok)
+	assert.Equal(t, DockerUnavailable, h)
+}
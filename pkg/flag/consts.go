@@ -16,8 +16,15 @@ package flag
 
 const (
 	FlagCacheDir           = "cache-dir"
+	FlagBuilder            = "builder"
+	FlagBuilderTLSCA       = "builder-tls-ca"
+	FlagBuilderTLSCert     = "builder-tls-cert"
+	FlagBuilderTLSKey      = "builder-tls-key"
+	FlagBuilderTLSName     = "builder-tls-server-name"
 	FlagBuildkitdImage     = "buildkitd-image"
 	FlagDebug              = "debug"
+	FlagLogLevel           = "log-level"
+	FlagLogFormat          = "log-format"
 	FlagBuildContext       = "build-context"
 	FlagDockerOrganization = "docker-organization"
 )
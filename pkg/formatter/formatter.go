@@ -0,0 +1,88 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package formatter renders sizes, durations and tables for the
+// command line output, so that all the commands look the same.
+package formatter
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/olekukonko/tablewriter"
+)
+
+const none = "<none>"
+
+// HumanSize returns a human-readable size, e.g. 1.23GB.
+func HumanSize(bytes int64) string {
+	return units.HumanSizeWithPrecision(float64(bytes), 3)
+}
+
+// HumanDuration returns a human-readable precise duration, e.g. 3.2s, 1m5s.
+func HumanDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
+
+// CreatedSince returns the approximate time since the unix timestamp,
+// e.g. 2 hours ago.
+func CreatedSince(created int64) string {
+	createdAt := time.Unix(created, 0)
+
+	if createdAt.IsZero() {
+		return ""
+	}
+
+	return units.HumanDuration(time.Now().UTC().Sub(createdAt)) + " ago"
+}
+
+// StringOrNone returns <none> if the string is empty.
+func StringOrNone(s string) string {
+	if s == "" {
+		return none
+	}
+	return s
+}
+
+// NewTable creates a borderless table aligned with tabs.
+func NewTable(w io.Writer, headers []string) *tablewriter.Table {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(headers)
+
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetTablePadding("\t") // pad with tabs
+	table.SetNoWhiteSpace(true)
+
+	return table
+}
+
+// NewBorderedTable creates a table with the top and bottom borders.
+func NewBorderedTable(w io.Writer, headers []string) *tablewriter.Table {
+	table := NewTable(w, headers)
+	table.SetBorder(true)
+	return table
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package formatter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHumanDuration(t *testing.T) {
+	require.Equal(t, "0.5s", HumanDuration(500*time.Millisecond))
+	require.Equal(t, "42.0s", HumanDuration(42*time.Second))
+	require.Equal(t, "1m5s", HumanDuration(65*time.Second+300*time.Millisecond))
+	require.Equal(t, "2h0m0s", HumanDuration(2*time.Hour))
+}
+
+func TestHumanSize(t *testing.T) {
+	require.Equal(t, "0B", HumanSize(0))
+	require.Equal(t, "1.23GB", HumanSize(1234567890))
+}
+
+func TestStringOrNone(t *testing.T) {
+	require.Equal(t, "<none>", StringOrNone(""))
+	require.Equal(t, "11.6", StringOrNone("11.6"))
+}
+
+func TestNewTable(t *testing.T) {
+	buf := &bytes.Buffer{}
+	table := NewTable(buf, []string{"Name", "Size"})
+	table.Append([]string{"mnist", HumanSize(1000)})
+	table.Render()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasPrefix(lines[0], "NAME"))
+	require.True(t, strings.HasPrefix(lines[1], "mnist"))
+}
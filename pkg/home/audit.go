@@ -0,0 +1,92 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package home
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/types"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+type auditManager interface {
+	AuditFile() string
+	// AppendAudit appends the record to the audit log.
+	AppendAudit(r types.AuditRecord) error
+	// ListAudit returns the records in the audit log in order.
+	ListAudit() ([]types.AuditRecord, error)
+}
+
+func (m *generalManager) initAudit() error {
+	// $HOME/.config/envd/audit.log is created by the first record.
+	audit, err := fileutil.ConfigFile("audit.log")
+	if err != nil {
+		return errors.Wrap(err, "failed to get audit file")
+	}
+	m.auditFile = audit
+	return nil
+}
+
+func (m generalManager) AuditFile() string {
+	return m.auditFile
+}
+
+func (m generalManager) AppendAudit(r types.AuditRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the audit record")
+	}
+	// The log is only appended, and one record is written at once thus the
+	// concurrent commands do not interleave.
+	file, err := os.OpenFile(m.auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open audit file")
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write audit file")
+	}
+	return nil
+}
+
+func (m generalManager) ListAudit() ([]types.AuditRecord, error) {
+	records := []types.AuditRecord{}
+	file, err := os.Open(m.auditFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, errors.Wrap(err, "failed to open audit file")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r types.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, errors.Wrap(err, "failed to decode audit file")
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read audit file")
+	}
+	return records, nil
+}
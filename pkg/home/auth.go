@@ -19,8 +19,8 @@ import (
 	"os"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/types"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
@@ -44,7 +44,7 @@ func (m *generalManager) initAuth() error {
 	_, err = os.Stat(m.authFile)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logrus.WithField("filename", m.authFile).Debug("Creating file")
+			log.WithField("filename", m.authFile).Debug("Creating file")
 			file, err := os.Create(m.authFile)
 			if err != nil {
 				return errors.Wrap(err, "failed to create file")
@@ -15,12 +15,15 @@
 package home
 
 import (
+	"context"
 	"encoding/gob"
 	"os"
+	"sort"
+	"sync"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
@@ -28,11 +31,32 @@ type cacheManager interface {
 	CacheDir() string
 	MarkCache(string, bool) error
 	Cached(string) bool
+	// CachedKeys returns the sorted keys of the cached assets.
+	CachedKeys() []string
+	// TouchCache records the access of the cached asset and its paths
+	// relative to the cache dir, which are removed when it is evicted.
+	TouchCache(key string, paths ...string) error
+	// ListCache returns the cached assets sorted by the keys.
+	ListCache() ([]CacheEntry, error)
+	// GCCache evicts the least recently used assets until the total size of
+	// the ones in the index is not larger than keepSize.
+	GCCache(keepSize int64) ([]CacheEntry, error)
+	// RemoveCache removes the cached asset and the paths in the index, thus
+	// it is downloaded again by the next build.
+	RemoveCache(key string) error
 	CleanCache() error
 }
 
+// cacheLockName is the advisory lock of the cache status and the cache
+// index among the envd processes.
+const cacheLockName = "cache"
+
+// cacheMu guards the cache map, since the assets, e.g. the vscode plugins,
+// are downloaded concurrently.
+var cacheMu sync.Mutex
+
 func (m *generalManager) initCache() error {
-	// Create $HOME/.cache/envd/
+	// Create $HOME/.cache/envd/, or the relocated one, e.g. $ENVD_CACHE_DIR.
 	m.cacheDir = fileutil.DefaultCacheDir
 
 	cacheStatusFile, err := fileutil.CacheFile("cache.status")
@@ -43,7 +67,7 @@ func (m *generalManager) initCache() error {
 	_, err = os.Stat(m.cacheStatusFile)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logrus.WithField("filename", m.cacheStatusFile).Debug("Creating file")
+			log.WithField("filename", m.cacheStatusFile).Debug("Creating file")
 			file, err := os.Create(m.cacheStatusFile)
 			if err != nil {
 				return errors.Wrap(err, "failed to create file")
@@ -60,29 +84,87 @@ func (m *generalManager) initCache() error {
 		}
 	}
 
+	return m.loadCacheStatus()
+}
+
+// loadCacheStatus reloads the cache map, since the other envd processes may
+// cache the assets after the init.
+func (m generalManager) loadCacheStatus() error {
 	file, err := os.Open(m.cacheStatusFile)
 	if err != nil {
 		return errors.Wrap(err, "failed to open cache status file")
 	}
 	defer file.Close()
+	cacheMap := make(map[string]bool)
 	e := gob.NewDecoder(file)
-	if err := e.Decode(&m.cacheMap); err != nil {
+	if err := e.Decode(&cacheMap); err != nil {
 		return errors.Wrap(err, "failed to decode cache map")
 	}
+	for key := range m.cacheMap {
+		delete(m.cacheMap, key)
+	}
+	for key, cached := range cacheMap {
+		m.cacheMap[key] = cached
+	}
 	return nil
 }
 
+// lockCache acquires the lock of the cache status and the cache index,
+// which are shared by the envd processes, and reloads the cache map.
+func (m generalManager) lockCache() (func(), error) {
+	unlock, err := fileutil.Lock(context.Background(), cacheLockName)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.loadCacheStatus(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
 func (m generalManager) MarkCache(key string, cached bool) error {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	unlock, err := m.lockCache()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	m.cacheMap[key] = cached
 	return m.dumpCacheStatus()
 }
 
 func (m generalManager) Cached(key string) bool {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if err := m.loadCacheStatus(); err != nil {
+		log.Debugf("failed to reload the cache status: %s", err)
+	}
 	return m.cacheMap[key]
 }
 
+func (m generalManager) CachedKeys() []string {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if err := m.loadCacheStatus(); err != nil {
+		log.Debugf("failed to reload the cache status: %s", err)
+	}
+	keys := []string{}
+	for key, cached := range m.cacheMap {
+		if cached {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (m *generalManager) dumpCacheStatus() error {
-	file, err := os.Create(m.cacheStatusFile)
+	// The status is written aside and renamed, thus the other envd
+	// processes never read the partial one.
+	tmp := m.cacheStatusFile + ".tmp"
+	file, err := os.Create(tmp)
 	if err != nil {
 		return errors.Wrap(err, "failed to create cache status file")
 	}
@@ -92,6 +174,12 @@ func (m *generalManager) dumpCacheStatus() error {
 	if err := e.Encode(m.cacheMap); err != nil {
 		return errors.Wrap(err, "failed to encode cache map")
 	}
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "failed to close cache status file")
+	}
+	if err := os.Rename(tmp, m.cacheStatusFile); err != nil {
+		return errors.Wrap(err, "failed to write cache status file")
+	}
 	return nil
 }
 
@@ -103,6 +191,6 @@ func (m generalManager) CleanCache() error {
 	if m.cacheDir == "" {
 		return nil
 	}
-	logrus.Debug("cleaning up host cache directory")
+	log.Debug("cleaning up host cache directory")
 	return os.RemoveAll(m.cacheDir)
 }
@@ -15,17 +15,28 @@
 package home
 
 import (
+	"os"
+
 	"github.com/cockroachdb/errors"
 
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
+const (
+	// orgConfigFile is the defaults file pushed by the organization, e.g.
+	// by the device management.
+	orgConfigFile = "/etc/envd/config.envd"
+	// orgConfigEnv overrides the location of the organization defaults.
+	orgConfigEnv = "ENVD_ORG_CONFIG"
+)
+
 type configManager interface {
 	ConfigFile() string
+	OrgConfigFile() string
 }
 
 func (m *generalManager) initConfig() error {
-	// Create $HOME/.config/envd/config.envd
+	// Create $HOME/.config/envd/config.envd, or in $ENVD_CONFIG_DIR.
 	config, err := fileutil.ConfigFile("config.envd")
 	if err != nil {
 		return errors.Wrap(err, "failed to get config file")
@@ -41,3 +52,17 @@ func (m *generalManager) initConfig() error {
 func (m generalManager) ConfigFile() string {
 	return m.configFile
 }
+
+// OrgConfigFile returns the organization defaults, which is evaluated before
+// the user config, thus the user config and the build file take precedence.
+// It is empty if there is no such file.
+func (m generalManager) OrgConfigFile() string {
+	config := orgConfigFile
+	if env := os.Getenv(orgConfigEnv); env != "" {
+		config = env
+	}
+	if exists, err := fileutil.FileExists(config); err != nil || !exists {
+		return ""
+	}
+	return config
+}
@@ -19,8 +19,8 @@ import (
 	"os"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/types"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
@@ -32,6 +32,8 @@ type contextManager interface {
 	ContextGetCurrent() (*types.Context, error)
 	ContextCreate(c types.Context, use bool) error
 	ContextRemove(name string) error
+	// ContextSetPyPICache enables or disables the PyPI cache in the current context.
+	ContextSetPyPICache(enabled bool) error
 }
 
 func (m *generalManager) initContext() error {
@@ -46,7 +48,7 @@ func (m *generalManager) initContext() error {
 	_, err = os.Stat(m.contextFile)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logrus.WithField("filename", m.contextFile).Debug("Creating file")
+			log.WithField("filename", m.contextFile).Debug("Creating file")
 			file, err := os.Create(m.contextFile)
 			if err != nil {
 				return errors.Wrap(err, "failed to create file")
@@ -95,13 +97,22 @@ func (m *generalManager) ContextCreate(ctx types.Context, use bool) error {
 		}
 	}
 	switch ctx.Builder {
-	case types.BuilderTypeDocker, types.BuilderTypeKubernetes, types.BuilderTypeTCP:
+	case types.BuilderTypeDocker, types.BuilderTypeKubernetes, types.BuilderTypeTCP,
+		types.BuilderTypeUnix:
 		break
 	default:
 		return errors.New("unknown builder type")
 	}
+	if ctx.BuilderTLS != nil {
+		if ctx.Builder != types.BuilderTypeTCP {
+			return errors.New("TLS is only supported by the tcp builder")
+		}
+		if err := ctx.BuilderTLS.Validate(); err != nil {
+			return err
+		}
+	}
 	switch ctx.Runner {
-	case types.RunnerTypeDocker, types.RunnerTypeEnvdServer:
+	case types.RunnerTypeDocker, types.RunnerTypeEnvdServer, types.RunnerTypeNerdctl:
 		break
 	default:
 		return errors.New("unknown runner type")
@@ -141,6 +152,16 @@ func (m *generalManager) ContextUse(name string) error {
 	return errors.Newf("context \"%s\" does not exist", name)
 }
 
+func (m *generalManager) ContextSetPyPICache(enabled bool) error {
+	for i, c := range m.context.Contexts {
+		if c.Name == m.context.Current {
+			m.context.Contexts[i].PyPICache = enabled
+			return m.dumpContext()
+		}
+	}
+	return errors.New("no current context")
+}
+
 func (m *generalManager) dumpContext() error {
 	file, err := os.Create(m.contextFile)
 	if err != nil {
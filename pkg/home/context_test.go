@@ -58,6 +58,13 @@ var _ = Describe("context test", func() {
 			Expect(*c.RunnerAddress).To(Equal(testRunnerAddress))
 		})
 
+		It("should set the PyPI cache of the current context", func() {
+			Expect(GetManager().ContextSetPyPICache(true)).To(Succeed())
+			c, err := GetManager().ContextGetCurrent()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.PyPICache).To(BeTrue())
+		})
+
 		It("cannot delete the current context", func() {
 			err := GetManager().ContextRemove(testContext)
 			Expect(err).To(HaveOccurred())
@@ -93,4 +100,36 @@ var _ = Describe("context test", func() {
 			Expect(GetManager().ContextRemove(testContext)).To(Succeed())
 		})
 	})
+
+	Describe("create with TLS", func() {
+		It("should only accept the valid TLS of the tcp builder", func() {
+			tlsContext := c
+			tlsContext.Name = "envd_home_test_tls"
+			tlsContext.BuilderTLS = &types.BuilderTLS{Cert: "/certs/cert.pem"}
+			Expect(GetManager().ContextCreate(tlsContext, false)).NotTo(Succeed())
+
+			tlsContext.BuilderTLS = &types.BuilderTLS{CACert: "/certs/ca.pem"}
+			tlsContext.Builder = types.BuilderTypeDocker
+			Expect(GetManager().ContextCreate(tlsContext, false)).NotTo(Succeed())
+
+			tlsContext.Builder = types.BuilderTypeTCP
+			Expect(GetManager().ContextCreate(tlsContext, false)).To(Succeed())
+			DeferCleanup(GetManager().ContextRemove, tlsContext.Name)
+			contexts, err := GetManager().ContextList()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(contexts.Contexts[len(contexts.Contexts)-1].BuilderTLS.CACert).To(Equal("/certs/ca.pem"))
+		})
+	})
+
+	Describe("create with containerd", func() {
+		It("should accept the host buildkitd and the nerdctl runner", func() {
+			containerdContext := c
+			containerdContext.Name = "envd_home_test_containerd"
+			containerdContext.Builder = types.BuilderTypeUnix
+			containerdContext.BuilderAddress = "/run/buildkit/buildkitd.sock"
+			containerdContext.Runner = types.RunnerTypeNerdctl
+			Expect(GetManager().ContextCreate(containerdContext, false)).To(Succeed())
+			DeferCleanup(GetManager().ContextRemove, containerdContext.Name)
+		})
+	})
 })
@@ -19,7 +19,8 @@ import (
 	"path/filepath"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 type dataManager interface {
@@ -29,7 +30,7 @@ type dataManager interface {
 func (m *generalManager) InitDataDir(name string) (string, error) {
 	newDataDir := filepath.Join(m.CacheDir(), "data", name)
 	if _, err := os.Stat(newDataDir); !os.IsNotExist(err) {
-		logrus.Infof("Data dir %s already exists, skipping creation", newDataDir)
+		log.Infof("Data dir %s already exists, skipping creation", newDataDir)
 		return newDataDir, nil
 	}
 
@@ -0,0 +1,251 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package home
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+// cacheIndexFile records the last access and the paths of the cached
+// assets, which are evicted by GCCache.
+const cacheIndexFile = "cache.index"
+
+// cacheIndexEntry is the cached asset in the index.
+type cacheIndexEntry struct {
+	// Paths are relative to the cache dir.
+	Paths      []string  `json:"paths"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+// CacheEntry is the cached asset, the paths and the last access are only
+// known if it is in the index.
+type CacheEntry struct {
+	Key        string
+	Paths      []string
+	Size       int64
+	LastAccess time.Time
+}
+
+func (m generalManager) cacheIndexPath() string {
+	return filepath.Join(m.cacheDir, cacheIndexFile)
+}
+
+func (m generalManager) readCacheIndex() (map[string]cacheIndexEntry, error) {
+	index := make(map[string]cacheIndexEntry)
+	data, err := os.ReadFile(m.cacheIndexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, errors.Wrap(err, "failed to read the cache index")
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, errors.Wrap(err, "failed to decode the cache index")
+	}
+	return index, nil
+}
+
+func (m generalManager) writeCacheIndex(index map[string]cacheIndexEntry) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the cache index")
+	}
+	// The index is written aside and renamed, thus it is never partial.
+	tmp := m.cacheIndexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write the cache index")
+	}
+	if err := os.Rename(tmp, m.cacheIndexPath()); err != nil {
+		return errors.Wrap(err, "failed to write the cache index")
+	}
+	return nil
+}
+
+func (m generalManager) TouchCache(key string, paths ...string) error {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	unlock, err := m.lockCache()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	index, err := m.readCacheIndex()
+	if err != nil {
+		return err
+	}
+	index[key] = cacheIndexEntry{
+		Paths:      paths,
+		LastAccess: time.Now(),
+	}
+	return m.writeCacheIndex(index)
+}
+
+func (m generalManager) ListCache() ([]CacheEntry, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if err := m.loadCacheStatus(); err != nil {
+		return nil, err
+	}
+	index, err := m.readCacheIndex()
+	if err != nil {
+		return nil, err
+	}
+	entries := []CacheEntry{}
+	for key, cached := range m.cacheMap {
+		if !cached {
+			continue
+		}
+		entry, err := m.cacheEntry(key, index[key])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+func (m generalManager) GCCache(keepSize int64) ([]CacheEntry, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	unlock, err := m.lockCache()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	index, err := m.readCacheIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]CacheEntry, 0, len(index))
+	var total int64
+	for key, ie := range index {
+		entry, err := m.cacheEntry(key, ie)
+		if err != nil {
+			return nil, err
+		}
+		total += entry.Size
+		candidates = append(candidates, entry)
+	}
+	// The least recently used one is evicted first.
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].LastAccess.Before(candidates[j].LastAccess)
+	})
+
+	evicted := []CacheEntry{}
+	for _, c := range candidates {
+		if total <= keepSize {
+			break
+		}
+		if err := m.removeCachePaths(c.Paths); err != nil {
+			return evicted, err
+		}
+		delete(index, c.Key)
+		delete(m.cacheMap, c.Key)
+		total -= c.Size
+		evicted = append(evicted, c)
+		log.WithField("cache", c.Key).Debugf("evicted %d bytes", c.Size)
+	}
+	if len(evicted) == 0 {
+		return evicted, nil
+	}
+	if err := m.writeCacheIndex(index); err != nil {
+		return evicted, err
+	}
+	if err := m.dumpCacheStatus(); err != nil {
+		return evicted, errors.Wrap(err, "failed to dump cache status")
+	}
+	return evicted, nil
+}
+
+func (m generalManager) RemoveCache(key string) error {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	unlock, err := m.lockCache()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	index, err := m.readCacheIndex()
+	if err != nil {
+		return err
+	}
+	if err := m.removeCachePaths(index[key].Paths); err != nil {
+		return err
+	}
+	delete(index, key)
+	delete(m.cacheMap, key)
+	if err := m.writeCacheIndex(index); err != nil {
+		return err
+	}
+	if err := m.dumpCacheStatus(); err != nil {
+		return errors.Wrap(err, "failed to dump cache status")
+	}
+	return nil
+}
+
+func (m generalManager) removeCachePaths(paths []string) error {
+	for _, p := range paths {
+		if err := os.RemoveAll(filepath.Join(m.cacheDir, p)); err != nil {
+			return errors.Wrapf(err, "failed to remove %s", p)
+		}
+	}
+	return nil
+}
+
+// cacheEntry returns the entry of the key with the size of its paths.
+func (m generalManager) cacheEntry(key string, ie cacheIndexEntry) (CacheEntry, error) {
+	entry := CacheEntry{
+		Key:        key,
+		Paths:      ie.Paths,
+		LastAccess: ie.LastAccess,
+	}
+	for _, p := range ie.Paths {
+		size, err := pathSize(filepath.Join(m.cacheDir, p))
+		if err != nil {
+			return entry, err
+		}
+		entry.Size += size
+	}
+	return entry, nil
+}
+
+// pathSize returns the size of the file, or the total size of the regular
+// files in the directory.
+func pathSize(path string) (int64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "failed to stat %s", path)
+	}
+	if info.IsDir() {
+		return fileutil.DirSize(path)
+	}
+	return info.Size(), nil
+}
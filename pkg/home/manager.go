@@ -18,8 +18,8 @@ import (
 	"sync"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 
+	"github.com/tensorchord/envd/pkg/log"
 	sshconfig "github.com/tensorchord/envd/pkg/ssh/config"
 	"github.com/tensorchord/envd/pkg/types"
 )
@@ -30,6 +30,7 @@ type Manager interface {
 	cacheManager
 	dataManager
 	authManager
+	auditManager
 }
 
 type generalManager struct {
@@ -38,13 +39,14 @@ type generalManager struct {
 	configFile      string
 	contextFile     string
 	authFile        string
+	auditFile       string
 
 	// TODO(gaocegege): Abstract CacheManager.
 	cacheMap map[string]bool
 	context  types.EnvdContext
 	auth     types.EnvdAuth
 
-	logger *logrus.Entry
+	logger *log.Entry
 }
 
 var (
@@ -94,11 +96,15 @@ func (m *generalManager) init() error {
 		return errors.Wrap(err, "failed to initialize auth")
 	}
 
+	if err := m.initAudit(); err != nil {
+		return errors.Wrap(err, "failed to initialize audit")
+	}
+
 	if err := sshconfig.GenerateKeys(); err != nil {
 		return errors.Wrap(err, "failed to generate ssh key")
 	}
 
-	m.logger = logrus.WithFields(logrus.Fields{
+	m.logger = log.WithFields(log.Fields{
 		"cache-dir":    m.cacheDir,
 		"config-file":  m.configFile,
 		"cache-status": m.cacheStatusFile,
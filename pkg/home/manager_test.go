@@ -57,6 +57,7 @@ var _ = Describe("home manager", func() {
 			Expect(Initialize()).NotTo(HaveOccurred())
 			m := GetManager()
 			m.(*generalManager).cacheMap = make(map[string]bool)
+			Expect(m.(*generalManager).dumpCacheStatus()).To(Succeed())
 			Expect(m.Cached("test")).To(BeFalse())
 			Expect(m.MarkCache("test", true)).To(Succeed())
 			Expect(m.Cached("test")).To(BeTrue())
@@ -65,5 +66,133 @@ var _ = Describe("home manager", func() {
 			m = GetManager()
 			Expect(m.Cached("test")).To(BeTrue())
 		})
+		It("should return the cached keys", func() {
+			Expect(Initialize()).NotTo(HaveOccurred())
+			m := GetManager()
+			m.(*generalManager).cacheMap = make(map[string]bool)
+			Expect(m.(*generalManager).dumpCacheStatus()).To(Succeed())
+			Expect(m.MarkCache("b", true)).To(Succeed())
+			Expect(m.MarkCache("a", true)).To(Succeed())
+			Expect(m.MarkCache("c", false)).To(Succeed())
+			Expect(m.CachedKeys()).To(Equal([]string{"a", "b"}))
+		})
+		It("should evict the least recently used assets", func() {
+			Expect(Initialize()).NotTo(HaveOccurred())
+			m := GetManager()
+			m.(*generalManager).cacheMap = make(map[string]bool)
+			Expect(m.(*generalManager).dumpCacheStatus()).To(Succeed())
+			Expect(os.RemoveAll(filepath.Join(m.CacheDir(), cacheIndexFile))).To(Succeed())
+			DeferCleanup(os.RemoveAll, filepath.Join(m.CacheDir(), cacheIndexFile))
+			for _, name := range []string{"gc-old", "gc-new"} {
+				Expect(os.MkdirAll(filepath.Join(m.CacheDir(), name), 0755)).To(Succeed())
+				DeferCleanup(os.RemoveAll, filepath.Join(m.CacheDir(), name))
+				Expect(os.WriteFile(filepath.Join(m.CacheDir(), name, "data"),
+					make([]byte, 100), 0644)).To(Succeed())
+				Expect(m.MarkCache(name, true)).To(Succeed())
+				Expect(m.TouchCache(name, name)).To(Succeed())
+			}
+
+			evicted, err := m.GCCache(200)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(evicted).To(BeEmpty())
+			evicted, err = m.GCCache(150)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(evicted).To(HaveLen(1))
+			Expect(evicted[0].Key).To(Equal("gc-old"))
+			Expect(evicted[0].Size).To(Equal(int64(100)))
+			Expect(m.Cached("gc-old")).To(BeFalse())
+			Expect(m.Cached("gc-new")).To(BeTrue())
+			exists, err := fileutil.DirExists(filepath.Join(m.CacheDir(), "gc-old"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		})
+		It("should remove the cached asset", func() {
+			Expect(Initialize()).NotTo(HaveOccurred())
+			m := GetManager()
+			Expect(os.MkdirAll(filepath.Join(m.CacheDir(), "rm-asset"), 0755)).To(Succeed())
+			DeferCleanup(os.RemoveAll, filepath.Join(m.CacheDir(), "rm-asset"))
+			Expect(m.MarkCache("rm-asset", true)).To(Succeed())
+			Expect(m.TouchCache("rm-asset", "rm-asset")).To(Succeed())
+
+			Expect(m.RemoveCache("rm-asset")).To(Succeed())
+			Expect(m.Cached("rm-asset")).To(BeFalse())
+			exists, err := fileutil.DirExists(filepath.Join(m.CacheDir(), "rm-asset"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+			entries, err := m.ListCache()
+			Expect(err).NotTo(HaveOccurred())
+			for _, e := range entries {
+				Expect(e.Key).NotTo(Equal("rm-asset"))
+			}
+		})
+		It("should see the assets cached by the other envd processes", func() {
+			Expect(Initialize()).NotTo(HaveOccurred())
+			m := GetManager()
+			other := &generalManager{
+				cacheDir:        m.CacheDir(),
+				cacheStatusFile: m.(*generalManager).cacheStatusFile,
+				cacheMap:        make(map[string]bool),
+			}
+			Expect(other.MarkCache("other-process", true)).To(Succeed())
+			DeferCleanup(m.MarkCache, "other-process", false)
+			Expect(m.Cached("other-process")).To(BeTrue())
+			Expect(m.MarkCache("this-process", true)).To(Succeed())
+			DeferCleanup(m.MarkCache, "this-process", false)
+			Expect(other.Cached("this-process")).To(BeTrue())
+			Expect(other.Cached("other-process")).To(BeTrue())
+		})
+		It("should list the cached assets with the sizes", func() {
+			Expect(Initialize()).NotTo(HaveOccurred())
+			m := GetManager()
+			m.(*generalManager).cacheMap = make(map[string]bool)
+			Expect(m.(*generalManager).dumpCacheStatus()).To(Succeed())
+			Expect(os.RemoveAll(filepath.Join(m.CacheDir(), cacheIndexFile))).To(Succeed())
+			DeferCleanup(os.RemoveAll, filepath.Join(m.CacheDir(), cacheIndexFile))
+			Expect(os.MkdirAll(filepath.Join(m.CacheDir(), "ls-tracked"), 0755)).To(Succeed())
+			DeferCleanup(os.RemoveAll, filepath.Join(m.CacheDir(), "ls-tracked"))
+			Expect(os.WriteFile(filepath.Join(m.CacheDir(), "ls-tracked", "data"),
+				make([]byte, 100), 0644)).To(Succeed())
+			Expect(m.MarkCache("ls-tracked", true)).To(Succeed())
+			Expect(m.TouchCache("ls-tracked", "ls-tracked")).To(Succeed())
+			Expect(m.MarkCache("ls-legacy", true)).To(Succeed())
+
+			entries, err := m.ListCache()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Key).To(Equal("ls-legacy"))
+			Expect(entries[0].Size).To(BeZero())
+			Expect(entries[0].LastAccess.IsZero()).To(BeTrue())
+			Expect(entries[1].Key).To(Equal("ls-tracked"))
+			Expect(entries[1].Size).To(Equal(int64(100)))
+			Expect(entries[1].Paths).To(Equal([]string{"ls-tracked"}))
+		})
+		It("should return the organization defaults if it exists", func() {
+			Expect(Initialize()).NotTo(HaveOccurred())
+			m := GetManager()
+			dir, err := os.MkdirTemp("", "envd-org")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.RemoveAll, dir)
+			org := filepath.Join(dir, "config.envd")
+			Expect(os.Setenv(orgConfigEnv, org)).To(Succeed())
+			DeferCleanup(os.Unsetenv, orgConfigEnv)
+			Expect(m.OrgConfigFile()).To(BeEmpty())
+			Expect(os.WriteFile(org, []byte("config.pip_index(url=\"https://mirror\")\n"), 0644)).To(Succeed())
+			Expect(m.OrgConfigFile()).To(Equal(org))
+		})
+		It("should append and list the audit records", func() {
+			Expect(Initialize()).NotTo(HaveOccurred())
+			m := GetManager()
+			Expect(os.RemoveAll(m.AuditFile())).NotTo(HaveOccurred())
+			records, err := m.ListAudit()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(BeEmpty())
+			Expect(m.AppendAudit(types.AuditRecord{Command: "up", Args: []string{"up"}})).To(Succeed())
+			Expect(m.AppendAudit(types.AuditRecord{Command: "destroy", Error: "failed"})).To(Succeed())
+			records, err = m.ListAudit()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0].Command).To(Equal("up"))
+			Expect(records[1].Error).To(Equal("failed"))
+		})
 	})
 })
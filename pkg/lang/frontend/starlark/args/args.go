@@ -0,0 +1,54 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+var (
+	logger = log.WithField("frontend", "starlark")
+)
+
+// Module exposes the build args passed by envd build --arg to the build file.
+var Module = &starlarkstruct.Module{
+	Name: "args",
+	Members: starlark.StringDict{
+		"get": starlark.NewBuiltin(ruleGet, ruleFuncGet),
+	},
+}
+
+func ruleFuncGet(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var defaultValue starlark.Value = starlark.None
+
+	if err := starlark.UnpackArgs(ruleGet, args, kwargs,
+		"name", &name, "default?", &defaultValue); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, name=%s", ruleGet, name)
+
+	value, ok := ir.BuildArg(name)
+	if !ok {
+		return defaultValue, nil
+	}
+	return starlark.String(value), nil
+}
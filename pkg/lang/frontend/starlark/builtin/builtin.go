@@ -14,7 +14,61 @@
 
 package builtin
 
+import (
+	"regexp"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"go.starlark.net/starlark"
+)
+
 const (
 	// BuildContextDir is the name of the directory that contains the build context.
 	BuildContextDir = "_build_context_dir"
+	// Sandbox is the thread local set when the build file is evaluated
+	// without side effects on the host, e.g. in envd inspect.
+	Sandbox = "_sandbox"
+	// Environments is the thread local of the build functions of the named
+	// environments declared by environment(name, build).
+	Environments = "_environments"
 )
+
+// The environment name is in the image tag and the container name.
+var environmentNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// IsSandbox returns true if the thread evaluates the build file in the sandbox.
+func IsSandbox(thread *starlark.Thread) bool {
+	sandbox, _ := thread.Local(Sandbox).(bool)
+	return sandbox
+}
+
+// RegisterEnvironment registers the build function of the named environment.
+func RegisterEnvironment(thread *starlark.Thread, name string, build starlark.Callable) error {
+	if !environmentNamePattern.MatchString(name) {
+		return errors.Newf("invalid environment name %q, it should match %s",
+			name, environmentNamePattern)
+	}
+	envs, _ := thread.Local(Environments).(map[string]starlark.Callable)
+	if envs == nil {
+		envs = make(map[string]starlark.Callable)
+		thread.SetLocal(Environments, envs)
+	}
+	if _, ok := envs[name]; ok {
+		return errors.Newf("environment %s is declared twice", name)
+	}
+	envs[name] = build
+	return nil
+}
+
+// Environment returns the build function of the named environment, or nil
+// if it is not declared. The names of all the declared ones are returned
+// for the error message.
+func Environment(thread *starlark.Thread, name string) (starlark.Callable, []string) {
+	envs, _ := thread.Local(Environments).(map[string]starlark.Callable)
+	names := make([]string, 0, len(envs))
+	for n := range envs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return envs[name], names
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builtin
+
+import (
+	"path/filepath"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+// WithLocation wraps the rule, thus where it is invoked in the build file is
+// recorded in the graph.
+func WithLocation(b *starlark.Builtin) *starlark.Builtin {
+	return starlark.NewBuiltin(b.Name(), func(thread *starlark.Thread, _ *starlark.Builtin,
+		args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		// The frame 0 is the rule itself, and the frame 1 is the caller.
+		if thread.CallStackDepth() > 1 {
+			pos := thread.CallFrame(1).Pos
+			ir.RecordLocation(b.Name(), pos.Filename(), int(pos.Line))
+		}
+		return b.CallInternal(thread, args, kwargs)
+	})
+}
+
+// WithLocations wraps all the rules in the module by WithLocation.
+func WithLocations(m *starlarkstruct.Module) *starlarkstruct.Module {
+	members := make(starlark.StringDict, len(m.Members))
+	for name, v := range m.Members {
+		if b, ok := v.(*starlark.Builtin); ok {
+			v = WithLocation(b)
+		}
+		members[name] = v
+	}
+	return &starlarkstruct.Module{Name: m.Name, Members: members}
+}
+
+// Deprecated records the deprecated usage of the rule with the position of
+// the caller for envd lint, and warns about it out of the sandbox.
+func Deprecated(thread *starlark.Thread, rule, message string) {
+	var filename string
+	var line int
+	if thread.CallStackDepth() > 1 {
+		pos := thread.CallFrame(1).Pos
+		filename, line = pos.Filename(), int(pos.Line)
+	}
+	if !IsSandbox(thread) {
+		log.Warnf("%s:%d: %s is deprecated, %s", filepath.Base(filename), line, rule, message)
+	}
+	ir.RecordDeprecation(rule, message, filename, line)
+}
@@ -16,16 +16,18 @@ package config
 
 import (
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/builtin"
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 	"github.com/tensorchord/envd/pkg/util/starlarkutil"
 )
 
 var (
-	logger = logrus.WithField("frontend", "starlark")
+	logger = log.WithField("frontend", "starlark")
 )
 
 var Module = &starlarkstruct.Module{
@@ -44,6 +46,25 @@ var Module = &starlarkstruct.Module{
 			ruleJuliaPackageServer, ruleFuncJuliaPackageServer),
 		"rstudio_server": starlark.NewBuiltin(ruleRStudioServer, ruleFuncRStudioServer),
 		"entrypoint":     starlark.NewBuiltin(ruleEntrypoint, ruleFuncEntrypoint),
+		"timezone":       starlark.NewBuiltin(ruleTimezone, ruleFuncTimezone),
+		"locale":         starlark.NewBuiltin(ruleLocale, ruleFuncLocale),
+		"ca_certificates": starlark.NewBuiltin(
+			ruleCACertificates, ruleFuncCACertificates),
+		"proxy":     starlark.NewBuiltin(ruleProxy, ruleFuncProxy),
+		"apt_proxy": starlark.NewBuiltin(ruleAPTProxy, ruleFuncAPTProxy),
+		"builtin_system_packages": starlark.NewBuiltin(
+			ruleBuiltinSystemPkgs, ruleFuncBuiltinSystemPackages),
+		"shell_rc": starlark.NewBuiltin(ruleShellRC, ruleFuncShellRC),
+		"pip_lock": starlark.NewBuiltin(rulePipLock, ruleFuncPipLock),
+		"authorized_keys": starlark.NewBuiltin(
+			ruleAuthorizedKeys, ruleFuncAuthorizedKeys),
+		"stage_limits": starlark.NewBuiltin(ruleStageLimits, ruleFuncStageLimits),
+		"known_hosts":  starlark.NewBuiltin(ruleKnownHosts, ruleFuncKnownHosts),
+		"vscode_marketplace": starlark.NewBuiltin(
+			ruleVSCodeMarketplace, ruleFuncVSCodeMarketplace),
+		"vscode":      starlark.NewBuiltin(ruleVSCode, ruleFuncVSCode),
+		"code_server": starlark.NewBuiltin(ruleCodeServer, ruleFuncCodeServer),
+		"oh_my_zsh":   starlark.NewBuiltin(ruleOHMyZSH, ruleFuncOHMyZSH),
 	},
 }
 
@@ -198,8 +219,10 @@ func ruleFuncCondaChannel(thread *starlark.Thread, _ *starlark.Builtin,
 func ruleFuncEntrypoint(thread *starlark.Thread, _ *starlark.Builtin,
 	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var argv *starlark.List
+	var replace bool
 
-	if err := starlark.UnpackArgs(ruleEntrypoint, args, kwargs, "args", &argv); err != nil {
+	if err := starlark.UnpackArgs(ruleEntrypoint, args, kwargs,
+		"args", &argv, "replace?", &replace); err != nil {
 		return nil, err
 	}
 
@@ -208,7 +231,335 @@ func ruleFuncEntrypoint(thread *starlark.Thread, _ *starlark.Builtin,
 		return nil, err
 	}
 
-	logger.Debugf("user defined entrypoints: {%s}\n", argList)
-	ir.Entrypoint(argList)
+	logger.Debugf("user defined entrypoints: {%s}, replace=%t\n", argList, replace)
+	ir.Entrypoint(argList, replace)
+	return starlark.None, nil
+}
+
+func ruleFuncTimezone(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name starlark.String
+
+	if err := starlark.UnpackArgs(ruleTimezone, args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+
+	nameStr := name.GoString()
+
+	logger.Debugf("rule `%s` is invoked, name=%s", ruleTimezone, nameStr)
+	if err := ir.Timezone(nameStr); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncLocale(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name starlark.String
+
+	if err := starlark.UnpackArgs(ruleLocale, args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+
+	nameStr := name.GoString()
+
+	logger.Debugf("rule `%s` is invoked, name=%s", ruleLocale, nameStr)
+	if err := ir.Locale(nameStr); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncCACertificates(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var paths *starlark.List
+
+	if err := starlark.UnpackArgs(ruleCACertificates, args, kwargs, "paths", &paths); err != nil {
+		return nil, err
+	}
+
+	pathList, err := starlarkutil.ToStringSlice(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Relative paths are relative to the build context.
+	buildContextDir := starlark.Universe[builtin.BuildContextDir].(starlark.String).GoString()
+	for i, p := range pathList {
+		pathList[i] = fileutil.ExpandHostPath(buildContextDir, p)
+	}
+
+	logger.Debugf("rule `%s` is invoked, paths=%v", ruleCACertificates, pathList)
+	if err := ir.CACertificates(pathList); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncProxy(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var httpProxy, httpsProxy, noProxy starlark.String
+
+	if err := starlark.UnpackArgs(ruleProxy, args, kwargs,
+		"http?", &httpProxy, "https?", &httpsProxy, "no_proxy?", &noProxy); err != nil {
+		return nil, err
+	}
+
+	httpProxyStr := httpProxy.GoString()
+	httpsProxyStr := httpsProxy.GoString()
+	noProxyStr := noProxy.GoString()
+
+	logger.Debugf("rule `%s` is invoked, http=%s, https=%s, no_proxy=%s",
+		ruleProxy, httpProxyStr, httpsProxyStr, noProxyStr)
+	ir.Proxy(httpProxyStr, httpsProxyStr, noProxyStr)
+	return starlark.None, nil
+}
+
+func ruleFuncAPTProxy(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url starlark.String
+
+	if err := starlark.UnpackArgs(ruleAPTProxy, args, kwargs,
+		"url", &url); err != nil {
+		return nil, err
+	}
+
+	urlStr := url.GoString()
+	logger.Debugf("rule `%s` is invoked, url=%s", ruleAPTProxy, urlStr)
+	if err := ir.APTProxy(urlStr); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncBuiltinSystemPackages(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var add, remove *starlark.List
+
+	if err := starlark.UnpackArgs(ruleBuiltinSystemPkgs, args, kwargs,
+		"add?", &add, "remove?", &remove); err != nil {
+		return nil, err
+	}
+
+	addList, err := starlarkutil.ToStringSlice(add)
+	if err != nil {
+		return nil, err
+	}
+	removeList, err := starlarkutil.ToStringSlice(remove)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, add=%v, remove=%v",
+		ruleBuiltinSystemPkgs, addList, removeList)
+	if err := ir.BuiltinSystemPackages(addList, removeList); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncShellRC(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var content starlark.String
+
+	if err := starlark.UnpackArgs(ruleShellRC, args, kwargs, "content", &content); err != nil {
+		return nil, err
+	}
+
+	contentStr := content.GoString()
+
+	logger.Debugf("rule `%s` is invoked, content=%s", ruleShellRC, contentStr)
+	if err := ir.ShellRC(contentStr); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncPipLock(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	requireHashes, noDeps := false, false
+
+	if err := starlark.UnpackArgs(rulePipLock, args, kwargs,
+		"require_hashes?", &requireHashes, "no_deps?", &noDeps); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, require_hashes=%t, no_deps=%t",
+		rulePipLock, requireHashes, noDeps)
+	ir.PipLock(requireHashes, noDeps)
+
+	return starlark.None, nil
+}
+
+func ruleFuncAuthorizedKeys(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var paths *starlark.List
+
+	if err := starlark.UnpackArgs(ruleAuthorizedKeys, args, kwargs, "paths?", &paths); err != nil {
+		return nil, err
+	}
+
+	pathList, err := starlarkutil.ToStringSlice(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Relative paths are relative to the build context.
+	buildContextDir := starlark.Universe[builtin.BuildContextDir].(starlark.String).GoString()
+	for i, p := range pathList {
+		pathList[i] = fileutil.ExpandHostPath(buildContextDir, p)
+	}
+
+	logger.Debugf("rule `%s` is invoked, paths=%v", ruleAuthorizedKeys, pathList)
+	if err := ir.AuthorizedKeys(pathList); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncStageLimits(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var timeout, maxLogSize starlark.String
+
+	if err := starlark.UnpackArgs(ruleStageLimits, args, kwargs,
+		"timeout?", &timeout, "max_log_size?", &maxLogSize); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, timeout=%s, max_log_size=%s",
+		ruleStageLimits, timeout.GoString(), maxLogSize.GoString())
+	if err := ir.StageLimits(timeout.GoString(), maxLogSize.GoString()); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, nil
+}
+
+func ruleFuncKnownHosts(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var hosts, entries *starlark.List
+
+	if err := starlark.UnpackArgs(ruleKnownHosts, args, kwargs,
+		"hosts?", &hosts, "entries?", &entries); err != nil {
+		return nil, err
+	}
+
+	hostList, err := starlarkutil.ToStringSlice(hosts)
+	if err != nil {
+		return nil, err
+	}
+	entryList, err := starlarkutil.ToStringSlice(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, hosts=%v, entries=%v",
+		ruleKnownHosts, hostList, entryList)
+	if err := ir.KnownHosts(hostList, entryList); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncVSCodeMarketplace(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var vendor, url string
+
+	if err := starlark.UnpackArgs(ruleVSCodeMarketplace, args, kwargs,
+		"vendor", &vendor, "url?", &url); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, vendor=%s, url=%s",
+		ruleVSCodeMarketplace, vendor, url)
+	if err := ir.VSCodeMarketplace(vendor, url); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncVSCode(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var settings *starlark.Dict
+	var keybindings *starlark.List
+	var serverVersion string
+
+	if err := starlark.UnpackArgs(ruleVSCode, args, kwargs,
+		"settings?", &settings, "keybindings?", &keybindings,
+		"server_version?", &serverVersion); err != nil {
+		return nil, err
+	}
+
+	settingsMap := map[string]interface{}{}
+	if settings != nil {
+		v, err := starlarkutil.ToGo(settings)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid vscode settings")
+		}
+		settingsMap = v.(map[string]interface{})
+	}
+	keybindingList := []map[string]interface{}{}
+	if keybindings != nil {
+		for i := 0; i < keybindings.Len(); i++ {
+			v, err := starlarkutil.ToGo(keybindings.Index(i))
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid vscode keybindings")
+			}
+			kb, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errors.Newf("invalid vscode keybinding %s, expect dict", keybindings.Index(i))
+			}
+			keybindingList = append(keybindingList, kb)
+		}
+	}
+
+	logger.Debugf("rule `%s` is invoked, settings=%v, keybindings=%v, server_version=%s",
+		ruleVSCode, settingsMap, keybindingList, serverVersion)
+	if err := ir.VSCode(settingsMap, keybindingList, serverVersion); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncCodeServer(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var port starlark.Int
+
+	if err := starlark.UnpackArgs(ruleCodeServer, args, kwargs,
+		"port?", &port); err != nil {
+		return nil, err
+	}
+
+	portInt, ok := port.Int64()
+	if !ok {
+		return nil, errors.New("port must be an integer")
+	}
+	logger.Debugf("rule `%s` is invoked, port=%d", ruleCodeServer, portInt)
+	if err := ir.CodeServer(portInt); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncOHMyZSH(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var revision, url, tarball string
+
+	if err := starlark.UnpackArgs(ruleOHMyZSH, args, kwargs,
+		"revision?", &revision, "url?", &url, "tarball?", &tarball); err != nil {
+		return nil, err
+	}
+
+	// Relative path is relative to the build context.
+	if tarball != "" {
+		buildContextDir := starlark.Universe[builtin.BuildContextDir].(starlark.String).GoString()
+		tarball = fileutil.ExpandHostPath(buildContextDir, tarball)
+	}
+
+	logger.Debugf("rule `%s` is invoked, revision=%s, url=%s, tarball=%s",
+		ruleOHMyZSH, revision, url, tarball)
+	if err := ir.OHMyZSH(revision, url, tarball); err != nil {
+		return nil, err
+	}
 	return starlark.None, nil
 }
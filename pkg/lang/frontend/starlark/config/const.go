@@ -24,4 +24,19 @@ const (
 	ruleJuliaPackageServer = "config.julia_pkg_server"
 	ruleRStudioServer      = "config.rstudio_server"
 	ruleEntrypoint         = "config.entrypoint"
+	ruleTimezone           = "config.timezone"
+	ruleLocale             = "config.locale"
+	ruleCACertificates     = "config.ca_certificates"
+	ruleProxy              = "config.proxy"
+	ruleAPTProxy           = "config.apt_proxy"
+	ruleBuiltinSystemPkgs  = "config.builtin_system_packages"
+	ruleShellRC            = "config.shell_rc"
+	rulePipLock            = "config.pip_lock"
+	ruleAuthorizedKeys     = "config.authorized_keys"
+	ruleStageLimits        = "config.stage_limits"
+	ruleKnownHosts         = "config.known_hosts"
+	ruleVSCodeMarketplace  = "config.vscode_marketplace"
+	ruleVSCode             = "config.vscode"
+	ruleCodeServer         = "config.code_server"
+	ruleOHMyZSH            = "config.oh_my_zsh"
 )
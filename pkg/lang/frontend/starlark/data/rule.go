@@ -15,15 +15,15 @@
 package data
 
 import (
-	"github.com/sirupsen/logrus"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 
 	envddata "github.com/tensorchord/envd/pkg/data"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 var (
-	logger = logrus.WithField("frontend", "starlark")
+	logger = log.WithField("frontend", "starlark")
 )
 
 var Module = &starlarkstruct.Module{
@@ -0,0 +1,69 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+import (
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+var (
+	logger = log.WithField("frontend", "starlark")
+)
+
+// Module exposes the restricted host information to the build file.
+var Module = &starlarkstruct.Module{
+	Name: "host",
+	Members: starlark.StringDict{
+		"getenv": starlark.NewBuiltin(ruleGetenv, ruleFuncGetenv),
+		"gpu":    starlark.NewBuiltin(ruleGPU, ruleFuncGPU),
+	},
+}
+
+func ruleFuncGetenv(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var defaultValue starlark.Value = starlark.None
+
+	if err := starlark.UnpackArgs(ruleGetenv, args, kwargs,
+		"name", &name, "default?", &defaultValue); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, name=%s", ruleGetenv, name)
+
+	value, ok, err := ir.HostEnv(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return defaultValue, nil
+	}
+	return starlark.String(value), nil
+}
+
+func ruleFuncGPU(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(ruleGPU, args, kwargs); err != nil {
+		return nil, err
+	}
+
+	gpus := ir.HostGPUs()
+	logger.Debugf("rule `%s` is invoked, gpus=%d", ruleGPU, gpus)
+	return starlark.MakeInt(gpus), nil
+}
@@ -15,11 +15,26 @@
 package install
 
 const (
-	ruleSystemPackage = "install.apt_packages"
-	rulePyPIPackage   = "install.python_packages"
-	ruleRPackage      = "install.r_packages"
-	ruleCUDA          = "install.cuda"
-	ruleVSCode        = "install.vscode_extensions"
-	ruleConda         = "install.conda_packages"
-	ruleJulia         = "install.julia_packages"
+	ruleSystemPackage   = "install.apt_packages"
+	rulePyPIPackage     = "install.python_packages"
+	ruleRPackage        = "install.r_packages"
+	ruleCUDA            = "install.cuda"
+	ruleCUDALibraries   = "install.cuda_libraries"
+	ruleVSCode          = "install.vscode_extensions"
+	ruleConda           = "install.conda_packages"
+	ruleJulia           = "install.julia_packages"
+	ruleGitLFS          = "install.git_lfs"
+	rulePreCommit       = "install.pre_commit"
+	ruleTmux            = "install.tmux"
+	ruleDirenv          = "install.direnv"
+	ruleGitHubCLI       = "install.github_cli"
+	ruleDatabaseClients = "install.database_clients"
+)
+
+// The layer modes of install.python_packages.
+const (
+	// pypiLayerPackage installs every package in its own layer.
+	pypiLayerPackage = "package"
+	// pypiLayerGroup installs the packages in the call in one layer.
+	pypiLayerGroup = "group"
 )
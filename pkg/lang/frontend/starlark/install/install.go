@@ -16,16 +16,18 @@ package install
 
 import (
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/builtin"
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 	"github.com/tensorchord/envd/pkg/util/starlarkutil"
 )
 
 var (
-	logger = logrus.WithField("frontend", "starlark")
+	logger = log.WithField("frontend", "starlark")
 )
 
 var Module = &starlarkstruct.Module{
@@ -35,20 +37,29 @@ var Module = &starlarkstruct.Module{
 		"r_packages":        starlark.NewBuiltin(ruleRPackage, ruleFuncRPackage),
 		"apt_packages":      starlark.NewBuiltin(ruleSystemPackage, ruleFuncSystemPackage),
 		"cuda":              starlark.NewBuiltin(ruleCUDA, ruleFuncCUDA),
+		"cuda_libraries":    starlark.NewBuiltin(ruleCUDALibraries, ruleFuncCUDALibraries),
 		"vscode_extensions": starlark.NewBuiltin(ruleVSCode, ruleFuncVSCode),
 		"conda_packages":    starlark.NewBuiltin(ruleConda, ruleFuncConda),
 		"julia_packages":    starlark.NewBuiltin(ruleJulia, ruleFuncJulia),
+		"git_lfs":           starlark.NewBuiltin(ruleGitLFS, ruleFuncGitLFS),
+		"pre_commit":        starlark.NewBuiltin(rulePreCommit, ruleFuncPreCommit),
+		"tmux":              starlark.NewBuiltin(ruleTmux, ruleFuncTmux),
+		"direnv":            starlark.NewBuiltin(ruleDirenv, ruleFuncDirenv),
+		"github_cli":        starlark.NewBuiltin(ruleGitHubCLI, ruleFuncGitHubCLI),
+		"database_clients":  starlark.NewBuiltin(ruleDatabaseClients, ruleFuncDatabaseClients),
 	},
 }
 
 func ruleFuncPyPIPackage(thread *starlark.Thread, _ *starlark.Builtin,
 	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var name *starlark.List
-	var requirementsFile starlark.String
+	var requirementsFile, pipfile starlark.String
 	var wheels *starlark.List
+	var layer starlark.String
 
 	if err := starlark.UnpackArgs(rulePyPIPackage, args, kwargs,
-		"name?", &name, "requirements?", &requirementsFile, "local_wheels?", &wheels); err != nil {
+		"name?", &name, "requirements?", &requirementsFile, "pipfile?", &pipfile,
+		"local_wheels?", &wheels, "layer?", &layer); err != nil {
 		return nil, err
 	}
 
@@ -58,17 +69,31 @@ func ruleFuncPyPIPackage(thread *starlark.Thread, _ *starlark.Builtin,
 	}
 
 	requirementsFileStr := requirementsFile.GoString()
+	pipfileStr := pipfile.GoString()
 
 	localWheels, err := starlarkutil.ToStringSlice(wheels)
 	if err != nil {
 		return nil, err
 	}
 
-	logger.Debugf("rule `%s` is invoked, name=%v, requirements=%s, local_wheels=%s",
-		rulePyPIPackage, nameList, requirementsFileStr, localWheels)
+	layerStr := layer.GoString()
+	switch layerStr {
+	case "", pypiLayerPackage, pypiLayerGroup:
+	default:
+		return nil, errors.Newf("layer should be %s or %s, got %s",
+			pypiLayerPackage, pypiLayerGroup, layerStr)
+	}
+
+	logger.Debugf("rule `%s` is invoked, name=%v, requirements=%s, pipfile=%s, local_wheels=%s, layer=%s",
+		rulePyPIPackage, nameList, requirementsFileStr, pipfileStr, localWheels, layerStr)
 
-	err = ir.PyPIPackage(nameList, requirementsFileStr, localWheels)
-	return starlark.None, err
+	if err := ir.PyPIPackage(nameList, requirementsFileStr, pipfileStr, localWheels); err != nil {
+		return nil, err
+	}
+	if layerStr != "" {
+		ir.PyPILayer(nameList, layerStr == pypiLayerPackage)
+	}
+	return starlark.None, nil
 }
 
 func ruleFuncRPackage(thread *starlark.Thread, _ *starlark.Builtin,
@@ -146,6 +171,95 @@ func ruleFuncCUDA(thread *starlark.Thread, _ *starlark.Builtin,
 	return starlark.None, nil
 }
 
+func ruleFuncCUDALibraries(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name *starlark.List
+
+	if err := starlark.UnpackArgs(ruleCUDALibraries,
+		args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+
+	nameList, err := starlarkutil.ToStringSlice(name)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, name=%v", ruleCUDALibraries, nameList)
+	if err := ir.CUDALibraries(nameList); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, nil
+}
+
+func ruleFuncGitLFS(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	propagateConfig := true
+
+	if err := starlark.UnpackArgs(ruleGitLFS,
+		args, kwargs, "propagate_config?", &propagateConfig); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, propagate_config=%t", ruleGitLFS, propagateConfig)
+	if err := ir.GitLFS(propagateConfig); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, nil
+}
+
+func ruleFuncPreCommit(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	installHooks := false
+
+	if err := starlark.UnpackArgs(rulePreCommit,
+		args, kwargs, "install_hooks?", &installHooks); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, install_hooks=%t", rulePreCommit, installHooks)
+	ir.PreCommit(installHooks)
+
+	return starlark.None, nil
+}
+
+func ruleFuncTmux(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var config starlark.String
+
+	if err := starlark.UnpackArgs(ruleTmux,
+		args, kwargs, "config?", &config); err != nil {
+		return nil, err
+	}
+
+	configStr := config.GoString()
+	if configStr != "" {
+		// Relative paths are relative to the build context.
+		buildContextDir := starlark.Universe[builtin.BuildContextDir].(starlark.String).GoString()
+		configStr = fileutil.ExpandHostPath(buildContextDir, configStr)
+	}
+	logger.Debugf("rule `%s` is invoked, config=%s", ruleTmux, configStr)
+	if err := ir.Tmux(configStr); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, nil
+}
+
+func ruleFuncDirenv(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(ruleDirenv, args, kwargs); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked", ruleDirenv)
+	ir.Direnv()
+
+	return starlark.None, nil
+}
+
 func ruleFuncVSCode(thread *starlark.Thread, _ *starlark.Builtin,
 	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var plugins *starlark.List
@@ -202,3 +316,39 @@ func ruleFuncConda(thread *starlark.Thread, _ *starlark.Builtin,
 
 	return starlark.None, nil
 }
+
+func ruleFuncGitHubCLI(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	forwardToken := false
+
+	if err := starlark.UnpackArgs(ruleGitHubCLI, args, kwargs,
+		"forward_token?", &forwardToken); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, forward_token=%t", ruleGitHubCLI, forwardToken)
+	ir.GitHubCLI(forwardToken)
+
+	return starlark.None, nil
+}
+
+func ruleFuncDatabaseClients(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var clients *starlark.List
+
+	if err := starlark.UnpackArgs(ruleDatabaseClients, args, kwargs,
+		"clients?", &clients); err != nil {
+		return nil, err
+	}
+
+	clientList, err := starlarkutil.ToStringSlice(clients)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, clients=%v", ruleDatabaseClients, clientList)
+	if err := ir.DatabaseClients(clientList); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
@@ -24,23 +24,35 @@ import (
 	"strings"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"go.starlark.net/starlark"
 
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/args"
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/builtin"
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/config"
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/data"
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/host"
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/install"
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/io"
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/runtime"
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/universe"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
 type Interpreter interface {
 	Eval(script string) (interface{}, error)
 	ExecFile(filename string, funcname string) (interface{}, error)
+	ExecEnv(filename string, env string) (interface{}, error)
 }
 
+// ErrRemoteModule is returned when the remote git module is loaded in the
+// sandbox, in which the repo is recorded instead of being cloned.
+var ErrRemoteModule = errors.New("remote module is not loaded in the sandbox")
+
+// builtinFilename is the file name of the frames of the built-in rules.
+const builtinFilename = "<builtin>"
+
 type entry struct {
 	globals starlark.StringDict
 	err     error
@@ -49,9 +61,11 @@ type entry struct {
 // generalInterpreter is the interpreter implementation for Starlark.
 // Please refer to https://github.com/google/starlark-go
 type generalInterpreter struct {
-	predeclared     starlark.StringDict
+	// rules are the predeclared rules of each syntax.
+	rules           map[string]starlark.StringDict
 	buildContextDir string
 	cache           map[string]*entry
+	sandbox         bool
 }
 
 func NewInterpreter(buildContextDir string) Interpreter {
@@ -60,28 +74,61 @@ func NewInterpreter(buildContextDir string) Interpreter {
 	universe.RegisterBuildContext(buildContextDir)
 
 	return &generalInterpreter{
-		predeclared: starlark.StringDict{
-			"install": install.Module,
-			"config":  config.Module,
-			"io":      io.Module,
-			"runtime": runtime.Module,
-			"data":    data.Module,
-		},
+		rules: syntaxRules(starlark.StringDict{
+			"install": builtin.WithLocations(install.Module),
+			"config":  builtin.WithLocations(config.Module),
+			"io":      builtin.WithLocations(io.Module),
+			"runtime": builtin.WithLocations(runtime.Module),
+			"data":    builtin.WithLocations(data.Module),
+			"host":    host.Module,
+			"args":    args.Module,
+		}),
 		buildContextDir: buildContextDir,
 		cache:           make(map[string]*entry),
 	}
 }
 
+// NewSandboxInterpreter returns the interpreter which evaluates the build
+// file without side effects on the host, e.g. the remote git modules are
+// not cloned and the data dirs are not created.
+func NewSandboxInterpreter(buildContextDir string) Interpreter {
+	s := NewInterpreter(buildContextDir).(*generalInterpreter)
+	s.sandbox = true
+	return s
+}
+
 func (s *generalInterpreter) NewThread(module string) *starlark.Thread {
 	thread := &starlark.Thread{
 		Name: module,
 		Load: s.load,
 	}
+	thread.SetLocal(builtin.Sandbox, s.sandbox)
 	return thread
 }
 
 func (s *generalInterpreter) load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
-	return s.exec(thread, module)
+	return s.exec(thread, s.resolve(thread, module))
+}
+
+// resolve returns the path of the local module relative to the file which
+// loads it, thus the shared files can be loaded from any build file. The
+// frames of the built-in rules, e.g. include, are skipped, and the build
+// context is used if there is no file in the call stack, e.g. in Eval.
+func (s *generalInterpreter) resolve(thread *starlark.Thread, module string) string {
+	if strings.HasPrefix(module, universe.GitPrefix) || filepath.IsAbs(module) {
+		return module
+	}
+	for depth := 0; depth < thread.CallStackDepth(); depth++ {
+		filename := thread.CallFrame(depth).Pos.Filename()
+		if filename == builtinFilename {
+			continue
+		}
+		if filename != "" {
+			return filepath.Join(filepath.Dir(filename), module)
+		}
+		break
+	}
+	return filepath.Join(s.buildContextDir, module)
 }
 
 func (s *generalInterpreter) exec(thread *starlark.Thread, module string) (starlark.StringDict, error) {
@@ -96,28 +143,56 @@ func (s *generalInterpreter) exec(thread *starlark.Thread, module string) (starl
 	s.cache[module] = nil
 
 	if !strings.HasPrefix(module, universe.GitPrefix) {
-		var data interface{}
-		globals, err := starlark.ExecFile(thread, module, data, s.predeclared)
+		globals, err := s.loadLocalModule(thread, module)
 		e = &entry{globals, err}
 	} else {
 		// exec remote git repo
 		url := module[len(universe.GitPrefix):]
+		ir.RemoteModule(url)
+		if s.sandbox {
+			return nil, errors.Wrapf(ErrRemoteModule, "failed to load %s", url)
+		}
 		path, err := fileutil.DownloadOrUpdateGitRepo(url)
 		if err != nil {
 			return nil, err
 		}
-		globals, err := s.loadGitModule(thread, path)
+		log.WithField("file", thread.Name).Debugf("load git module from: %s", path)
+		globals, err := s.loadModuleDir(thread, path, false)
 		e = &entry{globals, err}
 	}
+	s.cache[module] = e
 
 	return e.globals, e.err
 }
 
-func (s *generalInterpreter) loadGitModule(thread *starlark.Thread, path string) (globals starlark.StringDict, err error) {
-	var src interface{}
+// loadLocalModule executes the local build file, or all the build files in
+// the local dir, e.g. the settings shared by the team.
+func (s *generalInterpreter) loadLocalModule(thread *starlark.Thread, path string) (starlark.StringDict, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load module %s", path)
+	}
+	if info.IsDir() {
+		log.WithField("file", thread.Name).Debugf("load local module from: %s", path)
+		return s.loadModuleDir(thread, path, true)
+	}
+	globals, err := s.execFile(thread, path)
+	if err != nil {
+		return nil, err
+	}
+	// The build file itself is executed without the caller, and only the
+	// modules loaded by it are recorded.
+	if thread.CallStackDepth() > 0 {
+		ir.LocalModule(path)
+	}
+	return globals, nil
+}
+
+// loadModuleDir executes all the build files in the dir, and returns the
+// variables and functions defined in them, except those with the `_` prefix.
+// The files are recorded if the dir is in the local file system.
+func (s *generalInterpreter) loadModuleDir(thread *starlark.Thread, path string, local bool) (globals starlark.StringDict, err error) {
 	globals = starlark.StringDict{}
-	logger := logrus.WithField("file", thread.Name)
-	logger.Debugf("load git module from: %s", path)
 	err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -125,10 +200,13 @@ func (s *generalInterpreter) loadGitModule(thread *starlark.Thread, path string)
 		if d.IsDir() || !strings.HasSuffix(d.Name(), ".envd") {
 			return nil
 		}
-		dict, err := starlark.ExecFile(thread, path, src, s.predeclared)
+		dict, err := s.execFile(thread, path)
 		if err != nil {
 			return err
 		}
+		if local {
+			ir.LocalModule(path)
+		}
 		for key, val := range dict {
 			if _, exist := globals[key]; exist {
 				return errors.Newf("found duplicated object name: %s in %s", key, path)
@@ -143,14 +221,14 @@ func (s *generalInterpreter) loadGitModule(thread *starlark.Thread, path string)
 }
 
 func (s generalInterpreter) ExecFile(filename string, funcname string) (interface{}, error) {
-	logrus.WithField("filename", filename).Debug("interprete the file")
+	log.WithField("filename", filename).Debug("interprete the file")
 	thread := s.NewThread(filename)
 	globals, err := s.exec(thread, filename)
 	if err != nil {
 		return nil, err
 	}
 	if funcname != "" {
-		logrus.Debugf("Execute %s func", funcname)
+		log.Debugf("Execute %s func", funcname)
 		if globals.Has(funcname) {
 			buildVar := globals[funcname]
 			if fn, ok := buildVar.(*starlark.Function); ok {
@@ -169,9 +247,51 @@ func (s generalInterpreter) ExecFile(filename string, funcname string) (interfac
 	return globals, nil
 }
 
+// ExecEnv executes the build function of the environment declared by
+// environment(name, build) in the file, see envd build --env.
+func (s generalInterpreter) ExecEnv(filename string, env string) (interface{}, error) {
+	log.WithField("filename", filename).Debug("interprete the file")
+	thread := s.NewThread(filename)
+	globals, err := s.exec(thread, filename)
+	if err != nil {
+		return nil, err
+	}
+	build, names := builtin.Environment(thread, env)
+	if build == nil {
+		if len(names) == 0 {
+			return nil, errors.Newf("no environment is declared by environment() in %s", filename)
+		}
+		return nil, errors.Newf("environment %s is not declared in %s, the declared ones are %s",
+			env, filename, strings.Join(names, ", "))
+	}
+	log.Debugf("Execute the build func of environment %s", env)
+	if _, err := starlark.Call(thread, build, nil, nil); err != nil {
+		return nil, errors.Wrapf(err, "Exception when exec the build func of environment %s", env)
+	}
+	return globals, nil
+}
+
+// execFile executes the file with the rules of the syntax declared in it,
+// thus the modules of the different syntax can be loaded by each other.
+func (s *generalInterpreter) execFile(thread *starlark.Thread, filename string) (starlark.StringDict, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	syntax, err := ParseSyntax(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", filename)
+	}
+	return starlark.ExecFile(thread, filename, src, s.rules[syntax])
+}
+
 func (s generalInterpreter) Eval(script string) (interface{}, error) {
 	thread := s.NewThread(script)
-	return starlark.ExecFile(thread, "", script, s.predeclared)
+	syntax, err := ParseSyntax([]byte(script))
+	if err != nil {
+		return nil, err
+	}
+	return starlark.ExecFile(thread, "", script, s.rules[syntax])
 }
 
 func GetEnvdProgramHash(filename string) (string, error) {
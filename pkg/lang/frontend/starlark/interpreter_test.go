@@ -15,8 +15,12 @@
 package starlark
 
 import (
+	"path/filepath"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
+	"github.com/tensorchord/envd/pkg/lang/ir"
 )
 
 var _ = Describe("Starlark", func() {
@@ -26,4 +30,174 @@ var _ = Describe("Starlark", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(hash).To(Equal("cff1c81818116d42"))
 	})
+
+	Describe("include", func() {
+		BeforeEach(func() {
+			ir.DefaultGraph = ir.NewGraph()
+		})
+		AfterEach(func() {
+			ir.DefaultGraph = ir.NewGraph()
+		})
+
+		It("should load the local modules relative to the build file", func() {
+			dir := filepath.Join("testdata", "include")
+			s := NewInterpreter(dir)
+			_, err := s.ExecFile(filepath.Join(dir, "build.envd"), "build")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ir.DefaultGraph.PyPIPackages).To(ContainElements("numpy", "pandas"))
+			Expect(ir.DefaultGraph.Shell).To(Equal("zsh"))
+			Expect(ir.DefaultGraph.GitConfig).NotTo(BeNil())
+			Expect(ir.DefaultGraph.GitConfig.Editor).To(Equal("vim"))
+			Expect(ir.DefaultGraph.LocalModules).To(ConsistOf(
+				filepath.Join(dir, "shared", "packages.envd"),
+				filepath.Join(dir, "shared", "settings.envd"),
+			))
+		})
+
+		It("should require exactly one of git and path", func() {
+			s := NewInterpreter("testdata")
+			_, err := s.Eval(`include(git="https://github.com/tensorchord/envdlib", path="shared")`)
+			Expect(err).To(HaveOccurred())
+			_, err = s.Eval(`include()`)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("syntax", func() {
+		AfterEach(func() {
+			ir.DefaultGraph = ir.NewGraph()
+		})
+
+		DescribeTable("should parse the syntax header",
+			func(src, expected string, fails bool) {
+				syntax, err := ParseSyntax([]byte(src))
+				if fails {
+					Expect(err).To(HaveOccurred())
+					return
+				}
+				Expect(err).NotTo(HaveOccurred())
+				Expect(syntax).To(Equal(expected))
+			},
+			Entry("no header", "def build():\n    pass\n", SyntaxV0, false),
+			Entry("v1", "# syntax=v1\ndef build():\n    pass\n", SyntaxV1, false),
+			Entry("v1 after the comments", "\n# team settings\n# syntax = v1\n", SyntaxV1, false),
+			Entry("header after the code", "x = 1\n# syntax=v1\n", SyntaxV0, false),
+			Entry("unknown", "# syntax=v9\n", "", true),
+		)
+
+		It("should dispatch to the rules of the syntax", func() {
+			s := NewInterpreter("testdata")
+			_, err := s.Eval(`base(os="ubuntu22.04", language="python3")`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ir.DefaultGraph.OS).To(Equal("ubuntu22.04"))
+
+			_, err = s.Eval("# syntax=v1\nbase(os=\"ubuntu20.04\", language=\"python3\")")
+			Expect(err).To(HaveOccurred())
+			_, err = s.Eval("# syntax=v1\nbase(\"python3\")")
+			Expect(err).To(HaveOccurred())
+			_, err = s.Eval("# syntax=v1\nbase(language=\"python3.9\")")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("lint", func() {
+		BeforeEach(func() {
+			ir.DefaultGraph = ir.NewGraph()
+		})
+		AfterEach(func() {
+			ir.DefaultGraph = ir.NewGraph()
+		})
+
+		DescribeTable("should report the problems with the positions",
+			func(file string, expected []Diagnostic) {
+				filename := filepath.Join("testdata", "lint", file)
+				diagnostics := Lint(filename, "build")
+				Expect(diagnostics).To(HaveLen(len(expected)))
+				for i, d := range diagnostics {
+					Expect(d.Filename).To(Equal(filename))
+					Expect(d.Line).To(Equal(expected[i].Line))
+					Expect(d.Severity).To(Equal(expected[i].Severity))
+					Expect(d.Message).To(ContainSubstring(expected[i].Message))
+				}
+			},
+			Entry("unknown functions", "unknown.envd", []Diagnostic{
+				{Line: 3, Severity: SeverityError, Message: "undefined: instal"},
+				{Line: 4, Severity: SeverityError, Message: "undefined: foo"},
+			}),
+			Entry("bad argument types", "badarg.envd", []Diagnostic{
+				{Line: 3, Severity: SeverityError, Message: "got int, want string"},
+			}),
+			Entry("conflicts and deprecations", "conflict.envd", []Diagnostic{
+				{Line: 2, Severity: SeverityWarning, Message: "base is deprecated"},
+				{Line: 4, Severity: SeverityWarning, Message: "base overrides the one at conflict.envd:2"},
+			}),
+		)
+
+		It("should check the unsaved source without executing it", func() {
+			src := "base(language=\"r\")\ninstal.python_packages(name=[1])\n"
+			diagnostics := Check("build.envd", []byte(src))
+			Expect(diagnostics).To(HaveLen(1))
+			Expect(diagnostics[0].Line).To(Equal(2))
+			Expect(diagnostics[0].Column).To(Equal(1))
+			Expect(diagnostics[0].Message).To(Equal("undefined: instal"))
+			Expect(ir.DefaultGraph.Language.Name).NotTo(Equal("r"))
+		})
+	})
+
+	Describe("environment", func() {
+		BeforeEach(func() {
+			ir.DefaultGraph = ir.NewGraph()
+		})
+		AfterEach(func() {
+			ir.DefaultGraph = ir.NewGraph()
+		})
+
+		It("should execute the build func of the selected environment", func() {
+			dir := filepath.Join("testdata", "envs")
+			s := NewInterpreter(dir)
+			_, err := s.ExecEnv(filepath.Join(dir, "build.envd"), "gpu")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ir.DefaultGraph.CUDA).NotTo(BeNil())
+			Expect(*ir.DefaultGraph.CUDA).To(Equal("11.6.2"))
+
+			ir.DefaultGraph = ir.NewGraph()
+			s = NewInterpreter(dir)
+			_, err = s.ExecEnv(filepath.Join(dir, "build.envd"), "cpu")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ir.DefaultGraph.CUDA).To(BeNil())
+		})
+
+		It("should list the declared environments if the one is not declared", func() {
+			dir := filepath.Join("testdata", "envs")
+			s := NewInterpreter(dir)
+			_, err := s.ExecEnv(filepath.Join(dir, "build.envd"), "docs")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("the declared ones are cpu, gpu"))
+		})
+
+		It("should reject the invalid and the duplicated names", func() {
+			s := NewInterpreter("testdata")
+			_, err := s.Eval("def f():\n    pass\nenvironment(\"GPU\", f)")
+			Expect(err).To(HaveOccurred())
+			_, err = s.Eval("def f():\n    pass\nenvironment(\"gpu\", f)\nenvironment(\"gpu\", f)")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("args", func() {
+		AfterEach(func() {
+			ir.DefaultGraph = ir.NewGraph()
+		})
+
+		It("should read the build args or the default", func() {
+			ir.DefaultGraph = ir.NewGraph()
+			Expect(ir.BuildArgs(map[string]string{"CUDA": "11.7"})).To(Succeed())
+			s := NewInterpreter("testdata")
+			_, err := s.Eval(`install.cuda(version=args.get("CUDA", "11.6.2"), cudnn=args.get("CUDNN", "8"))`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*ir.DefaultGraph.CUDA).To(Equal("11.7"))
+			Expect(ir.DefaultGraph.CUDNN).To(Equal("8"))
+			Expect(ir.UnusedBuildArgs()).To(BeEmpty())
+		})
+	})
 })
@@ -15,6 +15,10 @@
 package io
 
 const (
-	ruleCopy = "io.copy"
-	ruleHTTP = "io.http"
+	ruleCopy     = "io.copy"
+	ruleHTTP     = "io.http"
+	ruleReadFile = "io.read_file"
+	// readFileMaxSize limits io.read_file to the small files, e.g. the
+	// version files and the requirements lists.
+	readFileMaxSize = 1 << 20
 )
@@ -15,22 +15,27 @@
 package io
 
 import (
-	"github.com/sirupsen/logrus"
+	"path/filepath"
+
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/builtin"
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
 var (
-	logger = logrus.WithField("frontend", "starlark")
+	logger = log.WithField("frontend", "starlark")
 )
 
 var Module = &starlarkstruct.Module{
 	Name: "io",
 	Members: starlark.StringDict{
-		"copy": starlark.NewBuiltin(ruleCopy, ruleFuncCopy),
-		"http": starlark.NewBuiltin(ruleHTTP, ruleFuncHTTP),
+		"copy":      starlark.NewBuiltin(ruleCopy, ruleFuncCopy),
+		"http":      starlark.NewBuiltin(ruleHTTP, ruleFuncHTTP),
+		"read_file": starlark.NewBuiltin(ruleReadFile, ruleFuncReadFile),
 	},
 }
 
@@ -68,3 +73,25 @@ func ruleFuncHTTP(thread *starlark.Thread, _ *starlark.Builtin,
 	}
 	return starlark.None, nil
 }
+
+func ruleFuncReadFile(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path string
+	if err := starlark.UnpackArgs(ruleReadFile, args, kwargs, "path", &path); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, path=%s", ruleReadFile, path)
+	// The path is relative to the build context, and the files out of the
+	// build context cannot be read.
+	buildContextDir := starlark.Universe[builtin.BuildContextDir].(starlark.String).GoString()
+	content, err := fileutil.ReadFileInDir(buildContextDir, path, readFileMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(buildContextDir, path)
+	}
+	ir.ReadFile(path)
+	return starlark.String(content), nil
+}
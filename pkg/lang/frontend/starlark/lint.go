@@ -0,0 +1,173 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starlark
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/tensorchord/envd/pkg/lang/ir"
+)
+
+// The severities of the diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// overridingRules are the rules whose later invocation overrides the former
+// one instead of adding to it, thus invoking them twice is a conflict.
+var overridingRules = []string{
+	"base", "os", "shell",
+	"install.cuda",
+	"config.apt_source", "config.pip_index", "config.cran_mirror",
+	"config.julia_pkg_server", "config.conda_channel", "config.gpu",
+	"config.jupyter", "config.rstudio_server", "config.timezone",
+	"config.locale", "config.pip_lock",
+}
+
+// Diagnostic is the problem found in the build file by Lint.
+type Diagnostic struct {
+	Filename string
+	Line     int
+	// Column is 0 if the problem is found by the rule, which only knows
+	// the line.
+	Column   int
+	Severity string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	pos := fmt.Sprintf("%s:%d", d.Filename, d.Line)
+	if d.Column > 0 {
+		pos = fmt.Sprintf("%s:%d", pos, d.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s", pos, d.Severity, d.Message)
+}
+
+// Lint evaluates the build file in the sandbox, and reports the unknown
+// functions, the bad arguments, the conflicting rules and the deprecated
+// usages with the positions. The evaluation stops at the first runtime
+// error, thus only the first bad argument is reported.
+func Lint(filename, funcname string) []Diagnostic {
+	interpreter := NewSandboxInterpreter(filepath.Dir(filename))
+	_, err := interpreter.ExecFile(filename, funcname)
+	diagnostics := evalDiagnostics(err, filename)
+
+	for _, rule := range overridingRules {
+		locations := ir.DefaultGraph.SourceLocations[rule]
+		for i := 1; i < len(locations); i++ {
+			l, first := locations[i], locations[0]
+			diagnostics = append(diagnostics, Diagnostic{
+				Filename: l.Filename,
+				Line:     l.Line,
+				Severity: SeverityWarning,
+				Message: fmt.Sprintf("%s overrides the one at %s:%d",
+					rule, filepath.Base(first.Filename), first.Line),
+			})
+		}
+	}
+	for _, d := range ir.DefaultGraph.Deprecations {
+		diagnostics = append(diagnostics, Diagnostic{
+			Filename: d.Location.Filename,
+			Line:     d.Location.Line,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%s is deprecated, %s", d.Rule, d.Message),
+		})
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Filename != diagnostics[j].Filename {
+			return diagnostics[i].Filename < diagnostics[j].Filename
+		}
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+	return diagnostics
+}
+
+// Check parses the build file and reports the syntax errors and the unknown
+// functions without executing it, e.g. for the unsaved file in the editor.
+func Check(filename string, src []byte) []Diagnostic {
+	version, err := ParseSyntax(src)
+	if err != nil {
+		return []Diagnostic{{
+			Filename: filename,
+			Line:     1,
+			Severity: SeverityError,
+			Message:  err.Error(),
+		}}
+	}
+	rules := NewSandboxInterpreter(filepath.Dir(filename)).(*generalInterpreter).rules[version]
+	_, _, err = starlark.SourceProgram(filename, src, rules.Has)
+	return evalDiagnostics(err, filename)
+}
+
+// evalDiagnostics converts the error of the evaluation to the diagnostics.
+// The syntax and the resolve errors, e.g. the unknown functions, are found
+// before the execution, and all of them are reported.
+func evalDiagnostics(err error, filename string) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+	var syntaxErr syntax.Error
+	var resolveErrs resolve.ErrorList
+	var evalErr *starlark.EvalError
+	switch {
+	case errors.Is(err, ErrRemoteModule):
+		return []Diagnostic{{
+			Filename: filename,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("the evaluation stopped at the remote module, the rules after it are not checked: %s", err),
+		}}
+	case errors.As(err, &resolveErrs):
+		diagnostics := []Diagnostic{}
+		for _, e := range resolveErrs {
+			diagnostics = append(diagnostics, positionDiagnostic(e.Pos, e.Msg))
+		}
+		return diagnostics
+	case errors.As(err, &syntaxErr):
+		return []Diagnostic{positionDiagnostic(syntaxErr.Pos, syntaxErr.Msg)}
+	case errors.As(err, &evalErr):
+		// The innermost frame in the build file is where the rule is
+		// invoked, the frames of the rules are skipped.
+		for i := 0; i < len(evalErr.CallStack); i++ {
+			frame := evalErr.CallStack.At(i)
+			if frame.Pos.Filename() != builtinFilename {
+				return []Diagnostic{positionDiagnostic(frame.Pos, evalErr.Msg)}
+			}
+		}
+	}
+	return []Diagnostic{{
+		Filename: filename,
+		Severity: SeverityError,
+		Message:  err.Error(),
+	}}
+}
+
+func positionDiagnostic(pos syntax.Position, msg string) Diagnostic {
+	return Diagnostic{
+		Filename: pos.Filename(),
+		Line:     int(pos.Line),
+		Column:   int(pos.Col),
+		Severity: SeverityError,
+		Message:  msg,
+	}
+}
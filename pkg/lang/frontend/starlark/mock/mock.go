@@ -48,6 +48,21 @@ func (mr *MockInterpreterMockRecorder) Eval(script interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Eval", reflect.TypeOf((*MockInterpreter)(nil).Eval), script)
 }
 
+// ExecEnv mocks base method.
+func (m *MockInterpreter) ExecEnv(filename, env string) (interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecEnv", filename, env)
+	ret0, _ := ret[0].(interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecEnv indicates an expected call of ExecEnv.
+func (mr *MockInterpreterMockRecorder) ExecEnv(filename, env interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecEnv", reflect.TypeOf((*MockInterpreter)(nil).ExecEnv), filename, env)
+}
+
 // ExecFile mocks base method.
 func (m *MockInterpreter) ExecFile(filename, funcname string) (interface{}, error) {
 	m.ctrl.T.Helper()
@@ -20,4 +20,9 @@ const (
 	ruleDaemon  = "runtime.daemon"
 	ruleEnviron = "runtime.environ"
 	ruleMount   = "runtime.mount"
+	ruleCron    = "runtime.cron"
+
+	ruleDatabase = "runtime.database"
+
+	ruleEnvPassthrough = "runtime.env_passthrough"
 )
@@ -20,27 +20,32 @@ import (
 	"strings"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/builtin"
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/data"
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
+	"github.com/tensorchord/envd/pkg/util/starlarkutil"
 )
 
 var (
-	logger = logrus.WithField("frontend", "starlark")
+	logger = log.WithField("frontend", "starlark")
 )
 
 var Module = &starlarkstruct.Module{
 	Name: "runtime",
 	Members: starlark.StringDict{
-		"command": starlark.NewBuiltin(ruleCommand, ruleFuncCommand),
-		"daemon":  starlark.NewBuiltin(ruleDaemon, ruleFuncDaemon),
-		"expose":  starlark.NewBuiltin(ruleExpose, ruleFuncExpose),
-		"environ": starlark.NewBuiltin(ruleEnviron, ruleFuncEnviron),
-		"mount":   starlark.NewBuiltin(ruleMount, ruleFuncMount),
+		"command":         starlark.NewBuiltin(ruleCommand, ruleFuncCommand),
+		"daemon":          starlark.NewBuiltin(ruleDaemon, ruleFuncDaemon),
+		"expose":          starlark.NewBuiltin(ruleExpose, ruleFuncExpose),
+		"environ":         starlark.NewBuiltin(ruleEnviron, ruleFuncEnviron),
+		"env_passthrough": starlark.NewBuiltin(ruleEnvPassthrough, ruleFuncEnvPassthrough),
+		"mount":           starlark.NewBuiltin(ruleMount, ruleFuncMount),
+		"cron":            starlark.NewBuiltin(ruleCron, ruleFuncCron),
+		"database":        starlark.NewBuiltin(ruleDatabase, ruleFuncDatabase),
 	},
 }
 
@@ -147,6 +152,27 @@ func ruleFuncEnviron(thread *starlark.Thread, _ *starlark.Builtin,
 	return starlark.None, nil
 }
 
+func ruleFuncEnvPassthrough(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var patterns *starlark.List
+
+	if err := starlark.UnpackArgs(ruleEnvPassthrough, args, kwargs,
+		"patterns", &patterns); err != nil {
+		return nil, err
+	}
+
+	patternList, err := starlarkutil.ToStringSlice(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, patterns: %v", ruleEnvPassthrough, patternList)
+	if err := ir.RuntimeEnvPassthrough(patternList); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
 func ruleFuncMount(thread *starlark.Thread, _ *starlark.Builtin,
 	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var source starlark.Value
@@ -161,13 +187,18 @@ func ruleFuncMount(thread *starlark.Thread, _ *starlark.Builtin,
 	var err error
 
 	if v, ok := source.(*data.DataSourceValue); ok {
-		err = v.Init()
-		if err != nil {
-			return starlark.None, err
-		}
-		sourceStr, err = v.GetHostDir()
-		if err != nil {
-			return starlark.None, err
+		if builtin.IsSandbox(thread) {
+			// The data dir is not created in the sandbox.
+			sourceStr = v.String()
+		} else {
+			err = v.Init()
+			if err != nil {
+				return starlark.None, err
+			}
+			sourceStr, err = v.GetHostDir()
+			if err != nil {
+				return starlark.None, err
+			}
 		}
 	} else if vs, ok := source.(starlark.String); ok {
 		sourceStr = vs.GoString()
@@ -199,3 +230,35 @@ func ruleFuncMount(thread *starlark.Thread, _ *starlark.Builtin,
 
 	return starlark.None, nil
 }
+
+func ruleFuncCron(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var schedule, command string
+
+	if err := starlark.UnpackArgs(ruleCron, args, kwargs,
+		"schedule", &schedule, "command", &command); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, schedule=%s, command=%s", ruleCron, schedule, command)
+	if err := ir.RuntimeCron(schedule, command); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+func ruleFuncDatabase(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, urlEnv string
+
+	if err := starlark.UnpackArgs(ruleDatabase, args, kwargs,
+		"name", &name, "url_env", &urlEnv); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, name=%s, url_env=%s", ruleDatabase, name, urlEnv)
+	if err := ir.RuntimeDatabase(name, urlEnv); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
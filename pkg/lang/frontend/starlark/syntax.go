@@ -0,0 +1,80 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starlark
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"go.starlark.net/starlark"
+
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/universe"
+)
+
+// The syntax versions of the build file, which is declared by the comment
+// `# syntax=v1` before the code. The rules are renamed or changed in the
+// new version, thus the existing build files are not broken.
+const (
+	// SyntaxV0 is the default syntax of the build file without the header.
+	SyntaxV0 = "v0"
+	// SyntaxV1 sets the os by os(name, version), and the arguments of base
+	// are keyword-only.
+	SyntaxV1 = "v1"
+)
+
+var syntaxPattern = regexp.MustCompile(`^#\s*syntax\s*=\s*(\S+)\s*$`)
+
+// ParseSyntax returns the syntax declared in the leading comments of the
+// build file, or SyntaxV0 if there is none.
+func ParseSyntax(src []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if m := syntaxPattern.FindStringSubmatch(line); m != nil {
+			switch m[1] {
+			case SyntaxV0, SyntaxV1:
+				return m[1], nil
+			}
+			return "", errors.Newf("unsupported syntax %s, expected %s or %s, "+
+				"the newer syntax may need the newer envd", m[1], SyntaxV0, SyntaxV1)
+		}
+	}
+	return SyntaxV0, nil
+}
+
+// syntaxRules returns the predeclared rules of each syntax, the rules of v1
+// are the ones of v0 overridden by universe.SyntaxV1.
+func syntaxRules(v0 starlark.StringDict) map[string]starlark.StringDict {
+	v1 := make(starlark.StringDict, len(v0)+len(universe.SyntaxV1))
+	for k, v := range v0 {
+		v1[k] = v
+	}
+	for k, v := range universe.SyntaxV1 {
+		v1[k] = v
+	}
+	return map[string]starlark.StringDict{
+		SyntaxV0: v0,
+		SyntaxV1: v1,
+	}
+}
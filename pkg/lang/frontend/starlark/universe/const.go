@@ -16,10 +16,13 @@ package universe
 
 const (
 	ruleBase      = "base"
+	ruleOS        = "os"
 	ruleShell     = "shell"
 	ruleRun       = "run"
 	ruleGitConfig = "git_config"
 	ruleInclude   = "include"
+	ruleTarget    = "target"
+	ruleEnv       = "environment"
 
 	GitPrefix = "git@"
 )
@@ -17,26 +17,36 @@ package universe
 import (
 	"fmt"
 
-	"github.com/sirupsen/logrus"
+	"github.com/cockroachdb/errors"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 
 	"github.com/tensorchord/envd/pkg/lang/frontend/starlark/builtin"
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
 	"github.com/tensorchord/envd/pkg/util/starlarkutil"
 )
 
 var (
-	logger = logrus.WithField("frontend", "starlark")
+	logger = log.WithField("frontend", "starlark")
 )
 
 // RegisterEnvdRules registers built-in envd rules into the global namespace.
 func RegisterEnvdRules() {
-	starlark.Universe[ruleBase] = starlark.NewBuiltin(ruleBase, ruleFuncBase)
-	starlark.Universe[ruleShell] = starlark.NewBuiltin(ruleShell, ruleFuncShell)
-	starlark.Universe[ruleRun] = starlark.NewBuiltin(ruleRun, ruleFuncRun)
-	starlark.Universe[ruleGitConfig] = starlark.NewBuiltin(ruleGitConfig, ruleFuncGitConfig)
+	starlark.Universe[ruleBase] = builtin.WithLocation(starlark.NewBuiltin(ruleBase, ruleFuncBase))
+	starlark.Universe[ruleOS] = builtin.WithLocation(starlark.NewBuiltin(ruleOS, ruleFuncOS))
+	starlark.Universe[ruleShell] = builtin.WithLocation(starlark.NewBuiltin(ruleShell, ruleFuncShell))
+	starlark.Universe[ruleRun] = builtin.WithLocation(starlark.NewBuiltin(ruleRun, ruleFuncRun))
+	starlark.Universe[ruleGitConfig] = builtin.WithLocation(starlark.NewBuiltin(ruleGitConfig, ruleFuncGitConfig))
 	starlark.Universe[ruleInclude] = starlark.NewBuiltin(ruleInclude, ruleFuncInclude)
+	starlark.Universe[ruleTarget] = starlark.NewBuiltin(ruleTarget, ruleFuncTarget)
+	starlark.Universe[ruleEnv] = starlark.NewBuiltin(ruleEnv, ruleFuncEnv)
+}
+
+// SyntaxV1 overrides the rules in the build files of `# syntax=v1`.
+var SyntaxV1 = starlark.StringDict{
+	ruleBase: builtin.WithLocation(starlark.NewBuiltin(ruleBase, ruleFuncBaseV1)),
 }
 
 func RegisterBuildContext(buildContextDir string) {
@@ -45,26 +55,67 @@ func RegisterBuildContext(buildContextDir string) {
 
 func ruleFuncBase(thread *starlark.Thread, _ *starlark.Builtin,
 	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	var os, language, image string
+	var os, language, image, dockerfile string
 
 	if err := starlark.UnpackArgs(ruleBase, args, kwargs,
-		"os?", &os, "language?", &language, "image?", &image); err != nil {
+		"os?", &os, "language?", &language, "image?", &image,
+		"dockerfile?", &dockerfile); err != nil {
 		return nil, err
 	}
+	if os != "" {
+		builtin.Deprecated(thread, ruleBase, "use os(name, version) instead of the os argument")
+	}
 
-	logger.Debugf("rule `%s` is invoked, os=%s, language=%s, image=%s\n",
-		ruleBase, os, language, image)
+	// The dockerfile is relative to the build context.
+	if dockerfile != "" {
+		buildContextDir := starlark.Universe[builtin.BuildContextDir].(starlark.String).GoString()
+		dockerfile = fileutil.ExpandHostPath(buildContextDir, dockerfile)
+	}
 
-	err := ir.Base(os, language, image)
+	logger.Debugf("rule `%s` is invoked, os=%s, language=%s, image=%s, dockerfile=%s\n",
+		ruleBase, os, language, image, dockerfile)
+
+	err := ir.Base(os, language, image, dockerfile)
+	return starlark.None, err
+}
+
+// ruleFuncBaseV1 is the base rule in syntax v1, in which the os is set by
+// os(name, version) and the arguments are keyword-only.
+func ruleFuncBaseV1(thread *starlark.Thread, b *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) > 0 {
+		return nil, errors.Newf("%s: the arguments are keyword-only in syntax v1", ruleBase)
+	}
+	for _, kv := range kwargs {
+		if kv[0].(starlark.String).GoString() == "os" {
+			return nil, errors.Newf("%s: os is replaced by os(name, version) in syntax v1", ruleBase)
+		}
+	}
+	return ruleFuncBase(thread, b, args, kwargs)
+}
+
+func ruleFuncOS(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, version string
+
+	if err := starlark.UnpackArgs(ruleOS, args, kwargs,
+		"name", &name, "version", &version); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, name=%s, version=%s", ruleOS, name, version)
+
+	err := ir.OS(name, version)
 	return starlark.None, err
 }
 
 func ruleFuncRun(thread *starlark.Thread, _ *starlark.Builtin,
 	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	var commands *starlark.List
+	var commands, allow *starlark.List
+	var shell starlark.String
 
-	if err := starlark.UnpackArgs(ruleRun,
-		args, kwargs, "commands?", &commands); err != nil {
+	if err := starlark.UnpackArgs(ruleRun, args, kwargs,
+		"commands?", &commands, "shell?", &shell, "allow?", &allow); err != nil {
 		return nil, err
 	}
 
@@ -72,9 +123,15 @@ func ruleFuncRun(thread *starlark.Thread, _ *starlark.Builtin,
 	if err != nil {
 		return nil, err
 	}
+	shellStr := shell.GoString()
+	allowList, err := starlarkutil.ToStringSlice(allow)
+	if err != nil {
+		return nil, err
+	}
 
-	logger.Debugf("rule `%s` is invoked, commands=%v", ruleRun, goCommands)
-	if err := ir.Run(goCommands); err != nil {
+	logger.Debugf("rule `%s` is invoked, commands=%v, shell=%s, allow=%v",
+		ruleRun, goCommands, shellStr, allowList)
+	if err := ir.Run(goCommands, shellStr, allowList); err != nil {
 		return nil, err
 	}
 
@@ -83,17 +140,25 @@ func ruleFuncRun(thread *starlark.Thread, _ *starlark.Builtin,
 
 func ruleFuncShell(thread *starlark.Thread, _ *starlark.Builtin,
 	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	var shell starlark.String
+	var shell, theme starlark.String
+	var plugins *starlark.List
 
-	if err := starlark.UnpackPositionalArgs(ruleShell, args, kwargs, 1, &shell); err != nil {
+	if err := starlark.UnpackArgs(ruleShell, args, kwargs,
+		"name", &shell, "plugins?", &plugins, "theme?", &theme); err != nil {
 		return nil, err
 	}
 
 	shellStr := shell.GoString()
+	pluginList, err := starlarkutil.ToStringSlice(plugins)
+	if err != nil {
+		return nil, err
+	}
+	themeStr := theme.GoString()
 
-	logger.Debugf("rule `%s` is invoked, shell=%s", ruleShell, shellStr)
+	logger.Debugf("rule `%s` is invoked, shell=%s, plugins=%v, theme=%s",
+		ruleShell, shellStr, pluginList, themeStr)
 
-	err := ir.Shell(shellStr)
+	err = ir.Shell(shellStr, pluginList, themeStr)
 	return starlark.None, err
 }
 
@@ -117,24 +182,63 @@ func ruleFuncGitConfig(thread *starlark.Thread, _ *starlark.Builtin,
 	return starlark.None, err
 }
 
+func ruleFuncTarget(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+
+	if err := starlark.UnpackPositionalArgs(ruleTarget, args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, name=%s", ruleTarget, name)
+	return starlark.Bool(ir.IsTarget(name)), nil
+}
+
+// ruleFuncEnv declares the named environment built by the function, which
+// is selected by envd build --env.
+func ruleFuncEnv(thread *starlark.Thread, _ *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var build starlark.Callable
+
+	if err := starlark.UnpackArgs(ruleEnv, args, kwargs,
+		"name", &name, "build", &build); err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("rule `%s` is invoked, name=%s, build=%s", ruleEnv, name, build.Name())
+	if err := builtin.RegisterEnvironment(thread, name, build); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
 func ruleFuncInclude(thread *starlark.Thread, _ *starlark.Builtin,
 	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	var gitRepo string
+	var gitRepo, path string
 
 	if err := starlark.UnpackArgs(ruleInclude,
-		args, kwargs, "git?", &gitRepo); err != nil {
+		args, kwargs, "git?", &gitRepo, "path?", &path); err != nil {
 		return nil, err
 	}
 
-	logger.Debugf("rule `%s` is invoked, git=%s", ruleInclude, gitRepo)
+	logger.Debugf("rule `%s` is invoked, git=%s, path=%s", ruleInclude, gitRepo, path)
+
+	if (gitRepo == "") == (path == "") {
+		return nil, errors.New("exactly one of git and path should be specified")
+	}
+	name, module := gitRepo, fmt.Sprintf("%s%s", GitPrefix, gitRepo)
+	if path != "" {
+		// The local path is resolved relative to the including file.
+		name, module = path, path
+	}
 
-	globals, err := thread.Load(thread, fmt.Sprintf("%s%s", GitPrefix, gitRepo))
+	globals, err := thread.Load(thread, module)
 	if err != nil {
 		return nil, err
 	}
-	module := &starlarkstruct.Module{
-		Name:    gitRepo,
+	return &starlarkstruct.Module{
+		Name:    name,
 		Members: globals,
-	}
-	return module, nil
+	}, nil
 }
@@ -0,0 +1,57 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/errors"
+)
+
+// BuildArgs sets the arguments passed by envd build --arg, which are read by
+// args.get in the build file.
+func BuildArgs(args map[string]string) error {
+	for name := range args {
+		if !envNamePattern.MatchString(name) {
+			return errors.Newf("invalid build arg name %q", name)
+		}
+	}
+	DefaultGraph.BuildArgs = args
+	return nil
+}
+
+// BuildArg returns the value of the build arg read by the build file, and
+// the name is recorded thus the unused ones are reported.
+func BuildArg(name string) (string, bool) {
+	if DefaultGraph.usedBuildArgs == nil {
+		DefaultGraph.usedBuildArgs = make(map[string]bool)
+	}
+	DefaultGraph.usedBuildArgs[name] = true
+	value, ok := DefaultGraph.BuildArgs[name]
+	return value, ok
+}
+
+// UnusedBuildArgs returns the names of the build args which are passed but
+// not read by the build file, e.g. the typos.
+func UnusedBuildArgs() []string {
+	unused := []string{}
+	for name := range DefaultGraph.BuildArgs {
+		if !DefaultGraph.usedBuildArgs[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
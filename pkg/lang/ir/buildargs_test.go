@@ -0,0 +1,42 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildArgs(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	if err := BuildArgs(map[string]string{"CUDA-VERSION": "11.7"}); err == nil {
+		t.Error("expected the error of the invalid name")
+	}
+	if err := BuildArgs(map[string]string{"CUDA": "11.7", "CUDNM": "8"}); err != nil {
+		t.Fatalf("failed to set the build args: %v", err)
+	}
+	if value, ok := BuildArg("CUDA"); !ok || value != "11.7" {
+		t.Errorf("expected the CUDA version, got %q, %v", value, ok)
+	}
+	if _, ok := BuildArg("CUDNN"); ok {
+		t.Error("expected the CUDNN not passed")
+	}
+	expected := []string{"CUDNM"}
+	if unused := UnusedBuildArgs(); !reflect.DeepEqual(unused, expected) {
+		t.Errorf("expected the unused %v, got %v", expected, unused)
+	}
+}
@@ -17,7 +17,7 @@ package ir
 import (
 	"fmt"
 
-	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 func (g Graph) CacheID(filename string) string {
@@ -27,6 +27,6 @@ func (g Graph) CacheID(filename string) string {
 	} else {
 		cacheID = fmt.Sprintf("%s/%s-cpu", filename, g.EnvironmentName)
 	}
-	logrus.Debugf("apt/pypi calculated cacheID: %s", cacheID)
+	log.Debugf("apt/pypi calculated cacheID: %s", cacheID)
 	return cacheID
 }
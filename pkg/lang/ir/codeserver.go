@@ -0,0 +1,86 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+const (
+	codeServerVersion = "4.16.1"
+	codeServerArchive = "code-server-" + codeServerVersion + "-linux-amd64"
+	codeServerURL     = "https://github.com/coder/code-server/releases/download/v" +
+		codeServerVersion + "/" + codeServerArchive + ".tar.gz"
+	codeServerBin = "/opt/" + codeServerArchive + "/bin/code-server"
+)
+
+type CodeServerConfig struct {
+	// Port is the port of code-server in the host, it is a free port if
+	// it is 0.
+	Port int64
+}
+
+// CodeServer installs code-server in the image and starts it in the
+// environment, thus the users get the vscode in the browser.
+func CodeServer(port int64) error {
+	DefaultGraph.CodeServerConfig = &CodeServerConfig{Port: port}
+	return nil
+}
+
+// compileCodeServer installs code-server in the system stage.
+func (g Graph) compileCodeServer(root llb.State) llb.State {
+	if g.CodeServerConfig == nil {
+		return root
+	}
+	archive := llb.HTTP(codeServerURL, llb.Filename(codeServerArchive+".tar.gz"))
+	return root.File(llb.Copy(archive, codeServerArchive+".tar.gz", "/opt/", &llb.CopyInfo{
+		AttemptUnpack:  true,
+		CreateDestPath: true,
+	}), llb.WithCustomNamef("[internal] install code-server %s", codeServerVersion))
+}
+
+// generateCodeServerCommand returns the command to start code-server. It
+// shares the extensions and the settings with the vscode server, thus the
+// plugins in install.vscode_extensions and the settings in config.vscode
+// work in the browser too.
+func (g Graph) generateCodeServerCommand(workingDir string) []string {
+	if g.CodeServerConfig == nil {
+		return nil
+	}
+	return []string{
+		codeServerBin,
+		"--bind-addr", "0.0.0.0:" + strconv.Itoa(config.CodeServerPortInContainer),
+		// The port is only published to the localhost of the host.
+		"--auth", "none",
+		"--disable-telemetry",
+		"--extensions-dir", fileutil.EnvdHomeDir(".vscode-server", "extensions"),
+		"--user-data-dir", fileutil.EnvdHomeDir(".vscode-server", "data"),
+		workingDir,
+	}
+}
+
+// dockerfileCodeServer is the Dockerfile version of compileCodeServer.
+func (g Graph) dockerfileCodeServer(w *dockerfileWriter) {
+	if g.CodeServerConfig == nil {
+		return
+	}
+	w.run(fmt.Sprintf("curl -fsSL %s | tar -xz -C /opt", codeServerURL))
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCodeServer(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	DefaultGraph.EnvironmentName = "test"
+
+	if err := CodeServer(8081); err != nil {
+		t.Fatalf("failed to enable code-server: %v", err)
+	}
+	if DefaultGraph.CodeServerConfig.Port != 8081 {
+		t.Errorf("expected the port 8081, got %d", DefaultGraph.CodeServerConfig.Port)
+	}
+
+	script := DefaultGraph.EntrypointScript()
+	expected := codeServerBin + " --bind-addr 0.0.0.0:8080 --auth none --disable-telemetry " +
+		"--extensions-dir /home/envd/.vscode-server/extensions " +
+		"--user-data-dir /home/envd/.vscode-server/data /home/envd/test &\n"
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected %q in the script:\n%s", expected, script)
+	}
+
+	ports, err := DefaultGraph.ExposedPorts()
+	if err != nil {
+		t.Fatalf("failed to get the exposed ports: %v", err)
+	}
+	if _, ok := ports["8080/tcp"]; !ok {
+		t.Errorf("expected the code-server port to be exposed, got %v", ports)
+	}
+}
@@ -19,19 +19,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
+	"strconv"
 
 	"github.com/cockroachdb/errors"
+	"github.com/containerd/console"
 	"github.com/moby/buildkit/client/llb"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	"github.com/tensorchord/envd/pkg/config"
 	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/progress/compileui"
 	"github.com/tensorchord/envd/pkg/types"
-	"github.com/tensorchord/envd/pkg/util/fileutil"
 	"github.com/tensorchord/envd/pkg/version"
 )
 
@@ -56,7 +55,7 @@ func NewGraph() *Graph {
 		RPackages:       []string{},
 		JuliaPackages:   []string{},
 		SystemPackages:  []string{},
-		Exec:            []string{},
+		Exec:            []RunInfo{},
 		UserDirectories: []string{},
 		Shell:           shellBASH,
 		CondaConfig:     conda,
@@ -74,8 +73,23 @@ func NumGPUs() int {
 	return DefaultGraph.NumGPUs
 }
 
-func Compile(ctx context.Context, envName string, pub string) (*llb.Definition, error) {
-	w, err := compileui.New(ctx, os.Stdout, "auto")
+// CompileOptions are the properties of the build host. They are not kept in
+// the graph, thus the dumped graph is built the same way on the other hosts.
+type CompileOptions struct {
+	// Rootless keeps the uid and the gid in the range mapped by the rootless
+	// builder.
+	Rootless bool
+}
+
+func Compile(ctx context.Context, envName string, pub string,
+	opt CompileOptions) (*llb.Definition, error) {
+	return compile(ctx, envName, pub, opt, os.Stdout)
+}
+
+// compile compiles the default graph, and writes the progress to out.
+func compile(ctx context.Context, envName string, pub string,
+	opt CompileOptions, out console.File) (*llb.Definition, error) {
+	w, err := compileui.New(ctx, out, "auto")
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create compileui")
 	}
@@ -87,7 +101,10 @@ func Compile(ctx context.Context, envName string, pub string) (*llb.Definition,
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get uid/gid")
 	}
-	state, err := DefaultGraph.Compile(uid, gid)
+	if opt.Rootless {
+		uid, gid = rootlessUIDGID(uid, gid)
+	}
+	state, err := DefaultGraph.Compile(ctx, uid, gid)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to compile the graph")
 	}
@@ -107,8 +124,8 @@ func ExposedPorts() (map[string]struct{}, error) {
 	return DefaultGraph.ExposedPorts()
 }
 
-func CompileEntrypoint(buildContextDir string) ([]string, error) {
-	return DefaultGraph.GetEntrypoint(buildContextDir)
+func CompileEntrypoint() ([]string, error) {
+	return DefaultGraph.GetEntrypoint()
 }
 
 func CompileEnviron() []string {
@@ -142,6 +159,9 @@ func (g Graph) Labels() (map[string]string, error) {
 		labels[types.ImageLabelCUDNN] = g.CUDNN
 	}
 	labels[types.ImageLabelVendor] = types.ImageVendorEnvd
+	if g.usesEntrypointScript() {
+		labels[types.ImageLabelEntrypoint] = strconv.Itoa(EntrypointScriptVersion)
+	}
 	code, err := g.RuntimeGraph.Dump()
 	if err != nil {
 		return labels, err
@@ -159,13 +179,18 @@ func (g Graph) ExposedPorts() (map[string]struct{}, error) {
 		return ports, nil
 	}
 
-	ports[fmt.Sprintf("%d/tcp", config.SSHPortInContainer)] = struct{}{}
+	if g.devTarget() {
+		ports[fmt.Sprintf("%d/tcp", config.SSHPortInContainer)] = struct{}{}
+	}
 	if g.JupyterConfig != nil {
 		ports[fmt.Sprintf("%d/tcp", config.JupyterPortInContainer)] = struct{}{}
 	}
 	if g.RStudioServerConfig != nil {
 		ports[fmt.Sprintf("%d/tcp", config.RStudioServerPortInContainer)] = struct{}{}
 	}
+	if g.CodeServerConfig != nil {
+		ports[fmt.Sprintf("%d/tcp", config.CodeServerPortInContainer)] = struct{}{}
+	}
 
 	if g.RuntimeExpose != nil && len(g.RuntimeExpose) > 0 {
 		for _, item := range g.RuntimeExpose {
@@ -178,9 +203,25 @@ func (g Graph) ExposedPorts() (map[string]struct{}, error) {
 
 func (g Graph) EnvString() []string {
 	var envs []string
+	if g.BaseDockerfile != nil {
+		for k, v := range g.BaseDockerfile.Env() {
+			envs = append(envs, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
 	for k, v := range g.RuntimeEnviron {
 		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
 	}
+	if len(g.CACertificates) > 0 {
+		envs = append(envs, fmt.Sprintf("REQUESTS_CA_BUNDLE=%s", caBundleFilePath),
+			fmt.Sprintf("SSL_CERT_FILE=%s", caBundleFilePath))
+	}
+	if g.Timezone != nil {
+		envs = append(envs, fmt.Sprintf("TZ=%s", *g.Timezone))
+	}
+	if g.Locale != nil {
+		envs = append(envs, fmt.Sprintf("LANG=%s", *g.Locale),
+			fmt.Sprintf("LC_ALL=%s", *g.Locale))
+	}
 	return envs
 }
 
@@ -201,7 +242,7 @@ func (g Graph) DefaultCacheImporter() (*string, error) {
 	return &res, nil
 }
 
-func (g Graph) GetEntrypoint(buildContextDir string) ([]string, error) {
+func (g Graph) GetEntrypoint() ([]string, error) {
 	if g.Image != nil {
 		return g.Entrypoint, nil
 	}
@@ -209,48 +250,29 @@ func (g Graph) GetEntrypoint(buildContextDir string) ([]string, error) {
 	ep := []string{
 		"tini",
 		"--",
-		"bash",
-		"-c",
 	}
-
-	template := `set -euo pipefail
-/var/envd/bin/envd-sshd --port %d --shell %s &
-%s
-wait -n`
-
-	// Generate jupyter and rstudio server commands.
-	var customCmd strings.Builder
-	workingDir := fileutil.EnvdHomeDir(filepath.Base(buildContextDir))
-	if g.RuntimeDaemon != nil {
-		for _, command := range g.RuntimeDaemon {
-			customCmd.WriteString(fmt.Sprintf("%s &\n", strings.Join(command, " ")))
-		}
+	if len(g.Entrypoint) > 0 && g.ReplaceEntrypoint {
+		log.Warn("envd-sshd is replaced by the entrypoint, thus the environment cannot be attached by ssh")
+		return append(ep, g.Entrypoint...), nil
 	}
-	if g.JupyterConfig != nil {
-		jupyterCmd := g.generateJupyterCommand(workingDir)
-		customCmd.WriteString(strings.Join(jupyterCmd, " "))
-		customCmd.WriteString("\n")
+	// There is no envd-sshd in the production image, thus the command is
+	// given by docker run if there is no entrypoint.
+	if !g.devTarget() {
+		return append(ep, g.Entrypoint...), nil
 	}
-	if g.RStudioServerConfig != nil {
-		rstudioCmd := g.generateRStudioCommand(workingDir)
-		customCmd.WriteString(strings.Join(rstudioCmd, " "))
-		customCmd.WriteString("\n")
-	}
-
-	cmd := fmt.Sprintf(template,
-		config.SSHPortInContainer, g.Shell, customCmd.String())
-	ep = append(ep, cmd)
+	// The script is generated by EntrypointScript and stored in the image.
+	ep = append(ep, "bash", config.ContainerEntrypointPath)
 
-	logrus.WithField("entrypoint", ep).Debug("generate entrypoint")
+	log.WithField("entrypoint", ep).Debug("generate entrypoint")
 	return ep, nil
 }
 
-func (g Graph) Compile(uid, gid int) (llb.State, error) {
+func (g Graph) Compile(ctx context.Context, uid, gid int) (llb.State, error) {
 	g.uid = uid
 
 	// TODO(gaocegege): Remove the hack for https://github.com/tensorchord/envd/issues/370
 	g.gid = 1001
-	logrus.WithFields(logrus.Fields{
+	log.WithFields(log.Fields{
 		"uid": g.uid,
 		"gid": g.gid,
 	}).Debug("compile LLB")
@@ -260,11 +282,25 @@ func (g Graph) Compile(uid, gid int) (llb.State, error) {
 	if err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to get the base image")
 	}
+	base = g.compileSourceDateEpoch(base)
 	source, err := g.compileExtraSource(base)
 	if err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to get extra sources")
 	}
-	aptStage := g.compileUbuntuAPT(source)
+	aptStage, err := g.compileCUDALibraries(g.compileLocale(g.compileTimezone(
+		g.compileKnownHosts(g.compileUbuntuAPT(source)))))
+	if err != nil {
+		return llb.State{}, errors.Wrap(err, "failed to install the CUDA libraries")
+	}
+	aptStage = g.compileCodeServer(g.compileDatabaseClients(g.compileGitHubCLI(
+		g.compileDirenv(g.compileGitLFS(aptStage)))))
+	aptStage, err = g.compileTmux(aptStage)
+	if err != nil {
+		return llb.State{}, errors.Wrap(err, "failed to install tmux")
+	}
+	if err := g.compilePreCommit(); err != nil {
+		return llb.State{}, errors.Wrap(err, "failed to compile pre-commit")
+	}
 	var merged llb.State
 	// Use custom logic when image is specified.
 	if g.Image != nil {
@@ -275,29 +311,34 @@ func (g Graph) Compile(uid, gid int) (llb.State, error) {
 	} else {
 		switch g.Language.Name {
 		case "r":
-			merged, err = g.compileRLang(aptStage)
+			merged, err = g.compileRLang(ctx, aptStage)
 			if err != nil {
 				return llb.State{}, errors.Wrap(err, "failed to compile r language")
 			}
 		case "python":
-			merged, err = g.compilePython(aptStage)
+			merged, err = g.compilePython(ctx, aptStage)
 			if err != nil {
 				return llb.State{}, errors.Wrap(err, "failed to compile python")
 			}
 		case "julia":
-			merged, err = g.compileJulia(aptStage)
+			merged, err = g.compileJulia(ctx, aptStage)
 			if err != nil {
 				return llb.State{}, errors.Wrap(err, "failed to compile julia")
 			}
 		}
 	}
 
-	prompt := g.compilePrompt(merged)
-	copy := g.compileCopy(prompt)
+	prompt := g.compileGitHubCLICompletion(g.compileDirenvHook(g.compileShellRC(
+		g.compileTmuxAgent(g.compilePreCommitHome(g.compileShellState(g.compilePrompt(merged)))))))
+	cron, err := g.compileCron(prompt)
+	if err != nil {
+		return llb.State{}, errors.Wrap(err, "failed to compile the cron jobs")
+	}
+	copy := g.compileCopy(cron)
 	// TODO(gaocegege): Support order-based exec.
 	run := g.compileRun(copy)
 	git := g.compileGit(run)
-	finalStage := g.compileUserOwn(git)
+	finalStage := g.compileReproducible(g.compileEntrypoint(g.compileUserOwn(git)))
 	g.Writer.Finish()
 	return finalStage, nil
 }
@@ -0,0 +1,103 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetEntrypoint(t *testing.T) {
+	g := NewGraph()
+	g.Entrypoint = []string{"python", "serve.py", "--name", "a b"}
+	ep, err := g.GetEntrypoint()
+	if err != nil {
+		t.Fatalf("failed to get the entrypoint: %v", err)
+	}
+	expected := []string{"tini", "--", "bash", "/var/envd/bin/entrypoint.sh"}
+	if !reflect.DeepEqual(ep, expected) {
+		t.Errorf("expected %v, got %v", expected, ep)
+	}
+
+	g.ReplaceEntrypoint = true
+	ep, err = g.GetEntrypoint()
+	if err != nil {
+		t.Fatalf("failed to get the entrypoint: %v", err)
+	}
+	expected = []string{"tini", "--", "python", "serve.py", "--name", "a b"}
+	if !reflect.DeepEqual(ep, expected) {
+		t.Errorf("expected %v, got %v", expected, ep)
+	}
+
+	image := "python:3.9"
+	g.Image = &image
+	if ep, _ := g.GetEntrypoint(); !reflect.DeepEqual(ep, g.Entrypoint) {
+		t.Errorf("expected the entrypoint of the custom image %v, got %v", g.Entrypoint, ep)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	if !IsTarget(TargetDev) || IsTarget("prod") {
+		t.Errorf("expected the default target dev")
+	}
+
+	Target("prod")
+	if IsTarget(TargetDev) || !IsTarget("prod") {
+		t.Errorf("expected the target prod")
+	}
+	ports, err := DefaultGraph.ExposedPorts()
+	if err != nil {
+		t.Fatalf("failed to get the exposed ports: %v", err)
+	}
+	if _, ok := ports["2222/tcp"]; ok {
+		t.Errorf("expected no ssh port in the production image, got %v", ports)
+	}
+	ep, err := DefaultGraph.GetEntrypoint()
+	if err != nil {
+		t.Fatalf("failed to get the entrypoint: %v", err)
+	}
+	if !reflect.DeepEqual(ep, []string{"tini", "--"}) {
+		t.Errorf("expected the entrypoint without envd-sshd, got %v", ep)
+	}
+}
+
+func TestMinimal(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	if err := Shell(shellZSH, nil, ""); err != nil {
+		t.Fatalf("failed to set the shell: %v", err)
+	}
+	if err := VSCodePlugins([]string{"ms-python.python"}); err != nil {
+		t.Fatalf("failed to add the vscode plugins: %v", err)
+	}
+
+	Minimal()
+	if DefaultGraph.devTarget() || !IsTarget(TargetDev) {
+		t.Errorf("expected the dev target without the dev conveniences")
+	}
+	if DefaultGraph.Shell != shellBASH || len(DefaultGraph.VSCodePlugins) != 0 {
+		t.Errorf("expected no zsh and vscode plugins, got %s and %v",
+			DefaultGraph.Shell, DefaultGraph.VSCodePlugins)
+	}
+	ports, err := DefaultGraph.ExposedPorts()
+	if err != nil {
+		t.Fatalf("failed to get the exposed ports: %v", err)
+	}
+	if _, ok := ports["2222/tcp"]; ok {
+		t.Errorf("expected no ssh port in the minimal image, got %v", ports)
+	}
+}
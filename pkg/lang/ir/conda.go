@@ -22,9 +22,9 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/moby/buildkit/client/llb"
-	"github.com/sirupsen/logrus"
 
 	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
@@ -48,7 +48,7 @@ var (
 
 func (g Graph) compileCondaChannel(root llb.State) llb.State {
 	if g.CondaConfig.CondaChannel != nil {
-		logrus.WithField("conda-channel", *g.CondaChannel).Debug("using custom conda channel")
+		log.WithField("conda-channel", *g.CondaChannel).Debug("using custom conda channel")
 		stage := root.
 			File(llb.Mkfile(condarc,
 				0644, []byte(*g.CondaChannel), llb.WithUIDGID(g.uid, g.gid)), llb.WithCustomName("[internal] setting conda channel"))
@@ -72,6 +72,16 @@ func (g Graph) condaInitShell(shell string) string {
 	return fmt.Sprintf("%s init %s", path, shell)
 }
 
+// condaFishHook activates the envd environment in the config.fish. The hook
+// is evaluated in the shell, since the init of conda rewrites the config.fish.
+func (g Graph) condaFishHook() string {
+	path := g.condaCommandPath()
+	if g.CondaConfig.UseMicroMamba {
+		return fmt.Sprintf("%s shell hook -s fish | source; and micromamba activate envd", path)
+	}
+	return fmt.Sprintf("%s shell.fish hook | source; and conda activate envd", path)
+}
+
 func (g Graph) condaUpdateFromFile() string {
 	args := fmt.Sprintf("update -n envd --file %s", g.CondaEnvFileName)
 	if g.CondaConfig.UseMicroMamba {
@@ -82,7 +92,7 @@ func (g Graph) condaUpdateFromFile() string {
 
 func (g *Graph) compileCondaPackages(root llb.State) llb.State {
 	if len(g.CondaConfig.CondaPackages) == 0 && len(g.CondaEnvFileName) == 0 {
-		logrus.Debug("Conda packages not enabled")
+		log.Debug("Conda packages not enabled")
 		return root
 	}
 
@@ -113,8 +123,8 @@ func (g *Graph) compileCondaPackages(root llb.State) llb.State {
 
 	cmd := sb.String()
 	run = root.Dir(g.getWorkingDir()).
-		Run(llb.Shlex(cmd), llb.WithCustomNamef("[internal] %s %s",
-			cmd, strings.Join(g.CondaPackages, " ")))
+		Run(llb.Shlex(g.withTimeoutCommand(cmd)), llb.WithCustomNamef("[internal] %s %s",
+			cmd, strings.Join(g.CondaPackages, " ")), g.sourceLocation(ruleCondaPackages))
 	run.AddMount(g.getWorkingDir(), llb.Local(flag.FlagBuildContext))
 	run.AddMount(cacheDir, cacheMount,
 		llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared), llb.SourcePath("/cache-conda"))
@@ -150,6 +160,10 @@ func (g Graph) compileCondaEnvironment(root llb.State) (llb.State, error) {
 			llb.WithCustomNamef("[internal] initialize conda %s environment", g.Shell)).Run(
 			llb.Shlex(fmt.Sprintf(`bash -c 'echo "source %s/activate envd" >> %s'`, condaBinDir, fileutil.EnvdHomeDir(".zshrc"))),
 			llb.WithCustomName("[internal] add conda environment to zshrc"))
+	case shellFish:
+		run = run.Run(
+			llb.Shlex(fmt.Sprintf(`bash -c 'echo "%s" >> %s'`, g.condaFishHook(), fishConfigPath)),
+			llb.WithCustomName("[internal] add conda environment to config.fish"))
 	}
 	return run.Root(), nil
 }
@@ -14,7 +14,11 @@
 
 package ir
 
-import "github.com/tensorchord/envd/pkg/util/fileutil"
+import (
+	"regexp"
+
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
 
 const (
 	osDefault              = "ubuntu20.04"
@@ -22,9 +26,23 @@ const (
 	languageVersionDefault = "3"
 	CUDNNVersionDefault    = "8"
 
+	// TargetDev is the default build target, the other targets are for the
+	// production thus the dev tools, e.g. envd-sshd, are not installed.
+	TargetDev = "dev"
+
 	aptSourceFilePath = "/etc/apt/sources.list"
+	// aptProxyFilePath is only used by APT_CONFIG in the build process, thus
+	// apt in the environment does not depend on the proxy.
+	aptProxyFilePath  = "/etc/apt/envd-proxy.conf"
+	caCertificatesDir = "/usr/local/share/ca-certificates"
+	caBundleFilePath  = "/etc/ssl/certs/ca-certificates.crt"
 	pypiIndexFilePath = "/etc/pip.conf"
 
+	updateCACertificatesCommand = "if command -v update-ca-certificates >/dev/null; " +
+		"then update-ca-certificates; fi"
+
+	starshipInstallCommand = "curl --proto '=https' --tlsv1.2 -sSf https://starship.rs/install.sh | sh -s -- -y"
+
 	pypiConfigTemplate = `
 [global]
 index-url=%s
@@ -35,8 +53,25 @@ src = /tmp
 `
 )
 
+// aptCacheDirs are mounted as the cache in all the apt stages.
+var aptCacheDirs = []string{"/var/cache/apt", "/var/lib/apt"}
+
 var (
 	// used inside the container
 	defaultConfigDir   = fileutil.EnvdHomeDir(".config")
 	starshipConfigPath = fileutil.EnvdHomeDir(".config", "starship.toml")
+	fishConfigPath     = fileutil.EnvdHomeDir(".config", "fish", "config.fish")
+
+	// e.g. UTC, Asia/Shanghai, America/Argentina/Buenos_Aires
+	timezonePattern = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+	// e.g. C.UTF-8, en_US.UTF-8, zh_CN.GB18030
+	localePattern = regexp.MustCompile(`^[A-Za-z]+(_[A-Za-z]+)?\.[A-Za-z0-9-]+$`)
+	// e.g. git, zsh-navigation-tools, agnoster, the bash-it ones are the same
+	zshNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	// e.g. master, a branch or a tag, and the commit hash
+	ohMyZSHRevisionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+	// e.g. https://github.com/ohmyzsh/ohmyzsh.git, git@example.com:mirror/ohmyzsh.git
+	gitURLPattern = regexp.MustCompile(`^(https?://|ssh://|git@)\S+$`)
+	// e.g. PatrickF1/fzf.fish, ilancosman/tide@v5
+	fisherPluginPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*/[A-Za-z0-9_.-]+(@[A-Za-z0-9_./-]+)?$`)
 )
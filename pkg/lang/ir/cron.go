@@ -0,0 +1,110 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+const (
+	cronTabPath = "/etc/cron.d/envd"
+	// cronStartCommand starts the cron daemon in the entrypoint. cron runs
+	// as root, and the jobs run as the envd user.
+	cronStartCommand = "sudo cron"
+)
+
+// CronJob is the command run periodically in the environment.
+type CronJob struct {
+	Schedule string
+	Command  string
+}
+
+var (
+	cronFieldPattern = regexp.MustCompile(`^[0-9A-Za-z*,/-]+$`)
+	cronMacros       = map[string]bool{
+		"@yearly": true, "@annually": true, "@monthly": true, "@weekly": true,
+		"@daily": true, "@midnight": true, "@hourly": true, "@reboot": true,
+	}
+)
+
+// RuntimeCron runs the command on the schedule in the cron format,
+// e.g. `0 2 * * *`, or the macros, e.g. `@daily`.
+func RuntimeCron(schedule, command string) error {
+	if err := validateCronSchedule(schedule); err != nil {
+		return err
+	}
+	if strings.TrimSpace(command) == "" || strings.Contains(command, "\n") {
+		return errors.Newf("invalid cron command %q, expected a single line", command)
+	}
+	DefaultGraph.RuntimeCron = append(DefaultGraph.RuntimeCron, CronJob{
+		Schedule: schedule,
+		Command:  command,
+	})
+	return nil
+}
+
+func validateCronSchedule(schedule string) error {
+	if cronMacros[schedule] {
+		return nil
+	}
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return errors.Newf("invalid cron schedule %q, expected 5 fields or the macros like @daily",
+			schedule)
+	}
+	for _, f := range fields {
+		if !cronFieldPattern.MatchString(f) {
+			return errors.Newf("invalid field %q in the cron schedule %q", f, schedule)
+		}
+	}
+	return nil
+}
+
+// crontab returns the system crontab of the jobs. The output is sent to
+// the container log, thus it can be checked by docker logs.
+func (g Graph) crontab() string {
+	var sb strings.Builder
+	sb.WriteString("SHELL=/bin/bash\n")
+	sb.WriteString(fmt.Sprintf("PATH=%s\n", types.DefaultPathEnvUnix))
+	for _, job := range g.RuntimeCron {
+		// % is the newline in the crontab.
+		command := strings.ReplaceAll(job.Command, "%", `\%`)
+		sb.WriteString(fmt.Sprintf("%s envd cd %s && %s > /proc/1/fd/1 2>&1\n",
+			job.Schedule, shellescape.Quote(g.getWorkingDir()), command))
+	}
+	return sb.String()
+}
+
+func (g Graph) compileCron(root llb.State) (llb.State, error) {
+	if len(g.RuntimeCron) == 0 {
+		return root, nil
+	}
+	if g.Image != nil {
+		return llb.State{}, errors.New("runtime.cron is not supported in the custom base image")
+	}
+	cron := g.runWithAPTCache(root, aptInstallCommand([]string{"cron"}),
+		llb.WithCustomName("[internal] install cron")).
+		File(llb.Mkfile(cronTabPath, 0644, []byte(g.crontab())),
+			llb.WithCustomName("[internal] add the cron jobs"))
+	return cron, nil
+}
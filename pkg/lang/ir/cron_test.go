@@ -0,0 +1,53 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuntimeCron(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	DefaultGraph.EnvironmentName = "test"
+
+	for _, schedule := range []string{"0 2 * * *", "*/5 1-3 * * mon,fri", "@daily"} {
+		if err := RuntimeCron(schedule, "date +%s"); err != nil {
+			t.Errorf("failed to add the cron job %s: %v", schedule, err)
+		}
+	}
+	for _, tc := range []struct{ schedule, command string }{
+		{"0 2 * *", "date"},
+		{"0 2 * * * *", "date"},
+		{"0 2 * * ?", "date"},
+		{"@often", "date"},
+		{"@daily", ""},
+		{"@daily", "date\ndate"},
+	} {
+		if err := RuntimeCron(tc.schedule, tc.command); err == nil {
+			t.Errorf("expected the error for %q %q", tc.schedule, tc.command)
+		}
+	}
+
+	crontab := DefaultGraph.crontab()
+	expected := "0 2 * * * envd cd /home/envd/test && date +\\%s > /proc/1/fd/1 2>&1\n"
+	if !strings.Contains(crontab, expected) {
+		t.Errorf("expected %q in the crontab:\n%s", expected, crontab)
+	}
+	if n := strings.Count(crontab, " envd cd "); n != 3 {
+		t.Errorf("expected 3 jobs, got %d:\n%s", n, crontab)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+)
+
+// cudaKeyringURL is the keyring package of the NVIDIA apt repo, which
+// replaces the rotated key in the legacy nvidia/cuda images.
+const cudaKeyringURL = "https://developer.download.nvidia.com/compute/cuda/repos/%s/x86_64/cuda-keyring_1.0-1_all.deb"
+
+// cudaLibraries maps the CUDA libraries to their apt packages in the NVIDIA
+// apt repo, whose versions are suffixed with the CUDA version, e.g.
+// 2.15.5-1+cuda11.8. The first package is used to resolve the version.
+var cudaLibraries = map[string][]string{
+	"nccl": {"libnccl2", "libnccl-dev"},
+	"tensorrt": {"libnvinfer8", "libnvinfer-plugin8", "libnvparsers8",
+		"libnvonnxparsers8", "libnvinfer-dev", "libnvinfer-plugin-dev",
+		"libnvparsers-dev", "libnvonnxparsers-dev"},
+}
+
+// CUDALibraries installs the CUDA libraries, e.g. tensorrt and nccl, from
+// the NVIDIA apt repo, matching the CUDA version set by install.cuda.
+func CUDALibraries(names []string) error {
+	for _, name := range names {
+		if _, ok := cudaLibraries[name]; !ok {
+			supported := make([]string, 0, len(cudaLibraries))
+			for lib := range cudaLibraries {
+				supported = append(supported, lib)
+			}
+			sort.Strings(supported)
+			return errors.Newf("CUDA library %s is not supported, expected one of %s",
+				name, strings.Join(supported, ", "))
+		}
+		DefaultGraph.CUDALibraries = append(DefaultGraph.CUDALibraries, name)
+	}
+	return nil
+}
+
+// cudaLibrariesCommand returns the command which configures the NVIDIA apt
+// repo and installs the CUDA libraries. It is a single line without the
+// double quotes, thus it works in both runWithAPTCache and the Dockerfile.
+func (g Graph) cudaLibrariesCommand() (string, error) {
+	if g.CUDA == nil {
+		return "", errors.New("install.cuda_libraries requires install.cuda")
+	}
+	family, version, err := parseOS(g.OS)
+	if err != nil {
+		return "", err
+	}
+	// e.g. ubuntu20.04 is ubuntu2004 in the NVIDIA apt repo.
+	repo := family + strings.ReplaceAll(version, ".", "")
+	// The packages are built for the CUDA major.minor, e.g. 11.8.
+	parts := strings.Split(*g.CUDA, ".")
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	cuda := strings.Join(parts, ".")
+
+	cmds := []string{
+		// The legacy sources are signed by the rotated key, and they
+		// conflict with the source in the keyring package.
+		"rm -f /etc/apt/sources.list.d/cuda.list /etc/apt/sources.list.d/nvidia-ml.list",
+		fmt.Sprintf("curl -fsSL -o /tmp/cuda-keyring.deb %s", fmt.Sprintf(cudaKeyringURL, repo)),
+		"dpkg -i /tmp/cuda-keyring.deb",
+		"rm -f /tmp/cuda-keyring.deb",
+		"apt-get update",
+	}
+	seen := map[string]bool{}
+	for _, name := range g.CUDALibraries {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		pkgs := cudaLibraries[name]
+		versioned := make([]string, 0, len(pkgs))
+		for _, pkg := range pkgs {
+			versioned = append(versioned, fmt.Sprintf("%s=$v", pkg))
+		}
+		cmds = append(cmds,
+			fmt.Sprintf("v=$(apt-cache madison %s | awk '{print $3}' | grep -F '+cuda%s' | head -n 1)",
+				pkgs[0], cuda),
+			fmt.Sprintf("{ [ ${#v} -gt 0 ] || { echo '%s is not found for CUDA %s' >&2; exit 1; }; }",
+				name, cuda),
+			// The packages may be held in the nvidia/cuda images.
+			fmt.Sprintf("DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends "+
+				"--allow-change-held-packages %s", strings.Join(versioned, " ")))
+	}
+	return strings.Join(cmds, " && "), nil
+}
+
+// compileCUDALibraries installs the CUDA libraries in the system stage.
+func (g Graph) compileCUDALibraries(root llb.State) (llb.State, error) {
+	if len(g.CUDALibraries) == 0 {
+		return root, nil
+	}
+	cmd, err := g.cudaLibrariesCommand()
+	if err != nil {
+		return llb.State{}, err
+	}
+	return g.runWithAPTCache(root, cmd,
+		llb.WithCustomNamef("[internal] install CUDA libraries %s",
+			strings.Join(g.CUDALibraries, " "))), nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCUDALibraries(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	if err := CUDALibraries([]string{"cublas"}); err == nil {
+		t.Errorf("expected the error of the unsupported library")
+	}
+	if err := CUDALibraries([]string{"tensorrt", "nccl"}); err != nil {
+		t.Fatalf("failed to set the CUDA libraries: %v", err)
+	}
+	if _, err := DefaultGraph.cudaLibrariesCommand(); err == nil {
+		t.Errorf("expected the error without install.cuda")
+	}
+
+	CUDA("11.6.2", "8")
+	cmd, err := DefaultGraph.cudaLibrariesCommand()
+	if err != nil {
+		t.Fatalf("failed to get the command: %v", err)
+	}
+	for _, expected := range []string{
+		"/repos/ubuntu2004/x86_64/cuda-keyring_1.0-1_all.deb",
+		"apt-cache madison libnvinfer8 | awk '{print $3}' | grep -F '+cuda11.6'",
+		"libnccl2=$v libnccl-dev=$v",
+	} {
+		if !strings.Contains(cmd, expected) {
+			t.Errorf("expected %q in the command %s", expected, cmd)
+		}
+	}
+	if strings.Contains(cmd, `"`) {
+		t.Errorf("expected no double quote in the command %s", cmd)
+	}
+}
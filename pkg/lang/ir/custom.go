@@ -27,7 +27,7 @@ func (g Graph) compileCustomPython(aptStage llb.State) (llb.State, error) {
 
 	builtinSystemStage := pypiMirrorStage
 
-	systemStage := g.compileCustomSystemPackages(builtinSystemStage)
+	systemStage := g.compileSystemPackages(builtinSystemStage)
 	pypiStage := g.compileCustomPyPIPackages(systemStage)
 
 	return pypiStage, nil
@@ -60,29 +60,3 @@ func (g Graph) compileCustomPyPIPackages(root llb.State) llb.State {
 		llb.SourcePath("/cache"))
 	return run.Root()
 }
-
-func (g Graph) compileCustomSystemPackages(root llb.State) llb.State {
-	if len(g.SystemPackages) == 0 {
-		return root
-	}
-
-	// Compose the package install command.
-	var sb strings.Builder
-	sb.WriteString("apt-get update && apt-get install -y --no-install-recommends")
-
-	for _, pkg := range g.SystemPackages {
-		sb.WriteString(fmt.Sprintf(" %s", pkg))
-	}
-
-	cacheDir := "/var/cache/apt"
-	cacheLibDir := "/var/lib/apt"
-
-	run := root.Run(llb.Shlex(fmt.Sprintf("bash -c \"%s\"", sb.String())),
-		llb.WithCustomNamef("apt-get install %s",
-			strings.Join(g.SystemPackages, " ")))
-	run.AddMount(cacheDir, llb.Scratch(),
-		llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared))
-	run.AddMount(cacheLibDir, llb.Scratch(),
-		llb.AsPersistentCacheDir(g.CacheID(cacheLibDir), llb.CacheMountShared))
-	return run.Root()
-}
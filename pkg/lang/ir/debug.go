@@ -0,0 +1,87 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/opencontainers/go-digest"
+)
+
+// LLBVertex is the vertex in the marshalled LLB definition, for debugging.
+type LLBVertex struct {
+	Digest string   `json:"digest"`
+	Name   string   `json:"name,omitempty"`
+	Op     string   `json:"op"`
+	Inputs []string `json:"inputs,omitempty"`
+}
+
+// DumpLLB compiles the default graph and returns the vertices of the LLB
+// definition in order. The progress is written to stderr to keep stdout clean.
+func DumpLLB(ctx context.Context, envName string, pub string,
+	opt CompileOptions) ([]LLBVertex, error) {
+	def, err := compile(ctx, envName, pub, opt, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return llbVertices(def)
+}
+
+func llbVertices(def *llb.Definition) ([]LLBVertex, error) {
+	vertices := make([]LLBVertex, 0, len(def.Def))
+	for _, dt := range def.Def {
+		var op pb.Op
+		if err := op.Unmarshal(dt); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal the llb op")
+		}
+		dgst := digest.FromBytes(dt)
+		v := LLBVertex{
+			Digest: dgst.String(),
+			Name:   def.Metadata[dgst].Description["llb.customname"],
+			Op:     describeOp(op),
+		}
+		for _, input := range op.Inputs {
+			v.Inputs = append(v.Inputs, input.Digest.String())
+		}
+		vertices = append(vertices, v)
+	}
+	return vertices, nil
+}
+
+func describeOp(op pb.Op) string {
+	switch o := op.Op.(type) {
+	case *pb.Op_Exec:
+		return fmt.Sprintf("exec %s", strings.Join(o.Exec.Meta.Args, " "))
+	case *pb.Op_Source:
+		return fmt.Sprintf("source %s", o.Source.Identifier)
+	case *pb.Op_File:
+		return fmt.Sprintf("file (%d actions)", len(o.File.Actions))
+	case *pb.Op_Build:
+		return "build"
+	case *pb.Op_Merge:
+		return "merge"
+	case *pb.Op_Diff:
+		return "diff"
+	default:
+		// The last vertex has no op, it only refers to the result.
+		return "result"
+	}
+}
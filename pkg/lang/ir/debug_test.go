@@ -0,0 +1,52 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+func TestLLBVertices(t *testing.T) {
+	def, err := llb.Image("docker.io/library/alpine:3.16").
+		Run(llb.Shlex("echo hello"), llb.WithCustomName("say hello")).
+		Root().Marshal(context.TODO(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the llb: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	if len(vertices) != 3 {
+		t.Fatalf("expected 3 vertices, got %d", len(vertices))
+	}
+	if !strings.HasPrefix(vertices[0].Op, "source docker-image://") {
+		t.Errorf("expected the source op, got %s", vertices[0].Op)
+	}
+	exec := vertices[1]
+	if exec.Op != "exec echo hello" || exec.Name != "say hello" {
+		t.Errorf("unexpected exec vertex %+v", exec)
+	}
+	if len(exec.Inputs) != 1 || exec.Inputs[0] != vertices[0].Digest {
+		t.Errorf("expected the exec to depend on the source, got %v", exec.Inputs)
+	}
+	if vertices[2].Op != "result" {
+		t.Errorf("expected the result vertex, got %s", vertices[2].Op)
+	}
+}
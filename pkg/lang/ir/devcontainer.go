@@ -0,0 +1,133 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/config"
+)
+
+// devContainer is the subset of the devcontainer.json spec used by envd,
+// see https://containers.dev/implementors/json_reference/.
+type devContainer struct {
+	Name            string `json:"name"`
+	Image           string `json:"image"`
+	RemoteUser      string `json:"remoteUser,omitempty"`
+	WorkspaceFolder string `json:"workspaceFolder"`
+	WorkspaceMount  string `json:"workspaceMount"`
+	// OverrideCommand is false to keep the envd entrypoint, which starts
+	// the daemons, jupyter and the cron jobs.
+	OverrideCommand   *bool                       `json:"overrideCommand,omitempty"`
+	RunArgs           []string                    `json:"runArgs,omitempty"`
+	ForwardPorts      []int                       `json:"forwardPorts,omitempty"`
+	PortsAttributes   map[string]devContainerPort `json:"portsAttributes,omitempty"`
+	PostCreateCommand string                      `json:"postCreateCommand,omitempty"`
+	Customizations    *devContainerCustomizations `json:"customizations,omitempty"`
+}
+
+type devContainerPort struct {
+	Label string `json:"label"`
+}
+
+type devContainerCustomizations struct {
+	VSCode devContainerVSCode `json:"vscode"`
+}
+
+type devContainerVSCode struct {
+	Extensions []string `json:"extensions"`
+}
+
+// DevContainer returns the devcontainer.json of the environment built as
+// the image, thus it can be opened by VS Code Remote Containers and GitHub
+// Codespaces.
+func DevContainer(envName, image string) ([]byte, error) {
+	DefaultGraph.EnvironmentName = envName
+	return DefaultGraph.DevContainer(image)
+}
+
+// DevContainer follows envd up, except that VS Code attaches to the
+// container by docker exec instead of envd-sshd, thus the ssh port is not
+// forwarded.
+func (g Graph) DevContainer(image string) ([]byte, error) {
+	workingDir := g.getWorkingDir()
+	dc := devContainer{
+		Name:            g.EnvironmentName,
+		Image:           image,
+		WorkspaceFolder: workingDir,
+		WorkspaceMount: fmt.Sprintf(
+			"source=${localWorkspaceFolder},target=%s,type=bind", workingDir),
+	}
+	if g.Image == nil {
+		dc.RemoteUser = "envd"
+	}
+	if g.usesEntrypointScript() {
+		override := false
+		dc.OverrideCommand = &override
+	} else if init := g.initCommands(workingDir); len(init) > 0 {
+		dc.PostCreateCommand = strings.Join(init, " && ")
+	}
+	if g.GPUEnabled() {
+		dc.RunArgs = []string{"--gpus", "all"}
+	}
+
+	labels := map[int]string{}
+	if g.JupyterConfig != nil {
+		labels[config.JupyterPortInContainer] = "jupyter"
+	}
+	if g.RStudioServerConfig != nil {
+		labels[config.RStudioServerPortInContainer] = "rstudio"
+	}
+	if g.CodeServerConfig != nil {
+		labels[config.CodeServerPortInContainer] = "code-server"
+	}
+	for _, item := range g.RuntimeExpose {
+		labels[item.EnvdPort] = item.ServiceName
+	}
+	for port, label := range labels {
+		dc.ForwardPorts = append(dc.ForwardPorts, port)
+		if label == "" {
+			continue
+		}
+		if dc.PortsAttributes == nil {
+			dc.PortsAttributes = make(map[string]devContainerPort)
+		}
+		dc.PortsAttributes[fmt.Sprint(port)] = devContainerPort{Label: label}
+	}
+	sort.Ints(dc.ForwardPorts)
+
+	if len(g.VSCodePlugins) > 0 {
+		dc.Customizations = &devContainerCustomizations{}
+		for _, p := range g.VSCodePlugins {
+			ext := fmt.Sprintf("%s.%s", p.Publisher, p.Extension)
+			if p.Version != nil {
+				ext = fmt.Sprintf("%s@%s", ext, *p.Version)
+			}
+			dc.Customizations.VSCode.Extensions = append(
+				dc.Customizations.VSCode.Extensions, ext)
+		}
+	}
+
+	data, err := json.MarshalIndent(dc, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the devcontainer.json")
+	}
+	return append(data, '\n'), nil
+}
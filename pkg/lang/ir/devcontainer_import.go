@@ -0,0 +1,371 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/cockroachdb/errors"
+)
+
+// devContainerSource is the subset of devcontainer.json read by
+// ImportDevContainer, the commands are in the string, array or object form.
+type devContainerSource struct {
+	Image string `json:"image"`
+	Build *struct {
+		Dockerfile string `json:"dockerfile"`
+	} `json:"build"`
+	DockerFile        string                      `json:"dockerFile"`
+	Features          map[string]json.RawMessage  `json:"features"`
+	Extensions        []string                    `json:"extensions"`
+	ForwardPorts      []interface{}               `json:"forwardPorts"`
+	ContainerEnv      map[string]string           `json:"containerEnv"`
+	RemoteEnv         map[string]string           `json:"remoteEnv"`
+	PostCreateCommand json.RawMessage             `json:"postCreateCommand"`
+	Customizations    *devContainerCustomizations `json:"customizations"`
+}
+
+var (
+	// devContainerImagePattern matches the language images of devcontainers,
+	// e.g. mcr.microsoft.com/devcontainers/python:3.10 or the legacy
+	// mcr.microsoft.com/vscode/devcontainers/python:0-3.10-bullseye.
+	devContainerImagePattern = regexp.MustCompile(
+		`^mcr\.microsoft\.com/(?:vscode/)?devcontainers/([a-z-]+)(?::(.*))?$`)
+	devContainerVersionPattern = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+)
+
+// devContainerBuiltinFeatures are installed in every envd environment.
+var devContainerBuiltinFeatures = map[string]bool{
+	"common-utils": true,
+	"sshd":         true,
+	"git":          true,
+}
+
+// ImportDevContainer reads the devcontainer.json and returns the skeleton
+// of build.envd, which installs the same language, features and vscode
+// extensions. The unsupported settings are left as the TODO comments.
+func ImportDevContainer(path, buildContextDir string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the devcontainer.json %s", path)
+	}
+	var dc devContainerSource
+	if err := json.Unmarshal(stripJSONComments(data), &dc); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the devcontainer.json %s", path)
+	}
+
+	w := &devContainerWriter{indent: "    "}
+	language := "python3"
+	var dockerfile string
+	switch {
+	case dc.Build != nil && dc.Build.Dockerfile != "":
+		dockerfile = dc.Build.Dockerfile
+	case dc.DockerFile != "":
+		dockerfile = dc.DockerFile
+	}
+	if dockerfile != "" {
+		// The Dockerfile is relative to the devcontainer.json, while it is
+		// relative to the build context in build.envd.
+		abs := filepath.Join(filepath.Dir(path), dockerfile)
+		if rel, err := filepath.Rel(buildContextDir, abs); err == nil {
+			dockerfile = filepath.ToSlash(rel)
+		}
+	} else if dc.Image != "" {
+		if l, ok := devContainerLanguage(dc.Image); ok {
+			language = l
+		} else {
+			w.todo("the base image %s is replaced by the envd base image", dc.Image)
+		}
+	}
+
+	features := make([]string, 0, len(dc.Features))
+	for id := range dc.Features {
+		features = append(features, id)
+	}
+	sort.Strings(features)
+	var installs []string
+	for _, id := range features {
+		name := devContainerFeatureName(id)
+		options := map[string]interface{}{}
+		// The options are ignored if they are given as the version string.
+		_ = json.Unmarshal(dc.Features[id], &options)
+		version, _ := options["version"].(string)
+		switch {
+		case devContainerBuiltinFeatures[name]:
+		case name == "python":
+			language = "python3"
+			if devContainerVersionPattern.MatchString(version) {
+				language = "python" + devContainerVersionPattern.FindString(version)
+			}
+		case name == "r-apt" || name == "r-rig":
+			language = "r"
+		case name == "julia":
+			language = "julia"
+		case name == "nvidia-cuda":
+			cuda, _ := options["cudaVersion"].(string)
+			if cuda == "" {
+				cuda = "11.6.2"
+			}
+			call := fmt.Sprintf("install.cuda(version=%s", strconv.Quote(cuda))
+			if cudnn, _ := options["cudnnVersion"].(string); cudnn != "" {
+				major, _, _ := strings.Cut(cudnn, ".")
+				call += fmt.Sprintf(", cudnn=%s", strconv.Quote(major))
+			}
+			installs = append(installs, call+")")
+		case name == "git-lfs":
+			installs = append(installs, "install.git_lfs()")
+		case name == "github-cli":
+			installs = append(installs, "install.github_cli()")
+		case name == "direnv":
+			installs = append(installs, "install.direnv()")
+		case name == "pre-commit":
+			installs = append(installs, "install.pre_commit()")
+		default:
+			w.todo("the feature %s is not supported", id)
+		}
+	}
+
+	w.line("def build():")
+	w.line(`%sos(name="ubuntu", version="20.04")`, w.indent)
+	if dockerfile != "" {
+		w.line("%sbase(language=%s, dockerfile=%s)", w.indent,
+			strconv.Quote(language), strconv.Quote(dockerfile))
+	} else {
+		w.line("%sbase(language=%s)", w.indent, strconv.Quote(language))
+	}
+	for _, call := range installs {
+		w.line("%s%s", w.indent, call)
+	}
+
+	extensions := dc.Extensions
+	if dc.Customizations != nil {
+		extensions = append(extensions, dc.Customizations.VSCode.Extensions...)
+	}
+	if len(extensions) > 0 {
+		names := make([]string, 0, len(extensions))
+		for _, e := range extensions {
+			names = append(names, strconv.Quote(e))
+		}
+		w.line("%sinstall.vscode_extensions(name=[%s])", w.indent, strings.Join(names, ", "))
+	}
+
+	for _, p := range dc.ForwardPorts {
+		var port int
+		switch v := p.(type) {
+		case float64:
+			port = int(v)
+		case string:
+			port, _ = strconv.Atoi(v)
+		}
+		if port <= 0 {
+			w.todo("the forwarded port %v is not supported", p)
+			continue
+		}
+		w.line("%sruntime.expose(envd_port=%d, host_port=%d)", w.indent, port, port)
+	}
+
+	env := map[string]string{}
+	for k, v := range dc.ContainerEnv {
+		env[k] = v
+	}
+	for k, v := range dc.RemoteEnv {
+		env[k] = v
+	}
+	if len(env) > 0 {
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, fmt.Sprintf("%s: %s", strconv.Quote(k), strconv.Quote(env[k])))
+		}
+		w.line("%sruntime.environ(env={%s})", w.indent, strings.Join(pairs, ", "))
+	}
+
+	commands, err := devContainerCommands(dc.PostCreateCommand)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the postCreateCommand in %s", path)
+	}
+	if len(commands) > 0 {
+		w.line("%s# postCreateCommand is run in the build, without the workspace.", w.indent)
+		quoted := make([]string, 0, len(commands))
+		for _, c := range commands {
+			quoted = append(quoted, strconv.Quote(c))
+		}
+		w.line("%srun(commands=[%s])", w.indent, strings.Join(quoted, ", "))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Imported from %s by envd, review it before the build.\n",
+		filepath.Base(path))
+	for _, t := range w.todos {
+		fmt.Fprintf(&buf, "# TODO: %s.\n", t)
+	}
+	buf.WriteString("\n")
+	buf.Write(w.buf.Bytes())
+	return buf.Bytes(), nil
+}
+
+type devContainerWriter struct {
+	buf    bytes.Buffer
+	indent string
+	todos  []string
+}
+
+func (w *devContainerWriter) line(format string, args ...interface{}) {
+	fmt.Fprintf(&w.buf, format+"\n", args...)
+}
+
+func (w *devContainerWriter) todo(format string, args ...interface{}) {
+	w.todos = append(w.todos, fmt.Sprintf(format, args...))
+}
+
+// devContainerLanguage returns the envd language of the devcontainers
+// language image.
+func devContainerLanguage(image string) (string, bool) {
+	matches := devContainerImagePattern.FindStringSubmatch(image)
+	if matches == nil {
+		return "", false
+	}
+	switch matches[1] {
+	case "python":
+		if v := devContainerVersionPattern.FindString(matches[2]); v != "" {
+			return "python" + v, true
+		}
+		return "python3", true
+	case "anaconda", "miniconda", "base", "universal":
+		return "python3", true
+	case "r":
+		return "r", true
+	}
+	return "", false
+}
+
+// devContainerFeatureName returns the name of the feature, e.g. python for
+// ghcr.io/devcontainers/features/python:1.
+func devContainerFeatureName(id string) string {
+	name := id[strings.LastIndex(id, "/")+1:]
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+// devContainerCommands returns the shell commands of the lifecycle script.
+func devContainerCommands(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []string{s}, nil
+	}
+	var args []string
+	if err := json.Unmarshal(raw, &args); err == nil {
+		return []string{shellescape.QuoteCommand(args)}, nil
+	}
+	var parallel map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &parallel); err != nil {
+		return nil, errors.New("expected the string, the array or the object")
+	}
+	names := make([]string, 0, len(parallel))
+	for name := range parallel {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var commands []string
+	for _, name := range names {
+		c, err := devContainerCommands(parallel[name])
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, c...)
+	}
+	return commands, nil
+}
+
+// stripJSONComments removes the comments and the trailing commas allowed
+// in devcontainer.json, which is JSON with comments.
+func stripJSONComments(data []byte) []byte {
+	var out bytes.Buffer
+	scanJSONStrings(data, func(i int) int {
+		switch {
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '/':
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				return len(data)
+			}
+			return i + end
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return len(data)
+			}
+			return i + end + 4
+		}
+		out.WriteByte(data[i])
+		return i + 1
+	}, func(b []byte) { out.Write(b) })
+
+	data = out.Bytes()
+	var res bytes.Buffer
+	scanJSONStrings(data, func(i int) int {
+		if data[i] == ',' {
+			// Drop the comma if the next token closes the object or the array.
+			rest := bytes.TrimLeft(data[i+1:], " \t\r\n")
+			if len(rest) > 0 && (rest[0] == '}' || rest[0] == ']') {
+				return i + 1
+			}
+		}
+		res.WriteByte(data[i])
+		return i + 1
+	}, func(b []byte) { res.Write(b) })
+	return res.Bytes()
+}
+
+// scanJSONStrings passes the string literals in data to str as they are,
+// and calls other at the offsets out of the strings, which returns the
+// offset to continue.
+func scanJSONStrings(data []byte, other func(i int) int, str func([]byte)) {
+	for i := 0; i < len(data); {
+		if data[i] != '"' {
+			i = other(i)
+			continue
+		}
+		j := i + 1
+		for j < len(data) && data[j] != '"' {
+			if data[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j < len(data) {
+			j++
+		} else {
+			j = len(data)
+		}
+		str(data[i:j])
+		i = j
+	}
+}
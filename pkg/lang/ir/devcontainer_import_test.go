@@ -0,0 +1,102 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportDevContainer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".devcontainer", "devcontainer.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `// For format details, see https://aka.ms/devcontainer.json.
+{
+	"name": "mnist",
+	"image": "mcr.microsoft.com/devcontainers/python:0-3.10-bullseye",
+	/* the GPU support */
+	"features": {
+		"ghcr.io/devcontainers/features/nvidia-cuda:1": {
+			"cudaVersion": "11.7",
+			"cudnnVersion": "8.5.0.96",
+		},
+		"ghcr.io/devcontainers/features/git-lfs:1": {},
+		"ghcr.io/devcontainers/features/common-utils:1": {},
+		"ghcr.io/devcontainers/features/docker-in-docker:2": "latest",
+	},
+	"forwardPorts": [8888, "db:5432"],
+	"containerEnv": {"URL": "http://example.com//a"},
+	"postCreateCommand": ["pip", "install", "-r", "requirements.txt"],
+	"customizations": {
+		"vscode": {
+			"extensions": ["ms-python.python@2022.8.0"], // pinned
+		},
+	},
+}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := ImportDevContainer(path, dir)
+	if err != nil {
+		t.Fatalf("failed to import the devcontainer.json: %v", err)
+	}
+	expected := []string{
+		"# TODO: the feature ghcr.io/devcontainers/features/docker-in-docker:2 is not supported.\n",
+		"# TODO: the forwarded port db:5432 is not supported.\n",
+		"def build():\n",
+		`    base(language="python3.10")` + "\n",
+		"    install.git_lfs()\n",
+		`    install.cuda(version="11.7", cudnn="8")` + "\n",
+		`    install.vscode_extensions(name=["ms-python.python@2022.8.0"])` + "\n",
+		"    runtime.expose(envd_port=8888, host_port=8888)\n",
+		`    runtime.environ(env={"URL": "http://example.com//a"})` + "\n",
+		`    run(commands=["pip install -r requirements.txt"])` + "\n",
+	}
+	last := 0
+	for _, e := range expected {
+		i := strings.Index(string(src), e)
+		if i < last {
+			t.Fatalf("expected %q after the offset %d in the build file:\n%s", e, last, src)
+		}
+		last = i
+	}
+	if strings.Contains(string(src), "common-utils") {
+		t.Errorf("expected the builtin feature to be skipped:\n%s", src)
+	}
+
+	data = `{"build": {"dockerfile": "Dockerfile"}, "postCreateCommand": {"a": "make", "b": "make test"}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err = ImportDevContainer(path, dir)
+	if err != nil {
+		t.Fatalf("failed to import the devcontainer.json: %v", err)
+	}
+	for _, e := range []string{
+		`base(language="python3", dockerfile=".devcontainer/Dockerfile")`,
+		`run(commands=["make", "make test"])`,
+	} {
+		if !strings.Contains(string(src), e) {
+			t.Errorf("expected %q in the build file:\n%s", e, src)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tensorchord/envd/pkg/editor/vscode"
+)
+
+func TestDevContainer(t *testing.T) {
+	version := "2022.8.0"
+	cuda := "11.6.2"
+	g := NewGraph()
+	g.EnvironmentName = "mnist"
+	g.CUDA = &cuda
+	g.JupyterConfig = &JupyterConfig{}
+	g.RuntimeExpose = []ExposeItem{{EnvdPort: 6006, HostPort: 6006, ServiceName: "tensorboard"}}
+	g.VSCodePlugins = []vscode.Plugin{
+		{Publisher: "ms-python", Extension: "python", Version: &version},
+		{Publisher: "eamodio", Extension: "gitlens"},
+	}
+
+	data, err := g.DevContainer("mnist:dev")
+	if err != nil {
+		t.Fatalf("failed to generate the devcontainer.json: %v", err)
+	}
+	var dc devContainer
+	if err := json.Unmarshal(data, &dc); err != nil {
+		t.Fatalf("failed to parse the devcontainer.json: %v\n%s", err, data)
+	}
+	if dc.Image != "mnist:dev" || dc.RemoteUser != "envd" ||
+		dc.WorkspaceFolder != "/home/envd/mnist" {
+		t.Errorf("unexpected devcontainer.json:\n%s", data)
+	}
+	if dc.OverrideCommand == nil || *dc.OverrideCommand || dc.PostCreateCommand != "" {
+		t.Errorf("expected the envd entrypoint to be kept:\n%s", data)
+	}
+	if !reflect.DeepEqual(dc.RunArgs, []string{"--gpus", "all"}) {
+		t.Errorf("expected the GPUs, got %v", dc.RunArgs)
+	}
+	if !reflect.DeepEqual(dc.ForwardPorts, []int{6006, 8888}) {
+		t.Errorf("expected the jupyter and the exposed ports, got %v", dc.ForwardPorts)
+	}
+	if dc.PortsAttributes["6006"].Label != "tensorboard" || dc.PortsAttributes["8888"].Label != "jupyter" {
+		t.Errorf("unexpected port labels %v", dc.PortsAttributes)
+	}
+	expected := []string{"ms-python.python@2022.8.0", "eamodio.gitlens"}
+	if dc.Customizations == nil || !reflect.DeepEqual(dc.Customizations.VSCode.Extensions, expected) {
+		t.Errorf("expected the extensions %v:\n%s", expected, data)
+	}
+
+	g.Minimal = true
+	g.RuntimeCron = []CronJob{{Schedule: "@daily", Command: "date"}}
+	data, err = g.DevContainer("mnist:dev-minimal")
+	if err != nil {
+		t.Fatalf("failed to generate the devcontainer.json: %v", err)
+	}
+	dc = devContainer{}
+	if err := json.Unmarshal(data, &dc); err != nil {
+		t.Fatalf("failed to parse the devcontainer.json: %v\n%s", err, data)
+	}
+	if dc.OverrideCommand != nil || dc.PostCreateCommand != cronStartCommand {
+		t.Errorf("expected the init commands in postCreateCommand:\n%s", data)
+	}
+}
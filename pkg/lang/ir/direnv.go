@@ -0,0 +1,88 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+// direnvConfigPath is the user config of direnv, in which the workspace is
+// whitelisted thus the .envrc there is loaded without direnv allow.
+var direnvConfigPath = filepath.Join(defaultConfigDir, "direnv", "direnv.toml")
+
+// Direnv installs direnv and hooks it into the shells.
+func Direnv() {
+	DefaultGraph.Direnv = true
+}
+
+func (g Graph) direnvConfig() string {
+	return fmt.Sprintf("[whitelist]\nprefix = [ %q ]\n", g.getWorkingDir())
+}
+
+// direnvHook returns the line which hooks direnv in the shell rc file.
+func direnvHook(rc string) string {
+	shell := "bash"
+	if filepath.Base(rc) == ".zshrc" {
+		shell = "zsh"
+	}
+	return fmt.Sprintf(`eval "$(direnv hook %s)"`, shell)
+}
+
+// compileDirenv installs direnv in the system stage.
+func (g Graph) compileDirenv(root llb.State) llb.State {
+	if !g.Direnv {
+		return root
+	}
+	return g.runWithAPTCache(root, aptInstallCommand([]string{"direnv"}),
+		llb.WithCustomName("[internal] install direnv"))
+}
+
+// compileDirenvHook whitelists the workspace and hooks direnv at the end of
+// the shell rc files, after the prompt which also sets the hooks.
+func (g Graph) compileDirenvHook(root llb.State) llb.State {
+	if !g.Direnv {
+		return root
+	}
+	if g.Image != nil {
+		log.Warn("direnv is not hooked into the shells in the custom image")
+		return root
+	}
+	hook := root.File(llb.Mkdir(filepath.Dir(direnvConfigPath), 0755, llb.WithParents(true),
+		llb.WithUIDGID(g.uid, g.gid)).
+		Mkfile(direnvConfigPath, 0644, []byte(g.direnvConfig()), llb.WithUIDGID(g.uid, g.gid)),
+		llb.WithCustomName("[internal] whitelist the workspace in direnv"))
+	for _, rc := range g.shellRCFiles() {
+		hook = hook.Run(llb.Args([]string{"bash", "-c",
+			fmt.Sprintf("echo '%s' >> %s", direnvHook(rc), rc)}),
+			llb.WithCustomNamef("[internal] hook direnv in %s", rc)).Root()
+	}
+	return hook
+}
+
+// dockerfileDirenvHook is the Dockerfile version of compileDirenvHook.
+func (g Graph) dockerfileDirenvHook(w *dockerfileWriter) {
+	if !g.Direnv || g.Image != nil {
+		return
+	}
+	w.file(direnvConfigPath, g.direnvConfig(), g.uid, g.gid)
+	for _, rc := range g.shellRCFiles() {
+		w.run(fmt.Sprintf("echo '%s' >> %s", direnvHook(rc), rc))
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+func TestDirenvHook(t *testing.T) {
+	g := NewGraph()
+	g.EnvironmentName = "mnist"
+	g.Shell = shellZSH
+	g.Direnv = true
+
+	expected := "[whitelist]\nprefix = [ \"" + g.getWorkingDir() + "\" ]\n"
+	if actual := g.direnvConfig(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	def, err := g.compileDirenvHook(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	ops := make(map[string]bool)
+	for _, v := range vertices {
+		ops[v.Op] = true
+	}
+	for _, rc := range g.shellRCFiles() {
+		if op := "exec bash -c echo '" + direnvHook(rc) + "' >> " + rc; !ops[op] {
+			t.Errorf("expected the op %q, got %v", op, ops)
+		}
+	}
+	if direnvHook(g.shellRCFiles()[1]) != `eval "$(direnv hook zsh)"` {
+		t.Errorf("expected the zsh hook in %s", g.shellRCFiles()[1])
+	}
+}
@@ -0,0 +1,787 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/shell"
+	"github.com/tensorchord/envd/pkg/types"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+	"github.com/tensorchord/envd/pkg/version"
+)
+
+const (
+	// heredoc and RUN --mount require the dockerfile frontend 1.4.
+	dockerfileSyntax = "docker/dockerfile:1.4"
+	heredocDelimiter = "ENVD_EOF"
+)
+
+// dockerfileWriter accumulates the instructions of a Dockerfile.
+type dockerfileWriter struct {
+	sb strings.Builder
+}
+
+func (w *dockerfileWriter) writef(format string, a ...interface{}) {
+	fmt.Fprintf(&w.sb, format+"\n", a...)
+}
+
+// run writes a RUN instruction. Multi-line commands are written
+// as a bash script in the heredoc.
+func (w *dockerfileWriter) run(cmd string, mounts ...string) {
+	var sb strings.Builder
+	sb.WriteString("RUN")
+	for _, m := range mounts {
+		sb.WriteString(" --mount=" + m)
+	}
+	if !strings.Contains(cmd, "\n") {
+		w.writef("%s %s", sb.String(), cmd)
+		return
+	}
+	w.writef("%s <<'%s'\n#!/bin/bash\n%s\n%s",
+		sb.String(), heredocDelimiter, strings.TrimRight(cmd, "\n"), heredocDelimiter)
+}
+
+// file writes a COPY instruction with the content in the heredoc.
+func (w *dockerfileWriter) file(dst, content string, uid, gid int) {
+	w.writef("COPY --chown=%d:%d <<'%s' %s\n%s\n%s",
+		uid, gid, heredocDelimiter, dst, strings.TrimRight(content, "\n"), heredocDelimiter)
+}
+
+func (w *dockerfileWriter) String() string {
+	return w.sb.String()
+}
+
+// Dockerfile walks the default graph and emits an equivalent Dockerfile,
+// whose build context is the build context of the envd environment.
+func Dockerfile(envName, pub, buildContextDir string) (string, error) {
+	DefaultGraph.EnvironmentName = envName
+	DefaultGraph.PublicKeyPath = pub
+
+	uid, gid, err := getUIDGID()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get uid/gid")
+	}
+	return DefaultGraph.Dockerfile(uid, gid, buildContextDir)
+}
+
+// Dockerfile follows the same steps as Compile, except that the
+// vscode extensions are not exported since they come from the host cache.
+func (g Graph) Dockerfile(uid, gid int, buildContextDir string) (string, error) {
+	g.uid = uid
+	// TODO(gaocegege): Remove the hack for https://github.com/tensorchord/envd/issues/370
+	g.gid = 1001
+
+	w := &dockerfileWriter{}
+	w.writef("# syntax=%s", dockerfileSyntax)
+	w.writef("# Generated by envd %s, DO NOT EDIT.", version.GetVersion().String())
+
+	if err := g.dockerfileBase(w); err != nil {
+		return "", err
+	}
+	if err := g.dockerfileSystem(w); err != nil {
+		return "", err
+	}
+	if g.Image != nil {
+		if err := g.compilePreCommit(); err != nil {
+			return "", err
+		}
+		g.dockerfileCustomPython(w)
+	} else {
+		switch g.Language.Name {
+		case "python":
+			if err := g.dockerfilePython(w); err != nil {
+				return "", err
+			}
+		case "r", "julia":
+			if err := g.dockerfileLanguage(w); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := g.dockerfileFinal(w); err != nil {
+		return "", err
+	}
+	if err := g.dockerfileImageConfig(w, buildContextDir); err != nil {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+func (g Graph) cacheMount(target string) string {
+	return fmt.Sprintf("type=cache,target=%s,id=%s,sharing=shared",
+		target, g.CacheID(target))
+}
+
+// aptCacheMounts returns the locked apt cache mounts, the same as runWithAPTCache.
+func (g Graph) aptCacheMounts() []string {
+	mounts := []string{}
+	for _, dir := range aptCacheDirs {
+		mounts = append(mounts, fmt.Sprintf("type=cache,target=%s,id=%s,sharing=locked",
+			dir, g.CacheID(dir)))
+	}
+	return mounts
+}
+
+func (g Graph) buildContextMount() string {
+	return fmt.Sprintf("type=bind,target=%s,rw", g.getWorkingDir())
+}
+
+func (g *Graph) dockerfileBase(w *dockerfileWriter) error {
+	if err := g.validateOSCombination(); err != nil {
+		return err
+	}
+	image, err := g.baseImage()
+	if err != nil {
+		return err
+	}
+
+	prepare := false
+	switch {
+	case g.Image != nil:
+		// The custom image is used as it is.
+	case g.BaseDockerfile != nil, g.CUDA != nil:
+		prepare = true
+	case g.Language.Name == "r":
+		// r-base image already has GID 1000.
+		if g.gid == 1000 {
+			g.gid = 1001
+		}
+		if g.uid == 1000 {
+			g.uid = 1001
+		}
+	case g.Language.Name == "julia":
+		// The julia image is built by envd, thus it is prepared already.
+	default:
+		prepare = true
+	}
+	w.writef("FROM %s", image)
+	w.writef(`SHELL ["/bin/bash", "-c"]`)
+
+	// Use ARG instead of ENV to keep the proxy out of the image config.
+	env := g.proxyEnv()
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		w.writef("ARG %s=%s", k, env[k])
+	}
+	// The certificates are needed by the downloads of the base image.
+	if err := g.dockerfileCACertificates(w); err != nil {
+		return err
+	}
+	if g.Image != nil {
+		return nil
+	}
+	if g.BaseDockerfile != nil {
+		g.dockerfileImportedSteps(w)
+	}
+
+	if prepare {
+		for _, env := range types.BaseEnvironment {
+			w.writef("ENV %s=%s", env.Name, env.Value)
+		}
+		w.run(aptInstallCommand(append([]string{"apt-utils"}, g.builtinSystemPackages()...)),
+			g.aptCacheMounts()...)
+		w.run(starshipInstallCommand)
+	}
+
+	if g.uid == 0 {
+		w.run(fmt.Sprintf("groupadd -g %d envd && "+
+			"useradd -p \"\" -u %d -g envd -s /bin/sh -m envd && "+
+			"usermod -s /bin/sh root && "+
+			"sed -i \"s/envd:x:1001:1001/envd:x:0:0/g\" /etc/passwd && "+
+			"sed -i \"s./root./home/envd.g\" /etc/passwd && "+
+			"sed -i \"s/envd:x:1001/envd:x:0/g\" /etc/group", 1001, 1001))
+	} else {
+		w.run(fmt.Sprintf("groupadd -g %d envd && "+
+			"useradd -p \"\" -u %d -g envd -s /bin/sh -m envd && "+
+			"adduser envd sudo", g.gid, g.uid))
+	}
+
+	if g.CondaConfig.UseMicroMamba {
+		w.writef("ENV MAMBA_BIN_DIR=%s MAMBA_ROOT_PREFIX=%s MAMBA_VERSION=%s",
+			condaBinDir, condaRootPrefix, mambaVersionDefault)
+		w.run(installMambaBash)
+	} else {
+		w.writef("ENV CONDA_VERSION=%s", condaVersionDefault)
+		w.run(fmt.Sprintf("mkdir -p %s", condaRootPrefix))
+		w.run(installCondaBash)
+	}
+
+	if g.devTarget() {
+		w.writef("COPY --from=%s /usr/bin/envd-sshd /var/envd/bin/envd-sshd", types.EnvdSshdImage)
+	}
+	return nil
+}
+
+// dockerfileImportedSteps writes back the steps of the imported Dockerfile.
+func (g Graph) dockerfileImportedSteps(w *dockerfileWriter) {
+	// The references to the base image env, e.g. $PATH, are kept in the
+	// values, thus $ is not escaped.
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	args := make(map[string]bool)
+	for _, step := range g.BaseDockerfile.Steps {
+		switch step.Instruction {
+		case dockerfileRun:
+			// ARG is not kept in the image either.
+			for _, kv := range step.BuildArgs {
+				if args[kv] {
+					continue
+				}
+				args[kv] = true
+				k, v, _ := strings.Cut(kv, "=")
+				w.writef("ARG %s=\"%s\"", k, r.Replace(v))
+			}
+			// The args are always in the exec form, thus it is safe to marshal.
+			data, _ := json.Marshal(step.Args)
+			w.writef("RUN %s", data)
+		case dockerfileEnv:
+			for i := 0; i+1 < len(step.Args); i += 2 {
+				w.writef("ENV %s=\"%s\"", step.Args[i], r.Replace(step.Args[i+1]))
+			}
+		case dockerfileCopy:
+			data, _ := json.Marshal(step.Args)
+			w.writef("COPY %s", data)
+		case dockerfileWorkdir:
+			w.writef("WORKDIR %s", step.Args[0])
+		}
+	}
+}
+
+func (g Graph) dockerfileCACertificates(w *dockerfileWriter) error {
+	if len(g.CACertificates) == 0 {
+		return nil
+	}
+	for i, p := range g.CACertificates {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the certificate %s", p)
+		}
+		name := fmt.Sprintf("envd-%d-%s.crt", i,
+			strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)))
+		w.file(filepath.Join(caCertificatesDir, name), string(content), 0, 0)
+	}
+	w.run(updateCACertificatesCommand)
+	w.writef("ENV REQUESTS_CA_BUNDLE=%[1]s SSL_CERT_FILE=%[1]s", caBundleFilePath)
+	return nil
+}
+
+func (g Graph) dockerfileSystem(w *dockerfileWriter) error {
+	for _, httpInfo := range g.HTTP {
+		filename := httpInfo.Filename
+		if filename == "" {
+			filename = path.Base(httpInfo.URL)
+		}
+		dst := filepath.Join(g.getExtraSourceDir(), filename)
+		w.writef("ADD --chown=%d:%d %s %s", g.uid, g.gid, httpInfo.URL, dst)
+		if httpInfo.Checksum != "" {
+			w.run(fmt.Sprintf("echo '%s  %s' | %ssum -c -",
+				httpInfo.Checksum.Encoded(), dst, httpInfo.Checksum.Algorithm()))
+		}
+	}
+
+	if g.UbuntuAPTSource != nil {
+		w.file(aptSourceFilePath, *g.UbuntuAPTSource, 0, 0)
+	}
+
+	g.dockerfileKnownHosts(w)
+
+	aptMounts := g.aptCacheMounts()
+	if g.Timezone != nil {
+		w.run(fmt.Sprintf("%[1]s && "+
+			"ln -snf /usr/share/zoneinfo/%[2]s /etc/localtime && echo %[2]s > /etc/timezone",
+			aptInstallCommand([]string{"tzdata"}), *g.Timezone), aptMounts...)
+		w.writef("ENV TZ=%s", *g.Timezone)
+	}
+	if g.Locale != nil {
+		w.run(fmt.Sprintf("%[1]s && locale-gen %[2]s && update-locale LANG=%[2]s",
+			aptInstallCommand([]string{"locales"}), *g.Locale), aptMounts...)
+		w.writef("ENV LANG=%[1]s LC_ALL=%[1]s", *g.Locale)
+	}
+	if len(g.CUDALibraries) > 0 {
+		cmd, err := g.cudaLibrariesCommand()
+		if err != nil {
+			return err
+		}
+		w.run(cmd, aptMounts...)
+	}
+	if g.GitLFSConfig != nil {
+		w.run(gitLFSCommand, aptMounts...)
+		for _, args := range g.gitLFSConfigArgs() {
+			w.run(shellescape.QuoteCommand(args))
+		}
+	}
+	if g.Direnv {
+		w.run(aptInstallCommand([]string{"direnv"}), aptMounts...)
+	}
+	g.dockerfileGitHubCLI(w, aptMounts)
+	if len(g.DatabaseClients) > 0 {
+		w.run(aptInstallCommand(g.databaseClientPackages()), aptMounts...)
+	}
+	g.dockerfileCodeServer(w)
+	return g.dockerfileTmux(w, aptMounts)
+}
+
+func (g Graph) dockerfileSSHKey(w *dockerfileWriter) error {
+	if !g.devTarget() {
+		return nil
+	}
+	if DefaultGraph.PublicKeyPath == "" {
+		w.writef("# ssh public key is not specified, skip installing it")
+		return nil
+	}
+	dat, err := g.authorizedKeys(DefaultGraph.PublicKeyPath)
+	if err != nil {
+		return err
+	}
+	w.file(config.ContainerAuthorizedKeysPath, dat, g.uid, g.gid)
+	return nil
+}
+
+func (g Graph) dockerfileShell(w *dockerfileWriter) {
+	switch g.Shell {
+	case shellBASH:
+		g.dockerfileBash(w)
+		return
+	case shellFish:
+		g.dockerfileFish(w)
+		return
+	}
+	if g.Shell != shellZSH {
+		return
+	}
+	m := g.ZSHManager()
+	ohMyZSHPath := fileutil.EnvdHomeDir(".oh-my-zsh")
+	installPath := fileutil.EnvdHomeDir("install.sh")
+	w.run(fmt.Sprintf("git init %[1]s && git -C %[1]s fetch --depth 1 %[2]s %[3]s && "+
+		"git -C %[1]s checkout FETCH_HEAD && chown -R %[4]d:%[5]d %[1]s",
+		ohMyZSHPath, m.RepoURL(), g.ohMyZSHCommit(m), g.uid, g.gid))
+	w.file(installPath, m.InstallScript(), g.uid, g.gid)
+	w.run(fmt.Sprintf("bash %s", installPath))
+	w.file(fileutil.EnvdHomeDir(".zshrc"), g.zshrc(m), g.uid, g.gid)
+}
+
+// ohMyZSHCommit returns the commit of the cached oh-my-zsh, thus the
+// Dockerfile is the same as the build. The pinned revision is used if it is
+// not cached yet, or it is installed from the tarball.
+func (g Graph) ohMyZSHCommit(m shell.Manager) string {
+	revision := shell.DefaultOHMyZSHRevision
+	if g.OHMyZSHConfig != nil && g.OHMyZSHConfig.Revision != "" {
+		revision = g.OHMyZSHConfig.Revision
+	}
+	if rev, err := m.Revision(); err == nil && rev.Revision == revision && rev.Commit != "" {
+		return rev.Commit
+	}
+	return revision
+}
+
+// dockerfileBash is the Dockerfile version of compileBash.
+func (g Graph) dockerfileBash(w *dockerfileWriter) {
+	if g.BashConfig == nil {
+		return
+	}
+	m := shell.NewBashManager()
+	bashIt := g.BashConfig.bashIt()
+	if bashIt {
+		bashItPath := fileutil.EnvdHomeDir(shell.BashItDir)
+		w.run(fmt.Sprintf("git clone --depth 1 %s %s && chown -R %d:%d %s",
+			shell.BashItRepoURL, bashItPath, g.uid, g.gid, bashItPath))
+	}
+	w.file(fileutil.EnvdHomeDir(".bashrc"), m.BashRC(bashIt, g.BashConfig.Theme), g.uid, g.gid)
+	if len(g.BashConfig.Plugins) == 0 {
+		return
+	}
+	w.writef("USER envd")
+	w.run(fmt.Sprintf("bash -c %s", shellescape.Quote(m.EnableCommand(g.BashConfig.Plugins))))
+	w.writef("USER root")
+}
+
+// dockerfileFish is the Dockerfile version of compileFish.
+func (g Graph) dockerfileFish(w *dockerfileWriter) {
+	m := shell.NewFishManager()
+	w.run(aptInstallCommand([]string{shellFish}), g.aptCacheMounts()...)
+	w.file(fishConfigPath, m.Config(), g.uid, g.gid)
+	if g.FishConfig == nil || len(g.FishConfig.Plugins) == 0 {
+		return
+	}
+	w.writef("USER envd")
+	w.run(fmt.Sprintf("fish -c %s", shellescape.Quote(m.InstallCommand(g.FishConfig.Plugins))))
+	w.writef("USER root")
+}
+
+func (g Graph) dockerfileSystemPackages(w *dockerfileWriter) {
+	if len(g.SystemPackages) == 0 {
+		return
+	}
+	w.run(aptInstallCommand(g.SystemPackages), g.aptCacheMounts()...)
+}
+
+func (g Graph) dockerfileVSCode(w *dockerfileWriter) error {
+	settings, keybindings, err := g.vscodeConfigFiles()
+	if err != nil {
+		return err
+	}
+	if settings != "" {
+		w.file(vscodeSettingsPath, settings, g.uid, g.gid)
+	}
+	if keybindings != "" {
+		w.file(vscodeKeybindingsPath, keybindings, g.uid, g.gid)
+	}
+	if g.VSCodeConfig != nil && g.VSCodeConfig.ServerVersion != "" {
+		log.Warnf("vscode-server %s is not exported to the Dockerfile", g.VSCodeConfig.ServerVersion)
+		w.writef("# vscode-server is not exported: %s", g.VSCodeConfig.ServerVersion)
+	}
+	if len(g.VSCodePlugins) == 0 {
+		return nil
+	}
+	plugins := []string{}
+	for _, p := range g.VSCodePlugins {
+		plugins = append(plugins, p.String())
+	}
+	log.Warnf("vscode extensions %v are not exported to the Dockerfile", plugins)
+	w.writef("# vscode extensions are not exported: %s", strings.Join(plugins, ", "))
+	return nil
+}
+
+func (g *Graph) dockerfilePython(w *dockerfileWriter) error {
+	if g.CondaConfig.CondaChannel != nil {
+		w.file(condarc, *g.CondaChannel, g.uid, g.gid)
+	}
+	g.dockerfilePyPIIndex(w)
+	if err := g.compileJupyter(); err != nil {
+		return errors.Wrap(err, "failed to compile jupyter")
+	}
+	if err := g.compilePreCommit(); err != nil {
+		return errors.Wrap(err, "failed to compile pre-commit")
+	}
+	if err := g.dockerfileSSHKey(w); err != nil {
+		return err
+	}
+	g.dockerfileShell(w)
+
+	// conda environment
+	pythonVersion, err := g.getAppropriatePythonVersion()
+	if err != nil {
+		return errors.Wrap(err, "failed to get python version")
+	}
+	w.run(g.condaInitShell("bash"))
+	w.writef("WORKDIR %s", g.getWorkingDir())
+	w.run(fmt.Sprintf("%s create -n envd python=%s", g.condaCommandPath(), pythonVersion))
+	rc := fileutil.EnvdHomeDir(".bashrc")
+	switch g.Shell {
+	case shellZSH:
+		w.run(g.condaInitShell(g.Shell))
+		rc = fileutil.EnvdHomeDir(".zshrc")
+	case shellFish:
+		w.run(fmt.Sprintf(`echo "%s" >> %s`, g.condaFishHook(), fishConfigPath))
+	}
+	w.run(fmt.Sprintf(`echo "source %s/activate envd" >> %s`, condaBinDir, rc))
+
+	// conda packages
+	if len(g.CondaConfig.CondaPackages) != 0 || len(g.CondaEnvFileName) != 0 {
+		var cmd string
+		if len(g.CondaEnvFileName) > 0 {
+			cmd = g.condaUpdateFromFile()
+		} else {
+			cmd = fmt.Sprintf("%s install -n envd", g.condaCommandPath())
+			for _, channel := range g.CondaConfig.AdditionalChannels {
+				cmd += fmt.Sprintf(" -c %s", channel)
+			}
+			cmd += " " + strings.Join(g.CondaConfig.CondaPackages, " ")
+		}
+		w.run(cmd, g.buildContextMount(),
+			g.cacheMount(filepath.Join(condaRootPrefix, "pkgs")))
+	}
+
+	if err := g.dockerfilePyPIPackages(w); err != nil {
+		return err
+	}
+	g.dockerfileSystemPackages(w)
+	if err := g.dockerfileVSCode(w); err != nil {
+		return err
+	}
+
+	envdPrefix := "/opt/conda/envs/envd/bin"
+	for _, bin := range []string{"python", "python3", "pip", "pip3"} {
+		w.run(fmt.Sprintf("update-alternatives --install /usr/bin/%[1]s %[1]s %[2]s/%[1]s 1",
+			bin, envdPrefix))
+	}
+	return nil
+}
+
+func (g Graph) dockerfilePyPIIndex(w *dockerfileWriter) {
+	if g.PyPIIndexURL == nil {
+		return
+	}
+	var extraIndex string
+	if g.PyPIExtraIndexURL != nil {
+		extraIndex = "extra-index-url=" + *g.PyPIExtraIndexURL
+	}
+	w.file(pypiIndexFilePath,
+		fmt.Sprintf(pypiConfigTemplate, *g.PyPIIndexURL, extraIndex), g.uid, g.gid)
+}
+
+// dockerfilePyPIPackages installs the PyPI packages with the same constraints
+// as compilePyPIPackages, i.e. the pins or the requirements of the lockfile.
+func (g *Graph) dockerfilePyPIPackages(w *dockerfileWriter) error {
+	if len(g.PyPIPackages) == 0 && g.RequirementsFile == nil &&
+		g.PipfileFile == nil && len(g.PythonWheels) == 0 {
+		return nil
+	}
+	if g.PipLockConfig != nil && !g.pipLocked() {
+		return errors.Newf("config.pip_lock requires the PyPI packages in %s, "+
+			"run envd lock first", LockFileName)
+	}
+
+	cacheDir := filepath.Join("/", "root", ".cache", "pip")
+	g.UserDirectories = append(g.UserDirectories, cacheDir)
+	w.run(fmt.Sprintf("mkdir -p %s", cacheDir))
+	pip := "/opt/conda/envs/envd/bin/python -m pip install"
+
+	if g.pipLocked() {
+		w.file(filepath.Join(pipConstraintsDir, "requirements.txt"),
+			g.pipLockRequirements(), 0, 0)
+		w.run(shellescape.QuoteCommand(g.pipLockArgs()), g.cacheMount(cacheDir))
+	} else if len(g.PyPIPackages) != 0 {
+		constraints := g.pipConstraintsFile()
+		if constraints != "" {
+			w.file(filepath.Join(pipConstraintsDir, "constraints.txt"), constraints, 0, 0)
+		}
+		w.run(shellescape.QuoteCommand(pipInstallArgs(g.PyPIPackages, constraints != "")),
+			g.cacheMount(cacheDir))
+	}
+	if g.RequirementsFile != nil {
+		w.run(fmt.Sprintf("%s -r %s", pip, *g.RequirementsFile),
+			g.buildContextMount(), g.cacheMount(cacheDir))
+	}
+	if g.PipfileFile != nil {
+		var sb strings.Builder
+		sb.WriteString("set -euo pipefail\n")
+		sb.WriteString("export PATH=/opt/conda/envs/envd/bin:$PATH\n")
+		sb.WriteString(fmt.Sprintf("export PIPENV_PIPFILE=%s\n", *g.PipfileFile))
+		sb.WriteString("python -m pip install pipenv\n")
+		sb.WriteString(fmt.Sprintf(
+			"if [ -f %s.lock ]; then python -m pipenv install --system --deploy; "+
+				"else python -m pipenv install --system --skip-lock; fi\n", *g.PipfileFile))
+		w.run(sb.String(), g.buildContextMount(), g.cacheMount(cacheDir))
+	}
+	for _, wheel := range g.PythonWheels {
+		w.run(fmt.Sprintf("%s %s", pip, wheel),
+			g.buildContextMount(), g.cacheMount(cacheDir))
+	}
+	return nil
+}
+
+func (g *Graph) dockerfileLanguage(w *dockerfileWriter) error {
+	if err := g.compileJupyter(); err != nil {
+		return errors.Wrap(err, "failed to compile jupyter")
+	}
+	if err := g.compilePreCommit(); err != nil {
+		return errors.Wrap(err, "failed to compile pre-commit")
+	}
+	if err := g.dockerfileSSHKey(w); err != nil {
+		return err
+	}
+	g.dockerfileShell(w)
+	g.dockerfileSystemPackages(w)
+
+	switch g.Language.Name {
+	case "r":
+		if len(g.RPackages) != 0 {
+			mirrorURL := "https://cran.rstudio.com"
+			if g.CRANMirrorURL != nil {
+				mirrorURL = *g.CRANMirrorURL
+			}
+			w.writef("USER envd")
+			w.run(fmt.Sprintf(`R -e 'options(repos = c(CRAN = "%s")); install.packages(c(%s))'`,
+				mirrorURL, quoteJoin(g.RPackages)))
+			w.writef("USER root")
+		}
+	case "julia":
+		if len(g.JuliaPackages) != 0 {
+			w.writef("USER envd")
+			if g.JuliaPackageServer != nil {
+				w.writef("ENV JULIA_PKG_SERVER=%s", *g.JuliaPackageServer)
+			}
+			w.run(fmt.Sprintf(`/usr/local/julia/bin/julia -e 'using Pkg; Pkg.add([%s])'`,
+				quoteJoin(g.JuliaPackages)))
+			w.writef("USER root")
+		}
+	}
+	return g.dockerfileVSCode(w)
+}
+
+func (g Graph) dockerfileCustomPython(w *dockerfileWriter) {
+	g.dockerfilePyPIIndex(w)
+	if len(g.SystemPackages) != 0 {
+		w.run(aptInstallCommand(g.SystemPackages), g.aptCacheMounts()...)
+	}
+	if len(g.PyPIPackages) != 0 {
+		w.run(fmt.Sprintf("pip install %s", shellescape.QuoteCommand(g.PyPIPackages)),
+			g.cacheMount("/home/root/.cache"))
+	}
+}
+
+func (g Graph) dockerfileFinal(w *dockerfileWriter) error {
+	// prompt
+	if g.Image == nil && g.devTarget() {
+		w.file(starshipConfigPath, starshipConfig, g.uid, g.gid)
+		if g.BashConfig == nil || g.BashConfig.Theme == "" {
+			w.run(fmt.Sprintf(`echo 'eval "$(starship init bash)"' >> %s`,
+				fileutil.EnvdHomeDir(".bashrc")))
+		}
+		switch g.Shell {
+		case shellZSH:
+			w.run(fmt.Sprintf(`echo 'eval "$(starship init zsh)"' >> %s`,
+				fileutil.EnvdHomeDir(".zshrc")))
+		case shellFish:
+			w.run(fmt.Sprintf(`echo 'starship init fish | source' >> %s`, fishConfigPath))
+		}
+	}
+	g.dockerfileShellState(w)
+	if g.PreCommitConfig != nil {
+		w.run(fmt.Sprintf("mkdir -p %[1]s && chown -R %[2]d:%[3]d %[1]s",
+			PreCommitHome, g.uid, g.gid))
+	}
+	g.dockerfileTmuxAgent(w)
+	g.dockerfileShellRC(w)
+	g.dockerfileDirenvHook(w)
+	g.dockerfileGitHubCLICompletion(w)
+	if len(g.RuntimeCron) > 0 {
+		if g.Image != nil {
+			return errors.New("runtime.cron is not supported in the custom base image")
+		}
+		w.run(aptInstallCommand([]string{"cron"}), g.aptCacheMounts()...)
+		w.file(cronTabPath, g.crontab(), 0, 0)
+	}
+
+	for _, c := range g.Copy {
+		w.writef("COPY --chown=%d:%d %s %s", g.uid, g.gid, c.Source, c.Destination)
+	}
+
+	if stages := g.runStages(); len(stages) > 0 {
+		w.writef("ENV PATH=%s", types.DefaultPathEnvUnix)
+		for _, stage := range stages {
+			switch {
+			case stage.Shell != "":
+				w.writef("WORKDIR %s", g.getWorkingDir())
+				w.run(fmt.Sprintf("%s -c %s", stage.Shell,
+					shellescape.Quote(strings.Join(stage.Commands, "\n"))), g.buildContextMount())
+			case len(stage.Commands) == 1:
+				w.run(stage.Commands[0])
+			default:
+				w.writef("WORKDIR %s", g.getWorkingDir())
+				w.run("set -euo pipefail\n"+strings.Join(stage.Commands, "\n"), g.buildContextMount())
+			}
+		}
+	}
+
+	if g.GitConfig != nil {
+		w.file(fileutil.EnvdHomeDir(".gitconfig"), fmt.Sprintf(templateGitConfig,
+			g.GitConfig.Email, g.GitConfig.Name, g.GitConfig.Editor), g.uid, g.gid)
+	}
+
+	if g.usesEntrypointScript() {
+		w.file(config.ContainerEntrypointPath, g.EntrypointScript(), 0, 0)
+	}
+
+	if g.Image != nil || g.uid == 0 {
+		return nil
+	}
+	for _, dir := range g.UserDirectories {
+		w.run(fmt.Sprintf("chown -R envd:envd %s", dir))
+	}
+	w.writef("USER envd")
+	return nil
+}
+
+func (g Graph) dockerfileImageConfig(w *dockerfileWriter, buildContextDir string) error {
+	env := append(g.EnvString(), "PATH="+types.DefaultPathEnvUnix)
+	sort.Strings(env)
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		w.writef("ENV %s=%s", k, dockerfileQuote(v))
+	}
+
+	ports, err := g.ExposedPorts()
+	if err != nil {
+		return errors.Wrap(err, "failed to get expose ports")
+	}
+	portList := make([]string, 0, len(ports))
+	for p := range ports {
+		portList = append(portList, p)
+	}
+	sort.Strings(portList)
+	for _, p := range portList {
+		w.writef("EXPOSE %s", p)
+	}
+
+	labels, err := g.Labels()
+	if err != nil {
+		return errors.Wrap(err, "failed to get labels")
+	}
+	labels[types.ImageLabelContext] = buildContextDir
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		w.writef("LABEL %s=%s", k, dockerfileQuote(labels[k]))
+	}
+
+	ep, err := g.GetEntrypoint()
+	if err != nil {
+		return errors.Wrap(err, "failed to get entrypoint")
+	}
+	if len(ep) > 0 {
+		data, err := json.Marshal(ep)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal the entrypoint")
+		}
+		w.writef("ENTRYPOINT %s", data)
+	}
+	return nil
+}
+
+// dockerfileQuote quotes the value of ENV and LABEL, and escapes the
+// variable expansion of the dockerfile frontend.
+func dockerfileQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// quoteJoin joins the items with double quotes, e.g. "a", "b".
+func quoteJoin(items []string) string {
+	quoted := make([]string, 0, len(items))
+	for _, item := range items {
+		quoted = append(quoted, fmt.Sprintf(`"%s"`, item))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,308 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	"github.com/moby/buildkit/util/system"
+
+	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+const (
+	dockerfileRun     = "run"
+	dockerfileEnv     = "env"
+	dockerfileCopy    = "copy"
+	dockerfileWorkdir = "workdir"
+)
+
+// ImportDockerfile parses the Dockerfile and returns the base image and
+// the supported steps in it.
+func ImportDockerfile(path string) (*DockerfileBase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open the Dockerfile %s", path)
+	}
+	defer f.Close()
+
+	d, err := parseDockerfile(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to import the Dockerfile %s", path)
+	}
+	d.Path = path
+	return d, nil
+}
+
+func parseDockerfile(r io.Reader) (*DockerfileBase, error) {
+	res, err := parser.Parse(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the Dockerfile")
+	}
+
+	d := &DockerfileBase{}
+	lex := shell.NewLex(res.EscapeToken)
+	// The env of the base image is unknown here, thus the references to it,
+	// e.g. $PATH, are kept and expanded when the steps are replayed.
+	lex.SkipUnsetEnv = true
+	// globalArgs are the ARGs before FROM, which are only used in FROM and
+	// the ARGs redeclared after FROM.
+	globalArgs := []string{}
+	// buildArgs are the ARGs after FROM, which are exposed to RUN.
+	buildArgs := []string{}
+	env := []string{}
+	expand := func(words []string) ([]string, error) {
+		return expandWords(lex, words, env)
+	}
+
+	for _, node := range res.AST.Children {
+		instruction := strings.ToLower(node.Value)
+		logger := log.WithFields(log.Fields{
+			"line":        node.StartLine,
+			"instruction": strings.ToUpper(instruction),
+		})
+		if len(node.Heredocs) > 0 {
+			return nil, errors.Newf("line %d: heredoc is not supported", node.StartLine)
+		}
+		args := []string{}
+		for n := node.Next; n != nil; n = n.Next {
+			args = append(args, n.Value)
+		}
+
+		if d.Image == "" && instruction != "from" && instruction != "arg" {
+			return nil, errors.Newf("line %d: %s is used before FROM",
+				node.StartLine, strings.ToUpper(instruction))
+		}
+
+		switch instruction {
+		case "arg":
+			for _, arg := range args {
+				kv, err := dockerfileArg(lex, arg, globalArgs, env)
+				if err != nil {
+					return nil, errors.Wrapf(err, "line %d", node.StartLine)
+				}
+				if kv == "" {
+					continue
+				}
+				if d.Image == "" {
+					globalArgs = append(globalArgs, kv)
+				} else {
+					env = append(env, kv)
+					buildArgs = setKeyValue(buildArgs, kv)
+				}
+			}
+		case "from":
+			if d.Image != "" {
+				return nil, errors.Newf("line %d: multi-stage build is not supported", node.StartLine)
+			}
+			if len(args) == 0 {
+				return nil, errors.Newf("line %d: FROM requires the image", node.StartLine)
+			}
+			image, err := expandWords(lex, args[:1], globalArgs)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", node.StartLine)
+			}
+			d.Image = image[0]
+		case dockerfileRun:
+			if len(args) == 0 {
+				return nil, errors.Newf("line %d: RUN requires the command", node.StartLine)
+			}
+			if !node.Attributes["json"] {
+				args = []string{"/bin/sh", "-c", strings.Join(args, " ")}
+			}
+			step := DockerfileStep{Instruction: instruction, Args: args}
+			if len(buildArgs) > 0 {
+				step.BuildArgs = append([]string{}, buildArgs...)
+			}
+			d.Steps = append(d.Steps, step)
+		case dockerfileEnv:
+			if len(args) == 0 || len(args)%2 != 0 {
+				return nil, errors.Newf("line %d: ENV requires the key value pairs", node.StartLine)
+			}
+			kvs, err := expand(args)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", node.StartLine)
+			}
+			for i := 0; i < len(kvs); i += 2 {
+				env = append(env, fmt.Sprintf("%s=%s", kvs[i], kvs[i+1]))
+				// ENV takes precedence over the ARG with the same name.
+				buildArgs = removeKey(buildArgs, kvs[i])
+			}
+			d.Steps = append(d.Steps, DockerfileStep{Instruction: instruction, Args: kvs})
+		case dockerfileCopy:
+			for _, f := range node.Flags {
+				if strings.HasPrefix(f, "--from") {
+					return nil, errors.Newf("line %d: COPY --from is not supported", node.StartLine)
+				}
+				logger.Warnf("flag %s is ignored", f)
+			}
+			if len(args) < 2 {
+				return nil, errors.Newf("line %d: COPY requires the source and the destination", node.StartLine)
+			}
+			paths, err := expand(args)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", node.StartLine)
+			}
+			d.Steps = append(d.Steps, DockerfileStep{Instruction: instruction, Args: paths})
+		case dockerfileWorkdir:
+			if len(args) != 1 {
+				return nil, errors.Newf("line %d: WORKDIR requires exactly one path", node.StartLine)
+			}
+			dir, err := expand(args)
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", node.StartLine)
+			}
+			d.Steps = append(d.Steps, DockerfileStep{Instruction: instruction, Args: dir})
+		default:
+			// e.g. USER, ENTRYPOINT and CMD are managed by envd.
+			logger.Warnf("%s is ignored in the imported Dockerfile", strings.ToUpper(instruction))
+		}
+	}
+
+	if d.Image == "" {
+		return nil, errors.New("FROM is not found")
+	}
+	return d, nil
+}
+
+func expandWords(lex *shell.Lex, words []string, env []string) ([]string, error) {
+	expanded := make([]string, 0, len(words))
+	for _, w := range words {
+		word, err := lex.ProcessWord(w, env)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, word)
+	}
+	return expanded, nil
+}
+
+// dockerfileArg returns the key value pair of the ARG, or "" if it has no
+// value. The ARG without the default value inherits the global one.
+func dockerfileArg(lex *shell.Lex, arg string, globalArgs, env []string) (string, error) {
+	key, value, ok := strings.Cut(arg, "=")
+	if !ok {
+		for _, kv := range globalArgs {
+			if strings.HasPrefix(kv, key+"=") {
+				return kv, nil
+			}
+		}
+		return "", nil
+	}
+	value, err := lex.ProcessWord(value, append(append([]string{}, globalArgs...), env...))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s=%s", key, value), nil
+}
+
+// setKeyValue sets the key value pair in the list, the existing one with
+// the same key is replaced.
+func setKeyValue(kvs []string, kv string) []string {
+	key, _, _ := strings.Cut(kv, "=")
+	return append(removeKey(kvs, key), kv)
+}
+
+func removeKey(kvs []string, key string) []string {
+	res := []string{}
+	for _, kv := range kvs {
+		if !strings.HasPrefix(kv, key+"=") {
+			res = append(res, kv)
+		}
+	}
+	return res
+}
+
+// expandBaseEnv expands the references to the env of the base image kept in
+// the value, e.g. PATH=/app/bin:$PATH.
+func expandBaseEnv(value string, env map[string]string) string {
+	return os.Expand(value, func(key string) string {
+		return env[key]
+	})
+}
+
+// Env returns the env set by the Dockerfile, which is kept in the image.
+// The references to the base image env are expanded with the envd defaults,
+// which are set in the image config.
+func (d DockerfileBase) Env() map[string]string {
+	base := map[string]string{"PATH": types.DefaultPathEnvUnix}
+	env := make(map[string]string)
+	for _, step := range d.Steps {
+		if step.Instruction != dockerfileEnv {
+			continue
+		}
+		for i := 0; i+1 < len(step.Args); i += 2 {
+			v := expandBaseEnv(step.Args[i+1], base)
+			base[step.Args[i]] = v
+			env[step.Args[i]] = v
+		}
+	}
+	return env
+}
+
+// compileBaseDockerfile replays the imported Dockerfile on its base image.
+func (g Graph) compileBaseDockerfile() (llb.State, error) {
+	d := g.BaseDockerfile
+	root, err := g.prepareImage(d.Image)
+	if err != nil {
+		return llb.State{}, err
+	}
+	// The image config is not resolved, thus the base image is assumed to
+	// use the default PATH like the runtime does.
+	env := map[string]string{"PATH": system.DefaultPathEnvUnix}
+	for _, step := range d.Steps {
+		switch step.Instruction {
+		case dockerfileRun:
+			opts := []llb.RunOption{llb.Args(step.Args),
+				llb.WithCustomNamef("[dockerfile] RUN %s", strings.Join(step.Args, " "))}
+			// The ARGs are set on the RUN only, thus they are not kept in
+			// the following steps and the image.
+			for _, kv := range step.BuildArgs {
+				k, v, _ := strings.Cut(kv, "=")
+				opts = append(opts, llb.AddEnv(k, expandBaseEnv(v, env)))
+			}
+			root = root.Run(opts...).Root()
+		case dockerfileEnv:
+			for i := 0; i+1 < len(step.Args); i += 2 {
+				v := expandBaseEnv(step.Args[i+1], env)
+				env[step.Args[i]] = v
+				root = root.AddEnv(step.Args[i], v)
+			}
+		case dockerfileCopy:
+			dst := step.Args[len(step.Args)-1]
+			for _, src := range step.Args[:len(step.Args)-1] {
+				root = root.File(llb.Copy(llb.Local(flag.FlagBuildContext), src, dst,
+					&llb.CopyInfo{
+						CreateDestPath:      true,
+						CopyDirContentsOnly: true,
+						AllowWildcard:       true,
+						FollowSymlinks:      true,
+					}), llb.WithCustomNamef("[dockerfile] COPY %s %s", src, dst))
+			}
+		case dockerfileWorkdir:
+			root = root.Dir(step.Args[0])
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	dockerfile := `ARG VERSION=20.04
+FROM ubuntu:$VERSION
+ARG VERSION
+ARG USER=envd
+ENV APP_HOME=/app/$USER PATH=/app/bin:$PATH
+RUN apt-get update && apt-get install -y curl
+RUN ["echo", "hello"]
+WORKDIR $APP_HOME
+COPY requirements.txt $APP_HOME/
+CMD ["python"]
+`
+	d, err := parseDockerfile(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("failed to parse the dockerfile: %v", err)
+	}
+	if d.Image != "ubuntu:20.04" {
+		t.Errorf("expected image ubuntu:20.04, got %s", d.Image)
+	}
+	expected := []DockerfileStep{
+		{Instruction: dockerfileEnv, Args: []string{"APP_HOME", "/app/envd", "PATH", "/app/bin:$PATH"}},
+		{Instruction: dockerfileRun, Args: []string{"/bin/sh", "-c", "apt-get update && apt-get install -y curl"},
+			BuildArgs: []string{"VERSION=20.04", "USER=envd"}},
+		{Instruction: dockerfileRun, Args: []string{"echo", "hello"},
+			BuildArgs: []string{"VERSION=20.04", "USER=envd"}},
+		{Instruction: dockerfileWorkdir, Args: []string{"/app/envd"}},
+		{Instruction: dockerfileCopy, Args: []string{"requirements.txt", "/app/envd/"}},
+	}
+	if !reflect.DeepEqual(d.Steps, expected) {
+		t.Errorf("expected steps %v, got %v", expected, d.Steps)
+	}
+
+	// The reference to the base image PATH is expanded with the default.
+	env := d.Env()
+	if env["PATH"] != "/app/bin:"+types.DefaultPathEnvUnix {
+		t.Errorf("expected PATH prepended to the default, got %s", env["PATH"])
+	}
+	if env["APP_HOME"] != "/app/envd" {
+		t.Errorf("expected APP_HOME /app/envd, got %s", env["APP_HOME"])
+	}
+}
+
+func TestCompileBaseDockerfileArgs(t *testing.T) {
+	dockerfile := `FROM ubuntu:20.04
+ARG V=1.2
+ARG HOME_DIR=/root
+ENV HOME_DIR=/home/envd
+RUN pip install foo==$V
+ENV V=2.0
+RUN echo $V
+`
+	d, err := parseDockerfile(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("failed to parse the dockerfile: %v", err)
+	}
+	g := Graph{BaseDockerfile: d}
+	root, err := g.compileBaseDockerfile()
+	if err != nil {
+		t.Fatalf("failed to compile the Dockerfile: %v", err)
+	}
+	def, err := root.Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	runs := make(map[string][]string)
+	for _, dt := range def.Def {
+		var op pb.Op
+		if err := op.Unmarshal(dt); err != nil {
+			t.Fatalf("failed to unmarshal the op: %v", err)
+		}
+		if e := op.GetExec(); e != nil {
+			runs[e.Meta.Args[len(e.Meta.Args)-1]] = e.Meta.Env
+		}
+	}
+	contains := func(env []string, kv string) bool {
+		for _, e := range env {
+			if e == kv {
+				return true
+			}
+		}
+		return false
+	}
+	// The ARG is exposed to RUN, and ENV takes precedence over it.
+	install := runs["pip install foo==$V"]
+	if !contains(install, "V=1.2") || !contains(install, "HOME_DIR=/home/envd") {
+		t.Errorf("expected V=1.2 and HOME_DIR=/home/envd in the env, got %v", install)
+	}
+	if echo := runs["echo $V"]; !contains(echo, "V=2.0") || contains(echo, "V=1.2") {
+		t.Errorf("expected V=2.0 in the env, got %v", echo)
+	}
+
+	// The ARG is not kept in the image.
+	env, err := root.Env(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get the env: %v", err)
+	}
+	if contains(env, "V=1.2") {
+		t.Errorf("expected the ARG not in the image env, got %v", env)
+	}
+}
+
+func TestParseDockerfileUnsupported(t *testing.T) {
+	testcases := []string{
+		"RUN echo hello\n",
+		"FROM ubuntu:20.04\nFROM ubuntu:22.04\n",
+		"FROM ubuntu:20.04\nCOPY --from=builder /app /app\n",
+		"ARG VERSION=20.04\n",
+	}
+	for _, tc := range testcases {
+		if _, err := parseDockerfile(strings.NewReader(tc)); err == nil {
+			t.Errorf("expected error for the dockerfile:\n%s", tc)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDockerfile(t *testing.T) {
+	g := NewGraph()
+	g.EnvironmentName = "test"
+	g.PyPIPackages = []string{"numpy"}
+	g.SystemPackages = []string{"htop"}
+	g.Exec = []RunInfo{{Commands: []string{"echo hello"}}}
+
+	dockerfile, err := g.Dockerfile(1000, 1000, "/tmp/test")
+	if err != nil {
+		t.Fatalf("failed to generate the dockerfile: %v", err)
+	}
+	for _, expected := range []string{
+		"# syntax=docker/dockerfile:1.4\n",
+		"FROM ubuntu:20.04\n",
+		"useradd -p \"\" -u 1000 -g envd -s /bin/sh -m envd",
+		"/opt/conda/envs/envd/bin/python -m pip install numpy\n",
+		"apt-get install -y --no-install-recommends htop\n",
+		"RUN echo hello\n",
+		"USER envd\n",
+		"EXPOSE 2222/tcp\n",
+		"COPY --chown=0:0 <<'ENVD_EOF' /var/envd/bin/entrypoint.sh\n#!/usr/bin/env bash\n",
+		"ENTRYPOINT [\"tini\",\"--\",\"bash\",\"/var/envd/bin/entrypoint.sh\"]\n",
+	} {
+		if !strings.Contains(dockerfile, expected) {
+			t.Errorf("expected %q in the dockerfile:\n%s", expected, dockerfile)
+		}
+	}
+}
+
+func TestDockerfilePipLock(t *testing.T) {
+	g := NewGraph()
+	g.EnvironmentName = "test"
+	g.PyPIPackages = []string{"numpy"}
+	g.PipLockConfig = &PipLockConfig{RequireHashes: true, NoDeps: true}
+	if _, err := g.Dockerfile(1000, 1000, "/tmp/test"); err == nil {
+		t.Errorf("expected error without the lockfile")
+	}
+
+	g = NewGraph()
+	g.EnvironmentName = "test"
+	g.PyPIPackages = []string{"numpy"}
+	g.PipLockConfig = &PipLockConfig{RequireHashes: true, NoDeps: true}
+	g.Lock = &Lock{
+		PyPI:       map[string]string{"numpy": "1.23.4"},
+		PyPIHashes: map[string][]string{"numpy": {"abc"}},
+	}
+	dockerfile, err := g.Dockerfile(1000, 1000, "/tmp/test")
+	if err != nil {
+		t.Fatalf("failed to generate the dockerfile: %v", err)
+	}
+	for _, expected := range []string{
+		"/var/envd/lock/requirements.txt\nnumpy==1.23.4 \\\n    --hash=sha256:abc\n",
+		"/opt/conda/envs/envd/bin/python -m pip install --no-deps --require-hashes " +
+			"-r /var/envd/lock/requirements.txt\n",
+	} {
+		if !strings.Contains(dockerfile, expected) {
+			t.Errorf("expected %q in the dockerfile:\n%s", expected, dockerfile)
+		}
+	}
+}
+
+func TestDockerfileQuote(t *testing.T) {
+	testcases := []struct {
+		value    string
+		expected string
+	}{
+		{"/usr/bin", `"/usr/bin"`},
+		{`{"a":"$b"}`, `"{\"a\":\"\$b\"}"`},
+		{`C:\envd`, `"C:\\envd"`},
+	}
+	for _, tc := range testcases {
+		if actual := dockerfileQuote(tc.value); actual != tc.expected {
+			t.Errorf("dockerfileQuote(%s) = %s, expected %s", tc.value, actual, tc.expected)
+		}
+	}
+}
@@ -15,53 +15,321 @@
 package ir
 
 import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/cockroachdb/errors"
 	"github.com/moby/buildkit/client/llb"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/tensorchord/envd/pkg/config"
 	"github.com/tensorchord/envd/pkg/editor/vscode"
 	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/progress/compileui"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
-func (g Graph) compileVSCode() (*llb.State, error) {
-	if len(g.VSCodePlugins) == 0 {
+// VSCodeMarketplace downloads the vscode plugins from the marketplace of
+// the vendor, or its mirror if the url is given.
+func VSCodeMarketplace(vendor, url string) error {
+	switch vscode.MarketplaceVendor(vendor) {
+	case vscode.MarketplaceVendorOpenVSX, vscode.MarketplaceVendorVSCode:
+	default:
+		return errors.Newf("invalid marketplace vendor %s, expected %s or %s", vendor,
+			vscode.MarketplaceVendorOpenVSX, vscode.MarketplaceVendorVSCode)
+	}
+	if url != "" && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return errors.Newf("invalid marketplace url %s, expected http or https", url)
+	}
+	DefaultGraph.VSCodeMarketplace = &VSCodeMarketplaceConfig{Vendor: vendor, URL: url}
+	return nil
+}
+
+// VSCodeVSIXDir installs the plugins from the local vsix files in the
+// directory before the marketplace, see envd build --vsix-dir.
+func VSCodeVSIXDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the vsix directory %s", dir)
+	}
+	if !info.IsDir() {
+		return errors.Newf("the vsix directory %s is not a directory", dir)
+	}
+	DefaultGraph.VSCodeVSIXDir = dir
+	return nil
+}
+
+// VSCodeClient returns the client of the marketplace configured by
+// config.vscode_marketplace, Open VSX by default.
+func (g Graph) VSCodeClient() (vscode.Client, error) {
+	if g.VSCodeMarketplace == nil {
+		return vscode.NewClient(vscode.MarketplaceVendorOpenVSX, "", g.VSCodeVSIXDir, g.HTTPClient())
+	}
+	return vscode.NewClient(vscode.MarketplaceVendor(g.VSCodeMarketplace.Vendor),
+		g.VSCodeMarketplace.URL, g.VSCodeVSIXDir, g.HTTPClient())
+}
+
+var (
+	// vscodeSettingsPath is the machine settings of the vscode server.
+	vscodeSettingsPath = fileutil.EnvdHomeDir(".vscode-server", "data", "Machine", "settings.json")
+	// vscodeKeybindingsPath is the user keybindings of the vscode server,
+	// which are read by the web-based vscode only, since the desktop vscode
+	// uses the local keybindings in the remote environments.
+	vscodeKeybindingsPath = fileutil.EnvdHomeDir(".vscode-server", "data", "User", "keybindings.json")
+)
+
+// VSCode ships the vscode settings and keybindings with the environment.
+// The settings override the ones set before, and the keybindings are
+// appended. The vscode-server of the version is installed if it is not empty.
+func VSCode(settings map[string]interface{}, keybindings []map[string]interface{},
+	serverVersion string) error {
+	for _, kb := range keybindings {
+		if key, ok := kb["key"].(string); !ok || key == "" {
+			return errors.Newf("invalid vscode keybinding %v, the key is required", kb)
+		}
+	}
+	if DefaultGraph.VSCodeConfig == nil {
+		DefaultGraph.VSCodeConfig = &VSCodeConfig{}
+	}
+	c := DefaultGraph.VSCodeConfig
+	if len(settings) > 0 && c.Settings == nil {
+		c.Settings = map[string]interface{}{}
+	}
+	for k, v := range settings {
+		c.Settings[k] = v
+	}
+	c.Keybindings = append(c.Keybindings, keybindings...)
+	if serverVersion != "" {
+		c.ServerVersion = serverVersion
+	}
+	return nil
+}
+
+// vscodeConfigFiles returns the content of the settings.json and the
+// keybindings.json, which is empty if it is not set.
+func (g Graph) vscodeConfigFiles() (string, string, error) {
+	var settings, keybindings string
+	if g.VSCodeConfig == nil {
+		return settings, keybindings, nil
+	}
+	if len(g.VSCodeConfig.Settings) > 0 {
+		b, err := json.MarshalIndent(g.VSCodeConfig.Settings, "", "  ")
+		if err != nil {
+			return "", "", errors.Wrap(err, "failed to marshal the vscode settings")
+		}
+		settings = string(b) + "\n"
+	}
+	if len(g.VSCodeConfig.Keybindings) > 0 {
+		b, err := json.MarshalIndent(g.VSCodeConfig.Keybindings, "", "  ")
+		if err != nil {
+			return "", "", errors.Wrap(err, "failed to marshal the vscode keybindings")
+		}
+		keybindings = string(b) + "\n"
+	}
+	return settings, keybindings, nil
+}
+
+// compileVSCodeConfig writes the vscode settings and keybindings.
+func (g Graph) compileVSCodeConfig() (*llb.State, error) {
+	settings, keybindings, err := g.vscodeConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+	var fa *llb.FileAction
+	for _, f := range []struct{ path, content string }{
+		{vscodeSettingsPath, settings},
+		{vscodeKeybindingsPath, keybindings},
+	} {
+		if f.content == "" {
+			continue
+		}
+		dir := filepath.Dir(f.path)
+		if fa == nil {
+			fa = llb.Mkdir(dir, 0755, llb.WithParents(true), llb.WithUIDGID(g.uid, g.gid))
+		} else {
+			fa = fa.Mkdir(dir, 0755, llb.WithParents(true), llb.WithUIDGID(g.uid, g.gid))
+		}
+		fa = fa.Mkfile(f.path, 0644, []byte(f.content), llb.WithUIDGID(g.uid, g.gid))
+	}
+	if fa == nil {
 		return nil, nil
 	}
+	layer := llb.Scratch().File(fa, llb.WithCustomName("[internal] setting vscode settings and keybindings"))
+	return &layer, nil
+}
+
+// compileVSCodeServer installs the vscode-server downloaded in the host
+// cache, thus it works in the air-gapped environments.
+func (g Graph) compileVSCodeServer(ctx context.Context) (llb.State, error) {
+	server, cached, err := vscode.DownloadServerOrCache(ctx, g.HTTPClient(), g.VSCodeConfig.ServerVersion)
+	if err != nil {
+		return llb.State{}, errors.Wrapf(err, "failed to download vscode-server %s",
+			g.VSCodeConfig.ServerVersion)
+	}
+	log.WithField("cached", cached).Debugf("vscode-server %s is downloaded", server.Commit)
+	archive := llb.Scratch().File(llb.Copy(llb.Local(flag.FlagCacheDir),
+		server.ArchivePath(), "/", &llb.CopyInfo{
+			AttemptUnpack: true,
+		}), llb.WithCustomName("[internal] unpacking vscode-server"))
+	return llb.Scratch().File(llb.Copy(archive, vscode.ServerArchiveRoot,
+		fileutil.EnvdHomeDir(server.InstallPath()),
+		&llb.CopyInfo{
+			CopyDirContentsOnly: true,
+			CreateDestPath:      true,
+		}, llb.WithUIDGID(g.uid, g.gid)),
+		llb.WithCustomNamef("install vscode-server %s", g.VSCodeConfig.ServerVersion)), nil
+}
+
+// vscodeDownloadConcurrency is the number of the vscode plugins downloaded
+// concurrently.
+const vscodeDownloadConcurrency = 4
+
+func (g Graph) compileVSCode(ctx context.Context) (*llb.State, error) {
+	if len(g.VSCodePlugins) == 0 && g.VSCodeConfig == nil {
+		return nil, nil
+	}
+	vscodeClient, err := g.VSCodeClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create vscode client")
+	}
 	inputs := []llb.State{}
-	for _, p := range g.VSCodePlugins {
-		vscodeClient, err := vscode.NewClient(vscode.MarketplaceVendorOpenVSX)
+	configStage, err := g.compileVSCodeConfig()
+	if err != nil {
+		return nil, err
+	}
+	if configStage != nil {
+		inputs = append(inputs, *configStage)
+	}
+	if g.VSCodeConfig != nil && g.VSCodeConfig.ServerVersion != "" {
+		serverStage, err := g.compileVSCodeServer(ctx)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create vscode client")
+			return nil, err
 		}
-		g.Writer.LogVSCodePlugin(p, compileui.ActionStart, false)
-		if cached, err := vscodeClient.DownloadOrCache(p); err != nil {
+		inputs = append(inputs, serverStage)
+	}
+	// The extensionDependencies and the extensionPack of the plugins are
+	// installed too, the plugins in the build file take precedence over the
+	// dependencies, thus they are never installed twice.
+	installed := map[string]bool{}
+	for _, p := range g.VSCodePlugins {
+		installed[p.Publisher+"."+p.Extension] = true
+	}
+	plugins, required := g.VSCodePlugins, true
+	for len(plugins) > 0 {
+		pinned, err := g.downloadVSCodePlugins(ctx, vscodeClient, plugins, required)
+		if err != nil {
 			return nil, err
-		} else {
-			g.Writer.LogVSCodePlugin(p, compileui.ActionEnd, cached)
 		}
-		ext := llb.Scratch().File(llb.Copy(llb.Local(flag.FlagCacheDir),
-			vscodeClient.PluginPath(p),
-			fileutil.EnvdHomeDir(".vscode-server", "extensions", p.String()),
-			&llb.CopyInfo{
-				CreateDestPath: true,
-			}, llb.WithUIDGID(g.uid, g.gid)),
-			llb.WithCustomNamef("install vscode plugin %s", p.String()))
-		inputs = append(inputs, ext)
-	}
-	layer := llb.Merge(inputs, llb.WithCustomName("merging plugins for vscode"))
+		deps := []vscode.Plugin{}
+		for i, p := range plugins {
+			if pinned[i] == nil {
+				continue
+			}
+			ext := llb.Scratch().File(llb.Copy(llb.Local(flag.FlagCacheDir),
+				vscodeClient.PluginPath(*pinned[i]),
+				fileutil.EnvdHomeDir(".vscode-server", "extensions", pinned[i].String()),
+				&llb.CopyInfo{
+					CreateDestPath: true,
+				}, llb.WithUIDGID(g.uid, g.gid)),
+				llb.WithCustomNamef("install vscode plugin %s", p.String()))
+			inputs = append(inputs, ext)
+
+			pluginDeps, err := vscodeClient.Dependencies(*pinned[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get the dependencies of vscode plugin %s", p)
+			}
+			for _, dep := range pluginDeps {
+				if installed[dep.Publisher+"."+dep.Extension] {
+					continue
+				}
+				log.Debugf("vscode plugin %s is required by %s", dep, p)
+				installed[dep.Publisher+"."+dep.Extension] = true
+				deps = append(deps, dep)
+			}
+		}
+		plugins, required = deps, false
+	}
+	layer := llb.Merge(inputs, llb.WithCustomName("merging plugins and settings for vscode"))
 	return &layer, nil
 }
 
+// downloadVSCodePlugins downloads the plugins concurrently, and returns the
+// pinned plugins in the same order. The plugins which are not required,
+// i.e. the dependencies of the other plugins, are skipped with the warnings
+// if they cannot be downloaded, and the pinned ones are nil.
+func (g Graph) downloadVSCodePlugins(ctx context.Context, client vscode.Client,
+	plugins []vscode.Plugin, required bool) ([]*vscode.Plugin, error) {
+	pinned := make([]*vscode.Plugin, len(plugins))
+	sem := make(chan struct{}, vscodeDownloadConcurrency)
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, p := range plugins {
+		i, p := i, p
+		eg.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sem }()
+
+			g.Writer.LogVSCodePlugin(p, compileui.ActionStart, false)
+			res, cached, err := client.DownloadOrCache(ctx, p)
+			if err != nil {
+				g.Writer.LogVSCodePlugin(p, compileui.ActionFailed, false)
+				if required {
+					return err
+				}
+				log.Warnf("failed to install vscode plugin %s required by the other plugins, "+
+					"please add it to vscode_extensions explicitly: %s", p, err)
+				return nil
+			}
+			g.Writer.LogVSCodePlugin(p, compileui.ActionEnd, cached)
+			pinned[i] = &res
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
+
+// ResolveVSCodePlugins returns the versions of the vscode plugins keyed by
+// the plugin IDs, the ones without the versions are resolved to the latest
+// versions in the marketplace. The digests of the vsix files are returned
+// too if the marketplace provides them.
+func ResolveVSCodePlugins(ctx context.Context) (map[string]string, map[string]string, error) {
+	client, err := DefaultGraph.VSCodeClient()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create vscode client")
+	}
+	versions := map[string]string{}
+	hashes := map[string]string{}
+	for _, p := range DefaultGraph.VSCodePlugins {
+		pinned, err := client.Resolve(ctx, p)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to resolve vscode plugin %s", p)
+		}
+		versions[p.ID()] = *pinned.Version
+		if pinned.SHA256 != "" {
+			hashes[p.ID()] = pinned.SHA256
+		}
+	}
+	return versions, hashes, nil
+}
+
 func (g *Graph) compileJupyter() error {
 	if g.JupyterConfig == nil {
 		return nil
 	}
 
-	g.PyPIPackages = append(g.PyPIPackages, "jupyter")
+	// Copy the slice, thus the graph being compiled is not modified.
+	g.PyPIPackages = append(append([]string{}, g.PyPIPackages...), "jupyter")
 	switch g.Language.Name {
 	case "python":
 		return nil
@@ -75,14 +343,15 @@ func (g Graph) generateJupyterCommand(workingDir string) []string {
 		return nil
 	}
 
-	if g.JupyterConfig.Token == "" {
-		g.JupyterConfig.Token = "''"
+	token := g.JupyterConfig.Token
+	if token == "" {
+		token = "''"
 	}
 
 	cmd := []string{
 		"python3", "-m", "notebook",
 		"--ip", "0.0.0.0", "--notebook-dir", workingDir,
-		"--NotebookApp.token", g.JupyterConfig.Token,
+		"--NotebookApp.token", token,
 		"--port", strconv.Itoa(config.JupyterPortInContainer),
 	}
 
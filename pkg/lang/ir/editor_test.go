@@ -15,6 +15,7 @@
 package ir
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -93,3 +94,58 @@ func equal(a, b []string) bool {
 	}
 	return true
 }
+
+func TestVSCodeMarketplace(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	if err := VSCodeMarketplace("openvsx", "https://open-vsx.example.com"); err != nil {
+		t.Fatalf("failed to set the marketplace: %v", err)
+	}
+	expected := &VSCodeMarketplaceConfig{Vendor: "openvsx", URL: "https://open-vsx.example.com"}
+	if !reflect.DeepEqual(DefaultGraph.VSCodeMarketplace, expected) {
+		t.Errorf("expected %v, got %v", expected, DefaultGraph.VSCodeMarketplace)
+	}
+	if _, err := DefaultGraph.VSCodeClient(); err != nil {
+		t.Errorf("failed to create the client: %v", err)
+	}
+	for _, tc := range [][2]string{{"unknown", ""}, {"vscode", "ftp://mirror"}} {
+		if err := VSCodeMarketplace(tc[0], tc[1]); err == nil {
+			t.Errorf("expected the error of %v", tc)
+		}
+	}
+}
+
+func TestVSCode(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	if err := VSCode(map[string]interface{}{"editor.formatOnSave": false, "editor.tabSize": 2}, nil, ""); err != nil {
+		t.Fatalf("failed to set the vscode settings: %v", err)
+	}
+	if err := VSCode(map[string]interface{}{"editor.formatOnSave": true},
+		[]map[string]interface{}{{"key": "ctrl+k", "command": "editor.action.formatDocument"}},
+		"1.85.1"); err != nil {
+		t.Fatalf("failed to set the vscode keybindings: %v", err)
+	}
+	settings, keybindings, err := DefaultGraph.vscodeConfigFiles()
+	if err != nil {
+		t.Fatalf("failed to get the vscode config files: %v", err)
+	}
+	expected := "{\n  \"editor.formatOnSave\": true,\n  \"editor.tabSize\": 2\n}\n"
+	if settings != expected {
+		t.Errorf("expected settings %q, got %q", expected, settings)
+	}
+	expected = "[\n  {\n    \"command\": \"editor.action.formatDocument\",\n    \"key\": \"ctrl+k\"\n  }\n]\n"
+	if keybindings != expected {
+		t.Errorf("expected keybindings %q, got %q", expected, keybindings)
+	}
+
+	if DefaultGraph.VSCodeConfig.ServerVersion != "1.85.1" {
+		t.Errorf("expected the vscode-server 1.85.1, got %s", DefaultGraph.VSCodeConfig.ServerVersion)
+	}
+
+	if err := VSCode(nil, []map[string]interface{}{{"command": "noop"}}, ""); err == nil {
+		t.Errorf("expected the error of the keybinding without the key")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/config"
+)
+
+// EntrypointScriptVersion is bumped when the layout of the entrypoint
+// script changes, it is labeled on the image.
+const EntrypointScriptVersion = 1
+
+// usesEntrypointScript returns true if the environment is started by the
+// generated entrypoint script, instead of the custom entrypoint.
+func (g Graph) usesEntrypointScript() bool {
+	if g.Image != nil || !g.devTarget() {
+		return false
+	}
+	return len(g.Entrypoint) == 0 || !g.ReplaceEntrypoint
+}
+
+// EntrypointScript returns the script run by tini in the dev environment.
+// It is assembled from the graph in the fixed order: the environment
+// variables, the conda activation, the init commands and the supervised
+// processes. All the supervised processes run in the background, and the
+// environment stops if any of them exits.
+func (g Graph) EntrypointScript() string {
+	workingDir := g.getWorkingDir()
+
+	var sb strings.Builder
+	sb.WriteString("#!/usr/bin/env bash\n")
+	sb.WriteString("# Generated by envd from the build file, DO NOT EDIT.\n")
+	fmt.Fprintf(&sb, "# envd-entrypoint-version: %d\n", EntrypointScriptVersion)
+	sb.WriteString("set -euo pipefail\n")
+
+	if env := g.EnvString(); len(env) > 0 {
+		sort.Strings(env)
+		sb.WriteString("\n# environment\n")
+		for _, kv := range env {
+			k, v, _ := strings.Cut(kv, "=")
+			fmt.Fprintf(&sb, "export %s=%s\n", k, shellescape.Quote(v))
+		}
+	}
+
+	if g.Language.Name == "python" {
+		// The activate scripts of conda refer to the unset variables.
+		sb.WriteString("\n# conda\n")
+		fmt.Fprintf(&sb, "if [ -f %[1]s/activate ]; then\n"+
+			"\tset +u\n\tsource %[1]s/activate envd\n\tset -u\nfi\n", condaBinDir)
+	}
+
+	if init := g.initCommands(workingDir); len(init) > 0 {
+		sb.WriteString("\n# init\n")
+		sb.WriteString(strings.Join(init, "\n") + "\n")
+	}
+
+	sb.WriteString("\n# supervisor\n")
+	fmt.Fprintf(&sb, "/var/envd/bin/envd-sshd --port %d --shell %s &\n",
+		config.SSHPortInContainer, g.Shell)
+	for _, command := range g.RuntimeDaemon {
+		fmt.Fprintf(&sb, "%s &\n", strings.Join(command, " "))
+	}
+	if g.CodeServerConfig != nil {
+		fmt.Fprintf(&sb, "%s &\n", strings.Join(g.generateCodeServerCommand(workingDir), " "))
+	}
+	if g.JupyterConfig != nil {
+		fmt.Fprintf(&sb, "%s &\n", strings.Join(g.generateJupyterCommand(workingDir), " "))
+	}
+	if g.RStudioServerConfig != nil {
+		fmt.Fprintf(&sb, "%s &\n", strings.Join(g.generateRStudioCommand(workingDir), " "))
+	}
+	if len(g.Entrypoint) > 0 {
+		fmt.Fprintf(&sb, "%s &\n", shellescape.QuoteCommand(g.Entrypoint))
+	}
+	sb.WriteString("wait -n\n")
+	return sb.String()
+}
+
+// initCommands are run once the environment is started, before the
+// supervised processes.
+func (g Graph) initCommands(workingDir string) []string {
+	init := []string{}
+	if len(g.RuntimeCron) > 0 {
+		init = append(init, cronStartCommand)
+	}
+	if g.PreCommitConfig != nil && g.PreCommitConfig.InstallHooks {
+		init = append(init, g.preCommitInstallCommand(workingDir))
+	}
+	return init
+}
+
+// compileEntrypoint stores the entrypoint script in the image, thus it can
+// be inspected by envd env describe --entrypoint.
+func (g Graph) compileEntrypoint(root llb.State) llb.State {
+	if !g.usesEntrypointScript() {
+		return root
+	}
+	return root.File(llb.Mkfile(config.ContainerEntrypointPath, 0755,
+		[]byte(g.EntrypointScript())),
+		llb.WithCustomName("[internal] generate the entrypoint script"))
+}
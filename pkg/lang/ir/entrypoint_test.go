@@ -0,0 +1,86 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+func TestEntrypointScript(t *testing.T) {
+	g := NewGraph()
+	g.EnvironmentName = "test"
+	g.RuntimeEnviron["GREETING"] = "hello world"
+	g.RuntimeDaemon = [][]string{{"python3", "-m", "http.server"}}
+	g.RuntimeCron = []CronJob{{Schedule: "@daily", Command: "date"}}
+	g.Entrypoint = []string{"python", "serve.py", "--name", "a b"}
+
+	script := g.EntrypointScript()
+	expected := []string{
+		"# envd-entrypoint-version: 1\n",
+		"export GREETING='hello world'\n",
+		"source /opt/conda/bin/activate envd\n",
+		"# init\nsudo cron\n",
+		"/var/envd/bin/envd-sshd --port 2222 --shell bash &\n",
+		"python3 -m http.server &\n",
+		"python serve.py --name 'a b' &\nwait -n\n",
+	}
+	last := 0
+	for _, e := range expected {
+		i := strings.Index(script, e)
+		if i < last {
+			t.Fatalf("expected %q after the offset %d in the script:\n%s", e, last, script)
+		}
+		last = i
+	}
+
+	labels, err := g.Labels()
+	if err != nil {
+		t.Fatalf("failed to get the labels: %v", err)
+	}
+	if labels[types.ImageLabelEntrypoint] != "1" {
+		t.Errorf("expected the entrypoint version label, got %v", labels)
+	}
+
+	g.ReplaceEntrypoint = true
+	if g.usesEntrypointScript() {
+		t.Errorf("expected no entrypoint script if it is replaced")
+	}
+	labels, err = g.Labels()
+	if err != nil {
+		t.Fatalf("failed to get the labels: %v", err)
+	}
+	if _, ok := labels[types.ImageLabelEntrypoint]; ok {
+		t.Errorf("expected no entrypoint version label, got %v", labels)
+	}
+}
+
+func TestEntrypointScriptJupyter(t *testing.T) {
+	g := NewGraph()
+	g.EnvironmentName = "test"
+	g.JupyterConfig = &JupyterConfig{Port: 8888}
+	g.Entrypoint = []string{"python", "serve.py"}
+
+	script := g.EntrypointScript()
+	jupyter := strings.Join(g.generateJupyterCommand(g.getWorkingDir()), " ")
+	// Jupyter runs in the foreground otherwise, thus the entrypoint
+	// never starts.
+	expected := jupyter + " &\npython serve.py &\nwait -n\n"
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected %q in the script:\n%s", expected, script)
+	}
+}
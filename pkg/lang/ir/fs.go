@@ -19,7 +19,8 @@ import (
 )
 
 func (g *Graph) CompileCacheDir(root llb.State, cacheDir string) llb.State {
-	g.UserDirectories = append(g.UserDirectories, cacheDir)
+	// Copy the slice, thus the graph being compiled is not modified.
+	g.UserDirectories = append(append([]string{}, g.UserDirectories...), cacheDir)
 	run := root.Run(llb.Shlexf("mkdir -p %s", cacheDir), llb.WithCustomName("[internal] create cache dir"))
 	return run.Root()
 }
@@ -0,0 +1,112 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+const (
+	githubCLIKeyringURL  = "https://cli.github.com/packages/githubcli-archive-keyring.gpg"
+	githubCLIKeyringPath = "/usr/share/keyrings/githubcli-archive-keyring.gpg"
+	githubCLISourcePath  = "/etc/apt/sources.list.d/github-cli.list"
+)
+
+var githubCLISource = fmt.Sprintf(
+	"deb [signed-by=%s] https://cli.github.com/packages stable main\n", githubCLIKeyringPath)
+
+type GitHubCLIConfig struct {
+	// ForwardToken passes the GitHub token of the host to gh in the
+	// environment by envd up, i.e. GH_TOKEN, GITHUB_TOKEN or gh auth token.
+	ForwardToken bool
+}
+
+// GitHubCLI installs gh from the apt repository of GitHub CLI, and sets up
+// its completion in the shells.
+func GitHubCLI(forwardToken bool) {
+	DefaultGraph.GitHubCLIConfig = &GitHubCLIConfig{
+		ForwardToken: forwardToken,
+	}
+}
+
+// githubCLICompletion returns the line which sets up the completion of gh
+// in the shell rc file.
+func githubCLICompletion(rc string) string {
+	shell := "bash"
+	if filepath.Base(rc) == ".zshrc" {
+		shell = "zsh"
+	}
+	return fmt.Sprintf(`eval "$(gh completion -s %s)"`, shell)
+}
+
+// compileGitHubCLI installs gh in the system stage.
+func (g Graph) compileGitHubCLI(root llb.State) llb.State {
+	if g.GitHubCLIConfig == nil {
+		return root
+	}
+	keyring := llb.HTTP(githubCLIKeyringURL,
+		llb.Filename(filepath.Base(githubCLIKeyringPath)), llb.Chmod(0644))
+	source := root.File(llb.Copy(keyring, filepath.Base(githubCLIKeyringPath),
+		githubCLIKeyringPath, &llb.CopyInfo{CreateDestPath: true}).
+		Mkfile(githubCLISourcePath, 0644, []byte(githubCLISource)),
+		llb.WithCustomName("[internal] add the apt repository of GitHub CLI"))
+	return g.runWithAPTCache(source, aptInstallCommand([]string{"gh"}),
+		llb.WithCustomName("[internal] install GitHub CLI"))
+}
+
+// compileGitHubCLICompletion sets up the completion of gh at the end of the
+// shell rc files.
+func (g Graph) compileGitHubCLICompletion(root llb.State) llb.State {
+	if g.GitHubCLIConfig == nil {
+		return root
+	}
+	if g.Image != nil {
+		log.Warn("the completion of GitHub CLI is not set up in the custom image")
+		return root
+	}
+	for _, rc := range g.shellRCFiles() {
+		root = root.Run(llb.Args([]string{"bash", "-c",
+			fmt.Sprintf("echo '%s' >> %s", githubCLICompletion(rc), rc)}),
+			llb.WithCustomNamef("[internal] set up the completion of gh in %s", rc)).Root()
+	}
+	return root
+}
+
+// dockerfileGitHubCLI is the Dockerfile version of compileGitHubCLI.
+func (g Graph) dockerfileGitHubCLI(w *dockerfileWriter, aptMounts []string) {
+	if g.GitHubCLIConfig == nil {
+		return
+	}
+	w.run(fmt.Sprintf("curl -fsSL %s -o %s && chmod 644 %s",
+		githubCLIKeyringURL, githubCLIKeyringPath, githubCLIKeyringPath))
+	w.file(githubCLISourcePath, githubCLISource, 0, 0)
+	w.run(aptInstallCommand([]string{"gh"}), aptMounts...)
+}
+
+// dockerfileGitHubCLICompletion is the Dockerfile version of
+// compileGitHubCLICompletion.
+func (g Graph) dockerfileGitHubCLICompletion(w *dockerfileWriter) {
+	if g.GitHubCLIConfig == nil || g.Image != nil {
+		return
+	}
+	for _, rc := range g.shellRCFiles() {
+		w.run(fmt.Sprintf("echo '%s' >> %s", githubCLICompletion(rc), rc))
+	}
+}
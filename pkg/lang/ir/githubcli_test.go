@@ -0,0 +1,59 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+func TestGitHubCLI(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	DefaultGraph.Shell = shellZSH
+
+	GitHubCLI(true)
+	if !DefaultGraph.GitHubCLIConfig.ForwardToken {
+		t.Errorf("expected the token forwarding")
+	}
+
+	def, err := DefaultGraph.compileGitHubCLICompletion(DefaultGraph.compileGitHubCLI(
+		llb.Image("ubuntu:20.04"))).Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	ops := make(map[string]bool)
+	for _, v := range vertices {
+		ops[v.Op] = true
+	}
+	expected := []string{"source " + githubCLIKeyringURL, "exec bash -c " + aptInstallCommand([]string{"gh"})}
+	for _, rc := range DefaultGraph.shellRCFiles() {
+		expected = append(expected, "exec bash -c echo '"+githubCLICompletion(rc)+"' >> "+rc)
+	}
+	for _, op := range expected {
+		if !ops[op] {
+			t.Errorf("expected the op %q, got %v", op, ops)
+		}
+	}
+	if githubCLICompletion(DefaultGraph.shellRCFiles()[1]) != `eval "$(gh completion -s zsh)"` {
+		t.Errorf("expected the zsh completion in %s", DefaultGraph.shellRCFiles()[1])
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"bufio"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+// gitLFSCommand installs git-lfs and sets up its filters in the system git
+// config, thus it is not overwritten by git_config in the user's one.
+var gitLFSCommand = aptInstallCommand([]string{"git", "git-lfs"}) +
+	" && git lfs install --system --skip-repo"
+
+type GitLFSConfig struct {
+	// Config is the lfs section of the host git config, e.g. lfs.url.
+	HostConfig map[string]string
+}
+
+// GitLFS installs git-lfs in the image, and optionally propagates the lfs
+// section of the global git config on the host.
+func GitLFS(propagateConfig bool) error {
+	DefaultGraph.GitLFSConfig = &GitLFSConfig{}
+	if !propagateConfig {
+		return nil
+	}
+	out, err := exec.Command("git", "config", "--global", "--get-regexp", `^lfs\.`).Output()
+	if err != nil {
+		// git exits with 1 if there is no lfs config.
+		log.Debugf("no git lfs config is found on the host: %s", err)
+		return nil
+	}
+	DefaultGraph.GitLFSConfig.HostConfig = parseGitConfig(string(out))
+	return nil
+}
+
+// parseGitConfig parses the output of git config --get-regexp, in which
+// every line is the key and the value separated by the space.
+func parseGitConfig(output string) map[string]string {
+	config := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		if key != "" {
+			config[key] = value
+		}
+	}
+	return config
+}
+
+// gitLFSConfigArgs returns the git commands which set the propagated
+// config in order.
+func (g Graph) gitLFSConfigArgs() [][]string {
+	keys := make([]string, 0, len(g.GitLFSConfig.HostConfig))
+	for key := range g.GitLFSConfig.HostConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	args := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, []string{"git", "config", "--system", key, g.GitLFSConfig.HostConfig[key]})
+	}
+	return args
+}
+
+func (g Graph) compileGitLFS(root llb.State) llb.State {
+	if g.GitLFSConfig == nil {
+		return root
+	}
+	root = g.runWithAPTCache(root, gitLFSCommand,
+		llb.WithCustomName("[internal] install git-lfs"))
+	// The values are passed as they are, without the shell.
+	for _, args := range g.gitLFSConfigArgs() {
+		root = root.Run(llb.Args(args),
+			llb.WithCustomNamef("[internal] set git config %s", args[3])).Root()
+	}
+	return root
+}
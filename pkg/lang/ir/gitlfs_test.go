@@ -0,0 +1,37 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGitLFSConfig(t *testing.T) {
+	g := NewGraph()
+	g.GitLFSConfig = &GitLFSConfig{
+		HostConfig: parseGitConfig("lfs.url https://lfs.example.com/repo\n" +
+			"lfs.https://lfs.example.com/.access basic\n" +
+			"lfs.fetchexclude models/*, logs/*\n"),
+	}
+	expected := [][]string{
+		{"git", "config", "--system", "lfs.fetchexclude", "models/*, logs/*"},
+		{"git", "config", "--system", "lfs.https://lfs.example.com/.access", "basic"},
+		{"git", "config", "--system", "lfs.url", "https://lfs.example.com/repo"},
+	}
+	if actual := g.gitLFSConfigArgs(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
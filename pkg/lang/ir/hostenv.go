@@ -0,0 +1,54 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// hostEnvDenied are the substrings of the credential-like env names, whose
+// values would be baked into the image if they are read by the build file.
+// They should be passed by runtime.env_passthrough instead.
+var hostEnvDenied = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "KEY"}
+
+// HostEnv returns the value of the host env read by the build file, e.g.
+// the proxy or the mirror, and the name is recorded for envd inspect.
+func HostEnv(name string) (string, bool, error) {
+	if !envNamePattern.MatchString(name) {
+		return "", false, errors.Newf("invalid env name %q", name)
+	}
+	upper := strings.ToUpper(name)
+	for _, denied := range hostEnvDenied {
+		if strings.Contains(upper, denied) {
+			return "", false, errors.Newf("the credential-like env %s cannot be read "+
+				"by the build file, use runtime.env_passthrough instead", name)
+		}
+	}
+	found := false
+	for _, n := range DefaultGraph.HostEnv {
+		if n == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		DefaultGraph.HostEnv = append(DefaultGraph.HostEnv, name)
+	}
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
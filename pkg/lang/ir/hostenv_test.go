@@ -0,0 +1,48 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestHostEnv(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	t.Setenv("ENVD_TEST_MIRROR", "https://mirror.example.com")
+	os.Unsetenv("ENVD_TEST_UNSET")
+
+	value, ok, err := HostEnv("ENVD_TEST_MIRROR")
+	if err != nil || !ok || value != "https://mirror.example.com" {
+		t.Errorf("expected the mirror, got %q, %v, %v", value, ok, err)
+	}
+	if _, ok, err := HostEnv("ENVD_TEST_UNSET"); err != nil || ok {
+		t.Errorf("expected the unset env, got %v, %v", ok, err)
+	}
+	if _, _, err := HostEnv("ENVD_TEST_MIRROR"); err != nil {
+		t.Errorf("failed to read the env twice: %v", err)
+	}
+	for _, name := range []string{"GITHUB_TOKEN", "aws_secret_access_key", "A-B", ""} {
+		if _, _, err := HostEnv(name); err == nil {
+			t.Errorf("expected the error of %q", name)
+		}
+	}
+	expected := []string{"ENVD_TEST_MIRROR", "ENVD_TEST_UNSET"}
+	if !reflect.DeepEqual(DefaultGraph.HostEnv, expected) {
+		t.Errorf("expected %v recorded, got %v", expected, DefaultGraph.HostEnv)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+// hostGPUProbe lists the GPUs of the host which runs envd. nvidia-smi is
+// missing on the CPU hosts, thus it is overridden in the tests.
+var hostGPUProbe = func() ([]byte, error) {
+	return exec.Command("nvidia-smi", "-L").Output()
+}
+
+// HostGPUs returns the number of the GPUs of the host, 0 if nvidia-smi is
+// missing or fails. The host is probed once per build and the result is
+// recorded for envd inspect.
+func HostGPUs() int {
+	if DefaultGraph.HostGPUs != nil {
+		return *DefaultGraph.HostGPUs
+	}
+	gpus := 0
+	out, err := hostGPUProbe()
+	if err != nil {
+		log.Debugf("no GPU detected on the host: %s", err)
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			// e.g. GPU 0: NVIDIA GeForce RTX 3090 (UUID: GPU-...)
+			if strings.HasPrefix(strings.TrimSpace(scanner.Text()), "GPU ") {
+				gpus++
+			}
+		}
+	}
+	DefaultGraph.HostGPUs = &gpus
+	return gpus
+}
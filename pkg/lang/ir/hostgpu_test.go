@@ -0,0 +1,52 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHostGPUs(t *testing.T) {
+	probe := hostGPUProbe
+	defer func() {
+		hostGPUProbe = probe
+		DefaultGraph = NewGraph()
+	}()
+
+	tcs := []struct {
+		out      string
+		err      error
+		expected int
+	}{
+		{"GPU 0: NVIDIA GeForce RTX 3090 (UUID: GPU-0)\nGPU 1: NVIDIA GeForce RTX 3090 (UUID: GPU-1)\n", nil, 2},
+		{"No devices were found\n", nil, 0},
+		{"", errors.New("executable file not found in $PATH"), 0},
+	}
+	for _, tc := range tcs {
+		DefaultGraph = NewGraph()
+		calls := 0
+		hostGPUProbe = func() ([]byte, error) {
+			calls++
+			return []byte(tc.out), tc.err
+		}
+		if gpus := HostGPUs(); gpus != tc.expected {
+			t.Errorf("expected %d GPUs from %q, got %d", tc.expected, tc.out, gpus)
+		}
+		if gpus := HostGPUs(); gpus != tc.expected || calls != 1 {
+			t.Errorf("expected the probe to be cached, got %d GPUs in %d calls", gpus, calls)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The kinds of the external resources reported by envd inspect.
+const (
+	ResourceImage    = "image"
+	ResourceURL      = "url"
+	ResourceRepo     = "repo"
+	ResourceMirror   = "mirror"
+	ResourcePackage  = "package"
+	ResourceCommand  = "command"
+	ResourceHostPath = "host path"
+	ResourceHostEnv  = "host env"
+)
+
+// urlPattern extracts the URLs from the apt sources and the condarc.
+var urlPattern = regexp.MustCompile(`https?://[^\s"']+`)
+
+// Resource is an external resource the environment touches when it is
+// built or started, e.g. the base image, the mirrors and the host paths.
+type Resource struct {
+	Kind string
+	// Name is the resource itself, e.g. the image name or the URL.
+	Name string
+	// Rule is the rule in the build file which introduces the resource.
+	Rule string
+}
+
+// RemoteModule records the remote git repo loaded by the build file.
+func RemoteModule(url string) {
+	DefaultGraph.RemoteModules = append(DefaultGraph.RemoteModules, url)
+}
+
+// LocalModule records the local build file loaded by the build file.
+func LocalModule(path string) {
+	for _, p := range DefaultGraph.LocalModules {
+		if p == path {
+			return
+		}
+	}
+	DefaultGraph.LocalModules = append(DefaultGraph.LocalModules, path)
+}
+
+// ReadFile records the file in the build context read by the build file.
+func ReadFile(path string) {
+	for _, p := range DefaultGraph.ReadFiles {
+		if p == path {
+			return
+		}
+	}
+	DefaultGraph.ReadFiles = append(DefaultGraph.ReadFiles, path)
+}
+
+// ExternalResources returns the external resources in the graph, thus the
+// build file can be reviewed before it is built.
+func (g Graph) ExternalResources() ([]Resource, error) {
+	res := []Resource{}
+	add := func(kind, rule string, names ...string) {
+		for _, name := range names {
+			if name != "" {
+				res = append(res, Resource{Kind: kind, Name: name, Rule: rule})
+			}
+		}
+	}
+
+	for _, url := range g.RemoteModules {
+		add(ResourceRepo, "include", url)
+	}
+	image, err := g.baseImage()
+	if err != nil {
+		return nil, err
+	}
+	add(ResourceImage, "base", image)
+	if g.BaseDockerfile != nil {
+		add(ResourceHostPath, "base", g.BaseDockerfile.Path)
+	}
+
+	if g.UbuntuAPTSource != nil {
+		add(ResourceMirror, "config.apt_source", urlPattern.FindAllString(*g.UbuntuAPTSource, -1)...)
+	}
+	if g.PyPIIndexURL != nil {
+		add(ResourceMirror, "config.pip_index", *g.PyPIIndexURL)
+	}
+	if g.PyPIExtraIndexURL != nil {
+		add(ResourceMirror, "config.pip_index", *g.PyPIExtraIndexURL)
+	}
+	if g.CRANMirrorURL != nil {
+		add(ResourceMirror, "config.cran_mirror", *g.CRANMirrorURL)
+	}
+	if g.JuliaPackageServer != nil {
+		add(ResourceMirror, "config.julia_pkg_server", *g.JuliaPackageServer)
+	}
+	if g.CondaConfig != nil {
+		if g.CondaConfig.CondaChannel != nil {
+			add(ResourceMirror, "config.conda_channel",
+				urlPattern.FindAllString(*g.CondaConfig.CondaChannel, -1)...)
+		}
+		add(ResourceMirror, ruleCondaPackages, g.CondaConfig.AdditionalChannels...)
+		add(ResourcePackage, ruleCondaPackages, g.CondaConfig.CondaPackages...)
+		add(ResourceHostPath, ruleCondaPackages, g.CondaConfig.CondaEnvFileName)
+	}
+	if g.ProxyConfig != nil {
+		add(ResourceMirror, "config.proxy", g.ProxyConfig.HTTPProxy, g.ProxyConfig.HTTPSProxy)
+		add(ResourceMirror, "config.apt_proxy", g.ProxyConfig.APTProxy)
+	}
+
+	add(ResourcePackage, ruleAPTPackages, g.SystemPackages...)
+	add(ResourcePackage, "install.cuda_libraries", g.CUDALibraries...)
+	add(ResourcePackage, "install.database_clients", g.databaseClientPackages()...)
+	add(ResourcePackage, rulePyPIPackages, g.PyPIPackages...)
+	for _, layer := range g.PyPILayers {
+		add(ResourcePackage, rulePyPIPackages, layer...)
+	}
+	if g.RequirementsFile != nil {
+		add(ResourceHostPath, rulePyPIPackages, *g.RequirementsFile)
+	}
+	if g.PipfileFile != nil {
+		add(ResourceHostPath, rulePyPIPackages, *g.PipfileFile)
+	}
+	add(ResourceHostPath, rulePyPIPackages, g.PythonWheels...)
+	add(ResourcePackage, ruleRPackages, g.RPackages...)
+	add(ResourcePackage, ruleJuliaPackages, g.JuliaPackages...)
+	for _, p := range g.VSCodePlugins {
+		add(ResourcePackage, "install.vscode_extensions", p.String())
+	}
+	if g.GitLFSConfig != nil && len(g.GitLFSConfig.HostConfig) > 0 {
+		add(ResourceHostPath, "install.git_lfs", "~/.gitconfig")
+	}
+	if g.TmuxConfig != nil {
+		add(ResourceHostPath, "install.tmux", g.TmuxConfig.ConfigFile)
+	}
+	if g.GitHubCLIConfig != nil {
+		add(ResourceURL, "install.github_cli", githubCLIKeyringURL, "https://cli.github.com/packages")
+		if g.GitHubCLIConfig.ForwardToken {
+			add(ResourceHostEnv, "install.github_cli", "GH_TOKEN", "GITHUB_TOKEN")
+		}
+	}
+
+	for _, h := range g.HTTP {
+		add(ResourceURL, "io.http", h.URL)
+	}
+	for _, c := range g.Copy {
+		add(ResourceHostPath, ruleCopy, c.Source)
+	}
+	for _, m := range g.Mount {
+		add(ResourceHostPath, "runtime.mount", m.Source)
+	}
+	add(ResourceHostPath, "config.ca_certificates", g.CACertificates...)
+	add(ResourceHostPath, "config.authorized_keys", g.AuthorizedKeys...)
+	add(ResourceHostPath, "io.read_file", g.ReadFiles...)
+	add(ResourceHostEnv, "runtime.env_passthrough", g.RuntimeEnvPassthrough...)
+	add(ResourceHostEnv, "host.getenv", g.HostEnv...)
+	if g.HostGPUs != nil {
+		add(ResourceCommand, "host.gpu", "nvidia-smi -L")
+	}
+	for _, db := range g.RuntimeDatabases {
+		add(ResourceHostEnv, "runtime.database", db.URLEnv)
+	}
+
+	for _, r := range g.Exec {
+		add(ResourceCommand, ruleRun, r.Commands...)
+	}
+	add(ResourceCommand, "config.entrypoint", strings.Join(g.Entrypoint, " "))
+	for name, cmd := range g.RuntimeCommands {
+		add(ResourceCommand, "runtime.command", fmt.Sprintf("%s: %s", name, cmd))
+	}
+	for _, d := range g.RuntimeDaemon {
+		add(ResourceCommand, "runtime.daemon", strings.Join(d, " "))
+	}
+	for _, c := range g.RuntimeCron {
+		add(ResourceCommand, "runtime.cron", fmt.Sprintf("%s %s", c.Schedule, c.Command))
+	}
+	return res, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"testing"
+)
+
+func TestExternalResources(t *testing.T) {
+	g := NewGraph()
+	image := "python:3.9"
+	source := "deb https://mirror.example.com/ubuntu/ focal main"
+	index := "https://pypi.example.com/simple"
+	g.Image = &image
+	g.UbuntuAPTSource = &source
+	g.PyPIIndexURL = &index
+	g.PyPIPackages = []string{"numpy"}
+	g.HTTP = []HTTPInfo{{URL: "https://example.com/data.tar.gz"}}
+	g.Mount = []MountInfo{{Source: "/data", Destination: "/home/envd/data"}}
+	g.Exec = []RunInfo{{Commands: []string{"curl https://example.com | sh"}}}
+	g.RemoteModules = []string{"https://github.com/example/envd-lib"}
+
+	resources, err := g.ExternalResources()
+	if err != nil {
+		t.Fatalf("failed to get the external resources: %v", err)
+	}
+	expected := []Resource{
+		{Kind: ResourceRepo, Name: "https://github.com/example/envd-lib", Rule: "include"},
+		{Kind: ResourceImage, Name: "python:3.9", Rule: "base"},
+		{Kind: ResourceMirror, Name: "https://mirror.example.com/ubuntu/", Rule: "config.apt_source"},
+		{Kind: ResourceMirror, Name: index, Rule: "config.pip_index"},
+		{Kind: ResourcePackage, Name: "numpy", Rule: rulePyPIPackages},
+		{Kind: ResourceURL, Name: "https://example.com/data.tar.gz", Rule: "io.http"},
+		{Kind: ResourceHostPath, Name: "/data", Rule: "runtime.mount"},
+		{Kind: ResourceCommand, Name: "curl https://example.com | sh", Rule: ruleRun},
+	}
+	if len(resources) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, resources)
+	}
+	for i := range expected {
+		if resources[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], resources[i])
+		}
+	}
+}
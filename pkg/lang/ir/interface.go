@@ -15,41 +15,101 @@
 package ir
 
 import (
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
 	"github.com/cockroachdb/errors"
 	"github.com/opencontainers/go-digest"
 
 	"github.com/tensorchord/envd/pkg/editor/vscode"
 )
 
-func Base(os, language, image string) error {
+var tagKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Target sets the build target, it is evaluated by target() in the build file.
+func Target(name string) {
+	DefaultGraph.Target = name
+}
+
+// IsTarget returns true if the build target is the given one.
+func IsTarget(name string) bool {
+	if DefaultGraph.Target == "" {
+		return name == TargetDev
+	}
+	return DefaultGraph.Target == name
+}
+
+// Minimal omits oh-my-zsh, the VS Code extensions and envd-sshd, thus only
+// the packages are kept in the image, e.g. for the batch jobs.
+func Minimal() {
+	DefaultGraph.Minimal = true
+	DefaultGraph.Shell = shellBASH
+	DefaultGraph.VSCodePlugins = nil
+}
+
+func Base(os, language, image, dockerfile string) error {
 	l, version, err := parseLanguage(language)
 	if err != nil {
 		return err
 	}
+	if image != "" && dockerfile != "" {
+		return errors.New("cannot specify the image and the dockerfile at the same time")
+	}
 	DefaultGraph.Language = Language{
 		Name:    l,
 		Version: version,
 	}
 	if len(os) > 0 {
-		DefaultGraph.OS = os
+		if _, _, err := parseOS(os); err != nil {
+			return err
+		}
+		DefaultGraph.OS = strings.ToLower(os)
 	}
 	if image != "" {
 		DefaultGraph.Image = &image
 	}
+	if dockerfile != "" {
+		d, err := ImportDockerfile(dockerfile)
+		if err != nil {
+			return err
+		}
+		DefaultGraph.BaseDockerfile = d
+	}
 	return nil
 }
 
-func PyPIPackage(deps []string, requirementsFile string, wheels []string) error {
+func PyPIPackage(deps []string, requirementsFile string, pipfile string, wheels []string) error {
 	DefaultGraph.PyPIPackages = append(DefaultGraph.PyPIPackages, deps...)
 	DefaultGraph.PythonWheels = append(DefaultGraph.PythonWheels, wheels...)
 
 	if requirementsFile != "" {
 		DefaultGraph.RequirementsFile = &requirementsFile
 	}
+	if pipfile != "" {
+		DefaultGraph.PipfileFile = &pipfile
+	}
 
 	return nil
 }
 
+// PyPILayer installs the PyPI packages in their own layer, or one layer per
+// package if perPackage is true. The packages must be added by PyPIPackage.
+func PyPILayer(deps []string, perPackage bool) {
+	if len(deps) == 0 {
+		return
+	}
+	if !perPackage {
+		DefaultGraph.PyPILayers = append(DefaultGraph.PyPILayers, deps)
+		return
+	}
+	for _, dep := range deps {
+		DefaultGraph.PyPILayers = append(DefaultGraph.PyPILayers, []string{dep})
+	}
+}
+
 func RPackage(deps []string) {
 	DefaultGraph.RPackages = append(DefaultGraph.RPackages, deps...)
 }
@@ -94,6 +154,95 @@ func UbuntuAPT(source string) error {
 	return nil
 }
 
+// Timezone sets the timezone (e.g. Asia/Shanghai) of the image.
+func Timezone(name string) error {
+	if !timezonePattern.MatchString(name) {
+		return errors.Newf("invalid timezone %s", name)
+	}
+	DefaultGraph.Timezone = &name
+	return nil
+}
+
+// Locale generates the locale (e.g. en_US.UTF-8) and uses it as the default.
+func Locale(name string) error {
+	if !localePattern.MatchString(name) {
+		return errors.Newf("invalid locale %s", name)
+	}
+	DefaultGraph.Locale = &name
+	return nil
+}
+
+// CACertificates installs the PEM encoded certificates into the system trust store.
+func CACertificates(paths []string) error {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			return errors.Wrapf(err, "failed to find the certificate %s", p)
+		}
+	}
+	DefaultGraph.CACertificates = append(DefaultGraph.CACertificates, paths...)
+	return nil
+}
+
+// BuiltinSystemPackages adds the packages to and removes the packages from
+// the builtin system packages installed in the base image.
+func BuiltinSystemPackages(add, remove []string) error {
+	for _, pkg := range remove {
+		for _, required := range requiredBuiltinSystemPackages {
+			if pkg == required {
+				return errors.Newf("builtin system package %s is required by envd", pkg)
+			}
+		}
+	}
+	DefaultGraph.ExtraBuiltinSystemPackages = append(
+		DefaultGraph.ExtraBuiltinSystemPackages, add...)
+	DefaultGraph.ExcludedBuiltinSystemPackages = append(
+		DefaultGraph.ExcludedBuiltinSystemPackages, remove...)
+	return nil
+}
+
+// Proxy sets the proxy used by apt, pip, conda and the downloads in the build
+// process. The empty values do not override the ones set before.
+func Proxy(httpProxy, httpsProxy, noProxy string) {
+	if DefaultGraph.ProxyConfig == nil {
+		DefaultGraph.ProxyConfig = &ProxyConfig{}
+	}
+	if httpProxy != "" {
+		DefaultGraph.ProxyConfig.HTTPProxy = httpProxy
+	}
+	if httpsProxy != "" {
+		DefaultGraph.ProxyConfig.HTTPSProxy = httpsProxy
+	}
+	if noProxy != "" {
+		DefaultGraph.ProxyConfig.NoProxy = noProxy
+	}
+}
+
+// APTProxy routes the apt traffic in the build process through the caching
+// proxy, e.g. apt-cacher-ng, so that the packages are downloaded only once.
+func APTProxy(url string) error {
+	if !strings.HasPrefix(url, "http://") {
+		return errors.Newf("apt proxy %s should start with http://", url)
+	}
+	if DefaultGraph.ProxyConfig == nil {
+		DefaultGraph.ProxyConfig = &ProxyConfig{}
+	}
+	DefaultGraph.ProxyConfig.APTProxy = url
+	return nil
+}
+
+// PyPIProxy uses the caching PyPI index in the build process. The index set
+// by PyPIIndex takes precedence over it.
+func PyPIProxy(url string) error {
+	if !strings.HasPrefix(url, "http://") {
+		return errors.Newf("PyPI proxy %s should start with http://", url)
+	}
+	if DefaultGraph.ProxyConfig == nil {
+		DefaultGraph.ProxyConfig = &ProxyConfig{}
+	}
+	DefaultGraph.ProxyConfig.PyPIProxy = url
+	return nil
+}
+
 func PyPIIndex(url, extraURL string) error {
 	if url == "" {
 		return errors.New("url is required")
@@ -114,12 +263,105 @@ func JuliaPackageServer(url string) error {
 	return nil
 }
 
-func Shell(shell string) error {
+func Shell(shell string, plugins []string, theme string) error {
+	DefaultGraph.ZSHConfig = nil
+	DefaultGraph.BashConfig = nil
+	DefaultGraph.FishConfig = nil
+	switch shell {
+	case shellZSH:
+		if err := checkShellNames("oh-my-zsh", plugins, theme); err != nil {
+			return err
+		}
+		if len(plugins) != 0 || theme != "" {
+			DefaultGraph.ZSHConfig = &ZSHConfig{
+				Plugins: plugins,
+				Theme:   theme,
+			}
+		}
+	case shellBASH:
+		// The bashrc is only rewritten if bash is chosen explicitly.
+		if err := checkShellNames("bash-it", plugins, theme); err != nil {
+			return err
+		}
+		DefaultGraph.BashConfig = &BashConfig{
+			Plugins: plugins,
+			Theme:   theme,
+		}
+	case shellFish:
+		if theme != "" {
+			return errors.New("theme is not supported by fish, install it as a fisher plugin")
+		}
+		for _, p := range plugins {
+			if !fisherPluginPattern.MatchString(p) {
+				return errors.Newf("invalid fisher plugin: %s", p)
+			}
+		}
+		DefaultGraph.FishConfig = &FishConfig{
+			Plugins: plugins,
+		}
+	default:
+		if len(plugins) != 0 || theme != "" {
+			return errors.Newf("plugins and theme are not supported by %s", shell)
+		}
+	}
 	DefaultGraph.Shell = shell
 	DefaultGraph.SystemPackages = append(DefaultGraph.SystemPackages, shell)
 	return nil
 }
 
+// OHMyZSH pins the revision of oh-my-zsh, i.e. a branch, a tag or a commit,
+// and sets where it is installed from, e.g. the mirror.
+func OHMyZSH(revision, url, tarball string) error {
+	if revision == "" && url == "" && tarball == "" {
+		return errors.New("one of the revision, url and tarball is required")
+	}
+	if revision != "" && !ohMyZSHRevisionPattern.MatchString(revision) {
+		return errors.Newf("invalid oh-my-zsh revision: %s", revision)
+	}
+	if url != "" && !gitURLPattern.MatchString(url) {
+		return errors.Newf("invalid oh-my-zsh url %s, expected http, https, ssh or git@", url)
+	}
+	if tarball != "" {
+		info, err := os.Stat(tarball)
+		if err != nil {
+			return errors.Wrapf(err, "failed to find the oh-my-zsh tarball %s", tarball)
+		}
+		if info.IsDir() {
+			return errors.Newf("the oh-my-zsh tarball %s is a directory", tarball)
+		}
+	}
+	DefaultGraph.OHMyZSHConfig = &OHMyZSHConfig{
+		Revision: revision,
+		URL:      url,
+		Tarball:  tarball,
+	}
+	return nil
+}
+
+// checkShellNames validates the names of the plugins and the theme of the
+// shell framework, e.g. oh-my-zsh.
+func checkShellNames(framework string, plugins []string, theme string) error {
+	for _, p := range plugins {
+		if !zshNamePattern.MatchString(p) {
+			return errors.Newf("invalid %s plugin: %s", framework, p)
+		}
+	}
+	if theme != "" && !zshNamePattern.MatchString(theme) {
+		return errors.Newf("invalid %s theme: %s", framework, theme)
+	}
+	return nil
+}
+
+// ShellRC appends the snippet to the rc files of the shells, e.g. the
+// aliases and the environment variables.
+func ShellRC(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errors.New("content is required")
+	}
+	DefaultGraph.ShellRC = append(DefaultGraph.ShellRC, content)
+	return nil
+}
+
 func Jupyter(pwd string, port int64) error {
 	DefaultGraph.JupyterConfig = &JupyterConfig{
 		Token: pwd,
@@ -133,9 +375,19 @@ func RStudioServer() error {
 	return nil
 }
 
-func Run(commands []string) error {
+func Run(commands []string, shell string, allow []string) error {
+	if shell != "" && len(strings.Fields(shell)) == 0 {
+		return errors.New("shell should not be blank")
+	}
+	if err := validateSandboxGrants(allow); err != nil {
+		return err
+	}
 	// TODO(gaocegege): Support order-based exec.
-	DefaultGraph.Exec = append(DefaultGraph.Exec, commands...)
+	DefaultGraph.Exec = append(DefaultGraph.Exec, RunInfo{
+		Commands: commands,
+		Shell:    strings.TrimSpace(shell),
+		Allow:    allow,
+	})
 	return nil
 }
 
@@ -197,8 +449,12 @@ func HTTP(url, checksum, filename string) error {
 	return nil
 }
 
-func Entrypoint(args []string) {
+// Entrypoint sets the entrypoint of the custom base image. In the envd
+// images, the command runs along with the envd-sshd, or instead of it if
+// replace is true.
+func Entrypoint(args []string, replace bool) {
 	DefaultGraph.Entrypoint = append(DefaultGraph.Entrypoint, args...)
+	DefaultGraph.ReplaceEntrypoint = DefaultGraph.ReplaceEntrypoint || replace
 }
 
 func RuntimeCommands(commands map[string]string) {
@@ -225,3 +481,72 @@ func RuntimeEnviron(env map[string]string) {
 		DefaultGraph.RuntimeEnviron[k] = v
 	}
 }
+
+func RuntimeEnvPassthrough(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid env passthrough pattern %s", pattern)
+		}
+	}
+	DefaultGraph.RuntimeEnvPassthrough = append(
+		DefaultGraph.RuntimeEnvPassthrough, patterns...)
+	return nil
+}
+
+// RuntimeTags sets the user-defined tags of the environment in the format
+// of key=value, which are labeled on the container.
+func RuntimeTags(tags []string) error {
+	for _, tag := range tags {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok || !tagKeyPattern.MatchString(k) {
+			return errors.Newf("invalid tag %s, expected key=value, e.g. team=nlp", tag)
+		}
+		if DefaultGraph.RuntimeTags == nil {
+			DefaultGraph.RuntimeTags = make(map[string]string)
+		}
+		DefaultGraph.RuntimeTags[k] = v
+	}
+	return nil
+}
+
+// RuntimeSSHAgent forwards the ssh agent of the host into the environment,
+// thus git works with the private repos without copying the private keys.
+func RuntimeSSHAgent(socket string) {
+	DefaultGraph.RuntimeSSHAgent = socket
+}
+
+// RuntimeGitConfig propagates the git config filtered from the host into the
+// environment, thus the commits are attributed to the user.
+func RuntimeGitConfig(path string) {
+	DefaultGraph.RuntimeGitConfig = path
+}
+
+// RuntimeGitCredentials makes the https credentials of the git credential
+// helper on the host usable in the environment, without storing them in the
+// image.
+func RuntimeGitCredentials(path string) {
+	DefaultGraph.RuntimeGitCredentials = path
+}
+
+// LogForwardJournald forwards the logs to the journal of the docker host.
+const LogForwardJournald = "journald"
+
+// RuntimeLogForward forwards the logs of the environment, i.e. envd-sshd,
+// jupyter and the daemons, to the journal of the docker host or the syslog
+// address, e.g. udp://logs.example.com:514.
+func RuntimeLogForward(target string) error {
+	if target != "" && target != LogForwardJournald {
+		u, err := url.Parse(target)
+		if err != nil {
+			return errors.Wrapf(err, "invalid log forward target %s", target)
+		}
+		switch u.Scheme {
+		case "udp", "tcp", "tcp+tls", "unix", "unixgram":
+		default:
+			return errors.Newf("invalid log forward target %s, expected journald "+
+				"or the syslog address, e.g. udp://logs.example.com:514", target)
+		}
+	}
+	DefaultGraph.RuntimeLogForward = target
+	return nil
+}
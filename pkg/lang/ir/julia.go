@@ -15,15 +15,17 @@
 package ir
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/cockroachdb/errors"
 	"github.com/moby/buildkit/client/llb"
-	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd/pkg/log"
 )
 
-func (g Graph) compileJulia(aptStage llb.State) (llb.State, error) {
+func (g Graph) compileJulia(ctx context.Context, aptStage llb.State) (llb.State, error) {
 	if err := g.compileJupyter(); err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to compile jupyter")
 	}
@@ -36,7 +38,7 @@ func (g Graph) compileJulia(aptStage llb.State) (llb.State, error) {
 	}
 	diffSSHStage := llb.Diff(builtinSystemStage, sshStage, llb.WithCustomName("install ssh keys"))
 
-	shellStage, err := g.compileShell(builtinSystemStage)
+	shellStage, err := g.compileShell(ctx, builtinSystemStage)
 	if err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to compile shell")
 	}
@@ -48,7 +50,7 @@ func (g Graph) compileJulia(aptStage llb.State) (llb.State, error) {
 	juliaStage := llb.Diff(builtinSystemStage,
 		g.installJuliaPackages(builtinSystemStage), llb.WithCustomName("install julia packages"))
 
-	vscodeStage, err := g.compileVSCode()
+	vscodeStage, err := g.compileVSCode(ctx)
 	if err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to get vscode plugins")
 	}
@@ -87,14 +89,15 @@ func (g Graph) installJuliaPackages(root llb.State) llb.State {
 
 	// TODO(gaocegege): Support cache.
 	cmd := sb.String()
-	logrus.Debug("install julia packages: ", cmd)
+	log.Debug("install julia packages: ", cmd)
 	root = llb.User("envd")(root)
 	if g.JuliaPackageServer != nil {
 		root = root.AddEnv("JULIA_PKG_SERVER", *g.JuliaPackageServer)
 	}
 	root = root.AddEnv("PATH", "/usr/local/julia/bin")
 	run := root.
-		Run(llb.Shlex(cmd), llb.WithCustomNamef("install julia packages"))
+		Run(llb.Shlex(cmd), llb.WithCustomNamef("install julia packages"),
+			g.sourceLocation(ruleJuliaPackages))
 
 	return run.Root()
 }
@@ -0,0 +1,98 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+	"golang.org/x/crypto/ssh"
+)
+
+// knownHostsPath is the global known_hosts read by the ssh client.
+const knownHostsPath = "/etc/ssh/ssh_known_hosts"
+
+// DefaultKnownHosts are the git hosts whose keys are baked by default.
+var DefaultKnownHosts = []string{"github.com", "gitlab.com"}
+
+// builtinKnownHosts are the host keys published by the git hosts, see
+// https://docs.github.com/en/authentication/keeping-your-account-and-data-secure/githubs-ssh-key-fingerprints
+// and https://docs.gitlab.com/ee/user/gitlab_com/#ssh-known_hosts-entries.
+var builtinKnownHosts = map[string][]string{
+	"github.com": {
+		"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl",
+		"ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBEmKSENjQEezOmxkZMy7opKgwFB9nkt5YRrYMjNuG5N87uRgg6CLrbo5wAdT/y6v0mKV0U2w0WZ2YB/++Tpockg=",
+		"ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABgQCj7ndNxQowgcQnjshcLrqPEiiphnt+VTTvDP6mHBL9j1aNUkY4Ue1gvwnGLVlOhGeYrnZaMgRK6+PKCUXaDbC7qtbW8gIkhL7aGCsOr/C56SJMy/BCZfxd1nWzAOxSDPgVsmerOBYfNqltV9/hWCqBywINIR+5dIg6JTJ72pcEpEjcYgXkE2YEFXV1JHnsKgbLWNlhScqb2UmyRkQyytRLtL+38TGxkxCflmO+5Z8CSSNY7GidjMIZ7Q4zMjA2n1nGrlTDkzwDCsw+wqFPGQA179cnfGWOWRVruj16z6XyvxvjJwbz0wQZ75XK5tKSb7FNyeIEs4TT4jk+S4dhPeAUC5y+bDYirYgM4GC7uEnztnZyaVWQ7B381AK4Qdrwt51ZqExKbQpTUNn+EjqoTwvqNj4kqx5QUCI0ThS/YkOxJCXmPUWZbhjpCg56i+2aB6CmK2JGhn57K5mj0MNdBXA4/WnwH6XoPWJzK5Nyu2zB3nAZp+S5hpQs+p1vN1/wsjk=",
+	},
+	"gitlab.com": {
+		"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAfuCHKVTjquxvt6CM6tdG4SLp1Btn/nOeHHE5UOzRdf",
+		"ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBFSMqzJeV9rUzU4kWitGjeR4PWSa29SPqJ1fVkhtj3Hw9xjLVXVYrU9QlYWrOLXBpQ6KWjbjTDTdDkoohFzgbEY=",
+		"ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCsj2bNKTBSpIYDEGk9KxsGh3mySTRgMtXL583qmBpzeQ+jqCMRgBqB98u3z++J1sKlXHWfM9dyhSevkMwSbhoR8XIq/U0tCNyokEi/ueaBMCvbcTHhO7FcwzY92WK4Yt0aGROY5qX2UKSeOvuP4D6TPqKF1onrSzH9bx9XUf2lEdWT/ia1NEKjunUqu1xOB/StKDHMoX4/OKyIzuS0q/T1zOATthvasJFoPrAjkohTyaDUz2LN5JoH839hViyEG82yB+MjcFV5MU3N1l1QL3cVUCh93xSaua1N85qivl+siMkPGbO5xR/En4iEY6K2XPASUEMaieWVNTRCtJ4S8H+9",
+	},
+}
+
+// KnownHosts bakes the verified keys of the git hosts and the known_hosts
+// entries into the global known_hosts, thus ssh does not prompt for the host
+// keys in the non-tty steps. The default hosts are used if both are empty.
+func KnownHosts(hosts, entries []string) error {
+	if len(hosts) == 0 && len(entries) == 0 {
+		hosts = DefaultKnownHosts
+	}
+	lines := []string{}
+	for _, host := range hosts {
+		keys, ok := builtinKnownHosts[host]
+		if !ok {
+			return errors.Newf("the host key of %s is not built in, "+
+				"please pass its known_hosts entry instead", host)
+		}
+		for _, key := range keys {
+			lines = append(lines, fmt.Sprintf("%s %s", host, key))
+		}
+	}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if _, _, _, _, _, err := ssh.ParseKnownHosts([]byte(entry)); err != nil {
+			return errors.Wrapf(err, "invalid known_hosts entry %s", entry)
+		}
+		lines = append(lines, entry)
+	}
+	DefaultGraph.KnownHosts = append(DefaultGraph.KnownHosts, lines...)
+	return nil
+}
+
+func (g Graph) knownHosts() string {
+	return strings.Join(g.KnownHosts, "\n") + "\n"
+}
+
+// compileKnownHosts writes the global known_hosts in the system stage.
+func (g Graph) compileKnownHosts(root llb.State) llb.State {
+	if len(g.KnownHosts) == 0 {
+		return root
+	}
+	return root.File(llb.Mkdir(filepath.Dir(knownHostsPath), 0755, llb.WithParents(true)).
+		Mkfile(knownHostsPath, 0644, []byte(g.knownHosts())),
+		llb.WithCustomName("[internal] setting ssh known hosts"))
+}
+
+// dockerfileKnownHosts is the Dockerfile version of compileKnownHosts.
+func (g Graph) dockerfileKnownHosts(w *dockerfileWriter) {
+	if len(g.KnownHosts) == 0 {
+		return
+	}
+	w.file(knownHostsPath, g.knownHosts(), 0, 0)
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestKnownHosts(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	// The fingerprints published by GitHub and GitLab.
+	fingerprints := map[string]bool{
+		"SHA256:+DiY3wvvV6TuJJhbpZisF/zLDA0zPMSvHdkr4UvCOqU": true,
+		"SHA256:p2QAMXNIC1TJYWeIOttrVc98/R1BUFWu3/LiyKgUfQM": true,
+		"SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s": true,
+		"SHA256:eUXGGm1YGsMAS7vkcx6JOJdOGHPem5gQp4taiCfCLB8": true,
+		"SHA256:HbW3g8zUjNSksFbqTiUWPWg2Bq1x8xdGUrliXFzSnUw": true,
+		"SHA256:ROQFvPThGrW4RuWLoL9tq9I9zJ42fK4XywyRtbOz/EQ": true,
+	}
+	if err := KnownHosts(nil, nil); err != nil {
+		t.Fatalf("failed to set the known hosts: %v", err)
+	}
+	if n := len(DefaultGraph.KnownHosts); n != len(fingerprints) {
+		t.Fatalf("expected %d keys, got %d", len(fingerprints), n)
+	}
+	for _, line := range DefaultGraph.KnownHosts {
+		_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", line, err)
+		}
+		if fp := ssh.FingerprintSHA256(key); !fingerprints[fp] {
+			t.Errorf("unexpected fingerprint %s of %s", fp, line)
+		}
+	}
+
+	entry := "git.example.com " + strings.TrimPrefix(DefaultGraph.KnownHosts[0], "github.com ")
+	if err := KnownHosts(nil, []string{entry}); err != nil {
+		t.Fatalf("failed to add the entry: %v", err)
+	}
+	if !strings.HasSuffix(DefaultGraph.knownHosts(), entry+"\n") {
+		t.Errorf("expected the entry in the known hosts:\n%s", DefaultGraph.knownHosts())
+	}
+	if err := KnownHosts([]string{"git.example.com"}, nil); err == nil {
+		t.Errorf("expected the error for the host without the built-in key")
+	}
+	if err := KnownHosts(nil, []string{"git.example.com ssh-ed25519"}); err == nil {
+		t.Errorf("expected the error for the invalid entry")
+	}
+}
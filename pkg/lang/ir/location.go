@@ -0,0 +1,103 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"os"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+// The rules in the build file whose invocations are attached to the build steps.
+const (
+	ruleAPTPackages   = "install.apt_packages"
+	rulePyPIPackages  = "install.python_packages"
+	ruleCondaPackages = "install.conda_packages"
+	ruleRPackages     = "install.r_packages"
+	ruleJuliaPackages = "install.julia_packages"
+	ruleRun           = "run"
+	ruleCopy          = "io.copy"
+)
+
+// SourceLocation is where the rule is invoked in the build file.
+type SourceLocation struct {
+	Filename string
+	Line     int
+}
+
+// RecordLocation records where the rule is invoked, thus the error of the
+// failed build step points at the line in the build file.
+func RecordLocation(rule, filename string, line int) {
+	if DefaultGraph.SourceLocations == nil {
+		DefaultGraph.SourceLocations = make(map[string][]SourceLocation)
+	}
+	DefaultGraph.SourceLocations[rule] = append(DefaultGraph.SourceLocations[rule],
+		SourceLocation{Filename: filename, Line: line})
+
+	if DefaultGraph.sourceMaps == nil {
+		DefaultGraph.sourceMaps = make(map[string]*llb.SourceMap)
+	}
+	if _, ok := DefaultGraph.sourceMaps[filename]; ok {
+		return
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.WithError(err).Debugf("failed to read the build file %s", filename)
+	}
+	DefaultGraph.sourceMaps[filename] = llb.NewSourceMap(nil, filename, data)
+}
+
+// Deprecation is the deprecated usage of the rule in the build file.
+type Deprecation struct {
+	Rule     string
+	Message  string
+	Location SourceLocation
+}
+
+// RecordDeprecation records the deprecated usage of the rule, thus envd
+// lint reports it with the position.
+func RecordDeprecation(rule, message, filename string, line int) {
+	DefaultGraph.Deprecations = append(DefaultGraph.Deprecations, Deprecation{
+		Rule:     rule,
+		Message:  message,
+		Location: SourceLocation{Filename: filename, Line: line},
+	})
+}
+
+// sourceLocation returns the option which attaches the lines of the rule to
+// the build step. Only the lines in the file where the rule is first invoked
+// are attached, since one build step has one source map here.
+func (g Graph) sourceLocation(rule string) llb.ConstraintsOpt {
+	locations := g.SourceLocations[rule]
+	if len(locations) == 0 {
+		// The nil source map attaches nothing.
+		return (*llb.SourceMap)(nil).Location(nil)
+	}
+	filename := locations[0].Filename
+	ranges := []*pb.Range{}
+	for _, l := range locations {
+		if l.Filename != filename {
+			continue
+		}
+		ranges = append(ranges, &pb.Range{
+			Start: pb.Position{Line: int32(l.Line)},
+			End:   pb.Position{Line: int32(l.Line)},
+		})
+	}
+	return g.sourceMaps[filename].Location(ranges)
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+func TestSourceLocation(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	manifest := filepath.Join(t.TempDir(), "build.envd")
+	if err := os.WriteFile(manifest, []byte("def build():\n    run(commands=[\"false\"])\n"), 0644); err != nil {
+		t.Fatalf("failed to write the manifest: %v", err)
+	}
+	RecordLocation(ruleRun, manifest, 2)
+	if l := DefaultGraph.SourceLocations[ruleRun]; len(l) != 1 || l[0].Line != 2 {
+		t.Fatalf("expected the location at line 2, got %v", l)
+	}
+
+	state := llb.Image("ubuntu:20.04").Run(llb.Shlex("false"),
+		DefaultGraph.sourceLocation(ruleRun)).Root()
+	def, err := state.Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	if def.Source == nil || len(def.Source.Infos) != 1 {
+		t.Fatalf("expected one source info, got %v", def.Source)
+	}
+	if def.Source.Infos[0].Filename != manifest {
+		t.Errorf("expected the source file %s, got %s", manifest, def.Source.Infos[0].Filename)
+	}
+
+	// The steps without the recorded rules have no source.
+	state = llb.Image("ubuntu:20.04").Run(llb.Shlex("true"),
+		DefaultGraph.sourceLocation(ruleCopy)).Root()
+	def, err = state.Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	if def.Source != nil && len(def.Source.Infos) != 0 {
+		t.Errorf("expected no source info, got %v", def.Source.Infos)
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+const (
+	// LockFileName is the lockfile in the build context, which is written
+	// by envd lock and consumed by the subsequent builds.
+	LockFileName = "envd.lock"
+	// LockVersion is the version of the lockfile format.
+	LockVersion = "v1"
+
+	pipConstraintsDir = "/var/envd/lock"
+)
+
+// Lock is the resolved versions of the packages. APT and Conda only pin the
+// packages in the build file, while PyPI pins all the packages in the envd
+// python environment, thus the dependencies are pinned too.
+type Lock struct {
+	Version string            `json:"version"`
+	APT     map[string]string `json:"apt,omitempty"`
+	PyPI    map[string]string `json:"pypi,omitempty"`
+	Conda   map[string]string `json:"conda,omitempty"`
+	// PyPIHashes are the sha256 digests of the distributions of the PyPI
+	// packages, they are only resolved for config.pip_lock(require_hashes=True).
+	PyPIHashes map[string][]string `json:"pypi_hashes,omitempty"`
+	// VSCode are the versions of the vscode plugins keyed by the plugin
+	// IDs without the versions, e.g. ms-python.python@linux-x64.
+	VSCode map[string]string `json:"vscode,omitempty"`
+	// VSCodeHashes are the sha256 digests of the vsix files of the vscode
+	// plugins, they are only resolved if the marketplace provides them.
+	VSCodeHashes map[string]string `json:"vscode_hashes,omitempty"`
+}
+
+// PipLockConfig installs the PyPI packages from the lockfile, instead of
+// resolving the packages in the build file with the lock as constraints.
+type PipLockConfig struct {
+	// RequireHashes only installs the distributions with the digests in
+	// the lockfile, i.e. pip install --require-hashes.
+	RequireHashes bool
+	// NoDeps installs the locked packages without resolving their
+	// dependencies, i.e. pip install --no-deps.
+	NoDeps bool
+}
+
+// e.g. numpy, scikit-learn[alldeps], and the pinned ones are not matched.
+var (
+	pypiNamePattern  = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[A-Za-z0-9,._-]+\])?$`)
+	plainNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_-]*$`)
+	pypiNameSep      = regexp.MustCompile(`[-_.]+`)
+	// e.g. torch>=1.12 and numpy==1.23.4, the name is matched only.
+	pypiSpecNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*`)
+)
+
+// normalizePyPIName normalizes the name as PEP 503, e.g. Scikit_Learn is
+// scikit-learn.
+func normalizePyPIName(name string) string {
+	return pypiNameSep.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// LoadLock reads the lockfile.
+func LoadLock(filename string) (*Lock, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the lockfile %s", filename)
+	}
+	l := &Lock{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the lockfile %s", filename)
+	}
+	if l.Version != LockVersion {
+		return nil, errors.Newf("lockfile version %s is not supported, expected %s",
+			l.Version, LockVersion)
+	}
+	return l, nil
+}
+
+// Write writes the lockfile, the keys are sorted thus it is stable.
+func (l Lock) Write(filename string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the lockfile")
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write the lockfile %s", filename)
+	}
+	return nil
+}
+
+// UseLock pins the packages in the build file to the versions in the lock.
+// The packages with the version specifiers are kept as they are.
+func UseLock(l *Lock) {
+	DefaultGraph.Lock = l
+	DefaultGraph.SystemPackages = pinPackages(DefaultGraph.SystemPackages, func(pkg string) string {
+		if v, ok := l.APT[pkg]; ok && plainNamePattern.MatchString(pkg) {
+			return fmt.Sprintf("%s=%s", pkg, v)
+		}
+		return pkg
+	})
+	pinPyPI := func(pkg string) string {
+		matches := pypiNamePattern.FindStringSubmatch(pkg)
+		if matches == nil {
+			return pkg
+		}
+		if v, ok := l.PyPI[normalizePyPIName(matches[1])]; ok {
+			return fmt.Sprintf("%s==%s", pkg, v)
+		}
+		return pkg
+	}
+	DefaultGraph.PyPIPackages = pinPackages(DefaultGraph.PyPIPackages, pinPyPI)
+	for i, layer := range DefaultGraph.PyPILayers {
+		DefaultGraph.PyPILayers[i] = pinPackages(layer, pinPyPI)
+	}
+	for i, p := range DefaultGraph.VSCodePlugins {
+		v, ok := l.VSCode[p.ID()]
+		if !ok {
+			continue
+		}
+		if p.Version == nil {
+			version := v
+			DefaultGraph.VSCodePlugins[i].Version = &version
+		}
+		// The digest is of the locked version only.
+		if *DefaultGraph.VSCodePlugins[i].Version == v {
+			DefaultGraph.VSCodePlugins[i].SHA256 = l.VSCodeHashes[p.ID()]
+		}
+	}
+	if DefaultGraph.CondaConfig != nil {
+		DefaultGraph.CondaPackages = pinPackages(DefaultGraph.CondaPackages, func(pkg string) string {
+			if v, ok := l.Conda[pkg]; ok && plainNamePattern.MatchString(pkg) {
+				return fmt.Sprintf("%s==%s", pkg, v)
+			}
+			return pkg
+		})
+	}
+}
+
+func pinPackages(pkgs []string, pin func(string) string) []string {
+	if len(pkgs) == 0 {
+		return pkgs
+	}
+	res := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		res = append(res, pin(pkg))
+	}
+	return res
+}
+
+// LockQuery is the command to resolve the versions of one kind of the
+// packages in the built image.
+type LockQuery struct {
+	Kind    string
+	Command []string
+}
+
+// The kinds of the packages in the lockfile.
+const (
+	LockKindAPT   = "apt"
+	LockKindPyPI  = "pypi"
+	LockKindConda = "conda"
+)
+
+// LockQueries returns the commands to resolve the versions of the packages
+// in the image built from the default graph.
+func LockQueries() []LockQuery {
+	g := DefaultGraph
+	queries := []LockQuery{}
+	if len(g.SystemPackages) > 0 {
+		cmd := []string{"dpkg-query", "-W", "-f=${Package} ${Version}\n"}
+		for _, pkg := range g.SystemPackages {
+			// e.g. htop=3.0.5-7build2 is pinned in the build file.
+			name, _, _ := strings.Cut(pkg, "=")
+			cmd = append(cmd, name)
+		}
+		queries = append(queries, LockQuery{
+			Kind:    LockKindAPT,
+			Command: cmd,
+		})
+	}
+	if g.Image == nil && g.Language.Name == "python" {
+		queries = append(queries, LockQuery{
+			Kind: LockKindPyPI,
+			Command: []string{"/opt/conda/envs/envd/bin/python", "-m", "pip",
+				"list", "--format=freeze", "--disable-pip-version-check"},
+		})
+	}
+	if g.CondaConfig != nil && len(g.CondaPackages) > 0 {
+		queries = append(queries, LockQuery{
+			Kind: LockKindConda,
+			Command: []string{g.condaCommandPath(), "list", "-p", "/opt/conda/envs/envd",
+				"--json"},
+		})
+	}
+	return queries
+}
+
+// Add adds the versions in the output of the query to the lock.
+func (l *Lock) Add(kind, output string) error {
+	switch kind {
+	case LockKindAPT:
+		versions, err := parseLines(output, func(line string) (string, string, error) {
+			// e.g. htop 3.0.5-7build2
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				return "", "", errors.Newf("invalid apt package version %s", line)
+			}
+			return fields[0], fields[1], nil
+		})
+		if err != nil {
+			return err
+		}
+		l.APT = versions
+	case LockKindPyPI:
+		versions, err := parseLines(output, func(line string) (string, string, error) {
+			// e.g. numpy==1.23.4, the editable ones are skipped.
+			name, v, ok := strings.Cut(line, "==")
+			if !ok {
+				return "", "", nil
+			}
+			return normalizePyPIName(name), v, nil
+		})
+		if err != nil {
+			return err
+		}
+		l.PyPI = versions
+	case LockKindConda:
+		// conda and micromamba list the packages in the same json format.
+		pkgs := []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}{}
+		if err := json.Unmarshal([]byte(output), &pkgs); err != nil {
+			return errors.Wrap(err, "failed to parse the conda packages")
+		}
+		requested := map[string]bool{}
+		for _, pkg := range DefaultGraph.CondaPackages {
+			requested[pkg] = true
+		}
+		// Only the packages in the build file are pinned.
+		l.Conda = map[string]string{}
+		for _, pkg := range pkgs {
+			if requested[pkg.Name] {
+				l.Conda[pkg.Name] = pkg.Version
+			}
+		}
+	default:
+		return errors.Newf("unknown package kind %s", kind)
+	}
+	return nil
+}
+
+// parseLines parses the name and the version in every line, the line is
+// skipped if the name is empty.
+func parseLines(output string, parse func(string) (string, string, error)) (map[string]string, error) {
+	versions := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		name, v, err := parse(line)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			versions[name] = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read the versions")
+	}
+	return versions, nil
+}
+
+// pipConstraints returns the state of the constraints file of pip, which
+// pins all the packages in the lock thus the dependencies are pinned too.
+func (g Graph) pipConstraints() (llb.State, bool) {
+	constraints := g.pipConstraintsFile()
+	if constraints == "" {
+		return llb.State{}, false
+	}
+	return llb.Scratch().File(llb.Mkfile("/constraints.txt", 0644, []byte(constraints)),
+		llb.WithCustomName("[internal] generating pip constraints from the lockfile")), true
+}
+
+// pipConstraintsFile returns the constraints file of pip, which pins all the
+// PyPI packages in the lock, or "" if there is no lock.
+func (g Graph) pipConstraintsFile() string {
+	if g.Lock == nil || len(g.Lock.PyPI) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(g.Lock.PyPI))
+	for name := range g.Lock.PyPI {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%s==%s\n", name, g.Lock.PyPI[name]))
+	}
+	return sb.String()
+}
+
+// PipLock installs the PyPI packages from the lockfile, see PipLockConfig.
+func PipLock(requireHashes, noDeps bool) {
+	DefaultGraph.PipLockConfig = &PipLockConfig{
+		RequireHashes: requireHashes,
+		NoDeps:        noDeps,
+	}
+}
+
+// CheckPipLock verifies that the lock used in the build covers the PyPI
+// packages in the build file, if they are installed from the lockfile.
+func CheckPipLock() error {
+	g := DefaultGraph
+	if g.PipLockConfig == nil {
+		return nil
+	}
+	if g.Lock == nil || len(g.Lock.PyPI) == 0 {
+		return errors.Newf("config.pip_lock requires the PyPI packages in %s, "+
+			"run envd lock first", LockFileName)
+	}
+	if g.RequireHashes && len(g.Lock.PyPIHashes) == 0 {
+		return errors.Newf("there is no PyPI hash in %s, run envd lock again", LockFileName)
+	}
+	for _, pkg := range g.PyPIPackages {
+		name := pypiSpecNamePattern.FindString(pkg)
+		if _, ok := g.Lock.PyPI[normalizePyPIName(name)]; !ok {
+			return errors.Newf("PyPI package %s is not in %s, run envd lock again",
+				pkg, LockFileName)
+		}
+	}
+	if len(g.PyPILayers) > 0 {
+		log.Warn("the PyPI layers are installed in one step with config.pip_lock")
+	}
+	return nil
+}
+
+// pipLocked returns true if the PyPI packages are installed from the lock.
+func (g Graph) pipLocked() bool {
+	return g.PipLockConfig != nil && g.Lock != nil && len(g.Lock.PyPI) > 0
+}
+
+// pipLockRequirements returns the requirements file of pip, which lists all
+// the packages in the lock with their digests if the hashes are required.
+// The local wheels are installed after it, thus they are left out.
+func (g Graph) pipLockRequirements() string {
+	wheels := make(map[string]bool, len(g.PythonWheels))
+	for _, wheel := range g.PythonWheels {
+		// e.g. envd-0.3.0-py3-none-any.whl
+		name, _, _ := strings.Cut(filepath.Base(wheel), "-")
+		wheels[normalizePyPIName(name)] = true
+	}
+	names := make([]string, 0, len(g.Lock.PyPI))
+	for name := range g.Lock.PyPI {
+		if wheels[name] {
+			continue
+		}
+		// The packages which are not found in the index when locking,
+		// e.g. the ones installed by conda, cannot be verified.
+		if g.RequireHashes && len(g.Lock.PyPIHashes[name]) == 0 {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%s==%s", name, g.Lock.PyPI[name]))
+		if g.RequireHashes {
+			for _, hash := range g.Lock.PyPIHashes[name] {
+				sb.WriteString(fmt.Sprintf(" \\\n    --hash=sha256:%s", hash))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// pipLockArgs returns the argv of the pip install command which installs
+// the requirements generated from the lock.
+func (g Graph) pipLockArgs() []string {
+	args := []string{"/opt/conda/envs/envd/bin/python", "-m", "pip", "install"}
+	if g.NoDeps {
+		args = append(args, "--no-deps")
+	}
+	if g.RequireHashes {
+		args = append(args, "--require-hashes")
+	}
+	return append(args, "-r", filepath.Join(pipConstraintsDir, "requirements.txt"))
+}
@@ -0,0 +1,167 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUseLock(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	DefaultGraph.SystemPackages = []string{"htop", "vim=2:8.1"}
+	DefaultGraph.PyPIPackages = []string{"numpy", "Scikit_Learn[alldeps]", "torch>=1.12", "black"}
+	DefaultGraph.PyPILayers = [][]string{{"numpy"}}
+	DefaultGraph.CondaConfig = &CondaConfig{CondaPackages: []string{"pytorch", "cudatoolkit"}}
+	if err := VSCodePlugins([]string{"ms-python.python@latest@linux-x64", "eamodio.gitlens@12.0.0"}); err != nil {
+		t.Fatalf("failed to parse the vscode plugins: %v", err)
+	}
+
+	UseLock(&Lock{
+		Version: LockVersion,
+		APT:     map[string]string{"htop": "3.0.5-7build2", "vim": "2:8.2"},
+		PyPI:    map[string]string{"numpy": "1.23.4", "scikit-learn": "1.1.3", "torch": "1.13.0"},
+		Conda:   map[string]string{"pytorch": "1.12.1"},
+		VSCode:  map[string]string{"ms-python.python@linux-x64": "2023.4.1", "eamodio.gitlens": "13.0.0"},
+		VSCodeHashes: map[string]string{
+			"ms-python.python@linux-x64": "digest-of-python", "eamodio.gitlens": "digest-of-gitlens"},
+	})
+
+	testcases := []struct {
+		actual   []string
+		expected []string
+	}{
+		{DefaultGraph.SystemPackages, []string{"htop=3.0.5-7build2", "vim=2:8.1"}},
+		{DefaultGraph.PyPIPackages, []string{"numpy==1.23.4", "Scikit_Learn[alldeps]==1.1.3", "torch>=1.12", "black"}},
+		{DefaultGraph.PyPILayers[0], []string{"numpy==1.23.4"}},
+		{DefaultGraph.CondaPackages, []string{"pytorch==1.12.1", "cudatoolkit"}},
+		{
+			[]string{DefaultGraph.VSCodePlugins[0].String(), DefaultGraph.VSCodePlugins[1].String()},
+			[]string{"ms-python.python-2023.4.1@linux-x64", "eamodio.gitlens-12.0.0"},
+		},
+	}
+	for _, tc := range testcases {
+		if !reflect.DeepEqual(tc.actual, tc.expected) {
+			t.Errorf("expected %v, got %v", tc.expected, tc.actual)
+		}
+	}
+	if DefaultGraph.VSCodePlugins[0].SHA256 != "digest-of-python" || DefaultGraph.VSCodePlugins[1].SHA256 != "" {
+		t.Errorf("expected the digest of the locked version only, got %v", DefaultGraph.VSCodePlugins)
+	}
+	if _, ok := DefaultGraph.pipConstraints(); !ok {
+		t.Errorf("expected the pip constraints from the lock")
+	}
+}
+
+func TestLockAdd(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	DefaultGraph.CondaConfig = &CondaConfig{CondaPackages: []string{"pytorch"}}
+
+	l := Lock{Version: LockVersion}
+	if err := l.Add(LockKindAPT, "htop 3.0.5-7build2\n"); err != nil {
+		t.Fatalf("failed to add the apt packages: %v", err)
+	}
+	if err := l.Add(LockKindPyPI, "numpy==1.23.4\nScikit_Learn==1.1.3\n-e git+https://x#egg=y\n"); err != nil {
+		t.Fatalf("failed to add the PyPI packages: %v", err)
+	}
+	if err := l.Add(LockKindConda,
+		`[{"name": "pytorch", "version": "1.12.1"}, {"name": "mkl", "version": "2022.1.0"}]`); err != nil {
+		t.Fatalf("failed to add the conda packages: %v", err)
+	}
+	expected := Lock{
+		Version: LockVersion,
+		APT:     map[string]string{"htop": "3.0.5-7build2"},
+		PyPI:    map[string]string{"numpy": "1.23.4", "scikit-learn": "1.1.3"},
+		Conda:   map[string]string{"pytorch": "1.12.1"},
+	}
+	if !reflect.DeepEqual(l, expected) {
+		t.Errorf("expected %v, got %v", expected, l)
+	}
+	if err := l.Add(LockKindAPT, "htop\n"); err == nil {
+		t.Errorf("expected the error of the invalid apt output")
+	}
+
+	filename := filepath.Join(t.TempDir(), LockFileName)
+	if err := l.Write(filename); err != nil {
+		t.Fatalf("failed to write the lockfile: %v", err)
+	}
+	loaded, err := LoadLock(filename)
+	if err != nil {
+		t.Fatalf("failed to load the lockfile: %v", err)
+	}
+	if !reflect.DeepEqual(*loaded, expected) {
+		t.Errorf("expected %v, got %v", expected, *loaded)
+	}
+}
+
+func TestCheckPipLock(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	DefaultGraph.PyPIPackages = []string{"numpy", "torch>=1.12"}
+	PipLock(true, true)
+
+	if err := CheckPipLock(); err == nil {
+		t.Errorf("expected error without the lock")
+	}
+	UseLock(&Lock{
+		Version: LockVersion,
+		PyPI:    map[string]string{"numpy": "1.23.4", "torch": "1.13.0"},
+	})
+	if err := CheckPipLock(); err == nil {
+		t.Errorf("expected error without the hashes")
+	}
+	DefaultGraph.Lock.PyPIHashes = map[string][]string{"numpy": {"aaa"}}
+	if err := CheckPipLock(); err != nil {
+		t.Errorf("failed to check the lock: %v", err)
+	}
+	DefaultGraph.PyPIPackages = append(DefaultGraph.PyPIPackages, "black")
+	if err := CheckPipLock(); err == nil {
+		t.Errorf("expected error for the package which is not locked")
+	}
+}
+
+func TestPipLockRequirements(t *testing.T) {
+	g := NewGraph()
+	g.PythonWheels = []string{"dist/envd-0.3.0-py3-none-any.whl"}
+	g.PipLockConfig = &PipLockConfig{RequireHashes: true, NoDeps: true}
+	g.Lock = &Lock{
+		Version: LockVersion,
+		PyPI:    map[string]string{"numpy": "1.23.4", "torch": "1.13.0", "mkl-fft": "1.3.1", "envd": "0.3.0"},
+		PyPIHashes: map[string][]string{
+			"numpy": {"aaa", "bbb"},
+			"torch": {"ccc"},
+			"envd":  {"ddd"},
+		},
+	}
+	expected := "numpy==1.23.4 \\\n    --hash=sha256:aaa \\\n    --hash=sha256:bbb\n" +
+		"torch==1.13.0 \\\n    --hash=sha256:ccc\n"
+	if actual := g.pipLockRequirements(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	expectedArgs := []string{"/opt/conda/envs/envd/bin/python", "-m", "pip", "install",
+		"--no-deps", "--require-hashes", "-r", pipConstraintsDir + "/requirements.txt"}
+	if actual := g.pipLockArgs(); !reflect.DeepEqual(actual, expectedArgs) {
+		t.Errorf("expected %v, got %v", expectedArgs, actual)
+	}
+
+	g.PipLockConfig = &PipLockConfig{NoDeps: true}
+	expected = "mkl-fft==1.3.1\nnumpy==1.23.4\ntorch==1.13.0\n"
+	if actual := g.pipLockRequirements(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import "testing"
+
+func TestRuntimeLogForward(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	for _, target := range []string{"", "journald", "udp://logs.example.com:514",
+		"tcp+tls://logs.example.com:6514", "unix:///dev/log"} {
+		if err := RuntimeLogForward(target); err != nil {
+			t.Errorf("failed to forward the logs to %q: %v", target, err)
+		}
+		if DefaultGraph.RuntimeLogForward != target {
+			t.Errorf("expected %q, got %q", target, DefaultGraph.RuntimeLogForward)
+		}
+	}
+	for _, target := range []string{"syslog", "logs.example.com:514", "http://logs.example.com"} {
+		if err := RuntimeLogForward(target); err == nil {
+			t.Errorf("expected the error for %q", target)
+		}
+	}
+}
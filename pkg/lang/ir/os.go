@@ -0,0 +1,140 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/viper"
+
+	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/version"
+)
+
+const (
+	osFamilyUbuntu = "ubuntu"
+	osFamilyDebian = "debian"
+)
+
+// supportedOS maps the supported OS families and versions to the base
+// images of the python environments.
+var supportedOS = map[string]map[string]string{
+	osFamilyUbuntu: {
+		"18.04": "ubuntu:18.04",
+		"20.04": "ubuntu:20.04",
+		"22.04": "ubuntu:22.04",
+	},
+	osFamilyDebian: {
+		"11": "debian:11",
+	},
+}
+
+// e.g. ubuntu20.04, debian11
+var osPattern = regexp.MustCompile(`^([a-z]+)([0-9][0-9.]*)$`)
+
+// OS sets the OS family and version of the base image, e.g. ubuntu 22.04.
+func OS(name, version string) error {
+	name = strings.ToLower(name)
+	if err := validateOS(name, version); err != nil {
+		return err
+	}
+	DefaultGraph.OS = name + version
+	return nil
+}
+
+// parseOS splits the OS in the graph, e.g. ubuntu20.04, into the family
+// and the version.
+func parseOS(os string) (string, string, error) {
+	matches := osPattern.FindStringSubmatch(strings.ToLower(os))
+	if matches == nil {
+		return "", "", errors.Newf("invalid os %s, expected the family and the version, e.g. %s",
+			os, osDefault)
+	}
+	if err := validateOS(matches[1], matches[2]); err != nil {
+		return "", "", err
+	}
+	return matches[1], matches[2], nil
+}
+
+func validateOS(name, version string) error {
+	versions, ok := supportedOS[name]
+	if !ok {
+		return errors.Newf("os %s is not supported, expected ubuntu or debian", name)
+	}
+	if _, ok := versions[version]; !ok {
+		supported := make([]string, 0, len(versions))
+		for v := range versions {
+			supported = append(supported, v)
+		}
+		sort.Strings(supported)
+		return errors.Newf("%s %s is not supported, expected one of %s",
+			name, version, strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// osImage returns the base image of the python environment.
+func (g Graph) osImage() (string, error) {
+	family, version, err := parseOS(g.OS)
+	if err != nil {
+		return "", err
+	}
+	return supportedOS[family][version], nil
+}
+
+// baseImage returns the image which the environment is built on.
+func (g Graph) baseImage() (string, error) {
+	org := viper.GetString(flag.FlagDockerOrganization)
+	v := version.GetVersionForImageTag()
+	switch {
+	case g.Image != nil:
+		return *g.Image, nil
+	case g.BaseDockerfile != nil:
+		return g.BaseDockerfile.Image, nil
+	case g.CUDA != nil:
+		return fmt.Sprintf("docker.io/nvidia/cuda:%s-cudnn%s-devel-%s", *g.CUDA, g.CUDNN, g.OS), nil
+	case g.Language.Name == "r":
+		return fmt.Sprintf("docker.io/%s/r-base:4.2-envd-%s", org, v), nil
+	case g.Language.Name == "julia":
+		return fmt.Sprintf("docker.io/%s/julia:1.8rc1-ubuntu20.04-envd-%s", org, v), nil
+	default:
+		return g.osImage()
+	}
+}
+
+// validateOSCombination checks the OS against the other parts of the base
+// image. The custom image is not checked since the OS is not used.
+func (g Graph) validateOSCombination() error {
+	if g.Image != nil {
+		return nil
+	}
+	family, _, err := parseOS(g.OS)
+	if err != nil {
+		return err
+	}
+	if g.CUDA != nil && family != osFamilyUbuntu {
+		return errors.Newf("CUDA is only supported on ubuntu, got %s", g.OS)
+	}
+	if g.CUDA == nil && (g.Language.Name == "r" || g.Language.Name == "julia") &&
+		g.OS != osDefault {
+		return errors.Newf("%s is only supported on %s, got %s",
+			g.Language.Name, osDefault, g.OS)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import "testing"
+
+func TestOS(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	if err := OS("Ubuntu", "22.04"); err != nil {
+		t.Fatalf("failed to set the os: %v", err)
+	}
+	if DefaultGraph.OS != "ubuntu22.04" {
+		t.Errorf("expected ubuntu22.04, got %s", DefaultGraph.OS)
+	}
+	if image, err := DefaultGraph.osImage(); err != nil || image != "ubuntu:22.04" {
+		t.Errorf("expected ubuntu:22.04, got %s, %v", image, err)
+	}
+
+	for _, tc := range []struct{ name, version string }{
+		{"ubuntu", "16.04"},
+		{"centos", "7"},
+		{"debian", ""},
+	} {
+		if err := OS(tc.name, tc.version); err == nil {
+			t.Errorf("expected the error for %s %s", tc.name, tc.version)
+		}
+	}
+}
+
+func TestParseOS(t *testing.T) {
+	testcases := []struct {
+		os      string
+		family  string
+		version string
+		valid   bool
+	}{
+		{"ubuntu20.04", "ubuntu", "20.04", true},
+		{"debian11", "debian", "11", true},
+		{"ubuntu", "", "", false},
+		{"ubuntu21.10", "", "", false},
+	}
+	for _, tc := range testcases {
+		family, version, err := parseOS(tc.os)
+		if (err == nil) != tc.valid {
+			t.Errorf("parseOS(%s) = %v, expected valid %t", tc.os, err, tc.valid)
+			continue
+		}
+		if family != tc.family || version != tc.version {
+			t.Errorf("parseOS(%s) = %s, %s, expected %s, %s",
+				tc.os, family, version, tc.family, tc.version)
+		}
+	}
+}
+
+func TestValidateOSCombination(t *testing.T) {
+	cuda := "11.6"
+	testcases := []struct {
+		graph Graph
+		valid bool
+	}{
+		{Graph{OS: "ubuntu22.04", Language: Language{Name: "python"}, CUDA: &cuda}, true},
+		{Graph{OS: "debian11", Language: Language{Name: "python"}}, true},
+		{Graph{OS: "debian11", Language: Language{Name: "python"}, CUDA: &cuda}, false},
+		{Graph{OS: "ubuntu22.04", Language: Language{Name: "r"}}, false},
+		{Graph{OS: "ubuntu20.04", Language: Language{Name: "julia"}}, true},
+	}
+	for _, tc := range testcases {
+		if err := tc.graph.validateOSCombination(); (err == nil) != tc.valid {
+			t.Errorf("validateOSCombination(%s, %s) = %v, expected valid %t",
+				tc.graph.OS, tc.graph.Language.Name, err, tc.valid)
+		}
+	}
+}
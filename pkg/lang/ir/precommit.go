@@ -0,0 +1,78 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+// PreCommitHome is the cache dir of pre-commit, in which the environments
+// of the hooks are installed. envd up mounts a volume shared by all the
+// environments there.
+var PreCommitHome = fileutil.EnvdHomeDir(".cache", "pre-commit")
+
+type PreCommitConfig struct {
+	// InstallHooks runs pre-commit install in the workspace at startup.
+	InstallHooks bool
+}
+
+func PreCommit(installHooks bool) {
+	DefaultGraph.PreCommitConfig = &PreCommitConfig{
+		InstallHooks: installHooks,
+	}
+}
+
+func (g *Graph) compilePreCommit() error {
+	if g.PreCommitConfig == nil {
+		return nil
+	}
+	if g.Image != nil {
+		return errors.New("install.pre_commit is not supported in the custom base image")
+	}
+
+	// Copy the slice, thus the graph being compiled is not modified.
+	g.PyPIPackages = append(append([]string{}, g.PyPIPackages...), "pre-commit")
+	switch g.Language.Name {
+	case "python":
+		return nil
+	default:
+		return errors.Newf("pre-commit is not supported in %s yet", g.Language.Name)
+	}
+}
+
+// compilePreCommitHome creates the cache dir owned by the user, thus the
+// volume created from it is writable.
+func (g Graph) compilePreCommitHome(root llb.State) llb.State {
+	if g.PreCommitConfig == nil {
+		return root
+	}
+	return root.File(llb.Mkdir(PreCommitHome, 0755, llb.WithParents(true),
+		llb.WithUIDGID(g.uid, g.gid)),
+		llb.WithCustomName("[internal] create the pre-commit cache dir"))
+}
+
+// preCommitInstallCommand installs the hooks if the workspace is configured
+// with pre-commit. The failure is not fatal, e.g. the workspace may not be
+// a git repo.
+func (g Graph) preCommitInstallCommand(workingDir string) string {
+	return fmt.Sprintf("if [ -f %[1]s/.pre-commit-config.yaml ]; then "+
+		"(cd %[1]s && python3 -m pre_commit install) || "+
+		"echo 'failed to install the pre-commit hooks' >&2; fi", workingDir)
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreCommit(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	DefaultGraph.PyPIPackages = []string{"numpy"}
+	PreCommit(true)
+
+	g := *DefaultGraph
+	if err := g.compilePreCommit(); err != nil {
+		t.Fatalf("failed to compile pre-commit: %v", err)
+	}
+	if len(g.PyPIPackages) != 2 || g.PyPIPackages[1] != "pre-commit" {
+		t.Errorf("expected pre-commit in the PyPI packages, got %v", g.PyPIPackages)
+	}
+	if len(DefaultGraph.PyPIPackages) != 1 {
+		t.Errorf("expected the default graph is not modified, got %v", DefaultGraph.PyPIPackages)
+	}
+
+	DefaultGraph.EnvironmentName = "test"
+	script := DefaultGraph.EntrypointScript()
+	expected := "(cd /home/envd/test && python3 -m pre_commit install)"
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected %q in the entrypoint script:\n%s", expected, script)
+	}
+
+	g = *DefaultGraph
+	g.Language.Name = "r"
+	if err := g.compilePreCommit(); err == nil {
+		t.Errorf("expected the error of pre-commit in r")
+	}
+
+	g = *DefaultGraph
+	image := "ubuntu:20.04"
+	g.Image = &image
+	if err := g.compilePreCommit(); err == nil {
+		t.Errorf("expected the error of pre-commit in the custom base image")
+	}
+}
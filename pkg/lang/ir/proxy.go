@@ -0,0 +1,96 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/util/netutil"
+)
+
+// proxyEnv returns the proxy environment variables in both the lower
+// and upper case, since tools differ in which one they respect.
+func (g Graph) proxyEnv() map[string]string {
+	env := make(map[string]string)
+	if g.ProxyConfig == nil {
+		return env
+	}
+	for k, v := range map[string]string{
+		"http_proxy":  g.ProxyConfig.HTTPProxy,
+		"https_proxy": g.ProxyConfig.HTTPSProxy,
+		"no_proxy":    g.ProxyConfig.NoProxy,
+	} {
+		if v == "" {
+			continue
+		}
+		env[k] = v
+		env[strings.ToUpper(k)] = v
+	}
+	return env
+}
+
+// compileProxy sets the proxy env for all the following build steps,
+// e.g. apt, pip and conda. It does not affect the image config.
+// The apt proxy and the PyPI proxy are set by APT_CONFIG and PIP_INDEX_URL
+// in the same way.
+func (g Graph) compileProxy(root llb.State) llb.State {
+	env := g.proxyEnv()
+	// Keep the order stable, or the llb cache is invalidated.
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		root = root.AddEnv(k, env[k])
+	}
+	if g.ProxyConfig != nil && g.ProxyConfig.PyPIProxy != "" && g.PyPIIndexURL == nil {
+		// The env takes precedence over /etc/pip.conf, and is not kept in the image.
+		root = root.AddEnv("PIP_INDEX_URL", g.ProxyConfig.PyPIProxy)
+		if u, err := url.Parse(g.ProxyConfig.PyPIProxy); err == nil {
+			root = root.AddEnv("PIP_TRUSTED_HOST", u.Host)
+		}
+	}
+	if g.ProxyConfig != nil && g.ProxyConfig.APTProxy != "" {
+		conf := fmt.Sprintf("Acquire::http::Proxy \"%s\";\n", g.ProxyConfig.APTProxy)
+		root = root.
+			File(llb.Mkdir(filepath.Dir(aptProxyFilePath), 0755, llb.WithParents(true)),
+				llb.WithCustomName("[internal] setting apt proxy")).
+			File(llb.Mkfile(aptProxyFilePath, 0644, []byte(conf)),
+				llb.WithCustomName("[internal] setting apt proxy")).
+			AddEnv("APT_CONFIG", aptProxyFilePath)
+	}
+	return root
+}
+
+// HTTPClient returns the client for the downloads on the host side,
+// e.g. oh-my-zsh and vscode extensions, which respects config.proxy.
+func (g Graph) HTTPClient() *http.Client {
+	if g.ProxyConfig == nil {
+		return netutil.Proxy{}.HTTPClient()
+	}
+	return netutil.Proxy{
+		HTTPProxy:  g.ProxyConfig.HTTPProxy,
+		HTTPSProxy: g.ProxyConfig.HTTPSProxy,
+		NoProxy:    g.ProxyConfig.NoProxy,
+	}.HTTPClient()
+}
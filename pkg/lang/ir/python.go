@@ -15,15 +15,16 @@
 package ir
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
 
 	"github.com/cockroachdb/errors"
 	"github.com/moby/buildkit/client/llb"
-	"github.com/sirupsen/logrus"
 
 	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 const (
@@ -45,7 +46,7 @@ func (g Graph) getAppropriatePythonVersion() (string, error) {
 	return "", errors.Errorf("python version %s is not supported", version)
 }
 
-func (g Graph) compilePython(aptStage llb.State) (llb.State, error) {
+func (g Graph) compilePython(ctx context.Context, aptStage llb.State) (llb.State, error) {
 	condaChanelStage := g.compileCondaChannel(aptStage)
 	pypiMirrorStage := g.compilePyPIIndex(condaChanelStage)
 
@@ -61,7 +62,7 @@ func (g Graph) compilePython(aptStage llb.State) (llb.State, error) {
 	diffSSHStage := llb.Diff(builtinSystemStage, sshStage, llb.WithCustomName("install ssh keys"))
 
 	// Conda affects shell and python, thus we cannot do it in parallel.
-	shellStage, err := g.compileShell(builtinSystemStage)
+	shellStage, err := g.compileShell(ctx, builtinSystemStage)
 	if err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to compile shell")
 	}
@@ -81,7 +82,7 @@ func (g Graph) compilePython(aptStage llb.State) (llb.State, error) {
 	systemStage := llb.Diff(builtinSystemStage, g.compileSystemPackages(builtinSystemStage),
 		llb.WithCustomName("install system packages"))
 
-	vscodeStage, err := g.compileVSCode()
+	vscodeStage, err := g.compileVSCode(ctx)
 	if err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to get vscode plugins")
 	}
@@ -113,8 +114,57 @@ func (g Graph) compileAlternative(root llb.State) llb.State {
 	return run.Root()
 }
 
+// pipInstallArgs returns the argv of the pip install command. The package
+// specs are passed as they are, thus the specs like "pkg[extra]>=1.0,<2"
+// are not interpreted by a shell.
+func pipInstallArgs(pkgs []string, constraints bool) []string {
+	// Always use the conda's pip.
+	args := []string{"/opt/conda/envs/envd/bin/python", "-m", "pip", "install"}
+	if constraints {
+		args = append(args, "-c", filepath.Join(pipConstraintsDir, "constraints.txt"))
+	}
+	return append(args, pkgs...)
+}
+
+// compilePipInstall installs the PyPI packages with the pip cache mounted.
+func (g Graph) compilePipInstall(root, cache llb.State, cacheDir string, pkgs []string) llb.State {
+	constraints, locked := g.pipConstraints()
+	args := pipInstallArgs(pkgs, locked)
+	log.WithField("command", args).
+		Debug("Configure pip install statements")
+	run := root.
+		Run(llb.Args(g.withTimeout(args)), llb.WithCustomNamef("pip install %s",
+			strings.Join(pkgs, " ")), g.sourceLocation(rulePyPIPackages))
+	if locked {
+		run.AddMount(pipConstraintsDir, constraints, llb.Readonly)
+	}
+	// Refer to https://github.com/moby/buildkit/blob/31054718bf775bf32d1376fe1f3611985f837584/frontend/dockerfile/dockerfile2llb/convert_runmount.go#L46
+	run.AddMount(cacheDir, cache,
+		llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared), llb.SourcePath("/cache/pip"))
+	return run.Root()
+}
+
+// compilePipLockInstall installs all the PyPI packages in the lock, see
+// config.pip_lock.
+func (g Graph) compilePipLockInstall(root, cache llb.State, cacheDir string) llb.State {
+	args := g.pipLockArgs()
+	log.WithField("command", args).
+		Debug("Configure pip install statements from the lockfile")
+	run := root.
+		Run(llb.Args(g.withTimeout(args)), llb.WithCustomName("pip install from the lockfile"),
+			g.sourceLocation(rulePyPIPackages))
+	requirements := llb.Scratch().File(
+		llb.Mkfile("/requirements.txt", 0644, []byte(g.pipLockRequirements())),
+		llb.WithCustomName("[internal] generating pip requirements from the lockfile"))
+	run.AddMount(pipConstraintsDir, requirements, llb.Readonly)
+	run.AddMount(cacheDir, cache,
+		llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared), llb.SourcePath("/cache/pip"))
+	return run.Root()
+}
+
 func (g Graph) compilePyPIPackages(root llb.State) llb.State {
-	if len(g.PyPIPackages) == 0 && g.RequirementsFile == nil && len(g.PythonWheels) == 0 {
+	if len(g.PyPIPackages) == 0 && g.RequirementsFile == nil &&
+		g.PipfileFile == nil && len(g.PythonWheels) == 0 {
 		return root
 	}
 
@@ -125,59 +175,52 @@ func (g Graph) compilePyPIPackages(root llb.State) llb.State {
 	cache := root.File(llb.Mkdir("/cache/pip", 0755, llb.WithParents(true)),
 		llb.WithCustomName("[internal] setting pip cache mount permissions"))
 
-	if len(g.PyPIPackages) != 0 {
-		// Compose the package install command.
-		var sb strings.Builder
-		// Always use the conda's pip.
-		sb.WriteString("/opt/conda/envs/envd/bin/python -m pip install")
-		for _, pkg := range g.PyPIPackages {
-			sb.WriteString(fmt.Sprintf(" %s", pkg))
+	layered := make(map[string]bool)
+	for _, layer := range g.PyPILayers {
+		for _, pkg := range layer {
+			layered[pkg] = true
+		}
+	}
+	shared := []string{}
+	for _, pkg := range g.PyPIPackages {
+		if !layered[pkg] {
+			shared = append(shared, pkg)
 		}
+	}
 
-		cmd := sb.String()
-		logrus.WithField("command", cmd).
-			Debug("Configure pip install statements")
-		run := root.
-			Run(llb.Shlex(sb.String()), llb.WithCustomNamef("pip install %s",
-				strings.Join(g.PyPIPackages, " ")))
-		// Refer to https://github.com/moby/buildkit/blob/31054718bf775bf32d1376fe1f3611985f837584/frontend/dockerfile/dockerfile2llb/convert_runmount.go#L46
-		run.AddMount(cacheDir, cache,
-			llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared), llb.SourcePath("/cache/pip"))
-		root = run.Root()
+	base := root
+	if g.pipLocked() {
+		root = g.compilePipLockInstall(root, cache, cacheDir)
+	} else if len(shared) != 0 {
+		root = g.compilePipInstall(root, cache, cacheDir, shared)
+	}
+	if len(g.PyPILayers) != 0 && !g.pipLocked() {
+		// Every layer is installed on the same base, thus it is only
+		// rebuilt when its own packages change.
+		inputs := []llb.State{root}
+		for _, layer := range g.PyPILayers {
+			inputs = append(inputs, llb.Diff(base,
+				g.compilePipInstall(base, cache, cacheDir, layer),
+				llb.WithCustomNamef("[internal] PyPI layer %s", strings.Join(layer, " "))))
+		}
+		root = llb.Merge(inputs, llb.WithCustomName("[internal] merging PyPI layers"))
 	}
 
 	if g.RequirementsFile != nil {
-		// Compose the package install command.
-		var sb strings.Builder
-		sb.WriteString("bash -c '")
-		sb.WriteString("set -euo pipefail\n")
-		sb.WriteString(fmt.Sprintf("chown -R envd:envd %s\n", g.getWorkingDir())) // Change mount dir permission
-		envdCmd := strings.Builder{}
-		envdCmd.WriteString(fmt.Sprintf("cd %s\n", g.getWorkingDir()))
-		envdCmd.WriteString(fmt.Sprintf("/opt/conda/envs/envd/bin/python -m pip install -r  %s\n", *g.RequirementsFile))
-
-		// Execute the command to write yaml file and conda env using envd user
-		sb.WriteString(fmt.Sprintf("sudo -i -u envd bash << EOF\n%s\nEOF\n", envdCmd.String()))
-		sb.WriteString("'")
-		cmd := sb.String()
-
-		logrus.WithField("command", cmd).
-			Debug("Configure pip install requirements statements")
-		root = root.User("root").Dir(g.getWorkingDir())
-		run := root.
-			Run(llb.Shlex(cmd), llb.WithCustomNamef("pip install %s", *g.RequirementsFile))
-		run.AddMount(cacheDir, cache,
-			llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared), llb.SourcePath("/cache/pip"))
-		run.AddMount(g.getWorkingDir(),
-			llb.Local(flag.FlagBuildContext))
-		root = run.Root()
+		root = g.compileEnvdUserInstall(root, cache, cacheDir,
+			fmt.Sprintf("/opt/conda/envs/envd/bin/python -m pip install -r  %s\n", *g.RequirementsFile),
+			fmt.Sprintf("pip install %s", *g.RequirementsFile))
+	}
+
+	if g.PipfileFile != nil {
+		root = g.compilePipfile(root, cache, cacheDir)
 	}
 
 	if len(g.PythonWheels) > 0 {
 		root = root.Dir(g.getWorkingDir())
-		cmdTemplate := "/opt/conda/envs/envd/bin/python -m pip install %s"
 		for _, wheel := range g.PythonWheels {
-			run := root.Run(llb.Shlex(fmt.Sprintf(cmdTemplate, wheel)), llb.WithCustomNamef("pip install %s", wheel))
+			run := root.Run(llb.Args(g.withTimeout(pipInstallArgs([]string{wheel}, false))),
+				llb.WithCustomNamef("pip install %s", wheel))
 			run.AddMount(g.getWorkingDir(), llb.Local(flag.FlagBuildContext), llb.Readonly)
 			run.AddMount(cacheDir, cache,
 				llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared), llb.SourcePath("/cache/pip"))
@@ -187,12 +230,56 @@ func (g Graph) compilePyPIPackages(root llb.State) llb.State {
 	return root
 }
 
+// compilePipfile installs the packages declared in the Pipfile into the envd
+// python environment. Pipfile.lock is respected if it exists next to the
+// Pipfile, otherwise the Pipfile is resolved without locking.
+func (g Graph) compilePipfile(root, cache llb.State, cacheDir string) llb.State {
+	pipfile := *g.PipfileFile
+	var sb strings.Builder
+	// pipenv installs into the python found in PATH when --system is used.
+	sb.WriteString("export PATH=/opt/conda/envs/envd/bin:$PATH\n")
+	sb.WriteString(fmt.Sprintf("export PIPENV_PIPFILE=%s\n", pipfile))
+	sb.WriteString("python -m pip install pipenv\n")
+	sb.WriteString(fmt.Sprintf(
+		"if [ -f %s.lock ]; then python -m pipenv install --system --deploy; "+
+			"else python -m pipenv install --system --skip-lock; fi\n", pipfile))
+	return g.compileEnvdUserInstall(root, cache, cacheDir, sb.String(),
+		fmt.Sprintf("pipenv install %s", pipfile))
+}
+
+// compileEnvdUserInstall runs the install script as the envd user in the
+// working dir, with the build context and the pip cache mounted, e.g. for
+// the requirements file and the Pipfile.
+func (g Graph) compileEnvdUserInstall(root, cache llb.State, cacheDir,
+	script, name string) llb.State {
+	var sb strings.Builder
+	sb.WriteString("bash -c '")
+	sb.WriteString("set -euo pipefail\n")
+	sb.WriteString(fmt.Sprintf("chown -R envd:envd %s\n", g.getWorkingDir())) // Change mount dir permission
+	// Execute the command to install packages using envd user
+	sb.WriteString(fmt.Sprintf("sudo -i -u envd bash << EOF\ncd %s\n%s\nEOF\n",
+		g.getWorkingDir(), script))
+	sb.WriteString("'")
+	cmd := g.withTimeoutCommand(sb.String())
+
+	log.WithField("command", cmd).
+		Debugf("Configure %s statements", name)
+	root = root.User("root").Dir(g.getWorkingDir())
+	run := root.
+		Run(llb.Shlex(cmd), llb.WithCustomName(name), g.sourceLocation(rulePyPIPackages))
+	run.AddMount(cacheDir, cache,
+		llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared), llb.SourcePath("/cache/pip"))
+	run.AddMount(g.getWorkingDir(),
+		llb.Local(flag.FlagBuildContext))
+	return run.Root()
+}
+
 func (g Graph) compilePyPIIndex(root llb.State) llb.State {
 	if g.PyPIIndexURL != nil {
-		logrus.WithField("index", *g.PyPIIndexURL).Debug("using custom PyPI index")
+		log.WithField("index", *g.PyPIIndexURL).Debug("using custom PyPI index")
 		var extraIndex string
 		if g.PyPIExtraIndexURL != nil {
-			logrus.WithField("index", *g.PyPIIndexURL).Debug("using extra PyPI index")
+			log.WithField("index", *g.PyPIIndexURL).Debug("using extra PyPI index")
 			extraIndex = "extra-index-url=" + *g.PyPIExtraIndexURL
 		}
 		content := fmt.Sprintf(pypiConfigTemplate, *g.PyPIIndexURL, extraIndex)
@@ -0,0 +1,142 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+)
+
+func TestCompilePyPILayers(t *testing.T) {
+	g := Graph{
+		PyPIPackages: []string{"numpy", "torch", "transformers"},
+		PyPILayers:   [][]string{{"torch"}, {"transformers"}},
+	}
+	def, err := g.compilePyPIPackages(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+
+	names := make(map[string]bool)
+	diffs, merges := 0, 0
+	for _, v := range vertices {
+		names[v.Name] = true
+		switch v.Op {
+		case "diff":
+			diffs++
+		case "merge":
+			merges++
+		}
+	}
+	for _, expected := range []string{
+		"pip install numpy", "pip install torch", "pip install transformers",
+	} {
+		if !names[expected] {
+			t.Errorf("expected the step %q, got %v", expected, names)
+		}
+	}
+	if diffs != 2 || merges != 1 {
+		t.Errorf("expected 2 diffs and 1 merge, got %d diffs and %d merges", diffs, merges)
+	}
+}
+
+func TestCompilePipfile(t *testing.T) {
+	pipfile := "Pipfile"
+	g := Graph{
+		PipfileFile:       &pipfile,
+		StageLimitsConfig: &StageLimitsConfig{StageTimeout: time.Minute},
+	}
+	def, err := g.compilePyPIPackages(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	var pipenv *pb.ExecOp
+	for _, dt := range def.Def {
+		var op pb.Op
+		if err := op.Unmarshal(dt); err != nil {
+			t.Fatalf("failed to unmarshal the op: %v", err)
+		}
+		if e := op.GetExec(); e != nil &&
+			strings.Contains(strings.Join(e.Meta.Args, " "), "pipenv install --system") {
+			pipenv = e
+		}
+	}
+	if pipenv == nil {
+		t.Fatalf("expected the exec of pipenv install")
+	}
+	if pipenv.Meta.Args[0] != "timeout" {
+		t.Errorf("expected the stage timeout, got %v", pipenv.Meta.Args)
+	}
+	args := strings.Join(pipenv.Meta.Args, " ")
+	for _, expected := range []string{
+		"export PIPENV_PIPFILE=Pipfile",
+		"if [ -f Pipfile.lock ]; then python -m pipenv install --system --deploy;",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("expected %q in the command, got %s", expected, args)
+		}
+	}
+	// The build context and the pip cache.
+	if len(pipenv.Mounts) != 3 {
+		t.Errorf("expected the build context and the cache mounted, got %v", pipenv.Mounts)
+	}
+}
+
+func TestPipInstallArgs(t *testing.T) {
+	pkgs := []string{"package[extra]>=1.0,<2", "torch"}
+	expected := []string{"/opt/conda/envs/envd/bin/python", "-m", "pip", "install",
+		"package[extra]>=1.0,<2", "torch"}
+	if actual := pipInstallArgs(pkgs, false); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	expected = []string{"/opt/conda/envs/envd/bin/python", "-m", "pip", "install",
+		"-c", pipConstraintsDir + "/constraints.txt", "package[extra]>=1.0,<2", "torch"}
+	if actual := pipInstallArgs(pkgs, true); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestCompilePipInstallSpecs(t *testing.T) {
+	g := Graph{PyPIPackages: []string{"package[extra]>=1.0,<2"}}
+	def, err := g.compilePyPIPackages(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	expected := "exec /opt/conda/envs/envd/bin/python -m pip install package[extra]>=1.0,<2"
+	for _, v := range vertices {
+		if v.Op == expected {
+			return
+		}
+	}
+	t.Errorf("expected the op %q, got %v", expected, vertices)
+}
@@ -15,6 +15,7 @@
 package ir
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -22,7 +23,7 @@ import (
 	"github.com/moby/buildkit/client/llb"
 )
 
-func (g Graph) compileRLang(aptStage llb.State) (llb.State, error) {
+func (g Graph) compileRLang(ctx context.Context, aptStage llb.State) (llb.State, error) {
 	if err := g.compileJupyter(); err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to compile jupyter")
 	}
@@ -35,7 +36,7 @@ func (g Graph) compileRLang(aptStage llb.State) (llb.State, error) {
 	diffSSHStage := llb.Diff(builtinSystemStage, sshStage, llb.WithCustomName("install ssh keys"))
 
 	// Conda affects shell and python, thus we cannot do it in parallel.
-	shellStage, err := g.compileShell(builtinSystemStage)
+	shellStage, err := g.compileShell(ctx, builtinSystemStage)
 	if err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to compile shell")
 	}
@@ -48,7 +49,7 @@ func (g Graph) compileRLang(aptStage llb.State) (llb.State, error) {
 	rPackageInstallStage := llb.Diff(builtinSystemStage,
 		g.installRPackages(builtinSystemStage), llb.WithCustomName("install R packages"))
 
-	vscodeStage, err := g.compileVSCode()
+	vscodeStage, err := g.compileVSCode(ctx)
 	if err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to get vscode plugins")
 	}
@@ -90,6 +91,7 @@ func (g Graph) installRPackages(root llb.State) llb.State {
 	// TODO(terrytangyuan): Support cache.
 	cmd := sb.String()
 	root = llb.User("envd")(root)
-	run := root.Run(llb.Shlex(cmd), llb.WithCustomNamef("install R packages"))
+	run := root.Run(llb.Shlex(g.withTimeoutCommand(cmd)), llb.WithCustomNamef("install R packages"),
+		g.sourceLocation(ruleRPackages))
 	return run.Root()
 }
@@ -0,0 +1,69 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+// Reproducible pins the timestamps in the build to the epoch, and sorts the
+// package lists, thus the builds of the same manifest produce the same image.
+// The wheels are installed in the order given, e.g. the dependencies first,
+// thus they are not sorted.
+func Reproducible(epoch int64) {
+	DefaultGraph.SourceDateEpoch = &epoch
+	for _, pkgs := range [][]string{
+		DefaultGraph.SystemPackages,
+		DefaultGraph.PyPIPackages,
+		DefaultGraph.RPackages,
+		DefaultGraph.JuliaPackages,
+	} {
+		sort.Strings(pkgs)
+	}
+	sort.Slice(DefaultGraph.VSCodePlugins, func(i, j int) bool {
+		return DefaultGraph.VSCodePlugins[i].String() < DefaultGraph.VSCodePlugins[j].String()
+	})
+}
+
+// compileSourceDateEpoch sets SOURCE_DATE_EPOCH for the following build
+// steps, which is respected by most of the package managers.
+func (g Graph) compileSourceDateEpoch(root llb.State) llb.State {
+	if g.SourceDateEpoch == nil {
+		return root
+	}
+	return root.AddEnv("SOURCE_DATE_EPOCH", strconv.FormatInt(*g.SourceDateEpoch, 10))
+}
+
+// compileReproducible clamps the mtime of the files changed in the build to
+// the epoch, and squashes the image into one layer since buildkit keeps the
+// mtime in the layers of the intermediate steps.
+func (g Graph) compileReproducible(root llb.State) llb.State {
+	if g.SourceDateEpoch == nil {
+		return root
+	}
+	cmd := fmt.Sprintf("find / -xdev "+
+		"\\( -path /proc -o -path /sys -o -path /dev "+
+		"-o -path /etc/hosts -o -path /etc/hostname -o -path /etc/resolv.conf \\) -prune "+
+		"-o -newermt @%[1]d -exec touch --no-dereference --date=@%[1]d {} +",
+		*g.SourceDateEpoch)
+	clamped := root.Run(llb.Args([]string{"/bin/sh", "-c", cmd}), llb.User("root"),
+		llb.WithCustomNamef("[internal] clamping mtime to %d", *g.SourceDateEpoch)).Root()
+	return llb.Diff(llb.Scratch(), clamped,
+		llb.WithCustomName("[internal] squashing the image"))
+}
@@ -0,0 +1,42 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReproducible(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+	DefaultGraph.SystemPackages = []string{"vim", "htop", "curl"}
+	DefaultGraph.PyPIPackages = []string{"torch", "numpy"}
+	DefaultGraph.PythonWheels = []string{"dep.whl", "app.whl"}
+
+	Reproducible(1660000000)
+	if *DefaultGraph.SourceDateEpoch != 1660000000 {
+		t.Errorf("expected the epoch 1660000000, got %d", *DefaultGraph.SourceDateEpoch)
+	}
+	if expected := []string{"curl", "htop", "vim"}; !reflect.DeepEqual(DefaultGraph.SystemPackages, expected) {
+		t.Errorf("expected %v, got %v", expected, DefaultGraph.SystemPackages)
+	}
+	if expected := []string{"numpy", "torch"}; !reflect.DeepEqual(DefaultGraph.PyPIPackages, expected) {
+		t.Errorf("expected %v, got %v", expected, DefaultGraph.PyPIPackages)
+	}
+	if expected := []string{"dep.whl", "app.whl"}; !reflect.DeepEqual(DefaultGraph.PythonWheels, expected) {
+		t.Errorf("expected the wheels in order %v, got %v", expected, DefaultGraph.PythonWheels)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+)
+
+const (
+	// SandboxGrantNetwork runs the commands with the network.
+	SandboxGrantNetwork = "network"
+	// SandboxGrantContext mounts the build context into the working dir.
+	SandboxGrantContext = "context"
+	// SandboxGrantProxy keeps the proxy and the PyPI index env, which may
+	// carry the credentials.
+	SandboxGrantProxy = "proxy"
+)
+
+// sandboxSecretEnv is unset in the sandboxed run without the proxy grant.
+var sandboxSecretEnv = []string{
+	"http_proxy", "https_proxy", "no_proxy",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+	"PIP_INDEX_URL", "PIP_TRUSTED_HOST",
+}
+
+// Sandbox runs the commands of the run rules without the network, the build
+// context and the proxy env unless they are granted by run(allow=[...]), so
+// that the copy-pasted snippets cannot exfiltrate the tokens in the build.
+func Sandbox() {
+	DefaultGraph.Sandbox = true
+}
+
+func validateSandboxGrants(allow []string) error {
+	for _, a := range allow {
+		switch a {
+		case SandboxGrantNetwork, SandboxGrantContext, SandboxGrantProxy:
+		default:
+			return errors.Newf("invalid grant %s, expected %s, %s or %s", a,
+				SandboxGrantNetwork, SandboxGrantContext, SandboxGrantProxy)
+		}
+	}
+	return nil
+}
+
+func sameSandboxGrants(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+func (r RunInfo) granted(grant string) bool {
+	for _, a := range r.Allow {
+		if a == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxRun returns the command prefix which unsets the secret env and the
+// options which restrict the run stage in the sandbox.
+func (g Graph) sandboxRun(stage RunInfo) ([]string, []llb.RunOption) {
+	var prefix []string
+	var opts []llb.RunOption
+	if !g.Sandbox {
+		return prefix, opts
+	}
+	if !stage.granted(SandboxGrantProxy) {
+		prefix = append(prefix, "env")
+		for _, k := range sandboxSecretEnv {
+			prefix = append(prefix, "-u", k)
+		}
+	}
+	if !stage.granted(SandboxGrantNetwork) {
+		opts = append(opts, llb.Network(pb.NetMode_NONE))
+	}
+	return prefix, opts
+}
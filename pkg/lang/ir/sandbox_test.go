@@ -0,0 +1,85 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+)
+
+func TestSandboxRun(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	if err := Run([]string{"echo a"}, "", nil); err != nil {
+		t.Fatalf("failed to add the run: %v", err)
+	}
+	if err := Run([]string{"git clone https://example.com/repo.git"}, "",
+		[]string{SandboxGrantNetwork, SandboxGrantContext}); err != nil {
+		t.Fatalf("failed to add the run: %v", err)
+	}
+	if err := Run([]string{"echo b"}, "", []string{"secrets"}); err == nil {
+		t.Errorf("expected the error for the invalid grant")
+	}
+	if n := len(DefaultGraph.runStages()); n != 2 {
+		t.Errorf("expected the runs with the different grants in 2 stages, got %d", n)
+	}
+
+	Sandbox()
+	def, err := DefaultGraph.compileRun(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	execs := make(map[string]*pb.ExecOp)
+	for _, dt := range def.Def {
+		var op pb.Op
+		if err := op.Unmarshal(dt); err != nil {
+			t.Fatalf("failed to unmarshal the op: %v", err)
+		}
+		if e := op.GetExec(); e != nil {
+			execs[e.Meta.Args[len(e.Meta.Args)-1]] = e
+		}
+	}
+
+	sandboxed, ok := execs["echo a"]
+	if !ok {
+		t.Fatalf("expected the exec of echo a, got %v", execs)
+	}
+	if sandboxed.Network != pb.NetMode_NONE {
+		t.Errorf("expected no network in the sandbox, got %v", sandboxed.Network)
+	}
+	if len(sandboxed.Mounts) != 1 {
+		t.Errorf("expected no build context in the sandbox, got %v", sandboxed.Mounts)
+	}
+	if args := strings.Join(sandboxed.Meta.Args, " "); !strings.HasPrefix(args, "env -u http_proxy") {
+		t.Errorf("expected the proxy env unset in the sandbox, got %s", args)
+	}
+
+	granted, ok := execs["git clone https://example.com/repo.git"]
+	if !ok {
+		t.Fatalf("expected the exec of git clone, got %v", execs)
+	}
+	if granted.Network != pb.NetMode_UNSET {
+		t.Errorf("expected the granted network, got %v", granted.Network)
+	}
+	if len(granted.Mounts) != 2 {
+		t.Errorf("expected the granted build context, got %v", granted.Mounts)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// GraphSchemaVersion is the version of the serialized graph. It should
+	// be bumped when a field is renamed or removed.
+	GraphSchemaVersion = "v1"
+
+	GraphFormatJSON = "json"
+	GraphFormatYAML = "yaml"
+)
+
+// GraphDocument is the serialized graph with its schema version.
+type GraphDocument struct {
+	Version string `json:"version"`
+	Graph   *Graph `json:"graph"`
+}
+
+// IsGraphFile returns true if the build file is a serialized graph
+// instead of a starlark program.
+func IsGraphFile(filename string) bool {
+	switch filepath.Ext(filename) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// MarshalGraph serializes the graph in the given format. The YAML output
+// is converted from the JSON one to keep the same field names.
+func MarshalGraph(g *Graph, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(GraphDocument{
+		Version: GraphSchemaVersion,
+		Graph:   g,
+	}, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the graph")
+	}
+	switch format {
+	case GraphFormatJSON:
+		return data, nil
+	case GraphFormatYAML:
+		return jsonToYAML(data)
+	default:
+		return nil, errors.Newf("unsupported format %s, expected json or yaml", format)
+	}
+}
+
+// UnmarshalGraph deserializes the graph from JSON or YAML. The fields
+// absent in the data keep the defaults of NewGraph, and the unknown
+// fields are rejected.
+func UnmarshalGraph(data []byte) (*Graph, error) {
+	// JSON is a subset of YAML, thus both are decoded by the YAML decoder.
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the graph")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the graph")
+	}
+
+	var doc struct {
+		Version string          `json:"version"`
+		Graph   json.RawMessage `json:"graph"`
+	}
+	if err := decodeStrict(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the graph")
+	}
+	if doc.Version != GraphSchemaVersion {
+		return nil, errors.Newf("unsupported graph version %q, expected %q",
+			doc.Version, GraphSchemaVersion)
+	}
+	if len(doc.Graph) == 0 || string(doc.Graph) == "null" {
+		return nil, errors.New("graph is not found")
+	}
+	g := NewGraph()
+	if err := decodeStrict(doc.Graph, g); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the graph")
+	}
+	return g, nil
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// LoadGraph reads the serialized graph from the file and uses it as the
+// default graph.
+func LoadGraph(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the graph file %s", filename)
+	}
+	g, err := UnmarshalGraph(data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load the graph file %s", filename)
+	}
+	DefaultGraph = g
+	return nil
+}
+
+func jsonToYAML(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the json")
+	}
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the yaml")
+	}
+	return data, nil
+}
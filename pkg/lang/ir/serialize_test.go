@@ -0,0 +1,94 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGraphRoundTrip(t *testing.T) {
+	g := NewGraph()
+	g.EnvironmentName = "test"
+	g.PyPIPackages = []string{"numpy"}
+	g.PyPILayers = [][]string{{"torch"}}
+	g.SystemPackages = []string{"htop"}
+	g.Copy = []CopyInfo{{Source: "a", Destination: "/b"}}
+	g.RuntimeEnviron["A"] = "B"
+	g.JupyterConfig = &JupyterConfig{Port: 8888}
+
+	for _, format := range []string{GraphFormatJSON, GraphFormatYAML} {
+		data, err := MarshalGraph(g, format)
+		if err != nil {
+			t.Fatalf("failed to marshal the graph to %s: %v", format, err)
+		}
+		actual, err := UnmarshalGraph(data)
+		if err != nil {
+			t.Fatalf("failed to unmarshal the graph from %s: %v\n%s", format, err, data)
+		}
+		if !reflect.DeepEqual(actual, g) {
+			t.Errorf("expected the same graph after the %s round trip, got %+v", format, actual)
+		}
+	}
+}
+
+func TestUnmarshalGraph(t *testing.T) {
+	g, err := UnmarshalGraph([]byte(`
+version: v1
+graph:
+  Shell: zsh
+  PyPIPackages: [numpy]
+`))
+	if err != nil {
+		t.Fatalf("failed to unmarshal the graph: %v", err)
+	}
+	if g.Shell != shellZSH || !reflect.DeepEqual(g.PyPIPackages, []string{"numpy"}) {
+		t.Errorf("unexpected graph %+v", g)
+	}
+	// The absent fields keep the defaults.
+	if g.OS != osDefault || g.Language.Name != languageDefault || g.CondaConfig == nil {
+		t.Errorf("expected the defaults in the graph, got %+v", g)
+	}
+
+	// The runs in the older graph are the plain commands.
+	g, err = UnmarshalGraph([]byte(`{"version": "v1", "graph": {"Exec": ["echo a",
+		{"Commands": ["echo b"], "Shell": "bash -eo pipefail"}]}}`))
+	if err != nil {
+		t.Fatalf("failed to unmarshal the graph: %v", err)
+	}
+	expected := []RunInfo{
+		{Commands: []string{"echo a"}},
+		{Commands: []string{"echo b"}, Shell: "bash -eo pipefail"},
+	}
+	if !reflect.DeepEqual(g.Exec, expected) {
+		t.Errorf("expected %v, got %v", expected, g.Exec)
+	}
+
+	testcases := []struct {
+		data     string
+		expected string
+	}{
+		{`{"version": "v0", "graph": {}}`, "unsupported graph version"},
+		{`{"version": "v1", "graph": {"Unknown": 1}}`, "unknown field"},
+		{`{"version": "v1"}`, "graph is not found"},
+	}
+	for _, tc := range testcases {
+		_, err := UnmarshalGraph([]byte(tc.data))
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("UnmarshalGraph(%s) = %v, expected %q", tc.data, err, tc.expected)
+		}
+	}
+}
@@ -15,12 +15,16 @@
 package ir
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/cockroachdb/errors"
 	"github.com/moby/buildkit/client/llb"
 
 	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/progress/compileui"
 	"github.com/tensorchord/envd/pkg/shell"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
@@ -44,16 +48,21 @@ disabled = false
 `
 )
 
-func (g *Graph) compileShell(root llb.State) (llb.State, error) {
-	if g.Shell == shellZSH {
-		return g.compileZSH(root)
+func (g *Graph) compileShell(ctx context.Context, root llb.State) (llb.State, error) {
+	switch g.Shell {
+	case shellZSH:
+		return g.compileZSH(ctx, root)
+	case shellBASH:
+		return g.compileBash(root), nil
+	case shellFish:
+		return g.compileFish(root), nil
 	}
 	return root, nil
 }
 
 func (g *Graph) compilePrompt(root llb.State) llb.State {
 	// skip this for customized image
-	if g.Image != nil {
+	if g.Image != nil || !g.devTarget() {
 		return root
 	}
 	// starship config
@@ -63,28 +72,97 @@ func (g *Graph) compilePrompt(root llb.State) llb.State {
 		File(llb.Mkfile(starshipConfigPath, 0644, []byte(starshipConfig), llb.WithUIDGID(g.uid, g.gid)),
 			llb.WithCustomName("[internal] setting prompt starship config"))
 
-	run := config.Run(llb.Shlex(fmt.Sprintf(`bash -c 'echo "eval \"\$(starship init bash)\"" >> %s'`, fileutil.EnvdHomeDir(".bashrc"))),
-		llb.WithCustomName("[internal] setting prompt bash config")).Root()
+	run := config
+	// The theme of bash-it sets the prompt instead of starship.
+	if g.BashConfig == nil || g.BashConfig.Theme == "" {
+		run = config.Run(llb.Shlex(fmt.Sprintf(`bash -c 'echo "eval \"\$(starship init bash)\"" >> %s'`, fileutil.EnvdHomeDir(".bashrc"))),
+			llb.WithCustomName("[internal] setting prompt bash config")).Root()
+	}
 
-	if g.Shell == shellZSH {
+	switch g.Shell {
+	case shellZSH:
 		run = run.Run(
 			llb.Shlex(fmt.Sprintf(`bash -c 'echo "eval \"\$(starship init zsh)\"" >> %s'`, fileutil.EnvdHomeDir(".zshrc"))),
 			llb.WithCustomName("[internal] setting prompt zsh config")).Root()
+	case shellFish:
+		run = run.Run(
+			llb.Shlex(fmt.Sprintf(`bash -c 'echo "starship init fish | source" >> %s'`, fishConfigPath)),
+			llb.WithCustomName("[internal] setting prompt fish config")).Root()
 	}
 	return run
 }
 
-func (g Graph) compileZSH(root llb.State) (llb.State, error) {
+// shellRCScript joins the snippets set by config.shell_rc. It is sourced by
+// the rc files, thus the snippets do not need to be quoted.
+func (g Graph) shellRCScript() string {
+	var sb strings.Builder
+	sb.WriteString("# Generated by envd from config.shell_rc in the build file.\n")
+	for _, rc := range g.ShellRC {
+		sb.WriteString(strings.TrimSuffix(rc, "\n"))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// compileShellRC appends the snippets in the build file to the shell rc
+// files, after the prompt and the shell state.
+func (g Graph) compileShellRC(root llb.State) llb.State {
+	if len(g.ShellRC) == 0 {
+		return root
+	}
+	if g.Image != nil {
+		log.Warn("config.shell_rc is ignored in the custom image")
+		return root
+	}
+	rc := root.File(llb.Mkdir(filepath.Dir(shellRCScriptPath), 0755, llb.WithParents(true)).
+		Mkfile(shellRCScriptPath, 0644, []byte(g.shellRCScript())),
+		llb.WithCustomName("[internal] add the shell rc snippets"))
+	for _, f := range g.shellRCFiles() {
+		rc = rc.Run(llb.Shlex(fmt.Sprintf(`bash -c 'echo "source %s" >> %s'`,
+			shellRCScriptPath, f)),
+			llb.WithCustomNamef("[internal] source the shell rc snippets in %s", f)).Root()
+	}
+	return rc
+}
+
+// dockerfileShellRC is the Dockerfile version of compileShellRC.
+func (g Graph) dockerfileShellRC(w *dockerfileWriter) {
+	if len(g.ShellRC) == 0 || g.Image != nil {
+		return
+	}
+	w.file(shellRCScriptPath, g.shellRCScript(), 0, 0)
+	for _, f := range g.shellRCFiles() {
+		w.run(fmt.Sprintf(`echo "source %s" >> %s`, shellRCScriptPath, f))
+	}
+}
+
+// ZSHManager returns the manager of oh-my-zsh pinned by config.oh_my_zsh.
+func (g Graph) ZSHManager() shell.Manager {
+	if g.OHMyZSHConfig == nil {
+		return shell.NewManager(shell.Source{HTTPClient: g.HTTPClient()})
+	}
+	return shell.NewManager(shell.Source{
+		Revision:   g.OHMyZSHConfig.Revision,
+		URL:        g.OHMyZSHConfig.URL,
+		Tarball:    g.OHMyZSHConfig.Tarball,
+		HTTPClient: g.HTTPClient(),
+	})
+}
+
+func (g Graph) compileZSH(ctx context.Context, root llb.State) (llb.State, error) {
 	installPath := fileutil.EnvdHomeDir("install.sh")
 	zshrcPath := fileutil.EnvdHomeDir(".zshrc")
 	ohMyZSHPath := fileutil.EnvdHomeDir(".oh-my-zsh")
-	m := shell.NewManager()
+	m := g.ZSHManager()
 	g.Writer.LogZSH(compileui.ActionStart, false)
-	if cached, err := m.DownloadOrCache(); err != nil {
+	if cached, err := m.DownloadOrCache(ctx); err != nil {
 		return llb.State{}, errors.Wrap(err, "failed to download oh-my-zsh")
 	} else {
 		g.Writer.LogZSH(compileui.ActionEnd, cached)
 	}
+	if err := g.checkZSHConfig(m.OHMyZSHDir()); err != nil {
+		return llb.State{}, err
+	}
 	zshStage := root.
 		File(llb.Copy(llb.Local(flag.FlagCacheDir), "oh-my-zsh", ohMyZSHPath,
 			&llb.CopyInfo{CreateDestPath: true}, llb.WithUIDGID(g.uid, g.gid))).
@@ -93,6 +171,88 @@ func (g Graph) compileZSH(root llb.State) (llb.State, error) {
 	zshrc := zshStage.Run(llb.Shlex(fmt.Sprintf("bash %s", installPath)),
 		llb.WithCustomName("[internal] install oh-my-zsh")).
 		File(llb.Mkfile(zshrcPath,
-			0644, []byte(m.ZSHRC()), llb.WithUIDGID(g.uid, g.gid)))
+			0644, []byte(g.zshrc(m)), llb.WithUIDGID(g.uid, g.gid)))
 	return zshrc, nil
 }
+
+// zshrc renders the zshrc with the plugins and the theme in build.envd.
+func (g Graph) zshrc(m shell.Manager) string {
+	if g.ZSHConfig == nil {
+		return m.ZSHRC(nil, "")
+	}
+	return m.ZSHRC(g.ZSHConfig.Plugins, g.ZSHConfig.Theme)
+}
+
+// checkZSHConfig makes sure the plugins and the theme are shipped with the
+// oh-my-zsh in the cache, thus the typo fails the build instead of the shell.
+func (g Graph) checkZSHConfig(ohMyZSHDir string) error {
+	if g.ZSHConfig == nil {
+		return nil
+	}
+	for _, p := range g.ZSHConfig.Plugins {
+		if ok, err := fileutil.DirExists(filepath.Join(ohMyZSHDir, "plugins", p)); err != nil {
+			return errors.Wrapf(err, "failed to check the oh-my-zsh plugin %s", p)
+		} else if !ok {
+			return errors.Newf("oh-my-zsh plugin %s is not found", p)
+		}
+	}
+	if g.ZSHConfig.Theme != "" {
+		theme := filepath.Join(ohMyZSHDir, "themes", g.ZSHConfig.Theme+".zsh-theme")
+		if ok, err := fileutil.FileExists(theme); err != nil {
+			return errors.Wrapf(err, "failed to check the oh-my-zsh theme %s", g.ZSHConfig.Theme)
+		} else if !ok {
+			return errors.Newf("oh-my-zsh theme %s is not found", g.ZSHConfig.Theme)
+		}
+	}
+	return nil
+}
+
+// compileFish installs fish and writes the config.fish. The fisher plugins
+// are installed by the user, thus they can be updated in the environment.
+func (g Graph) compileFish(root llb.State) llb.State {
+	m := shell.NewFishManager()
+	fishStage := g.runWithAPTCache(root, aptInstallCommand([]string{shellFish}),
+		llb.WithCustomName("[internal] install fish")).
+		File(llb.Mkdir(filepath.Dir(fishConfigPath), 0755, llb.WithParents(true),
+			llb.WithUIDGID(g.uid, g.gid)).
+			Mkfile(fishConfigPath, 0644, []byte(m.Config()), llb.WithUIDGID(g.uid, g.gid)),
+			llb.WithCustomName("[internal] add config.fish"))
+	if g.FishConfig == nil || len(g.FishConfig.Plugins) == 0 {
+		return fishStage
+	}
+	return fishStage.Run(
+		llb.Args([]string{"fish", "-c", m.InstallCommand(g.FishConfig.Plugins)}),
+		llb.User(fmt.Sprintf("%d:%d", g.uid, g.gid)),
+		llb.AddEnv("HOME", fileutil.EnvdHomeDir()),
+		llb.WithCustomNamef("[internal] install fisher plugins %s",
+			strings.Join(g.FishConfig.Plugins, " "))).Root()
+}
+
+// compileBash writes the bashrc with the sensible defaults if bash is chosen
+// explicitly, and installs bash-it if the plugins or the theme are set.
+func (g Graph) compileBash(root llb.State) llb.State {
+	if g.BashConfig == nil {
+		return root
+	}
+	m := shell.NewBashManager()
+	bashIt := g.BashConfig.bashIt()
+	bashStage := root
+	if bashIt {
+		repo := llb.Git(shell.BashItRepoURL, "master")
+		bashStage = root.File(llb.Copy(repo, "/", fileutil.EnvdHomeDir(shell.BashItDir),
+			&llb.CopyInfo{CreateDestPath: true}, llb.WithUIDGID(g.uid, g.gid)),
+			llb.WithCustomName("[internal] install bash-it"))
+	}
+	bashStage = bashStage.File(llb.Mkfile(fileutil.EnvdHomeDir(".bashrc"), 0644,
+		[]byte(m.BashRC(bashIt, g.BashConfig.Theme)), llb.WithUIDGID(g.uid, g.gid)),
+		llb.WithCustomName("[internal] add bashrc"))
+	if len(g.BashConfig.Plugins) == 0 {
+		return bashStage
+	}
+	return bashStage.Run(
+		llb.Args([]string{"bash", "-c", m.EnableCommand(g.BashConfig.Plugins)}),
+		llb.User(fmt.Sprintf("%d:%d", g.uid, g.gid)),
+		llb.AddEnv("HOME", fileutil.EnvdHomeDir()),
+		llb.WithCustomNamef("[internal] enable bash-it plugins %s",
+			strings.Join(g.BashConfig.Plugins, " "))).Root()
+}
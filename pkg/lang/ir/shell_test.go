@@ -0,0 +1,184 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tensorchord/envd/pkg/shell"
+)
+
+func TestShellZSHConfig(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+
+	if err := Shell("tcsh", []string{"git"}, ""); err == nil {
+		t.Errorf("expected error for the plugins of tcsh")
+	}
+	if err := Shell(shellZSH, []string{"git;rm"}, ""); err == nil {
+		t.Errorf("expected error for the invalid plugin")
+	}
+	if err := Shell(shellZSH, []string{"git", "autojump"}, "ys"); err != nil {
+		t.Fatalf("failed to set the shell: %v", err)
+	}
+	if DefaultGraph.ZSHConfig == nil || DefaultGraph.ZSHConfig.Theme != "ys" {
+		t.Errorf("expected the zsh config, got %v", DefaultGraph.ZSHConfig)
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "plugins", "git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultGraph.checkZSHConfig(dir); err == nil {
+		t.Errorf("expected error for the missing plugin autojump")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "plugins", "autojump"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultGraph.checkZSHConfig(dir); err == nil {
+		t.Errorf("expected error for the missing theme ys")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "themes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "themes", "ys.zsh-theme"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefaultGraph.checkZSHConfig(dir); err != nil {
+		t.Errorf("failed to check the zsh config: %v", err)
+	}
+
+	if err := OHMyZSH("master;rm -rf /", "", ""); err == nil {
+		t.Errorf("expected error for the invalid revision")
+	}
+	if err := OHMyZSH("", "ftp://example.com/ohmyzsh.git", ""); err == nil {
+		t.Errorf("expected error for the invalid url")
+	}
+	if err := OHMyZSH("", "", filepath.Join(dir, "missing.tar.gz")); err == nil {
+		t.Errorf("expected error for the missing tarball")
+	}
+	tarball := filepath.Join(dir, "ohmyzsh.tar.gz")
+	if err := os.WriteFile(tarball, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := OHMyZSH("release/v1", "https://git.example.com/mirror/ohmyzsh.git", tarball); err != nil {
+		t.Fatalf("failed to pin the oh-my-zsh revision: %v", err)
+	}
+	m := DefaultGraph.ZSHManager()
+	if m.RepoURL() != "https://git.example.com/mirror/ohmyzsh.git" {
+		t.Errorf("expected the mirror, got %s", m.RepoURL())
+	}
+}
+
+func TestShellRC(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+
+	if err := ShellRC(" \n"); err == nil {
+		t.Errorf("expected error for the empty content")
+	}
+	if err := ShellRC("alias ll='ls -alF'\n"); err != nil {
+		t.Fatalf("failed to add the shell rc: %v", err)
+	}
+	if err := ShellRC(`export EDITOR="vim"`); err != nil {
+		t.Fatalf("failed to add the shell rc: %v", err)
+	}
+	if err := Shell(shellZSH, nil, ""); err != nil {
+		t.Fatalf("failed to set the shell: %v", err)
+	}
+
+	script := DefaultGraph.shellRCScript()
+	if !strings.HasSuffix(script, "alias ll='ls -alF'\nexport EDITOR=\"vim\"\n") {
+		t.Errorf("unexpected shell rc script:\n%s", script)
+	}
+	w := &dockerfileWriter{}
+	DefaultGraph.dockerfileShellRC(w)
+	for _, rc := range []string{".bashrc", ".zshrc"} {
+		expected := "source /var/envd/shell-rc.sh\" >> /home/envd/" + rc
+		if !strings.Contains(w.String(), expected) {
+			t.Errorf("expected %q in the dockerfile:\n%s", expected, w.String())
+		}
+	}
+}
+
+func TestShellFishConfig(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+
+	if err := Shell(shellFish, nil, "tide"); err == nil {
+		t.Errorf("expected error for the theme of fish")
+	}
+	if err := Shell(shellFish, []string{"fzf"}, ""); err == nil {
+		t.Errorf("expected error for the plugin without the owner")
+	}
+	if err := Shell(shellFish, []string{"PatrickF1/fzf.fish", "ilancosman/tide@v5"}, ""); err != nil {
+		t.Fatalf("failed to set the shell: %v", err)
+	}
+	if DefaultGraph.FishConfig == nil || len(DefaultGraph.FishConfig.Plugins) != 2 {
+		t.Errorf("expected the fish config, got %v", DefaultGraph.FishConfig)
+	}
+
+	w := &dockerfileWriter{}
+	DefaultGraph.dockerfileShell(w)
+	for _, expected := range []string{
+		"COPY --chown=0:0 <<'ENVD_EOF' /home/envd/.config/fish/config.fish",
+		"fisher install jorgebucaran/fisher PatrickF1/fzf.fish ilancosman/tide@v5",
+	} {
+		if !strings.Contains(w.String(), expected) {
+			t.Errorf("expected %q in the dockerfile:\n%s", expected, w.String())
+		}
+	}
+
+	if err := Shell(shellZSH, nil, ""); err != nil {
+		t.Fatalf("failed to set the shell: %v", err)
+	}
+	if DefaultGraph.FishConfig != nil {
+		t.Errorf("expected the fish config to be reset, got %v", DefaultGraph.FishConfig)
+	}
+}
+
+func TestShellBashConfig(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+
+	if DefaultGraph.BashConfig != nil {
+		t.Errorf("expected no bash config by default, got %v", DefaultGraph.BashConfig)
+	}
+	if err := Shell(shellBASH, []string{"git;rm"}, ""); err == nil {
+		t.Errorf("expected error for the invalid plugin")
+	}
+	if err := Shell(shellBASH, nil, ""); err != nil {
+		t.Fatalf("failed to set the shell: %v", err)
+	}
+	w := &dockerfileWriter{}
+	DefaultGraph.dockerfileShell(w)
+	if !strings.Contains(w.String(), "/home/envd/.bashrc") || strings.Contains(w.String(), shell.BashItRepoURL) {
+		t.Errorf("expected only the bashrc in the dockerfile:\n%s", w.String())
+	}
+
+	if err := Shell(shellBASH, []string{"git", "history"}, "powerline"); err != nil {
+		t.Fatalf("failed to set the shell: %v", err)
+	}
+	w = &dockerfileWriter{}
+	DefaultGraph.dockerfileShell(w)
+	for _, expected := range []string{
+		"git clone --depth 1 " + shell.BashItRepoURL + " /home/envd/.bash_it",
+		`export BASH_IT_THEME="powerline"`,
+		"bash-it enable plugin git history",
+	} {
+		if !strings.Contains(w.String(), expected) {
+			t.Errorf("expected %q in the dockerfile:\n%s", expected, w.String())
+		}
+	}
+}
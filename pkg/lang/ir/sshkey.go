@@ -0,0 +1,94 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthorizedKeys adds the public keys to the authorized keys of envd-sshd,
+// thus the standard ssh client works with them besides envd ssh. The keys
+// in ~/.ssh on the host are used if no path is specified.
+func AuthorizedKeys(paths []string) error {
+	if len(paths) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return errors.Wrap(err, "failed to get the home dir")
+		}
+		if paths, err = filepath.Glob(filepath.Join(home, ".ssh", "id_*.pub")); err != nil {
+			return errors.Wrap(err, "failed to find the public keys")
+		}
+		if len(paths) == 0 {
+			return errors.Newf("there is no public key in %s", filepath.Join(home, ".ssh"))
+		}
+	}
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			return errors.Wrapf(err, "failed to find the public key %s", p)
+		}
+	}
+	DefaultGraph.AuthorizedKeys = append(DefaultGraph.AuthorizedKeys, paths...)
+	return nil
+}
+
+// authorizedKeys returns the content of the authorized keys file, i.e. the
+// public key of envd followed by the keys added by config.authorized_keys.
+func (g Graph) authorizedKeys(public string) (string, error) {
+	bdat, err := os.ReadFile(public)
+	if err != nil {
+		return "", errors.Wrap(err, "Cannot read public SSH key")
+	}
+	keys := []string{strings.TrimSuffix(string(bdat), "\n") + " envd"}
+	for _, p := range g.AuthorizedKeys {
+		lines, err := readAuthorizedKeys(p)
+		if err != nil {
+			return "", err
+		}
+		keys = append(keys, lines...)
+	}
+	return strings.Join(keys, "\n"), nil
+}
+
+// readAuthorizedKeys reads the keys in the file, every line of which is
+// verified thus envd-sshd does not fail to load them at startup.
+func readAuthorizedKeys(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the public key %s", path)
+	}
+	defer f.Close()
+	keys := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err != nil {
+			return nil, errors.Wrapf(err, "invalid public key in %s", path)
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read the public key %s", path)
+	}
+	return keys, nil
+}
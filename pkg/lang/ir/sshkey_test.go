@@ -0,0 +1,74 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func writePublicKey(t *testing.T, dir, name, comment string) (string, string) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate the key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("failed to create the public key: %v", err)
+	}
+	line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(key)), "\n") + comment
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(line+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write the public key: %v", err)
+	}
+	return path, line
+}
+
+func TestAuthorizedKeys(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	dir := t.TempDir()
+	envdKey, envdLine := writePublicKey(t, dir, "envd.pub", "")
+	aliceKey, aliceLine := writePublicKey(t, dir, "alice.pub", " alice@laptop")
+
+	if err := AuthorizedKeys([]string{filepath.Join(dir, "bob.pub")}); err == nil {
+		t.Errorf("expected error for the missing key")
+	}
+	if err := AuthorizedKeys([]string{aliceKey}); err != nil {
+		t.Fatalf("failed to add the key: %v", err)
+	}
+	expected := envdLine + " envd\n" + aliceLine
+	actual, err := DefaultGraph.authorizedKeys(envdKey)
+	if err != nil {
+		t.Fatalf("failed to get the authorized keys: %v", err)
+	}
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	invalid := filepath.Join(dir, "invalid.pub")
+	if err := os.WriteFile(invalid, []byte("ssh-ed25519 invalid\n"), 0644); err != nil {
+		t.Fatalf("failed to write the public key: %v", err)
+	}
+	DefaultGraph.AuthorizedKeys = []string{invalid}
+	if _, err := DefaultGraph.authorizedKeys(envdKey); err == nil {
+		t.Errorf("expected error for the invalid key")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/docker/go-units"
+)
+
+// stageKillAfter is how long the stage is given to exit after the timeout,
+// before it is killed.
+const stageKillAfter = 10 * time.Second
+
+// StageLimitsConfig bounds the stages of the packages and the run rules, so
+// that a hung pip install fails the build instead of hanging the CI.
+type StageLimitsConfig struct {
+	// StageTimeout is the timeout of each stage.
+	StageTimeout time.Duration `json:"StageTimeout,omitempty"`
+	// MaxLogSize is the size of the logs kept for each stage, the output
+	// beyond it is clipped.
+	MaxLogSize int64 `json:"MaxLogSize,omitempty"`
+}
+
+// StageLimits sets the timeout and the max log size of the stages, e.g.
+// 30m and 2MiB. The empty value keeps the stages unlimited.
+func StageLimits(timeout, maxLogSize string) error {
+	limits := &StageLimitsConfig{}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return errors.Wrapf(err, "invalid stage timeout %s", timeout)
+		}
+		if d < time.Second {
+			return errors.Newf("the stage timeout %s should be at least 1s", timeout)
+		}
+		limits.StageTimeout = d
+	}
+	if maxLogSize != "" {
+		size, err := units.RAMInBytes(maxLogSize)
+		if err != nil {
+			return errors.Wrapf(err, "invalid max log size %s", maxLogSize)
+		}
+		if size <= 0 {
+			return errors.Newf("the max log size %s should be positive", maxLogSize)
+		}
+		limits.MaxLogSize = size
+	}
+	DefaultGraph.StageLimitsConfig = limits
+	return nil
+}
+
+// StageTimeoutExceeded tells if the build error is caused by the stage
+// timeout, i.e. the exit code 124 of timeout.
+func StageTimeoutExceeded(err error) bool {
+	return err != nil && DefaultGraph.stageTimeout() > 0 &&
+		strings.Contains(err.Error(), "exit code: 124")
+}
+
+// StageTimeout returns the timeout of the stages, or 0 if not limited.
+func StageTimeout() time.Duration {
+	return DefaultGraph.stageTimeout()
+}
+
+// MaxLogSize returns the size of the logs kept for each stage, or 0 if not
+// limited.
+func MaxLogSize() int64 {
+	if DefaultGraph.StageLimitsConfig == nil {
+		return 0
+	}
+	return DefaultGraph.StageLimitsConfig.MaxLogSize
+}
+
+func (g Graph) stageTimeout() time.Duration {
+	if g.StageLimitsConfig == nil {
+		return 0
+	}
+	return g.StageLimitsConfig.StageTimeout
+}
+
+// timeoutPrefix is the command prefix which limits the stage by timeout(1).
+func (g Graph) timeoutPrefix() []string {
+	d := g.stageTimeout()
+	if d == 0 {
+		return nil
+	}
+	return []string{"timeout", "-k", fmt.Sprintf("%d", int64(stageKillAfter.Seconds())),
+		fmt.Sprintf("%d", int64(d.Round(time.Second).Seconds()))}
+}
+
+// withTimeout limits the args of the stage.
+func (g Graph) withTimeout(args []string) []string {
+	return append(g.timeoutPrefix(), args...)
+}
+
+// withTimeoutCommand limits the command of the stage parsed by llb.Shlex.
+func (g Graph) withTimeoutCommand(cmd string) string {
+	if prefix := g.timeoutPrefix(); len(prefix) > 0 {
+		return strings.Join(prefix, " ") + " " + cmd
+	}
+	return cmd
+}
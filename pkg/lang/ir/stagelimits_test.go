@@ -0,0 +1,66 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+func TestStageLimits(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	for _, tc := range []struct{ timeout, maxLogSize string }{
+		{"30", ""},
+		{"10ms", ""},
+		{"", "2 lines"},
+		{"", "0"},
+	} {
+		if err := StageLimits(tc.timeout, tc.maxLogSize); err == nil {
+			t.Errorf("expected the error for %q %q", tc.timeout, tc.maxLogSize)
+		}
+	}
+	if err := StageLimits("30m", "2MiB"); err != nil {
+		t.Fatalf("failed to set the stage limits: %v", err)
+	}
+	if StageTimeout() != 30*time.Minute || MaxLogSize() != 2*1024*1024 {
+		t.Errorf("unexpected stage limits %v", DefaultGraph.StageLimitsConfig)
+	}
+
+	if err := Run([]string{"sleep infinity"}, "", nil); err != nil {
+		t.Fatalf("failed to add the run: %v", err)
+	}
+	def, err := DefaultGraph.compileRun(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	expected := "exec timeout -k 10 1800 bash -c sleep infinity"
+	found := false
+	for _, v := range vertices {
+		found = found || v.Op == expected
+	}
+	if !found {
+		t.Errorf("expected the op %q, got %v", expected, vertices)
+	}
+}
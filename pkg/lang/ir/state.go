@@ -0,0 +1,110 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+const (
+	// shellStateScriptPath is sourced by the shell rc. It is out of the
+	// state dir since the volume hides the changes of the image there.
+	shellStateScriptPath = "/var/envd/shell-state.sh"
+	// shellRCScriptPath is sourced by the shell rc, see config.shell_rc.
+	shellRCScriptPath = "/var/envd/shell-rc.sh"
+
+	shellStateScript = `# The shell state is kept in the volume mounted by envd up, and the
+# history is kept in the cache dir of the host if it is mounted.
+_envd_history_dir=%[1]s
+if [ -d %[2]s ] && [ -w %[2]s ]; then
+  _envd_history_dir=%[2]s
+fi
+if [ -n "$ZSH_VERSION" ]; then
+  HISTFILE=$_envd_history_dir/zsh_history
+else
+  HISTFILE=$_envd_history_dir/bash_history
+fi
+unset _envd_history_dir
+export _Z_DATA=%[1]s/z
+mkdir -p %[1]s/autojump ~/.local/share
+[ -e ~/.local/share/autojump ] || ln -s %[1]s/autojump ~/.local/share/autojump
+`
+	ipythonStateConfig = "c.HistoryManager.hist_file = '%s/ipython_history.sqlite'\n"
+)
+
+var ipythonProfileDir = fileutil.EnvdHomeDir(".ipython", "profile_default")
+
+// shellRCFiles returns the rc files of the shells in the environment.
+func (g Graph) shellRCFiles() []string {
+	rc := []string{fileutil.EnvdHomeDir(".bashrc")}
+	if g.Shell == shellZSH {
+		rc = append(rc, fileutil.EnvdHomeDir(".zshrc"))
+	}
+	return rc
+}
+
+func (g Graph) shellStateScript() string {
+	return fmt.Sprintf(shellStateScript, config.ContainerStateDir, config.ContainerHistoryDir)
+}
+
+// compileShellState redirects the shell history, the z/autojump databases
+// and the ipython history into the state dir, which is owned by the user
+// thus the volume created from it is writable.
+func (g Graph) compileShellState(root llb.State) llb.State {
+	// skip this for customized image
+	if g.Image != nil || !g.devTarget() {
+		return root
+	}
+	state := root.
+		File(llb.Mkdir(config.ContainerStateDir, 0755, llb.WithParents(true),
+			llb.WithUIDGID(g.uid, g.gid)),
+			llb.WithCustomName("[internal] create the shell state dir")).
+		File(llb.Mkfile(shellStateScriptPath, 0644,
+			[]byte(g.shellStateScript())),
+			llb.WithCustomName("[internal] add the shell state script")).
+		File(llb.Mkdir(ipythonProfileDir, 0755, llb.WithParents(true),
+			llb.WithUIDGID(g.uid, g.gid)).
+			Mkfile(ipythonProfileDir+"/ipython_config.py", 0644,
+				[]byte(fmt.Sprintf(ipythonStateConfig, config.ContainerStateDir)),
+				llb.WithUIDGID(g.uid, g.gid)),
+			llb.WithCustomName("[internal] persist the ipython history"))
+	for _, rc := range g.shellRCFiles() {
+		state = state.Run(llb.Shlex(fmt.Sprintf(`bash -c 'echo "source %s" >> %s'`,
+			shellStateScriptPath, rc)),
+			llb.WithCustomNamef("[internal] persist the shell state in %s", rc)).Root()
+	}
+	return state
+}
+
+// dockerfileShellState is the Dockerfile version of compileShellState.
+func (g Graph) dockerfileShellState(w *dockerfileWriter) {
+	if g.Image != nil || !g.devTarget() {
+		return
+	}
+	w.run(fmt.Sprintf("mkdir -p %s %s && chown -R %d:%d %s %s",
+		config.ContainerStateDir, ipythonProfileDir, g.uid, g.gid,
+		config.ContainerStateDir, fileutil.EnvdHomeDir(".ipython")))
+	w.file(shellStateScriptPath, g.shellStateScript(), 0, 0)
+	w.file(ipythonProfileDir+"/ipython_config.py",
+		fmt.Sprintf(ipythonStateConfig, config.ContainerStateDir), g.uid, g.gid)
+	for _, rc := range g.shellRCFiles() {
+		w.run(fmt.Sprintf(`echo "source %s" >> %s`, shellStateScriptPath, rc))
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+func TestCompileShellState(t *testing.T) {
+	g := Graph{Shell: shellZSH}
+	def, err := g.compileShellState(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, v := range vertices {
+		names[v.Name] = true
+	}
+	for _, expected := range []string{
+		"[internal] create the shell state dir",
+		"[internal] persist the ipython history",
+		"[internal] persist the shell state in /home/envd/.bashrc",
+		"[internal] persist the shell state in /home/envd/.zshrc",
+	} {
+		if !names[expected] {
+			t.Errorf("expected the step %q, got %v", expected, names)
+		}
+	}
+
+	script := g.shellStateScript()
+	for _, expected := range []string{
+		"_envd_history_dir=/var/envd/state\n",
+		"if [ -d /var/envd/history ] && [ -w /var/envd/history ]; then",
+		"HISTFILE=$_envd_history_dir/zsh_history",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected %q in the shell state script:\n%s", expected, script)
+		}
+	}
+
+	image := "python:3.9"
+	g.Image = &image
+	root := llb.Image(image)
+	if actual := g.compileShellState(root); actual.Output() != root.Output() {
+		t.Errorf("expected the custom image to be skipped")
+	}
+}
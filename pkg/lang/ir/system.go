@@ -21,20 +21,21 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/alessio/shellescape"
 	"github.com/cockroachdb/errors"
 	"github.com/moby/buildkit/client/llb"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	"github.com/tensorchord/envd/pkg/config"
 	"github.com/tensorchord/envd/pkg/flag"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/types"
 	"github.com/tensorchord/envd/pkg/version"
 )
 
 func (g Graph) compileUbuntuAPT(root llb.State) llb.State {
 	if g.UbuntuAPTSource != nil {
-		logrus.WithField("source", *g.UbuntuAPTSource).Debug("using custom APT source")
+		log.WithField("source", *g.UbuntuAPTSource).Debug("using custom APT source")
 		aptSource := llb.Scratch().
 			File(llb.Mkdir(filepath.Dir(aptSourceFilePath), 0755, llb.WithParents(true)),
 				llb.WithCustomName("[internal] setting apt source")).
@@ -46,32 +47,176 @@ func (g Graph) compileUbuntuAPT(root llb.State) llb.State {
 	return root
 }
 
+// prepareImage returns the base image with the proxy and the CA certificates,
+// thus they are used by all the build steps including the ones of the base
+// image, e.g. the builtin system packages, starship, conda and the RUN of the
+// imported Dockerfile.
+func (g Graph) prepareImage(ref string) (llb.State, error) {
+	return g.compileCACertificates(g.compileProxy(llb.Image(ref)))
+}
+
+// compileCACertificates adds the host certificates to the trust store,
+// thus apt, pip and conda work behind TLS-intercepting proxies.
+// ca-certificates may be missing in the image, then it is installed with
+// the builtin system packages and picks up the certificates by itself.
+func (g Graph) compileCACertificates(root llb.State) (llb.State, error) {
+	if len(g.CACertificates) == 0 {
+		return root, nil
+	}
+	certs := root.File(llb.Mkdir(caCertificatesDir, 0755, llb.WithParents(true)),
+		llb.WithCustomName("[internal] creating ca certificates dir"))
+	for i, path := range g.CACertificates {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return llb.State{}, errors.Wrapf(err, "failed to read the certificate %s", path)
+		}
+		// update-ca-certificates only picks up files with the .crt extension.
+		name := fmt.Sprintf("envd-%d-%s.crt", i,
+			strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+		certs = certs.File(llb.Mkfile(filepath.Join(caCertificatesDir, name), 0644, content),
+			llb.WithCustomNamef("[internal] adding ca certificate %s", path))
+	}
+	run := certs.Run(llb.Args([]string{"sh", "-c", updateCACertificatesCommand}),
+		llb.WithCustomName("[internal] updating ca certificates"))
+	return run.Root().
+		AddEnv("REQUESTS_CA_BUNDLE", caBundleFilePath).
+		AddEnv("SSL_CERT_FILE", caBundleFilePath), nil
+}
+
+func (g Graph) compileTimezone(root llb.State) llb.State {
+	if g.Timezone == nil {
+		return root
+	}
+	log.WithField("timezone", *g.Timezone).Debug("configure timezone")
+	cmd := fmt.Sprintf("%[1]s && "+
+		"ln -snf /usr/share/zoneinfo/%[2]s /etc/localtime && echo %[2]s > /etc/timezone",
+		aptInstallCommand([]string{"tzdata"}), *g.Timezone)
+	return g.runWithAPTCache(root, cmd,
+		llb.WithCustomNamef("[internal] setting timezone %s", *g.Timezone)).
+		AddEnv("TZ", *g.Timezone)
+}
+
+func (g Graph) compileLocale(root llb.State) llb.State {
+	if g.Locale == nil {
+		return root
+	}
+	log.WithField("locale", *g.Locale).Debug("configure locale")
+	cmd := fmt.Sprintf("%[1]s && locale-gen %[2]s && update-locale LANG=%[2]s",
+		aptInstallCommand([]string{"locales"}), *g.Locale)
+	return g.runWithAPTCache(root, cmd,
+		llb.WithCustomNamef("[internal] generating locale %s", *g.Locale)).
+		AddEnv("LANG", *g.Locale).
+		AddEnv("LC_ALL", *g.Locale)
+}
+
+// aptInstallCommand returns the command which installs the apt packages. It
+// always updates the metadata first, since the metadata lives in the cache
+// mount instead of the image, and it may be stale or missing. The packages
+// are quoted since the command is run by bash.
+func aptInstallCommand(pkgs []string) string {
+	return fmt.Sprintf("apt-get update && DEBIAN_FRONTEND=noninteractive "+
+		"apt-get install -y --no-install-recommends %s", shellescape.QuoteCommand(pkgs))
+}
+
+// runWithAPTCache runs the apt-get command with the apt cache mounted. The
+// cache is locked since apt cannot share it between the parallel stages.
+func (g Graph) runWithAPTCache(root llb.State, cmd string, opts ...llb.RunOption) llb.State {
+	opts = append([]llb.RunOption{llb.Args(g.withTimeout([]string{"bash", "-c", cmd}))}, opts...)
+	run := root.Run(opts...)
+	for _, dir := range aptCacheDirs {
+		run.AddMount(dir, llb.Scratch(),
+			llb.AsPersistentCacheDir(g.CacheID(dir), llb.CacheMountLocked))
+	}
+	return run.Root()
+}
+
+// runStages merges the adjacent runs without the shell, and keeps the runs
+// with the shell in their own stages.
+func (g Graph) runStages() []RunInfo {
+	stages := []RunInfo{}
+	for _, r := range g.Exec {
+		if len(r.Commands) == 0 {
+			continue
+		}
+		if n := len(stages); r.Shell == "" && n > 0 && stages[n-1].Shell == "" &&
+			sameSandboxGrants(stages[n-1].Allow, r.Allow) {
+			stages[n-1].Commands = append(stages[n-1].Commands, r.Commands...)
+			continue
+		}
+		stages = append(stages, RunInfo{
+			Commands: append([]string{}, r.Commands...),
+			Shell:    r.Shell,
+			Allow:    append([]string(nil), r.Allow...),
+		})
+	}
+	return stages
+}
+
 func (g Graph) compileRun(root llb.State) llb.State {
-	if len(g.Exec) == 0 {
+	stages := g.runStages()
+	if len(stages) == 0 {
 		return root
 	}
 	root = root.AddEnv("PATH", types.DefaultPathEnvUnix)
-	logrus.Debugf("compile run: %s", strings.Join(g.Exec, " "))
-	if len(g.Exec) == 1 {
-		return root.Run(llb.Shlex(fmt.Sprintf("bash -c \"%s\"", g.Exec[0]))).Root()
+	for _, stage := range stages {
+		root = g.compileRunStage(root, stage)
 	}
+	return root
+}
 
-	var sb strings.Builder
-	sb.WriteString("set -euo pipefail\n")
-	for _, c := range g.Exec {
-		sb.WriteString(c + "\n")
+func (g Graph) compileRunStage(root llb.State, stage RunInfo) llb.State {
+	log.Debugf("compile run: %s", strings.Join(stage.Commands, " "))
+	prefix, opts := g.sandboxRun(stage)
+	prefix = append(g.timeoutPrefix(), prefix...)
+	if stage.Shell == "" && len(stage.Commands) == 1 {
+		cmdStr := fmt.Sprintf("bash -c \"%s\"", stage.Commands[0])
+		if len(prefix) > 0 {
+			cmdStr = strings.Join(prefix, " ") + " " + cmdStr
+		}
+		if !g.Sandbox || !stage.granted(SandboxGrantContext) {
+			return root.Run(append(opts, llb.Shlex(cmdStr),
+				g.sourceLocation(ruleRun))...).Root()
+		}
+		// The granted stage needs the build context even if it only
+		// has one command.
+		workingDir := g.getWorkingDir()
+		run := root.Dir(workingDir).
+			Run(append(opts, llb.Shlex(cmdStr), g.sourceLocation(ruleRun))...)
+		run.AddMount(workingDir, llb.Local(flag.FlagBuildContext))
+		return run.Root()
 	}
 
-	cmdStr := fmt.Sprintf("bash -c '%s'", sb.String())
-	logrus.WithField("command", cmdStr).Debug("compile run command")
+	var cmd llb.RunOption
+	if stage.Shell == "" {
+		var sb strings.Builder
+		sb.WriteString("set -euo pipefail\n")
+		for _, c := range stage.Commands {
+			sb.WriteString(c + "\n")
+		}
+		cmdStr := fmt.Sprintf("bash -c '%s'", sb.String())
+		if len(prefix) > 0 {
+			cmdStr = strings.Join(prefix, " ") + " " + cmdStr
+		}
+		log.WithField("command", cmdStr).Debug("compile run command")
+		cmd = llb.Shlex(cmdStr)
+	} else {
+		// The args are not parsed by the shell, thus the commands are
+		// not quoted.
+		args := append(append(prefix, strings.Fields(stage.Shell)...),
+			"-c", strings.Join(stage.Commands, "\n"))
+		log.WithField("command", args).Debug("compile run command")
+		cmd = llb.Args(args)
+	}
 	workingDir := g.getWorkingDir()
 	run := root.Dir(workingDir).
-		Run(llb.Shlex(cmdStr))
+		Run(append(opts, cmd, g.sourceLocation(ruleRun))...)
 	// Mount the build context into the build process.
 	// TODO(gaocegege): Maybe we should make it readonly,
 	// but these cases then cannot be supported:
 	// run(commands=["git clone xx.git"])
-	run.AddMount(workingDir, llb.Local(flag.FlagBuildContext))
+	if !g.Sandbox || stage.granted(SandboxGrantContext) {
+		run.AddMount(workingDir, llb.Local(flag.FlagBuildContext))
+	}
 
 	return run.Root()
 }
@@ -86,42 +231,31 @@ func (g Graph) compileCopy(root llb.State) llb.State {
 	for _, c := range g.Copy {
 		result = result.File(llb.Copy(
 			llb.Local(flag.FlagBuildContext), c.Source, c.Destination,
-			llb.WithUIDGID(g.uid, g.gid)))
+			llb.WithUIDGID(g.uid, g.gid)), g.sourceLocation(ruleCopy))
 	}
 	return result
 }
 
-func (g *Graph) compileCUDAPackages(org string) llb.State {
-	return g.preparePythonBase(llb.Image(fmt.Sprintf(
+func (g *Graph) compileCUDAPackages(org string) (llb.State, error) {
+	root, err := g.prepareImage(fmt.Sprintf(
 		"docker.io/%s:%s-cudnn%s-devel-%s",
-		org, *g.CUDA, g.CUDNN, g.OS)))
+		org, *g.CUDA, g.CUDNN, g.OS))
+	if err != nil {
+		return llb.State{}, err
+	}
+	return g.preparePythonBase(root), nil
 }
 
+// compileSystemPackages installs the user system packages. It runs as root
+// in the same pipeline as the builtin packages, thus sudo is not needed.
 func (g Graph) compileSystemPackages(root llb.State) llb.State {
 	if len(g.SystemPackages) == 0 {
-		logrus.Debug("skip the apt since system package is not specified")
+		log.Debug("skip the apt since system package is not specified")
 		return root
 	}
-
-	// Compose the package install command.
-	var sb strings.Builder
-	sb.WriteString("sudo apt-get update && sudo apt-get install -y --no-install-recommends")
-
-	for _, pkg := range g.SystemPackages {
-		sb.WriteString(fmt.Sprintf(" %s", pkg))
-	}
-
-	cacheDir := "/var/cache/apt"
-	cacheLibDir := "/var/lib/apt"
-
-	run := root.Run(llb.Shlex(fmt.Sprintf("bash -c \"%s\"", sb.String())),
-		llb.WithCustomNamef("apt-get install %s",
-			strings.Join(g.SystemPackages, " ")))
-	run.AddMount(cacheDir, llb.Scratch(),
-		llb.AsPersistentCacheDir(g.CacheID(cacheDir), llb.CacheMountShared))
-	run.AddMount(cacheLibDir, llb.Scratch(),
-		llb.AsPersistentCacheDir(g.CacheID(cacheLibDir), llb.CacheMountShared))
-	return run.Root()
+	return g.runWithAPTCache(root, aptInstallCommand(g.SystemPackages),
+		llb.WithCustomNamef("apt-get install %s", strings.Join(g.SystemPackages, " ")),
+		g.sourceLocation(ruleAPTPackages))
 }
 
 // nolint:unparam
@@ -145,27 +279,48 @@ func (g *Graph) compileExtraSource(root llb.State) (llb.State, error) {
 	return llb.Merge(inputs, llb.WithCustomName("[internal] build source layers")), nil
 }
 
+// requiredBuiltinSystemPackages cannot be removed from the builtin system
+// packages since the entrypoint and the prompt installation depend on them.
+var requiredBuiltinSystemPackages = []string{"curl", "sudo", "tini"}
+
+// builtinSystemPackages returns the builtin system packages overridden by
+// config.builtin_system_packages. It does not modify types.BaseAptPackage.
+func (g Graph) builtinSystemPackages() []string {
+	excluded := make(map[string]bool, len(g.ExcludedBuiltinSystemPackages))
+	for _, pkg := range g.ExcludedBuiltinSystemPackages {
+		excluded[pkg] = true
+	}
+	all := append(append([]string{}, types.BaseAptPackage...), g.ExtraBuiltinSystemPackages...)
+	pkgs := []string{}
+	for _, pkg := range all {
+		if excluded[pkg] {
+			continue
+		}
+		excluded[pkg] = true
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
+
 func (g *Graph) preparePythonBase(root llb.State) llb.State {
 	for _, env := range types.BaseEnvironment {
 		root = root.AddEnv(env.Name, env.Value)
 	}
 
 	// apt packages
-	var sb strings.Builder
-	sb.WriteString("apt-get update && apt-get install -y apt-utils && ")
-	sb.WriteString("apt-get install -y --no-install-recommends --no-install-suggests --fix-missing ")
-	sb.WriteString(strings.Join(types.BaseAptPackage, " "))
-	sb.WriteString("&& rm -rf /var/lib/apt/lists/* ")
-	// shell prompt
-	sb.WriteString("&& curl --proto '=https' --tlsv1.2 -sSf https://starship.rs/install.sh | sh -s -- -y")
-
-	run := root.Run(llb.Shlex(fmt.Sprintf("bash -c \"%s\"", sb.String())),
+	root = g.runWithAPTCache(root,
+		aptInstallCommand(append([]string{"apt-utils"}, g.builtinSystemPackages()...)),
 		llb.WithCustomName("[internal] install system packages"))
-
+	// shell prompt
+	run := root.Run(llb.Shlex(fmt.Sprintf("bash -c \"%s\"", starshipInstallCommand)),
+		llb.WithCustomName("[internal] install starship"))
 	return run.Root()
 }
 
 func (g Graph) compileSshd(root llb.State) llb.State {
+	if !g.devTarget() {
+		return root
+	}
 	sshd := root.File(llb.Copy(
 		llb.Image(types.EnvdSshdImage), "/usr/bin/envd-sshd", "/var/envd/bin/envd-sshd",
 		&llb.CopyInfo{CreateDestPath: true}),
@@ -174,7 +329,7 @@ func (g Graph) compileSshd(root llb.State) llb.State {
 }
 
 func (g *Graph) compileBase() (llb.State, error) {
-	logger := logrus.WithFields(logrus.Fields{
+	logger := log.WithFields(log.Fields{
 		"os":       g.OS,
 		"language": g.Language.Name,
 	})
@@ -182,6 +337,9 @@ func (g *Graph) compileBase() (llb.State, error) {
 		logger = logger.WithField("version", *g.Language.Version)
 	}
 	logger.Debug("compile base image")
+	if err := g.validateOSCombination(); err != nil {
+		return llb.State{}, err
+	}
 
 	var base llb.State
 	org := viper.GetString(flag.FlagDockerOrganization)
@@ -189,11 +347,26 @@ func (g *Graph) compileBase() (llb.State, error) {
 	// Do not update user permission in the base image.
 	if g.Image != nil {
 		logger.WithField("image", *g.Image).Debugf("using custom base image")
-		return llb.Image(*g.Image), nil
+		return g.prepareImage(*g.Image)
+	} else if g.BaseDockerfile != nil {
+		if g.Language.Name != "python" {
+			return llb.State{}, errors.Newf(
+				"importing the Dockerfile is not supported in %s yet", g.Language.Name)
+		}
+		logger.WithField("dockerfile", g.BaseDockerfile.Path).Debug("using the imported Dockerfile")
+		root, err := g.compileBaseDockerfile()
+		if err != nil {
+			return llb.State{}, err
+		}
+		base = g.preparePythonBase(root)
 	} else if g.CUDA == nil {
 		switch g.Language.Name {
 		case "r":
-			base = llb.Image(fmt.Sprintf("docker.io/%s/r-base:4.2-envd-%s", org, v))
+			root, err := g.prepareImage(fmt.Sprintf("docker.io/%s/r-base:4.2-envd-%s", org, v))
+			if err != nil {
+				return llb.State{}, err
+			}
+			base = root
 			// r-base image already has GID 1000.
 			// It is a trick, we actually use GID 1000
 			if g.gid == 1000 {
@@ -203,14 +376,29 @@ func (g *Graph) compileBase() (llb.State, error) {
 				g.uid = 1001
 			}
 		case "python":
-			// TODO(keming) use user input `base(os="")`
-			base = g.preparePythonBase(llb.Image(types.PythonBaseImage))
+			image, err := g.osImage()
+			if err != nil {
+				return llb.State{}, err
+			}
+			root, err := g.prepareImage(image)
+			if err != nil {
+				return llb.State{}, err
+			}
+			base = g.preparePythonBase(root)
 		case "julia":
-			base = llb.Image(fmt.Sprintf(
+			root, err := g.prepareImage(fmt.Sprintf(
 				"docker.io/%s/julia:1.8rc1-ubuntu20.04-envd-%s", org, v))
+			if err != nil {
+				return llb.State{}, err
+			}
+			base = root
 		}
 	} else {
-		base = g.compileCUDAPackages("nvidia/cuda")
+		root, err := g.compileCUDAPackages("nvidia/cuda")
+		if err != nil {
+			return llb.State{}, err
+		}
+		base = root
 	}
 
 	base = g.compileUserGroup(base)
@@ -223,17 +411,18 @@ func (g *Graph) compileBase() (llb.State, error) {
 }
 
 func (g Graph) copySSHKey(root llb.State) (llb.State, error) {
-	public := DefaultGraph.PublicKeyPath
-	bdat, err := os.ReadFile(public)
-	dat := strings.TrimSuffix(string(bdat), "\n")
+	if !g.devTarget() {
+		return root, nil
+	}
+	dat, err := g.authorizedKeys(DefaultGraph.PublicKeyPath)
 	if err != nil {
-		return llb.State{}, errors.Wrap(err, "Cannot read public SSH key")
+		return llb.State{}, err
 	}
 	run := root.
 		File(llb.Mkdir("/var/envd", 0755, llb.WithParents(true),
 			llb.WithUIDGID(g.uid, g.gid))).
 		File(llb.Mkfile(config.ContainerAuthorizedKeysPath,
-			0644, []byte(dat+" envd"), llb.WithUIDGID(g.uid, g.gid)),
+			0644, []byte(dat), llb.WithUIDGID(g.uid, g.gid)),
 			llb.WithCustomName("install ssh keys"))
 	return run, nil
 }
@@ -0,0 +1,244 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+
+	"github.com/tensorchord/envd/pkg/types"
+)
+
+func TestBuiltinSystemPackages(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+	DefaultGraph = NewGraph()
+
+	if err := BuiltinSystemPackages([]string{"htop", "git"}, []string{"vim", "zsh"}); err != nil {
+		t.Fatalf("failed to override the builtin system packages: %v", err)
+	}
+	expected := []string{}
+	for _, pkg := range types.BaseAptPackage {
+		if pkg != "vim" && pkg != "zsh" {
+			expected = append(expected, pkg)
+		}
+	}
+	expected = append(expected, "htop")
+	if actual := DefaultGraph.builtinSystemPackages(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	// The builtin list itself must not be modified.
+	if !reflect.DeepEqual(DefaultGraph.builtinSystemPackages(), expected) {
+		t.Errorf("builtin system packages are not idempotent")
+	}
+
+	if err := BuiltinSystemPackages(nil, []string{"tini"}); err == nil {
+		t.Errorf("expected the error when removing the required package tini")
+	}
+}
+
+func TestCompileJupyterDoesNotModifyGraph(t *testing.T) {
+	pkgs := make([]string, 1, 2)
+	pkgs[0] = "numpy"
+	g := Graph{
+		Language:      Language{Name: "python"},
+		PyPIPackages:  pkgs,
+		JupyterConfig: &JupyterConfig{},
+	}
+
+	copied := g
+	if err := copied.compileJupyter(); err != nil {
+		t.Fatalf("failed to compile jupyter: %v", err)
+	}
+	copied.generateJupyterCommand("test")
+	if g.JupyterConfig.Token != "" {
+		t.Errorf("expected the token not to be modified, got %s", g.JupyterConfig.Token)
+	}
+	if extended := pkgs[:2]; extended[1] != "" {
+		t.Errorf("expected the packages not to be modified, got %v", extended)
+	}
+}
+
+func TestAPTInstallCommand(t *testing.T) {
+	expected := "apt-get update && DEBIAN_FRONTEND=noninteractive " +
+		"apt-get install -y --no-install-recommends htop vim"
+	if actual := aptInstallCommand([]string{"htop", "vim"}); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+	expected = "apt-get update && DEBIAN_FRONTEND=noninteractive " +
+		"apt-get install -y --no-install-recommends 'python3=3.8*' 'libfoo;rm'"
+	if actual := aptInstallCommand([]string{"python3=3.8*", "libfoo;rm"}); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestCompileRunStages(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+
+	if err := Run([]string{"echo a"}, "", nil); err != nil {
+		t.Fatalf("failed to add the run: %v", err)
+	}
+	if err := Run([]string{"echo b"}, "", nil); err != nil {
+		t.Fatalf("failed to add the run: %v", err)
+	}
+	if err := Run([]string{"curl example.com | sh", "echo c"}, " bash -eo pipefail ", nil); err != nil {
+		t.Fatalf("failed to add the run: %v", err)
+	}
+	if err := Run([]string{"echo d"}, "", nil); err != nil {
+		t.Fatalf("failed to add the run: %v", err)
+	}
+	if err := Run([]string{"echo e"}, "  ", nil); err == nil {
+		t.Errorf("expected error for the blank shell")
+	}
+
+	expected := []RunInfo{
+		{Commands: []string{"echo a", "echo b"}},
+		{Commands: []string{"curl example.com | sh", "echo c"}, Shell: "bash -eo pipefail"},
+		{Commands: []string{"echo d"}},
+	}
+	if actual := DefaultGraph.runStages(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	def, err := DefaultGraph.compileRun(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	ops := make(map[string]bool)
+	for _, v := range vertices {
+		ops[v.Op] = true
+	}
+	for _, op := range []string{
+		"exec bash -eo pipefail -c curl example.com | sh\necho c",
+		"exec bash -c echo d",
+	} {
+		if !ops[op] {
+			t.Errorf("expected the op %q, got %v", op, ops)
+		}
+	}
+}
+
+func TestCompileBaseDockerfileProxy(t *testing.T) {
+	g := Graph{
+		ProxyConfig: &ProxyConfig{HTTPProxy: "http://proxy:3128"},
+		BaseDockerfile: &DockerfileBase{
+			Image: "ubuntu:20.04",
+			Steps: []DockerfileStep{
+				{Instruction: dockerfileRun, Args: []string{"apt-get", "update"}},
+			},
+		},
+	}
+	root, err := g.compileBaseDockerfile()
+	if err != nil {
+		t.Fatalf("failed to compile the Dockerfile: %v", err)
+	}
+	def, err := root.Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	var run *pb.ExecOp
+	for _, dt := range def.Def {
+		var op pb.Op
+		if err := op.Unmarshal(dt); err != nil {
+			t.Fatalf("failed to unmarshal the op: %v", err)
+		}
+		if e := op.GetExec(); e != nil {
+			run = e
+		}
+	}
+	if run == nil {
+		t.Fatalf("expected the exec of the RUN")
+	}
+	// The RUN of the base image needs the proxy as well.
+	for _, env := range []string{"http_proxy=http://proxy:3128", "HTTP_PROXY=http://proxy:3128"} {
+		found := false
+		for _, e := range run.Meta.Env {
+			found = found || e == env
+		}
+		if !found {
+			t.Errorf("expected %s in the env, got %v", env, run.Meta.Env)
+		}
+	}
+}
+
+func TestCompileBaseCACertificates(t *testing.T) {
+	cert := filepath.Join(t.TempDir(), "corp.pem")
+	if err := os.WriteFile(cert, []byte("certificate"), 0644); err != nil {
+		t.Fatalf("failed to write the certificate: %v", err)
+	}
+	g := NewGraph()
+	g.CACertificates = []string{cert}
+	base, err := g.compileBase()
+	if err != nil {
+		t.Fatalf("failed to compile the base: %v", err)
+	}
+	def, err := base.Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	inputs := make(map[string][]string)
+	var certs string
+	for _, v := range vertices {
+		inputs[v.Digest] = v.Inputs
+		if v.Name == "[internal] updating ca certificates" {
+			certs = v.Digest
+		}
+	}
+	if certs == "" {
+		t.Fatalf("expected the step of the ca certificates")
+	}
+	var dependsOnCerts func(dgst string) bool
+	dependsOnCerts = func(dgst string) bool {
+		for _, input := range inputs[dgst] {
+			if input == certs || dependsOnCerts(input) {
+				return true
+			}
+		}
+		return false
+	}
+	// The downloads over HTTPS need the certificates behind the
+	// TLS-intercepting proxy.
+	for _, name := range []string{"[internal] install starship", "[internal] install conda"} {
+		found := false
+		for _, v := range vertices {
+			if !strings.HasPrefix(v.Name, name) {
+				continue
+			}
+			found = true
+			if !dependsOnCerts(v.Digest) {
+				t.Errorf("expected %q after the ca certificates", v.Name)
+			}
+		}
+		if !found {
+			t.Errorf("expected the step %q", name)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client/llb"
+
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+const (
+	// tmuxConfigPath is the system config, thus ~/.tmux.conf still takes
+	// precedence over it.
+	tmuxConfigPath = "/etc/tmux.conf"
+	// tmuxScriptPath is sourced by the shell rc, see install.tmux.
+	tmuxScriptPath = "/var/envd/tmux.sh"
+
+	// The agent socket of envd-sshd is removed when the ssh session ends,
+	// thus the shells in tmux use a symlink to the latest one instead.
+	tmuxScript = `# Keep the ssh agent working in the tmux sessions across ssh reconnects.
+if [ -z "$TMUX" ] && [ -S "$SSH_AUTH_SOCK" ] && [ "$SSH_AUTH_SOCK" != "%[1]s" ]; then
+  mkdir -p "$(dirname %[1]s)"
+  ln -sf "$SSH_AUTH_SOCK" %[1]s
+fi
+`
+	tmuxBuiltinConfig = `# Generated by envd from install.tmux in the build file.
+set-environment -g SSH_AUTH_SOCK %s
+set -g update-environment "DISPLAY KRB5CCNAME SSH_ASKPASS SSH_AGENT_PID SSH_CONNECTION WINDOWID XAUTHORITY"
+`
+)
+
+var tmuxAgentSocket = fileutil.EnvdHomeDir(".ssh", "ssh_auth_sock")
+
+type TmuxConfig struct {
+	// ConfigFile is the tmux.conf on the host, which is appended to the
+	// system config in the image.
+	ConfigFile string
+}
+
+// Tmux installs tmux in the image, and optionally bakes the tmux.conf on
+// the host into it.
+func Tmux(configFile string) error {
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return errors.Wrapf(err, "failed to find the tmux config %s", configFile)
+		}
+	}
+	DefaultGraph.TmuxConfig = &TmuxConfig{ConfigFile: configFile}
+	return nil
+}
+
+// tmuxConfig returns the system tmux config, which is followed by the one
+// on the host if it is specified.
+func (g Graph) tmuxConfig() (string, error) {
+	config := fmt.Sprintf(tmuxBuiltinConfig, tmuxAgentSocket)
+	if g.TmuxConfig.ConfigFile == "" {
+		return config, nil
+	}
+	content, err := os.ReadFile(g.TmuxConfig.ConfigFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read the tmux config %s", g.TmuxConfig.ConfigFile)
+	}
+	return config + strings.TrimSuffix(string(content), "\n") + "\n", nil
+}
+
+// compileTmux installs tmux and its system config in the system stage.
+func (g Graph) compileTmux(root llb.State) (llb.State, error) {
+	if g.TmuxConfig == nil {
+		return root, nil
+	}
+	config, err := g.tmuxConfig()
+	if err != nil {
+		return llb.State{}, err
+	}
+	root = g.runWithAPTCache(root, aptInstallCommand([]string{"tmux"}),
+		llb.WithCustomName("[internal] install tmux"))
+	return root.File(llb.Mkfile(tmuxConfigPath, 0644, []byte(config)),
+		llb.WithCustomName("[internal] add the tmux config")), nil
+}
+
+// compileTmuxAgent links the ssh agent socket in the shell rc files, after
+// they are created.
+func (g Graph) compileTmuxAgent(root llb.State) llb.State {
+	if g.TmuxConfig == nil {
+		return root
+	}
+	if g.Image != nil {
+		log.Warn("the ssh agent is not kept in tmux in the custom image")
+		return root
+	}
+	rc := root.File(llb.Mkdir(filepath.Dir(tmuxScriptPath), 0755, llb.WithParents(true)).
+		Mkfile(tmuxScriptPath, 0644, []byte(fmt.Sprintf(tmuxScript, tmuxAgentSocket))),
+		llb.WithCustomName("[internal] add the tmux script"))
+	for _, f := range g.shellRCFiles() {
+		rc = rc.Run(llb.Shlex(fmt.Sprintf(`bash -c 'echo "source %s" >> %s'`,
+			tmuxScriptPath, f)),
+			llb.WithCustomNamef("[internal] source the tmux script in %s", f)).Root()
+	}
+	return rc
+}
+
+// dockerfileTmux is the Dockerfile version of compileTmux.
+func (g Graph) dockerfileTmux(w *dockerfileWriter, aptMounts []string) error {
+	if g.TmuxConfig == nil {
+		return nil
+	}
+	config, err := g.tmuxConfig()
+	if err != nil {
+		return err
+	}
+	w.run(aptInstallCommand([]string{"tmux"}), aptMounts...)
+	w.file(tmuxConfigPath, config, 0, 0)
+	return nil
+}
+
+// dockerfileTmuxAgent is the Dockerfile version of compileTmuxAgent.
+func (g Graph) dockerfileTmuxAgent(w *dockerfileWriter) {
+	if g.TmuxConfig == nil || g.Image != nil {
+		return
+	}
+	w.file(tmuxScriptPath, fmt.Sprintf(tmuxScript, tmuxAgentSocket), 0, 0)
+	for _, f := range g.shellRCFiles() {
+		w.run(fmt.Sprintf(`echo "source %s" >> %s`, tmuxScriptPath, f))
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+)
+
+func TestTmuxConfig(t *testing.T) {
+	defer func() { DefaultGraph = NewGraph() }()
+
+	if err := Tmux(filepath.Join(t.TempDir(), "tmux.conf")); err == nil {
+		t.Errorf("expected error for the missing config")
+	}
+
+	path := filepath.Join(t.TempDir(), "tmux.conf")
+	if err := os.WriteFile(path, []byte("set -g mouse on\n"), 0644); err != nil {
+		t.Fatalf("failed to write the config: %v", err)
+	}
+	if err := Tmux(path); err != nil {
+		t.Fatalf("failed to install tmux: %v", err)
+	}
+	config, err := DefaultGraph.tmuxConfig()
+	if err != nil {
+		t.Fatalf("failed to get the config: %v", err)
+	}
+	if !strings.HasPrefix(config, "# Generated by envd") ||
+		!strings.Contains(config, "set-environment -g SSH_AUTH_SOCK "+tmuxAgentSocket) {
+		t.Errorf("expected the builtin config, got %s", config)
+	}
+	if !strings.HasSuffix(config, "set -g mouse on\n") {
+		t.Errorf("expected the host config at the end, got %s", config)
+	}
+
+	def, err := DefaultGraph.compileTmuxAgent(llb.Image("ubuntu:20.04")).
+		Marshal(context.Background(), llb.LinuxAmd64)
+	if err != nil {
+		t.Fatalf("failed to marshal the state: %v", err)
+	}
+	vertices, err := llbVertices(def)
+	if err != nil {
+		t.Fatalf("failed to get the vertices: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, v := range vertices {
+		names[v.Name] = true
+	}
+	for _, f := range DefaultGraph.shellRCFiles() {
+		if name := "[internal] source the tmux script in " + f; !names[name] {
+			t.Errorf("expected the step %q, got %v", name, names)
+		}
+	}
+}
@@ -15,6 +15,9 @@
 package ir
 
 import (
+	"encoding/json"
+
+	"github.com/moby/buildkit/client/llb"
 	"github.com/opencontainers/go-digest"
 
 	"github.com/tensorchord/envd/pkg/editor/vscode"
@@ -28,51 +31,138 @@ type Graph struct {
 	uid int
 	gid int
 
-	OS string
-	Language
-	Image *string
+	OS       string
+	Language `json:"Language"`
+	Image    *string
 
-	Shell   string
+	Shell string
+	// ShellRC are the snippets appended to the rc files of the shells.
+	ShellRC []string
+	// Direnv hooks direnv into the shells, see install.direnv.
+	Direnv  bool
 	CUDA    *string
 	CUDNN   string
 	NumGPUs int
+	// CUDALibraries are installed from the NVIDIA apt repo, e.g. tensorrt.
+	CUDALibraries []string
 
 	UbuntuAPTSource    *string
+	Timezone           *string
+	Locale             *string
 	CRANMirrorURL      *string
 	JuliaPackageServer *string
 	PyPIIndexURL       *string
 	PyPIExtraIndexURL  *string
 
 	PublicKeyPath string
+	// AuthorizedKeys are the public keys on the host authorized by
+	// envd-sshd besides the envd key, see config.authorized_keys.
+	AuthorizedKeys []string
+	CACertificates []string
+	// KnownHosts are the known_hosts entries baked into the image, see
+	// config.known_hosts.
+	KnownHosts []string `json:"KnownHosts,omitempty"`
+	// DatabaseClients are the clients installed by install.database_clients.
+	DatabaseClients []string `json:"DatabaseClients,omitempty"`
 
-	PyPIPackages     []string
+	PyPIPackages []string
+	// PyPILayers are the groups of PyPI packages installed in their own
+	// layers, thus changing one group does not invalidate the others.
+	PyPILayers       [][]string
 	RequirementsFile *string
+	PipfileFile      *string
 	PythonWheels     []string
 	RPackages        []string
 	JuliaPackages    []string
 	SystemPackages   []string
+	// ExtraBuiltinSystemPackages and ExcludedBuiltinSystemPackages override
+	// the builtin system packages installed in the base image.
+	ExtraBuiltinSystemPackages    []string
+	ExcludedBuiltinSystemPackages []string
 
-	VSCodePlugins   []vscode.Plugin
+	VSCodePlugins []vscode.Plugin
+	// VSCodeMarketplace is where the plugins are downloaded, Open VSX by
+	// default, see config.vscode_marketplace.
+	VSCodeMarketplace *VSCodeMarketplaceConfig `json:"VSCodeMarketplace,omitempty"`
+	// VSCodeVSIXDir is the local directory of the vsix files, which are
+	// installed before the marketplace ones, see envd build --vsix-dir.
+	VSCodeVSIXDir string `json:"-"`
+	// CodeServerConfig starts code-server in the environment, see
+	// config.code_server.
+	CodeServerConfig *CodeServerConfig `json:"CodeServerConfig,omitempty"`
+	// OHMyZSHConfig is the pinned revision and the source of oh-my-zsh, see
+	// config.oh_my_zsh.
+	OHMyZSHConfig *OHMyZSHConfig `json:"OHMyZSHConfig,omitempty"`
+	// VSCodeConfig is the settings and the keybindings of vscode, see
+	// config.vscode.
+	VSCodeConfig    *VSCodeConfig `json:"VSCodeConfig,omitempty"`
 	UserDirectories []string
 
-	Exec       []string
+	Exec       []RunInfo
 	Copy       []CopyInfo
 	Mount      []MountInfo
 	HTTP       []HTTPInfo
 	Entrypoint []string
+	// ReplaceEntrypoint runs the entrypoint instead of the envd-sshd.
+	ReplaceEntrypoint bool
+	// BaseDockerfile is the imported Dockerfile used as the base image.
+	BaseDockerfile *DockerfileBase
+	// SourceDateEpoch is set in the reproducible build.
+	SourceDateEpoch *int64
+	// Lock is the lockfile used in the build, see envd lock.
+	Lock *Lock `json:"Lock,omitempty"`
+	// RemoteModules are the git repos loaded by include in the build file.
+	RemoteModules []string `json:"RemoteModules,omitempty"`
+	// LocalModules are the build files loaded by load or include, thus the
+	// image is rebuilt if any of them is updated.
+	LocalModules []string `json:"LocalModules,omitempty"`
+	// ReadFiles are the files read by io.read_file, thus the image is
+	// rebuilt if any of them is updated.
+	ReadFiles []string `json:"ReadFiles,omitempty"`
+	// HostEnv are the names of the host env read by host.getenv.
+	HostEnv []string `json:"HostEnv,omitempty"`
+	// HostGPUs is the number of the host GPUs probed by host.gpu, thus
+	// the image is rebuilt if the GPUs are attached or detached.
+	HostGPUs *int `json:"HostGPUs,omitempty"`
+	// BuildArgs are the arguments passed by envd build --arg, they are
+	// consumed by the interpretation thus not serialized.
+	BuildArgs     map[string]string `json:"-"`
+	usedBuildArgs map[string]bool
+	// SourceLocations are where the rules are invoked in the build file.
+	SourceLocations map[string][]SourceLocation
+	// Deprecations are the deprecated usages of the rules, see envd lint.
+	Deprecations []Deprecation `json:"-"`
+	sourceMaps   map[string]*llb.SourceMap
+
+	*JupyterConfig       `json:"JupyterConfig,omitempty"`
+	*GitConfig           `json:"GitConfig,omitempty"`
+	*ZSHConfig           `json:"ZSHConfig,omitempty"`
+	*BashConfig          `json:"BashConfig,omitempty"`
+	*FishConfig          `json:"FishConfig,omitempty"`
+	*GitLFSConfig        `json:"GitLFSConfig,omitempty"`
+	*PreCommitConfig     `json:"PreCommitConfig,omitempty"`
+	*TmuxConfig          `json:"TmuxConfig,omitempty"`
+	*GitHubCLIConfig     `json:"GitHubCLIConfig,omitempty"`
+	*PipLockConfig       `json:"PipLockConfig,omitempty"`
+	*StageLimitsConfig   `json:"StageLimitsConfig,omitempty"`
+	*CondaConfig         `json:"CondaConfig,omitempty"`
+	*RStudioServerConfig `json:"RStudioServerConfig,omitempty"`
+	*ProxyConfig         `json:"ProxyConfig,omitempty"`
 
-	*JupyterConfig
-	*GitConfig
-	*CondaConfig
-	*RStudioServerConfig
+	// Target is the build target selected by envd build --target.
+	Target string
+	// Minimal omits the dev conveniences, see envd build --minimal.
+	Minimal bool
+	// Sandbox restricts the run stages, see envd build --sandbox.
+	Sandbox bool
 
-	Writer compileui.Writer
+	Writer compileui.Writer `json:"-"`
 	// EnvironmentName is the base name of the environment.
 	// It is the BaseDir(BuildContextDir)
 	// e.g. mnist, streamlit-mnist
 	EnvironmentName string
 
-	RuntimeGraph
+	RuntimeGraph `json:"RuntimeGraph"`
 }
 
 // The results during runtime should be maintained here
@@ -81,6 +171,71 @@ type RuntimeGraph struct {
 	RuntimeDaemon   [][]string
 	RuntimeEnviron  map[string]string
 	RuntimeExpose   []ExposeItem
+	// RuntimeEnvPassthrough is the allow-list of the host env names
+	// (glob patterns) that are copied into the container at start.
+	RuntimeEnvPassthrough []string
+	// RuntimeCron are the jobs run by cron in the environment.
+	RuntimeCron []CronJob
+	// RuntimeDatabases are the connection profiles generated at start.
+	RuntimeDatabases []Database `json:"RuntimeDatabases,omitempty"`
+	// RuntimeTags are the user-defined tags labeled on the container.
+	RuntimeTags map[string]string `json:"-"`
+	// RuntimeLogForward is where the logs of the environment are forwarded,
+	// i.e. journald or the syslog address.
+	RuntimeLogForward string `json:"-"`
+	// RuntimeSSHAgent is the ssh agent socket of the host forwarded into
+	// the environment.
+	RuntimeSSHAgent string `json:"-"`
+	// RuntimeGitConfig is the git config filtered from the host.
+	RuntimeGitConfig string `json:"-"`
+	// RuntimeGitCredentials is the git credentials bridged from the host.
+	RuntimeGitCredentials string `json:"-"`
+}
+
+// DockerfileBase is the result of importing a Dockerfile.
+type DockerfileBase struct {
+	Path  string
+	Image string
+	Steps []DockerfileStep
+}
+
+// DockerfileStep is a supported Dockerfile instruction, i.e. RUN, ENV,
+// COPY and WORKDIR. The args of RUN are always in the exec form.
+type DockerfileStep struct {
+	Instruction string
+	Args        []string
+	// BuildArgs are the ARGs in the scope of RUN in the key=value format,
+	// which are set in its env only, thus they are not kept in the image.
+	BuildArgs []string `json:",omitempty"`
+}
+
+// RunInfo is the commands of a run rule. The commands with the shell are run
+// in their own stage, and the adjacent ones without it are merged.
+type RunInfo struct {
+	Commands []string
+	// Shell runs the commands by <shell> -c, e.g. bash -eo pipefail.
+	Shell string `json:"Shell,omitempty"`
+	// Allow grants the network, the build context or the proxy to the
+	// commands in the sandbox, see envd build --sandbox.
+	Allow []string `json:"Allow,omitempty"`
+}
+
+// UnmarshalJSON accepts the command in the graph of the older envd, in
+// which the run rule is a plain command.
+func (r *RunInfo) UnmarshalJSON(data []byte) error {
+	var command string
+	if err := json.Unmarshal(data, &command); err == nil {
+		*r = RunInfo{Commands: []string{command}}
+		return nil
+	}
+	// The alias drops the method, thus the struct is decoded as usual.
+	type runInfo RunInfo
+	var v runInfo
+	if err := decodeStrict(data, &v); err != nil {
+		return err
+	}
+	*r = RunInfo(v)
+	return nil
 }
 
 type CopyInfo struct {
@@ -121,12 +276,75 @@ type GitConfig struct {
 	Editor string
 }
 
+// ZSHConfig is the oh-my-zsh plugins and theme written in the zshrc.
+type ZSHConfig struct {
+	Plugins []string
+	Theme   string
+}
+
+// OHMyZSHConfig is where oh-my-zsh is installed from, the defaults of
+// shell.Source are used for the empty ones.
+type OHMyZSHConfig struct {
+	// Revision is the branch, the tag or the commit.
+	Revision string `json:"Revision,omitempty"`
+	// URL is the git repository, e.g. the internal mirror.
+	URL string `json:"URL,omitempty"`
+	// Tarball is the local archive installed if the repository is
+	// unreachable. It is the host path thus not serialized.
+	Tarball string `json:"-"`
+}
+
+// BashConfig is the bash-it plugins and theme, bash-it is installed if
+// any of them is set.
+type BashConfig struct {
+	Plugins []string
+	Theme   string
+}
+
+// bashIt returns true if bash-it is installed.
+func (c BashConfig) bashIt() bool {
+	return len(c.Plugins) != 0 || c.Theme != ""
+}
+
+// FishConfig is the fisher plugins installed in the build.
+type FishConfig struct {
+	Plugins []string
+}
+
+// ProxyConfig is the proxy used in the build process.
+type ProxyConfig struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// APTProxy is the caching proxy only for apt, e.g. apt-cacher-ng.
+	APTProxy string
+	// PyPIProxy is the caching PyPI index only used in the build process.
+	PyPIProxy string
+}
+
 type ExposeItem struct {
 	EnvdPort    int
 	HostPort    int
 	ServiceName string
 }
 
+// VSCodeMarketplaceConfig is the marketplace vendor of the vscode plugins,
+// and the url of its mirror if it is not empty.
+type VSCodeMarketplaceConfig struct {
+	Vendor string
+	URL    string
+}
+
+// VSCodeConfig is the machine settings and the user keybindings of vscode
+// shipped with the environment.
+type VSCodeConfig struct {
+	Settings    map[string]interface{}   `json:"Settings,omitempty"`
+	Keybindings []map[string]interface{} `json:"Keybindings,omitempty"`
+	// ServerVersion is the VS Code version whose vscode-server is installed,
+	// thus VS Code does not download it on the first connection.
+	ServerVersion string `json:"ServerVersion,omitempty"`
+}
+
 type JupyterConfig struct {
 	Token string
 	Port  int64
@@ -135,4 +353,5 @@ type JupyterConfig struct {
 const (
 	shellBASH = "bash"
 	shellZSH  = "zsh"
+	shellFish = "fish"
 )
@@ -17,14 +17,24 @@ package ir
 import (
 	"encoding/json"
 	"os/user"
+	"path"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/cockroachdb/errors"
 
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
+// devTarget returns true if the dev tools, e.g. envd-sshd, are installed.
+func (g Graph) devTarget() bool {
+	if g.Minimal {
+		return false
+	}
+	return g.Target == "" || g.Target == TargetDev
+}
+
 func (g Graph) getWorkingDir() string {
 	return fileutil.EnvdHomeDir(g.EnvironmentName)
 }
@@ -57,6 +67,25 @@ func parseLanguage(l string) (string, *string, error) {
 	}
 }
 
+// rootlessIDs is the size of the subordinate id range (see /etc/subuid
+// and /etc/subgid) mapped in the user namespace of the rootless builder by
+// default.
+const rootlessIDs = 65536
+
+// rootlessUIDGID returns the uid and the gid of the user in the image built
+// by the rootless builder. The id out of the mapped range (e.g. the LDAP id
+// of the host user) cannot own any file in the image, thus 1000 is used
+// instead.
+func rootlessUIDGID(uid, gid int) (int, int) {
+	if uid >= rootlessIDs {
+		uid = 1000
+	}
+	if gid >= rootlessIDs {
+		gid = 1000
+	}
+	return uid, gid
+}
+
 func getUIDGID() (int, int, error) {
 	user, err := user.Current()
 	if err != nil {
@@ -93,5 +122,25 @@ func (rg *RuntimeGraph) Load(code []byte) error {
 	rg.RuntimeDaemon = newrg.RuntimeDaemon
 	rg.RuntimeEnviron = newrg.RuntimeEnviron
 	rg.RuntimeExpose = newrg.RuntimeExpose
+	rg.RuntimeEnvPassthrough = newrg.RuntimeEnvPassthrough
 	return nil
 }
+
+// PassthroughEnviron returns the host env in the form of key=value,
+// whose key matches any of the passthrough patterns.
+func (rg RuntimeGraph) PassthroughEnviron(environ []string) []string {
+	envs := []string{}
+	for _, kv := range environ {
+		key, _, found := strings.Cut(kv, "=")
+		if !found || key == "" {
+			continue
+		}
+		for _, pattern := range rg.RuntimeEnvPassthrough {
+			if ok, _ := path.Match(pattern, key); ok {
+				envs = append(envs, kv)
+				break
+			}
+		}
+	}
+	return envs
+}
@@ -76,3 +76,52 @@ func TestParseLanguage(t *testing.T) {
 
 	}
 }
+
+func TestPassthroughEnviron(t *testing.T) {
+	rg := RuntimeGraph{
+		RuntimeEnvPassthrough: []string{"WANDB_*", "HF_TOKEN"},
+	}
+	environ := []string{
+		"WANDB_API_KEY=key",
+		"WANDB_MODE=offline",
+		"HF_TOKEN=token",
+		"HF_TOKEN_PATH=/tmp",
+		"HOME=/home/envd",
+	}
+	expected := []string{
+		"WANDB_API_KEY=key",
+		"WANDB_MODE=offline",
+		"HF_TOKEN=token",
+	}
+
+	envs := rg.PassthroughEnviron(environ)
+	if len(envs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, envs)
+	}
+	for i := range expected {
+		if envs[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], envs[i])
+		}
+	}
+}
+
+func TestRootlessUIDGID(t *testing.T) {
+	tcs := []struct {
+		id       int
+		expected int
+	}{
+		{0, 0},
+		{1001, 1001},
+		{65535, 65535},
+		{65536, 1000},
+		{1234567890, 1000},
+	}
+	for _, tc := range tcs {
+		if uid, _ := rootlessUIDGID(tc.id, 0); uid != tc.expected {
+			t.Errorf("uid %d: expected %d, got %d", tc.id, tc.expected, uid)
+		}
+		if _, gid := rootlessUIDGID(0, tc.id); gid != tc.expected {
+			t.Errorf("gid %d: expected %d, got %d", tc.id, tc.expected, gid)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Fields is the structured fields of the log entry.
+type Fields = logrus.Fields
+
+// Entry is the logger with the fields, e.g. returned by WithField.
+type Entry = logrus.Entry
+
+// WithField returns the entry with the field of the standard logger.
+func WithField(key string, value interface{}) *Entry {
+	return logrus.WithField(key, value)
+}
+
+// WithFields returns the entry with the fields of the standard logger.
+func WithFields(fields Fields) *Entry {
+	return logrus.WithFields(fields)
+}
+
+// WithError returns the entry with the error of the standard logger.
+func WithError(err error) *Entry {
+	return logrus.WithError(err)
+}
+
+func Debug(args ...interface{}) {
+	logrus.Debug(args...)
+}
+
+func Debugf(format string, args ...interface{}) {
+	logrus.Debugf(format, args...)
+}
+
+func Info(args ...interface{}) {
+	logrus.Info(args...)
+}
+
+func Infof(format string, args ...interface{}) {
+	logrus.Infof(format, args...)
+}
+
+func Infoln(args ...interface{}) {
+	logrus.Infoln(args...)
+}
+
+func Warn(args ...interface{}) {
+	logrus.Warn(args...)
+}
+
+func Warnf(format string, args ...interface{}) {
+	logrus.Warnf(format, args...)
+}
+
+func Error(args ...interface{}) {
+	logrus.Error(args...)
+}
+
+func Errorf(format string, args ...interface{}) {
+	logrus.Errorf(format, args...)
+}
+
+// Fatal logs the message and exits with the code 1.
+func Fatal(args ...interface{}) {
+	logrus.Fatal(args...)
+}
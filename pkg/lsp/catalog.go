@@ -0,0 +1,225 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// function is the rule documented in the API stubs, e.g. envd/api/install.
+type function struct {
+	// Module is empty for the global rules, e.g. base.
+	Module string
+	Name   string
+	// Params are the parameters as written in the stub, e.g.
+	// `layer: Optional[str] = None`.
+	Params []string
+	Doc    string
+}
+
+func (f function) qualifiedName() string {
+	if f.Module == "" {
+		return f.Name
+	}
+	return f.Module + "." + f.Name
+}
+
+func (f function) signature() string {
+	return fmt.Sprintf("%s(%s)", f.qualifiedName(), strings.Join(f.Params, ", "))
+}
+
+// paramName returns the name of the parameter without the annotation and
+// the default value.
+func paramName(param string) string {
+	if i := strings.IndexAny(param, ":="); i >= 0 {
+		param = param[:i]
+	}
+	return strings.TrimSpace(param)
+}
+
+// catalog is the rules which the build file could invoke, it is loaded
+// from the API stubs thus the documentation is the same as the website.
+type catalog struct {
+	functions map[string]function
+	modules   []string
+}
+
+func loadCatalog(stubs fs.FS) (*catalog, error) {
+	c := &catalog{functions: make(map[string]function)}
+	err := fs.WalkDir(stubs, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Base(p) != "__init__.py" {
+			return nil
+		}
+		src, err := fs.ReadFile(stubs, p)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the stub %s", p)
+		}
+		module := path.Dir(p)
+		if module == "." {
+			module = ""
+		} else {
+			c.modules = append(c.modules, module)
+		}
+		for _, f := range parseStub(module, string(src)) {
+			c.functions[f.qualifiedName()] = f
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(c.modules)
+	return c, nil
+}
+
+// members returns the functions in the module sorted by the name.
+func (c *catalog) members(module string) []function {
+	functions := []function{}
+	for _, f := range c.functions {
+		if f.Module == module {
+			functions = append(functions, f)
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+	return functions
+}
+
+func (c *catalog) isModule(name string) bool {
+	for _, m := range c.modules {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStub parses the top-level functions and their docstrings in the
+// stub. The stubs only declare the functions, thus the parser does not need
+// to understand python.
+func parseStub(module, src string) []function {
+	functions := []function{}
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	var current *function
+	var header, doc []string
+	inHeader, inDoc := false, false
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case inDoc:
+			trimmed := strings.TrimSpace(line)
+			if strings.HasSuffix(trimmed, `"""`) {
+				doc = append(doc, strings.TrimSuffix(trimmed, `"""`))
+				current.Doc = strings.TrimSpace(strings.Join(doc, "\n"))
+				functions = append(functions, *current)
+				current, inDoc = nil, false
+				continue
+			}
+			doc = append(doc, strings.TrimPrefix(line, "    "))
+			continue
+		case strings.HasPrefix(line, "def "):
+			// The previous function has no docstring.
+			if current != nil {
+				functions = append(functions, *current)
+				current = nil
+			}
+			header = []string{line}
+			inHeader = true
+		case inHeader:
+			header = append(header, line)
+		case current != nil:
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, `"""`) {
+				trimmed = strings.TrimPrefix(trimmed, `"""`)
+				if strings.HasSuffix(trimmed, `"""`) {
+					current.Doc = strings.TrimSuffix(trimmed, `"""`)
+					functions = append(functions, *current)
+					current = nil
+					continue
+				}
+				doc = []string{trimmed}
+				inDoc = true
+				continue
+			}
+			// The function without the docstring.
+			functions = append(functions, *current)
+			current = nil
+			continue
+		default:
+			continue
+		}
+		if strings.HasSuffix(strings.TrimSpace(line), ":") {
+			inHeader = false
+			current = parseHeader(module, strings.Join(header, "\n"))
+		}
+	}
+	if current != nil {
+		functions = append(functions, *current)
+	}
+	return functions
+}
+
+// parseHeader parses the function header, e.g.
+// `def copy(host_path: str, envd_path: str):`.
+func parseHeader(module, header string) *function {
+	header = strings.TrimPrefix(header, "def ")
+	lparen, rparen := strings.Index(header, "("), strings.LastIndex(header, ")")
+	if lparen < 0 || rparen < lparen {
+		return nil
+	}
+	f := &function{
+		Module: module,
+		Name:   strings.TrimSpace(header[:lparen]),
+		Params: []string{},
+	}
+	depth, start := 0, lparen+1
+	for i := lparen + 1; i <= rparen; i++ {
+		switch header[i] {
+		case '[', '(':
+			depth++
+		case ']':
+			depth--
+		case ')':
+			if i != rparen {
+				depth--
+				continue
+			}
+			fallthrough
+		case ',':
+			if depth > 0 {
+				continue
+			}
+			if param := strings.TrimSpace(header[start:i]); param != "" {
+				f.Params = append(f.Params, strings.Join(strings.Fields(param), " "))
+			}
+			start = i + 1
+		}
+	}
+	return f
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tensorchord/envd/envd"
+)
+
+const stub = `"""Install functions
+"""
+
+from typing import List, Optional
+
+
+def apt_packages(name: List[str]):
+    """Install package by system-level package manager (apt on Ubuntu)
+
+    Args:
+        name (str): apt package name list
+    """
+
+
+def python_packages(
+    name: List[str],
+    requirements: str,
+    layer: Optional[str] = None,
+):
+    """Install python package by pip"""
+
+
+def vscode_extensions(name: List[str]):
+    pass
+
+
+def cuda(version: str, cudnn: Optional[str] = "8"):
+    """Install CUDA
+
+    Example usage:
+    ` + "```" + `
+    def build():
+        install.cuda(version="11.6.2")
+    ` + "```" + `
+    """
+`
+
+func TestParseStub(t *testing.T) {
+	functions := parseStub("install", stub)
+	expected := []function{
+		{
+			Module: "install",
+			Name:   "apt_packages",
+			Params: []string{"name: List[str]"},
+			Doc: "Install package by system-level package manager (apt on Ubuntu)\n\n" +
+				"Args:\n    name (str): apt package name list",
+		},
+		{
+			Module: "install",
+			Name:   "python_packages",
+			Params: []string{"name: List[str]", "requirements: str", "layer: Optional[str] = None"},
+			Doc:    "Install python package by pip",
+		},
+		{
+			Module: "install",
+			Name:   "vscode_extensions",
+			Params: []string{"name: List[str]"},
+		},
+		{
+			Module: "install",
+			Name:   "cuda",
+			Params: []string{"version: str", `cudnn: Optional[str] = "8"`},
+			Doc: "Install CUDA\n\nExample usage:\n```\ndef build():\n" +
+				"    install.cuda(version=\"11.6.2\")\n```",
+		},
+	}
+	if !reflect.DeepEqual(functions, expected) {
+		t.Errorf("expected %+v, got %+v", expected, functions)
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	c, err := loadCatalog(envd.ApiStubs())
+	if err != nil {
+		t.Fatalf("failed to load the catalog: %s", err)
+	}
+	for _, name := range []string{"base", "install.python_packages", "config.jupyter", "io.copy"} {
+		if _, ok := c.functions[name]; !ok {
+			t.Errorf("expected the rule %s in the catalog", name)
+		}
+	}
+	if !c.isModule("install") || c.isModule("base") {
+		t.Errorf("expected install to be the module only, got %v", c.modules)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// e.g. `name = ` in `install.python_packages(name = [`
+var keywordPattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s*=($|[^=])`)
+
+// offsetAt returns the byte offset of the position, whose character is
+// counted in the UTF-16 code units as the protocol requires.
+func offsetAt(text string, pos position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+	for units := 0; units < pos.Character && offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '.' || ('a' <= b && b <= 'z') ||
+		('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
+
+// wordBefore returns the dotted identifier before the offset, e.g.
+// `install.py` when the user is typing `install.python_packages`.
+func wordBefore(text string, offset int) string {
+	start := offset
+	for start > 0 && isWordByte(text[start-1]) {
+		start--
+	}
+	return text[start:offset]
+}
+
+func (f function) completionItem() completionItem {
+	return completionItem{
+		Label:         f.Name,
+		Kind:          completionItemKindFunction,
+		Detail:        f.signature(),
+		Documentation: markdown(f.Doc),
+	}
+}
+
+func markdown(doc string) *markupContent {
+	if doc == "" {
+		return nil
+	}
+	return &markupContent{Kind: "markdown", Value: doc}
+}
+
+// complete returns the rules and the modules matching the word before the
+// offset. The members of the module are completed after the dot.
+func (c *catalog) complete(text string, offset int) []completionItem {
+	items := []completionItem{}
+	word := wordBefore(text, offset)
+	if i := strings.LastIndex(word, "."); i >= 0 {
+		module, prefix := word[:i], word[i+1:]
+		if !c.isModule(module) {
+			return items
+		}
+		for _, f := range c.members(module) {
+			if strings.HasPrefix(f.Name, prefix) {
+				items = append(items, f.completionItem())
+			}
+		}
+		return items
+	}
+	for _, m := range c.modules {
+		if strings.HasPrefix(m, word) {
+			items = append(items, completionItem{
+				Label: m,
+				Kind:  completionItemKindModule,
+			})
+		}
+	}
+	for _, f := range c.members("") {
+		if strings.HasPrefix(f.Name, word) {
+			items = append(items, f.completionItem())
+		}
+	}
+	return items
+}
+
+// signatureHelp returns the signature of the rule whose arguments are being
+// typed at the offset, and the parameter of the current argument. The
+// keyword argument selects the parameter by the name, otherwise it is the
+// position of the argument.
+func (c *catalog) signatureHelp(text string, offset int) *signatureHelp {
+	depth, commas, lastComma := 0, 0, -1
+	for i := offset - 1; i >= 0; i-- {
+		switch text[i] {
+		case ')', ']', '}':
+			depth++
+		case ',':
+			if depth == 0 {
+				commas++
+				if lastComma < 0 {
+					lastComma = i
+				}
+			}
+		case '[', '{':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			// The cursor is in the list or the dict argument, the commas
+			// in it do not separate the arguments.
+			commas, lastComma = 0, -1
+		case '(':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			f, ok := c.functions[wordBefore(text, i)]
+			if !ok {
+				return nil
+			}
+			argStart := i + 1
+			if lastComma >= 0 {
+				argStart = lastComma + 1
+			}
+			active := commas
+			if m := keywordPattern.FindStringSubmatch(text[argStart:offset]); m != nil {
+				for j, p := range f.Params {
+					if paramName(p) == m[1] {
+						active = j
+					}
+				}
+			}
+			info := signatureInformation{
+				Label:         f.signature(),
+				Documentation: markdown(f.Doc),
+				Parameters:    []parameterInformation{},
+			}
+			for _, p := range f.Params {
+				info.Parameters = append(info.Parameters, parameterInformation{Label: p})
+			}
+			return &signatureHelp{
+				Signatures:      []signatureInformation{info},
+				ActiveParameter: active,
+			}
+		}
+	}
+	return nil
+}
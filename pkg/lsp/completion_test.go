@@ -0,0 +1,99 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"strings"
+	"testing"
+)
+
+func testCatalog() *catalog {
+	c := &catalog{
+		functions: make(map[string]function),
+		modules:   []string{"install"},
+	}
+	for _, f := range append(parseStub("install", stub), function{
+		Name:   "base",
+		Params: []string{"os: str", "language: str"},
+	}) {
+		c.functions[f.qualifiedName()] = f
+	}
+	return c
+}
+
+func TestOffsetAt(t *testing.T) {
+	text := "def build():\n    shell(\"😀\")\n"
+	if offset := offsetAt(text, position{Line: 1, Character: 4}); text[offset:offset+5] != "shell" {
+		t.Errorf("expected the offset of shell, got %d", offset)
+	}
+	// The emoji is 2 code units in UTF-16 and 4 bytes in UTF-8.
+	if offset := offsetAt(text, position{Line: 1, Character: 13}); text[offset:] != "\")\n" {
+		t.Errorf("expected the offset after the emoji, got %d", offset)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	c := testCatalog()
+	tcs := []struct {
+		text     string
+		expected []string
+	}{
+		{"    install.", []string{"apt_packages", "cuda", "python_packages", "vscode_extensions"}},
+		{"    install.py", []string{"python_packages"}},
+		{"    ins", []string{"install"}},
+		{"    ba", []string{"base"}},
+		{"    unknown.", []string{}},
+	}
+	for _, tc := range tcs {
+		labels := []string{}
+		for _, item := range c.complete(tc.text, len(tc.text)) {
+			labels = append(labels, item.Label)
+		}
+		if strings.Join(labels, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("%q: expected %v, got %v", tc.text, tc.expected, labels)
+		}
+	}
+}
+
+func TestSignatureHelp(t *testing.T) {
+	c := testCatalog()
+	tcs := []struct {
+		text     string
+		label    string
+		expected int
+	}{
+		{`    install.python_packages(`, "install.python_packages", 0},
+		{`    install.python_packages(["numpy", "pandas"], `, "install.python_packages", 1},
+		{`    install.python_packages(name=["numpy", `, "install.python_packages", 0},
+		{`    install.python_packages(layer="package", name=[`, "install.python_packages", 0},
+		{`    install.python_packages(name=["numpy"], layer=`, "install.python_packages", 2},
+		{`    base(os="ubuntu20.04", language=max(1, 2), `, "base", 2},
+	}
+	for _, tc := range tcs {
+		help := c.signatureHelp(tc.text, len(tc.text))
+		if help == nil {
+			t.Errorf("%q: expected the signature help", tc.text)
+			continue
+		}
+		if !strings.HasPrefix(help.Signatures[0].Label, tc.label+"(") ||
+			help.ActiveParameter != tc.expected {
+			t.Errorf("%q: expected %s with the parameter %d, got %+v", tc.text,
+				tc.label, tc.expected, help)
+		}
+	}
+	if help := c.signatureHelp(`    unknown(`, 12); help != nil {
+		t.Errorf("expected no signature help of the unknown function, got %+v", help)
+	}
+}
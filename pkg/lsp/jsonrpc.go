@@ -0,0 +1,131 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// The error codes of JSON-RPC 2.0 used by the server.
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// message is the request or the notification of JSON-RPC 2.0, the
+// notification has no ID.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// response has either the result, which may be null, or the error.
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+// conn reads and writes the messages framed by the Content-Length header,
+// see https://microsoft.github.io/language-server-protocol/specifications/base/0.9/specification/
+type conn struct {
+	r  *textproto.Reader
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+func (c *conn) read() (*message, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse the Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, body); err != nil {
+		return nil, errors.Wrap(err, "failed to read the message")
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, &responseError{Code: codeParseError, Message: err.Error()}
+	}
+	return msg, nil
+}
+
+func (c *conn) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the message")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+func (c *conn) reply(id *json.RawMessage, result interface{}, err error) error {
+	resp := &response{JSONRPC: "2.0", ID: id}
+	if err == nil {
+		resp.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		var respErr *responseError
+		if !errors.As(err, &respErr) {
+			respErr = &responseError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Result = nil
+		resp.Error = respErr
+	}
+	return c.write(resp)
+}
+
+func (c *conn) notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the params")
+	}
+	return c.write(&message{JSONRPC: "2.0", Method: method, Params: data})
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestConn(t *testing.T) {
+	in := `{"jsonrpc":"2.0","id":1,"method":"shutdown"}`
+	input := "Content-Length: " + strconv.Itoa(len(in)) + "\r\n\r\n" + in
+	out := &bytes.Buffer{}
+	c := newConn(strings.NewReader(input), out)
+
+	msg, err := c.read()
+	if err != nil {
+		t.Fatalf("failed to read the message: %s", err)
+	}
+	if msg.Method != "shutdown" || string(*msg.ID) != "1" {
+		t.Errorf("expected the shutdown request, got %+v", msg)
+	}
+	if err := c.reply(msg.ID, nil, nil); err != nil {
+		t.Fatalf("failed to reply: %s", err)
+	}
+	// The null result is required in the response without the error.
+	expected := `{"jsonrpc":"2.0","id":1,"result":null}`
+	if out.String() != "Content-Length: "+strconv.Itoa(len(expected))+"\r\n\r\n"+expected {
+		t.Errorf("expected the response %s, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := c.reply(msg.ID, nil, &responseError{Code: codeMethodNotFound, Message: "not found"}); err != nil {
+		t.Fatalf("failed to reply: %s", err)
+	}
+	var resp response
+	body := out.String()[strings.Index(out.String(), "{"):]
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("failed to unmarshal the response: %s", err)
+	}
+	if resp.Error == nil || resp.Error.Code != codeMethodNotFound || resp.Result != nil {
+		t.Errorf("expected the error response, got %s", body)
+	}
+}
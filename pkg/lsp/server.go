@@ -0,0 +1,261 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/envd"
+	"github.com/tensorchord/envd/pkg/lang/frontend/starlark"
+	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/version"
+)
+
+// The build function is executed by the lint on save if it is defined,
+// the shared modules without it are executed at the top level only.
+var buildFuncPattern = regexp.MustCompile(`(?m)^def build\(`)
+
+// Server is the language server of the build file. It provides the
+// completion and the signature help of the rules documented in the API
+// stubs, and the diagnostics of envd lint.
+type Server struct {
+	conn    *conn
+	catalog *catalog
+	// documents are the texts of the opened files by the URI.
+	documents map[string]string
+	logger    *log.Entry
+}
+
+func NewServer(r io.Reader, w io.Writer) (*Server, error) {
+	c, err := loadCatalog(envd.ApiStubs())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the API stubs")
+	}
+	return &Server{
+		conn:      newConn(r, w),
+		catalog:   c,
+		documents: make(map[string]string),
+		logger:    log.WithField("component", "lsp"),
+	}, nil
+}
+
+// Serve handles the messages until the client exits or closes the input.
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.conn.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var respErr *responseError
+			if errors.As(err, &respErr) {
+				if err := s.conn.reply(nil, nil, respErr); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			if err != nil {
+				s.logger.Debugf("failed to handle %s: %s", msg.Method, err)
+			}
+			continue
+		}
+		if err := s.conn.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (interface{}, error) {
+	s.logger.Debugf("handle %s", msg.Method)
+	switch msg.Method {
+	case "initialize":
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync: textDocumentSyncOptions{
+					OpenClose: true,
+					Change:    textDocumentSyncFull,
+					Save:      true,
+				},
+				CompletionProvider: completionOptions{
+					TriggerCharacters: []string{"."},
+				},
+				SignatureHelpProvider: signatureHelpOptions{
+					TriggerCharacters: []string{"(", ","},
+				},
+			},
+			ServerInfo: serverInfo{Name: "envd", Version: version.GetVersion().String()},
+		}, nil
+	case "initialized", "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		s.documents[params.TextDocument.URI] = params.TextDocument.Text
+		return nil, s.publish(params.TextDocument.URI, s.check)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		// The full text is sent on every change, see textDocumentSyncFull.
+		if n := len(params.ContentChanges); n > 0 {
+			s.documents[params.TextDocument.URI] = params.ContentChanges[n-1].Text
+		}
+		return nil, s.publish(params.TextDocument.URI, s.check)
+	case "textDocument/didSave":
+		var params didSaveParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.publish(params.TextDocument.URI, s.lint)
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []diagnostic{},
+		})
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		text := s.documents[params.TextDocument.URI]
+		return s.catalog.complete(text, offsetAt(text, params.Position)), nil
+	case "textDocument/signatureHelp":
+		var params textDocumentPositionParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		text := s.documents[params.TextDocument.URI]
+		return s.catalog.signatureHelp(text, offsetAt(text, params.Position)), nil
+	}
+	if strings.HasPrefix(msg.Method, "$/") {
+		// The optional notifications, e.g. $/cancelRequest.
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func unmarshalParams(msg *message, v interface{}) error {
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// check reports the syntax errors and the unknown functions of the text
+// being edited.
+func (s *Server) check(filename, text string) []starlark.Diagnostic {
+	return starlark.Check(filename, []byte(text))
+}
+
+// lint executes the saved file in the sandbox as envd lint does.
+func (s *Server) lint(filename, text string) []starlark.Diagnostic {
+	ir.DefaultGraph = ir.NewGraph()
+	defer func() {
+		ir.DefaultGraph = ir.NewGraph()
+	}()
+	ir.Target(ir.TargetDev)
+	funcname := ""
+	if buildFuncPattern.MatchString(text) {
+		funcname = "build"
+	}
+	return starlark.Lint(filename, funcname)
+}
+
+// publish sends the diagnostics of the document, the ones in the modules
+// loaded by it are skipped.
+func (s *Server) publish(uri string,
+	diagnose func(filename, text string) []starlark.Diagnostic) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return errors.Newf("unsupported document URI %s", uri)
+	}
+	text := s.documents[uri]
+	diagnostics := []diagnostic{}
+	for _, d := range diagnose(u.Path, text) {
+		if d.Filename != u.Path {
+			continue
+		}
+		severity := diagnosticSeverityWarning
+		if d.Severity == starlark.SeverityError {
+			severity = diagnosticSeverityError
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    diagnosticRange(text, d),
+			Severity: severity,
+			Source:   "envd",
+			Message:  d.Message,
+		})
+	}
+	return s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// diagnosticRange returns the range from the column to the end of the word
+// at it, or the whole line if the column is unknown. The column of starlark
+// is counted in the runes.
+func diagnosticRange(text string, d starlark.Diagnostic) rangeT {
+	line := d.Line - 1
+	if line < 0 {
+		line = 0
+	}
+	var runes []rune
+	if lines := strings.Split(text, "\n"); line < len(lines) {
+		runes = []rune(lines[line])
+	}
+	if d.Column <= 0 {
+		return rangeT{
+			Start: position{Line: line},
+			End:   position{Line: line, Character: len(utf16.Encode(runes))},
+		}
+	}
+	start := d.Column - 1
+	if start > len(runes) {
+		start = len(runes)
+	}
+	end := start
+	for end < len(runes) && runes[end] < utf8.RuneSelf && isWordByte(byte(runes[end])) {
+		end++
+	}
+	return rangeT{
+		Start: position{Line: line, Character: len(utf16.Encode(runes[:start]))},
+		End:   position{Line: line, Character: len(utf16.Encode(runes[:end]))},
+	}
+}
@@ -17,9 +17,8 @@ package metrics
 import (
 	"context"
 
-	"github.com/sirupsen/logrus"
-
 	"github.com/tensorchord/envd/pkg/docker"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 type dockerCollector struct {
@@ -55,7 +54,7 @@ func (c *dockerCollector) Watch(ctx context.Context, cid string) chan Metrics {
 		defer close(stats)
 		err := c.client.Stats(ctx, cid, stats, c.done)
 		if err != nil {
-			logrus.Error(err)
+			log.Error(err)
 		}
 		c.running = false
 	}()
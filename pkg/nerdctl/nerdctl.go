@@ -0,0 +1,89 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nerdctl runs the nerdctl CLI, which manages the containers and the
+// images in containerd with the docker compatible commands.
+package nerdctl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/errdefs"
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+const binary = "nerdctl"
+
+type Client interface {
+	// Output runs the nerdctl command, and returns the stdout.
+	Output(ctx context.Context, args ...string) ([]byte, error)
+	// Load loads the docker image archive from the reader into containerd.
+	Load(ctx context.Context, r io.Reader) error
+}
+
+type generalClient struct {
+	// address is the containerd socket, nerdctl uses its default if empty.
+	address string
+}
+
+// NewClient returns the client of the containerd at the address.
+func NewClient(address string) (Client, error) {
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, errdefs.Wrap(err, errdefs.NerdctlUnavailable)
+	}
+	return generalClient{address: address}, nil
+}
+
+// IsErrNotFound returns true if the container or the image does not exist.
+func IsErrNotFound(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "no such")
+}
+
+func (c generalClient) command(ctx context.Context, args ...string) *exec.Cmd {
+	if c.address != "" {
+		args = append([]string{"--address", c.address}, args...)
+	}
+	log.WithField("args", args).Debug("running nerdctl")
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+func (c generalClient) Output(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := c.command(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to run nerdctl %s: %s",
+			args[0], strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (c generalClient) Load(ctx context.Context, r io.Reader) error {
+	cmd := c.command(ctx, "load")
+	cmd.Stdin = r
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "failed to load the image: %s",
+			strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+type desktop struct{}
+
+// NewDesktop returns the notifier which shows the desktop notification
+// by osascript on macOS and notify-send on Linux.
+func NewDesktop() Notifier {
+	return desktop{}
+}
+
+func (desktop) Notify(ctx context.Context, e Event) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := "display notification " + appleScriptQuote(e.Message()) +
+			" with title " + appleScriptQuote(e.Title())
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	case "linux":
+		cmd = exec.CommandContext(ctx, "notify-send", e.Title(), e.Message())
+	default:
+		return errors.Newf("desktop notification is not supported on %s", runtime.GOOS)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "failed to send the desktop notification: %s", out)
+	}
+	return nil
+}
+
+func appleScriptQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notify sends the desktop and webhook notifications when the
+// build is finished, since long builds often finish while users are elsewhere.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tensorchord/envd/pkg/formatter"
+)
+
+// Event is the result of a build.
+type Event struct {
+	Tag      string
+	Digest   string
+	Duration time.Duration
+	Err      error
+}
+
+// Notifier sends the event to the user.
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Title returns the short summary of the event.
+func (e Event) Title() string {
+	if e.Err != nil {
+		return "envd build failed"
+	}
+	return "envd build succeeded"
+}
+
+// Message returns the details of the event.
+func (e Event) Message() string {
+	duration := formatter.HumanDuration(e.Duration)
+	if e.Err != nil {
+		return fmt.Sprintf("image %s failed after %s: %s", e.Tag, duration, e.Err)
+	}
+	if e.Digest == "" {
+		return fmt.Sprintf("image %s is built in %s", e.Tag, duration)
+	}
+	return fmt.Sprintf("image %s (%s) is built in %s", e.Tag, e.Digest, duration)
+}
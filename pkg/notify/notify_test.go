@@ -0,0 +1,66 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventMessage(t *testing.T) {
+	e := Event{Tag: "test:dev", Digest: "sha256:abc", Duration: 3 * time.Second}
+	assert.Equal(t, "envd build succeeded", e.Title())
+	assert.Equal(t, "image test:dev (sha256:abc) is built in 3.0s", e.Message())
+
+	e.Err = errors.New("oops")
+	assert.Equal(t, "envd build failed", e.Title())
+	assert.Equal(t, "image test:dev failed after 3.0s: oops", e.Message())
+}
+
+func TestWebhook(t *testing.T) {
+	var p payload
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+	}))
+	defer s.Close()
+
+	e := Event{Tag: "test:dev", Digest: "sha256:abc", Duration: time.Minute}
+	require.NoError(t, NewWebhook(s.URL).Notify(context.Background(), e))
+	assert.Equal(t, payload{
+		Text:     "envd build succeeded: image test:dev (sha256:abc) is built in 1m0s",
+		Tag:      "test:dev",
+		Digest:   "sha256:abc",
+		Duration: 60,
+		Success:  true,
+	}, p)
+}
+
+func TestWebhookError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+
+	assert.Error(t, NewWebhook(s.URL).Notify(context.Background(), Event{}))
+}
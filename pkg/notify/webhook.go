@@ -0,0 +1,75 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+)
+
+type webhook struct {
+	url string
+}
+
+// NewWebhook returns the notifier which posts the event to the URL. The
+// payload has the text field, thus it works with the Slack incoming webhook.
+func NewWebhook(url string) Notifier {
+	return webhook{url: url}
+}
+
+type payload struct {
+	Text     string  `json:"text"`
+	Tag      string  `json:"tag"`
+	Digest   string  `json:"digest,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+	Success  bool    `json:"success"`
+	Error    string  `json:"error,omitempty"`
+}
+
+func (w webhook) Notify(ctx context.Context, e Event) error {
+	p := payload{
+		Text:     e.Title() + ": " + e.Message(),
+		Tag:      e.Tag,
+		Digest:   e.Digest,
+		Duration: e.Duration.Seconds(),
+		Success:  e.Err == nil,
+	}
+	if e.Err != nil {
+		p.Error = e.Err.Error()
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the payload")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create the webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send the webhook")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.Newf("webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
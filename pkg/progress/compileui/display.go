@@ -23,9 +23,9 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/containerd/console"
 	"github.com/morikuni/aec"
-	"github.com/sirupsen/logrus"
 
 	"github.com/tensorchord/envd/pkg/editor/vscode"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 type Writer interface {
@@ -91,6 +91,8 @@ func New(ctx context.Context, out console.File, mode string) (Writer, error) {
 }
 
 func (w *generalWriter) LogVSCodePlugin(p vscode.Plugin, action Action, cached bool) {
+	w.result.mu.Lock()
+	defer w.result.mu.Unlock()
 	switch action {
 	case ActionStart:
 		c := time.Now()
@@ -99,18 +101,36 @@ func (w *generalWriter) LogVSCodePlugin(p vscode.Plugin, action Action, cached b
 			startTime: &c,
 			cached:    cached,
 		})
-	case ActionEnd:
+	case ActionEnd, ActionFailed:
 		c := time.Now()
 		for i, plugin := range w.result.plugins {
 			if plugin.String() == p.String() {
 				w.result.plugins[i].endTime = &c
 				w.result.plugins[i].cached = cached
+				w.result.plugins[i].failed = action == ActionFailed
+				if !w.modeConsole {
+					fmt.Fprintln(w.trace.w, pluginStatus(w.result.plugins[i]))
+				}
 			}
 		}
 	}
 }
 
+// pluginStatus returns the status of the plugin download, e.g.
+// " => 💽 (cached) download ms-python.python-2022.8.0".
+func pluginStatus(p *PluginInfo) string {
+	template := " => download %s"
+	if p.failed {
+		template = " => ❌ (failed) download %s"
+	} else if p.cached {
+		template = " => 💽 (cached) download %s"
+	}
+	return fmt.Sprintf(template, p.Plugin)
+}
+
 func (w *generalWriter) LogZSH(action Action, cached bool) {
+	w.result.mu.Lock()
+	defer w.result.mu.Unlock()
 	switch action {
 	case ActionStart:
 		c := time.Now()
@@ -173,6 +193,8 @@ func (w *generalWriter) output(finished bool) {
 		w.phase, time.Since(*w.trace.startTime).Seconds(), statusStr)
 	fmt.Fprint(w.console, s)
 	loc := 0
+	w.result.mu.Lock()
+	defer w.result.mu.Unlock()
 
 	// output shell info.
 	if w.result.ZSHInfo != nil {
@@ -201,19 +223,14 @@ func (w *generalWriter) output(finished bool) {
 			timer = p.endTime.Sub(*p.startTime).Seconds()
 		}
 		timerStr := fmt.Sprintf(" %3.1fs\n", timer)
-		template := " => download %s"
-		if p.cached {
-			template = " => 💽 (cached) download %s"
-		}
-		out := fmt.Sprintf(template, p.Plugin)
-		out = align(out, timerStr, width)
+		out := align(pluginStatus(p), timerStr, width)
 		fmt.Fprint(w.console, out)
 		loc++
 	}
 
 	// override previous content
 	if diff := w.lineCount - loc; diff > 0 {
-		logrus.WithFields(logrus.Fields{
+		log.WithFields(log.Fields{
 			"diff":    diff,
 			"plugins": len(w.result.plugins),
 		}).Debug("override previous content", diff)
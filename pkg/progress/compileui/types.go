@@ -15,6 +15,7 @@
 package compileui
 
 import (
+	"sync"
 	"time"
 
 	"github.com/tensorchord/envd/pkg/editor/vscode"
@@ -25,9 +26,13 @@ type Action string
 const (
 	ActionStart Action = "start"
 	ActionEnd   Action = "end"
+	// ActionFailed ends the action which is failed.
+	ActionFailed Action = "failed"
 )
 
 type Result struct {
+	// mu guards the result, since the plugins are downloaded concurrently.
+	mu      sync.Mutex
 	plugins []*PluginInfo
 	ZSHInfo *ZSHInfo
 }
@@ -37,6 +42,7 @@ type PluginInfo struct {
 	startTime *time.Time
 	endTime   *time.Time
 	cached    bool
+	failed    bool
 }
 
 type ZSHInfo struct {
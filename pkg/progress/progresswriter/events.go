@@ -0,0 +1,187 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progresswriter
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+// The types of the events in the event stream.
+const (
+	EventBuildStarted  = "build.started"
+	EventBuildFinished = "build.finished"
+	EventStageStarted  = "stage.started"
+	EventStageFinished = "stage.finished"
+	EventStageProgress = "stage.progress"
+	EventEnvStarted    = "env.started"
+	EventEnvReady      = "env.ready"
+)
+
+// Event is one line of the event stream, which is consumed by the wrappers
+// (e.g. the IDE plugins) to render their own progress.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	Stage string    `json:"stage,omitempty"`
+	// ID is the vertex digest of the stage, or the ID of the progress
+	// (e.g. the layer being downloaded) in the stage.progress event.
+	ID      string            `json:"id,omitempty"`
+	Current int64             `json:"current,omitempty"`
+	Total   int64             `json:"total,omitempty"`
+	Cached  bool              `json:"cached,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// EventStream writes the events as JSON lines. The nil stream discards
+// the events, thus the callers do not need to check if it is enabled.
+type EventStream struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+func NewEventStream(w io.WriteCloser) *EventStream {
+	return &EventStream{w: w, enc: json.NewEncoder(w)}
+}
+
+// OpenEventStream opens the event stream on the file descriptor inherited
+// from the parent process, or the unix socket. It returns nil if neither
+// is set.
+func OpenEventStream(fd int, socket string) (*EventStream, error) {
+	switch {
+	case fd > 0 && socket != "":
+		return nil, errors.New("only one of the events fd and the events socket can be set")
+	case fd > 0:
+		f := os.NewFile(uintptr(fd), "envd-events")
+		if f == nil {
+			return nil, errors.Newf("invalid events fd %d", fd)
+		}
+		return NewEventStream(f), nil
+	case socket != "":
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to connect to the events socket %s", socket)
+		}
+		return NewEventStream(conn), nil
+	}
+	return nil, nil
+}
+
+// Emit writes the event. The failure is logged only, the consumer going
+// away does not fail the build.
+func (s *EventStream) Emit(e Event) {
+	if s == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(e); err != nil {
+		log.Debugf("failed to write the event %s: %s", e.Type, err)
+	}
+}
+
+func (s *EventStream) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Close()
+}
+
+type eventTee struct {
+	Writer
+	status chan *client.SolveStatus
+}
+
+func (t *eventTee) Status() chan *client.SolveStatus {
+	return t.status
+}
+
+// TeeEvents emits the stage events of the solve status to the stream, and
+// forwards the status to the writer.
+func TeeEvents(w Writer, s *EventStream) Writer {
+	if s == nil {
+		return w
+	}
+	st := make(chan *client.SolveStatus)
+	t := &eventTee{
+		status: st,
+		Writer: w,
+	}
+	go func() {
+		// The vertex is sent again on every update, only the first
+		// start and completion are emitted.
+		started := make(map[digest.Digest]bool)
+		completed := make(map[digest.Digest]bool)
+		for v := range st {
+			for _, vtx := range v.Vertexes {
+				if vtx.Started != nil && !started[vtx.Digest] {
+					started[vtx.Digest] = true
+					s.Emit(Event{
+						Time:  *vtx.Started,
+						Type:  EventStageStarted,
+						Stage: vtx.Name,
+						ID:    vtx.Digest.String(),
+					})
+				}
+				if vtx.Completed != nil && !completed[vtx.Digest] {
+					completed[vtx.Digest] = true
+					s.Emit(Event{
+						Time:   *vtx.Completed,
+						Type:   EventStageFinished,
+						Stage:  vtx.Name,
+						ID:     vtx.Digest.String(),
+						Cached: vtx.Cached,
+						Error:  vtx.Error,
+					})
+				}
+			}
+			for _, status := range v.Statuses {
+				// The status without the total is not the transfer,
+				// e.g. the resolving of the image config.
+				if status.Total == 0 {
+					continue
+				}
+				s.Emit(Event{
+					Time:    status.Timestamp,
+					Type:    EventStageProgress,
+					Stage:   status.Name,
+					ID:      status.ID,
+					Current: status.Current,
+					Total:   status.Total,
+				})
+			}
+			w.Status() <- v
+		}
+		close(w.Status())
+	}()
+	return t
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progresswriter
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestTeeEvents(t *testing.T) {
+	r, pw := io.Pipe()
+	s := NewEventStream(nopWriteCloser{pw})
+	p := &printer{status: make(chan *client.SolveStatus)}
+	w := TeeEvents(p, s)
+
+	a := digest.FromString("a")
+	now := time.Now()
+	go func() {
+		w.Status() <- &client.SolveStatus{Vertexes: []*client.Vertex{
+			{Digest: a, Name: "apt install", Started: &now},
+		}}
+		w.Status() <- &client.SolveStatus{
+			Vertexes: []*client.Vertex{
+				{Digest: a, Name: "apt install", Started: &now},
+			},
+			Statuses: []*client.VertexStatus{
+				{ID: "resolve", Vertex: a},
+				{ID: "sha256:layer", Vertex: a, Current: 10, Total: 20},
+			},
+		}
+		w.Status() <- &client.SolveStatus{Vertexes: []*client.Vertex{
+			{Digest: a, Name: "apt install", Started: &now, Completed: &now, Cached: true},
+		}}
+		close(w.Status())
+	}()
+	go func() {
+		for range p.Status() {
+		}
+		pw.Close()
+	}()
+
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("failed to unmarshal the event: %s", err)
+		}
+		events = append(events, e)
+	}
+	expected := []string{EventStageStarted, EventStageProgress, EventStageFinished}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i, e := range events {
+		if e.Type != expected[i] || e.ID == "" {
+			t.Errorf("expected the event %s, got %+v", expected[i], e)
+		}
+	}
+	if events[1].Current != 10 || events[1].Total != 20 {
+		t.Errorf("expected the progress 10/20, got %+v", events[1])
+	}
+	if !events[2].Cached {
+		t.Errorf("expected the cached stage, got %+v", events[2])
+	}
+}
+
+func TestNilEventStream(t *testing.T) {
+	var s *EventStream
+	s.Emit(Event{Type: EventBuildStarted})
+	if err := s.Close(); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+	p := &printer{}
+	if TeeEvents(p, s) != p {
+		t.Error("expected the writer unchanged with the nil stream")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progresswriter
+
+import (
+	"fmt"
+
+	"github.com/docker/go-units"
+	"github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+)
+
+type logLimiter struct {
+	Writer
+	status chan *client.SolveStatus
+}
+
+func (l *logLimiter) Status() chan *client.SolveStatus {
+	return l.status
+}
+
+// LimitLogs clips the logs of each vertex beyond the max bytes, thus the
+// runaway output does not flood the terminal and the CI logs.
+func LimitLogs(w Writer, max int64) Writer {
+	st := make(chan *client.SolveStatus)
+	l := &logLimiter{
+		status: st,
+		Writer: w,
+	}
+	go func() {
+		sizes := make(map[digest.Digest]int64)
+		for v := range st {
+			logs := make([]*client.VertexLog, 0, len(v.Logs))
+			for _, log := range v.Logs {
+				size := sizes[log.Vertex]
+				if size >= max {
+					continue
+				}
+				sizes[log.Vertex] = size + int64(len(log.Data))
+				if size+int64(len(log.Data)) > max {
+					clipped := *log
+					clipped.Data = append(append([]byte{}, log.Data[:max-size]...),
+						fmt.Sprintf("\n[output clipped, log limit %s reached]\n",
+							units.BytesSize(float64(max)))...)
+					log = &clipped
+				}
+				logs = append(logs, log)
+			}
+			v.Logs = logs
+			w.Status() <- v
+		}
+		close(w.Status())
+	}()
+	return l
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progresswriter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestLimitLogs(t *testing.T) {
+	p := &printer{status: make(chan *client.SolveStatus)}
+	w := LimitLogs(p, 8)
+
+	a, b := digest.FromString("a"), digest.FromString("b")
+	go func() {
+		w.Status() <- &client.SolveStatus{Logs: []*client.VertexLog{
+			{Vertex: a, Data: []byte("12345")},
+			{Vertex: b, Data: []byte("12345")},
+		}}
+		w.Status() <- &client.SolveStatus{Logs: []*client.VertexLog{
+			{Vertex: a, Data: []byte("67890")},
+			{Vertex: a, Data: []byte("abcde")},
+		}}
+		close(w.Status())
+	}()
+
+	logs := make(map[digest.Digest]string)
+	for s := range p.Status() {
+		for _, l := range s.Logs {
+			logs[l.Vertex] += string(l.Data)
+		}
+	}
+	if !strings.HasPrefix(logs[a], "12345678\n[output clipped") || strings.Contains(logs[a], "abcde") {
+		t.Errorf("expected the clipped logs of a, got %q", logs[a])
+	}
+	if logs[b] != "12345" {
+		t.Errorf("expected the logs of b, got %q", logs[b])
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prompt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/term"
+
+	"github.com/tensorchord/envd/pkg/formatter"
+)
+
+// ErrNotInteractive is returned when the confirmation is required but
+// the stdin is not a terminal.
+var ErrNotInteractive = errors.New(
+	"cannot ask for confirmation in non-interactive mode, use --yes to skip it")
+
+// Summary describes exactly what a destructive operation is going to delete.
+type Summary struct {
+	Containers  []string
+	Images      []string
+	Directories []string
+	Volumes     []string
+	// CacheBytes is the size of the build cache to be pruned.
+	CacheBytes int64
+}
+
+// Empty returns true if there is nothing to delete.
+func (s Summary) Empty() bool {
+	return len(s.Containers) == 0 && len(s.Images) == 0 &&
+		len(s.Directories) == 0 && len(s.Volumes) == 0 && s.CacheBytes == 0
+}
+
+func (s Summary) String() string {
+	var b strings.Builder
+	for _, c := range s.Containers {
+		fmt.Fprintf(&b, "  container:   %s\n", c)
+	}
+	for _, i := range s.Images {
+		fmt.Fprintf(&b, "  image:       %s\n", i)
+	}
+	for _, d := range s.Directories {
+		fmt.Fprintf(&b, "  directory:   %s\n", d)
+	}
+	for _, v := range s.Volumes {
+		fmt.Fprintf(&b, "  volume:      %s\n", v)
+	}
+	if s.CacheBytes > 0 {
+		fmt.Fprintf(&b, "  build cache: %s\n", formatter.HumanSize(s.CacheBytes))
+	}
+	return b.String()
+}
+
+// Confirm prints the summary and asks the user whether to continue.
+// It returns true without asking if yes is set or there is nothing to delete.
+func Confirm(s Summary, yes bool) (bool, error) {
+	if yes || s.Empty() {
+		return true, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, ErrNotInteractive
+	}
+	return confirm(os.Stdin, os.Stdout, s)
+}
+
+func confirm(in io.Reader, out io.Writer, s Summary) (bool, error) {
+	fmt.Fprintf(out, "The following resources will be deleted:\n%s", s)
+	fmt.Fprint(out, "Are you sure you want to continue? [y/N] ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, errors.Wrap(err, "failed to read the answer")
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
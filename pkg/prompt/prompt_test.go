@@ -0,0 +1,62 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prompt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirm(t *testing.T) {
+	s := Summary{
+		Containers: []string{"envd"},
+		Images:     []string{"envd:dev"},
+		Volumes:    []string{"envd_state_envd"},
+		CacheBytes: 2048,
+	}
+	testCases := []struct {
+		answer string
+		expect bool
+	}{
+		{"y\n", true},
+		{"Yes\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	}
+	for _, tc := range testCases {
+		var out bytes.Buffer
+		ok, err := confirm(strings.NewReader(tc.answer), &out, s)
+		require.Nil(t, err)
+		require.Equal(t, tc.expect, ok, "answer %q", tc.answer)
+		require.Contains(t, out.String(), "container:   envd")
+		require.Contains(t, out.String(), "image:       envd:dev")
+		require.Contains(t, out.String(), "volume:      envd_state_envd")
+		require.Contains(t, out.String(), "build cache: 2.05kB")
+	}
+}
+
+func TestConfirmSkipped(t *testing.T) {
+	ok, err := Confirm(Summary{Images: []string{"envd:dev"}}, true)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	ok, err = Confirm(Summary{}, false)
+	require.Nil(t, err)
+	require.True(t, ok)
+}
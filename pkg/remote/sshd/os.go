@@ -19,7 +19,8 @@ import (
 	"os/exec"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 var (
@@ -29,10 +30,10 @@ var (
 // GetShell returns the shell in $PATH.
 func GetShell(shell string) error {
 	if path, err := exec.LookPath(shell); err == nil {
-		logrus.Infof("%s exists at %s", shell, path)
+		log.Infof("%s exists at %s", shell, path)
 		return nil
 	}
-	logrus.Debugf("%s does not exist", shell)
+	log.Debugf("%s does not exist", shell)
 
 	return errNoShell
 }
@@ -18,7 +18,6 @@ package sshd
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/exec"
 	"strings"
@@ -32,7 +31,8 @@ import (
 	"github.com/gliderlabs/ssh"
 	"github.com/google/uuid"
 	"github.com/pkg/sftp"
-	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 // LoadAuthorizedKeys loads path as an array.
@@ -95,11 +95,11 @@ func (srv *Server) getServer() (*ssh.Server, error) {
 			"session":      ssh.DefaultSessionHandler,
 		},
 		LocalPortForwardingCallback: ssh.LocalPortForwardingCallback(func(ctx ssh.Context, dhost string, dport uint32) bool {
-			log.Println("Accepted forward", dhost, dport)
+			log.Infoln("Accepted forward", dhost, dport)
 			return true
 		}),
 		ReversePortForwardingCallback: ssh.ReversePortForwardingCallback(func(ctx ssh.Context, host string, port uint32) bool {
-			log.Println("attempt to bind", host, port, "granted")
+			log.Infoln("attempt to bind", host, port, "granted")
 			return true
 		}),
 		RequestHandlers: map[string]ssh.RequestHandler{
@@ -125,7 +125,7 @@ func (srv *Server) getServer() (*ssh.Server, error) {
 	return server, nil
 }
 
-func (srv Server) buildCmd(logger *logrus.Entry, s ssh.Session) *exec.Cmd {
+func (srv Server) buildCmd(logger *log.Entry, s ssh.Session) *exec.Cmd {
 	var cmd *exec.Cmd
 
 	if len(s.RawCommand()) == 0 {
@@ -145,9 +145,7 @@ func (srv Server) buildCmd(logger *logrus.Entry, s ssh.Session) *exec.Cmd {
 func (srv *Server) connectionHandler(s ssh.Session) {
 	// Set session ID as the logger field.
 	sessionID := uuid.New().String()
-	l := logrus.New()
-	l.SetLevel(logrus.GetLevel())
-	logger := l.WithField("session.id", sessionID)
+	logger := log.WithField("session.id", sessionID)
 
 	defer func() {
 		s.Close()
@@ -198,7 +196,7 @@ func (srv *Server) connectionHandler(s ssh.Session) {
 	}
 }
 
-func handlePTY(logger *logrus.Entry, cmd *exec.Cmd, s ssh.Session, ptyReq ssh.Pty, winCh <-chan ssh.Window) error {
+func handlePTY(logger *log.Entry, cmd *exec.Cmd, s ssh.Session, ptyReq ssh.Pty, winCh <-chan ssh.Window) error {
 	if len(ptyReq.Term) > 0 {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("TERM=%s", ptyReq.Term))
 	}
@@ -252,11 +250,11 @@ func setWinSize(f *os.File, w, h int) {
 	_, _, err := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCSWINSZ),
 		uintptr(unsafe.Pointer(&struct{ h, w, x, y uint16 }{uint16(h), uint16(w), 0, 0})))
 	if err != 0 {
-		logrus.WithError(err).Error("failed to set winsize")
+		log.WithError(err).Error("failed to set winsize")
 	}
 }
 
-func sendErrAndExit(logger *logrus.Entry, s ssh.Session, err error) {
+func sendErrAndExit(logger *log.Entry, s ssh.Session, err error) {
 	msg := strings.TrimPrefix(err.Error(), "exec: ")
 	if _, err := s.Stderr().Write([]byte(msg)); err != nil {
 		logger.WithError(err).Errorf("failed to write error back to session")
@@ -289,7 +287,7 @@ func getExitStatusFromError(err error) int {
 	return waitStatus.ExitStatus()
 }
 
-func handleNoTTY(logger *logrus.Entry, cmd *exec.Cmd, s ssh.Session) error {
+func handleNoTTY(logger *log.Entry, cmd *exec.Cmd, s ssh.Session) error {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		logger.WithError(err).Errorf("couldn't get StdoutPipe")
@@ -350,12 +348,12 @@ func handleNoTTY(logger *logrus.Entry, cmd *exec.Cmd, s ssh.Session) error {
 func (srv *Server) authorize(ctx ssh.Context, key ssh.PublicKey) bool {
 	for _, k := range srv.AuthorizedKeys {
 		if ssh.KeysEqual(key, k) {
-			logrus.Debugf("authorized key: %s", k.Type())
+			log.Debugf("authorized key: %s", k.Type())
 			return true
 		}
 	}
 
-	logrus.Debugf("access denied")
+	log.Debugf("access denied")
 	return false
 }
 
@@ -369,13 +367,13 @@ func sftpHandler(sess ssh.Session) {
 		serverOptions...,
 	)
 	if err != nil {
-		logrus.Infof("sftp server init error: %s\n", err)
+		log.Infof("sftp server init error: %s\n", err)
 		return
 	}
 	if err := server.Serve(); errors.Is(err, io.EOF) {
 		server.Close()
-		logrus.Infoln("sftp client exited session.")
+		log.Infoln("sftp client exited session.")
 	} else if err != nil {
-		logrus.Infoln("sftp server completed with error:", err)
+		log.Infoln("sftp server completed with error:", err)
 	}
 }
@@ -0,0 +1,68 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+const (
+	// BashItRepoURL is the git repository of bash-it.
+	BashItRepoURL = "https://github.com/Bash-it/bash-it.git"
+	// BashItDir is the relative path of bash-it in the home dir.
+	BashItDir = ".bash_it"
+)
+
+//go:embed bashrc
+var bashrc string
+
+// BashManager is the bash version of Manager. bash-it is cloned in the
+// build, thus there is no cache of it in the host.
+type BashManager interface {
+	// BashRC renders the bashrc with the sensible defaults, bash-it is
+	// loaded with the theme if it is enabled.
+	BashRC(bashIt bool, theme string) string
+	// EnableCommand returns the bash command which enables the bash-it
+	// plugins, e.g. git, history.
+	EnableCommand(plugins []string) string
+}
+
+type bashManager struct {
+}
+
+func NewBashManager() BashManager {
+	return &bashManager{}
+}
+
+func (m bashManager) BashRC(bashIt bool, theme string) string {
+	if !bashIt {
+		return bashrc
+	}
+	// The prompt of starship is used if the theme is empty.
+	return bashrc + fmt.Sprintf(`
+# bash-it
+export BASH_IT="$HOME/%s"
+export BASH_IT_THEME=%q
+export SCM_CHECK=true
+source "$BASH_IT/bash_it.sh"
+`, BashItDir, theme)
+}
+
+func (m bashManager) EnableCommand(plugins []string) string {
+	return fmt.Sprintf(`export BASH_IT="$HOME/%s" && source "$BASH_IT/bash_it.sh" && bash-it enable plugin %s`,
+		BashItDir, strings.Join(plugins, " "))
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("bash manager", func() {
+	bashManager := NewBashManager()
+	It("should only write the defaults without bash-it", func() {
+		rc := bashManager.BashRC(false, "")
+		Expect(rc).To(ContainSubstring("shopt -s histappend\n"))
+		Expect(rc).NotTo(ContainSubstring("bash_it.sh"))
+	})
+	It("should load bash-it with the theme", func() {
+		rc := bashManager.BashRC(true, "powerline")
+		Expect(rc).To(HavePrefix(bashManager.BashRC(false, "")))
+		Expect(rc).To(ContainSubstring(`export BASH_IT_THEME="powerline"`))
+		Expect(rc).To(HaveSuffix("source \"$BASH_IT/bash_it.sh\"\n"))
+	})
+	It("should enable the plugins", func() {
+		Expect(bashManager.EnableCommand([]string{"git", "history"})).
+			To(HaveSuffix("bash-it enable plugin git history"))
+	})
+})
@@ -0,0 +1,3 @@
+# Generated by envd.
+# Disable the greeting message.
+set -g fish_greeting
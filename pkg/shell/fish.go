@@ -0,0 +1,59 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+const (
+	// FisherURL is fisher, the plugin manager of fish.
+	FisherURL    = "https://raw.githubusercontent.com/jorgebucaran/fisher/main/functions/fisher.fish"
+	fisherPlugin = "jorgebucaran/fisher"
+)
+
+//go:embed config.fish
+var fishConfig string
+
+// FishManager is the fish version of Manager, the plugins are installed by
+// fisher in the build instead of the host cache.
+type FishManager interface {
+	// Config returns the config.fish, which is appended by the prompt and
+	// the conda activation in the build.
+	Config() string
+	// InstallCommand returns the fish command which installs fisher and
+	// the plugins, e.g. PatrickF1/fzf.fish.
+	InstallCommand(plugins []string) string
+}
+
+type fishManager struct {
+}
+
+func NewFishManager() FishManager {
+	return &fishManager{}
+}
+
+func (m fishManager) Config() string {
+	return fishConfig
+}
+
+// InstallCommand keeps fisher itself, thus the plugins can be managed in
+// the environment too.
+func (m fishManager) InstallCommand(plugins []string) string {
+	return fmt.Sprintf("curl -fsSL %s | source && fisher install %s", FisherURL,
+		strings.Join(append([]string{fisherPlugin}, plugins...), " "))
+}
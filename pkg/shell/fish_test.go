@@ -0,0 +1,32 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fish manager", func() {
+	fishManager := NewFishManager()
+	It("should disable the greeting", func() {
+		Expect(fishManager.Config()).To(ContainSubstring("set -g fish_greeting\n"))
+	})
+	It("should install fisher with the plugins", func() {
+		cmd := fishManager.InstallCommand([]string{"PatrickF1/fzf.fish", "jethrokuan/z"})
+		Expect(cmd).To(HavePrefix("curl -fsSL " + FisherURL + " | source && "))
+		Expect(cmd).To(HaveSuffix("fisher install jorgebucaran/fisher PatrickF1/fzf.fish jethrokuan/z"))
+	})
+})
@@ -15,77 +15,459 @@
 package shell
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/cockroachdb/errors"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
-	"github.com/sirupsen/logrus"
+	"github.com/go-git/go-git/v5/plumbing"
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
 
+	"github.com/tensorchord/envd/pkg/bundle"
 	"github.com/tensorchord/envd/pkg/home"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
 const (
-	cacheKey = "oh-my-zsh"
+	// CacheKey is the key of the cached oh-my-zsh.
+	CacheKey = "oh-my-zsh"
+	// revisionFile records the revision of the cached oh-my-zsh.
+	revisionFile = "oh-my-zsh.revision"
+
+	// OHMyZSHRepoURL is the git repository of oh-my-zsh.
+	OHMyZSHRepoURL = "https://github.com/ohmyzsh/ohmyzsh.git"
+	// DefaultOHMyZSHRevision is the oh-my-zsh revision if it is not pinned
+	// by config.oh_my_zsh. The commit is recorded when it is cloned, thus the
+	// builds use it until the cache is updated.
+	DefaultOHMyZSHRevision = "master"
 )
 
+// commitPattern matches the full commit hash, the prefix is not supported.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// gitTransportMu guards the http transports of go-git, which are global.
+var gitTransportMu sync.Mutex
+
 //go:embed install.sh
 var installScript string
 
 //go:embed zshrc
 var zshrc string
 
+// defaultPlugins are the plugins enabled in the zshrc template.
+var defaultPlugins = []string{"git", "ubuntu"}
+
 type Manager interface {
-	ZSHRC() string
+	// ZSHRC renders the zshrc with the oh-my-zsh plugins and the theme,
+	// the defaults in the template are used if they are empty.
+	ZSHRC(plugins []string, theme string) string
 	InstallScript() string
-	DownloadOrCache() (bool, error)
+	// DownloadOrCache clones the pinned revision of oh-my-zsh, it is cloned
+	// again if the revision in the cache is not the pinned one.
+	DownloadOrCache(ctx context.Context) (bool, error)
+	// Update updates the cached oh-my-zsh to the latest commit of the pinned
+	// branch. The tags and the commits are never updated.
+	Update(ctx context.Context) (bool, error)
+	// Revision returns the revision recorded in the cache.
+	Revision() (Revision, error)
+	// Verify verifies the cached oh-my-zsh against the recorded revision.
+	Verify() error
+	// RepoURL returns the git repository of oh-my-zsh, e.g. the mirror.
+	RepoURL() string
 	OHMyZSHDir() string
 }
 
+// Source is where oh-my-zsh is installed from.
+type Source struct {
+	// Revision is the branch, the tag or the commit, DefaultOHMyZSHRevision
+	// if it is empty.
+	Revision string
+	// URL is the git repository, e.g. the internal mirror, OHMyZSHRepoURL
+	// if it is empty.
+	URL string
+	// Tarball is the local archive (.tar.gz) of oh-my-zsh, which is
+	// installed if the repository is unreachable.
+	Tarball string
+	// HTTPClient sends the git requests, e.g. through the proxy. The
+	// default transport of go-git is used if it is nil.
+	HTTPClient *http.Client
+}
+
+// Revision is the pinned revision of oh-my-zsh, i.e. a branch, a tag or a
+// commit, and the commit which it is resolved to when it is cloned. The
+// commit is empty if it is installed from the tarball.
+type Revision struct {
+	Revision string `json:"revision"`
+	Commit   string `json:"commit"`
+	// Tarball is the sha256 of the tarball which it is installed from.
+	Tarball string `json:"tarball,omitempty"`
+}
+
 type generalManager struct {
+	revision   string
+	url        string
+	tarball    string
+	httpClient *http.Client
 }
 
-func NewManager() Manager {
-	return &generalManager{}
+// NewManager returns the manager of oh-my-zsh installed from the source.
+func NewManager(src Source) Manager {
+	m := &generalManager{
+		revision:   src.Revision,
+		url:        src.URL,
+		tarball:    src.Tarball,
+		httpClient: src.HTTPClient,
+	}
+	if m.revision == "" {
+		m.revision = DefaultOHMyZSHRevision
+	}
+	if m.url == "" {
+		m.url = OHMyZSHRepoURL
+	}
+	return m
+}
+
+func (m generalManager) RepoURL() string {
+	return m.url
 }
 
 func (m generalManager) InstallScript() string {
 	return installScript
 }
 
-func (m generalManager) ZSHRC() string {
-	return zshrc
+func (m generalManager) ZSHRC(plugins []string, theme string) string {
+	rc := zshrc
+	if len(plugins) > 0 {
+		rc = strings.Replace(rc,
+			fmt.Sprintf("plugins=(%s)", strings.Join(defaultPlugins, " ")),
+			fmt.Sprintf("plugins=(%s)", strings.Join(plugins, " ")), 1)
+	}
+	if theme != "" {
+		rc = strings.Replace(rc, `# ZSH_THEME="envd"`, fmt.Sprintf("ZSH_THEME=%q", theme), 1)
+	}
+	return rc
 }
 
-func (m generalManager) DownloadOrCache() (bool, error) {
-	if home.GetManager().Cached(cacheKey) {
-		logrus.WithFields(logrus.Fields{
-			"cache-dir": m.OHMyZSHDir(),
-		}).Debug("oh-my-zsh already exists in cache")
-		return true, nil
-	}
-	url := "https://github.com/ohmyzsh/ohmyzsh.git"
-	l := logrus.WithFields(logrus.Fields{
+func (m generalManager) DownloadOrCache(ctx context.Context) (bool, error) {
+	l := log.WithFields(log.Fields{
 		"cache-dir": m.OHMyZSHDir(),
-		"URL":       url,
+		"revision":  m.revision,
 	})
+	unlock, err := fileutil.Lock(ctx, CacheKey)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	if home.GetManager().Cached(CacheKey) {
+		if rev, err := m.Revision(); err == nil && rev.Revision == m.revision {
+			l.Debugf("oh-my-zsh already exists in cache: %s", rev.Commit)
+			return true, touchCache()
+		}
+		l.Debug("the revision of the cached oh-my-zsh is not the pinned one")
+	}
 
 	// Cleanup the cache dir.
 	if fileutil.RemoveAll(m.OHMyZSHDir()) != nil {
 		return false, errors.New("failed to remove oh-my-zsh dir")
 	}
 	l.Debug("cache miss, downloading oh-my-zsh")
+	rev := Revision{Revision: m.revision}
+	var commit string
+	err = m.withHTTPClient(func() (err error) {
+		commit, err = clone(ctx, m.OHMyZSHDir(), m.url, m.revision)
+		return err
+	})
+	if err != nil {
+		if m.tarball == "" {
+			return false, err
+		}
+		l.Warnf("failed to clone oh-my-zsh, installing it from %s: %v", m.tarball, err)
+		if rev.Tarball, err = m.extractTarball(); err != nil {
+			return false, err
+		}
+	}
+	rev.Commit = commit
+	if err := m.writeRevision(rev); err != nil {
+		return false, err
+	}
+
+	if err := home.GetManager().MarkCache(CacheKey, true); err != nil {
+		return false, errors.Wrap(err, "failed to update cache status")
+	}
+	l.Debugf("oh-my-zsh is downloaded: %s", commit)
+	return false, touchCache()
+}
+
+// Update updates the cached oh-my-zsh if there is a new commit in the pinned
+// branch. It returns true if it is updated.
+func (m generalManager) Update(ctx context.Context) (bool, error) {
+	if !home.GetManager().Cached(CacheKey) {
+		return false, nil
+	}
+	l := log.WithFields(log.Fields{
+		"cache-dir": m.OHMyZSHDir(),
+		"revision":  m.revision,
+	})
+	if commitPattern.MatchString(m.revision) {
+		l.Debug("oh-my-zsh is pinned to the commit, skip the update")
+		return false, nil
+	}
+	var latest *plumbing.Reference
+	err := m.withHTTPClient(func() (err error) {
+		latest, err = remoteRef(ctx, m.url, m.revision)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if latest.Name().IsTag() {
+		l.Debug("oh-my-zsh is pinned to the tag, skip the update")
+		return false, nil
+	}
+	// The cache is cloned again if the pinned revision is changed, or it is
+	// installed from the tarball.
+	if rev, err := m.Revision(); err == nil && rev.Revision == m.revision &&
+		rev.Commit == latest.Hash().String() {
+		l.Debugf("oh-my-zsh is up to date: %s", rev.Commit)
+		return false, nil
+	}
+	unlock, err := fileutil.Lock(ctx, CacheKey)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	// The repo is cloned aside and then replaces the cached one, thus
+	// the concurrent builds never see the partial repo.
+	tmp := m.OHMyZSHDir() + ".refresh"
+	if err := fileutil.RemoveAll(tmp); err != nil {
+		return false, errors.Wrapf(err, "failed to remove %s", tmp)
+	}
+	var commit string
+	err = m.withHTTPClient(func() (err error) {
+		commit, err = clone(ctx, tmp, m.url, m.revision)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := fileutil.ReplaceDir(tmp, m.OHMyZSHDir()); err != nil {
+		return false, err
+	}
+	if err := m.writeRevision(Revision{Revision: m.revision, Commit: commit}); err != nil {
+		return false, err
+	}
+	l.Debugf("oh-my-zsh is updated to %s", commit)
+	return true, nil
+}
+
+func (m generalManager) Revision() (Revision, error) {
+	rev := Revision{}
+	data, err := os.ReadFile(m.revisionPath())
+	if err != nil {
+		return rev, errors.Wrap(err, "failed to read the revision of oh-my-zsh")
+	}
+	if err := json.Unmarshal(data, &rev); err != nil {
+		return rev, errors.Wrap(err, "failed to parse the revision of oh-my-zsh")
+	}
+	return rev, nil
+}
+
+func (m generalManager) writeRevision(rev Revision) error {
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the revision of oh-my-zsh")
+	}
+	if err := os.WriteFile(m.revisionPath(), data, 0644); err != nil {
+		return errors.Wrap(err, "failed to record the revision of oh-my-zsh")
+	}
+	return nil
+}
+
+// touchCache records the access of the cached oh-my-zsh and its revision,
+// thus it can be evicted by envd cache gc.
+func touchCache() error {
+	if err := home.GetManager().TouchCache(CacheKey, "oh-my-zsh", revisionFile); err != nil {
+		return errors.Wrap(err, "failed to update cache index")
+	}
+	return nil
+}
+
+func (m generalManager) revisionPath() string {
+	return filepath.Join(home.GetManager().CacheDir(), revisionFile)
+}
+
+// Verify checks that the worktree of the cached oh-my-zsh is clean at the
+// recorded commit, thus the interrupted clone or the modified files are
+// detected. The one installed from the tarball has no git metadata, thus
+// only oh-my-zsh.sh is checked.
+func (m generalManager) Verify() error {
+	rev, err := m.Revision()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(m.OHMyZSHDir(), "oh-my-zsh.sh")); err != nil {
+		return errors.Wrap(err, "failed to find oh-my-zsh.sh")
+	}
+	if rev.Commit == "" {
+		return nil
+	}
+	repo, err := git.PlainOpen(m.OHMyZSHDir())
+	if err != nil {
+		return errors.Wrap(err, "failed to open oh-my-zsh repo")
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the HEAD of oh-my-zsh")
+	}
+	if head.Hash().String() != rev.Commit {
+		return errors.Errorf("the HEAD of oh-my-zsh is %s, expected %s", head.Hash(), rev.Commit)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the worktree of oh-my-zsh")
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the status of oh-my-zsh")
+	}
+	if !status.IsClean() {
+		return errors.Errorf("the worktree of oh-my-zsh is modified:\n%s", status)
+	}
+	return nil
+}
+
+func (m generalManager) OHMyZSHDir() string {
+	return filepath.Join(home.GetManager().CacheDir(), "oh-my-zsh")
+}
+
+// extractTarball installs oh-my-zsh from the tarball, and returns its sha256.
+// The single top-level directory of the archive, e.g. ohmyzsh-master in the
+// GitHub archive, is stripped.
+func (m generalManager) extractTarball() (string, error) {
+	f, err := os.Open(m.tarball)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open the oh-my-zsh tarball")
+	}
+	defer f.Close()
+	h := sha256.New()
+	gr, err := gzip.NewReader(io.TeeReader(f, h))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read the oh-my-zsh tarball %s", m.tarball)
+	}
+	defer gr.Close()
+
+	tmp := m.OHMyZSHDir() + ".tarball"
+	if err := fileutil.RemoveAll(tmp); err != nil {
+		return "", errors.Wrapf(err, "failed to remove %s", tmp)
+	}
+	defer func() {
+		if err := fileutil.RemoveAll(tmp); err != nil {
+			log.Warnf("failed to remove %s: %s", tmp, err)
+		}
+	}()
+	if err := bundle.Extract(gr, tmp); err != nil {
+		return "", errors.Wrapf(err, "failed to extract the oh-my-zsh tarball %s", m.tarball)
+	}
+	// Drain the rest, e.g. the padding, thus the sha256 covers the whole file.
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		return "", errors.Wrapf(err, "failed to read the oh-my-zsh tarball %s", m.tarball)
+	}
+	root := tmp
+	if entries, err := os.ReadDir(tmp); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		root = filepath.Join(tmp, entries[0].Name())
+	}
+	if ok, err := fileutil.FileExists(filepath.Join(root, "oh-my-zsh.sh")); err != nil || !ok {
+		return "", errors.Newf("oh-my-zsh.sh is not found in the tarball %s", m.tarball)
+	}
+	if err := fileutil.ReplaceDir(root, m.OHMyZSHDir()); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// withHTTPClient runs fn with the http transports of go-git sending the
+// requests by the client of the manager, and restores the defaults
+// afterwards, since go-git has no option of the client per request.
+func (m generalManager) withHTTPClient(fn func() error) error {
+	if m.httpClient == nil {
+		return fn()
+	}
+	gitTransportMu.Lock()
+	defer gitTransportMu.Unlock()
+	t := githttp.NewClient(m.httpClient)
+	gitclient.InstallProtocol("http", t)
+	gitclient.InstallProtocol("https", t)
+	defer func() {
+		gitclient.InstallProtocol("http", githttp.DefaultClient)
+		gitclient.InstallProtocol("https", githttp.DefaultClient)
+	}()
+	return fn()
+}
+
+// remoteRef finds the branch or the tag of the revision in oh-my-zsh.
+func remoteRef(ctx context.Context, url, revision string) (*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{url},
+	})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the refs of oh-my-zsh")
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.NewBranchReferenceName(revision) ||
+			ref.Name() == plumbing.NewTagReferenceName(revision) {
+			return ref, nil
+		}
+	}
+	return nil, errors.Newf("revision %s of oh-my-zsh is not found", revision)
+}
 
+// fetchRefSpec returns the refspec of the revision and the local ref which
+// it is fetched to. The branches and the tags are fetched with depth 1, the
+// commit needs the whole history since it cannot be fetched directly.
+func fetchRefSpec(ctx context.Context, url, revision string) (config.RefSpec, plumbing.ReferenceName, int, error) {
+	if commitPattern.MatchString(revision) {
+		return config.RefSpec("+refs/heads/*:refs/remotes/origin/*"), "", 0, nil
+	}
+	ref, err := remoteRef(ctx, url, revision)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if ref.Name().IsTag() {
+		return config.RefSpec(fmt.Sprintf("+%[1]s:%[1]s", ref.Name())), ref.Name(), 1, nil
+	}
+	local := plumbing.NewRemoteReferenceName("origin", revision)
+	return config.RefSpec(fmt.Sprintf("+%s:%s", ref.Name(), local)), local, 1, nil
+}
+
+// clone clones the revision of oh-my-zsh from the url into the dir, and
+// returns the commit which is checked out.
+func clone(ctx context.Context, dir, url, revision string) (string, error) {
 	// Init the git repository.
-	repo, err := git.PlainInit(m.OHMyZSHDir(), false)
+	repo, err := git.PlainInit(dir, false)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to init oh-my-zsh repo")
+		return "", errors.Wrap(err, "failed to init oh-my-zsh repo")
 	}
 	cfg, err := repo.Config()
 	if err != nil {
-		return false, errors.Wrap(err, "failed to get repo config")
+		return "", errors.Wrap(err, "failed to get repo config")
 	}
 	// Refer to https://github.com/tensorchord/envd/issues/183#issuecomment-1148113323
 	cfg.Raw.AddOption("core", "", "eol", "lf")
@@ -97,52 +479,47 @@ func (m generalManager) DownloadOrCache() (bool, error) {
 	cfg.Raw.AddOption("fsck", "", "zeroPaddedFilemode", "ignore")
 	cfg.Raw.AddOption("fetch", "fsck", "zeroPaddedFilemode", "ignore")
 	cfg.Raw.AddOption("receive", "fsck", "zeroPaddedFilemode", "ignore")
-	cfg.Remotes["origin"] = &config.RemoteConfig{
-		Name: "origin",
-		URLs: []string{url},
-		Fetch: []config.RefSpec{
-			config.RefSpec("+refs/heads/master:refs/remotes/origin/master"),
-		},
+	refSpec, ref, depth, err := fetchRefSpec(ctx, url, revision)
+	if err != nil {
+		return "", err
 	}
-	cfg.Branches["master"] = &config.Branch{
-		Name:   "master",
-		Remote: "origin",
-		Merge:  "refs/heads/master",
+	cfg.Remotes["origin"] = &config.RemoteConfig{
+		Name:  "origin",
+		URLs:  []string{url},
+		Fetch: []config.RefSpec{refSpec},
 	}
 
 	if err := cfg.Validate(); err != nil {
-		return false, errors.Wrap(err, "failed to validate config")
+		return "", errors.Wrap(err, "failed to validate config")
 	}
 	if err := repo.SetConfig(cfg); err != nil {
-		return false, errors.Wrap(err, "failed to set config")
+		return "", errors.Wrap(err, "failed to set config")
 	}
 
-	if err := repo.Fetch(&git.FetchOptions{
+	if err := repo.FetchContext(ctx, &git.FetchOptions{
 		RemoteName: "origin",
-		RefSpecs: []config.RefSpec{
-			config.RefSpec("+refs/heads/master:refs/remotes/origin/master"),
-		},
-		Depth: 1,
+		RefSpecs:   []config.RefSpec{refSpec},
+		Depth:      depth,
+		Tags:       git.NoTags,
 	}); err != nil {
-		return false, errors.Wrap(err, "failed to fetch oh-my-zsh")
+		return "", errors.Wrapf(err, "failed to fetch oh-my-zsh %s", revision)
+	}
+	hash := plumbing.NewHash(revision)
+	if ref != "" {
+		h, err := repo.ResolveRevision(plumbing.Revision(ref))
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve oh-my-zsh %s", revision)
+		}
+		hash = *h
 	}
 	wktree, err := repo.Worktree()
 	if err != nil {
-		return false, errors.Wrap(err, "failed to get worktree")
+		return "", errors.Wrap(err, "failed to get worktree")
 	}
 	if err := wktree.Checkout(&git.CheckoutOptions{
-		Branch: "refs/remotes/origin/master",
+		Hash: hash,
 	}); err != nil {
-		return false, errors.Wrap(err, "failed to checkout master")
+		return "", errors.Wrapf(err, "failed to checkout oh-my-zsh %s", revision)
 	}
-
-	if err := home.GetManager().MarkCache(cacheKey, true); err != nil {
-		return false, errors.Wrap(err, "failed to update cache status")
-	}
-	l.Debug("oh-my-zsh is downloaded")
-	return false, nil
-}
-
-func (m generalManager) OHMyZSHDir() string {
-	return filepath.Join(home.GetManager().CacheDir(), "oh-my-zsh")
+	return hash.String(), nil
 }
@@ -15,9 +15,15 @@
 package shell
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -26,7 +32,7 @@ import (
 )
 
 var _ = Describe("zsh manager", Serial, func() {
-	zshManager := NewManager()
+	zshManager := NewManager(Source{})
 	BeforeEach(func() {
 		Expect(home.Initialize()).NotTo(HaveOccurred())
 	})
@@ -37,23 +43,159 @@ var _ = Describe("zsh manager", Serial, func() {
 	})
 	When("cached", func() {
 		It("should skip", func() {
-			err := home.GetManager().MarkCache(cacheKey, true)
+			err := home.GetManager().MarkCache(CacheKey, true)
 			Expect(err).NotTo(HaveOccurred())
-			cached, err := zshManager.DownloadOrCache()
+			Expect(zshManager.(*generalManager).writeRevision(Revision{
+				Revision: DefaultOHMyZSHRevision,
+				Commit:   "cached",
+			})).To(Succeed())
+			cached, err := zshManager.DownloadOrCache(context.Background())
 			Expect(cached).To(BeTrue())
 			Expect(err).NotTo(HaveOccurred())
 		})
 	})
 	When("not cached", func() {
 		It("should download", func() {
-			err := home.GetManager().MarkCache(cacheKey, false)
+			err := home.GetManager().MarkCache(CacheKey, false)
 			Expect(err).NotTo(HaveOccurred())
-			cached, err := zshManager.DownloadOrCache()
+			cached, err := zshManager.DownloadOrCache(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(cached).To(BeFalse())
 			exists, err := fileutil.DirExists(filepath.Join(home.GetManager().CacheDir(), "oh-my-zsh"))
 			Expect(err).NotTo(HaveOccurred())
 			Expect(exists).To(BeTrue())
+			rev, err := zshManager.Revision()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rev.Revision).To(Equal(DefaultOHMyZSHRevision))
+			Expect(rev.Commit).To(MatchRegexp("^[0-9a-f]{40}$"))
+		})
+	})
+	When("rendering the zshrc", func() {
+		It("should keep the defaults", func() {
+			rc := zshManager.ZSHRC(nil, "")
+			Expect(rc).To(ContainSubstring("plugins=(git ubuntu)\n"))
+			Expect(rc).To(ContainSubstring(`# ZSH_THEME="envd"`))
+		})
+		It("should set the plugins and the theme", func() {
+			rc := zshManager.ZSHRC([]string{"git", "autojump"}, "ys")
+			Expect(rc).To(ContainSubstring("plugins=(git autojump)\n"))
+			Expect(rc).NotTo(ContainSubstring("plugins=(git ubuntu)"))
+			Expect(rc).To(ContainSubstring(`ZSH_THEME="ys"`))
+		})
+	})
+	When("pinned to another revision", func() {
+		It("should download again", func() {
+			err := home.GetManager().MarkCache(CacheKey, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zshManager.(*generalManager).writeRevision(Revision{
+				Revision: DefaultOHMyZSHRevision,
+				Commit:   "cached",
+			})).To(Succeed())
+			m := NewManager(Source{Revision: "not-found-revision"})
+			_, err = m.DownloadOrCache(context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	When("the repository is unreachable", func() {
+		It("should install from the tarball", func() {
+			err := home.GetManager().MarkCache(CacheKey, false)
+			Expect(err).NotTo(HaveOccurred())
+			dir, err := os.MkdirTemp("", "envd-oh-my-zsh")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			tarball := filepath.Join(dir, "ohmyzsh-master.tar.gz")
+			Expect(writeTarball(tarball, "ohmyzsh-master/oh-my-zsh.sh")).To(Succeed())
+
+			m := NewManager(Source{
+				URL:     filepath.Join(dir, "unreachable"),
+				Tarball: tarball,
+			})
+			Expect(m.RepoURL()).To(Equal(filepath.Join(dir, "unreachable")))
+			cached, err := m.DownloadOrCache(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cached).To(BeFalse())
+			exists, err := fileutil.FileExists(filepath.Join(m.OHMyZSHDir(), "oh-my-zsh.sh"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeTrue())
+			rev, err := m.Revision()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rev.Commit).To(BeEmpty())
+			Expect(rev.Tarball).To(HaveLen(64))
+			Expect(m.Verify()).To(Succeed())
+			Expect(os.Remove(filepath.Join(m.OHMyZSHDir(), "oh-my-zsh.sh"))).To(Succeed())
+			Expect(m.Verify()).NotTo(Succeed())
+		})
+	})
+	When("verifying the cloned repository", func() {
+		It("should detect the modified worktree", func() {
+			err := home.GetManager().MarkCache(CacheKey, false)
+			Expect(err).NotTo(HaveOccurred())
+			dir, err := os.MkdirTemp("", "envd-oh-my-zsh")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			Expect(writeRepo(dir)).To(Succeed())
+
+			m := NewManager(Source{URL: dir})
+			_, err = m.DownloadOrCache(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Verify()).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(m.OHMyZSHDir(), "oh-my-zsh.sh"),
+				[]byte("truncated"), 0644)).To(Succeed())
+			Expect(m.Verify()).NotTo(Succeed())
+		})
+	})
+	When("updating without the cache", func() {
+		It("should skip", func() {
+			err := home.GetManager().MarkCache(CacheKey, false)
+			Expect(err).NotTo(HaveOccurred())
+			updated, err := zshManager.Update(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated).To(BeFalse())
 		})
 	})
 })
+
+// writeRepo creates the repository of oh-my-zsh with a commit in master.
+func writeRepo(dir string) error {
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oh-my-zsh.sh"), []byte("# oh-my-zsh\n"), 0644); err != nil {
+		return err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if _, err := wt.Add("oh-my-zsh.sh"); err != nil {
+		return err
+	}
+	_, err = wt.Commit("init", &git.CommitOptions{
+		Author: &object.Signature{Name: "envd", Email: "envd@tensorchord.ai", When: time.Now()},
+	})
+	return err
+}
+
+func writeTarball(path, name string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	content := []byte("# oh-my-zsh\n")
+	if err := tw.WriteHeader(&tar.Header{
+		Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/cockroachdb/errors"
+)
+
+// dockerDesktopAgentSocket is the ssh agent of the macOS host in the VM of
+// Docker Desktop, the one in SSH_AUTH_SOCK cannot be mounted.
+const dockerDesktopAgentSocket = "/run/host-services/ssh-auth.sock"
+
+// AgentSocket returns the ssh agent socket of the host, which is bind
+// mounted into the environment.
+func AgentSocket() (string, error) {
+	if runtime.GOOS == "darwin" {
+		return dockerDesktopAgentSocket, nil
+	}
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return "", errors.New("SSH_AUTH_SOCK is not set, please start the ssh agent first")
+	}
+	return sock, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd/pkg/log"
+	"github.com/tensorchord/envd/pkg/util/fileutil"
+)
+
+func hostKeyPath(name string) (string, error) {
+	path, err := fileutil.CacheFile(fmt.Sprintf("host_key_%s", name))
+	if err != nil {
+		return "", errors.Wrap(err, "Cannot get host key path")
+	}
+	return path, nil
+}
+
+// HostKey returns the host key of envd-sshd in the environment. It is
+// generated at the first start and kept in the cache dir, thus the host
+// identification does not change after the environment is rebuilt.
+func HostKey(name string) (string, error) {
+	path, err := hostKeyPath(name)
+	if err != nil {
+		return "", err
+	}
+	exists, err := fileutil.FileExists(path)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return path, nil
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate the host key")
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal the host key")
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privDER,
+	})
+	// The user in the container may have the different uid, while the
+	// cache dir is only accessible by the user on the host.
+	if err := os.WriteFile(path, privatePEM, 0644); err != nil {
+		return "", errors.Wrap(err, "failed to write the host key")
+	}
+	log.Debugf("created the host key of %s at %s", name, path)
+	return path, nil
+}
+
+// RemoveHostKey removes the host key of envd-sshd in the environment.
+func RemoveHostKey(name string) error {
+	path, err := hostKeyPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove the host key")
+	}
+	return nil
+}
@@ -22,10 +22,10 @@ import (
 	"os"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/tensorchord/envd/pkg/config"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/util/fileutil"
 )
 
@@ -38,19 +38,19 @@ func KeyExists(public, private string) bool {
 	// public, private := getKeyPaths()
 	publicKeyExists, _ := fileutil.FileExists(public)
 	if !publicKeyExists {
-		logrus.Debugf("%s doesn't exist", public)
+		log.Debugf("%s doesn't exist", public)
 		return false
 	}
 
-	logrus.Debugf("%s already present", public)
+	log.Debugf("%s already present", public)
 
 	privateKeyExists, _ := fileutil.FileExists(private)
 	if !privateKeyExists {
-		logrus.Debugf("%s doesn't exist", private)
+		log.Debugf("%s doesn't exist", private)
 		return false
 	}
 
-	logrus.Debugf("%s already present", private)
+	log.Debugf("%s already present", private)
 	return true
 }
 
@@ -88,7 +88,7 @@ func generateKeys(public, private string, bitSize int) error {
 		return errors.Wrap(err, "failed to write private SSH key")
 	}
 
-	logrus.Debugf("created ssh keypair at  %s and %s", public, private)
+	log.Debugf("created ssh keypair at  %s and %s", public, private)
 	return nil
 }
 
@@ -176,7 +176,7 @@ func GetPrivateKey() (string, error) {
 func GetPublicKeyOrPanic() string {
 	pub, _, err := getDefaultKeyPaths()
 	if err != nil {
-		logrus.Fatal("Cannot get public key path")
+		log.Fatal("Cannot get public key path")
 	}
 	return pub
 }
@@ -185,7 +185,7 @@ func GetPublicKeyOrPanic() string {
 func GetPrivateKeyOrPanic() string {
 	_, pri, err := getDefaultKeyPaths()
 	if err != nil {
-		logrus.Fatal("Cannot get private key path")
+		log.Fatal("Cannot get private key path")
 	}
 	return pri
 }
@@ -27,8 +27,8 @@ import (
 	"strings"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/util/osutil"
 )
 
@@ -231,7 +231,7 @@ func (config *sshConfig) writeTo(w io.Writer) error {
 func (config *sshConfig) writeToFilepath(p string) error {
 	sshDir := filepath.Dir(p)
 	if err := os.MkdirAll(sshDir, 0700); err != nil {
-		logrus.Infof("failed to create SSH directory %s: %s", sshDir, err)
+		log.Infof("failed to create SSH directory %s: %s", sshDir, err)
 	}
 
 	stat, err := os.Stat(p)
@@ -311,7 +311,7 @@ func AddEntry(name, iface string, port int, privateKeyPath string) error {
 		return err
 	}
 	if osutil.IsWsl() {
-		logrus.Debug("Try adding entry to WSL's ssh-agent")
+		log.Debug("Try adding entry to WSL's ssh-agent")
 		winSshConfig, err := osutil.GetWslHostSshConfig()
 		if err != nil {
 			return err
@@ -321,7 +321,7 @@ func AddEntry(name, iface string, port int, privateKeyPath string) error {
 			return err
 		}
 		// Add the entry to the WSL host SSH config
-		logrus.Debugf("Adding entry to WSL's ssh-agent: %s", winSshConfig)
+		log.Debugf("Adding entry to WSL's ssh-agent: %s", winSshConfig)
 		err = add(winSshConfig, buildHostname(name), iface, port, winKeyPath)
 		if err != nil {
 			return err
@@ -335,14 +335,14 @@ func ReplaceKeyManagedByEnvd(oldKey string, newKey string) error {
 	if err != nil {
 		return err
 	}
-	logrus.Infof("Rewrite ssh keys old: %s, new: %s", oldKey, newKey)
+	log.Infof("Rewrite ssh keys old: %s, new: %s", oldKey, newKey)
 	for ih, h := range cfg.hosts {
 		for _, hn := range h.hostnames {
-			logrus.Info(h.hostnames)
+			log.Info(h.hostnames)
 			if strings.HasSuffix(hn, ".envd") {
 				for ip, p := range h.params {
 					if p.keyword == identityFile && strings.Trim(p.args[0], "\"") == oldKey {
-						logrus.Debug("Change key")
+						log.Debug("Change key")
 						cfg.hosts[ih].params[ip].args[0] = newKey
 					}
 				}
@@ -382,14 +382,14 @@ func ReplaceKeyManagedByEnvd(oldKey string, newKey string) error {
 		if err != nil {
 			return err
 		}
-		logrus.Infof("Rewrite WSL ssh keys old: %s, new: %s", winOldKey, winNewKey)
+		log.Infof("Rewrite WSL ssh keys old: %s, new: %s", winOldKey, winNewKey)
 		for ih, h := range cfg.hosts {
 			for _, hn := range h.hostnames {
-				logrus.Info(h.hostnames)
+				log.Info(h.hostnames)
 				if strings.HasSuffix(hn, ".envd") {
 					for ip, p := range h.params {
 						if p.keyword == identityFile && strings.Trim(p.args[0], "\"") == winOldKey {
-							logrus.Debug("Change key")
+							log.Debug("Change key")
 							cfg.hosts[ih].params[ip].args[0] = winNewKey
 						}
 					}
@@ -438,7 +438,7 @@ func RemoveEntry(name string) error {
 		return err
 	}
 	if osutil.IsWsl() {
-		logrus.Debug("Try removing entry from WSL's ssh-agent")
+		log.Debug("Try removing entry from WSL's ssh-agent")
 		winSshConfig, err := osutil.GetWslHostSshConfig()
 		if err != nil {
 			return err
@@ -549,7 +549,7 @@ func save(cfg *sshConfig, path string) error {
 func getSSHConfigPath() string {
 	dirname, err := os.UserHomeDir()
 	if err != nil {
-		logrus.Fatal(err)
+		log.Fatal(err)
 	}
 	return filepath.Join(dirname, ".ssh", "config")
 }
@@ -15,8 +15,12 @@
 package config
 
 import (
+	"os"
+	"runtime"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
 )
 
 var _ = Describe("ssh config", func() {
@@ -38,3 +42,52 @@ var _ = Describe("ssh config", func() {
 		})
 	})
 })
+
+var _ = Describe("agent socket", func() {
+	It("Should get the ssh agent socket of the host", func() {
+		if runtime.GOOS == "darwin" {
+			Skip("the socket of Docker Desktop is used on macOS")
+		}
+		origin, ok := os.LookupEnv("SSH_AUTH_SOCK")
+		defer func() {
+			if ok {
+				os.Setenv("SSH_AUTH_SOCK", origin)
+			} else {
+				os.Unsetenv("SSH_AUTH_SOCK")
+			}
+		}()
+
+		os.Setenv("SSH_AUTH_SOCK", "/tmp/ssh-agent.sock")
+		sock, err := AgentSocket()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sock).To(Equal("/tmp/ssh-agent.sock"))
+
+		os.Unsetenv("SSH_AUTH_SOCK")
+		_, err = AgentSocket()
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("host key", func() {
+	It("Should keep the host key until it is removed", func() {
+		env := "test-host-key"
+		path, err := HostKey(env)
+		Expect(err).NotTo(HaveOccurred())
+		key, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ssh.ParsePrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+
+		again, err := HostKey(env)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(path))
+		actual, err := os.ReadFile(again)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual).To(Equal(key))
+
+		Expect(RemoveHostKey(env)).To(Succeed())
+		_, err = os.Stat(path)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		Expect(RemoveHostKey(env)).To(Succeed())
+	})
+})
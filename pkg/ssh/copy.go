@@ -18,7 +18,7 @@ import (
 	"io"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 // Copier copies from local to remote terminalhandles the lifecycle of all the forwards
@@ -48,13 +48,13 @@ func (c *Copier) Copy() {
 			nw, ew := c.Remote.Write(buf[write:nr])
 			write += nw
 			if ew != nil {
-				logrus.Debugf("write to remote terminal error: %s", ew.Error())
+				log.Debugf("write to remote terminal error: %s", ew.Error())
 				<-t.C
 				continue
 			}
 		}
 		if er != nil {
-			logrus.Debugf("read from local to remote terminal error: %s", er.Error())
+			log.Debugf("read from local to remote terminal error: %s", er.Error())
 			return
 		}
 	}
@@ -30,12 +30,12 @@ import (
 
 	"github.com/alessio/shellescape"
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/term"
 
 	"github.com/tensorchord/envd/pkg/lang/ir"
+	"github.com/tensorchord/envd/pkg/log"
 	"github.com/tensorchord/envd/pkg/ssh/config"
 )
 
@@ -140,7 +140,7 @@ func NewClient(opt Options) (Client, error) {
 				return nil, errors.Wrap(err, "forwarding agent to client failed")
 			}
 		} else {
-			logrus.Warn("failed to get the environment variable SSH_AUTH_SOCK")
+			log.Warn("failed to get the environment variable SSH_AUTH_SOCK")
 		}
 	}
 
@@ -200,15 +200,15 @@ func (c generalClient) Attach() error {
 	var ok bool
 	if termFD, ok = isTerminal(os.Stdin); ok {
 		width, height, err = term.GetSize(int(os.Stdout.Fd()))
-		logrus.Debugf("terminal width %d height %d", width, height)
+		log.Debugf("terminal width %d height %d", width, height)
 		if err != nil {
-			logrus.Debugf("request for terminal size failed: %s", err)
+			log.Debugf("request for terminal size failed: %s", err)
 		}
 	}
 
 	state, err := term.MakeRaw(termFD)
 	if err != nil {
-		logrus.Debugf("request for raw terminal failed: %s", err)
+		log.Debugf("request for raw terminal failed: %s", err)
 	}
 
 	defer func() {
@@ -217,10 +217,10 @@ func (c generalClient) Attach() error {
 		}
 
 		if err := term.Restore(termFD, state); err != nil {
-			logrus.Debugf("failed to restore terminal: %s", err)
+			log.Debugf("failed to restore terminal: %s", err)
 		}
 
-		logrus.Debugf("terminal restored")
+		log.Debugf("terminal restored")
 	}()
 
 	if err := session.RequestPty("xterm-256color", height, width, modes); err != nil {
@@ -240,7 +240,7 @@ func (c generalClient) Attach() error {
 
 	go func() {
 		if _, err := io.Copy(os.Stdout, stdout); err != nil {
-			logrus.Debugf("error while writing to stdOut: %s", err)
+			log.Debugf("error while writing to stdOut: %s", err)
 		}
 	}()
 
@@ -251,16 +251,16 @@ func (c generalClient) Attach() error {
 
 	go func() {
 		if _, err := io.Copy(os.Stderr, stderr); err != nil {
-			logrus.Debugf("error while writing to stdOut: %s", err)
+			log.Debugf("error while writing to stdOut: %s", err)
 		}
 	}()
 
 	// TODO(gaocegege): Refactor it to avoid direct access to DefaultGraph
 	cmd := shellescape.QuoteCommand([]string{ir.DefaultGraph.Shell})
-	logrus.Debugf("executing command over ssh: '%s'", cmd)
+	log.Debugf("executing command over ssh: '%s'", cmd)
 	err = session.Run(cmd)
 	if err == nil {
-		logrus.Infof("Detached successfully. You can attach to the container with command `ssh %s.envd`\n",
+		log.Infof("Detached successfully. You can attach to the container with command `ssh %s.envd`\n",
 			ir.DefaultGraph.EnvironmentName)
 		return nil
 	}
@@ -268,10 +268,10 @@ func (c generalClient) Attach() error {
 		return nil
 	}
 	if strings.Contains(err.Error(), "exit code 137") || strings.Contains(err.Error(), "exit status 137") {
-		logrus.Warn(`Insufficient memory.`)
+		log.Warn(`Insufficient memory.`)
 	}
 
-	logrus.Debugf("command failed: %s", err)
+	log.Debugf("command failed: %s", err)
 	return errors.Wrap(err, "command failed")
 }
 
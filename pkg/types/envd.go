@@ -18,7 +18,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/docker/docker/api/types"
 	"github.com/moby/buildkit/util/system"
 
@@ -35,7 +37,21 @@ const DefaultPathEnvUnix = "/opt/conda/envs/envd/bin:/opt/conda/bin:/home/envd/.
 // ';' character .
 const DefaultPathEnvWindows = system.DefaultPathEnvWindows
 
-const PythonBaseImage = "ubuntu:20.04"
+const (
+	// APTCacherImage is the apt-cacher-ng image to cache the apt packages
+	// on the host, shared by all the builds.
+	APTCacherImage         = "docker.io/sameersbn/apt-cacher-ng:3.7.4-20220421"
+	APTCacherContainerName = "envd_apt_cacher"
+	APTCacherCacheDir      = "/var/cache/apt-cacher-ng"
+	APTCacherPort          = 3142
+
+	// PyPICacherImage is the proxpi image to cache the PyPI packages
+	// on the host, shared by all the builds.
+	PyPICacherImage         = "docker.io/epicwink/proxpi:latest"
+	PyPICacherContainerName = "envd_pypi_cacher"
+	PyPICacherCacheDir      = "/var/cache/proxpi"
+	PyPICacherPort          = 5000
+)
 
 var EnvdSshdImage = fmt.Sprintf(
 	"tensorchord/envd-sshd-from-scratch:%s",
@@ -87,7 +103,12 @@ type EnvdEnvironment struct {
 	Name              string  `json:"name,omitempty"`
 	JupyterAddr       *string `json:"jupyter_addr,omitempty"`
 	RStudioServerAddr *string `json:"rstudio_server_addr,omitempty"`
-	EnvdManifest      `json:",inline,omitempty"`
+	CodeServerAddr    *string `json:"code_server_addr,omitempty"`
+	// Context is the context whose runner the environment is placed on.
+	Context string `json:"context,omitempty"`
+	// Tags are the user-defined tags set by envd up --env-tag.
+	Tags         map[string]string `json:"tags,omitempty"`
+	EnvdManifest `json:",inline,omitempty"`
 }
 
 type EnvdManifest struct {
@@ -102,6 +123,20 @@ type EnvdInfo struct {
 	types.Info
 }
 
+// HostResources is the resources of the runner host of the context, it is
+// used to place the environment by envd up --auto-place.
+type HostResources struct {
+	Context string `json:"context,omitempty"`
+	// GPUs is the number of the GPUs on the host, it is 0 if the GPUs
+	// cannot be queried.
+	GPUs int `json:"gpus"`
+	// FreeGPUs is the number of the GPUs not requested by the envd
+	// environments.
+	FreeGPUs   int   `json:"free_gpus"`
+	Memory     int64 `json:"memory"`
+	FreeMemory int64 `json:"free_memory"`
+}
+
 type EnvdContext struct {
 	Current  string    `json:"current,omitempty"`
 	Contexts []Context `json:"contexts,omitempty"`
@@ -113,6 +148,44 @@ type Context struct {
 	BuilderAddress string      `json:"builder_address,omitempty"`
 	Runner         RunnerType  `json:"runner,omitempty"`
 	RunnerAddress  *string     `json:"runner_address,omitempty"`
+	// PyPICache uses the PyPI cache container in the builds.
+	PyPICache bool `json:"pypi_cache,omitempty"`
+	// Registry is where envd up pushes the images to if the runner is
+	// remote, thus the runner could pull them.
+	Registry string `json:"registry,omitempty"`
+	// BuilderTLS is the mTLS config of the remote buildkitd over TCP.
+	BuilderTLS *BuilderTLS `json:"builder_tls,omitempty"`
+}
+
+// BuilderTLS is the certificates to connect to the remote buildkitd, e.g.
+// the one shared by the team. The paths are absolute.
+type BuilderTLS struct {
+	CACert string `json:"ca_cert,omitempty"`
+	Cert   string `json:"cert,omitempty"`
+	Key    string `json:"key,omitempty"`
+	// ServerName is the name in the certificate of buildkitd, the host of
+	// the address is used if it is empty.
+	ServerName string `json:"server_name,omitempty"`
+}
+
+// Validate checks that the CA certificate is set, and the client
+// certificate is set with the key.
+func (t BuilderTLS) Validate() error {
+	if t.CACert == "" {
+		return errors.New("the CA certificate of buildkitd is required for TLS")
+	}
+	if (t.Cert == "") != (t.Key == "") {
+		return errors.New("the client certificate and the key must be set together")
+	}
+	return nil
+}
+
+// RemoteRunner returns true if the environments do not run in the local
+// docker host, thus the images built here must be pushed to the registry.
+// The address of the nerdctl runner is the local containerd socket.
+func (c Context) RemoteRunner() bool {
+	return c.Runner == RunnerTypeEnvdServer ||
+		(c.Runner != RunnerTypeNerdctl && c.RunnerAddress != nil)
 }
 
 type BuilderType string
@@ -121,13 +194,34 @@ const (
 	BuilderTypeDocker     BuilderType = "docker-container"
 	BuilderTypeKubernetes BuilderType = "kube-pod"
 	BuilderTypeTCP        BuilderType = "tcp"
+	// BuilderTypeUnix is the buildkitd running on the host, e.g. the one with
+	// the containerd worker at unix:///run/buildkit/buildkitd.sock.
+	BuilderTypeUnix BuilderType = "unix"
 )
 
+// ParseBuilder parses the builder in the form of <type>://<address>, e.g.
+// tcp://buildkitd.example.com:1234.
+func ParseBuilder(builder string) (BuilderType, string, error) {
+	typ, address, ok := strings.Cut(builder, "://")
+	if !ok || address == "" {
+		return "", "", errors.Newf("invalid builder %s, expected <type>://<address>", builder)
+	}
+	switch t := BuilderType(typ); t {
+	case BuilderTypeDocker, BuilderTypeKubernetes, BuilderTypeTCP, BuilderTypeUnix:
+		return t, address, nil
+	default:
+		return "", "", errors.Newf("unknown builder type %s", typ)
+	}
+}
+
 type RunnerType string
 
 const (
 	RunnerTypeDocker     RunnerType = "docker"
 	RunnerTypeEnvdServer RunnerType = "envd-server"
+	// RunnerTypeNerdctl runs the environments on containerd by nerdctl, the
+	// runner address is the containerd socket.
+	RunnerTypeNerdctl RunnerType = "nerdctl"
 )
 
 type Dependency struct {
@@ -152,6 +246,20 @@ type AuthConfig struct {
 	IdentityToken string `json:"identity_token,omitempty"`
 }
 
+// AuditRecord is the record of an envd command in the audit log.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user,omitempty"`
+	Host string    `json:"host,omitempty"`
+	// Command is the full name of the command, e.g. context create.
+	Command string `json:"command"`
+	// Args are the arguments, in which the secrets are redacted.
+	Args     []string      `json:"args,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Error is empty if the command succeeds.
+	Error string `json:"error,omitempty"`
+}
+
 func NewImage(image types.ImageSummary) (*EnvdImage, error) {
 	img := EnvdImage{
 		ImageSummary: image,
@@ -177,6 +285,20 @@ func NewEnvironment(ctr types.Container) (*EnvdEnvironment, error) {
 	if rstudioServerAddr, ok := ctr.Labels[ContainerLabelRStudioServerAddr]; ok {
 		env.RStudioServerAddr = &rstudioServerAddr
 	}
+	if codeServerAddr, ok := ctr.Labels[ContainerLabelCodeServerAddr]; ok {
+		env.CodeServerAddr = &codeServerAddr
+	}
+	if context, ok := ctr.Labels[ContainerLabelContext]; ok {
+		env.Context = context
+	}
+	for k, v := range ctr.Labels {
+		if strings.HasPrefix(k, ContainerLabelTagPrefix) {
+			if env.Tags == nil {
+				env.Tags = make(map[string]string)
+			}
+			env.Tags[strings.TrimPrefix(k, ContainerLabelTagPrefix)] = v
+		}
+	}
 
 	m, err := newManifest(ctr.Labels)
 	if err != nil {
@@ -33,3 +33,39 @@ var _ = g.Describe("pypi label", func() {
 		})
 	})
 })
+
+var _ = g.Describe("builder", func() {
+	g.It("should parse the builder with the address", func() {
+		typ, address, err := ParseBuilder("tcp://buildkitd.example.com:1234")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(typ).To(Equal(BuilderTypeTCP))
+		Expect(address).To(Equal("buildkitd.example.com:1234"))
+
+		typ, address, err = ParseBuilder("docker-container://envd_buildkitd")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(typ).To(Equal(BuilderTypeDocker))
+		Expect(address).To(Equal("envd_buildkitd"))
+
+		typ, address, err = ParseBuilder("unix:///run/buildkit/buildkitd.sock")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(typ).To(Equal(BuilderTypeUnix))
+		Expect(address).To(Equal("/run/buildkit/buildkitd.sock"))
+
+		for _, invalid := range []string{"tcp", "tcp://", "ssh://host:22"} {
+			_, _, err := ParseBuilder(invalid)
+			Expect(err).To(HaveOccurred(), invalid)
+		}
+	})
+	g.It("should validate the TLS", func() {
+		Expect(BuilderTLS{CACert: "ca.pem"}.Validate()).To(Succeed())
+		Expect(BuilderTLS{CACert: "ca.pem", Cert: "cert.pem", Key: "key.pem"}.Validate()).To(Succeed())
+		Expect(BuilderTLS{Cert: "cert.pem", Key: "key.pem"}.Validate()).NotTo(Succeed())
+		Expect(BuilderTLS{CACert: "ca.pem", Cert: "cert.pem"}.Validate()).NotTo(Succeed())
+	})
+	g.It("should run the nerdctl environments locally", func() {
+		address := "/run/containerd/containerd.sock"
+		Expect(Context{Runner: RunnerTypeNerdctl, RunnerAddress: &address}.RemoteRunner()).To(BeFalse())
+		address = "tcp://docker.example.com:2375"
+		Expect(Context{Runner: RunnerTypeDocker, RunnerAddress: &address}.RemoteRunner()).To(BeTrue())
+	})
+})
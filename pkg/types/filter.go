@@ -0,0 +1,74 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+const filterTag = "tag"
+
+// EnvironmentFilter matches the environments by the tag, e.g. tag=team=nlp
+// matches the tag team with the value nlp, and tag=team matches the tag
+// team with any value.
+type EnvironmentFilter struct {
+	Key   string
+	Value *string
+}
+
+// ParseEnvironmentFilters parses the filters in the format of tag=key[=value].
+func ParseEnvironmentFilters(filters []string) ([]EnvironmentFilter, error) {
+	res := make([]EnvironmentFilter, 0, len(filters))
+	for _, f := range filters {
+		kind, expr, ok := strings.Cut(f, "=")
+		if !ok || expr == "" {
+			return nil, errors.Newf("invalid filter %s, expected tag=key[=value]", f)
+		}
+		if kind != filterTag {
+			return nil, errors.Newf("filter %s is not supported, expected %s", kind, filterTag)
+		}
+		key, value, hasValue := strings.Cut(expr, "=")
+		filter := EnvironmentFilter{Key: key}
+		if hasValue {
+			filter.Value = &value
+		}
+		res = append(res, filter)
+	}
+	return res, nil
+}
+
+// Match returns true if the environment matches all the filters.
+func (e EnvdEnvironment) Match(filters []EnvironmentFilter) bool {
+	for _, f := range filters {
+		v, ok := e.Tags[f.Key]
+		if !ok || (f.Value != nil && *f.Value != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterEnvironments returns the environments matching all the filters.
+func FilterEnvironments(envs []EnvdEnvironment, filters []EnvironmentFilter) []EnvdEnvironment {
+	res := []EnvdEnvironment{}
+	for _, env := range envs {
+		if env.Match(filters) {
+			res = append(res, env)
+		}
+	}
+	return res
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"github.com/docker/docker/api/types"
+	g "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = g.Describe("environment filter", func() {
+	newEnv := func(labels map[string]string) EnvdEnvironment {
+		env, err := NewEnvironment(types.Container{Labels: labels})
+		Expect(err).NotTo(HaveOccurred())
+		return *env
+	}
+
+	g.It("should parse the tags from the labels", func() {
+		env := newEnv(map[string]string{
+			ContainerLabelName:                "test",
+			ContainerLabelTagPrefix + "team":  "nlp",
+			ContainerLabelTagPrefix + "owner": "alice",
+		})
+		Expect(env.Tags).To(Equal(map[string]string{"team": "nlp", "owner": "alice"}))
+	})
+
+	g.It("should match the environments by the tags", func() {
+		nlp := newEnv(map[string]string{
+			ContainerLabelName:               "nlp",
+			ContainerLabelTagPrefix + "team": "nlp",
+		})
+		cv := newEnv(map[string]string{
+			ContainerLabelName:               "cv",
+			ContainerLabelTagPrefix + "team": "cv",
+		})
+		untagged := newEnv(map[string]string{ContainerLabelName: "untagged"})
+		envs := []EnvdEnvironment{nlp, cv, untagged}
+
+		filters, err := ParseEnvironmentFilters([]string{"tag=team=nlp"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(FilterEnvironments(envs, filters)).To(Equal([]EnvdEnvironment{nlp}))
+
+		filters, err = ParseEnvironmentFilters([]string{"tag=team"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(FilterEnvironments(envs, filters)).To(Equal([]EnvdEnvironment{nlp, cv}))
+
+		Expect(FilterEnvironments(envs, nil)).To(Equal(envs))
+	})
+
+	g.It("should reject the invalid filters", func() {
+		for _, f := range []string{"tag", "tag=", "name=test"} {
+			_, err := ParseEnvironmentFilters([]string{f})
+			Expect(err).To(HaveOccurred())
+		}
+	})
+})
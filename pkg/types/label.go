@@ -18,7 +18,12 @@ const (
 	ContainerLabelName              = "ai.tensorchord.envd.name"
 	ContainerLabelJupyterAddr       = "ai.tensorchord.envd.jupyter.address"
 	ContainerLabelRStudioServerAddr = "ai.tensorchord.envd.rstudio.server.address"
+	ContainerLabelCodeServerAddr    = "ai.tensorchord.envd.code-server.address"
 	ContainerLabelSSHPort           = "ai.tensorchord.envd.ssh.port"
+	ContainerLabelContext           = "ai.tensorchord.envd.context"
+	// ContainerLabelTagPrefix prefixes the user-defined tags, e.g.
+	// ai.tensorchord.envd.tag.team=nlp.
+	ContainerLabelTagPrefix = "ai.tensorchord.envd.tag."
 
 	ImageLabelVendor    = "ai.tensorchord.envd.vendor"
 	ImageLabelGPU       = "ai.tensorchord.envd.gpu"
@@ -30,6 +35,8 @@ const (
 	ImageLabelContext   = "ai.tensorchord.envd.build.context"
 	ImageLabelCacheHash = "ai.tensorchord.envd.build.digest"
 	RuntimeGraphCode    = "ai.tensorchord.envd.runtimeGraph"
+	// ImageLabelEntrypoint is the version of the generated entrypoint script.
+	ImageLabelEntrypoint = "ai.tensorchord.envd.entrypoint.version"
 
 	ImageVendorEnvd = "envd"
 )
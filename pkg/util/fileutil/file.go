@@ -23,7 +23,15 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/go-git/go-git/v5"
-	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+const (
+	// EnvConfigDir and EnvCacheDir relocate the envd dirs, e.g. on the shared
+	// CI runners, otherwise the XDG base dirs are respected.
+	EnvConfigDir = "ENVD_CONFIG_DIR"
+	EnvCacheDir  = "ENVD_CACHE_DIR"
 )
 
 var (
@@ -37,9 +45,39 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
-	DefaultConfigDir = filepath.Join(home, ".config", "envd")
-	DefaultCacheDir = filepath.Join(home, ".cache", "envd")
+	DefaultConfigDir, err = filepath.Abs(
+		envdDir(EnvConfigDir, "XDG_CONFIG_HOME", filepath.Join(home, ".config")))
+	if err != nil {
+		panic(err)
+	}
+	if err := SetCacheDir(
+		envdDir(EnvCacheDir, "XDG_CACHE_HOME", filepath.Join(home, ".cache"))); err != nil {
+		panic(err)
+	}
+}
+
+// envdDir returns the dir in env, or the envd dir in the XDG base dir. The
+// relative XDG base dir is ignored as the spec requires.
+func envdDir(env, xdgEnv, fallback string) string {
+	if dir := os.Getenv(env); dir != "" {
+		return dir
+	}
+	if xdg := os.Getenv(xdgEnv); filepath.IsAbs(xdg) {
+		fallback = xdg
+	}
+	return filepath.Join(fallback, "envd")
+}
+
+// SetCacheDir relocates the cache dir, e.g. by --cache-dir, it must be
+// called before the home manager is initialized.
+func SetCacheDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the absolute path of %s", dir)
+	}
+	DefaultCacheDir = abs
 	DefaultEnvdLibDir = filepath.Join(DefaultCacheDir, "envdlib")
+	return nil
 }
 
 // FileExists returns true if the file exists
@@ -80,10 +118,73 @@ func FindFileAbsPath(path, fileName string) (string, error) {
 	return absPath, nil
 }
 
+// ExpandHostPath expands the leading ~ to the home directory of the host user,
+// and resolves the relative path against the base directory.
+func ExpandHostPath(base, path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	return path
+}
+
+// ReadFileInDir reads the file relative to the dir, which must not escape
+// the dir, even by the symlinks. The file larger than maxSize is refused.
+func ReadFileInDir(dir, path string, maxSize int64) ([]byte, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve the dir %s", dir)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve the file %s", path)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return nil, errors.Newf("file %s is not in the dir %s", path, dir)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat the file %s", path)
+	}
+	if info.IsDir() {
+		return nil, errors.Newf("%s is a dir", path)
+	}
+	if info.Size() > maxSize {
+		return nil, errors.Newf("file %s is larger than %d bytes", path, maxSize)
+	}
+	return os.ReadFile(resolved)
+}
+
 func RemoveAll(dirname string) error {
 	return os.RemoveAll(dirname)
 }
 
+// ReplaceDir replaces the dst directory with the src directory by renaming,
+// thus the dst directory is never partially updated.
+func ReplaceDir(src, dst string) error {
+	old := dst + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return errors.Wrapf(err, "failed to remove %s", old)
+	}
+	if err := os.Rename(dst, old); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to rename %s", dst)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		// Restore the dst directory.
+		_ = os.Rename(old, dst)
+		return errors.Wrapf(err, "failed to rename %s to %s", src, dst)
+	}
+	return os.RemoveAll(old)
+}
+
 // DirExists returns true if the directory exists.
 func DirExists(filename string) (bool, error) {
 	info, err := os.Stat(filename)
@@ -96,11 +197,33 @@ func DirExists(filename string) (bool, error) {
 	return info.IsDir(), nil
 }
 
+// DirSize returns the total size of the regular files in the directory.
+// It returns 0 if the directory does not exist.
+func DirSize(dirname string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dirname, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to walk %s", dirname)
+	}
+	return size, nil
+}
+
 func CreateIfNotExist(f string) error {
 	_, err := os.Stat(f)
 	if err != nil {
 		if os.IsNotExist(err) {
-			logrus.WithField("filename", f).Debug("Creating file")
+			log.WithField("filename", f).Debug("Creating file")
 			if _, err := os.Create(f); err != nil {
 				return errors.Wrap(err, "failed to create file")
 			}
@@ -145,7 +268,7 @@ func validateAndJoin(dir, file string) (string, error) {
 
 // DownloadOrUpdateGitRepo downloads (if not exist) or update (if exist)
 func DownloadOrUpdateGitRepo(url string) (path string, err error) {
-	logger := logrus.WithField("git", url)
+	logger := log.WithField("git", url)
 	path = filepath.Join(DefaultEnvdLibDir, strings.ReplaceAll(url, "/", "_"))
 	var repo *git.Repository
 	exist, err := DirExists(path)
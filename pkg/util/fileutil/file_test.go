@@ -15,9 +15,11 @@
 package fileutil
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -80,3 +82,103 @@ func TestFindFileAbsPath(t *testing.T) {
 		}
 	}
 }
+
+func TestExpandHostPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	require.Nil(t, err, "cannot get the home dir")
+
+	require.Equal(t, "/etc/ssl/ca.pem", ExpandHostPath("/build", "/etc/ssl/ca.pem"))
+	require.Equal(t, "/build/certs/ca.pem", ExpandHostPath("/build", "certs/ca.pem"))
+	require.Equal(t, filepath.Join(home, "ca.pem"), ExpandHostPath("/build", "~/ca.pem"))
+	require.Equal(t, home, ExpandHostPath("/build", "~"))
+}
+
+func TestReplaceDir(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	require.Nil(t, os.MkdirAll(src, 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "new"), []byte("new"), 0644))
+	require.Nil(t, os.MkdirAll(dst, 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(dst, "old"), []byte("old"), 0644))
+
+	require.Nil(t, ReplaceDir(src, dst))
+	content, err := os.ReadFile(filepath.Join(dst, "new"))
+	require.Nil(t, err)
+	require.Equal(t, "new", string(content))
+	for _, f := range []string{src, filepath.Join(dst, "old"), dst + ".old"} {
+		_, err := os.Stat(f)
+		require.True(t, os.IsNotExist(err), "%s is expected to be removed", f)
+	}
+
+	require.Error(t, ReplaceDir(src, dst), "src does not exist")
+	_, err = os.Stat(filepath.Join(dst, "new"))
+	require.Nil(t, err, "dst is expected to be restored")
+}
+
+func TestReadFileInDir(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "project")
+	require.Nil(t, os.MkdirAll(filepath.Join(project, "sub"), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(project, "sub", "VERSION"), []byte("1.2.3\n"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644))
+	require.Nil(t, os.Symlink(filepath.Join(dir, "secret"), filepath.Join(project, "link")))
+
+	content, err := ReadFileInDir(project, "sub/VERSION", 1024)
+	require.Nil(t, err)
+	require.Equal(t, "1.2.3\n", string(content))
+	_, err = ReadFileInDir(project, filepath.Join(project, "sub", "VERSION"), 1024)
+	require.Nil(t, err, "the absolute path in the dir is allowed")
+
+	for _, path := range []string{"../secret", filepath.Join(dir, "secret"), "link", "sub", "missing"} {
+		_, err := ReadFileInDir(project, path, 1024)
+		require.Error(t, err, path)
+	}
+	_, err = ReadFileInDir(project, "sub/VERSION", 3)
+	require.Error(t, err, "the file is larger than the limit")
+}
+
+func TestEnvdDir(t *testing.T) {
+	t.Setenv(EnvCacheDir, "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	require.Equal(t, "/home/envd/.cache/envd",
+		envdDir(EnvCacheDir, "XDG_CACHE_HOME", "/home/envd/.cache"))
+	t.Setenv("XDG_CACHE_HOME", "relative")
+	require.Equal(t, "/home/envd/.cache/envd",
+		envdDir(EnvCacheDir, "XDG_CACHE_HOME", "/home/envd/.cache"))
+	t.Setenv("XDG_CACHE_HOME", "/xdg")
+	require.Equal(t, "/xdg/envd",
+		envdDir(EnvCacheDir, "XDG_CACHE_HOME", "/home/envd/.cache"))
+	t.Setenv(EnvCacheDir, "/data/envd-cache")
+	require.Equal(t, "/data/envd-cache",
+		envdDir(EnvCacheDir, "XDG_CACHE_HOME", "/home/envd/.cache"))
+}
+
+func TestSetCacheDir(t *testing.T) {
+	cacheDir, libDir := DefaultCacheDir, DefaultEnvdLibDir
+	defer func() {
+		DefaultCacheDir, DefaultEnvdLibDir = cacheDir, libDir
+	}()
+	require.Nil(t, SetCacheDir("/data/envd"))
+	require.Equal(t, "/data/envd", DefaultCacheDir)
+	require.Equal(t, "/data/envd/envdlib", DefaultEnvdLibDir)
+	require.Nil(t, SetCacheDir("cache"))
+	require.True(t, filepath.IsAbs(DefaultCacheDir))
+}
+
+func TestLock(t *testing.T) {
+	cacheDir := DefaultCacheDir
+	defer func() { DefaultCacheDir = cacheDir }()
+	DefaultCacheDir = t.TempDir()
+
+	unlock, err := Lock(context.Background(), "test")
+	require.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_, err = Lock(ctx, "test")
+	require.Error(t, err, "the lock is held")
+
+	unlock()
+	unlock, err = Lock(context.Background(), "test")
+	require.Nil(t, err)
+	unlock()
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gofrs/flock"
+
+	"github.com/tensorchord/envd/pkg/log"
+)
+
+const (
+	// lockDir keeps the advisory locks in the cache dir.
+	lockDir        = "locks"
+	lockRetryDelay = 100 * time.Millisecond
+)
+
+// Lock acquires the advisory lock of the name, thus the concurrent envd
+// processes, e.g. envd up in different repos, never write the shared state
+// at the same time. It waits until the lock is released or the ctx is done,
+// and the returned func releases it.
+func Lock(ctx context.Context, name string) (func(), error) {
+	dir := filepath.Join(DefaultCacheDir, lockDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create the lock dir")
+	}
+	path, err := validateAndJoin(dir, name+".lock")
+	if err != nil {
+		return nil, err
+	}
+	l := flock.New(path)
+	ok, err := l.TryLock()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to lock %s", name)
+	}
+	if !ok {
+		log.Infof("waiting for another envd process to release the lock of %s", name)
+		if _, err := l.TryLockContext(ctx, lockRetryDelay); err != nil {
+			return nil, errors.Wrapf(err, "failed to lock %s", name)
+		}
+	}
+	return func() {
+		if err := l.Unlock(); err != nil {
+			log.Warnf("failed to unlock %s: %s", name, err)
+		}
+	}, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitutil
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// DefaultSections are the sections of the host git config propagated into
+// the environment by default, i.e. the identity and the aliases.
+var DefaultSections = []string{"user", "alias"}
+
+// HostConfig reads the git config of the user on the host, i.e. ~/.gitconfig
+// or $XDG_CONFIG_HOME/git/config.
+func HostConfig() ([]byte, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get the home dir")
+	}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	for _, path := range []string{
+		filepath.Join(home, ".gitconfig"),
+		filepath.Join(xdg, "git", "config"),
+	} {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			return content, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to read the git config %s", path)
+		}
+	}
+	return nil, errors.New("the git config is not found on the host")
+}
+
+// FilterConfig keeps the sections of the git config, e.g. user, alias. The
+// subsections are kept with their section, e.g. [url "git@github.com:"]
+// with url.
+func FilterConfig(content []byte, sections []string) []byte {
+	keep := make(map[string]bool, len(sections))
+	for _, s := range sections {
+		keep[strings.ToLower(s)] = true
+	}
+
+	var buf bytes.Buffer
+	kept := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "[") {
+			kept = keep[sectionName(trimmed)]
+		}
+		if kept {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// sectionName returns the lower case name of the section header, e.g. url
+// for [url "git@github.com:"] and [url.git@github.com:].
+func sectionName(header string) string {
+	name := strings.TrimPrefix(header, "[")
+	if i := strings.IndexAny(name, " \t\".]"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ToLower(name)
+}
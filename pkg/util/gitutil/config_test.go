@@ -0,0 +1,47 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterConfig(t *testing.T) {
+	content := `# the global config
+[User]
+	name = envd
+	email = envd@example.com
+[credential]
+	helper = store
+[alias]
+	co = checkout
+[url "git@github.com:"]
+	insteadOf = https://github.com/
+[alias.ci]
+`
+	expected := `[User]
+	name = envd
+	email = envd@example.com
+[alias]
+	co = checkout
+[alias.ci]
+`
+	assert.Equal(t, expected, string(FilterConfig([]byte(content), DefaultSections)))
+	assert.Contains(t, string(FilterConfig([]byte(content), []string{"url"})),
+		"insteadOf = https://github.com/")
+	assert.Empty(t, FilterConfig([]byte(content), nil))
+}
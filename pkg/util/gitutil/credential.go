@@ -0,0 +1,94 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+// Credential is the https credential of the host, see git credential.
+type Credential struct {
+	Protocol string
+	Host     string
+	Username string
+	Password string
+}
+
+// FillCredential gets the credential of the host from the credential helper
+// of git on the host, without prompting.
+func FillCredential(host string) (Credential, error) {
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\n\n", host))
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return Credential{}, errors.Wrapf(err, "failed to get the git credential of %s", host)
+	}
+	return parseCredential(out)
+}
+
+func parseCredential(out []byte) (Credential, error) {
+	var c Credential
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "protocol":
+			c.Protocol = v
+		case "host":
+			c.Host = v
+		case "username":
+			c.Username = v
+		case "password":
+			c.Password = v
+		}
+	}
+	if c.Host == "" || c.Username == "" || c.Password == "" {
+		return Credential{}, errors.New("the git credential is incomplete")
+	}
+	if c.Protocol == "" {
+		c.Protocol = "https"
+	}
+	return c, nil
+}
+
+// StoreLine returns the credential in the file format of git credential-store.
+func (c Credential) StoreLine() string {
+	u := url.URL{
+		Scheme: c.Protocol,
+		User:   url.UserPassword(c.Username, c.Password),
+		Host:   c.Host,
+	}
+	return u.String()
+}
+
+// CredentialHelperConfig returns the git config which gets the credentials
+// in the file by git credential-store. The file is read-only, thus the
+// helper only answers get instead of storing the credentials back.
+func CredentialHelperConfig(path string) []byte {
+	return []byte(fmt.Sprintf("[credential]\n\thelper = "+
+		"\"!f() { test $1 = get && git credential-store --file=%s get; }; f\"\n", path))
+}
@@ -15,7 +15,14 @@
 package netutil
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -25,3 +32,99 @@ func TestGetFreePort(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEqual(t, port, 0)
 }
+
+func TestWaitForTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, WaitForTCP(ctx, l.Addr().String(), "", 10*time.Millisecond))
+}
+
+func TestWaitForTCPTimeout(t *testing.T) {
+	port, err := GetFreePort()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, WaitForTCP(ctx, fmt.Sprintf("127.0.0.1:%d", port), "", 10*time.Millisecond))
+}
+
+func TestWaitForTCPBanner(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	var conns int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// The first connection is closed without the banner, like the
+			// published port before the server in the container listens.
+			if atomic.AddInt32(&conns, 1) > 1 {
+				_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_8.9\r\n"))
+			}
+			conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, WaitForTCP(ctx, l.Addr().String(), "SSH-", 10*time.Millisecond))
+	assert.Greater(t, atomic.LoadInt32(&conns), int32(1))
+}
+
+func TestWaitForHTTP(t *testing.T) {
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, WaitForHTTP(ctx, s.URL, 10*time.Millisecond))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestProxyHTTPClient(t *testing.T) {
+	for _, env := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy",
+		"NO_PROXY", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("HTTP_PROXY", "http://env-proxy:3128")
+	p := Proxy{
+		HTTPProxy:  "http://proxy:3128",
+		HTTPSProxy: "http://proxy:3129",
+		NoProxy:    "internal.example.com",
+	}
+	transport := p.HTTPClient().Transport.(*http.Transport)
+	testcases := []struct {
+		url, expected string
+	}{
+		// The env takes precedence.
+		{"http://example.com", "http://env-proxy:3128"},
+		{"https://example.com", "http://proxy:3129"},
+		{"https://internal.example.com", ""},
+	}
+	for _, tc := range testcases {
+		req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+		assert.NoError(t, err)
+		proxy, err := transport.Proxy(req)
+		assert.NoError(t, err)
+		actual := ""
+		if proxy != nil {
+			actual = proxy.String()
+		}
+		assert.Equal(t, tc.expected, actual, tc.url)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netutil
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+// bannerTimeout bounds reading the banner if the context has no deadline.
+const bannerTimeout = 5 * time.Second
+
+// WaitForTCP polls the address until it accepts TCP connections. If the
+// banner is not empty, the server is ready only after it sends the banner,
+// e.g. "SSH-" of the ssh server, since the published port of the container
+// accepts the connections before the server in the container listens.
+func WaitForTCP(ctx context.Context, addr, banner string, interval time.Duration) error {
+	return poll(ctx, interval, func() error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if banner == "" {
+			return nil
+		}
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(bannerTimeout)
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+		buf := make([]byte, len(banner))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return errors.Wrap(err, "failed to read the banner")
+		}
+		if string(buf) != banner {
+			return errors.Newf("unexpected banner %q", buf)
+		}
+		return nil
+	})
+}
+
+// WaitForHTTP polls the URL until it responds with a non-5xx status code.
+func WaitForHTTP(ctx context.Context, url string, interval time.Duration) error {
+	return poll(ctx, interval, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return errors.Newf("unexpected status code %d", resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+func poll(ctx context.Context, interval time.Duration, probe func() error) error {
+	for {
+		err := probe()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(err, "not ready before the deadline")
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netutil
+
+import (
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Proxy is the proxy of the requests sent by envd on the host, e.g. the
+// downloads of the vscode extensions. The env, e.g. HTTPS_PROXY, takes
+// precedence over it.
+type Proxy struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+}
+
+// HTTPClient returns the client which sends the requests through the proxy.
+func (p Proxy) HTTPClient() *http.Client {
+	cfg := httpproxy.FromEnvironment()
+	if cfg.HTTPProxy == "" {
+		cfg.HTTPProxy = p.HTTPProxy
+	}
+	if cfg.HTTPSProxy == "" {
+		cfg.HTTPSProxy = p.HTTPSProxy
+	}
+	if cfg.NoProxy == "" {
+		cfg.NoProxy = p.NoProxy
+	}
+	proxy := cfg.ProxyFunc()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osutil
+
+import (
+	"os/exec"
+	"runtime"
+
+	"github.com/cockroachdb/errors"
+)
+
+// OpenBrowser opens the URL in the default browser of the host.
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		if IsWsl() {
+			cmd = exec.Command("wslview", url)
+		} else {
+			cmd = exec.Command("xdg-open", url)
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "failed to open %s in the browser", url)
+	}
+	return nil
+}
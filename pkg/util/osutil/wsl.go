@@ -26,7 +26,8 @@ import (
 	"strings"
 
 	"github.com/cockroachdb/errors"
-	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd/pkg/log"
 )
 
 func IsWsl() bool {
@@ -34,7 +35,7 @@ func IsWsl() bool {
 	cmd := exec.Command("cat", "/proc/version")
 	output, err := cmd.Output()
 	if err != nil {
-		logrus.Debugf("Error when check whether sys is WSL: %v", err)
+		log.Debugf("Error when check whether sys is WSL: %v", err)
 		return false
 	}
 
@@ -54,7 +55,7 @@ func GetWslHostSshConfig() (string, error) {
 		return "", err
 	}
 	outputPath := path.Join(strings.Trim(string(output), "\n"), ".ssh", "config")
-	logrus.Debugf("wsl sshconfig path: %s", outputPath)
+	log.Debugf("wsl sshconfig path: %s", outputPath)
 	return outputPath, nil
 }
 
@@ -0,0 +1,75 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starlarkutil
+
+import (
+	"github.com/cockroachdb/errors"
+
+	"go.starlark.net/starlark"
+)
+
+// ToGo converts the starlark value to the Go value which can be marshaled
+// to JSON, e.g. the dict is converted to map[string]interface{}. The keys
+// of the dicts must be strings.
+func ToGo(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, errors.Newf("Conversion failed, %s overflows int64", v)
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return v.GoString(), nil
+	case *starlark.List:
+		return toGoSlice(v)
+	case starlark.Tuple:
+		return toGoSlice(v)
+	case *starlark.Dict:
+		m := map[string]interface{}{}
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, errors.Newf("Conversion failed, expect string key, but got %s as %s", item[0], item[0].Type())
+			}
+			value, err := ToGo(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	default:
+		return nil, errors.Newf("Conversion failed, unsupported type %s of %s", v.Type(), v)
+	}
+}
+
+func toGoSlice(v starlark.Indexable) ([]interface{}, error) {
+	s := []interface{}{}
+	for i := 0; i < v.Len(); i++ {
+		value, err := ToGo(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, value)
+	}
+	return s, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The envd Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starlarkutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.starlark.net/starlark"
+)
+
+func TestToGoDict(t *testing.T) {
+	d := starlark.NewDict(3)
+	assert.Nil(t, d.SetKey(starlark.String("editor.formatOnSave"), starlark.True))
+	assert.Nil(t, d.SetKey(starlark.String("editor.tabSize"), starlark.MakeInt(4)))
+	assert.Nil(t, d.SetKey(starlark.String("files.exclude"), starlark.NewList(
+		[]starlark.Value{starlark.String("*.pyc"), starlark.Float(0.5), starlark.None})))
+	v, err := ToGo(d)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"editor.formatOnSave": true,
+		"editor.tabSize":      int64(4),
+		"files.exclude":       []interface{}{"*.pyc", 0.5, nil},
+	}, v)
+}
+
+func TestToGoInvalidKey(t *testing.T) {
+	d := starlark.NewDict(1)
+	assert.Nil(t, d.SetKey(starlark.MakeInt(1), starlark.True))
+	_, err := ToGo(d)
+	assert.ErrorContains(t, err, "1 as int")
+}
+
+func TestToGoUnsupportedType(t *testing.T) {
+	_, err := ToGo(starlark.NewSet(0))
+	assert.ErrorContains(t, err, "unsupported type set")
+}